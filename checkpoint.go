@@ -63,8 +63,10 @@ func ParseCheckpoint(text string) (Checkpoint, error) {
 		return Checkpoint{}, errors.New("malformed checkpoint")
 	}
 
+	// The decoder ignores newlines and non-zero padding bits, so check that the
+	// hash has a single encoding, like the rest of the checkpoint.
 	h, err := base64.StdEncoding.DecodeString(lines[2])
-	if err != nil || len(h) != tlog.HashSize {
+	if err != nil || len(h) != tlog.HashSize || base64.StdEncoding.EncodeToString(h) != lines[2] {
 		return Checkpoint{}, errors.New("malformed checkpoint")
 	}
 
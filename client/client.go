@@ -0,0 +1,362 @@
+// Package client implements a client for the monitoring API of Sunlight logs,
+// specified at c2sp.org/sunlight.
+//
+// It fetches and verifies checkpoints, reads hash and data tiles and verifies
+// them against a checkpoint, and parses the log entries, so that monitors
+// don't need to reimplement the tile format.
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"time"
+
+	"filippo.io/sunlight"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// TileHeight is the height of the tiles of Sunlight logs.
+const TileHeight = 8
+const tileWidth = 1 << TileHeight
+
+const maxCheckpointSize = 1e6
+const maxTileSize = 64 << 20
+
+const defaultPollInterval = 5 * time.Second
+
+// Config is the configuration of a [Client].
+type Config struct {
+	// MonitoringPrefix is the URL prefix of the log's monitoring API, where
+	// the checkpoint, tiles, and issuers bundle are published.
+	MonitoringPrefix string
+
+	// Name is the name of the log, which is the origin line of its
+	// checkpoints.
+	Name string
+
+	// PublicKey is the public key of the log.
+	PublicKey crypto.PublicKey
+
+	// HTTPClient is used for all requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// UserAgent is the User-Agent header of all requests. If empty, a default
+	// is used. Monitor operators are encouraged to include contact details.
+	UserAgent string
+
+	// PollInterval is how often [Client.Tail] fetches the checkpoint. If zero,
+	// it defaults to five seconds.
+	PollInterval time.Duration
+}
+
+// A Client reads a Sunlight log through its monitoring API.
+//
+// A Client is safe for concurrent use.
+type Client struct {
+	c  Config
+	hc *http.Client
+}
+
+// New returns a new Client for the log described by config.
+func New(config *Config) (*Client, error) {
+	if config.MonitoringPrefix == "" {
+		return nil, errors.New("MonitoringPrefix is required")
+	}
+	// Check that Name and PublicKey are valid.
+	if _, err := sunlight.NewRFC6962Verifier(config.Name, config.PublicKey, nil); err != nil {
+		return nil, fmt.Errorf("invalid log name or public key: %w", err)
+	}
+	c := &Client{c: *config, hc: config.HTTPClient}
+	if c.hc == nil {
+		c.hc = http.DefaultClient
+	}
+	if c.c.UserAgent == "" {
+		c.c.UserAgent = "filippo.io/sunlight/client"
+	}
+	if c.c.PollInterval == 0 {
+		c.c.PollInterval = defaultPollInterval
+	}
+	return c, nil
+}
+
+// A Checkpoint is a verified checkpoint of the log.
+type Checkpoint struct {
+	sunlight.Checkpoint
+
+	// Timestamp is the timestamp of the RFC 6962 signature, in milliseconds
+	// since the epoch.
+	Timestamp int64
+
+	// Signed is the signed note, as published by the log.
+	Signed []byte
+}
+
+// Checkpoint fetches the latest checkpoint of the log, and verifies its
+// signature and origin.
+func (c *Client) Checkpoint(ctx context.Context) (*Checkpoint, error) {
+	signed, err := c.fetch(ctx, "checkpoint", maxCheckpointSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checkpoint: %w", err)
+	}
+	return c.VerifyCheckpoint(signed)
+}
+
+// VerifyCheckpoint verifies the signature and origin of a checkpoint obtained
+// by other means, such as from a mirror.
+func (c *Client) VerifyCheckpoint(signed []byte) (*Checkpoint, error) {
+	var timestamp uint64
+	v, err := sunlight.NewRFC6962Verifier(c.c.Name, c.c.PublicKey, func(t uint64) { timestamp = t })
+	if err != nil {
+		return nil, err
+	}
+	n, err := note.Open(signed, note.VerifierList(v))
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint signature: %w", err)
+	}
+	cp, err := sunlight.ParseCheckpoint(n.Text)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse checkpoint: %w", err)
+	}
+	if cp.Origin != c.c.Name {
+		return nil, fmt.Errorf("checkpoint origin %q doesn't match log name %q", cp.Origin, c.c.Name)
+	}
+	return &Checkpoint{Checkpoint: cp, Timestamp: int64(timestamp), Signed: signed}, nil
+}
+
+// Issuers fetches the issuers bundle of the log, a sequence of PEM
+// certificates. It's not verified, as it's not covered by the checkpoint.
+func (c *Client) Issuers(ctx context.Context) ([]byte, error) {
+	b, err := c.fetch(ctx, "issuers.pem", maxTileSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch issuers: %w", err)
+	}
+	return b, nil
+}
+
+// ReadTile fetches a hash tile, or a data tile if t.L is -1. The returned
+// tile is not verified.
+//
+// If t is a partial tile that is not available anymore, the full tile is
+// fetched and truncated to t.W hashes or entries instead. Data tiles are
+// decompressed if they were stored compressed.
+func (c *Client) ReadTile(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	if t.H != TileHeight {
+		return nil, fmt.Errorf("unsupported tile height %d", t.H)
+	}
+	b, err := c.fetchTile(ctx, t)
+	if errors.Is(err, errNotFound) && t.W < tileWidth {
+		full := t
+		full.W = tileWidth
+		if b, err = c.fetchTile(ctx, full); err == nil {
+			b, err = truncateTile(b, t)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tile %s: %w", t.Path(), err)
+	}
+	return b, nil
+}
+
+func (c *Client) fetchTile(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	b, err := c.fetch(ctx, t.Path(), maxTileSize)
+	if err != nil {
+		return nil, err
+	}
+	// Data tiles are uploaded compressed, and are usually served with a
+	// Content-Encoding that the HTTP client transparently decodes, but
+	// mirrors might serve the compressed object as is. Data tiles start with
+	// a timestamp that would be millions of years in the future if it
+	// started with the gzip magic.
+	if t.L == -1 && bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		b, err = io.ReadAll(io.LimitReader(r, maxTileSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > maxTileSize {
+			return nil, errors.New("decompressed tile is too large")
+		}
+	}
+	return b, nil
+}
+
+// truncateTile returns the first t.W hashes or entries of a full tile.
+func truncateTile(b []byte, t tlog.Tile) ([]byte, error) {
+	if t.L != -1 {
+		if len(b) < t.W*tlog.HashSize {
+			return nil, errors.New("full tile is too short")
+		}
+		return b[:t.W*tlog.HashSize], nil
+	}
+	rest := b
+	for i := 0; i < t.W; i++ {
+		var err error
+		if _, rest, err = ReadTileLeaf(rest); err != nil {
+			return nil, err
+		}
+	}
+	return b[:len(b)-len(rest)], nil
+}
+
+// HashReader returns a tlog.HashReader that reads hashes from the tiles of
+// tree, and verifies them against its root hash.
+func (c *Client) HashReader(ctx context.Context, tree tlog.Tree) tlog.HashReader {
+	return tlog.TileHashReader(tree, &tileReader{ctx: ctx, c: c, saved: make(map[int]tileWithBytes)})
+}
+
+type tileWithBytes struct {
+	tlog.Tile
+	B []byte
+}
+
+// tileReader keeps the last verified tile of each level, since sequential
+// reads use the same upper level tiles over and over.
+type tileReader struct {
+	ctx   context.Context
+	c     *Client
+	saved map[int]tileWithBytes
+}
+
+func (r *tileReader) Height() int {
+	return TileHeight
+}
+
+func (r *tileReader) ReadTiles(tiles []tlog.Tile) (data [][]byte, err error) {
+	for _, t := range tiles {
+		if s, ok := r.saved[t.L]; ok && s.Tile == t {
+			data = append(data, s.B)
+			continue
+		}
+		b, err := r.c.ReadTile(r.ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b)
+	}
+	return data, nil
+}
+
+func (r *tileReader) SaveTiles(tiles []tlog.Tile, data [][]byte) {
+	for i, t := range tiles {
+		r.saved[t.L] = tileWithBytes{t, data[i]}
+	}
+}
+
+// DataTile fetches data tile n of tree, and returns its entries after
+// verifying them against tree.
+func (c *Client) DataTile(ctx context.Context, tree tlog.Tree, n int64) ([]*Entry, error) {
+	return c.dataTile(ctx, c.HashReader(ctx, tree), tree, n)
+}
+
+func (c *Client) dataTile(ctx context.Context, hr tlog.HashReader, tree tlog.Tree, n int64) ([]*Entry, error) {
+	start := n * tileWidth
+	if n < 0 || start >= tree.N {
+		return nil, fmt.Errorf("data tile %d is not in tree of size %d", n, tree.N)
+	}
+	tile := tlog.Tile{H: TileHeight, L: -1, N: n, W: int(min(tileWidth, tree.N-start))}
+	indexes := make([]int64, 0, tile.W)
+	for i := start; i < start+int64(tile.W); i++ {
+		indexes = append(indexes, tlog.StoredHashIndex(0, i))
+	}
+	hashes, err := hr.ReadHashes(indexes)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read level 0 hashes: %w", err)
+	}
+	b, err := c.ReadTile(ctx, tile)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, tile.W)
+	for i := range hashes {
+		e, rest, err := ReadTileLeaf(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data tile %s: %w", tile.Path(), err)
+		}
+		b = rest
+		if idx := start + int64(i); e.LeafIndex != idx {
+			return nil, fmt.Errorf("data tile leaf %d has index %d", idx, e.LeafIndex)
+		}
+		if got := tlog.RecordHash(e.MerkleTreeLeaf()); got != hashes[i] {
+			return nil, fmt.Errorf("data tile leaf %d hashes to %v, level 0 hash is %v", e.LeafIndex, got, hashes[i])
+		}
+		entries = append(entries, e)
+	}
+	if len(b) != 0 {
+		return nil, fmt.Errorf("invalid data tile %s: trailing data", tile.Path())
+	}
+	return entries, nil
+}
+
+// Entries returns an iterator over the entries of tree, starting at index
+// start. Each data tile is verified against tree before its entries are
+// yielded.
+//
+// If an error occurs, it's yielded with a nil Entry, and the iteration stops.
+func (c *Client) Entries(ctx context.Context, tree tlog.Tree, start int64) iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		if start < 0 || start > tree.N {
+			yield(nil, fmt.Errorf("start %d is not in tree of size %d", start, tree.N))
+			return
+		}
+		hr := c.HashReader(ctx, tree)
+		for n := start / tileWidth; n*tileWidth < tree.N; n++ {
+			entries, err := c.dataTile(ctx, hr, tree, n)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, e := range entries {
+				if e.LeafIndex < start {
+					continue
+				}
+				if !yield(e, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+var errNotFound = errors.New("not found")
+
+func (c *Client) fetch(ctx context.Context, key string, limit int64) ([]byte, error) {
+	url := strings.TrimSuffix(c.c.MonitoringPrefix, "/") + "/" + key
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.c.UserAgent)
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		// S3 returns 403 for missing objects if the bucket can't be listed.
+		return nil, fmt.Errorf("GET %s: %s: %w", url, resp.Status, errNotFound)
+	default:
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("GET %s: response exceeds %d bytes", url, limit)
+	}
+	return b, nil
+}
@@ -0,0 +1,94 @@
+package client_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	tl := newTestLog(t)
+	c := tl.Client
+	ctx := context.Background()
+
+	const precerts = (tileWidth + 10) / 3
+	tl.add(t, tileWidth+10-precerts, false)
+	tl.add(t, precerts, true)
+	cp, err := c.Checkpoint(ctx)
+	fatalIfErr(t, err)
+	if cp.N != tileWidth+10 {
+		t.Fatalf("checkpoint size is %d, expected %d", cp.N, tileWidth+10)
+	}
+	if cp.Timestamp == 0 {
+		t.Errorf("checkpoint timestamp is zero")
+	}
+	var leaves [][]byte
+	var gotPrecerts int
+	for e, err := range c.Entries(ctx, cp.Tree, 0) {
+		fatalIfErr(t, err)
+		if e.LeafIndex != int64(len(leaves)) {
+			t.Fatalf("got entry %d, expected %d", e.LeafIndex, len(leaves))
+		}
+		if e.IsPrecert {
+			gotPrecerts++
+		}
+		leaves = append(leaves, e.MerkleTreeLeaf())
+	}
+	if len(leaves) != tileWidth+10 {
+		t.Fatalf("got %d entries, expected %d", len(leaves), tileWidth+10)
+	}
+	if gotPrecerts != precerts {
+		t.Errorf("got %d precertificate entries, expected %d", gotPrecerts, precerts)
+	}
+	var n int64
+	for e, err := range c.Entries(ctx, cp.Tree, tileWidth+5) {
+		fatalIfErr(t, err)
+		if e.LeafIndex != tileWidth+5+n {
+			t.Fatalf("got entry %d, expected %d", e.LeafIndex, tileWidth+5+n)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("got %d entries starting at %d, expected 5", n, tileWidth+5)
+	}
+
+	// Fill the partial tiles, and remove them, so that the client has to fall
+	// back to the full tiles for the old tree.
+	tl.add(t, tileWidth, false)
+	tl.backend.set("tile/8/data/001.p/10", nil)
+	tl.backend.set("tile/8/0/001.p/10", nil)
+	for _, key := range []string{"tile/8/data/000", "tile/8/data/001"} {
+		// Mirrors might serve the compressed objects as is.
+		data, err := tl.backend.Fetch(ctx, key)
+		fatalIfErr(t, err)
+		buf := &bytes.Buffer{}
+		w := gzip.NewWriter(buf)
+		w.Write(data)
+		w.Close()
+		tl.backend.set(key, buf.Bytes())
+	}
+	entries, err := c.DataTile(ctx, cp.Tree, 1)
+	fatalIfErr(t, err)
+	if len(entries) != 10 {
+		t.Fatalf("got %d entries from old partial tile, expected 10", len(entries))
+	}
+	for i, e := range entries {
+		if !bytes.Equal(e.MerkleTreeLeaf(), leaves[tileWidth+i]) {
+			t.Errorf("entry %d changed", e.LeafIndex)
+		}
+	}
+
+	hashTile, err := tl.backend.Fetch(ctx, "tile/8/0/000")
+	fatalIfErr(t, err)
+	hashTile[0] ^= 0xff
+	tl.backend.set("tile/8/0/000", hashTile)
+	if _, err := c.DataTile(ctx, cp.Tree, 0); err == nil {
+		t.Errorf("DataTile succeeded with corrupted hash tile")
+	}
+
+	tl.backend.set("checkpoint", bytes.Replace(cp.Signed, []byte("sunlighttest"), []byte("sunlighttost"), 1))
+	if _, err := c.Checkpoint(ctx); err == nil {
+		t.Errorf("Checkpoint succeeded with wrong origin")
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// An Entry is a log entry, as stored in the data tiles of a Sunlight log.
+type Entry struct {
+	// Certificate is either the x509_entry or the tbs_certificate for precerts.
+	Certificate []byte
+
+	IsPrecert          bool
+	IssuerKeyHash      [32]byte
+	PreCertificate     []byte
+	PrecertSigningCert []byte
+
+	LeafIndex int64
+	// Timestamp is the SCT timestamp, in milliseconds since the epoch.
+	Timestamp int64
+}
+
+// MerkleTreeLeaf returns the RFC 6962 MerkleTreeLeaf of the entry, whose
+// tlog.RecordHash is the leaf hash in the Merkle tree.
+func (e *Entry) MerkleTreeLeaf() []byte {
+	b := &cryptobyte.Builder{}
+	b.AddUint8(0 /* version = v1 */)
+	b.AddUint8(0 /* leaf_type = timestamped_entry */)
+	b.AddUint64(uint64(e.Timestamp))
+	if !e.IsPrecert {
+		b.AddUint16(0 /* entry_type = x509_entry */)
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(e.Certificate)
+		})
+	} else {
+		b.AddUint16(1 /* entry_type = precert_entry */)
+		b.AddBytes(e.IssuerKeyHash[:])
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(e.Certificate)
+		})
+	}
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(0 /* extension_type = leaf_index */)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			v := uint64(e.LeafIndex)
+			b.AddBytes([]byte{byte(v >> 32), byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+		})
+	})
+	return b.BytesOrPanic()
+}
+
+// ReadTileLeaf parses the first TileLeaf in a data tile, and returns the rest
+// of the tile.
+func ReadTileLeaf(tile []byte) (e *Entry, rest []byte, err error) {
+	e = &Entry{}
+	s := cryptobyte.String(tile)
+	var timestamp uint64
+	var entryType uint16
+	var extensions cryptobyte.String
+	if !s.ReadUint64(&timestamp) || !s.ReadUint16(&entryType) || timestamp > math.MaxInt64 {
+		return nil, s, errors.New("invalid data tile")
+	}
+	e.Timestamp = int64(timestamp)
+	switch entryType {
+	case 0: // x509_entry
+		if !s.ReadUint24LengthPrefixed((*cryptobyte.String)(&e.Certificate)) ||
+			!s.ReadUint16LengthPrefixed(&extensions) {
+			return nil, s, errors.New("invalid data tile x509_entry")
+		}
+	case 1: // precert_entry
+		e.IsPrecert = true
+		if !s.CopyBytes(e.IssuerKeyHash[:]) ||
+			!s.ReadUint24LengthPrefixed((*cryptobyte.String)(&e.Certificate)) ||
+			!s.ReadUint16LengthPrefixed(&extensions) ||
+			!s.ReadUint24LengthPrefixed((*cryptobyte.String)(&e.PreCertificate)) ||
+			!s.ReadUint24LengthPrefixed((*cryptobyte.String)(&e.PrecertSigningCert)) {
+			return nil, s, errors.New("invalid data tile precert_entry")
+		}
+	default:
+		return nil, s, fmt.Errorf("invalid data tile: unknown type %d", entryType)
+	}
+	var extensionType uint8
+	var extensionData, leafIndex cryptobyte.String
+	if !extensions.ReadUint8(&extensionType) || extensionType != 0 ||
+		!extensions.ReadUint16LengthPrefixed(&extensionData) ||
+		!extensionData.ReadBytes((*[]byte)(&leafIndex), 5) || !extensionData.Empty() ||
+		!extensions.Empty() {
+		return nil, s, errors.New("invalid data tile extensions")
+	}
+	e.LeafIndex = int64(leafIndex[0])<<32 | int64(leafIndex[1])<<24 |
+		int64(leafIndex[2])<<16 | int64(leafIndex[3])<<8 | int64(leafIndex[4])
+	return e, s, nil
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// An IssuerSet is a parsed issuers bundle, which holds every certificate that
+// the log accepted as part of a submitted chain, indexed so that the chain of
+// each entry can be reconstructed.
+//
+// The certificates are not parsed beyond the fields used for the indexes, so
+// that unusual encodings accepted by the log don't make the bundle unusable.
+type IssuerSet struct {
+	// Certificates are the DER-encoded certificates of the bundle, in order.
+	Certificates [][]byte
+
+	// ByKeyHash maps the SHA-256 hash of each SubjectPublicKeyInfo to the
+	// certificates with that public key, like the IssuerKeyHash of
+	// precertificate entries.
+	ByKeyHash map[[sha256.Size]byte][][]byte
+
+	// bySubject maps each raw DER-encoded subject to the certificates with
+	// that name.
+	bySubject map[string][][]byte
+}
+
+// IssuerSet fetches and parses the issuers bundle of the log. Like
+// [Client.Issuers], it's not verified, but see [IssuerSet.Issuers].
+func (c *Client) IssuerSet(ctx context.Context) (*IssuerSet, error) {
+	b, err := c.Issuers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIssuerSet(b)
+}
+
+// ParseIssuerSet parses an issuers bundle, a sequence of PEM certificates.
+func ParseIssuerSet(b []byte) (*IssuerSet, error) {
+	s := &IssuerSet{
+		ByKeyHash: make(map[[sha256.Size]byte][][]byte),
+		bySubject: make(map[string][][]byte),
+	}
+	for len(b) > 0 {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block %q in issuers", block.Type)
+		}
+		subject, spki, err := parseIssuerCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate %d in issuers: %w", len(s.Certificates), err)
+		}
+		keyHash := sha256.Sum256(spki)
+		s.Certificates = append(s.Certificates, block.Bytes)
+		s.ByKeyHash[keyHash] = append(s.ByKeyHash[keyHash], block.Bytes)
+		s.bySubject[string(subject)] = append(s.bySubject[string(subject)], block.Bytes)
+	}
+	return s, nil
+}
+
+// Issuers returns the candidate issuers of the certificate of e from the set.
+//
+// For precertificates, they are the certificates whose public key hashes to
+// e.IssuerKeyHash, which is covered by the Merkle tree, so a precertificate
+// with no candidates is evidence of a missing issuer. For other entries,
+// they are the certificates whose subject matches the issuer name of the
+// entry certificate. The signatures are not checked.
+//
+// If there are no candidates, Issuers returns an error.
+func (s *IssuerSet) Issuers(e *Entry) ([][]byte, error) {
+	if e.IsPrecert {
+		issuers := s.ByKeyHash[e.IssuerKeyHash]
+		if len(issuers) == 0 {
+			return nil, fmt.Errorf("entry %d: issuer key hash %x not in issuers", e.LeafIndex, e.IssuerKeyHash)
+		}
+		return issuers, nil
+	}
+	tbs, err := readTBS(e.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("entry %d: %w", e.LeafIndex, err)
+	}
+	issuer, err := readTBSIssuer(tbs)
+	if err != nil {
+		return nil, fmt.Errorf("entry %d: %w", e.LeafIndex, err)
+	}
+	issuers := s.bySubject[string(issuer)]
+	if len(issuers) == 0 {
+		return nil, fmt.Errorf("entry %d: issuer of certificate not in issuers", e.LeafIndex)
+	}
+	return issuers, nil
+}
+
+// Chain returns the chain of the entry certificate, starting with its issuer
+// and ending with a self-issued certificate, following the first candidate
+// from the set at each step. For precertificates signed by a Precertificate
+// Signing Certificate, the chain starts with it.
+func (s *IssuerSet) Chain(e *Entry) ([][]byte, error) {
+	var chain [][]byte
+	if e.IsPrecert && len(e.PrecertSigningCert) > 0 {
+		// The issuer key hash is that of the certificate that issued the
+		// Precertificate Signing Certificate.
+		chain = append(chain, e.PrecertSigningCert)
+	}
+	next, err := s.Issuers(e)
+	if err != nil {
+		return nil, err
+	}
+	for range maxChainLength {
+		cert := next[0]
+		chain = append(chain, cert)
+		tbs, err := readTBS(cert)
+		if err != nil {
+			return nil, err
+		}
+		issuer, err := readTBSIssuer(tbs)
+		if err != nil {
+			return nil, err
+		}
+		subject, _, err := parseIssuerCertificate(cert)
+		if err != nil {
+			return nil, err
+		}
+		if string(issuer) == string(subject) {
+			return chain, nil
+		}
+		if next = s.bySubject[string(issuer)]; len(next) == 0 {
+			return nil, fmt.Errorf("entry %d: chain is incomplete after %d certificates", e.LeafIndex, len(chain))
+		}
+	}
+	return nil, fmt.Errorf("entry %d: chain is longer than %d certificates", e.LeafIndex, maxChainLength)
+}
+
+// maxChainLength is the maximum length of a chain returned by
+// [IssuerSet.Chain], to stop at loops in the issuers bundle.
+const maxChainLength = 10
+
+// parseIssuerCertificate returns the raw subject and SubjectPublicKeyInfo of
+// a DER-encoded certificate.
+func parseIssuerCertificate(der []byte) (subject, spki []byte, err error) {
+	tbs, err := readTBS(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !skipTBSToIssuer(&tbs) ||
+		!tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) || // issuer
+		!tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) || // validity
+		!tbs.ReadASN1Element((*cryptobyte.String)(&subject), cryptobyte_asn1.SEQUENCE) ||
+		!tbs.ReadASN1Element((*cryptobyte.String)(&spki), cryptobyte_asn1.SEQUENCE) {
+		return nil, nil, errors.New("malformed tbsCertificate")
+	}
+	return subject, spki, nil
+}
+
+// readTBS returns the contents of the tbsCertificate of a DER-encoded
+// certificate.
+func readTBS(der []byte) (cryptobyte.String, error) {
+	cert := cryptobyte.String(der)
+	var c, tbs cryptobyte.String
+	if !cert.ReadASN1(&c, cryptobyte_asn1.SEQUENCE) ||
+		!c.ReadASN1(&tbs, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("malformed certificate")
+	}
+	return tbs, nil
+}
+
+// readTBSIssuer returns the raw issuer of the contents of a tbsCertificate.
+func readTBSIssuer(tbs cryptobyte.String) ([]byte, error) {
+	var issuer []byte
+	if !skipTBSToIssuer(&tbs) ||
+		!tbs.ReadASN1Element((*cryptobyte.String)(&issuer), cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("malformed tbsCertificate")
+	}
+	return issuer, nil
+}
+
+// skipTBSToIssuer skips the version, serial number, and signature algorithm
+// of the contents of a tbsCertificate.
+func skipTBSToIssuer(tbs *cryptobyte.String) bool {
+	return tbs.SkipOptionalASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) &&
+		tbs.SkipASN1(cryptobyte_asn1.INTEGER) &&
+		tbs.SkipASN1(cryptobyte_asn1.SEQUENCE)
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// InclusionProof returns the proof that the entry at index is included in
+// tree, which RFC 6962 calls a Merkle audit path, as returned by the
+// get-proof-by-hash endpoint of RFC 6962 logs.
+//
+// The proof is built from the hash tiles, fetching only those that contain
+// the needed hashes, and the hashes are verified against tree.
+func (c *Client) InclusionProof(ctx context.Context, tree tlog.Tree, index int64) (tlog.RecordProof, error) {
+	if index < 0 || index >= tree.N {
+		return nil, fmt.Errorf("index %d is not in tree of size %d", index, tree.N)
+	}
+	proof, err := tlog.ProveRecord(tree.N, index, c.HashReader(ctx, tree))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build inclusion proof: %w", err)
+	}
+	return proof, nil
+}
+
+// ConsistencyProof returns the proof that tree contains as a prefix the tree
+// of size oldSize, as returned by the get-sth-consistency endpoint of RFC 6962
+// logs.
+//
+// The proof is built from the hash tiles, fetching only those that contain
+// the needed hashes, and the hashes are verified against tree.
+func (c *Client) ConsistencyProof(ctx context.Context, tree tlog.Tree, oldSize int64) (tlog.TreeProof, error) {
+	if oldSize < 0 || oldSize > tree.N {
+		return nil, fmt.Errorf("old size %d is not valid for tree of size %d", oldSize, tree.N)
+	}
+	// RFC 6962 defines the consistency proof with the empty tree as empty,
+	// which tlog.ProveTree rejects.
+	if oldSize == 0 {
+		return tlog.TreeProof{}, nil
+	}
+	proof, err := tlog.ProveTree(tree.N, oldSize, c.HashReader(ctx, tree))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build consistency proof: %w", err)
+	}
+	return proof, nil
+}
@@ -0,0 +1,82 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"filippo.io/sunlight/client"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestProofs(t *testing.T) {
+	tl := newTestLog(t)
+	var fetches atomic.Int64
+	h := tl.Log.Log.Handler()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+
+	c, err := client.New(&client.Config{
+		MonitoringPrefix: ts.URL,
+		Name:             tl.Name,
+		PublicKey:        tl.Key.Public(),
+	})
+	fatalIfErr(t, err)
+
+	tl.add(t, tileWidth+10, false)
+	old, err := c.Checkpoint(ctx)
+	fatalIfErr(t, err)
+	tl.add(t, tileWidth*2+20, false)
+	cp, err := c.Checkpoint(ctx)
+	fatalIfErr(t, err)
+
+	for _, size := range []int64{0, 1, 5, tileWidth, old.N, cp.N - 1, cp.N} {
+		var oldHash tlog.Hash
+		if size > 0 {
+			oldHash, err = tlog.TreeHash(size, c.HashReader(ctx, cp.Tree))
+			fatalIfErr(t, err)
+		}
+		proof, err := c.ConsistencyProof(ctx, cp.Tree, size)
+		fatalIfErr(t, err)
+		if size == 0 {
+			if len(proof) != 0 {
+				t.Errorf("consistency proof with empty tree is not empty")
+			}
+			continue
+		}
+		if err := tlog.CheckTree(proof, cp.N, cp.Hash, size, oldHash); err != nil {
+			t.Errorf("consistency proof from %d: %v", size, err)
+		}
+	}
+	proof, err := c.ConsistencyProof(ctx, cp.Tree, old.N)
+	fatalIfErr(t, err)
+	fatalIfErr(t, tlog.CheckTree(proof, cp.N, cp.Hash, old.N, old.Hash))
+
+	entries, err := c.DataTile(ctx, cp.Tree, 1)
+	fatalIfErr(t, err)
+	for _, e := range entries[:5] {
+		fetches.Store(0)
+		proof, err := c.InclusionProof(ctx, cp.Tree, e.LeafIndex)
+		fatalIfErr(t, err)
+		if n := fetches.Load(); n > 3 {
+			t.Errorf("inclusion proof for %d took %d fetches", e.LeafIndex, n)
+		}
+		leafHash := tlog.RecordHash(e.MerkleTreeLeaf())
+		if err := tlog.CheckRecord(proof, cp.N, cp.Hash, e.LeafIndex, leafHash); err != nil {
+			t.Errorf("inclusion proof for %d: %v", e.LeafIndex, err)
+		}
+	}
+
+	if _, err := c.InclusionProof(ctx, cp.Tree, cp.N); err == nil {
+		t.Errorf("InclusionProof succeeded for index out of tree")
+	}
+	if _, err := c.ConsistencyProof(ctx, old.Tree, cp.N); err == nil {
+		t.Errorf("ConsistencyProof succeeded for size larger than tree")
+	}
+}
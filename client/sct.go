@@ -0,0 +1,193 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// An SCT is a RFC 6962 SignedCertificateTimestamp, version 1.
+type SCT struct {
+	LogID [sha256.Size]byte
+
+	// Timestamp is in milliseconds since the epoch.
+	Timestamp  int64
+	Extensions []byte
+
+	// HashAlgorithm and SignatureAlgorithm are the TLS algorithm identifiers
+	// of the signature, which are 4 (sha256) and 3 (ecdsa) for Sunlight logs.
+	HashAlgorithm      uint8
+	SignatureAlgorithm uint8
+	Signature          []byte
+}
+
+// ParseSCT parses a TLS-encoded SignedCertificateTimestamp, such as those in a
+// SignedCertificateTimestampList.
+func ParseSCT(b []byte) (*SCT, error) {
+	s := cryptobyte.String(b)
+	sct := &SCT{}
+	var version uint8
+	var timestamp uint64
+	var logID []byte
+	var extensions, signature cryptobyte.String
+	if !s.ReadUint8(&version) || !s.ReadBytes(&logID, sha256.Size) ||
+		!s.ReadUint64(&timestamp) || !s.ReadUint16LengthPrefixed(&extensions) ||
+		!s.ReadUint8(&sct.HashAlgorithm) || !s.ReadUint8(&sct.SignatureAlgorithm) ||
+		!s.ReadUint16LengthPrefixed(&signature) || !s.Empty() {
+		return nil, errors.New("invalid SCT encoding")
+	}
+	if version != 0 {
+		return nil, fmt.Errorf("unsupported SCT version %d", version)
+	}
+	copy(sct.LogID[:], logID)
+	sct.Timestamp = int64(timestamp)
+	sct.Extensions = extensions
+	sct.Signature = signature
+	return sct, nil
+}
+
+// ParseSCTList parses a TLS-encoded SignedCertificateTimestampList, as
+// embedded in certificates or sent in the TLS extension, and returns the
+// encoded SCTs, to be parsed with [ParseSCT].
+func ParseSCTList(b []byte) ([][]byte, error) {
+	s := cryptobyte.String(b)
+	var list cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&list) || !s.Empty() {
+		return nil, errors.New("invalid SCT list encoding")
+	}
+	var scts [][]byte
+	for !list.Empty() {
+		var sct cryptobyte.String
+		if !list.ReadUint16LengthPrefixed(&sct) {
+			return nil, errors.New("invalid SCT list encoding")
+		}
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// LeafIndex returns the index of the entry in the log, from the leaf_index
+// extension of SCTs issued by Sunlight logs.
+func (sct *SCT) LeafIndex() (int64, error) {
+	s := cryptobyte.String(sct.Extensions)
+	for !s.Empty() {
+		var extensionType uint8
+		var extension cryptobyte.String
+		if !s.ReadUint8(&extensionType) || !s.ReadUint16LengthPrefixed(&extension) {
+			return 0, errors.New("invalid SCT extensions")
+		}
+		if extensionType != 0 /* leaf_index */ {
+			continue
+		}
+		var b []byte
+		if !extension.ReadBytes(&b, 5) || !extension.Empty() {
+			return 0, errors.New("invalid leaf_index extension")
+		}
+		return int64(b[0])<<32 | int64(b[1])<<24 | int64(b[2])<<16 | int64(b[3])<<8 | int64(b[4]), nil
+	}
+	return 0, errors.New("missing leaf_index extension")
+}
+
+// LogID returns the RFC 6962 log ID, the SHA-256 hash of the log public key.
+func (c *Client) LogID() ([sha256.Size]byte, error) {
+	spki, err := x509.MarshalPKIXPublicKey(c.c.PublicKey)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(spki), nil
+}
+
+// VerifySCT verifies that sct is a valid SCT from the log for e, of which
+// only Certificate, IsPrecert, and IssuerKeyHash are used.
+//
+// For certificates with embedded SCTs, e is the precertificate entry, with
+// the TBSCertificate stripped of the SCT list extension.
+func (c *Client) VerifySCT(sct *SCT, e *Entry) error {
+	logID, err := c.LogID()
+	if err != nil {
+		return err
+	}
+	if sct.LogID != logID {
+		return errors.New("SCT is not from this log")
+	}
+	pk, ok := c.c.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("unsupported log public key type")
+	}
+	if sct.HashAlgorithm != 4 || sct.SignatureAlgorithm != 3 {
+		return fmt.Errorf("unsupported SCT signature algorithm %d/%d", sct.HashAlgorithm, sct.SignatureAlgorithm)
+	}
+
+	b := &cryptobyte.Builder{}
+	b.AddUint8(0 /* sct_version = v1 */)
+	b.AddUint8(0 /* signature_type = certificate_timestamp */)
+	b.AddUint64(uint64(sct.Timestamp))
+	if !e.IsPrecert {
+		b.AddUint16(0 /* entry_type = x509_entry */)
+	} else {
+		b.AddUint16(1 /* entry_type = precert_entry */)
+		b.AddBytes(e.IssuerKeyHash[:])
+	}
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(e.Certificate)
+	})
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sct.Extensions)
+	})
+	signed, err := b.Bytes()
+	if err != nil {
+		return err
+	}
+	h := sha256.Sum256(signed)
+	if !ecdsa.VerifyASN1(pk, h[:], sct.Signature) {
+		return errors.New("invalid SCT signature")
+	}
+	return nil
+}
+
+// SCTInclusionProof verifies sct for e as [Client.VerifySCT] does, checks that
+// the entry at its leaf index in tree is e with the SCT timestamp, and returns
+// the entry as read from the data tile and its inclusion proof in tree.
+func (c *Client) SCTInclusionProof(ctx context.Context, tree tlog.Tree, sct *SCT, e *Entry) (*Entry, tlog.RecordProof, error) {
+	if err := c.VerifySCT(sct, e); err != nil {
+		return nil, nil, err
+	}
+	index, err := sct.LeafIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+	if index >= tree.N {
+		return nil, nil, fmt.Errorf("entry %d is not yet in tree of size %d", index, tree.N)
+	}
+	entries, err := c.DataTile(ctx, tree, index/tileWidth)
+	if err != nil {
+		return nil, nil, err
+	}
+	logged := entries[index%tileWidth]
+	expected := &Entry{
+		Certificate:   e.Certificate,
+		IsPrecert:     e.IsPrecert,
+		IssuerKeyHash: e.IssuerKeyHash,
+		LeafIndex:     index,
+		Timestamp:     sct.Timestamp,
+	}
+	leaf := expected.MerkleTreeLeaf()
+	if !bytes.Equal(logged.MerkleTreeLeaf(), leaf) {
+		return logged, nil, fmt.Errorf("entry %d in the log doesn't match the SCT", index)
+	}
+	proof, err := c.InclusionProof(ctx, tree, index)
+	if err != nil {
+		return logged, nil, err
+	}
+	if err := tlog.CheckRecord(proof, tree.N, tree.Hash, index, tlog.RecordHash(leaf)); err != nil {
+		return logged, nil, fmt.Errorf("invalid inclusion proof: %w", err)
+	}
+	return logged, proof, nil
+}
@@ -0,0 +1,81 @@
+package client_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"filippo.io/sunlight/client"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestSCT(t *testing.T) {
+	tl := newTestLog(t)
+	c := tl.Client
+	ctx := context.Background()
+
+	tl.add(t, 1, false)
+	leaf := tl.issue(t, false)
+	leafSCT, err := tl.AddChain(ctx, tl.chain(leaf))
+	fatalIfErr(t, err)
+	precert := tl.issue(t, true)
+	precertSCT, err := tl.AddPreChain(ctx, tl.chain(precert))
+	fatalIfErr(t, err)
+
+	p, err := ctx509.ParseCertificate(precert)
+	fatalIfErr(t, err)
+	tbs, err := ctx509.RemoveCTPoison(p.RawTBSCertificate)
+	fatalIfErr(t, err)
+	leafEntry := &client.Entry{Certificate: leaf}
+	precertEntry := &client.Entry{Certificate: tbs, IsPrecert: true,
+		IssuerKeyHash: sha256.Sum256(tl.ca.RawSubjectPublicKeyInfo)}
+
+	cp, err := c.Checkpoint(ctx)
+	fatalIfErr(t, err)
+	for i, tc := range []struct {
+		sct   []byte
+		entry *client.Entry
+		index int64
+	}{{leafSCT, leafEntry, 1}, {precertSCT, precertEntry, 2}} {
+		sct, err := client.ParseSCT(tc.sct)
+		fatalIfErr(t, err)
+		if idx, err := sct.LeafIndex(); err != nil || idx != tc.index {
+			t.Errorf("%d: got leaf index %d, %v, expected %d", i, idx, err, tc.index)
+		}
+		e, proof, err := c.SCTInclusionProof(ctx, cp.Tree, sct, tc.entry)
+		fatalIfErr(t, err)
+		if e.LeafIndex != tc.index || e.Timestamp != sct.Timestamp {
+			t.Errorf("%d: got entry %d at %d, expected %d at %d", i, e.LeafIndex, e.Timestamp, tc.index, sct.Timestamp)
+		}
+		leafHash := tlog.RecordHash(e.MerkleTreeLeaf())
+		if err := tlog.CheckRecord(proof, cp.N, cp.Hash, tc.index, leafHash); err != nil {
+			t.Errorf("%d: invalid inclusion proof: %v", i, err)
+		}
+
+		// The SCT must not verify for the other entry.
+		other := leafEntry
+		if tc.entry == leafEntry {
+			other = precertEntry
+		}
+		if err := c.VerifySCT(sct, other); err == nil {
+			t.Errorf("%d: SCT verified for the wrong entry", i)
+		}
+		sct.Timestamp++
+		if err := c.VerifySCT(sct, tc.entry); err == nil {
+			t.Errorf("%d: SCT verified with the wrong timestamp", i)
+		}
+	}
+
+	list := []byte{0, 0}
+	for _, b := range [][]byte{leafSCT, precertSCT} {
+		list = append(list, byte(len(b)>>8), byte(len(b)))
+		list = append(list, b...)
+	}
+	list[0], list[1] = byte((len(list)-2)>>8), byte(len(list)-2)
+	scts, err := client.ParseSCTList(list)
+	fatalIfErr(t, err)
+	if len(scts) != 2 {
+		t.Errorf("got %d SCTs from list, expected 2", len(scts))
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// Tail returns an iterator that follows the log, yielding its entries in
+// order starting at index from, until ctx is canceled.
+//
+// Every Config.PollInterval, Tail fetches the checkpoint and verifies that
+// it's consistent with the previous one. Then, it fetches the new data tiles
+// one at a time, verifies them against the checkpoint, and yields their
+// entries. If from is beyond the end of the tree, Tail waits for the tree to
+// grow.
+//
+// Errors are yielded with a nil Entry. If the loop continues, Tail tries
+// again at the next poll, resuming from the first entry it didn't yield.
+func (c *Client) Tail(ctx context.Context, from int64) iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		if from < 0 {
+			yield(nil, fmt.Errorf("invalid start index %d", from))
+			return
+		}
+		var tree tlog.Tree
+		var hr tlog.HashReader
+		next := from
+		for {
+			cp, err := c.Checkpoint(ctx)
+			if err == nil {
+				err = c.checkTreeGrowth(ctx, tree, cp.Tree)
+			}
+			if err == nil && cp.N > tree.N {
+				tree = cp.Tree
+				hr = c.HashReader(ctx, tree)
+			}
+			for err == nil && next < tree.N {
+				var entries []*Entry
+				entries, err = c.dataTile(ctx, hr, tree, next/tileWidth)
+				for _, e := range entries {
+					if e.LeafIndex < next {
+						continue
+					}
+					if !yield(e, nil) {
+						return
+					}
+					next = e.LeafIndex + 1
+				}
+			}
+			if err != nil {
+				if ctx.Err() != nil || !yield(nil, err) {
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(c.c.PollInterval):
+			}
+		}
+	}
+}
+
+// checkTreeGrowth verifies that new is an append-only extension of old.
+func (c *Client) checkTreeGrowth(ctx context.Context, old, new tlog.Tree) error {
+	switch {
+	case new.N < old.N:
+		return fmt.Errorf("checkpoint rolled back: size %d is smaller than %d", new.N, old.N)
+	case new.N == old.N && new.Hash != old.Hash:
+		return fmt.Errorf("checkpoint forked: size %d has hash %v, expected %v", new.N, new.Hash, old.Hash)
+	case new.N == old.N:
+		return nil
+	}
+	proof, err := c.ConsistencyProof(ctx, new, old.N)
+	if err != nil {
+		return err
+	}
+	if old.N > 0 {
+		if err := tlog.CheckTree(proof, new.N, new.Hash, old.N, old.Hash); err != nil {
+			return fmt.Errorf("checkpoint is inconsistent with previous: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package client_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/client"
+)
+
+func TestTail(t *testing.T) {
+	tl := newTestLog(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	type result struct {
+		e   *client.Entry
+		err error
+	}
+	results := make(chan result)
+	go func() {
+		for e, err := range tl.Client.Tail(ctx, 5) {
+			select {
+			case results <- result{e, err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	next := func() result {
+		t.Helper()
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for Tail")
+			return result{}
+		}
+	}
+	expect := func(from, to int64) {
+		t.Helper()
+		for i := from; i < to; i++ {
+			r := next()
+			fatalIfErr(t, r.err)
+			if r.e.LeafIndex != i {
+				t.Fatalf("got entry %d, expected %d", r.e.LeafIndex, i)
+			}
+		}
+	}
+
+	// Start before the tree reaches the starting index.
+	tl.add(t, 1, false)
+	tl.add(t, 9, false)
+	expect(5, 10)
+	old, err := tl.backend.Fetch(ctx, "checkpoint")
+	fatalIfErr(t, err)
+
+	tl.add(t, tileWidth+10, false)
+	expect(10, tileWidth+20)
+
+	tl.backend.set("checkpoint", old)
+	if r := next(); r.err == nil || !strings.Contains(r.err.Error(), "rolled back") {
+		t.Errorf("Tail with rolled back checkpoint: got %v, %v", r.e, r.err)
+	}
+
+	tl.backend.reset("checkpoint")
+	tl.add(t, 1, false)
+	for {
+		r := next()
+		if r.err != nil {
+			continue // the rolled back checkpoint might have been seen again
+		}
+		if r.e.LeafIndex != tileWidth+20 {
+			t.Fatalf("got entry %d, expected %d", r.e.LeafIndex, tileWidth+20)
+		}
+		break
+	}
+}
@@ -0,0 +1,170 @@
+package client_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/ctlog"
+	"filippo.io/sunlight/sunlighttest"
+	"golang.org/x/sync/errgroup"
+)
+
+const tileWidth = 256
+
+// testLog is a sunlighttest log, with a backend that tests can tamper with,
+// and a CA that issues the certificates submitted to it.
+type testLog struct {
+	*sunlighttest.Log
+	backend *tamperBackend
+
+	root, intermediate []byte
+	ca                 *x509.Certificate
+	caKey, leafKey     *ecdsa.PrivateKey
+	serial             atomic.Int64
+}
+
+func newTestLog(t *testing.T) *testLog {
+	tl := &testLog{backend: &tamperBackend{MemoryBackend: ctlog.NewMemoryBackend()}}
+	rootKey := newKey(t)
+	tl.caKey, tl.leafKey = newKey(t), newKey(t)
+	tl.serial.Store(100)
+	ca := func(cn string, serial int64) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+	}
+	var root *x509.Certificate
+	tl.root, root = issue(t, ca("Test Root", 1), ca("Test Root", 1), &rootKey.PublicKey, rootKey)
+	tl.intermediate, tl.ca = issue(t, ca("Test Intermediate", 2), root, &tl.caKey.PublicKey, rootKey)
+
+	tl.Log = sunlighttest.NewLog(t, &sunlighttest.Config{
+		Roots:            []*x509.Certificate{root},
+		Backend:          tl.backend,
+		SequencingPeriod: 5 * time.Millisecond,
+	})
+	return tl
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	return k
+}
+
+func issue(t *testing.T, tmpl, parent *x509.Certificate, pub, priv any) ([]byte, *x509.Certificate) {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+	fatalIfErr(t, err)
+	c, err := x509.ParseCertificate(der)
+	fatalIfErr(t, err)
+	return der, c
+}
+
+// issue returns a new leaf certificate, or precertificate, from the
+// intermediate of the log's hierarchy.
+func (tl *testLog) issue(t *testing.T, precert bool) []byte {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(tl.serial.Add(1)),
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if precert {
+		tmpl.ExtraExtensions = []pkix.Extension{{
+			Id:       asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3},
+			Critical: true,
+			Value:    []byte{0x05, 0x00},
+		}}
+	}
+	der, _ := issue(t, tmpl, tl.ca, &tl.leafKey.PublicKey, tl.caKey)
+	return der
+}
+
+// chain returns the chain to submit for leaf.
+func (tl *testLog) chain(leaf []byte) [][]byte {
+	return [][]byte{leaf, tl.intermediate, tl.root}
+}
+
+// add submits n new certificates, or precertificates, concurrently so that
+// they are sequenced in few rounds, and returns when they are all logged.
+func (tl *testLog) add(t *testing.T, n int, precert bool) {
+	t.Helper()
+	var g errgroup.Group
+	g.SetLimit(32)
+	for range n {
+		leaf := tl.issue(t, precert)
+		g.Go(func() error {
+			if precert {
+				_, err := tl.AddPreChain(context.Background(), tl.chain(leaf))
+				return err
+			}
+			_, err := tl.AddChain(context.Background(), tl.chain(leaf))
+			return err
+		})
+	}
+	fatalIfErr(t, g.Wait())
+}
+
+// tamperBackend is a [ctlog.MemoryBackend] whose objects can be replaced or
+// removed for the readers, behind the log's back.
+type tamperBackend struct {
+	*ctlog.MemoryBackend
+
+	mu        sync.Mutex
+	overrides map[string][]byte
+}
+
+func (b *tamperBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	b.mu.Lock()
+	data, ok := b.overrides[key]
+	b.mu.Unlock()
+	if !ok {
+		return b.MemoryBackend.Fetch(ctx, key)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("key %q not found", key)
+	}
+	return data, nil
+}
+
+// set makes Fetch return data for key, or a not found error if data is nil.
+func (b *tamperBackend) set(key string, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.overrides == nil {
+		b.overrides = make(map[string][]byte)
+	}
+	b.overrides[key] = data
+}
+
+// reset undoes set.
+func (b *tamperBackend) reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.overrides, key)
+}
+
+func fatalIfErr(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
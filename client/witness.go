@@ -0,0 +1,177 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+const maxWitnessResponseSize = 1 << 16
+
+// WitnessConfig is the configuration of a [Witness].
+type WitnessConfig struct {
+	// URL is the prefix of the witness's c2sp.org/tlog-witness API, to which
+	// "/add-checkpoint" is appended.
+	URL string
+
+	// Verifier verifies the witness cosignatures.
+	Verifier note.Verifier
+
+	// HTTPClient is used for all requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// UserAgent is the User-Agent header of all requests. If empty, a default
+	// is used.
+	UserAgent string
+}
+
+// A Witness submits checkpoints to a witness, implementing the
+// c2sp.org/tlog-witness protocol, and returns its verified cosignatures.
+//
+// The checkpoints can be of any log the witness is configured for, not only
+// the one of a specific [Client], so a Witness can be shared by a log and by
+// the mirrors of other logs.
+//
+// A Witness is safe for concurrent use.
+type Witness struct {
+	c  WitnessConfig
+	hc *http.Client
+
+	// sizes are the latest tree sizes known to the witness, by log origin.
+	mu    sync.Mutex
+	sizes map[string]int64
+}
+
+// NewWitness returns a new Witness for the witness described by config.
+func NewWitness(config *WitnessConfig) (*Witness, error) {
+	if config.URL == "" {
+		return nil, errors.New("URL is required")
+	}
+	if config.Verifier == nil {
+		return nil, errors.New("Verifier is required")
+	}
+	w := &Witness{c: *config, hc: config.HTTPClient, sizes: make(map[string]int64)}
+	if w.hc == nil {
+		w.hc = http.DefaultClient
+	}
+	if w.c.UserAgent == "" {
+		w.c.UserAgent = "filippo.io/sunlight/client"
+	}
+	return w, nil
+}
+
+// Name returns the key name of the witness cosignatures.
+func (w *Witness) Name() string {
+	return w.c.Verifier.Name()
+}
+
+// A WitnessConflictError is returned by [Witness.AddCheckpoint] if the old
+// size doesn't match the latest checkpoint the witness has for the log.
+type WitnessConflictError struct {
+	// Size is the size of the latest checkpoint known to the witness.
+	Size int64
+}
+
+func (e *WitnessConflictError) Error() string {
+	return fmt.Sprintf("witness has a checkpoint of size %d", e.Size)
+}
+
+// Submit submits cp, a checkpoint of the log read by c, to the witness, with
+// a consistency proof from the latest checkpoint the witness is known to have
+// for the log. It returns cp.Signed with the witness cosignature appended.
+//
+// If the witness has a different checkpoint, the proof is rebuilt from the
+// size it reports, and the checkpoint submitted again.
+func (w *Witness) Submit(ctx context.Context, c *Client, cp *Checkpoint) ([]byte, error) {
+	w.mu.Lock()
+	oldSize := w.sizes[cp.Origin]
+	w.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if oldSize > cp.N {
+			return nil, fmt.Errorf("witness has a checkpoint of size %d, larger than %d", oldSize, cp.N)
+		}
+		proof, err := c.ConsistencyProof(ctx, cp.Tree, oldSize)
+		if err != nil {
+			return nil, err
+		}
+		sigs, err := w.AddCheckpoint(ctx, oldSize, proof, cp.Signed)
+		if conflict := (*WitnessConflictError)(nil); errors.As(err, &conflict) && attempt == 0 {
+			oldSize = conflict.Size
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		w.mu.Lock()
+		if w.sizes[cp.Origin] < cp.N {
+			w.sizes[cp.Origin] = cp.N
+		}
+		w.mu.Unlock()
+		return append(bytes.Clone(cp.Signed), sigs...), nil
+	}
+}
+
+// AddCheckpoint makes an add-checkpoint request to the witness with the signed
+// checkpoint and the consistency proof from the tree of size oldSize, and
+// returns the cosignature note signature lines, verified against the
+// checkpoint.
+//
+// If the witness has a checkpoint of a size different from oldSize, it returns
+// a *[WitnessConflictError].
+func (w *Witness) AddCheckpoint(ctx context.Context, oldSize int64, proof tlog.TreeProof, signed []byte) ([]byte, error) {
+	body := &bytes.Buffer{}
+	fmt.Fprintf(body, "old %d\n", oldSize)
+	for _, h := range proof {
+		fmt.Fprintf(body, "%s\n", base64.StdEncoding.EncodeToString(h[:]))
+	}
+	body.WriteString("\n")
+	body.Write(signed)
+
+	url := strings.TrimSuffix(w.c.URL, "/") + "/add-checkpoint"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", w.c.UserAgent)
+	resp, err := w.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxWitnessResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		size, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("POST %s: %s: invalid size %q", url, resp.Status, b)
+		}
+		return nil, &WitnessConflictError{Size: size}
+	default:
+		return nil, fmt.Errorf("POST %s: %s: %s", url, resp.Status, bytes.TrimSpace(b))
+	}
+
+	// The response is a set of note signature lines, which are appended to
+	// the checkpoint to verify the cosignature.
+	if len(b) == 0 || b[len(b)-1] != '\n' {
+		return nil, fmt.Errorf("POST %s: malformed cosignature response", url)
+	}
+	if _, err := note.Open(append(bytes.Clone(signed), b...), note.VerifierList(w.c.Verifier)); err != nil {
+		return nil, fmt.Errorf("POST %s: invalid cosignature: %w", url, err)
+	}
+	return b, nil
+}
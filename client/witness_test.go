@@ -0,0 +1,144 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"filippo.io/sunlight/client"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestWitness(t *testing.T) {
+	tl := newTestLog(t)
+	c := tl.Client
+	ctx := context.Background()
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "example.com/TestWitness")
+	fatalIfErr(t, err)
+	signer, err := note.NewSigner(skey)
+	fatalIfErr(t, err)
+	verifier, err := note.NewVerifier(vkey)
+	fatalIfErr(t, err)
+
+	// witness implements the c2sp.org/tlog-witness add-checkpoint endpoint.
+	var mu sync.Mutex
+	var witnessed tlog.Tree
+	var requests int
+	ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		body, err := io.ReadAll(r.Body)
+		if err != nil || r.URL.Path != "/add-checkpoint" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		header, signed, _ := bytes.Cut(body, []byte("\n\n"))
+		lines := strings.Split(string(header), "\n")
+		var old int64
+		if _, err := fmt.Sscanf(lines[0], "old %d", &old); err != nil {
+			http.Error(w, "bad old line", http.StatusBadRequest)
+			return
+		}
+		var proof tlog.TreeProof
+		for _, l := range lines[1:] {
+			h, err := base64.StdEncoding.DecodeString(l)
+			if err != nil || len(h) != tlog.HashSize {
+				http.Error(w, "bad proof", http.StatusBadRequest)
+				return
+			}
+			proof = append(proof, tlog.Hash(h))
+		}
+		cp, err := c.VerifyCheckpoint(signed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if old != witnessed.N {
+			w.Header().Set("Content-Type", "text/x.tlog.size")
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, "%d\n", witnessed.N)
+			return
+		}
+		if old > 0 && tlog.CheckTree(proof, cp.N, cp.Hash, old, witnessed.Hash) != nil {
+			http.Error(w, "invalid proof", http.StatusUnprocessableEntity)
+			return
+		}
+		text, _, _ := strings.Cut(string(signed), "\n\n")
+		cosigned, err := note.Sign(&note.Note{Text: text + "\n"}, signer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		witnessed = cp.Tree
+		w.Write(cosigned[len(text)+2:])
+	}))
+	t.Cleanup(ws.Close)
+	resetRequests := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := requests
+		requests = 0
+		return n
+	}
+
+	newWitness := func(v note.Verifier) *client.Witness {
+		w, err := client.NewWitness(&client.WitnessConfig{URL: ws.URL, Verifier: v})
+		fatalIfErr(t, err)
+		return w
+	}
+	submit := func(w *client.Witness) error {
+		t.Helper()
+		cp, err := c.Checkpoint(ctx)
+		fatalIfErr(t, err)
+		cosigned, err := w.Submit(ctx, c, cp)
+		if err != nil {
+			return err
+		}
+		if _, err := note.Open(cosigned, note.VerifierList(verifier)); err != nil {
+			t.Errorf("invalid cosigned checkpoint: %v", err)
+		}
+		if _, err := c.VerifyCheckpoint(cosigned); err != nil {
+			t.Errorf("cosigned checkpoint doesn't verify as the log's: %v", err)
+		}
+		return nil
+	}
+
+	w := newWitness(verifier)
+	tl.add(t, 1, false)
+	fatalIfErr(t, submit(w))
+
+	tl.add(t, tileWidth+10, false)
+	resetRequests()
+	fatalIfErr(t, submit(w))
+	if n := resetRequests(); n != 1 {
+		t.Errorf("got %d requests, expected 1 with the known witness size", n)
+	}
+
+	// A new client learns the witness size from the conflict response.
+	tl.add(t, 1, false)
+	fatalIfErr(t, submit(newWitness(verifier)))
+	if n := resetRequests(); n != 2 {
+		t.Errorf("got %d requests, expected 2 after a conflict", n)
+	}
+
+	// Cosignatures that don't verify are rejected.
+	_, otherKey, err := note.GenerateKey(rand.Reader, "example.com/TestWitness")
+	fatalIfErr(t, err)
+	other, err := note.NewVerifier(otherKey)
+	fatalIfErr(t, err)
+	tl.add(t, 1, false)
+	if err := submit(newWitness(other)); err == nil {
+		t.Error("accepted cosignature from the wrong witness key")
+	}
+}
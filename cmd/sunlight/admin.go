@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// adminAuth restricts access to the metrics and debug endpoints to requests
+// that carry a bearer token or a client certificate issued by clientCAs.
+type adminAuth struct {
+	token     []byte
+	clientCAs *x509.CertPool
+}
+
+func newAdminAuth(tokenFile, clientCAsFile string) (*adminAuth, error) {
+	a := &adminAuth{}
+	if tokenFile != "" {
+		b, err := readSecretFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token file: %w", err)
+		}
+		a.token = []byte(strings.TrimSpace(string(b)))
+		if len(a.token) == 0 {
+			return nil, errors.New("token file is empty")
+		}
+	}
+	if clientCAsFile != "" {
+		pemBytes, err := os.ReadFile(clientCAsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CAs: %w", err)
+		}
+		a.clientCAs = x509.NewCertPool()
+		if !a.clientCAs.AppendCertsFromPEM(pemBytes) {
+			return nil, errors.New("no certificates found in client CAs file")
+		}
+	}
+	return a, nil
+}
+
+// enabled reports whether any authentication method is configured. If not,
+// the endpoints are not restricted.
+func (a *adminAuth) enabled() bool {
+	return a.token != nil || a.clientCAs != nil
+}
+
+func (a *adminAuth) authorized(r *http.Request) bool {
+	if a.clientCAs != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	if a.token != nil {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && subtle.ConstantTimeCompare([]byte(token), a.token) == 1
+	}
+	return false
+}
+
+func (a *adminAuth) wrap(h http.Handler) http.Handler {
+	if !a.enabled() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			if a.token != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
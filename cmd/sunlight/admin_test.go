@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdminAuthToken(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	fatalIfErr(t, os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600))
+	auth, err := newAdminAuth(tokenFile, "")
+	fatalIfErr(t, err)
+	h := auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"Valid", "Bearer s3cret", http.StatusOK},
+		{"Missing", "", http.StatusUnauthorized},
+		{"Wrong", "Bearer s3cre7", http.StatusUnauthorized},
+		{"Prefix", "Bearer s3cre", http.StatusUnauthorized},
+		{"Newline", "Bearer s3cret\n", http.StatusUnauthorized},
+		{"Scheme", "Basic s3cret", http.StatusUnauthorized},
+		{"Bare", "s3cret", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/metrics", nil)
+			if tc.header != "" {
+				r.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Errorf("got status %d, expected %d", w.Code, tc.status)
+			}
+			if tc.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("missing WWW-Authenticate header")
+			}
+		})
+	}
+
+	fatalIfErr(t, os.WriteFile(tokenFile, []byte(" \n"), 0o600))
+	if _, err := newAdminAuth(tokenFile, ""); err == nil {
+		t.Errorf("accepted an empty token file")
+	}
+	if _, err := newAdminAuth(filepath.Join(dir, "missing"), ""); err == nil {
+		t.Errorf("accepted a missing token file")
+	}
+}
+
+func TestAdminAuthDisabled(t *testing.T) {
+	auth, err := newAdminAuth("", "")
+	fatalIfErr(t, err)
+	if auth.enabled() {
+		t.Errorf("auth enabled without TokenFile or ClientCAs")
+	}
+	h := auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d without authentication configured", w.Code)
+	}
+}
+
+func TestAdminAuthClientCert(t *testing.T) {
+	dir := t.TempDir()
+	caKey, ca, caPEM := newTestCA(t, "Admin CA")
+	caFile := filepath.Join(dir, "ca.pem")
+	fatalIfErr(t, os.WriteFile(caFile, caPEM, 0o644))
+	tokenFile := filepath.Join(dir, "token")
+	fatalIfErr(t, os.WriteFile(tokenFile, []byte("s3cret"), 0o600))
+	auth, err := newAdminAuth(tokenFile, caFile)
+	fatalIfErr(t, err)
+
+	ts := httptest.NewUnstartedServer(auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	ts.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: auth.clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	get := func(t *testing.T, cert *tls.Certificate, token string) (int, error) {
+		t.Helper()
+		tr := ts.Client().Transport.(*http.Transport).Clone()
+		if cert != nil {
+			tr.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+		}
+		defer tr.CloseIdleConnections()
+		req, err := http.NewRequest("GET", ts.URL+"/metrics", nil)
+		fatalIfErr(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := (&http.Client{Transport: tr}).Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	if status, err := get(t, newTestClientCert(t, ca, caKey), ""); err != nil || status != http.StatusOK {
+		t.Errorf("got status %d, %v with a client certificate", status, err)
+	}
+	if status, err := get(t, nil, ""); err != nil || status != http.StatusUnauthorized {
+		t.Errorf("got status %d, %v without a client certificate", status, err)
+	}
+	// The token is still accepted when ClientCAs is set.
+	if status, err := get(t, nil, "s3cret"); err != nil || status != http.StatusOK {
+		t.Errorf("got status %d, %v with a token", status, err)
+	}
+	otherKey, other, _ := newTestCA(t, "Other CA")
+	if status, err := get(t, newTestClientCert(t, other, otherKey), ""); err == nil && status == http.StatusOK {
+		t.Errorf("got status %d with a certificate from another CA", status)
+	}
+
+	fatalIfErr(t, os.WriteFile(filepath.Join(dir, "empty.pem"), nil, 0o644))
+	if _, err := newAdminAuth("", filepath.Join(dir, "empty.pem")); err == nil {
+		t.Errorf("accepted a client CAs file without certificates")
+	}
+}
+
+// newTestCA returns the key, certificate, and PEM of a new self-signed CA.
+func newTestCA(t *testing.T, cn string) (*ecdsa.PrivateKey, *x509.Certificate, []byte) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	fatalIfErr(t, err)
+	c, err := x509.ParseCertificate(der)
+	fatalIfErr(t, err)
+	return k, c, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newTestClientCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey) *tls.Certificate {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "admin"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &k.PublicKey, caKey)
+	fatalIfErr(t, err)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: k}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// snapshot implements the "sunlight snapshot" command, which takes a
+// consistent snapshot of a log, read and verified through its monitoring API,
+// into a tar archive, or into a second S3 bucket. See [ctlog.WriteSnapshot].
+//
+// The archive is gzip-compressed if the -o file name ends in ".gz". It's
+// written to a temporary file and renamed into place once complete. A bucket
+// snapshot is a one-off "sunlight mirror -once", and can be refreshed by
+// running it again.
+func snapshot(args []string) {
+	fs := flag.NewFlagSet("sunlight snapshot", flag.ExitOnError)
+	monitoringFlag := fs.String("monitoring", "", "monitoring URL prefix of the log (required)")
+	nameFlag := fs.String("name", "", "name of the log, the checkpoint origin (required)")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the log (required)")
+	outFlag := fs.String("o", "", "path of the tar archive to write")
+	regionFlag := fs.String("s3-region", "", "AWS region of the destination S3 bucket")
+	bucketFlag := fs.String("s3-bucket", "", "destination S3 bucket, instead of -o")
+	endpointFlag := fs.String("s3-endpoint", "", "base URL of the destination S3 API, if not AWS")
+	prefixFlag := fs.String("s3-prefix", "", "prefix of the destination object keys")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *monitoringFlag == "" || *nameFlag == "" || *keyFlag == "" {
+		logger.Error("-monitoring, -name, and -key are required")
+		os.Exit(1)
+	}
+	if (*outFlag == "") == (*bucketFlag == "") {
+		logger.Error("exactly one of -o and -s3-bucket is required")
+		os.Exit(1)
+	}
+	key, err := parsePublicKey(*keyFlag)
+	if err != nil {
+		logger.Error("invalid -key", "err", err)
+		os.Exit(1)
+	}
+	src, err := client.New(&client.Config{
+		MonitoringPrefix: *monitoringFlag,
+		Name:             *nameFlag,
+		PublicKey:        key,
+		UserAgent:        "filippo.io/sunlight snapshot",
+	})
+	if err != nil {
+		logger.Error("failed to create client", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *bucketFlag != "" {
+		dst, err := ctlog.NewS3Backend(ctx, *regionFlag, *bucketFlag, *endpointFlag, *prefixFlag, logger)
+		if err != nil {
+			logger.Error("failed to create backend", "err", err)
+			os.Exit(1)
+		}
+		m, err := ctlog.NewMirror(ctx, &ctlog.MirrorConfig{
+			Source:      src,
+			Destination: dst,
+			Log:         logger,
+		})
+		if err != nil {
+			logger.Error("failed to load destination", "err", err)
+			os.Exit(1)
+		}
+		if err := m.Sync(ctx); err != nil {
+			logger.Error("snapshot failed", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(*outFlag), filepath.Base(*outFlag)+".tmp*")
+	if err != nil {
+		logger.Error("failed to create output file", "err", err)
+		os.Exit(1)
+	}
+	defer os.Remove(tmp.Name())
+	bw := bufio.NewWriter(tmp)
+	w := io.Writer(bw)
+	var gw *gzip.Writer
+	if strings.HasSuffix(*outFlag, ".gz") {
+		gw = gzip.NewWriter(bw)
+		w = gw
+	}
+	if _, err := ctlog.WriteSnapshot(ctx, src, w, logger); err != nil {
+		logger.Error("snapshot failed", "err", err)
+		os.Exit(1)
+	}
+	if gw != nil {
+		err = gw.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), *outFlag)
+	}
+	if err != nil {
+		logger.Error("failed to write output file", "err", err)
+		os.Exit(1)
+	}
+}
+
+// restore implements the "sunlight restore" command, which restores a snapshot
+// archive written by "sunlight snapshot" into a fresh backend, and verifies the
+// restored tree against the snapshot checkpoint. See [ctlog.RestoreSnapshot].
+//
+// With -log, the backend and key of the log are taken from the config file,
+// and if the lock backend has no checkpoint for the log, the snapshot one is
+// stored there, so that the log can be started from the restored backend.
+// Otherwise, the destination is an S3 bucket specified by the -s3 flags, such
+// as a read replica, and -name and -key are required.
+func restore(args []string) {
+	fs := flag.NewFlagSet("sunlight restore", flag.ExitOnError)
+	inFlag := fs.String("i", "", "path of the tar archive to restore, optionally gzip-compressed (required)")
+	configFlag := fs.String("c", "sunlight.yaml", "path to the config file, used with -log")
+	logFlag := fs.String("log", "", "ShortName of the log to restore into")
+	nameFlag := fs.String("name", "", "name of the log, the checkpoint origin")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the log")
+	regionFlag := fs.String("s3-region", "", "AWS region of the destination S3 bucket")
+	bucketFlag := fs.String("s3-bucket", "", "destination S3 bucket, instead of -log")
+	endpointFlag := fs.String("s3-endpoint", "", "base URL of the destination S3 API, if not AWS")
+	prefixFlag := fs.String("s3-prefix", "", "prefix of the destination object keys")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *inFlag == "" {
+		logger.Error("-i is required")
+		os.Exit(1)
+	}
+	if (*logFlag == "") == (*bucketFlag == "") {
+		logger.Error("exactly one of -log and -s3-bucket is required")
+		os.Exit(1)
+	}
+	if *bucketFlag != "" && (*nameFlag == "" || *keyFlag == "") {
+		logger.Error("-name and -key are required with -s3-bucket")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var dst ctlog.Backend
+	var key crypto.PublicKey
+	var lock ctlog.LockBackend
+	name := *nameFlag
+	if *logFlag != "" {
+		c, err := readConfig(*configFlag)
+		if err != nil {
+			logger.Error("failed to load config", "err", err)
+			os.Exit(1)
+		}
+		var lc *LogConfig
+		for i := range c.Logs {
+			if c.Logs[i].ShortName == *logFlag {
+				lc = &c.Logs[i]
+			}
+		}
+		if lc == nil {
+			logger.Error("log not found in config file", "log", *logFlag)
+			os.Exit(1)
+		}
+		logger = logger.With("log", lc.ShortName)
+		signer, _, err := newSigner(ctx, lc, logger)
+		if err != nil {
+			logger.Error("failed to load log key", "err", err)
+			os.Exit(1)
+		}
+		key, name = signer.Public(), lc.Name
+		if dst, err = ctlog.NewS3Backend(ctx, lc.S3Region, lc.S3Bucket, lc.S3Endpoint, lc.S3KeyPrefix, logger); err != nil {
+			logger.Error("failed to create backend", "err", err)
+			os.Exit(1)
+		}
+		if lock, err = newLockBackend(ctx, c, logger); err != nil {
+			logger.Error("failed to create lock backend", "err", err)
+			os.Exit(1)
+		}
+	} else {
+		var err error
+		if key, err = parsePublicKey(*keyFlag); err != nil {
+			logger.Error("invalid -key", "err", err)
+			os.Exit(1)
+		}
+		if dst, err = ctlog.NewS3Backend(ctx, *regionFlag, *bucketFlag, *endpointFlag, *prefixFlag, logger); err != nil {
+			logger.Error("failed to create backend", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	f, err := os.Open(*inFlag)
+	if err != nil {
+		logger.Error("failed to open snapshot", "err", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	r := io.Reader(br)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			logger.Error("failed to decompress snapshot", "err", err)
+			os.Exit(1)
+		}
+		r = gr
+	}
+	tree, err := ctlog.RestoreSnapshot(ctx, r, &ctlog.RestoreConfig{
+		Name:        name,
+		Key:         key,
+		Destination: dst,
+		Log:         logger,
+	})
+	if err != nil {
+		logger.Error("restore failed", "err", err)
+		os.Exit(1)
+	}
+	logger.Info("verified restored tree", "tree_size", tree.N, "root_hash", tree.Hash)
+
+	if lock == nil {
+		return
+	}
+	signed, err := dst.Fetch(ctx, "checkpoint")
+	if err != nil {
+		logger.Error("failed to fetch restored checkpoint", "err", err)
+		os.Exit(1)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		logger.Error("failed to marshal public key", "err", err)
+		os.Exit(1)
+	}
+	logID := sha256.Sum256(pkix)
+	if err := lock.Create(ctx, logID, signed); err == nil {
+		logger.Info("stored restored checkpoint in lock backend")
+		return
+	}
+	// The lock backend already has a checkpoint for the log. The log can only
+	// be started if it's the restored one, or if the missing tiles beyond it
+	// are uploaded, for example from a mirror.
+	if locked, err := lock.Fetch(ctx, logID); err != nil {
+		logger.Error("failed to fetch checkpoint from lock backend", "err", err)
+		os.Exit(1)
+	} else if !bytes.Equal(locked.Bytes(), signed) {
+		logger.Warn("lock backend has a different checkpoint for the log; it won't load until the tree matches it")
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+// defaultCCADBURL is the CCADB report of all root and intermediate
+// certificates, including their PEM and the root store inclusion status.
+const defaultCCADBURL = "https://ccadb.my.salesforce-sites.com/ccadb/AllCertificateRecordsCSVFormatv4"
+
+// defaultCCADBSyncInterval is how often the CCADB report is fetched, if
+// CCADB.SyncInterval is not set.
+const defaultCCADBSyncInterval = 24 * time.Hour
+
+// maxCCADBSize is the maximum size of the CCADB report.
+const maxCCADBSize = 256 << 20
+
+// CCADB report columns.
+const (
+	ccadbRecordType = "Certificate Record Type"
+	ccadbStatus     = "Status of Root Cert"
+	ccadbPEM        = "X.509 Certificate (PEM)"
+)
+
+// ccadbSyncer keeps the roots of a log in sync with a CCADB report.
+type ccadbSyncer struct {
+	url    string
+	stores []string
+	// roots is the path where the selected roots are written as a PEM file,
+	// so that a restart uses the last synced set even if CCADB is unreachable.
+	roots string
+	// audit is the path of the JSON lines audit trail of changes. Optional.
+	audit  string
+	log    *ctlog.Log
+	logger *slog.Logger
+}
+
+// parseCCADB returns the PEM of the root certificates in the CSV report r that
+// are included in at least one of the named root stores, sorted by hash.
+func parseCCADB(r io.Reader, stores []string) ([]byte, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CCADB report header: %w", err)
+	}
+	typeCol, statusCol, pemCol := -1, -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case ccadbRecordType:
+			typeCol = i
+		case ccadbStatus:
+			statusCol = i
+		case ccadbPEM:
+			pemCol = i
+		}
+	}
+	if typeCol < 0 || statusCol < 0 || pemCol < 0 {
+		return nil, errors.New("CCADB report is missing required columns")
+	}
+
+	var ders [][]byte
+	seen := make(map[[sha256.Size]byte]bool)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CCADB report: %w", err)
+		}
+		if record[typeCol] != "Root Certificate" || !includedIn(record[statusCol], stores) {
+			continue
+		}
+		block, _ := pem.Decode([]byte(strings.Trim(record[pemCol], "'\"")))
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, errors.New("invalid PEM in CCADB report")
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); x509.IsFatal(err) {
+			return nil, fmt.Errorf("invalid certificate in CCADB report: %w", err)
+		}
+		h := sha256.Sum256(block.Bytes)
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+		ders = append(ders, block.Bytes)
+	}
+	if len(ders) == 0 {
+		return nil, errors.New("no roots selected from CCADB report")
+	}
+
+	slices.SortFunc(ders, func(a, b []byte) int {
+		ha, hb := sha256.Sum256(a), sha256.Sum256(b)
+		return bytes.Compare(ha[:], hb[:])
+	})
+	var out []byte
+	for _, der := range ders {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return out, nil
+}
+
+// includedIn reports whether a CCADB root status such as "Apple: Included;
+// Google Chrome: Included; Mozilla: Not Yet Included" lists any of stores as
+// "Included".
+func includedIn(status string, stores []string) bool {
+	for _, s := range strings.Split(status, ";") {
+		store, state, ok := strings.Cut(s, ":")
+		if !ok || strings.TrimSpace(state) != "Included" {
+			continue
+		}
+		if slices.Contains(stores, strings.TrimSpace(store)) {
+			return true
+		}
+	}
+	return false
+}
+
+// run syncs the roots every interval, starting immediately, until ctx is done.
+func (s *ccadbSyncer) run(ctx context.Context, current []byte, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if newRoots, err := s.sync(ctx, current); err != nil {
+			s.logger.Error("failed to sync roots from CCADB", "err", err)
+			s.log.Alert(ctx, ctlog.AlertRootsReload, "failed to sync roots from CCADB", err)
+		} else {
+			current = newRoots
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *ccadbSyncer) sync(ctx context.Context, current []byte) ([]byte, error) {
+	pemBytes, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(pemBytes, current) {
+		return current, nil
+	}
+
+	r := x509util.NewPEMCertPool()
+	if !r.AppendCertsFromPEM(pemBytes) {
+		return nil, errors.New("failed to parse selected roots")
+	}
+	if err := s.writeAudit(current, r); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(s.roots, pemBytes); err != nil {
+		return nil, fmt.Errorf("failed to write roots: %w", err)
+	}
+	s.log.SetRoots(r)
+	return pemBytes, nil
+}
+
+// fetch returns the PEM of the roots selected from the CCADB report.
+func (s *ccadbSyncer) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "filippo.io/sunlight")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return parseCCADB(io.LimitReader(resp.Body, maxCCADBSize), s.stores)
+}
+
+type ccadbAuditEntry struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	SHA256  string    `json:"sha256"`
+	Subject string    `json:"subject"`
+}
+
+// writeAudit appends an entry for each root added or removed to the audit
+// trail, if configured.
+func (s *ccadbSyncer) writeAudit(oldPEM []byte, newRoots *x509util.PEMCertPool) error {
+	if s.audit == "" {
+		return nil
+	}
+	oldRoots := x509util.NewPEMCertPool()
+	oldRoots.AppendCertsFromPEM(oldPEM)
+	hashes := func(p *x509util.PEMCertPool) map[[sha256.Size]byte]*x509.Certificate {
+		m := make(map[[sha256.Size]byte]*x509.Certificate)
+		for _, c := range p.RawCertificates() {
+			m[sha256.Sum256(c.Raw)] = c
+		}
+		return m
+	}
+	oldSet, newSet := hashes(oldRoots), hashes(newRoots)
+
+	now := time.Now().UTC()
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	for h, c := range newSet {
+		if oldSet[h] == nil {
+			e.Encode(ccadbAuditEntry{now, "added", hex.EncodeToString(h[:]), x509util.NameToString(c.Subject)})
+		}
+	}
+	for h, c := range oldSet {
+		if newSet[h] == nil {
+			e.Encode(ccadbAuditEntry{now, "removed", hex.EncodeToString(h[:]), x509util.NameToString(c.Subject)})
+		}
+	}
+
+	f, err := os.OpenFile(s.audit, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data, through a rename.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
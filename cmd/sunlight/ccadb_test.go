@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/pem"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIncludedIn(t *testing.T) {
+	stores := []string{"Mozilla", "Google Chrome"}
+	for _, tc := range []struct {
+		status string
+		want   bool
+	}{
+		{"Mozilla: Included", true},
+		{"Apple: Included; Google Chrome: Included; Mozilla: Not Yet Included", true},
+		{" Apple: Included ;  Mozilla :  Included ", true},
+		{"Apple: Included; Microsoft: Included", false},
+		{"Mozilla: Not Yet Included; Google Chrome: Not Included", false},
+		{"Mozilla", false},
+		{"", false},
+	} {
+		if got := includedIn(tc.status, stores); got != tc.want {
+			t.Errorf("includedIn(%q) = %v, expected %v", tc.status, got, tc.want)
+		}
+	}
+}
+
+func TestParseCCADB(t *testing.T) {
+	mozilla, chrome, apple := newTestRoot(t, "Mozilla Root"), newTestRoot(t, "Chrome Root"), newTestRoot(t, "Apple Root")
+	intermediate := newTestRoot(t, "Intermediate")
+	stores := []string{"Mozilla", "Google Chrome"}
+
+	header := []string{"CA Owner", ccadbRecordType, ccadbPEM, ccadbStatus}
+	row := func(recordType string, cert []byte, status string) []string {
+		// The report wraps the PEM in single quotes.
+		return []string{"Example CA", recordType, "'" + string(cert) + "'", status}
+	}
+	report := func(rows ...[]string) string {
+		buf := &bytes.Buffer{}
+		w := csv.NewWriter(buf)
+		w.WriteAll(rows)
+		return buf.String()
+	}
+
+	got, err := parseCCADB(strings.NewReader(report(header,
+		row("Root Certificate", apple, "Apple: Included; Mozilla: Not Yet Included"),
+		row("Root Certificate", mozilla, "Mozilla: Included"),
+		row("Intermediate Certificate", intermediate, "Mozilla: Included"),
+		row("Root Certificate", chrome, "Apple: Included; Google Chrome: Included"),
+		row("Root Certificate", mozilla, "Mozilla: Included; Google Chrome: Included"),
+	)), stores)
+	fatalIfErr(t, err)
+	var subjects []string
+	for rest := got; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			t.Fatalf("invalid PEM output: %q", got)
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		fatalIfErr(t, err)
+		subjects = append(subjects, c.Subject.CommonName)
+	}
+	slices.Sort(subjects)
+	if !slices.Equal(subjects, []string{"Chrome Root", "Mozilla Root"}) {
+		t.Errorf("got roots %q, expected the Mozilla and Chrome roots once each", subjects)
+	}
+
+	// The output is sorted, so it doesn't depend on the order of the report.
+	again, err := parseCCADB(strings.NewReader(report(header,
+		row("Root Certificate", chrome, "Google Chrome: Included"),
+		row("Root Certificate", mozilla, "Mozilla: Included"),
+	)), stores)
+	fatalIfErr(t, err)
+	if !bytes.Equal(got, again) {
+		t.Errorf("output depends on the order of the report")
+	}
+
+	// Columns are found by name, with surrounding spaces.
+	reordered := []string{" " + ccadbStatus + " ", ccadbPEM, ccadbRecordType}
+	if _, err := parseCCADB(strings.NewReader(report(reordered,
+		[]string{"Mozilla: Included", string(mozilla), "Root Certificate"},
+	)), stores); err != nil {
+		t.Errorf("failed to parse reordered columns: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		report string
+	}{
+		{"Empty", ""},
+		{"MissingColumn", report([]string{ccadbRecordType, ccadbPEM},
+			[]string{"Root Certificate", string(mozilla)})},
+		{"NoRoots", report(header,
+			row("Root Certificate", apple, "Apple: Included"),
+			row("Intermediate Certificate", intermediate, "Mozilla: Included"))},
+		{"InvalidPEM", report(header,
+			row("Root Certificate", []byte("not a certificate"), "Mozilla: Included"))},
+		{"InvalidCertificate", report(header,
+			row("Root Certificate", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("junk")}),
+				"Mozilla: Included"))},
+		{"WrongPEMType", report(header,
+			row("Root Certificate", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("junk")}),
+				"Mozilla: Included"))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseCCADB(strings.NewReader(tc.report), stores); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+// newTestRoot returns the PEM of a new self-signed CA certificate.
+func newTestRoot(t *testing.T, cn string) []byte {
+	_, _, p := newTestCA(t, cn)
+	return p
+}
@@ -0,0 +1,629 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/sunlight"
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/google/certificate-transparency-go/x509util"
+	"golang.org/x/mod/sumdb/note"
+	"gopkg.in/yaml.v3"
+)
+
+// checkConfigProbePrefix is the prefix of the object written and deleted by
+// "sunlight check-config" to check the bucket permissions. It doesn't collide
+// with any object of the log.
+const checkConfigProbePrefix = ".sunlight-check-config/"
+
+// checkConfig implements the "sunlight check-config" command, which loads the
+// config file like the log would, without serving or sequencing anything, and
+// reports every problem it finds, rather than stopping at the first one.
+//
+// Beyond parsing, it fetches the roots, loads the keys and makes a test
+// signature, checks that the lock backend and the bucket are reachable, and
+// that their checkpoints verify with the log name and key, and probes the
+// bucket permissions by writing, reading, listing, and deleting an object
+// under checkConfigProbePrefix. LIST and DELETE are only needed by "sunlight
+// gc", so missing them are warnings.
+//
+// Logs with the same Roots are assumed to be temporal shards of the same log
+// series, and their NotAfterStart-NotAfterLimit intervals must not overlap.
+//
+// It exits with status 1 if any check failed.
+func checkConfig(args []string) {
+	fs := flag.NewFlagSet("sunlight check-config", flag.ExitOnError)
+	configFlag := fs.String("c", "sunlight.yaml", "path to the config file")
+	offlineFlag := fs.Bool("offline", false, "skip the checks that connect to the backends")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	yml, err := os.ReadFile(*configFlag)
+	if err != nil {
+		logger.Error("failed to read config file", "err", err)
+		os.Exit(1)
+	}
+	cc := &configChecker{logger: logger, offline: *offlineFlag,
+		logIDs: make(map[[sha256.Size]byte]string)}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := cc.check(ctx, yml)
+	if cc.failures > 0 {
+		logger.Error("config check failed", "failures", cc.failures, "warnings", cc.warnings)
+		os.Exit(1)
+	}
+	logger.Info("config check passed", "logs", len(c.Logs), "warnings", cc.warnings)
+}
+
+// configChecker counts and logs the results of "sunlight check-config".
+type configChecker struct {
+	logger   *slog.Logger
+	offline  bool
+	failures int
+	warnings int
+
+	// lock is the lock backend, or nil if it failed to load.
+	lock ctlog.LockBackend
+
+	// logIDs maps the log IDs checked so far to the ShortName of their log.
+	logIDs map[[sha256.Size]byte]string
+}
+
+// check runs all the checks on the config file yml, and returns the parsed
+// config, or nil if it can't be parsed.
+func (cc *configChecker) check(ctx context.Context, yml []byte) *Config {
+	c := &Config{}
+	if err := unmarshalConfig(yml, c); err != nil {
+		cc.fail(cc.logger, "failed to parse config file", "err", err)
+		return nil
+	}
+
+	// Sunlight ignores unknown keys, so typos silently leave options unset.
+	// The expanded file is checked, so that values from environment variables
+	// are decoded like by sunlight.
+	root, err := parseConfigNode(yml)
+	if err != nil {
+		panic(err) // already parsed above
+	}
+	expanded, err := yaml.Marshal(root)
+	if err != nil {
+		panic(err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(expanded))
+	dec.KnownFields(true)
+	if err := dec.Decode(&configFields{}); err != nil {
+		cc.fail(cc.logger, "unknown keys in config file", "err", err)
+	}
+
+	cc.checkGlobal(ctx, c)
+	for i := range c.Logs {
+		cc.checkLog(ctx, c, &c.Logs[i])
+	}
+	cc.checkShards(c.Logs)
+	return c
+}
+
+func (cc *configChecker) fail(logger *slog.Logger, msg string, args ...any) {
+	cc.failures++
+	logger.Error(msg, args...)
+}
+
+func (cc *configChecker) warn(logger *slog.Logger, msg string, args ...any) {
+	cc.warnings++
+	logger.Warn(msg, args...)
+}
+
+// duration checks that s, named field, is empty or a valid Go duration.
+func (cc *configChecker) duration(logger *slog.Logger, field, s string) {
+	if s == "" {
+		return
+	}
+	if _, err := time.ParseDuration(s); err != nil {
+		cc.fail(logger, "invalid "+field, "err", err)
+	}
+}
+
+func (cc *configChecker) checkGlobal(ctx context.Context, c *Config) {
+	logger := cc.logger
+
+	if len(c.Logs) == 0 {
+		cc.fail(logger, "no logs configured")
+	}
+	if c.Listen == "" {
+		cc.warn(logger, "Listen is not set")
+	}
+	if c.ACME.Host != "" && c.ACME.Cache == "" {
+		cc.fail(logger, "ACME.Cache is required with ACME.Host")
+	}
+
+	// The File is not opened, to avoid creating it.
+	logging := c.Logging
+	logging.File = ""
+	if _, err := newLogging(logging); err != nil {
+		cc.fail(logger, "invalid Logging configuration", "err", err)
+	}
+	if _, err := newAdminAuth(c.Admin.TokenFile, c.Admin.ClientCAs); err != nil {
+		cc.fail(logger, "invalid Admin configuration", "err", err)
+	}
+	if c.Admin.PublicDebug && c.Admin.TokenFile == "" && c.Admin.ClientCAs == "" {
+		cc.fail(logger, "Admin.PublicDebug requires Admin.TokenFile or Admin.ClientCAs")
+	}
+	if c.Admin.ClientCAs != "" && c.ACME.Host == "" {
+		cc.warn(logger, "Admin.ClientCAs requires ACME, or running with -testcert")
+	}
+	switch c.LatencyMetrics {
+	case "", "summary":
+		if c.TraceExemplars {
+			cc.fail(logger, "TraceExemplars requires histogram LatencyMetrics")
+		}
+	case "histogram", "native-histogram":
+	default:
+		cc.fail(logger, "unknown LatencyMetrics type", "type", c.LatencyMetrics)
+	}
+	if len(c.Alerts.Webhooks) > 0 {
+		if _, err := newWebhookAlerter(c.Alerts, logger); err != nil {
+			cc.fail(logger, "invalid Alerts configuration", "err", err)
+		}
+	}
+	if c.NTP.Server != "" && c.NTP.DateURL != "" {
+		cc.fail(logger, "only one of NTP.Server and NTP.DateURL can be set")
+	}
+	if c.NTP.DateURL != "" {
+		if u, err := url.Parse(c.NTP.DateURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+			cc.fail(logger, "NTP.DateURL must be an HTTP URL", "url", c.NTP.DateURL)
+		}
+	}
+	cc.duration(logger, "NTP.MaxOffset", c.NTP.MaxOffset)
+	if c.Limits.MemoryLimit != "" {
+		if _, err := parseMemoryLimit(c.Limits.MemoryLimit); err != nil {
+			cc.fail(logger, "invalid Limits.MemoryLimit", "err", err)
+		}
+	}
+	cc.duration(logger, "Limits.ReadTimeout", c.Limits.ReadTimeout)
+	cc.duration(logger, "Limits.WriteTimeout", c.Limits.WriteTimeout)
+	cc.duration(logger, "Limits.IdleTimeout", c.Limits.IdleTimeout)
+	if _, err := c.Listener.check(); err != nil {
+		cc.fail(logger, "invalid Listener configuration", "err", err)
+	}
+	if (c.Listener.Network != "" || c.Listener.FastOpen) && (strings.HasPrefix(c.Listen, "unix:") ||
+		c.Listen == "systemd" || strings.HasPrefix(c.Listen, "systemd:")) {
+		cc.warn(logger, "Listener.Network and Listener.FastOpen are ignored for unix and systemd sockets")
+	}
+	if c.Debug.MaxConnections < 0 {
+		cc.fail(logger, "Debug.MaxConnections can't be negative")
+	}
+	cc.duration(logger, "NTP.Interval", c.NTP.Interval)
+	cc.duration(logger, "StatsD.Interval", c.StatsD.Interval)
+
+	var names, shortNames, prefixes, buckets []string
+	for _, lc := range c.Logs {
+		bucket := lc.S3Endpoint + "|" + lc.S3Bucket + "|" + lc.S3KeyPrefix
+		if slices.Contains(buckets, bucket) {
+			cc.fail(logger, "bucket and S3KeyPrefix shared by multiple logs",
+				"bucket", lc.S3Bucket, "prefix", lc.S3KeyPrefix)
+		}
+		buckets = append(buckets, bucket)
+		if slices.Contains(names, lc.Name) {
+			cc.fail(logger, "duplicate log Name", "name", lc.Name)
+		}
+		if slices.Contains(shortNames, lc.ShortName) {
+			cc.fail(logger, "duplicate log ShortName", "log", lc.ShortName)
+		}
+		if slices.Contains(prefixes, lc.HTTPPrefix) {
+			cc.fail(logger, "duplicate log HTTPPrefix", "prefix", lc.HTTPPrefix)
+		}
+		names, shortNames, prefixes = append(names, lc.Name),
+			append(shortNames, lc.ShortName), append(prefixes, lc.HTTPPrefix)
+	}
+	if len(c.Witness.Logs) > 0 {
+		if _, err := newWitnessServer(&c.Witness, nil, logger); err != nil {
+			cc.fail(logger, "invalid Witness configuration", "err", err)
+		}
+		prefix := c.Witness.HTTPPrefix
+		if prefix == "" {
+			prefix = "/witness"
+		}
+		if slices.Contains(prefixes, prefix) {
+			cc.fail(logger, "Witness.HTTPPrefix is shared with a log", "prefix", prefix)
+		}
+	}
+	if c.Kubernetes.Lease != (KubernetesConfig{}).Lease {
+		if c.Kubernetes.Lease.Name == "" {
+			cc.fail(logger, "Kubernetes.Lease requires Name")
+		}
+		if _, _, _, err := leaseTimings(c.Kubernetes.Lease.Duration,
+			c.Kubernetes.Lease.RenewDeadline, c.Kubernetes.Lease.RetryPeriod); err != nil {
+			cc.fail(logger, "invalid Kubernetes.Lease configuration", "err", err)
+		}
+	}
+	if c.Region.Name != "" {
+		if c.Checkpoints != "" {
+			cc.fail(logger, "Region is not supported with the SQLite Checkpoints backend")
+		}
+		if _, _, _, err := leaseTimings(c.Region.Lease.Duration,
+			c.Region.Lease.RenewDeadline, c.Region.Lease.RetryPeriod); err != nil {
+			cc.fail(logger, "invalid Region.Lease configuration", "err", err)
+		}
+	} else if c.Region.Lease != (RegionConfig{}).Lease {
+		cc.warn(logger, "Region.Lease is ignored without Region.Name")
+	}
+
+	if cc.offline {
+		return
+	}
+	db, err := newLockBackend(ctx, c, logger)
+	if err != nil {
+		cc.fail(logger, "failed to create lock backend", "err", err)
+		return
+	}
+	cc.lock = db
+}
+
+func (cc *configChecker) checkLog(ctx context.Context, c *Config, lc *LogConfig) {
+	logger := cc.logger.With("log", lc.ShortName)
+	if lc.Name == "" || lc.ShortName == "" {
+		cc.fail(logger, "missing name or short name for log")
+	}
+	if lc.HTTPPrefix != "" && (lc.HTTPPrefix[0] != '/' || lc.HTTPPrefix[len(lc.HTTPPrefix)-1] == '/') {
+		cc.fail(logger, "HTTPPrefix must start with a slash and not end with one", "prefix", lc.HTTPPrefix)
+	}
+	if _, err := time.Parse(time.DateOnly, lc.Inception); err != nil {
+		cc.fail(logger, "invalid Inception date", "err", err)
+	}
+	if lc.Cache == "" {
+		cc.fail(logger, "Cache is required")
+	}
+	if lc.S3Bucket == "" {
+		cc.fail(logger, "S3Bucket is required")
+	}
+
+	notAfterStart, err := time.Parse(time.RFC3339, lc.NotAfterStart)
+	if err != nil {
+		cc.fail(logger, "failed to parse NotAfterStart", "err", err)
+	}
+	notAfterLimit, err := time.Parse(time.RFC3339, lc.NotAfterLimit)
+	if err != nil {
+		cc.fail(logger, "failed to parse NotAfterLimit", "err", err)
+	}
+	if !notAfterStart.Before(notAfterLimit) {
+		cc.fail(logger, "NotAfterStart must be before NotAfterLimit")
+	}
+
+	if len(lc.CCADB.Stores) > 0 {
+		if _, err := os.Stat(lc.Roots); err != nil {
+			cc.warn(logger, "Roots file will be fetched from the CCADB at startup", "err", err)
+		}
+	} else if _, _, err := loadRoots(ctx, lc.Roots); err != nil {
+		cc.fail(logger, "failed to load roots", "err", err)
+	}
+	for _, h := range lc.DeniedRoots {
+		if b, err := hex.DecodeString(h); err != nil || len(b) != sha256.Size {
+			cc.fail(logger, "invalid DeniedRoots hash", "hash", h)
+		}
+	}
+	if lc.TestRoots != "" {
+		if lc.TestRootsToken == "" {
+			cc.fail(logger, "TestRoots requires TestRootsToken")
+		}
+		if err := x509util.NewPEMCertPool().AppendCertsFromPEMFile(lc.TestRoots); err != nil {
+			cc.fail(logger, "failed to load test roots", "err", err)
+		}
+	}
+	if lc.CrossSigned != "" {
+		if err := x509util.NewPEMCertPool().AppendCertsFromPEMFile(lc.CrossSigned); err != nil {
+			cc.fail(logger, "failed to load cross-signed intermediates", "err", err)
+		}
+	}
+	if _, err := parseSignatureAlgorithms(lc.RejectSignatureAlgorithms); err != nil {
+		cc.fail(logger, "failed to parse RejectSignatureAlgorithms", "err", err)
+	}
+	if lc.Dedup != "" && lc.Dedup != "leaf" && lc.Dedup != "tbs" {
+		cc.fail(logger, "unknown Dedup mode", "dedup", lc.Dedup)
+	}
+	if !slices.Contains([]string{"", "log", "reject", "sct"}, lc.LoggedPrecert) {
+		cc.fail(logger, "unknown LoggedPrecert action", "action", lc.LoggedPrecert)
+	}
+	if len(lc.Policy.Command) > 0 && lc.Policy.Webhook != "" {
+		cc.fail(logger, "only one of Policy.Command and Policy.Webhook can be set")
+	}
+	if lc.State != "" {
+		if _, err := time.Parse(time.RFC3339, lc.StateTimestamp); err != nil {
+			cc.fail(logger, "failed to parse StateTimestamp", "err", err)
+		}
+	}
+	cc.duration(logger, "Retention", lc.Retention)
+	cc.duration(logger, "SubmissionTimeout", lc.SubmissionTimeout)
+	if lc.MaxConcurrentValidations < 0 || lc.MaxBackendRequests < 0 {
+		cc.fail(logger, "MaxConcurrentValidations and MaxBackendRequests must not be negative")
+	}
+	cc.duration(logger, "S3Transport.IdleConnTimeout", lc.S3Transport.IdleConnTimeout)
+	if lc.S3Transport.MaxIdleConnsPerHost < 0 || lc.S3Transport.TLSSessionCacheSize < 0 ||
+		lc.S3Transport.PrewarmConnections < 0 {
+		cc.fail(logger, "S3Transport values must not be negative")
+	}
+	if lc.TileStore.Path != "" {
+		if !lc.ServeMonitoring {
+			cc.warn(logger, "TileStore is only used with ServeMonitoring")
+		}
+		if _, err := tileStoreSize(lc); err != nil {
+			cc.fail(logger, "invalid TileStore.Size", "err", err)
+		}
+	}
+	if _, err := hedgingOptions(lc); err != nil {
+		cc.fail(logger, "invalid Hedging", "err", err)
+	}
+	if err := compressionOptions(lc).Check(); err != nil {
+		cc.fail(logger, "invalid Compression", "err", err)
+	}
+	if n := lc.S3Transport.PrewarmConnections; n > 0 && n > max(lc.S3Transport.MaxIdleConnsPerHost, 2) {
+		cc.warn(logger, "S3Transport.PrewarmConnections is more than MaxIdleConnsPerHost, the extra connections will be closed")
+	}
+	if lc.MaxConcurrentValidations > 0 && lc.SubmissionTimeout == "" {
+		cc.warn(logger, "MaxConcurrentValidations without SubmissionTimeout queues requests until the HTTP server WriteTimeout")
+	}
+	if _, err := ctlog.NewFeatures(lc.Features); err != nil {
+		cc.fail(logger, "invalid Features", "err", err)
+	}
+	if lc.Retention != "" && lc.NotAfterLimit == "" {
+		cc.fail(logger, "Retention requires NotAfterLimit")
+	}
+	if lc.SelfMonitor.Enabled && lc.MonitoringURL == "" {
+		cc.fail(logger, "SelfMonitor requires MonitoringURL")
+	}
+	if len(lc.Witnesses) > 0 && lc.MonitoringURL == "" {
+		cc.fail(logger, "Witnesses requires MonitoringURL")
+	}
+	for _, w := range lc.Witnesses {
+		if _, err := newWitness(w.URL, w.PublicKey, nil, ""); err != nil {
+			cc.fail(logger, "invalid witness", "url", w.URL, "err", err)
+		}
+	}
+	cc.duration(logger, "RootsReloadInterval", lc.RootsReloadInterval)
+	cc.duration(logger, "ClockSkew", lc.ClockSkew)
+	cc.duration(logger, "Policy.Timeout", lc.Policy.Timeout)
+	cc.duration(logger, "Audit.Interval", lc.Audit.Interval)
+	cc.duration(logger, "SignerCheck.Interval", lc.SignerCheck.Interval)
+	cc.duration(logger, "SignerCheck.MaxLatency", lc.SignerCheck.MaxLatency)
+	cc.duration(logger, "SelfMonitor.Interval", lc.SelfMonitor.Interval)
+	cc.duration(logger, "CCADB.SyncInterval", lc.CCADB.SyncInterval)
+
+	for _, path := range lc.CheckpointKeys {
+		if _, err := loadNoteSigner(path, lc.KeyIdentityFile, lc.KeyPassphraseFile); err != nil {
+			cc.fail(logger, "failed to load checkpoint key", "path", path, "err", err)
+		}
+	}
+	if cc.offline && lc.Key == "" {
+		// Remote signers are never contacted in offline mode.
+		return
+	}
+	signer, _, err := newSigner(ctx, lc, logger)
+	if err != nil {
+		cc.fail(logger, "failed to load log key", "err", err)
+		return
+	}
+	if !cc.checkKey(logger, lc, signer) {
+		return
+	}
+
+	spki, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		cc.fail(logger, "failed to marshal public key", "err", err)
+		return
+	}
+	logID := sha256.Sum256(spki)
+	logger = logger.With("log_id", base64.StdEncoding.EncodeToString(logID[:]))
+	if other, ok := cc.logIDs[logID]; ok {
+		// The lock backend is keyed by log ID, so the logs would conflict.
+		cc.fail(logger, "log key is also used by another log", "other_log", other)
+		return
+	}
+	cc.logIDs[logID] = lc.ShortName
+	if cc.offline {
+		return
+	}
+	b, err := ctlog.NewS3Backend(ctx, lc.S3Region, lc.S3Bucket, lc.S3Endpoint, lc.S3KeyPrefix, logger)
+	if err != nil {
+		cc.fail(logger, "failed to create backend", "err", err)
+		return
+	}
+	// The log is created at startup on the Inception date, so it must exist
+	// only after that.
+	created := time.Now().Format(time.DateOnly) > lc.Inception
+	cc.checkCheckpoints(ctx, logger, lc.Name, signer.Public(), logID, b, created)
+	cc.checkBucket(ctx, logger, b)
+}
+
+// checkKey checks that signer matches PublicKey, if set, and that it can make
+// a valid signature.
+func (cc *configChecker) checkKey(logger *slog.Logger, lc *LogConfig, signer crypto.Signer) bool {
+	pub, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		cc.fail(logger, "log key is not an ECDSA key")
+		return false
+	}
+	if lc.PublicKey != "" {
+		der, err := base64.StdEncoding.DecodeString(lc.PublicKey)
+		if err != nil {
+			cc.fail(logger, "failed to parse public key base64", "err", err)
+			return false
+		}
+		cfgPubKey, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			cc.fail(logger, "failed to parse public key", "err", err)
+			return false
+		}
+		if !pub.Equal(cfgPubKey) {
+			spki, _ := x509.MarshalPKIXPublicKey(pub)
+			cc.fail(logger, "configured private and public keys do not match", "configured", lc.PublicKey,
+				"publicFromPrivate", base64.StdEncoding.EncodeToString(spki))
+			return false
+		}
+	}
+	digest := sha256.Sum256([]byte("sunlight check-config"))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		cc.fail(logger, "failed to make a test signature", "err", err)
+		return false
+	}
+	if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+		cc.fail(logger, "test signature doesn't verify with the log public key")
+		return false
+	}
+	logger.Info("log key OK")
+	return true
+}
+
+// checkCheckpoints checks that the checkpoints in the lock backend and in the
+// bucket exist, are signed by the log key for the log name, and that the
+// latter is not ahead of the former. If the log was not created yet, missing
+// checkpoints are expected.
+func (cc *configChecker) checkCheckpoints(ctx context.Context, logger *slog.Logger,
+	name string, key crypto.PublicKey, logID [sha256.Size]byte, b ctlog.Backend, created bool) {
+	if cc.lock == nil {
+		return
+	}
+	v, err := sunlight.NewRFC6962Verifier(name, key, nil)
+	if err != nil {
+		cc.fail(logger, "failed to construct verifier", "err", err)
+		return
+	}
+	open := func(signed []byte) (sunlight.Checkpoint, error) {
+		n, err := note.Open(signed, note.VerifierList(v))
+		if err != nil {
+			return sunlight.Checkpoint{}, err
+		}
+		c, err := sunlight.ParseCheckpoint(n.Text)
+		if err != nil {
+			return sunlight.Checkpoint{}, err
+		}
+		if c.Origin != name {
+			return sunlight.Checkpoint{}, fmt.Errorf("checkpoint origin is %q", c.Origin)
+		}
+		return c, nil
+	}
+
+	lock, lockErr := cc.lock.Fetch(ctx, logID)
+	signed, fetchErr := b.Fetch(ctx, "checkpoint")
+	if lockErr != nil && fetchErr != nil && !created {
+		logger.Info("log doesn't exist yet, it will be created on the Inception date")
+		return
+	}
+	if lockErr != nil {
+		cc.fail(logger, "failed to fetch checkpoint from lock backend", "err", lockErr)
+		return
+	}
+	locked, err := open(lock.Bytes())
+	if err != nil {
+		cc.fail(logger, "lock checkpoint doesn't match the log name and key", "err", err)
+		return
+	}
+	if fetchErr != nil {
+		cc.fail(logger, "failed to fetch checkpoint from bucket", "err", fetchErr)
+		return
+	}
+	published, err := open(signed)
+	if err != nil {
+		cc.fail(logger, "bucket checkpoint doesn't match the log name and key", "err", err)
+		return
+	}
+	if published.N > locked.N {
+		cc.fail(logger, "bucket checkpoint is ahead of lock checkpoint",
+			"tree_size", published.N, "lock_tree_size", locked.N)
+		return
+	}
+	logger.Info("checkpoints OK", "tree_size", published.N, "lock_tree_size", locked.N)
+}
+
+// checkBucket uploads, fetches, lists, and deletes a probe object.
+func (cc *configChecker) checkBucket(ctx context.Context, logger *slog.Logger, b *ctlog.S3Backend) {
+	r := make([]byte, 8)
+	rand.Read(r)
+	key := checkConfigProbePrefix + hex.EncodeToString(r)
+	data := []byte("sunlight check-config probe\n")
+
+	if err := b.Upload(ctx, key, data, &ctlog.UploadOptions{ContentType: "text/plain; charset=utf-8"}); err != nil {
+		cc.fail(logger, "bucket PUT failed", "key", key, "err", err)
+		return
+	}
+	if got, err := b.Fetch(ctx, key); err != nil {
+		cc.fail(logger, "bucket GET failed", "key", key, "err", err)
+	} else if !bytes.Equal(got, data) {
+		cc.fail(logger, "bucket GET returned different contents", "key", key)
+	}
+	var listed bool
+	for obj, err := range b.List(ctx, checkConfigProbePrefix) {
+		if err != nil {
+			cc.warn(logger, "bucket LIST failed, sunlight gc won't work", "err", err)
+			listed = true // already reported
+			break
+		}
+		if obj.Key == key {
+			listed = true
+		}
+	}
+	if !listed {
+		cc.warn(logger, "bucket LIST didn't return the probe object, sunlight gc won't work", "key", key)
+	}
+	if err := b.Delete(ctx, []string{key}); err != nil {
+		cc.warn(logger, "bucket DELETE failed, sunlight gc won't work; delete the probe object manually",
+			"key", key, "err", err)
+		return
+	}
+	if _, err := b.Fetch(ctx, key); err == nil {
+		cc.warn(logger, "bucket DELETE didn't delete the probe object", "key", key)
+		return
+	}
+	logger.Info("bucket permissions OK")
+}
+
+// checkShards checks that logs with the same Roots, which are assumed to be
+// temporal shards of the same series, have non-overlapping NotAfter intervals.
+func (cc *configChecker) checkShards(logs []LogConfig) {
+	type shard struct {
+		name        string
+		start, stop time.Time
+	}
+	series := make(map[string][]shard)
+	for _, lc := range logs {
+		start, err1 := time.Parse(time.RFC3339, lc.NotAfterStart)
+		stop, err2 := time.Parse(time.RFC3339, lc.NotAfterLimit)
+		if err := errors.Join(err1, err2); err != nil {
+			continue // already reported
+		}
+		series[lc.Roots] = append(series[lc.Roots], shard{lc.ShortName, start, stop})
+	}
+	for roots, shards := range series {
+		slices.SortFunc(shards, func(a, b shard) int { return a.start.Compare(b.start) })
+		for i := 1; i < len(shards); i++ {
+			prev, s := shards[i-1], shards[i]
+			if s.start.Before(prev.stop) {
+				cc.fail(cc.logger, "temporal intervals of logs with the same Roots overlap",
+					"roots", roots, "log", prev.name, "overlapping_log", s.name,
+					"not_after_limit", prev.stop, "not_after_start", s.start)
+			} else if s.start.After(prev.stop) {
+				cc.warn(cc.logger, "gap between temporal intervals of logs with the same Roots",
+					"roots", roots, "log", prev.name, "next_log", s.name,
+					"not_after_limit", prev.stop, "not_after_start", s.start)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkConfigFiles are the files referenced by the test configs.
+type checkConfigFiles struct {
+	dir, roots, key, otherKey string
+	publicKey                 string
+}
+
+func newCheckConfigFiles(t *testing.T) *checkConfigFiles {
+	f := &checkConfigFiles{dir: t.TempDir()}
+	_, _, rootPEM := newTestCA(t, "Test Root")
+	f.roots = filepath.Join(f.dir, "roots.pem")
+	fatalIfErr(t, os.WriteFile(f.roots, rootPEM, 0o644))
+	writeKey := func(name string) (string, *ecdsa.PrivateKey) {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		fatalIfErr(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		fatalIfErr(t, err)
+		path := filepath.Join(f.dir, name)
+		fatalIfErr(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+		return path, k
+	}
+	var k *ecdsa.PrivateKey
+	f.key, k = writeKey("key.pem")
+	f.otherKey, _ = writeKey("other-key.pem")
+	spki, err := x509.MarshalPKIXPublicKey(k.Public())
+	fatalIfErr(t, err)
+	f.publicKey = base64.StdEncoding.EncodeToString(spki)
+	return f
+}
+
+// log returns the YAML of a valid log, followed by the extra lines.
+func (f *checkConfigFiles) log(shortName, key, notAfterStart, notAfterLimit string, extra ...string) string {
+	s := fmt.Sprintf(`
+  - name: example.com/%[1]s
+    shortname: %[1]s
+    inception: "2024-01-01"
+    httpprefix: /%[1]s
+    cache: %[2]s/%[1]s.db
+    s3bucket: %[1]s
+    roots: %[3]s
+    key: %[4]s
+    notafterstart: %[5]s
+    notafterlimit: %[6]s
+`, shortName, f.dir, f.roots, key, notAfterStart, notAfterLimit)
+	for _, line := range extra {
+		s += "    " + line + "\n"
+	}
+	return s
+}
+
+func runCheckConfig(t *testing.T, yml string) (cc *configChecker, output string) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	cc = &configChecker{logger: slog.New(slog.NewTextHandler(buf, nil)), offline: true,
+		logIDs: make(map[[sha256.Size]byte]string)}
+	cc.check(context.Background(), []byte(yml))
+	return cc, buf.String()
+}
+
+func TestCheckConfig(t *testing.T) {
+	f := newCheckConfigFiles(t)
+	const start, limit = "2025-01-01T00:00:00Z", "2025-07-01T00:00:00Z"
+	config := func(logs ...string) string {
+		return "listen: :8443\nlogs:" + strings.Join(logs, "")
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		cc, out := runCheckConfig(t, config(
+			f.log("a2025h1", f.key, start, limit, "publickey: "+f.publicKey, "dedup: tbs", "loggedprecert: sct"),
+			f.log("a2025h2", f.otherKey, limit, "2026-01-01T00:00:00Z"),
+		))
+		if cc.failures != 0 || cc.warnings != 0 {
+			t.Errorf("got %d failures and %d warnings:\n%s", cc.failures, cc.warnings, out)
+		}
+		if !strings.Contains(out, "log key OK") {
+			t.Errorf("log keys weren't checked:\n%s", out)
+		}
+	})
+
+	for _, tc := range []struct {
+		name string
+		yml  string
+		msg  string
+	}{
+		{"Unparseable", "logs: [", "failed to parse config file"},
+		{"NoLogs", "listen: :8443\n", "no logs configured"},
+		{"UnknownKey", config(f.log("a2025h1", f.key, start, limit, "notafterlimt: "+limit)),
+			"unknown keys in config file"},
+		{"Inception", config(strings.Replace(f.log("a2025h1", f.key, start, limit),
+			`"2024-01-01"`, `"January 1st"`, 1)), "invalid Inception date"},
+		{"NotAfterOrder", config(f.log("a2025h1", f.key, limit, start)),
+			"NotAfterStart must be before NotAfterLimit"},
+		{"NotAfterFormat", config(f.log("a2025h1", f.key, "2025-01-01", limit)),
+			"failed to parse NotAfterStart"},
+		{"Roots", config(strings.Replace(f.log("a2025h1", f.key, start, limit),
+			f.roots, filepath.Join(f.dir, "missing.pem"), 1)), "failed to load roots"},
+		{"Dedup", config(f.log("a2025h1", f.key, start, limit, "dedup: cert")), "unknown Dedup mode"},
+		{"LoggedPrecert", config(f.log("a2025h1", f.key, start, limit, "loggedprecert: ignore")),
+			"unknown LoggedPrecert action"},
+		{"Duration", config(f.log("a2025h1", f.key, start, limit, "submissiontimeout: 10")),
+			"invalid SubmissionTimeout"},
+		{"KeyFile", config(f.log("a2025h1", filepath.Join(f.dir, "missing.pem"), start, limit)),
+			"failed to load log key"},
+		{"PublicKey", config(f.log("a2025h1", f.otherKey, start, limit, "publickey: "+f.publicKey)),
+			"configured private and public keys do not match"},
+		{"SharedKey", config(f.log("a2025h1", f.key, start, limit),
+			f.log("a2025h2", f.key, limit, "2026-01-01T00:00:00Z")), "log key is also used by another log"},
+		{"DuplicateShortName", config(f.log("a2025h1", f.key, start, limit),
+			f.log("a2025h1", f.otherKey, limit, "2026-01-01T00:00:00Z")), "duplicate log ShortName"},
+		{"OverlappingShards", config(f.log("a2025h1", f.key, start, limit),
+			f.log("a2025h2", f.otherKey, "2025-06-01T00:00:00Z", "2026-01-01T00:00:00Z")),
+			"temporal intervals of logs with the same Roots overlap"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cc, out := runCheckConfig(t, tc.yml)
+			if cc.failures == 0 {
+				t.Errorf("no failures:\n%s", out)
+			}
+			if !strings.Contains(out, tc.msg) {
+				t.Errorf("output doesn't report %q:\n%s", tc.msg, out)
+			}
+		})
+	}
+
+	t.Run("Warnings", func(t *testing.T) {
+		cc, out := runCheckConfig(t, "logs:"+
+			f.log("a2025h1", f.key, start, limit)+
+			f.log("a2025h2", f.otherKey, "2025-08-01T00:00:00Z", "2026-01-01T00:00:00Z"))
+		if cc.failures != 0 {
+			t.Errorf("got %d failures:\n%s", cc.failures, out)
+		}
+		for _, msg := range []string{"Listen is not set", "gap between temporal intervals"} {
+			if !strings.Contains(out, msg) {
+				t.Errorf("output doesn't warn %q:\n%s", msg, out)
+			}
+		}
+		if cc.warnings != 2 {
+			t.Errorf("got %d warnings, expected 2:\n%s", cc.warnings, out)
+		}
+	})
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// maxCompareCheckpointSize is the maximum size of a fetched checkpoint.
+const maxCompareCheckpointSize = 1e6
+
+// compareHeaders are the response headers recorded in the evidence, which
+// help tell which cache or server produced a view.
+var compareHeaders = []string{"Date", "Age", "Last-Modified", "ETag", "Cache-Control",
+	"Server", "Via", "X-Cache", "CF-Cache-Status", "CF-Ray", "X-Amz-Request-Id"}
+
+type repeatedFlag []string
+
+func (r *repeatedFlag) String() string     { return fmt.Sprint(*r) }
+func (r *repeatedFlag) Set(v string) error { *r = append(*r, v); return nil }
+
+// compareReport is the evidence produced by "sunlight compare-checkpoints".
+type compareReport struct {
+	Log       string           `json:"log"`
+	PublicKey string           `json:"public_key"`
+	Time      time.Time        `json:"time"`
+	Views     []*compareView   `json:"views"`
+	Findings  []compareFinding `json:"findings"`
+}
+
+// compareView is the checkpoint observed at one vantage point.
+type compareView struct {
+	Source    string            `json:"source"`
+	URL       string            `json:"url"`
+	FetchedAt time.Time         `json:"fetched_at"`
+	Status    int               `json:"status,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Error     string            `json:"error,omitempty"`
+
+	// Checkpoint is the signed note, verbatim, so that it can be verified
+	// independently of this report.
+	Checkpoint string `json:"checkpoint,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	RootHash   string `json:"root_hash,omitempty"`
+
+	// Timestamp is the timestamp of the RFC 6962 signature, in milliseconds
+	// since the epoch.
+	Timestamp int64 `json:"timestamp,omitempty"`
+
+	// Witnesses maps the names of the -witness keys to whether the view
+	// carries a valid cosignature from them.
+	Witnesses map[string]bool `json:"witnesses,omitempty"`
+
+	tree tlog.Tree
+	time time.Time
+	ok   bool
+}
+
+// compareFinding is a problem found by comparing the views.
+type compareFinding struct {
+	// Kind is one of "fetch-error", "invalid-checkpoint", "split-view",
+	// "inconsistent", "unverified-consistency", "stale", or
+	// "missing-cosignature".
+	Kind    string   `json:"kind"`
+	Sources []string `json:"sources"`
+	Detail  string   `json:"detail"`
+}
+
+// compareCheckpoints implements the "sunlight compare-checkpoints" command,
+// which fetches the checkpoint of a log from multiple vantage points, such as
+// the origin bucket, a CDN, mirrors, and the witnesses that publish cosigned
+// checkpoints, and checks that they are all views of the same append-only
+// tree.
+//
+// Every checkpoint must be signed by the log key. Two checkpoints of the same
+// size with different root hashes are a split view, and are proof of log
+// misbehavior on their own. With -monitoring, checkpoints of different sizes
+// are checked to be consistent with the largest one through a consistency
+// proof built from the log tiles. Checkpoints older than -max-age than the
+// latest one are reported as stale, and ones lacking a valid cosignature from
+// a -witness key as missing it. Witness keys are note verifier keys, like the
+// ones printed by "sunlight keygen".
+//
+// The views, with the verbatim signed checkpoints and the response headers,
+// and the findings are written as JSON to -o, to be attached to an incident
+// report. It exits with status 1 if there are any findings.
+func compareCheckpoints(args []string) {
+	fs := flag.NewFlagSet("sunlight compare-checkpoints", flag.ExitOnError)
+	nameFlag := fs.String("name", "", "name of the log, the checkpoint origin (required)")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the log (required)")
+	var sources, witnesses repeatedFlag
+	fs.Var(&sources, "source", "NAME=URL of a checkpoint to compare, such as origin=https://bucket.example/checkpoint (can be repeated)")
+	fs.Var(&witnesses, "witness", "note verifier key of a witness whose cosignature is expected (can be repeated)")
+	monitoringFlag := fs.String("monitoring", "", "monitoring URL prefix of the log, to check consistency across sizes")
+	maxAgeFlag := fs.Duration("max-age", 1*time.Minute, "maximum age of a checkpoint relative to the latest one")
+	outFlag := fs.String("o", "-", "output file for the JSON report, or - for stdout")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *nameFlag == "" || *keyFlag == "" || len(sources) < 1 {
+		logger.Error("-name, -key, and at least one -source are required")
+		os.Exit(1)
+	}
+	key, err := parsePublicKey(*keyFlag)
+	if err != nil {
+		logger.Error("invalid -key", "err", err)
+		os.Exit(1)
+	}
+	report := &compareReport{Log: *nameFlag, PublicKey: *keyFlag, Time: time.Now().UTC(),
+		Findings: []compareFinding{}}
+	for _, s := range sources {
+		name, u, ok := strings.Cut(s, "=")
+		if !ok || name == "" || u == "" {
+			logger.Error("invalid -source, expected NAME=URL", "source", s)
+			os.Exit(1)
+		}
+		report.Views = append(report.Views, &compareView{Source: name, URL: u})
+	}
+
+	prefix := *monitoringFlag
+	if prefix == "" {
+		// Without -monitoring the client is only used to verify checkpoints,
+		// which doesn't fetch anything.
+		prefix = strings.TrimSuffix(report.Views[0].URL, "checkpoint")
+	}
+	c, err := client.New(&client.Config{
+		MonitoringPrefix: prefix,
+		Name:             *nameFlag,
+		PublicKey:        key,
+		UserAgent:        "filippo.io/sunlight compare-checkpoints",
+	})
+	if err != nil {
+		logger.Error("failed to create client", "err", err)
+		os.Exit(1)
+	}
+	var verifiers []note.Verifier
+	for _, w := range witnesses {
+		v, err := note.NewVerifier(w)
+		if err != nil {
+			logger.Error("invalid -witness key", "key", w, "err", err)
+			os.Exit(1)
+		}
+		verifiers = append(verifiers, v)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Fetch concurrently, so that the views are as close in time as possible.
+	hc := &http.Client{Timeout: 30 * time.Second}
+	var wg sync.WaitGroup
+	for _, v := range report.Views {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.fetch(ctx, hc, c, verifiers)
+		}()
+	}
+	wg.Wait()
+
+	report.compare(ctx, c, *monitoringFlag != "", *maxAgeFlag, verifiers)
+	for _, v := range report.Views {
+		if v.ok {
+			logger.Info("fetched checkpoint", "source", v.Source, "size", v.Size,
+				"root_hash", v.RootHash, "timestamp", v.time)
+		}
+	}
+	for _, f := range report.Findings {
+		logger.Error(f.Kind, "sources", f.Sources, "detail", f.Detail)
+	}
+
+	out := io.Writer(os.Stdout)
+	if *outFlag != "-" {
+		f, err := os.Create(*outFlag)
+		if err != nil {
+			logger.Error("failed to create output file", "err", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		logger.Error("failed to write report", "err", err)
+		os.Exit(1)
+	}
+	if len(report.Findings) > 0 {
+		os.Exit(1)
+	}
+	logger.Info("all views are consistent", "views", len(report.Views))
+}
+
+// fetch fetches and verifies the checkpoint at v.URL.
+func (v *compareView) fetch(ctx context.Context, hc *http.Client, c *client.Client, witnesses []note.Verifier) {
+	v.FetchedAt = time.Now().UTC()
+	signed, err := v.get(ctx, hc)
+	if err != nil {
+		v.Error = err.Error()
+		return
+	}
+	v.Checkpoint = string(signed)
+	cp, err := c.VerifyCheckpoint(signed)
+	if err != nil {
+		v.Error = err.Error()
+		return
+	}
+	v.tree, v.ok = cp.Tree, true
+	v.Size, v.RootHash = cp.N, cp.Hash.String()
+	v.Timestamp, v.time = cp.Timestamp, time.UnixMilli(cp.Timestamp).UTC()
+	if len(witnesses) > 0 {
+		v.Witnesses = make(map[string]bool)
+	}
+	for _, w := range witnesses {
+		_, err := note.Open(signed, note.VerifierList(w))
+		v.Witnesses[w.Name()] = err == nil
+	}
+}
+
+func (v *compareView) get(ctx context.Context, hc *http.Client) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", v.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "filippo.io/sunlight compare-checkpoints")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	v.Status = resp.StatusCode
+	v.Headers = make(map[string]string)
+	for _, h := range compareHeaders {
+		if value := resp.Header.Get(h); value != "" {
+			v.Headers[h] = value
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxCompareCheckpointSize))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (r *compareReport) find(kind, detail string, views ...*compareView) {
+	var sources []string
+	for _, v := range views {
+		sources = append(sources, v.Source)
+	}
+	r.Findings = append(r.Findings, compareFinding{Kind: kind, Sources: sources, Detail: detail})
+}
+
+// compare populates r.Findings from r.Views.
+func (r *compareReport) compare(ctx context.Context, c *client.Client, consistency bool,
+	maxAge time.Duration, witnesses []note.Verifier) {
+	var valid []*compareView
+	for _, v := range r.Views {
+		switch {
+		case v.ok:
+			valid = append(valid, v)
+		case v.Checkpoint != "":
+			r.find("invalid-checkpoint", v.Error, v)
+		default:
+			r.find("fetch-error", v.Error, v)
+		}
+	}
+	if len(valid) == 0 {
+		return
+	}
+
+	// Sort by size, so that the largest view is last, and views of the same
+	// size are adjacent.
+	slices.SortStableFunc(valid, func(a, b *compareView) int { return cmp.Compare(a.Size, b.Size) })
+	largest := valid[len(valid)-1]
+	latest := largest
+	for _, v := range valid {
+		if v.time.After(latest.time) {
+			latest = v
+		}
+	}
+
+	for i, v := range valid {
+		if i > 0 && valid[i-1].Size == v.Size && valid[i-1].tree.Hash != v.tree.Hash {
+			r.find("split-view", fmt.Sprintf("size %d has root hash %s and %s",
+				v.Size, valid[i-1].RootHash, v.RootHash), valid[i-1], v)
+		}
+		if age := latest.time.Sub(v.time); age > maxAge {
+			r.find("stale", fmt.Sprintf("checkpoint is %v older than the one from %s",
+				age, latest.Source), v)
+		}
+		for _, w := range witnesses {
+			if !v.Witnesses[w.Name()] {
+				r.find("missing-cosignature", fmt.Sprintf("no valid cosignature from %s", w.Name()), v)
+			}
+		}
+	}
+
+	if !consistency {
+		return
+	}
+	for _, v := range valid {
+		if v.Size == largest.Size {
+			continue
+		}
+		proof, err := c.ConsistencyProof(ctx, largest.tree, v.Size)
+		if err != nil {
+			r.find("unverified-consistency", fmt.Sprintf("couldn't build consistency proof from size %d to %d: %v",
+				v.Size, largest.Size, err), v, largest)
+			continue
+		}
+		if v.Size == 0 {
+			continue
+		}
+		// The proof hashes were verified against the largest tree, so if the
+		// proof fails the two views can't be of the same log.
+		if err := tlog.CheckTree(proof, largest.Size, largest.tree.Hash, v.Size, v.tree.Hash); err != nil {
+			r.find("inconsistent", fmt.Sprintf("size %d is not a prefix of size %d: %v",
+				v.Size, largest.Size, err), v, largest)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/sunlighttest"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// serveCheckpoints serves each of checkpoints at its path, and a 404 for any
+// other path.
+func serveCheckpoints(t *testing.T, checkpoints map[string][]byte) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := checkpoints[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(b)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func fetchCheckpoint(t *testing.T, tl *testLog) []byte {
+	resp, err := tl.Server.Client().Get(tl.URL + "checkpoint")
+	fatalIfErr(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	fatalIfErr(t, err)
+	return b
+}
+
+// runCompare fetches the checkpoints at paths of ts, and compares them.
+func runCompare(t *testing.T, tl *testLog, ts *httptest.Server, consistency bool,
+	witnesses []note.Verifier, paths ...string) *compareReport {
+	r := &compareReport{Log: tl.Name}
+	for _, p := range paths {
+		v := &compareView{Source: p[1:], URL: ts.URL + p}
+		v.fetch(context.Background(), ts.Client(), tl.Client, witnesses)
+		r.Views = append(r.Views, v)
+	}
+	r.compare(context.Background(), tl.Client, consistency, time.Hour, witnesses)
+	return r
+}
+
+func checkFindings(t *testing.T, r *compareReport, want ...compareFinding) {
+	t.Helper()
+	if len(r.Findings) != len(want) {
+		t.Fatalf("got findings %+v, expected %+v", r.Findings, want)
+	}
+	for i, f := range r.Findings {
+		if f.Kind != want[i].Kind || !slices.Equal(f.Sources, want[i].Sources) {
+			t.Errorf("got finding %+v, expected %s for %q", f, want[i].Kind, want[i].Sources)
+		}
+	}
+}
+
+func TestCompareCheckpoints(t *testing.T) {
+	tl := newTestLog(t)
+	tl.add(t, false)
+	tl.add(t, false)
+	old := fetchCheckpoint(t, tl)
+	tl.add(t, false)
+	tl.add(t, true)
+	latest := fetchCheckpoint(t, tl)
+	cp, err := tl.Checkpoint(context.Background())
+	fatalIfErr(t, err)
+
+	t.Run("Consistent", func(t *testing.T) {
+		ts := serveCheckpoints(t, map[string][]byte{"/origin": latest, "/cdn": latest, "/mirror": old})
+		r := runCompare(t, tl, ts, true, nil, "/origin", "/cdn", "/mirror")
+		checkFindings(t, r)
+		for _, v := range r.Views {
+			if !v.ok || v.Checkpoint == "" || v.Status != http.StatusOK || v.Headers["Cache-Control"] != "no-store" {
+				t.Errorf("view %s: incomplete evidence %+v", v.Source, v)
+			}
+		}
+		if r.Views[0].Size != cp.N || r.Views[2].Size != 2 {
+			t.Errorf("got sizes %d and %d, expected %d and 2", r.Views[0].Size, r.Views[2].Size, cp.N)
+		}
+	})
+
+	t.Run("SplitView", func(t *testing.T) {
+		fork := tl.signCheckpoint(t, tlog.Tree{N: cp.N, Hash: tlog.Hash{1}}, cp.Timestamp)
+		ts := serveCheckpoints(t, map[string][]byte{"/origin": latest, "/cdn": fork})
+		r := runCompare(t, tl, ts, false, nil, "/origin", "/cdn")
+		checkFindings(t, r, compareFinding{Kind: "split-view", Sources: []string{"origin", "cdn"}})
+	})
+
+	t.Run("Inconsistent", func(t *testing.T) {
+		fork := tl.signCheckpoint(t, tlog.Tree{N: 2, Hash: tlog.Hash{1}}, cp.Timestamp)
+		ts := serveCheckpoints(t, map[string][]byte{"/origin": latest, "/mirror": fork})
+		r := runCompare(t, tl, ts, true, nil, "/origin", "/mirror")
+		checkFindings(t, r, compareFinding{Kind: "inconsistent", Sources: []string{"mirror", "origin"}})
+
+		// Without -monitoring, different sizes can't be compared.
+		r = runCompare(t, tl, ts, false, nil, "/origin", "/mirror")
+		checkFindings(t, r)
+	})
+
+	t.Run("BadSignature", func(t *testing.T) {
+		// A checkpoint for the log ID, signed by a different key.
+		forger := &testLog{Log: &sunlighttest.Log{Name: tl.Name, Key: newOtherKey(t), Client: tl.Client}}
+		forged := forger.signCheckpoint(t, cp.Tree, cp.Timestamp)
+		tampered := slices.Clone(latest)
+		tampered[len(tampered)-2] ^= 1
+		ts := serveCheckpoints(t, map[string][]byte{"/origin": latest, "/forged": forged, "/tampered": tampered})
+		r := runCompare(t, tl, ts, false, nil, "/origin", "/forged", "/tampered", "/missing")
+		checkFindings(t, r,
+			compareFinding{Kind: "invalid-checkpoint", Sources: []string{"forged"}},
+			compareFinding{Kind: "invalid-checkpoint", Sources: []string{"tampered"}},
+			compareFinding{Kind: "fetch-error", Sources: []string{"missing"}})
+		if r.Views[3].Status != http.StatusNotFound {
+			t.Errorf("got status %d for a missing checkpoint", r.Views[3].Status)
+		}
+	})
+
+	t.Run("Stale", func(t *testing.T) {
+		stale := tl.signCheckpoint(t, cp.Tree, cp.Timestamp-2*time.Hour.Milliseconds())
+		ts := serveCheckpoints(t, map[string][]byte{"/origin": latest, "/cdn": stale})
+		r := runCompare(t, tl, ts, false, nil, "/origin", "/cdn")
+		checkFindings(t, r, compareFinding{Kind: "stale", Sources: []string{"cdn"}})
+	})
+
+	t.Run("Cosignature", func(t *testing.T) {
+		skey, vkey, err := note.GenerateKey(rand.Reader, "witness.example")
+		fatalIfErr(t, err)
+		signer, err := note.NewSigner(skey)
+		fatalIfErr(t, err)
+		verifier, err := note.NewVerifier(vkey)
+		fatalIfErr(t, err)
+		cosigned := tl.signCheckpoint(t, cp.Tree, cp.Timestamp, signer)
+		ts := serveCheckpoints(t, map[string][]byte{"/origin": latest, "/witness": cosigned})
+		r := runCompare(t, tl, ts, false, []note.Verifier{verifier}, "/origin", "/witness")
+		checkFindings(t, r, compareFinding{Kind: "missing-cosignature", Sources: []string{"origin"}})
+		if !r.Views[1].Witnesses["witness.example"] {
+			t.Errorf("valid cosignature not recorded")
+		}
+	})
+}
+
+// newOtherKey returns a key that's not the key of any test log.
+func newOtherKey(t *testing.T) *ecdsa.PrivateKey {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	return k
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// maxMirrorObjectSize is the maximum size of a compared object.
+const maxMirrorObjectSize = 64 << 20
+
+var errMirrorNotFound = errors.New("object not found")
+
+// mirrorReport is the output of "sunlight compare-mirrors".
+type mirrorReport struct {
+	A     string    `json:"a"`
+	B     string    `json:"b"`
+	Time  time.Time `json:"time"`
+	SizeA int64     `json:"size_a"`
+	SizeB int64     `json:"size_b"`
+
+	// From and Size are the range of entries whose tiles were compared.
+	From     int64           `json:"from"`
+	Size     int64           `json:"size"`
+	Objects  int             `json:"objects"`
+	Findings []mirrorFinding `json:"findings"`
+}
+
+// mirrorFinding is a difference between the two copies.
+//
+// Kind is one of "missing" (in A but not in B), "extra" (in B but not in A),
+// "differing", or "fetch-error".
+type mirrorFinding struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	HashA  string `json:"hash_a,omitempty"`
+	HashB  string `json:"hash_b,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// compareMirrors implements the "sunlight compare-mirrors" command, which
+// compares two copies of a log, such as the origin bucket and a CDN or a
+// mirror, object by object.
+//
+// Since CDNs can't be listed, the compared objects are the tiles of the tree of
+// the smaller of the two checkpoints, for the entries starting at -from, and
+// the issuers bundle. Each object is fetched from both copies and compared by
+// SHA-256 hash. A is treated as the reference, so objects only found in A are
+// reported as missing, and objects only found in B as extra. Partial tiles are
+// compared only if both checkpoints have the same size, or if both copies
+// still have them, since the larger log might have collected them.
+//
+// The report is written as JSON to -o. It exits with status 1 if there are
+// any findings.
+func compareMirrors(args []string) {
+	fs := flag.NewFlagSet("sunlight compare-mirrors", flag.ExitOnError)
+	aFlag := fs.String("a", "", "monitoring URL prefix of the reference copy, such as the origin bucket (required)")
+	bFlag := fs.String("b", "", "monitoring URL prefix of the copy to check, such as a CDN or mirror (required)")
+	nameFlag := fs.String("name", "", "name of the log, the checkpoint origin (required)")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the log (required)")
+	fromFlag := fs.Int64("from", 0, "index of the first entry whose tiles are compared")
+	concurrencyFlag := fs.Int("concurrency", 8, "maximum number of concurrent object comparisons")
+	outFlag := fs.String("o", "-", "output file for the JSON report, or - for stdout")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *aFlag == "" || *bFlag == "" || *nameFlag == "" || *keyFlag == "" {
+		logger.Error("-a, -b, -name, and -key are required")
+		os.Exit(1)
+	}
+	if *concurrencyFlag <= 0 || *fromFlag < 0 {
+		logger.Error("-concurrency must be positive and -from not negative")
+		os.Exit(1)
+	}
+	key, err := parsePublicKey(*keyFlag)
+	if err != nil {
+		logger.Error("invalid -key", "err", err)
+		os.Exit(1)
+	}
+	hc := &http.Client{Timeout: 1 * time.Minute}
+	newClient := func(prefix string) *client.Client {
+		c, err := client.New(&client.Config{
+			MonitoringPrefix: prefix,
+			Name:             *nameFlag,
+			PublicKey:        key,
+			HTTPClient:       hc,
+			UserAgent:        "filippo.io/sunlight compare-mirrors",
+		})
+		if err != nil {
+			logger.Error("failed to create client", "err", err)
+			os.Exit(1)
+		}
+		return c
+	}
+	a, b := newClient(*aFlag), newClient(*bFlag)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := compareMirrorCopies(ctx, hc, *aFlag, *bFlag, a, b, *fromFlag, *concurrencyFlag, logger)
+	if err != nil {
+		logger.Error("failed to compare mirrors", "err", err)
+		os.Exit(1)
+	}
+	for _, f := range report.Findings {
+		logger.Error(f.Kind, "key", f.Key, "detail", f.Detail)
+	}
+	logger.Info("compared mirrors", "objects", report.Objects, "findings", len(report.Findings))
+
+	out := io.Writer(os.Stdout)
+	if *outFlag != "-" {
+		f, err := os.Create(*outFlag)
+		if err != nil {
+			logger.Error("failed to create output file", "err", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		logger.Error("failed to write report", "err", err)
+		os.Exit(1)
+	}
+	if len(report.Findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+// compareMirrorCopies compares the copies at the monitoring prefixes aURL and
+// bURL, fetched with hc and checked with the clients a and b, and returns the
+// report with the findings sorted by key.
+func compareMirrorCopies(ctx context.Context, hc *http.Client, aURL, bURL string, a, b *client.Client,
+	from int64, concurrency int, logger *slog.Logger) (*mirrorReport, error) {
+	cpA, err := a.Checkpoint(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checkpoint of A: %w", err)
+	}
+	cpB, err := b.Checkpoint(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checkpoint of B: %w", err)
+	}
+	report := &mirrorReport{A: aURL, B: bURL, Time: time.Now().UTC(),
+		SizeA: cpA.N, SizeB: cpB.N, From: from, Size: min(cpA.N, cpB.N),
+		Findings: []mirrorFinding{}}
+	if cpA.N == cpB.N && cpA.Hash != cpB.Hash {
+		report.Findings = append(report.Findings, mirrorFinding{Kind: "differing", Key: "checkpoint",
+			HashA: cpA.Hash.String(), HashB: cpB.Hash.String(),
+			Detail: "checkpoints of the same size have different root hashes"})
+	}
+	if report.From > report.Size {
+		report.From = report.Size
+	}
+	logger.Info("comparing mirrors", "size_a", cpA.N, "size_b", cpB.N, "from", report.From)
+
+	m := &mirrorComparer{hc: hc, a: strings.TrimSuffix(aURL, "/") + "/",
+		b: strings.TrimSuffix(bURL, "/") + "/", report: report}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	compare := func(key string, dataTile, partial bool) {
+		select {
+		case <-ctx.Done():
+			return
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			m.compare(ctx, key, dataTile, partial && cpA.N != cpB.N)
+		}()
+	}
+	compare("issuers.pem", false, false)
+	for _, t := range tlog.NewTiles(client.TileHeight, report.From, report.Size) {
+		compare(t.Path(), false, t.W < 1<<client.TileHeight)
+		if t.L == 0 {
+			t.L = -1
+			compare(t.Path(), true, t.W < 1<<client.TileHeight)
+		}
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("interrupted after comparing %d objects: %w", report.Objects, ctx.Err())
+	}
+
+	slices.SortFunc(report.Findings, func(a, b mirrorFinding) int { return strings.Compare(a.Key, b.Key) })
+	return report, nil
+}
+
+type mirrorComparer struct {
+	hc   *http.Client
+	a, b string
+
+	mu     sync.Mutex
+	report *mirrorReport
+}
+
+// compare fetches key from both copies, and records any difference. If
+// optional is true, a missing object is not a finding.
+func (m *mirrorComparer) compare(ctx context.Context, key string, dataTile, optional bool) {
+	hashA, errA := m.hash(ctx, m.a+key, dataTile)
+	hashB, errB := m.hash(ctx, m.b+key, dataTile)
+	if ctx.Err() != nil {
+		return
+	}
+	f := mirrorFinding{Key: key, HashA: hashA, HashB: hashB}
+	switch {
+	case errA != nil && !errors.Is(errA, errMirrorNotFound):
+		f.Kind, f.Detail = "fetch-error", "A: "+errA.Error()
+	case errB != nil && !errors.Is(errB, errMirrorNotFound):
+		f.Kind, f.Detail = "fetch-error", "B: "+errB.Error()
+	case errA != nil && errB != nil:
+		if !optional && key != "issuers.pem" {
+			f.Kind = "missing"
+			f.Detail = "not found in either copy"
+		}
+	case errB != nil:
+		if !optional {
+			f.Kind = "missing"
+		}
+	case errA != nil:
+		if !optional {
+			f.Kind = "extra"
+		}
+	case hashA != hashB:
+		f.Kind = "differing"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.report.Objects++
+	if f.Kind != "" {
+		m.report.Findings = append(m.report.Findings, f)
+	}
+}
+
+// hash fetches url and returns the hex-encoded SHA-256 hash of its contents.
+func (m *mirrorComparer) hash(ctx context.Context, url string, dataTile bool) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "filippo.io/sunlight compare-mirrors")
+	resp, err := m.hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		// S3 returns 403 for missing objects if the bucket can't be listed.
+		return "", errMirrorNotFound
+	default:
+		return "", fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxMirrorObjectSize))
+	if err != nil {
+		return "", err
+	}
+	// Mirrors might serve compressed data tiles without a Content-Encoding,
+	// so compare their decompressed contents. See [client.Client.ReadTile].
+	if dataTile && bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return "", err
+		}
+		if b, err = io.ReadAll(io.LimitReader(r, maxMirrorObjectSize)); err != nil {
+			return "", err
+		}
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"filippo.io/sunlight/client"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// newTestMirror serves a copy of tl, passing the status and contents of each
+// object through mirror, which can modify them.
+func newTestMirror(t *testing.T, tl *testLog, mirror func(key string, status int, body []byte) (int, []byte)) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := tl.Server.Client().Get(tl.URL + r.URL.Path[1:])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		status, body := mirror(r.URL.Path[1:], resp.StatusCode, body)
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func runCompareMirrors(t *testing.T, tl *testLog, b *httptest.Server, from int64) (*mirrorReport, error) {
+	cb, err := client.New(&client.Config{
+		MonitoringPrefix: b.URL,
+		Name:             tl.Name,
+		PublicKey:        tl.Key.Public(),
+		HTTPClient:       b.Client(),
+	})
+	fatalIfErr(t, err)
+	return compareMirrorCopies(context.Background(), b.Client(), tl.URL, b.URL, tl.Client, cb, from, 2, discardLogger())
+}
+
+func checkMirrorFindings(t *testing.T, r *mirrorReport, want ...mirrorFinding) {
+	t.Helper()
+	if len(r.Findings) != len(want) {
+		t.Fatalf("got findings %+v, expected %+v", r.Findings, want)
+	}
+	for i, f := range r.Findings {
+		if f.Kind != want[i].Kind || f.Key != want[i].Key || !strings.Contains(f.Detail, want[i].Detail) {
+			t.Errorf("got finding %+v, expected %+v", f, want[i])
+		}
+	}
+}
+
+func TestCompareMirrors(t *testing.T) {
+	tl := newTestLog(t)
+	tl.add(t, false)
+	tl.add(t, true)
+	old, err := tl.Checkpoint(context.Background())
+	fatalIfErr(t, err)
+	oldSigned := fetchCheckpoint(t, tl)
+	tl.add(t, false)
+	tl.add(t, true)
+	tl.add(t, false)
+	cp, err := tl.Checkpoint(context.Background())
+	fatalIfErr(t, err)
+	tile := tlog.Tile{H: client.TileHeight, L: 0, N: 0, W: int(cp.N)}.Path()
+	dataTile := tlog.Tile{H: client.TileHeight, L: -1, N: 0, W: int(cp.N)}.Path()
+
+	t.Run("Identical", func(t *testing.T) {
+		// Data tiles served compressed, without a Content-Encoding, are
+		// compared by their contents.
+		b := newTestMirror(t, tl, func(key string, status int, body []byte) (int, []byte) {
+			if key == dataTile {
+				buf := &bytes.Buffer{}
+				w := gzip.NewWriter(buf)
+				w.Write(body)
+				w.Close()
+				return status, buf.Bytes()
+			}
+			return status, body
+		})
+		r, err := runCompareMirrors(t, tl, b, 0)
+		fatalIfErr(t, err)
+		checkMirrorFindings(t, r)
+		if r.Objects != 3 || r.SizeA != cp.N || r.SizeB != cp.N || r.Size != cp.N {
+			t.Errorf("got %d objects and sizes %d/%d/%d, expected 3 objects and %d",
+				r.Objects, r.SizeA, r.SizeB, r.Size, cp.N)
+		}
+	})
+
+	t.Run("Divergent", func(t *testing.T) {
+		b := newTestMirror(t, tl, func(key string, status int, body []byte) (int, []byte) {
+			switch key {
+			case tile:
+				body = bytes.Clone(body)
+				body[0] ^= 1
+			case dataTile:
+				return http.StatusForbidden, []byte("AccessDenied")
+			case "issuers.pem":
+				return http.StatusNotFound, nil
+			}
+			return status, body
+		})
+		r, err := runCompareMirrors(t, tl, b, 0)
+		fatalIfErr(t, err)
+		checkMirrorFindings(t, r,
+			mirrorFinding{Kind: "missing", Key: "issuers.pem"},
+			mirrorFinding{Kind: "differing", Key: tile},
+			mirrorFinding{Kind: "missing", Key: dataTile})
+		if f := r.Findings[1]; f.HashA == "" || f.HashB == "" || f.HashA == f.HashB {
+			t.Errorf("got hashes %q and %q for a differing tile", f.HashA, f.HashB)
+		}
+	})
+
+	t.Run("SplitView", func(t *testing.T) {
+		forked := tl.signCheckpoint(t, tlog.Tree{N: cp.N, Hash: tlog.Hash{1}}, cp.Timestamp)
+		b := newTestMirror(t, tl, func(key string, status int, body []byte) (int, []byte) {
+			if key == "checkpoint" {
+				return status, forked
+			}
+			return status, body
+		})
+		r, err := runCompareMirrors(t, tl, b, 0)
+		fatalIfErr(t, err)
+		checkMirrorFindings(t, r, mirrorFinding{Kind: "differing", Key: "checkpoint",
+			Detail: "different root hashes"})
+	})
+
+	t.Run("Behind", func(t *testing.T) {
+		// A mirror with an older checkpoint is compared up to its size, and
+		// its partial tiles might have been collected by the log.
+		b := newTestMirror(t, tl, func(key string, status int, body []byte) (int, []byte) {
+			if key == "checkpoint" {
+				return status, oldSigned
+			}
+			return status, body
+		})
+		r, err := runCompareMirrors(t, tl, b, 0)
+		fatalIfErr(t, err)
+		checkMirrorFindings(t, r)
+		if r.Size != old.N || r.SizeB != old.N || r.SizeA != cp.N {
+			t.Errorf("got sizes %d/%d/%d, expected %d", r.SizeA, r.SizeB, r.Size, old.N)
+		}
+
+		// Starting past the end of the smaller tree only compares issuers.
+		r, err = runCompareMirrors(t, tl, b, cp.N)
+		fatalIfErr(t, err)
+		if r.From != old.N || r.Objects != 1 {
+			t.Errorf("got from %d and %d objects, expected %d and 1", r.From, r.Objects, old.N)
+		}
+	})
+
+	t.Run("FetchError", func(t *testing.T) {
+		b := newTestMirror(t, tl, func(key string, status int, body []byte) (int, []byte) {
+			if key == dataTile {
+				return http.StatusBadGateway, nil
+			}
+			return status, body
+		})
+		r, err := runCompareMirrors(t, tl, b, 0)
+		fatalIfErr(t, err)
+		checkMirrorFindings(t, r, mirrorFinding{Kind: "fetch-error", Key: dataTile, Detail: "B: unexpected response status: 502"})
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		b := newTestMirror(t, tl, func(key string, status int, body []byte) (int, []byte) {
+			return status, body
+		})
+		b.Close()
+		_, err := runCompareMirrors(t, tl, b, 0)
+		if err == nil || !strings.Contains(err.Error(), "failed to fetch checkpoint of B") {
+			t.Errorf("got error %v, expected a checkpoint fetch failure", err)
+		}
+	})
+}
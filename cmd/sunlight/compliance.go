@@ -0,0 +1,539 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// complianceReport is the output of "sunlight compliance". It's modeled after
+// what log programs ask for during inclusion review: the availability of each
+// endpoint, the observed merge delay against the MMD, the freshness of the
+// checkpoint, and whether the temporal interval is enforced.
+type complianceReport struct {
+	Log    string    `json:"log"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Rounds int       `json:"rounds"`
+
+	// MMD and TemporalInterval are as advertised in log.v3.json.
+	MMD              int64 `json:"mmd"`
+	TemporalInterval struct {
+		StartInclusive time.Time `json:"start_inclusive"`
+		EndExclusive   time.Time `json:"end_exclusive"`
+	} `json:"temporal_interval"`
+
+	Endpoints  map[string]*complianceEndpoint `json:"endpoints"`
+	MergeDelay complianceMergeDelay           `json:"merge_delay"`
+	Freshness  complianceFreshness            `json:"checkpoint_freshness"`
+	Temporal   []*complianceBoundary          `json:"temporal_checks"`
+
+	// Violations are the human-readable failures to meet the requirements,
+	// computed again at every round. The command exits with status 1 if any.
+	Violations []string `json:"violations"`
+}
+
+type complianceEndpoint struct {
+	Probes   int `json:"probes"`
+	Failures int `json:"failures"`
+
+	// Availability is the percentage of successful probes.
+	Availability float64 `json:"availability"`
+	LatencyP50   int64   `json:"latency_p50_ms"`
+	LatencyP99   int64   `json:"latency_p99_ms"`
+	LastError    string  `json:"last_error,omitempty"`
+
+	latencies []time.Duration
+}
+
+// complianceMergeDelay measures the delay between the SCT timestamp and the
+// timestamp of the first fetched checkpoint including the entry, in
+// milliseconds. It's an upper bound, with the resolution of -interval.
+type complianceMergeDelay struct {
+	Samples int   `json:"samples"`
+	P50     int64 `json:"p50_ms"`
+	P99     int64 `json:"p99_ms"`
+	Max     int64 `json:"max_ms"`
+
+	// Exceeded counts the entries merged later than the MMD, and Pending the
+	// ones not yet merged at the end of the last round.
+	Exceeded int `json:"exceeded_mmd"`
+	Pending  int `json:"pending"`
+
+	delays []time.Duration
+}
+
+// complianceFreshness measures the age of the checkpoint when fetched, in
+// milliseconds.
+type complianceFreshness struct {
+	Samples int   `json:"samples"`
+	Max     int64 `json:"max_age_ms"`
+
+	// Stale counts the checkpoints older than -max-age.
+	Stale int `json:"stale"`
+}
+
+// complianceBoundary is a submission with a NotAfter at the edge of the
+// temporal interval, which the log is expected to accept or reject.
+type complianceBoundary struct {
+	Name       string    `json:"name"`
+	NotAfter   time.Time `json:"not_after"`
+	Accept     bool      `json:"expect_accepted"`
+	Checks     int       `json:"checks"`
+	Failures   int       `json:"failures"`
+	LastResult string    `json:"last_result,omitempty"`
+
+	// once is true for boundaries that are accepted, and so logged, which
+	// are only checked in the first round.
+	once bool
+}
+
+// compliance implements the "sunlight compliance" command, which probes a log
+// at every -interval for -duration, and writes a report of the properties that
+// CT log programs such as Chrome's and Apple's require.
+//
+// Each round fetches log.v3.json, get-roots, and the checkpoint, and submits a
+// certificate issued by the test root (see "sunlight flood -gen-root"), which
+// must be accepted by the log, to measure the merge delay. Certificates with
+// a NotAfter just outside the temporal interval are submitted every round and
+// must be rejected, while those at its edges are submitted in the first round
+// only, since they get logged.
+//
+// The report is rewritten to -o after every round, so that it can be inspected
+// while the command keeps running.
+func compliance(args []string) {
+	fs := flag.NewFlagSet("sunlight compliance", flag.ExitOnError)
+	urlFlag := fs.String("url", "", "submission URL prefix of the log, without ct/v1/ (required)")
+	monitoringFlag := fs.String("monitoring", "", "monitoring URL prefix of the log (required)")
+	nameFlag := fs.String("name", "", "name of the log (required)")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the log (required)")
+	rootFlag := fs.String("root", "flood-root.pem", "path to the PEM test root certificate")
+	rootKeyFlag := fs.String("root-key", "flood-root-key.pem", "path to the PEM PKCS#8 test root key")
+	tokenFlag := fs.String("token", "", "value of the Sunlight-Test-Submission header, for TestRoots")
+	intervalFlag := fs.Duration("interval", 1*time.Minute, "how often to probe the log")
+	durationFlag := fs.Duration("duration", 24*time.Hour, "how long to probe the log for, or 0 until interrupted")
+	maxAgeFlag := fs.Duration("max-age", 1*time.Minute, "maximum acceptable age of the checkpoint")
+	minUptimeFlag := fs.Float64("min-uptime", 99, "minimum acceptable availability of each endpoint, in percent")
+	outFlag := fs.String("o", "-", "path of the JSON report, or - for stdout at the end")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *urlFlag == "" || *monitoringFlag == "" || *nameFlag == "" || *keyFlag == "" {
+		logger.Error("-url, -monitoring, -name, and -key are required")
+		os.Exit(1)
+	}
+	key, err := parsePublicKey(*keyFlag)
+	if err != nil {
+		logger.Error("invalid -key", "err", err)
+		os.Exit(1)
+	}
+	root, rootKey, err := loadFloodRoot(*rootFlag, *rootKeyFlag)
+	if err != nil {
+		logger.Error("failed to load test root", "err", err)
+		os.Exit(1)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		logger.Error("failed to generate leaf key", "err", err)
+		os.Exit(1)
+	}
+	hc := &http.Client{Timeout: 30 * time.Second}
+	c, err := client.New(&client.Config{
+		MonitoringPrefix: *monitoringFlag,
+		Name:             *nameFlag,
+		PublicKey:        key,
+		HTTPClient:       hc,
+		UserAgent:        "filippo.io/sunlight compliance",
+	})
+	if err != nil {
+		logger.Error("failed to create client", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *durationFlag > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *durationFlag)
+		defer cancel()
+	}
+
+	p := &complianceProber{
+		url: strings.TrimSuffix(*urlFlag, "/") + "/",
+		s: &submitter{
+			url:       strings.TrimSuffix(*urlFlag, "/") + "/ct/v1/",
+			token:     *tokenFlag,
+			userAgent: "filippo.io/sunlight compliance",
+			hc:        hc,
+		},
+		c:         c,
+		hc:        hc,
+		root:      root,
+		rootKey:   rootKey,
+		leafKey:   leafKey,
+		maxAge:    *maxAgeFlag,
+		minUptime: *minUptimeFlag,
+		report: &complianceReport{
+			Log:       *nameFlag,
+			Start:     time.Now().UTC(),
+			Endpoints: make(map[string]*complianceEndpoint),
+		},
+		logger: logger,
+	}
+	for {
+		p.round(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		p.finish()
+		if *outFlag != "-" {
+			if err := p.write(*outFlag); err != nil {
+				logger.Error("failed to write report", "err", err)
+				os.Exit(1)
+			}
+		}
+		logger.Info("compliance round", "round", p.report.Rounds, "violations", len(p.report.Violations))
+		select {
+		case <-ctx.Done():
+		case <-time.After(*intervalFlag):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	p.finish()
+	if *outFlag == "-" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(p.report); err != nil {
+			logger.Error("failed to write report", "err", err)
+			os.Exit(1)
+		}
+	} else if err := p.write(*outFlag); err != nil {
+		logger.Error("failed to write report", "err", err)
+		os.Exit(1)
+	}
+	for _, v := range p.report.Violations {
+		logger.Warn("compliance violation", "violation", v)
+	}
+	if len(p.report.Violations) > 0 {
+		os.Exit(1)
+	}
+}
+
+// complianceProber holds the state of a "sunlight compliance" run.
+type complianceProber struct {
+	url       string
+	s         *submitter
+	c         *client.Client
+	hc        *http.Client
+	root      *x509.Certificate
+	rootKey   *ecdsa.PrivateKey
+	leafKey   *ecdsa.PrivateKey
+	maxAge    time.Duration
+	minUptime float64
+
+	report *complianceReport
+	// pending are the submitted entries not yet in a checkpoint.
+	pending []pendingSCT
+	// lastSize is the size of the last fetched checkpoint.
+	lastSize int64
+	logger   *slog.Logger
+}
+
+// round runs one set of probes. It returns early only if ctx is canceled.
+func (p *complianceProber) round(ctx context.Context) {
+	if err := p.metadata(ctx); err != nil {
+		p.logger.Warn("failed to fetch log.v3.json", "err", err)
+	}
+	if _, err := p.get(ctx, "get-roots", p.url+"ct/v1/get-roots"); err != nil {
+		p.logger.Warn("failed to fetch get-roots", "err", err)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Submit before fetching the checkpoint, so that a round's entry can be
+	// merged by the next round's checkpoint at the latest.
+	interval := p.report.TemporalInterval
+	if !interval.StartInclusive.IsZero() {
+		notAfter := time.Now().Add(90 * 24 * time.Hour)
+		if notAfter.Before(interval.StartInclusive) || !notAfter.Before(interval.EndExclusive) {
+			notAfter = interval.StartInclusive.Add(interval.EndExclusive.Sub(interval.StartInclusive) / 2)
+		}
+		start := time.Now()
+		index, timestamp, err := p.submit(ctx, notAfter)
+		p.record("add-chain", time.Since(start), err)
+		if err != nil {
+			p.logger.Warn("failed to submit certificate", "err", err)
+		} else {
+			p.pending = append(p.pending, pendingSCT{index: index, t: time.UnixMilli(timestamp)})
+		}
+		p.checkBoundaries(ctx)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	start := time.Now()
+	cp, err := p.c.Checkpoint(ctx)
+	p.record("checkpoint", time.Since(start), err)
+	if err != nil {
+		p.logger.Warn("failed to fetch checkpoint", "err", err)
+	} else {
+		p.checkpoint(cp)
+	}
+	if ctx.Err() == nil {
+		p.report.Rounds++
+	}
+}
+
+func (p *complianceProber) metadata(ctx context.Context) error {
+	body, err := p.get(ctx, "log.v3.json", p.url+"log.v3.json")
+	if err != nil {
+		return err
+	}
+	var m struct {
+		MMD              int64 `json:"mmd"`
+		TemporalInterval struct {
+			StartInclusive time.Time `json:"start_inclusive"`
+			EndExclusive   time.Time `json:"end_exclusive"`
+		} `json:"temporal_interval"`
+	}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return fmt.Errorf("invalid log.v3.json: %w", err)
+	}
+	p.report.MMD = m.MMD
+	if m.TemporalInterval != p.report.TemporalInterval {
+		p.report.TemporalInterval = m.TemporalInterval
+		p.report.Temporal = nil
+		start, end := m.TemporalInterval.StartInclusive, m.TemporalInterval.EndExclusive
+		if !start.IsZero() {
+			p.report.Temporal = []*complianceBoundary{
+				{Name: "before start", NotAfter: start.Add(-1 * time.Second)},
+				{Name: "at start", NotAfter: start, Accept: true, once: true},
+				{Name: "before end", NotAfter: end.Add(-1 * time.Second), Accept: true, once: true},
+				{Name: "at end", NotAfter: end},
+			}
+		}
+	}
+	return nil
+}
+
+// checkBoundaries submits the certificates at the edges of the temporal
+// interval, and checks they are accepted or rejected as expected.
+func (p *complianceProber) checkBoundaries(ctx context.Context) {
+	for _, b := range p.report.Temporal {
+		if b.once && b.Checks > 0 {
+			continue
+		}
+		index, timestamp, err := p.submit(ctx, b.NotAfter)
+		var serr *submitError
+		switch {
+		case err == nil:
+			b.LastResult = "accepted"
+			p.pending = append(p.pending, pendingSCT{index: index, t: time.UnixMilli(timestamp)})
+		case errors.As(err, &serr) && serr.status == http.StatusBadRequest:
+			b.LastResult = "rejected: " + serr.body
+		default:
+			// Not a definitive answer, try again next round.
+			p.logger.Warn("failed to check temporal interval", "check", b.Name, "err", err)
+			continue
+		}
+		b.Checks++
+		if (err == nil) != b.Accept {
+			b.Failures++
+			p.logger.Warn("temporal interval not enforced", "check", b.Name, "result", b.LastResult)
+		}
+	}
+}
+
+// submit submits a new certificate with the given NotAfter, and returns the
+// leaf index and timestamp of the SCT.
+func (p *complianceProber) submit(ctx context.Context, notAfter time.Time) (int64, int64, error) {
+	leaf, err := issueTestCertificate(p.root, p.rootKey, &p.leafKey.PublicKey,
+		notAfter.Add(-90*24*time.Hour), notAfter, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	sct, err := p.s.submit(ctx, [][]byte{leaf, p.root.Raw}, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	index, err := ctlog.ParseExtensions(sct.Extensions)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid SCT extensions: %w", err)
+	}
+	return index, int64(sct.Timestamp), nil
+}
+
+// checkpoint records the freshness of cp, and the merge delay of the pending
+// entries it includes, measured with the timestamps of the log.
+func (p *complianceProber) checkpoint(cp *client.Checkpoint) {
+	age := time.Since(time.UnixMilli(cp.Timestamp))
+	f := &p.report.Freshness
+	f.Samples++
+	f.Max = max(f.Max, age.Milliseconds())
+	if age > p.maxAge {
+		f.Stale++
+		p.logger.Warn("stale checkpoint", "age", age)
+	}
+	if cp.N < p.lastSize {
+		p.logger.Warn("checkpoint rolled back", "size", cp.N, "previous", p.lastSize)
+		return
+	}
+	p.lastSize = cp.N
+	m := &p.report.MergeDelay
+	p.pending = slices.DeleteFunc(p.pending, func(s pendingSCT) bool {
+		if s.index >= cp.N {
+			return false
+		}
+		m.delays = append(m.delays, time.UnixMilli(cp.Timestamp).Sub(s.t))
+		return true
+	})
+}
+
+// get fetches url, recording the result as a probe of the endpoint.
+func (p *complianceProber) get(ctx context.Context, endpoint, url string) ([]byte, error) {
+	start := time.Now()
+	body, err := func() ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", "filippo.io/sunlight compliance")
+		resp, err := p.hc.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	}()
+	p.record(endpoint, time.Since(start), err)
+	return body, err
+}
+
+// record records a probe of endpoint, unless it failed because the run is
+// ending, which is not the log's fault.
+func (p *complianceProber) record(endpoint string, latency time.Duration, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	e, ok := p.report.Endpoints[endpoint]
+	if !ok {
+		e = &complianceEndpoint{}
+		p.report.Endpoints[endpoint] = e
+	}
+	e.Probes++
+	if err != nil {
+		e.Failures++
+		e.LastError = err.Error()
+		return
+	}
+	e.latencies = append(e.latencies, latency)
+}
+
+// finish computes the aggregate statistics and the violations.
+func (p *complianceProber) finish() {
+	r := p.report
+	r.End = time.Now().UTC()
+	r.Violations = nil
+	mmd := time.Duration(r.MMD) * time.Second
+
+	endpoints := make([]string, 0, len(r.Endpoints))
+	for name := range r.Endpoints {
+		endpoints = append(endpoints, name)
+	}
+	slices.Sort(endpoints)
+	for _, name := range endpoints {
+		e := r.Endpoints[name]
+		e.Availability = 100 * float64(e.Probes-e.Failures) / float64(e.Probes)
+		e.LatencyP50, e.LatencyP99 = percentileMillis(e.latencies, 0.5), percentileMillis(e.latencies, 0.99)
+		if e.Availability < p.minUptime {
+			r.Violations = append(r.Violations, fmt.Sprintf(
+				"%s availability is %.2f%%, below %.2f%%", name, e.Availability, p.minUptime))
+		}
+	}
+
+	m := &r.MergeDelay
+	m.Samples = len(m.delays)
+	m.P50, m.P99 = percentileMillis(m.delays, 0.5), percentileMillis(m.delays, 0.99)
+	m.Max, m.Exceeded = 0, 0
+	for _, d := range m.delays {
+		m.Max = max(m.Max, d.Milliseconds())
+		if mmd > 0 && d > mmd {
+			m.Exceeded++
+		}
+	}
+	m.Pending = len(p.pending)
+	if m.Exceeded > 0 {
+		r.Violations = append(r.Violations, fmt.Sprintf(
+			"%d entries were merged after more than the MMD of %v", m.Exceeded, mmd))
+	}
+	var overdue int
+	for _, s := range p.pending {
+		if mmd > 0 && time.Since(s.t) > mmd {
+			overdue++
+		}
+	}
+	if overdue > 0 {
+		r.Violations = append(r.Violations, fmt.Sprintf(
+			"%d entries are not merged after more than the MMD of %v", overdue, mmd))
+	}
+
+	if r.Freshness.Stale > 0 {
+		r.Violations = append(r.Violations, fmt.Sprintf(
+			"%d checkpoints were older than %v, up to %v", r.Freshness.Stale, p.maxAge,
+			time.Duration(r.Freshness.Max)*time.Millisecond))
+	}
+
+	for _, b := range r.Temporal {
+		if b.Failures > 0 {
+			expected := "rejected"
+			if b.Accept {
+				expected = "accepted"
+			}
+			r.Violations = append(r.Violations, fmt.Sprintf(
+				"certificate with NotAfter %s (%s) was not %s: %s", b.NotAfter.Format(time.RFC3339),
+				b.Name, expected, b.LastResult))
+		}
+	}
+}
+
+func (p *complianceProber) write(path string) error {
+	b, err := json.MarshalIndent(p.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(b, '\n'))
+}
+
+// percentileMillis returns the q-th percentile of d in milliseconds, sorting d.
+func percentileMillis(d []time.Duration, q float64) int64 {
+	if len(d) == 0 {
+		return 0
+	}
+	slices.Sort(d)
+	return d[min(int(q*float64(len(d))), len(d)-1)].Milliseconds()
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"filippo.io/sunlight/sunlighttest"
+)
+
+// complianceProxy serves a sunlighttest log, optionally misbehaving.
+type complianceProxy struct {
+	*httptest.Server
+	tl *sunlighttest.Log
+
+	// failRoots makes get-roots fail.
+	failRoots atomic.Bool
+	// mmd, if not zero, replaces the MMD in log.v3.json.
+	mmd atomic.Int64
+	// startShift is added to the start of the advertised temporal interval.
+	startShift atomic.Int64
+	// checkpoint, if set, is served instead of the latest checkpoint.
+	checkpoint atomic.Pointer[[]byte]
+}
+
+func newComplianceProxy(t *testing.T, root *x509.Certificate, start, end time.Time) *complianceProxy {
+	p := &complianceProxy{tl: sunlighttest.NewLog(t, &sunlighttest.Config{
+		Roots:            []*x509.Certificate{root},
+		NotAfterStart:    start,
+		NotAfterLimit:    end,
+		SequencingPeriod: 5 * time.Millisecond,
+	})}
+	u, err := url.Parse(p.tl.URL)
+	fatalIfErr(t, err)
+	rp := httputil.NewSingleHostReverseProxy(u)
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/ct/v1/get-roots" && p.failRoots.Load():
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case r.URL.Path == "/checkpoint" && p.checkpoint.Load() != nil:
+			w.Write(*p.checkpoint.Load())
+		case r.URL.Path == "/log.v3.json":
+			resp, err := p.tl.Server.Client().Get(p.tl.URL + "log.v3.json")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			var m struct {
+				MMD              int64 `json:"mmd"`
+				TemporalInterval struct {
+					StartInclusive time.Time `json:"start_inclusive"`
+					EndExclusive   time.Time `json:"end_exclusive"`
+				} `json:"temporal_interval"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			if mmd := p.mmd.Load(); mmd != 0 {
+				m.MMD = mmd
+			}
+			m.TemporalInterval.StartInclusive = m.TemporalInterval.StartInclusive.Add(
+				time.Duration(p.startShift.Load()))
+			json.NewEncoder(w).Encode(m)
+		default:
+			rp.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+// freezeCheckpoint makes the proxy serve the current checkpoint from now on.
+func (p *complianceProxy) freezeCheckpoint(t *testing.T) {
+	resp, err := p.Client().Get(p.URL + "/checkpoint")
+	fatalIfErr(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	fatalIfErr(t, err)
+	p.checkpoint.Store(&b)
+}
+
+func (p *complianceProxy) newProber(t *testing.T, f *flooder, maxAge time.Duration) *complianceProber {
+	c, err := client.New(&client.Config{
+		MonitoringPrefix: p.URL,
+		Name:             p.tl.Name,
+		PublicKey:        p.tl.Key.Public(),
+		HTTPClient:       p.Client(),
+	})
+	fatalIfErr(t, err)
+	return &complianceProber{
+		url:       p.URL + "/",
+		s:         &submitter{url: p.URL + "/ct/v1/", userAgent: "test", hc: p.Client()},
+		c:         c,
+		hc:        p.Client(),
+		root:      f.root,
+		rootKey:   f.rootKey,
+		leafKey:   f.leafKey,
+		maxAge:    maxAge,
+		minUptime: 99,
+		report:    &complianceReport{Log: p.tl.Name, Endpoints: make(map[string]*complianceEndpoint)},
+		logger:    discardLogger(),
+	}
+}
+
+func checkViolations(t *testing.T, p *complianceProber, want ...string) {
+	t.Helper()
+	got := p.report.Violations
+	if len(got) != len(want) {
+		t.Fatalf("got violations %q, expected %q", got, want)
+	}
+	for i := range want {
+		if !strings.Contains(got[i], want[i]) {
+			t.Errorf("got violation %q, expected %q", got[i], want[i])
+		}
+	}
+}
+
+func TestCompliance(t *testing.T) {
+	dir := t.TempDir()
+	rootPath, keyPath := filepath.Join(dir, "root.pem"), filepath.Join(dir, "root-key.pem")
+	fatalIfErr(t, generateFloodRoot(rootPath, keyPath))
+	root, rootKey, err := loadFloodRoot(rootPath, keyPath)
+	fatalIfErr(t, err)
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	f := &flooder{root: root, rootKey: rootKey, leafKey: leafKey}
+	start := time.Now().Truncate(time.Hour).Add(24 * time.Hour).UTC()
+	end := start.Add(180 * 24 * time.Hour)
+	ctx := context.Background()
+
+	t.Run("Pass", func(t *testing.T) {
+		cp := newComplianceProxy(t, root, start, end)
+		p := cp.newProber(t, f, 1*time.Minute)
+		p.round(ctx)
+		p.round(ctx)
+		p.finish()
+		checkViolations(t, p)
+
+		r := p.report
+		if r.Rounds != 2 || r.MMD != 86400 || !r.TemporalInterval.StartInclusive.Equal(start) {
+			t.Errorf("got %d rounds, MMD %d, and interval start %v", r.Rounds, r.MMD, r.TemporalInterval.StartInclusive)
+		}
+		for _, name := range []string{"log.v3.json", "get-roots", "add-chain", "checkpoint"} {
+			e := r.Endpoints[name]
+			if e == nil || e.Probes != 2 || e.Availability != 100 {
+				t.Errorf("endpoint %s: got %+v, expected 2 successful probes", name, e)
+			}
+		}
+		// One entry per round, and the two at the edges of the interval.
+		if m := r.MergeDelay; m.Samples != 4 || m.Pending != 0 || m.Exceeded != 0 {
+			t.Errorf("got merge delay %+v, expected 4 merged entries", m)
+		}
+		if r.Freshness.Samples != 2 || r.Freshness.Stale != 0 {
+			t.Errorf("got freshness %+v, expected 2 fresh checkpoints", r.Freshness)
+		}
+		if len(r.Temporal) != 4 {
+			t.Fatalf("got %d temporal checks, expected 4", len(r.Temporal))
+		}
+		for _, b := range r.Temporal {
+			checks := 2
+			if b.Accept {
+				checks = 1
+			}
+			if b.Checks != checks || b.Failures != 0 {
+				t.Errorf("temporal check %q: got %d checks and %d failures, expected %d checks",
+					b.Name, b.Checks, b.Failures, checks)
+			}
+			if b.Accept != (b.LastResult == "accepted") {
+				t.Errorf("temporal check %q: got result %q", b.Name, b.LastResult)
+			}
+		}
+	})
+
+	t.Run("Availability", func(t *testing.T) {
+		cp := newComplianceProxy(t, root, start, end)
+		p := cp.newProber(t, f, 1*time.Minute)
+		p.round(ctx)
+		cp.failRoots.Store(true)
+		p.round(ctx)
+		p.finish()
+		checkViolations(t, p, "get-roots availability is 50.00%, below 99.00%")
+		if e := p.report.Endpoints["get-roots"]; e.Failures != 1 || !strings.Contains(e.LastError, "503") {
+			t.Errorf("got get-roots endpoint %+v, expected a 503 failure", e)
+		}
+	})
+
+	t.Run("TemporalInterval", func(t *testing.T) {
+		for _, tc := range []struct {
+			shift     time.Duration
+			violation string
+		}{
+			// The log accepts a certificate that expires before the
+			// advertised start of the interval.
+			{24 * time.Hour, "(before start) was not rejected: accepted"},
+			// The log rejects a certificate that expires at the advertised
+			// start of the interval.
+			{-24 * time.Hour, "(at start) was not accepted: rejected"},
+		} {
+			cp := newComplianceProxy(t, root, start, end)
+			cp.startShift.Store(int64(tc.shift))
+			p := cp.newProber(t, f, 1*time.Minute)
+			p.round(ctx)
+			p.finish()
+			checkViolations(t, p, tc.violation)
+		}
+	})
+
+	t.Run("MergeDelay", func(t *testing.T) {
+		// The checkpoint stops advancing for longer than the MMD.
+		cp := newComplianceProxy(t, root, start, end)
+		cp.mmd.Store(1)
+		p := cp.newProber(t, f, 1*time.Minute)
+		cp.freezeCheckpoint(t)
+		p.round(ctx)
+		time.Sleep(1100 * time.Millisecond)
+		p.finish()
+		checkViolations(t, p, "3 entries are not merged after more than the MMD of 1s")
+
+		cp.checkpoint.Store(nil)
+		p.round(ctx)
+		p.finish()
+		checkViolations(t, p, "3 entries were merged after more than the MMD of 1s")
+		if m := p.report.MergeDelay; m.Samples != 4 || m.Pending != 0 || m.Max < 1000 {
+			t.Errorf("got merge delay %+v", m)
+		}
+	})
+
+	t.Run("Freshness", func(t *testing.T) {
+		cp := newComplianceProxy(t, root, start, end)
+		p := cp.newProber(t, f, 100*time.Millisecond)
+		p.round(ctx)
+		cp.freezeCheckpoint(t)
+		time.Sleep(200 * time.Millisecond)
+		p.round(ctx)
+		p.finish()
+		checkViolations(t, p, "1 checkpoints were older than 100ms")
+		if p.report.Freshness.Samples != 2 || p.report.Freshness.Max < 200 {
+			t.Errorf("got freshness %+v", p.report.Freshness)
+		}
+	})
+}
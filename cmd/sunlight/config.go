@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"gopkg.in/yaml.v3"
+)
+
+// secretTimeout is the timeout of fetching each secret reference.
+const secretTimeout = 30 * time.Second
+
+// readConfig reads and parses the config file at path, with unmarshalConfig.
+func readConfig(path string) (*Config, error) {
+	yml, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	c := &Config{}
+	if err := unmarshalConfig(yml, c); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return c, nil
+}
+
+// unmarshalConfig decodes a YAML config file into v, after replacing ${VAR} in
+// its values with the value of the environment variable VAR. An unset variable
+// is an error, and $${ is replaced by a literal ${.
+func unmarshalConfig(yml []byte, v any) error {
+	root, err := parseConfigNode(yml)
+	if err != nil {
+		return err
+	}
+	if root.Kind == 0 {
+		return nil // empty file
+	}
+	return root.Decode(v)
+}
+
+// parseConfigNode parses a YAML config file and expands the environment
+// variables in its values, like unmarshalConfig.
+func parseConfigNode(yml []byte) (*yaml.Node, error) {
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(yml, root); err != nil {
+		return nil, err
+	}
+	if err := expandNode(root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func expandNode(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "${") {
+		v, err := expandEnv(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		n.Value = v
+		if n.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			// Resolve the tag again, so that "PoolSize: ${POOL_SIZE}" is
+			// decoded as an integer.
+			n.Tag = ""
+		}
+	}
+	for _, c := range n.Content {
+		if err := expandNode(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandEnv replaces ${VAR} in s with the value of the environment variable
+// VAR, and $${ with ${.
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		name, rest, ok := strings.Cut(s[i+2:], "}")
+		if !ok || name == "" {
+			return "", fmt.Errorf("malformed variable reference in %q", s)
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		b.WriteString(v)
+		s = rest
+	}
+}
+
+// readSecretFile reads the file at path, or fetches the secret if path is a
+// secretref:// URI (see [ctlog.FetchSecret]), so that key material and
+// credentials don't need to be written to disk.
+func readSecretFile(path string) ([]byte, error) {
+	if !ctlog.IsSecretRef(path) {
+		return os.ReadFile(path)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	return ctlog.FetchSecret(ctx, path)
+}
+
+// resolveSecret returns s, or the secret it references if it's a
+// secretref:// URI, for config values that are secrets themselves, like API
+// tokens, rather than paths to files holding them.
+func resolveSecret(s string) (string, error) {
+	if !ctlog.IsSecretRef(s) {
+		return s, nil
+	}
+	b, err := readSecretFile(s)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// configFields has the fields of Config, without its UnmarshalYAML method.
+type configFields Config
+
+// UnmarshalYAML decodes the config file, decoding each of Logs on top of
+// LogDefaults, so that the fields set in both are taken from the log.
+func (c *Config) UnmarshalYAML(value *yaml.Node) error {
+	if err := value.Decode((*configFields)(c)); err != nil {
+		return err
+	}
+	defaults, logs := mappingValue(value, "logdefaults"), mappingValue(value, "logs")
+	if defaults == nil || logs == nil {
+		return nil
+	}
+	if c.LogDefaults.Name != "" || c.LogDefaults.ShortName != "" {
+		return errors.New("LogDefaults can't set Name or ShortName")
+	}
+	if logs.Kind == yaml.AliasNode {
+		logs = logs.Alias
+	}
+	for i, n := range logs.Content {
+		lc := LogConfig{}
+		if err := defaults.Decode(&lc); err != nil {
+			return err
+		}
+		if err := n.Decode(&lc); err != nil {
+			return err
+		}
+		c.Logs[i] = lc
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in the mapping node n, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind == yaml.DocumentNode && len(n.Content) == 1 {
+		n = n.Content[0]
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
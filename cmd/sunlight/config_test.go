@@ -0,0 +1,157 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLogDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		yml   string
+		check func(t *testing.T, lc LogConfig)
+		err   bool
+	}{
+		{
+			name: "Inherited",
+			yml: `
+logdefaults:
+  roots: /etc/sunlight/roots.pem
+  poolsize: 1000
+logs:
+  - shortname: example2025h1
+`,
+			check: func(t *testing.T, lc LogConfig) {
+				if lc.ShortName != "example2025h1" || lc.Roots != "/etc/sunlight/roots.pem" || lc.PoolSize != 1000 {
+					t.Errorf("got %q, %q, %d", lc.ShortName, lc.Roots, lc.PoolSize)
+				}
+			},
+		},
+		{
+			name: "Overridden",
+			yml: `
+logdefaults:
+  roots: /etc/sunlight/roots.pem
+  poolsize: 1000
+logs:
+  - shortname: example2025h1
+    poolsize: 10
+`,
+			check: func(t *testing.T, lc LogConfig) {
+				if lc.Roots != "/etc/sunlight/roots.pem" || lc.PoolSize != 10 {
+					t.Errorf("got %q, %d", lc.Roots, lc.PoolSize)
+				}
+			},
+		},
+		{
+			name: "Nested",
+			yml: `
+logdefaults:
+  hedging:
+    quantile: 0.99
+    maxrate: 0.2
+logs:
+  - shortname: example2025h1
+    hedging:
+      maxrate: 0.5
+`,
+			check: func(t *testing.T, lc LogConfig) {
+				if lc.Hedging.Quantile != 0.99 || lc.Hedging.MaxRate != 0.5 {
+					t.Errorf("got Hedging %+v", lc.Hedging)
+				}
+			},
+		},
+		{
+			name: "List",
+			yml: `
+logdefaults:
+  corsorigins: [https://a.example, https://b.example]
+logs:
+  - shortname: example2025h1
+    corsorigins: [https://c.example]
+`,
+			check: func(t *testing.T, lc LogConfig) {
+				if !slices.Equal(lc.CORSOrigins, []string{"https://c.example"}) {
+					t.Errorf("got CORSOrigins %q", lc.CORSOrigins)
+				}
+			},
+		},
+		{
+			name: "ListInherited",
+			yml: `
+logdefaults:
+  corsorigins: [https://a.example, https://b.example]
+logs:
+  - shortname: example2025h1
+`,
+			check: func(t *testing.T, lc LogConfig) {
+				if !slices.Equal(lc.CORSOrigins, []string{"https://a.example", "https://b.example"}) {
+					t.Errorf("got CORSOrigins %q", lc.CORSOrigins)
+				}
+			},
+		},
+		{
+			name: "NoDefaults",
+			yml: `
+logs:
+  - shortname: example2025h1
+    poolsize: 10
+`,
+			check: func(t *testing.T, lc LogConfig) {
+				if lc.ShortName != "example2025h1" || lc.PoolSize != 10 {
+					t.Errorf("got %q, %d", lc.ShortName, lc.PoolSize)
+				}
+			},
+		},
+		{
+			name: "ShortName",
+			yml: `
+logdefaults:
+  shortname: example2025h1
+logs:
+  - poolsize: 10
+`,
+			err: true,
+		},
+		{
+			name: "Name",
+			yml: `
+logdefaults:
+  name: example.com/2025h1
+logs:
+  - poolsize: 10
+`,
+			err: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{}
+			err := unmarshalConfig([]byte(tc.yml), c)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			fatalIfErr(t, err)
+			if len(c.Logs) != 1 {
+				t.Fatalf("got %d logs, expected 1", len(c.Logs))
+			}
+			tc.check(t, c.Logs[0])
+		})
+	}
+
+	// Each log is decoded on a fresh copy of the defaults.
+	c := &Config{}
+	fatalIfErr(t, unmarshalConfig([]byte(`
+logdefaults:
+  poolsize: 1000
+logs:
+  - shortname: a
+    poolsize: 10
+  - shortname: b
+`), c))
+	if c.Logs[0].PoolSize != 10 || c.Logs[1].PoolSize != 1000 {
+		t.Errorf("got PoolSize %d and %d, expected 10 and 1000", c.Logs[0].PoolSize, c.Logs[1].PoolSize)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// estimateMonth is the length of a billing month.
+const estimateMonth = 730 * time.Hour
+
+// storagePrice is the list price of a storage class, in USD.
+type storagePrice struct {
+	StorageGBMonth float64 `json:"storage_gb_month"`
+	PutPerMillion  float64 `json:"put_per_million"`
+	GetPerMillion  float64 `json:"get_per_million"`
+	EgressGB       float64 `json:"egress_gb"`
+
+	// MinObjectSize is the minimum billed size of an object, in bytes, as
+	// charged by infrequent access storage classes.
+	MinObjectSize int64 `json:"min_object_size,omitempty"`
+}
+
+// defaultStoragePrices are approximate list prices in the cheapest US regions,
+// without free tiers or volume discounts. Use -prices for accurate figures.
+var defaultStoragePrices = map[string]storagePrice{
+	"aws-s3-standard":    {StorageGBMonth: 0.023, PutPerMillion: 5, GetPerMillion: 0.4, EgressGB: 0.09},
+	"aws-s3-standard-ia": {StorageGBMonth: 0.0125, PutPerMillion: 10, GetPerMillion: 1, EgressGB: 0.09 + 0.01, MinObjectSize: 128 << 10},
+	"gcs-standard":       {StorageGBMonth: 0.020, PutPerMillion: 5, GetPerMillion: 0.4, EgressGB: 0.12},
+	"cloudflare-r2":      {StorageGBMonth: 0.015, PutPerMillion: 4.5, GetPerMillion: 0.36},
+	"backblaze-b2":       {StorageGBMonth: 0.006, GetPerMillion: 0.4, EgressGB: 0.01},
+}
+
+// estimate implements the "sunlight estimate" command, which projects the
+// storage volume, request counts, and monthly cost of a log over -months.
+//
+// The submission rate and the stored size of each entry are either passed with
+// -rate and -entry-size, or sampled from the latest full data tile of a running
+// log with -monitoring, -name, and -key.
+//
+// The model follows the sequencer: every second it uploads a checkpoint and,
+// if there were new entries, a partial data tile and a partial hash tile for
+// each tree level, plus every tile that got completed. Partial tiles are
+// reported separately, since they can be deleted with "sunlight gc". Reads are
+// modeled as -monitors clients downloading every full tile once and polling the
+// checkpoint every -monitor-poll.
+func estimate(args []string) {
+	fs := flag.NewFlagSet("sunlight estimate", flag.ExitOnError)
+	rateFlag := fs.Float64("rate", 0, "submissions per second")
+	entrySizeFlag := fs.Int("entry-size", 1500, "stored size of an entry in a compressed data tile, in bytes")
+	sizeFlag := fs.Int64("size", 0, "current size of the log")
+	monitoringFlag := fs.String("monitoring", "", "monitoring URL prefix of a log to sample -rate, -entry-size, and -size from")
+	nameFlag := fs.String("name", "", "name of the log, required with -monitoring")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the log, required with -monitoring")
+	monthsFlag := fs.Int("months", 6, "length of the projection, in months")
+	monitorsFlag := fs.Int("monitors", 20, "number of monitors reading the whole log")
+	monitorPollFlag := fs.Duration("monitor-poll", 1*time.Minute, "how often each monitor fetches the checkpoint")
+	pricesFlag := fs.String("prices", "", "JSON file of storage prices by provider, replacing the built-in ones")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	m := &capacityModel{rate: *rateFlag, entrySize: float64(*entrySizeFlag), size: *sizeFlag,
+		months: *monthsFlag, monitors: *monitorsFlag, monitorPoll: *monitorPollFlag}
+	if *monitoringFlag != "" {
+		key, err := parsePublicKey(*keyFlag)
+		if err != nil || *nameFlag == "" {
+			logger.Error("-monitoring requires -name and a valid -key", "err", err)
+			os.Exit(1)
+		}
+		c, err := client.New(&client.Config{
+			MonitoringPrefix: *monitoringFlag,
+			Name:             *nameFlag,
+			PublicKey:        key,
+			UserAgent:        "filippo.io/sunlight estimate",
+		})
+		if err != nil {
+			logger.Error("failed to create client", "err", err)
+			os.Exit(1)
+		}
+		if err := m.sample(ctx, c); err != nil {
+			logger.Error("failed to sample log", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("sampled log", "size", m.size, "rate", m.rate, "entry_size", m.entrySize)
+	}
+	if m.rate <= 0 || m.entrySize <= 0 || m.months <= 0 || m.monitorPoll <= 0 {
+		logger.Error("-rate, -entry-size, -months, and -monitor-poll must be positive")
+		os.Exit(1)
+	}
+
+	prices := defaultStoragePrices
+	if *pricesFlag != "" {
+		b, err := os.ReadFile(*pricesFlag)
+		if err != nil {
+			logger.Error("failed to read prices", "err", err)
+			os.Exit(1)
+		}
+		prices = nil
+		if err := json.Unmarshal(b, &prices); err != nil {
+			logger.Error("failed to parse prices", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	m.report(os.Stdout, prices)
+}
+
+// capacityModel projects the resource usage of a log.
+type capacityModel struct {
+	rate        float64 // entries per second
+	entrySize   float64 // bytes per entry in a compressed data tile
+	size        int64
+	months      int
+	monitors    int
+	monitorPoll time.Duration
+}
+
+// sample sets rate, entrySize, and size from the latest full data tile.
+func (m *capacityModel) sample(ctx context.Context, c *client.Client) error {
+	cp, err := c.Checkpoint(ctx)
+	if err != nil {
+		return err
+	}
+	if cp.N < 2<<client.TileHeight {
+		return fmt.Errorf("log is too small to sample, with %d entries", cp.N)
+	}
+	// Use the second to last full tile, as the last might be mostly made of
+	// the entries of one large pool.
+	n := cp.N>>client.TileHeight - 2
+	entries, err := c.DataTile(ctx, cp.Tree, n)
+	if err != nil {
+		return err
+	}
+	data, err := c.ReadTile(ctx, tlog.Tile{H: client.TileHeight, L: -1, N: n, W: 1 << client.TileHeight})
+	if err != nil {
+		return err
+	}
+	compressed := &bytes.Buffer{}
+	w := gzip.NewWriter(compressed)
+	w.Write(data)
+	w.Close()
+
+	first, last := entries[0].Timestamp, entries[len(entries)-1].Timestamp
+	if last <= first {
+		return fmt.Errorf("entries of data tile %d have no timestamp spread", n)
+	}
+	m.rate = float64(len(entries)-1) / (float64(last-first) / 1000)
+	m.entrySize = float64(compressed.Len()) / float64(len(entries))
+	m.size = cp.N
+	return nil
+}
+
+// capacityMonth is the projected usage during one month.
+type capacityMonth struct {
+	entries float64 // at the end of the month
+
+	// Full data and hash tiles, and partial tiles uploaded so far.
+	dataBytes, dataObjects       float64
+	hashBytes, hashObjects       float64
+	partialBytes, partialObjects float64
+
+	puts, gets  float64 // during the month
+	egressBytes float64 // during the month
+}
+
+func (m *capacityModel) project() []capacityMonth {
+	secs := estimateMonth.Seconds()
+	const width = 1 << client.TileHeight
+	var months []capacityMonth
+	var prev capacityMonth
+	prev.entries = float64(m.size)
+	prev.dataObjects = math.Floor(prev.entries / width)
+	prev.hashObjects = prev.dataObjects * width / (width - 1)
+	prev.dataBytes = prev.entries * m.entrySize
+	prev.hashBytes = prev.entries * tlog.HashSize * width / (width - 1)
+	for range m.months {
+		cur := prev
+		added := m.rate * secs
+		cur.entries += added
+		levels := math.Max(1, math.Ceil(math.Log(cur.entries)/math.Log(width)))
+
+		// Full data tiles, and full hash tiles at all levels.
+		fullData := math.Floor(cur.entries/width) - math.Floor(prev.entries/width)
+		fullHash := fullData * width / (width - 1)
+		cur.dataObjects += fullData
+		cur.hashObjects += fullHash
+		cur.dataBytes += added * m.entrySize
+		cur.hashBytes += added * tlog.HashSize * width / (width - 1)
+
+		// Rounds with at least one entry, assuming Poisson arrivals. Each
+		// uploads a partial data tile and a partial tile per level, which on
+		// average are half full.
+		rounds := secs * (1 - math.Exp(-m.rate))
+		cur.partialObjects += rounds * (1 + levels)
+		cur.partialBytes += rounds * (width / 2) * (m.entrySize + levels*tlog.HashSize)
+
+		cur.puts = secs + rounds*(1+levels) + fullData + fullHash
+		polls := float64(m.monitors) * secs / m.monitorPoll.Seconds()
+		cur.gets = float64(m.monitors)*(fullData+fullHash) + polls
+		cur.egressBytes = float64(m.monitors) * added * (m.entrySize + tlog.HashSize)
+
+		months = append(months, cur)
+		prev = cur
+	}
+	return months
+}
+
+// cost returns the storage, request, and egress cost of a month.
+func (c *capacityMonth) cost(p storagePrice, withPartials bool) (storage, requests, egress float64) {
+	const gb = 1e9
+	// Objects smaller than the minimum are billed as the minimum. The objects
+	// of each kind are close enough in size to apply it to their average.
+	billed := func(bytes, objects float64) float64 {
+		return max(bytes, objects*float64(p.MinObjectSize))
+	}
+	bytes := billed(c.dataBytes, c.dataObjects) + billed(c.hashBytes, c.hashObjects)
+	if withPartials {
+		bytes += billed(c.partialBytes, c.partialObjects)
+	}
+	storage = bytes / gb * p.StorageGBMonth
+	requests = c.puts/1e6*p.PutPerMillion + c.gets/1e6*p.GetPerMillion
+	egress = c.egressBytes / gb * p.EgressGB
+	return
+}
+
+func (m *capacityModel) report(w io.Writer, prices map[string]storagePrice) {
+	months := m.project()
+	last := months[len(months)-1]
+	fmt.Fprintf(w, "rate:            %.2f entries/s (%.0f per month)\n", m.rate, m.rate*estimateMonth.Seconds())
+	fmt.Fprintf(w, "entry size:      %.0f bytes\n", m.entrySize)
+	fmt.Fprintf(w, "entries:         %.0f after %d months\n", last.entries, m.months)
+	fmt.Fprintf(w, "data tiles:      %s in %.0f objects\n", formatBytes(last.dataBytes), last.dataObjects)
+	fmt.Fprintf(w, "hash tiles:      %s in %.0f objects\n", formatBytes(last.hashBytes), last.hashObjects)
+	fmt.Fprintf(w, "partial tiles:   %s in %.0f objects, unless deleted with sunlight gc\n",
+		formatBytes(last.partialBytes), last.partialObjects)
+	fmt.Fprintf(w, "PUTs:            %.0f per month\n", last.puts)
+	fmt.Fprintf(w, "GETs:            %.0f per month, by %d monitors\n", last.gets, m.monitors)
+	fmt.Fprintf(w, "egress:          %s per month\n", formatBytes(last.egressBytes))
+	fmt.Fprintln(w)
+
+	providers := make([]string, 0, len(prices))
+	for name := range prices {
+		providers = append(providers, name)
+	}
+	slices.Sort(providers)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "provider\tstorage\trequests\tegress\tlast month\twith partials\ttotal\t")
+	for _, name := range providers {
+		p := prices[name]
+		storage, requests, egress := last.cost(p, false)
+		withPartials, _, _ := last.cost(p, true)
+		var total float64
+		for _, month := range months {
+			s, r, e := month.cost(p, false)
+			total += s + r + e
+		}
+		fmt.Fprintf(tw, "%s\t$%.2f\t$%.2f\t$%.2f\t$%.2f\t$%.2f\t$%.2f\t\n", name, storage, requests, egress,
+			storage+requests+egress, withPartials+requests+egress, total)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nCosts are in USD, at approximate list prices. The total is over the whole")
+	fmt.Fprintln(w, "projection, without partial tiles.")
+}
+
+func formatBytes(b float64) string {
+	for _, unit := range []string{"B", "KB", "MB", "GB", "TB"} {
+		if b < 1000 || unit == "TB" {
+			return fmt.Sprintf("%.1f %s", b, unit)
+		}
+		b /= 1000
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// approxEqual reports whether a and b are equal up to floating point error.
+func approxEqual(a, b float64) bool {
+	return a == b || math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b))
+}
+
+func TestCapacityModelProject(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		model capacityModel
+		last  capacityMonth
+	}{
+		{
+			// 2,628,000 entries in 10,265 full data tiles, a tree of 3
+			// levels, and a non-empty round 63% of the seconds.
+			name:  "OneMonth",
+			model: capacityModel{rate: 1, entrySize: 1000, months: 1, monitorPoll: time.Minute},
+			last: capacityMonth{
+				entries:   2628000,
+				dataBytes: 2628000000, dataObjects: 10265,
+				hashBytes: 84425788.23529412, hashObjects: 10305.254901960785,
+				partialBytes: 233048225298.84015, partialObjects: 6644851.314405798,
+				puts: 9293421.56930776,
+			},
+		},
+		{
+			// The existing entries count towards the stored tiles, and only
+			// the new ones are read by the monitors.
+			name: "ExistingLog",
+			model: capacityModel{rate: 10, entrySize: 1500, size: 1000000, months: 2,
+				monitors: 10, monitorPoll: 30 * time.Second},
+			last: capacityMonth{
+				entries:   53560000,
+				dataBytes: 80340000000, dataObjects: 209218,
+				hashBytes: 1720641254.9019608, hashObjects: 210038.46274509805,
+				partialBytes: 1095216578986.7272, partialObjects: 26278806.88984584,
+				puts: 15973118.01747194, gets: 2933145.7254901957, egressBytes: 402609600000,
+			},
+		},
+		{
+			// At a low rate, most seconds have no entries, and PUTs are
+			// dominated by the checkpoint uploads.
+			name: "LowRate",
+			model: capacityModel{rate: 0.001, entrySize: 1000, size: 300, months: 1,
+				monitors: 1, monitorPoll: time.Minute},
+			last: capacityMonth{
+				entries:   2928,
+				dataBytes: 2928000, dataObjects: 11,
+				hashBytes: 94063.43529411765, hashObjects: 11.04313725490196,
+				partialBytes: 357733679.34917516, partialObjects: 7880.059313671327,
+				puts: 2635900.0985293575, gets: 43820.03921568627, egressBytes: 2712096,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			months := tc.model.project()
+			if len(months) != tc.model.months {
+				t.Fatalf("got %d months, expected %d", len(months), tc.model.months)
+			}
+			got, want := months[len(months)-1], tc.last
+			for _, f := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"entries", got.entries, want.entries},
+				{"dataBytes", got.dataBytes, want.dataBytes},
+				{"dataObjects", got.dataObjects, want.dataObjects},
+				{"hashBytes", got.hashBytes, want.hashBytes},
+				{"hashObjects", got.hashObjects, want.hashObjects},
+				{"partialBytes", got.partialBytes, want.partialBytes},
+				{"partialObjects", got.partialObjects, want.partialObjects},
+				{"puts", got.puts, want.puts},
+				{"gets", got.gets, want.gets},
+				{"egressBytes", got.egressBytes, want.egressBytes},
+			} {
+				if !approxEqual(f.got, f.want) {
+					t.Errorf("%s: got %v, expected %v", f.name, f.got, f.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCapacityMonthCost(t *testing.T) {
+	month := &capacityMonth{
+		dataBytes: 1e9, dataObjects: 10,
+		hashBytes: 1e9, hashObjects: 10,
+		partialBytes: 2e9, partialObjects: 1e6,
+		puts: 2e6, gets: 1e6, egressBytes: 1e10,
+	}
+	for _, tc := range []struct {
+		name                      string
+		price                     string
+		withPartials              bool
+		storage, requests, egress float64
+	}{
+		{"Standard", "aws-s3-standard", false, 2 * 0.023, 2*5 + 0.4, 10 * 0.09},
+		{"StandardWithPartials", "aws-s3-standard", true, 4 * 0.023, 2*5 + 0.4, 10 * 0.09},
+		// Full tiles are larger than the minimum object size.
+		{"InfrequentAccess", "aws-s3-standard-ia", false, 2 * 0.0125, 2*10 + 1, 10 * 0.1},
+		// The partial tiles average 2KB, so they are billed as 128KiB each.
+		{"InfrequentAccessWithPartials", "aws-s3-standard-ia", true,
+			(2e9 + 1e6*128*1024) / 1e9 * 0.0125, 2*10 + 1, 10 * 0.1},
+		{"NoEgress", "cloudflare-r2", false, 2 * 0.015, 2*4.5 + 0.36, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			storage, requests, egress := month.cost(defaultStoragePrices[tc.price], tc.withPartials)
+			if !approxEqual(storage, tc.storage) || !approxEqual(requests, tc.requests) || !approxEqual(egress, tc.egress) {
+				t.Errorf("got $%v storage, $%v requests, $%v egress, expected $%v, $%v, $%v",
+					storage, requests, egress, tc.storage, tc.requests, tc.egress)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for _, tc := range []struct {
+		b    float64
+		want string
+	}{
+		{0, "0.0 B"},
+		{999, "999.0 B"},
+		{1000, "1.0 KB"},
+		{1.5e6, "1.5 MB"},
+		{2.25e12, "2.2 TB"},
+		{3e15, "3000.0 TB"},
+	} {
+		if got := formatBytes(tc.b); got != tc.want {
+			t.Errorf("formatBytes(%v) = %q, expected %q", tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestCapacityModelReport(t *testing.T) {
+	m := &capacityModel{rate: 1, entrySize: 1000, months: 2, monitors: 1, monitorPoll: time.Minute}
+	prices := map[string]storagePrice{"b": {StorageGBMonth: 1}, "a": {EgressGB: 1}}
+	buf := &bytes.Buffer{}
+	m.report(buf, prices)
+	out := buf.String()
+	for _, want := range []string{
+		"rate:            1.00 entries/s (2628000 per month)",
+		"entries:         5256000 after 2 months",
+		"data tiles:      5.3 GB in 20531 objects",
+		"egress:          2.7 GB per month",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report is missing %q:\n%s", want, out)
+		}
+	}
+
+	// The providers are sorted. Egress is the same every month, while
+	// storage accumulates, so the total of b is the sum of half and all of
+	// the last month's storage.
+	var rows [][]string
+	for _, line := range strings.Split(out, "\n") {
+		if f := strings.Fields(line); len(f) == 7 && strings.HasPrefix(f[1], "$") {
+			rows = append(rows, f)
+		}
+	}
+	want := [][]string{
+		{"a", "$0.00", "$0.00", "$2.71", "$2.71", "$2.71", "$5.42"},
+		{"b", "$5.42", "$0.00", "$0.00", "$5.42", "$471.52", "$8.14"},
+	}
+	if !slices.EqualFunc(rows, want, slices.Equal) {
+		t.Errorf("got cost rows %q, expected %q", rows, want)
+	}
+}
+
+func TestCapacityModelSample(t *testing.T) {
+	tl := newTestLog(t)
+	m := &capacityModel{}
+	if err := m.sample(context.Background(), tl.Client); err == nil {
+		t.Errorf("sampled an empty log")
+	}
+
+	// Fill three data tiles, so that the second to last full one is tile 1.
+	const n = 3 << client.TileHeight
+	chains := make([][][]byte, n)
+	for i := range chains {
+		chains[i] = tl.chain(tl.issue(t, false))
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 64)
+	for _, chain := range chains {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := tl.AddChain(context.Background(), chain); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ctx := context.Background()
+	fatalIfErr(t, m.sample(ctx, tl.Client))
+	cp, err := tl.Checkpoint(ctx)
+	fatalIfErr(t, err)
+	entries, err := tl.Client.DataTile(ctx, cp.Tree, 1)
+	fatalIfErr(t, err)
+	data, err := tl.ReadTile(ctx, tlog.Tile{H: client.TileHeight, L: -1, N: 1, W: 1 << client.TileHeight})
+	fatalIfErr(t, err)
+	compressed := &bytes.Buffer{}
+	w := gzip.NewWriter(compressed)
+	w.Write(data)
+	w.Close()
+
+	if m.size != n {
+		t.Errorf("got size %d, expected %d", m.size, n)
+	}
+	seconds := float64(entries[len(entries)-1].Timestamp-entries[0].Timestamp) / 1000
+	if rate := float64(len(entries)-1) / seconds; !approxEqual(m.rate, rate) {
+		t.Errorf("got rate %v, expected %v", m.rate, rate)
+	}
+	if size := float64(compressed.Len()) / float64(len(entries)); !approxEqual(m.entrySize, size) {
+		t.Errorf("got entry size %v, expected %v", m.entrySize, size)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"github.com/parquet-go/parquet-go"
+)
+
+// exportRow is a log entry as exported by "sunlight export".
+type exportRow struct {
+	Index     int64 `parquet:"index"`
+	Timestamp int64 `parquet:"timestamp,timestamp(millisecond)"`
+	IsPrecert bool  `parquet:"is_precert"`
+
+	// IssuerKeyHash is the SHA-256 hash of the issuer public key of
+	// precertificates, and empty for certificates.
+	IssuerKeyHash []byte `parquet:"issuer_key_hash"`
+
+	// Certificate is the DER of the certificate or precertificate.
+	Certificate []byte `parquet:"certificate"`
+}
+
+// exportParquetBatch is the number of rows buffered by the Parquet writer
+// between Write calls.
+const exportParquetBatch = 1024
+
+// export implements the "sunlight export" command, which walks the data tiles
+// of a log through its monitoring API, verifying them against the checkpoint,
+// and writes its entries to a CSV or Parquet file, for offline analysis.
+//
+// In CSV files, the issuer key hash is hex-encoded and the certificate
+// base64-encoded, and the timestamp is in milliseconds since the UNIX epoch.
+func export(args []string) {
+	fs := flag.NewFlagSet("sunlight export", flag.ExitOnError)
+	sourceFlag := fs.String("source", "", "monitoring URL prefix of the log (required)")
+	nameFlag := fs.String("name", "", "name of the log, the checkpoint origin (required)")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the log (required)")
+	formatFlag := fs.String("format", "csv", "output format, csv or parquet")
+	outFlag := fs.String("o", "-", "output file, or - for stdout")
+	startFlag := fs.Int64("start", 0, "index of the first entry to export")
+	endFlag := fs.Int64("end", -1, "index after the last entry to export, by default the checkpoint size")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *sourceFlag == "" || *nameFlag == "" || *keyFlag == "" {
+		logger.Error("-source, -name, and -key are required")
+		os.Exit(1)
+	}
+	if *formatFlag != "csv" && *formatFlag != "parquet" {
+		logger.Error("unknown -format", "format", *formatFlag)
+		os.Exit(1)
+	}
+	key, err := parsePublicKey(*keyFlag)
+	if err != nil {
+		logger.Error("invalid -key", "err", err)
+		os.Exit(1)
+	}
+	c, err := client.New(&client.Config{
+		MonitoringPrefix: *sourceFlag,
+		Name:             *nameFlag,
+		PublicKey:        key,
+		UserAgent:        "filippo.io/sunlight export",
+	})
+	if err != nil {
+		logger.Error("failed to create client", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cp, err := c.Checkpoint(ctx)
+	if err != nil {
+		logger.Error("failed to fetch checkpoint", "err", err)
+		os.Exit(1)
+	}
+	end := *endFlag
+	if end < 0 || end > cp.N {
+		end = cp.N
+	}
+	if *startFlag < 0 || *startFlag > end {
+		logger.Error("invalid -start", "start", *startFlag, "end", end)
+		os.Exit(1)
+	}
+
+	var out io.Writer = os.Stdout
+	if *outFlag != "-" {
+		f, err := os.Create(*outFlag)
+		if err != nil {
+			logger.Error("failed to create output file", "err", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	bw := bufio.NewWriter(out)
+
+	var w exportWriter
+	if *formatFlag == "parquet" {
+		w = &parquetExportWriter{w: parquet.NewGenericWriter[exportRow](bw)}
+	} else {
+		w = newCSVExportWriter(bw)
+	}
+
+	start := time.Now()
+	n, err := exportEntries(ctx, c, cp, *startFlag, end, w)
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		logger.Error("export failed", "entries", n, "err", err)
+		os.Exit(1)
+	}
+	logger.Info("exported entries", "start", *startFlag, "end", end,
+		"tree_size", cp.N, "elapsed", time.Since(start))
+}
+
+// exportEntries writes the entries of the log in [start, end) to w.
+func exportEntries(ctx context.Context, c *client.Client, cp *client.Checkpoint, start, end int64, w exportWriter) (int64, error) {
+	var n int64
+	if start == end {
+		return 0, nil
+	}
+	for e, err := range c.Entries(ctx, cp.Tree, start) {
+		if err != nil {
+			return n, err
+		}
+		row := exportRow{
+			Index:       e.LeafIndex,
+			Timestamp:   e.Timestamp,
+			IsPrecert:   e.IsPrecert,
+			Certificate: e.Certificate,
+		}
+		if e.IsPrecert {
+			row.IssuerKeyHash = e.IssuerKeyHash[:]
+			row.Certificate = e.PreCertificate
+		}
+		if err := w.Write(row); err != nil {
+			return n, err
+		}
+		n++
+		if e.LeafIndex+1 >= end {
+			break
+		}
+	}
+	return n, nil
+}
+
+// exportWriter writes exportRows in a specific file format.
+type exportWriter interface {
+	Write(exportRow) error
+	Close() error
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func newCSVExportWriter(w io.Writer) *csvExportWriter {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"index", "timestamp", "is_precert", "issuer_key_hash", "certificate"})
+	return &csvExportWriter{w: cw}
+}
+
+func (w *csvExportWriter) Write(r exportRow) error {
+	return w.w.Write([]string{
+		strconv.FormatInt(r.Index, 10),
+		strconv.FormatInt(r.Timestamp, 10),
+		strconv.FormatBool(r.IsPrecert),
+		hex.EncodeToString(r.IssuerKeyHash),
+		base64.StdEncoding.EncodeToString(r.Certificate),
+	})
+}
+
+func (w *csvExportWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type parquetExportWriter struct {
+	w     *parquet.GenericWriter[exportRow]
+	batch []exportRow
+}
+
+func (w *parquetExportWriter) Write(r exportRow) error {
+	w.batch = append(w.batch, r)
+	if len(w.batch) < exportParquetBatch {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *parquetExportWriter) flush() error {
+	if _, err := w.w.Write(w.batch); err != nil {
+		return fmt.Errorf("failed to write Parquet rows: %w", err)
+	}
+	w.batch = w.batch[:0]
+	return nil
+}
+
+func (w *parquetExportWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.w.Close()
+}
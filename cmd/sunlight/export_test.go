@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestExportEntries(t *testing.T) {
+	tl := newTestLog(t)
+	tl.add(t, false)
+	tl.add(t, true)
+	tl.add(t, false)
+	tl.add(t, true)
+	tl.add(t, false)
+	ctx := context.Background()
+	cp, err := tl.Checkpoint(ctx)
+	fatalIfErr(t, err)
+	entries, err := tl.Entries(ctx)
+	fatalIfErr(t, err)
+
+	checkRow := func(t *testing.T, r exportRow) {
+		t.Helper()
+		e := entries[r.Index]
+		if r.Timestamp != e.Timestamp || r.IsPrecert != e.IsPrecert {
+			t.Errorf("row %d: got timestamp %d and precert %v, expected %d and %v",
+				r.Index, r.Timestamp, r.IsPrecert, e.Timestamp, e.IsPrecert)
+		}
+		want, wantHash := e.Certificate, []byte(nil)
+		if e.IsPrecert {
+			want, wantHash = e.PreCertificate, e.IssuerKeyHash[:]
+		}
+		if !bytes.Equal(r.Certificate, want) {
+			t.Errorf("row %d: wrong certificate", r.Index)
+		}
+		if !bytes.Equal(r.IssuerKeyHash, wantHash) {
+			t.Errorf("row %d: got issuer key hash %x, expected %x", r.Index, r.IssuerKeyHash, wantHash)
+		}
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w := newCSVExportWriter(buf)
+		n, err := exportEntries(ctx, tl.Client, cp, 1, 4, w)
+		fatalIfErr(t, err)
+		fatalIfErr(t, w.Close())
+		if n != 3 {
+			t.Errorf("exported %d entries, expected 3", n)
+		}
+		records, err := csv.NewReader(buf).ReadAll()
+		fatalIfErr(t, err)
+		if len(records) != 4 {
+			t.Fatalf("got %d records, expected a header and 3 rows", len(records))
+		}
+		if records[0][0] != "index" || records[0][4] != "certificate" {
+			t.Errorf("got header %q", records[0])
+		}
+		for i, rec := range records[1:] {
+			var r exportRow
+			r.Index, err = strconv.ParseInt(rec[0], 10, 64)
+			fatalIfErr(t, err)
+			if r.Index != int64(i+1) {
+				t.Errorf("got index %d, expected %d", r.Index, i+1)
+			}
+			r.Timestamp, err = strconv.ParseInt(rec[1], 10, 64)
+			fatalIfErr(t, err)
+			r.IsPrecert, err = strconv.ParseBool(rec[2])
+			fatalIfErr(t, err)
+			if rec[3] != "" {
+				r.IssuerKeyHash, err = hex.DecodeString(rec[3])
+				fatalIfErr(t, err)
+			}
+			r.Certificate, err = base64.StdEncoding.DecodeString(rec[4])
+			fatalIfErr(t, err)
+			checkRow(t, r)
+		}
+	})
+
+	t.Run("Parquet", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w := &parquetExportWriter{w: parquet.NewGenericWriter[exportRow](buf)}
+		n, err := exportEntries(ctx, tl.Client, cp, 0, cp.N, w)
+		fatalIfErr(t, err)
+		fatalIfErr(t, w.Close())
+		if n != cp.N {
+			t.Errorf("exported %d entries, expected %d", n, cp.N)
+		}
+		rows, err := parquet.Read[exportRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		fatalIfErr(t, err)
+		if int64(len(rows)) != cp.N {
+			t.Fatalf("got %d rows, expected %d", len(rows), cp.N)
+		}
+		for i, r := range rows {
+			if r.Index != int64(i) {
+				t.Errorf("got index %d, expected %d", r.Index, i)
+			}
+			checkRow(t, r)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w := newCSVExportWriter(buf)
+		n, err := exportEntries(ctx, tl.Client, cp, 2, 2, w)
+		fatalIfErr(t, err)
+		fatalIfErr(t, w.Close())
+		if n != 0 {
+			t.Errorf("exported %d entries from an empty range", n)
+		}
+		if records, _ := csv.NewReader(buf).ReadAll(); len(records) != 1 {
+			t.Errorf("got %d records, expected only the header", len(records))
+		}
+	})
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	mrand "math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// floodProgressInterval is how often "sunlight flood" logs its progress.
+const floodProgressInterval = 10 * time.Second
+
+// oidCTPoison is the RFC 6962 precertificate poison extension.
+var oidCTPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+
+// flood implements the "sunlight flood" command, a load test that submits
+// synthetic certificates and precertificates issued by a test root at a
+// controlled rate and concurrency, and reports the latency of the SCTs and,
+// if -monitoring is set, the latency until the entries are in the published
+// checkpoint.
+//
+// The test root, generated with -gen-root, must be in the log's Roots, or in
+// its TestRoots, with -token set to the TestRootsToken.
+func flood(args []string) {
+	fs := flag.NewFlagSet("sunlight flood", flag.ExitOnError)
+	urlFlag := fs.String("url", "", "submission URL prefix of the log, without ct/v1/ (required)")
+	rootFlag := fs.String("root", "flood-root.pem", "path to the PEM test root certificate")
+	rootKeyFlag := fs.String("root-key", "flood-root-key.pem", "path to the PEM PKCS#8 test root key")
+	genRootFlag := fs.Bool("gen-root", false, "generate a new test root at -root and -root-key and exit")
+	tokenFlag := fs.String("token", "", "value of the Sunlight-Test-Submission header, for TestRoots")
+	rateFlag := fs.Float64("rate", 10, "submissions per second, or 0 for as fast as possible")
+	concurrencyFlag := fs.Int("concurrency", 10, "maximum number of concurrent submissions")
+	durationFlag := fs.Duration("duration", 1*time.Minute, "how long to submit for")
+	countFlag := fs.Int("count", 0, "number of submissions after which to stop, or 0 for no limit")
+	notAfterFlag := fs.String("not-after", "", "NotAfter of the certificates, as RFC 3339, by default in 90 days")
+	precertsFlag := fs.Float64("precerts", 0.5, "fraction of submissions that are precertificates")
+	monitoringFlag := fs.String("monitoring", "", "monitoring URL prefix of the log, to measure the merge latency")
+	nameFlag := fs.String("name", "", "name of the log, required with -monitoring")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the log, required with -monitoring")
+	pollFlag := fs.Duration("poll", 250*time.Millisecond, "how often to fetch the checkpoint with -monitoring")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	if *genRootFlag {
+		if err := generateFloodRoot(*rootFlag, *rootKeyFlag); err != nil {
+			logger.Error("failed to generate test root", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("generated test root, add it to the log's Roots or TestRoots", "root", *rootFlag)
+		return
+	}
+
+	if *urlFlag == "" {
+		logger.Error("-url is required")
+		os.Exit(1)
+	}
+	if *concurrencyFlag <= 0 || *rateFlag < 0 || *countFlag < 0 {
+		logger.Error("-concurrency must be positive and -rate and -count not negative")
+		os.Exit(1)
+	}
+	root, rootKey, err := loadFloodRoot(*rootFlag, *rootKeyFlag)
+	if err != nil {
+		logger.Error("failed to load test root", "err", err)
+		os.Exit(1)
+	}
+	notAfter := time.Now().Add(90 * 24 * time.Hour)
+	if *notAfterFlag != "" {
+		notAfter, err = time.Parse(time.RFC3339, *notAfterFlag)
+		if err != nil {
+			logger.Error("invalid -not-after", "err", err)
+			os.Exit(1)
+		}
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		logger.Error("failed to generate leaf key", "err", err)
+		os.Exit(1)
+	}
+
+	var mon *client.Client
+	if *monitoringFlag != "" {
+		key, err := parsePublicKey(*keyFlag)
+		if err != nil || *nameFlag == "" {
+			logger.Error("-monitoring requires -name and a valid -key", "err", err)
+			os.Exit(1)
+		}
+		mon, err = client.New(&client.Config{
+			MonitoringPrefix: *monitoringFlag,
+			Name:             *nameFlag,
+			PublicKey:        key,
+			UserAgent:        "filippo.io/sunlight flood",
+		})
+		if err != nil {
+			logger.Error("failed to create monitoring client", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	f := &flooder{
+		s: &submitter{
+			url:       strings.TrimSuffix(*urlFlag, "/") + "/ct/v1/",
+			token:     *tokenFlag,
+			userAgent: "filippo.io/sunlight flood",
+			hc:        &http.Client{Timeout: 1 * time.Minute},
+		},
+		root:     root,
+		rootKey:  rootKey,
+		leafKey:  leafKey,
+		notAfter: notAfter,
+		precerts: *precertsFlag,
+		errors:   make(map[string]int),
+	}
+
+	submitted := make(chan struct{})
+	var mergeDone chan struct{}
+	if mon != nil {
+		mergeDone = make(chan struct{})
+		go func() {
+			defer close(mergeDone)
+			f.watchMerges(ctx, submitted, mon, *pollFlag, logger)
+		}()
+	}
+
+	elapsed := f.run(ctx, *durationFlag, *countFlag, *rateFlag, *concurrencyFlag, logger)
+	close(submitted)
+	if mergeDone != nil {
+		logger.Info("waiting for the submitted entries to be published")
+		<-mergeDone
+	}
+	f.report(os.Stdout, elapsed)
+}
+
+// run starts submissions at rate per second, or as fast as possible if rate is
+// zero, as long as fewer than concurrency are in flight, for duration or until
+// count submissions were started if count is not zero. It returns once all the
+// submissions completed, with the time since the first was started.
+func (f *flooder) run(ctx context.Context, duration time.Duration, count int, rate float64, concurrency int, logger *slog.Logger) time.Duration {
+	submitCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	start := time.Now()
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var tick <-chan time.Time
+	if rate > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer t.Stop()
+		tick = t.C
+	}
+	progress := time.NewTicker(floodProgressInterval)
+	defer progress.Stop()
+	var started int
+loop:
+	for count == 0 || started < count {
+		if tick != nil {
+			select {
+			case <-submitCtx.Done():
+				break loop
+			case <-progress.C:
+				f.logProgress(logger, time.Since(start))
+				continue
+			case <-tick:
+			}
+		}
+		select {
+		case <-submitCtx.Done():
+			break loop
+		case <-progress.C:
+			f.logProgress(logger, time.Since(start))
+			continue
+		case sem <- struct{}{}:
+		}
+		started++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			f.submit(ctx)
+		}()
+	}
+	wg.Wait()
+	return time.Since(start)
+}
+
+// flooder holds the state of a "sunlight flood" run.
+type flooder struct {
+	s        *submitter
+	root     *x509.Certificate
+	rootKey  *ecdsa.PrivateKey
+	leafKey  *ecdsa.PrivateKey
+	notAfter time.Time
+	precerts float64
+
+	mu sync.Mutex
+	// sctLatencies are the latencies of successful submissions, and errors
+	// counts the failed ones by HTTP status or error type.
+	sctLatencies []time.Duration
+	errors       map[string]int
+	// pending are the SCTs not yet seen in a published checkpoint, and
+	// mergeLatencies the time from SCT to checkpoint of the merged ones.
+	pending        []pendingSCT
+	mergeLatencies []time.Duration
+	treeSize       int64
+}
+
+type pendingSCT struct {
+	index int64
+	t     time.Time
+}
+
+func (f *flooder) submit(ctx context.Context) {
+	isPrecert := mrand.Float64() < f.precerts
+	leaf, err := f.issue(isPrecert)
+	if err != nil {
+		f.fail("issue")
+		return
+	}
+	start := time.Now()
+	sct, err := f.s.submit(ctx, [][]byte{leaf, f.root.Raw}, isPrecert)
+	latency := time.Since(start)
+	var serr *submitError
+	switch {
+	case errors.As(err, &serr):
+		f.fail(fmt.Sprintf("HTTP %d", serr.status))
+		return
+	case errors.Is(err, errInvalidResponse):
+		f.fail("invalid response")
+		return
+	case err != nil:
+		if ctx.Err() == nil {
+			f.fail("network")
+		}
+		return
+	}
+	index, err := ctlog.ParseExtensions(sct.Extensions)
+	if err != nil {
+		f.fail("invalid extensions")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sctLatencies = append(f.sctLatencies, latency)
+	if index < f.treeSize {
+		f.mergeLatencies = append(f.mergeLatencies, 0)
+	} else {
+		f.pending = append(f.pending, pendingSCT{index: index, t: time.Now()})
+	}
+}
+
+func (f *flooder) fail(reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors[reason]++
+}
+
+// issue returns a new certificate or precertificate for a random name, signed
+// by the test root.
+func (f *flooder) issue(isPrecert bool) ([]byte, error) {
+	return issueTestCertificate(f.root, f.rootKey, &f.leafKey.PublicKey,
+		f.notAfter.Add(-90*24*time.Hour), f.notAfter, isPrecert)
+}
+
+// issueTestCertificate returns a new certificate or precertificate for a
+// random name under flood.invalid, signed by a test root from generateFloodRoot.
+func issueTestCertificate(root *x509.Certificate, rootKey *ecdsa.PrivateKey, pub *ecdsa.PublicKey,
+	notBefore, notAfter time.Time, isPrecert bool) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%x.flood.invalid", serial.Bytes()[:8])
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if isPrecert {
+		tmpl.ExtraExtensions = []pkix.Extension{{
+			Id: oidCTPoison, Critical: true, Value: asn1.NullBytes,
+		}}
+	}
+	return x509.CreateCertificate(rand.Reader, tmpl, root, pub, rootKey)
+}
+
+// watchMerges polls the checkpoint and records the merge latency of the
+// pending SCTs, until submitted is closed and no SCTs are pending, or until
+// ctx is canceled.
+func (f *flooder) watchMerges(ctx context.Context, submitted <-chan struct{}, c *client.Client, poll time.Duration, logger *slog.Logger) {
+	for {
+		cp, err := c.Checkpoint(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("failed to fetch checkpoint", "err", err)
+		}
+		now := time.Now()
+		f.mu.Lock()
+		if err == nil && cp.N > f.treeSize {
+			f.treeSize = cp.N
+			f.pending = slices.DeleteFunc(f.pending, func(p pendingSCT) bool {
+				if p.index >= cp.N {
+					return false
+				}
+				f.mergeLatencies = append(f.mergeLatencies, now.Sub(p.t))
+				return true
+			})
+		}
+		pending := len(f.pending)
+		f.mu.Unlock()
+		var done bool
+		select {
+		case <-submitted:
+			done = pending == 0
+		default:
+		}
+		if done {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(poll):
+		}
+	}
+}
+
+func (f *flooder) logProgress(logger *slog.Logger, elapsed time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var errs int
+	for _, n := range f.errors {
+		errs += n
+	}
+	logger.Info("flood progress", "elapsed", elapsed.Round(time.Second),
+		"scts", len(f.sctLatencies), "errors", errs, "pending_merge", len(f.pending))
+}
+
+func (f *flooder) report(w io.Writer, elapsed time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fmt.Fprintf(w, "duration:     %v\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "SCTs:         %d (%.1f/s)\n", len(f.sctLatencies),
+		float64(len(f.sctLatencies))/elapsed.Seconds())
+	reasons := make([]string, 0, len(f.errors))
+	for r := range f.errors {
+		reasons = append(reasons, r)
+	}
+	slices.Sort(reasons)
+	for _, r := range reasons {
+		fmt.Fprintf(w, "errors:       %d (%s)\n", f.errors[r], r)
+	}
+	fmt.Fprintf(w, "SCT latency:  %s\n", latencySummary(f.sctLatencies))
+	if f.treeSize > 0 || len(f.pending) > 0 {
+		fmt.Fprintf(w, "merge latency: %s\n", latencySummary(f.mergeLatencies))
+		if len(f.pending) > 0 {
+			fmt.Fprintf(w, "never merged: %d\n", len(f.pending))
+		}
+	}
+}
+
+// latencySummary formats the percentiles of a set of latencies.
+func latencySummary(d []time.Duration) string {
+	if len(d) == 0 {
+		return "n/a"
+	}
+	slices.Sort(d)
+	p := func(q float64) time.Duration {
+		return d[min(int(q*float64(len(d))), len(d)-1)].Round(time.Millisecond)
+	}
+	return fmt.Sprintf("p50 %v, p90 %v, p99 %v, max %v", p(0.5), p(0.9), p(0.99), d[len(d)-1].Round(time.Millisecond))
+}
+
+// generateFloodRoot writes a new self-signed ECDSA P-256 root and its key.
+func generateFloodRoot(rootPath, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Sunlight flood test root"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(rootPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// loadFloodRoot reads the test root generated by generateFloodRoot.
+func loadFloodRoot(rootPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	rootPEM, err := os.ReadFile(rootPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(rootPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, nil, fmt.Errorf("no certificate in %q", rootPath)
+	}
+	root, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, nil, fmt.Errorf("no private key in %q", keyPath)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := k.(*ecdsa.PrivateKey)
+	if !ok || !key.PublicKey.Equal(root.PublicKey) {
+		return nil, nil, errors.New("test root key is not the ECDSA key of the root")
+	}
+	return root, key, nil
+}
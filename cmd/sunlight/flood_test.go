@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/sunlighttest"
+)
+
+func newTestFlooder(t *testing.T, url string) *flooder {
+	dir := t.TempDir()
+	rootPath, keyPath := filepath.Join(dir, "root.pem"), filepath.Join(dir, "root-key.pem")
+	fatalIfErr(t, generateFloodRoot(rootPath, keyPath))
+	root, rootKey, err := loadFloodRoot(rootPath, keyPath)
+	fatalIfErr(t, err)
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	return &flooder{
+		s: &submitter{
+			url:       strings.TrimSuffix(url, "/") + "/ct/v1/",
+			userAgent: "filippo.io/sunlight flood",
+			hc:        &http.Client{Timeout: 10 * time.Second},
+		},
+		root:     root,
+		rootKey:  rootKey,
+		leafKey:  leafKey,
+		notAfter: time.Now().Add(90 * 24 * time.Hour),
+		precerts: 0.5,
+		errors:   make(map[string]int),
+	}
+}
+
+func TestFloodCount(t *testing.T) {
+	f := newTestFlooder(t, "")
+	tl := sunlighttest.NewLog(t, &sunlighttest.Config{
+		Roots:            []*x509.Certificate{f.root},
+		SequencingPeriod: 5 * time.Millisecond,
+	})
+	f.s.url = tl.URL + "ct/v1/"
+
+	f.run(context.Background(), 1*time.Minute, 20, 0, 4, discardLogger())
+	if len(f.sctLatencies) != 20 || len(f.errors) != 0 {
+		t.Errorf("got %d SCTs and errors %v, expected 20 SCTs", len(f.sctLatencies), f.errors)
+	}
+	entries, err := tl.Entries(context.Background())
+	fatalIfErr(t, err)
+	if len(entries) != 20 {
+		t.Errorf("got %d entries in the log, expected 20", len(entries))
+	}
+	var precerts int
+	for _, e := range entries {
+		if e.IsPrecert {
+			precerts++
+		}
+	}
+	if precerts == 0 || precerts == 20 {
+		t.Errorf("got %d precertificates out of 20, expected a mix", precerts)
+	}
+
+	// The merge latency of every SCT is recorded once it's in a checkpoint.
+	submitted := make(chan struct{})
+	close(submitted)
+	f.watchMerges(context.Background(), submitted, tl.Client, 5*time.Millisecond, discardLogger())
+	if len(f.pending) != 0 || len(f.mergeLatencies) != 20 {
+		t.Errorf("got %d pending and %d merged SCTs", len(f.pending), len(f.mergeLatencies))
+	}
+
+	buf := &bytes.Buffer{}
+	f.report(buf, time.Second)
+	for _, want := range []string{"SCTs:         20 (20.0/s)", "SCT latency:  p50", "merge latency: p50"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report is missing %q:\n%s", want, buf)
+		}
+	}
+}
+
+func TestFloodDuration(t *testing.T) {
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "pool full", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	f := newTestFlooder(t, ts.URL)
+
+	elapsed := f.run(context.Background(), 100*time.Millisecond, 0, 0, 2, discardLogger())
+	if elapsed < 100*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("ran for %v, expected 100ms", elapsed)
+	}
+	if requests.Load() == 0 {
+		t.Fatalf("no requests were made")
+	}
+	// Every request is accounted for, by status.
+	if got := f.errors["HTTP 503"]; int64(got) != requests.Load() || len(f.errors) != 1 {
+		t.Errorf("got errors %v, expected %d HTTP 503", f.errors, requests.Load())
+	}
+	if len(f.sctLatencies) != 0 {
+		t.Errorf("got %d SCTs from a failing log", len(f.sctLatencies))
+	}
+}
+
+func TestFloodRate(t *testing.T) {
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+	f := newTestFlooder(t, ts.URL)
+
+	// At 50/s for 500ms, about 25 submissions are started, regardless of the
+	// higher concurrency.
+	f.run(context.Background(), 500*time.Millisecond, 0, 50, 100, discardLogger())
+	if n := requests.Load(); n < 10 || n > 30 {
+		t.Errorf("got %d requests, expected about 25", n)
+	}
+	if int64(f.errors["HTTP 429"]) != requests.Load() {
+		t.Errorf("got errors %v, expected %d HTTP 429", f.errors, requests.Load())
+	}
+}
+
+func TestFloodErrors(t *testing.T) {
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		case 2:
+			w.Write([]byte("not JSON"))
+		case 3:
+			// A valid SCT, but without the leaf_index extension.
+			w.Write([]byte(`{"sct_version":0,"id":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",` +
+				`"timestamp":1,"extensions":"","signature":"BAMAAA=="}`))
+		default:
+			// Drop the connection.
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		}
+	}))
+	defer ts.Close()
+	f := newTestFlooder(t, ts.URL)
+
+	f.run(context.Background(), 1*time.Minute, 4, 0, 1, discardLogger())
+	want := map[string]int{"HTTP 500": 1, "invalid response": 1, "invalid extensions": 1, "network": 1}
+	if len(f.errors) != len(want) {
+		t.Errorf("got errors %v, expected %v", f.errors, want)
+	}
+	for reason, n := range want {
+		if f.errors[reason] != n {
+			t.Errorf("got errors %v, expected %v", f.errors, want)
+			break
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	f.report(buf, time.Second)
+	for _, want := range []string{"errors:       1 (HTTP 500)", "errors:       1 (network)", "SCT latency:  n/a"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report is missing %q:\n%s", want, buf)
+		}
+	}
+}
+
+func TestLoadFloodRoot(t *testing.T) {
+	dir := t.TempDir()
+	fatalIfErr(t, generateFloodRoot(filepath.Join(dir, "a.pem"), filepath.Join(dir, "a-key.pem")))
+	fatalIfErr(t, generateFloodRoot(filepath.Join(dir, "b.pem"), filepath.Join(dir, "b-key.pem")))
+	if _, _, err := loadFloodRoot(filepath.Join(dir, "a.pem"), filepath.Join(dir, "b-key.pem")); err == nil {
+		t.Errorf("accepted the key of a different root")
+	}
+	if _, _, err := loadFloodRoot(filepath.Join(dir, "a-key.pem"), filepath.Join(dir, "a-key.pem")); err == nil {
+		t.Errorf("accepted a key as the root certificate")
+	}
+}
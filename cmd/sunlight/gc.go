@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// defaultGCMinAge is the minimum age of collected tiles, if -min-age is not
+// set. It's much longer than the time any client should take between fetching
+// a checkpoint and the tiles it needs.
+const defaultGCMinAge = 1 * time.Hour
+
+// gc implements the "sunlight gc" command, which finds the tiles of the logs
+// in the config file that are no longer needed, and deletes them if -delete
+// is passed. See [ctlog.CollectGarbage] for what is collected.
+func gc(args []string) {
+	fs := flag.NewFlagSet("sunlight gc", flag.ExitOnError)
+	configFlag := fs.String("c", "sunlight.yaml", "path to the config file")
+	logFlag := fs.String("log", "", "ShortName of the log to collect, by default all logs")
+	deleteFlag := fs.Bool("delete", false, "delete the garbage tiles, rather than only reporting them")
+	orphansFlag := fs.Bool("orphans", false, "also collect tiles beyond the latest checkpoint; only safe while the log is stopped")
+	minAgeFlag := fs.Duration("min-age", defaultGCMinAge, "minimum age of the tiles to collect")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	c, err := readConfig(*configFlag)
+	if err != nil {
+		logger.Error("failed to load config", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	db, err := newLockBackend(ctx, c, logger)
+	if err != nil {
+		logger.Error("failed to create lock backend", "err", err)
+		os.Exit(1)
+	}
+
+	var found bool
+	for _, lc := range c.Logs {
+		if *logFlag != "" && lc.ShortName != *logFlag {
+			continue
+		}
+		found = true
+		logger := logger.With("log", lc.ShortName)
+
+		b, err := ctlog.NewS3Backend(ctx, lc.S3Region, lc.S3Bucket, lc.S3Endpoint, lc.S3KeyPrefix, logger)
+		if err != nil {
+			logger.Error("failed to create backend", "err", err)
+			os.Exit(1)
+		}
+		signer, _, err := newSigner(ctx, &lc, logger)
+		if err != nil {
+			logger.Error("failed to load log key", "err", err)
+			os.Exit(1)
+		}
+		res, err := ctlog.CollectGarbage(ctx, &ctlog.Config{
+			Name:    lc.Name,
+			Key:     signer,
+			Backend: b,
+			Lock:    db,
+			Log:     logger,
+		}, &ctlog.GCOptions{
+			Delete:  *deleteFlag,
+			Orphans: *orphansFlag,
+			MinAge:  *minAgeFlag,
+		})
+		if err != nil {
+			logger.Error("garbage collection failed", "err", err)
+			os.Exit(1)
+		}
+		if !*deleteFlag {
+			for _, key := range res.Obsolete {
+				logger.Info("obsolete partial tile", "key", key)
+			}
+			for _, key := range res.Orphaned {
+				logger.Info("orphaned tile", "key", key)
+			}
+			logger.Info("dry run, pass -delete to delete the tiles above")
+		}
+	}
+	if !found {
+		logger.Error("log not found in config file", "log", *logFlag)
+		os.Exit(1)
+	}
+}
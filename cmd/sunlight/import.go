@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	ctclient "github.com/google/certificate-transparency-go/client"
+	"github.com/google/certificate-transparency-go/jsonclient"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// defaultImportBatch is the number of entries requested with each get-entries
+// call and sequenced together, if -batch is not set.
+const defaultImportBatch = 256
+
+// importLog implements the "sunlight import" command, which copies the
+// entries of a RFC 6962 log into a Sunlight log from the config file.
+//
+// The entries are sequenced in order, in batches of -batch entries, with their
+// original timestamps and without issuing SCTs. Sunlight entries have a
+// leaf_index extension, so the Sunlight tree can't have the same root hash as
+// the source log. Instead, every entry is checked to be converted without any
+// other change, and the source leaves are hashed into a tree which is checked
+// against the source STH at the end.
+//
+// The hashes needed to resume that tree are saved to the -state file after
+// every batch, and an interrupted import resumes from the end of the Sunlight
+// log. The log must not be served by another instance during the import.
+func importLog(args []string) {
+	fs := flag.NewFlagSet("sunlight import", flag.ExitOnError)
+	configFlag := fs.String("c", "sunlight.yaml", "path to the config file")
+	logFlag := fs.String("log", "", "ShortName of the log to import into (required)")
+	sourceFlag := fs.String("source", "", "URL prefix of the source RFC 6962 log (required)")
+	keyFlag := fs.String("source-key", "", "base64-encoded SubjectPublicKeyInfo of the source log (required)")
+	stateFlag := fs.String("state", "", "path to the file tracking the import progress (required)")
+	batchFlag := fs.Int("batch", defaultImportBatch, "number of entries to fetch and sequence at a time")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *logFlag == "" || *sourceFlag == "" || *keyFlag == "" || *stateFlag == "" {
+		logger.Error("-log, -source, -source-key, and -state are required")
+		os.Exit(1)
+	}
+	if *batchFlag <= 0 {
+		logger.Error("-batch must be positive")
+		os.Exit(1)
+	}
+
+	c, err := readConfig(*configFlag)
+	if err != nil {
+		logger.Error("failed to load config", "err", err)
+		os.Exit(1)
+	}
+	var lc *LogConfig
+	for i := range c.Logs {
+		if c.Logs[i].ShortName == *logFlag {
+			lc = &c.Logs[i]
+		}
+	}
+	if lc == nil {
+		logger.Error("log not found in config file", "log", *logFlag)
+		os.Exit(1)
+	}
+	logger = logger.With("log", lc.ShortName)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	l, err := loadImportLog(ctx, c, lc, logger)
+	if err != nil {
+		logger.Error("failed to load log", "err", err)
+		os.Exit(1)
+	}
+	defer l.CloseCache()
+
+	spki, err := base64.StdEncoding.DecodeString(*keyFlag)
+	if err != nil {
+		logger.Error("invalid -source-key", "err", err)
+		os.Exit(1)
+	}
+	src, err := ctclient.New(*sourceFlag, &http.Client{Timeout: 1 * time.Minute}, jsonclient.Options{
+		PublicKeyDER: spki,
+		UserAgent:    "filippo.io/sunlight import",
+	})
+	if err != nil {
+		logger.Error("failed to create source client", "err", err)
+		os.Exit(1)
+	}
+
+	if err := runImport(ctx, l, src, *stateFlag, *batchFlag, logger); err != nil {
+		logger.Error("import failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+// loadImportLog creates, if necessary, and loads the log configured by lc.
+func loadImportLog(ctx context.Context, c *Config, lc *LogConfig, logger *slog.Logger) (*ctlog.Log, error) {
+	db, err := newLockBackend(ctx, c, logger)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ctlog.NewS3Backend(ctx, lc.S3Region, lc.S3Bucket, lc.S3Endpoint, lc.S3KeyPrefix, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backend: %w", err)
+	}
+	signer, _, err := newSigner(ctx, lc, logger)
+	if err != nil {
+		return nil, err
+	}
+	var checkpointSigners []note.Signer
+	for _, path := range lc.CheckpointKeys {
+		s, err := loadNoteSigner(path, lc.KeyIdentityFile, lc.KeyPassphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load checkpoint key %q: %w", path, err)
+		}
+		checkpointSigners = append(checkpointSigners, s)
+	}
+	r, _, err := loadRoots(ctx, lc.Roots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roots: %w", err)
+	}
+	notAfterStart, err := time.Parse(time.RFC3339, lc.NotAfterStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NotAfterStart: %w", err)
+	}
+	notAfterLimit, err := time.Parse(time.RFC3339, lc.NotAfterLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NotAfterLimit: %w", err)
+	}
+
+	cc := &ctlog.Config{
+		Name:              lc.Name,
+		Key:               signer,
+		Cache:             lc.Cache,
+		Backend:           b,
+		Lock:              db,
+		Log:               logger,
+		Roots:             r,
+		NotAfterStart:     notAfterStart,
+		NotAfterLimit:     notAfterLimit,
+		CheckpointSigners: checkpointSigners,
+	}
+	if err := ctlog.CreateLog(ctx, cc); err == ctlog.ErrLogExists {
+		logger.Info("log exists, resuming import")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create log: %w", err)
+	}
+	return ctlog.LoadLog(ctx, cc)
+}
+
+// importState is the content of the import -state file.
+type importState struct {
+	// Source is the URL of the source log.
+	Source string `json:"source"`
+
+	// TreeSize is the number of source entries imported, and Frontier the
+	// hashes of the source log's tree of that size needed to extend it, as
+	// produced by [frontier].
+	TreeSize int64    `json:"tree_size"`
+	Frontier [][]byte `json:"frontier"`
+}
+
+// runImport imports the source log up to its current STH into l.
+func runImport(ctx context.Context, l *ctlog.Log, src *ctclient.LogClient, statePath string, batch int, logger *slog.Logger) error {
+	sth, err := src.GetSTH(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch source STH: %w", err)
+	}
+	logger.Info("fetched source STH", "tree_size", sth.TreeSize, "timestamp", sth.Timestamp)
+
+	state := &importState{Source: src.BaseURI()}
+	if b, err := os.ReadFile(statePath); err == nil {
+		if err := json.Unmarshal(b, state); err != nil {
+			return fmt.Errorf("failed to parse state file: %w", err)
+		}
+		if state.Source != src.BaseURI() {
+			return fmt.Errorf("state file is for source %q, not %q", state.Source, src.BaseURI())
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+	f := &frontier{n: state.TreeSize}
+	for _, h := range state.Frontier {
+		if len(h) != tlog.HashSize {
+			return errors.New("invalid hash in state file")
+		}
+		f.hashes = append(f.hashes, tlog.Hash(h))
+	}
+
+	size := l.DebugState().TreeSize
+	end := int64(sth.TreeSize)
+	switch {
+	case size < state.TreeSize:
+		return fmt.Errorf("log has %d entries, but the state file has %d", size, state.TreeSize)
+	case size > end:
+		return fmt.Errorf("log has %d entries, but the source STH has %d", size, end)
+	case size > state.TreeSize:
+		// The last batch was sequenced, but the state file was not updated.
+		logger.Info("hashing source entries missing from the state file",
+			"start", state.TreeSize, "end", size)
+	}
+
+	start := time.Now()
+	for f.n < end {
+		// Entries already in the log are only hashed, and not sequenced again.
+		imported := f.n >= size
+		stop := end
+		if !imported {
+			stop = size
+		}
+		resp, err := src.GetRawEntries(ctx, f.n, min(f.n+int64(batch), stop)-1)
+		if err != nil {
+			return fmt.Errorf("failed to fetch source entries at %d: %w", f.n, err)
+		}
+		if len(resp.Entries) == 0 {
+			return fmt.Errorf("source returned no entries at %d", f.n)
+		}
+		resp.Entries = resp.Entries[:min(len(resp.Entries), int(stop-f.n))]
+
+		var entries []*ctlog.ImportEntry
+		for i, le := range resp.Entries {
+			if imported {
+				e, err := ctlog.ParseRFC6962Entry(le.LeafInput, le.ExtraData)
+				if err != nil {
+					return fmt.Errorf("source entry %d: %w", f.n+int64(i), err)
+				}
+				entries = append(entries, e)
+			}
+			f.append(tlog.RecordHash(le.LeafInput))
+		}
+		if imported {
+			if err := l.ImportEntries(ctx, entries); err != nil {
+				return fmt.Errorf("failed to sequence entries: %w", err)
+			}
+		}
+
+		state.TreeSize, state.Frontier = f.n, nil
+		for _, h := range f.hashes {
+			state.Frontier = append(state.Frontier, h[:])
+		}
+		b, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(statePath, b); err != nil {
+			return fmt.Errorf("failed to write state file: %w", err)
+		}
+		logger.Debug("imported entries", "tree_size", f.n, "entries", len(resp.Entries))
+		if f.n%(int64(batch)*100) < int64(len(resp.Entries)) {
+			logger.Info("import progress", "tree_size", f.n, "source_tree_size", end,
+				"elapsed", time.Since(start))
+		}
+	}
+
+	if root := f.root(); root != tlog.Hash(sth.SHA256RootHash) {
+		return fmt.Errorf("imported entries don't match the source STH: root hash is %v, expected %v",
+			root, tlog.Hash(sth.SHA256RootHash))
+	}
+	logger.Info("import complete, verified against source STH", "tree_size", end,
+		"root_hash", tlog.Hash(sth.SHA256RootHash), "elapsed", time.Since(start))
+	return nil
+}
+
+// frontier is the right edge of a RFC 6962 Merkle tree being built leaf by
+// leaf: the roots of its complete subtrees, from the largest to the smallest.
+type frontier struct {
+	n      int64
+	hashes []tlog.Hash
+}
+
+func (f *frontier) append(h tlog.Hash) {
+	f.hashes = append(f.hashes, h)
+	for k := f.n; k&1 == 1; k >>= 1 {
+		i := len(f.hashes) - 2
+		f.hashes[i] = tlog.NodeHash(f.hashes[i], f.hashes[i+1])
+		f.hashes = f.hashes[:i+1]
+	}
+	f.n++
+}
+
+func (f *frontier) root() tlog.Hash {
+	if f.n == 0 {
+		return sha256.Sum256(nil)
+	}
+	h := f.hashes[len(f.hashes)-1]
+	for i := len(f.hashes) - 2; i >= 0; i-- {
+		h = tlog.NodeHash(f.hashes[i], h)
+	}
+	return h
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"filippo.io/sunlight/client"
+	"github.com/google/certificate-transparency-go/x509"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+const (
+	// indexBatchSize is the number of entries added to the index in each
+	// transaction.
+	indexBatchSize = 16 << client.TileHeight
+
+	// defaultIndexSearchLimit and maxIndexSearchLimit bound the number of
+	// results returned by each search.
+	defaultIndexSearchLimit = 100
+	maxIndexSearchLimit     = 1000
+)
+
+// indexLog implements the "sunlight index" command, which follows a log through
+// its monitoring API, extracts the DNS names of the logged certificates and
+// precertificates into a local SQLite index, and serves a search endpoint.
+//
+// It's meant to run as a sidecar for security teams that need to know what
+// was logged for their domains, without downloading the whole log each time.
+// Consecutive checkpoints are verified to be consistent, and every data tile
+// against its checkpoint. Indexing resumes from the database on restart.
+//
+// GET /search?q=example.com returns, as JSON, the entries with the name
+// example.com, and with subdomains=true also the ones with its subdomains,
+// including wildcards. Results are ordered by leaf index, limited by limit,
+// and the next page is requested by passing the returned "next" as after.
+func indexLog(args []string) {
+	fs := flag.NewFlagSet("sunlight index", flag.ExitOnError)
+	sourceFlag := fs.String("source", "", "monitoring URL prefix of the log (required)")
+	nameFlag := fs.String("name", "", "name of the log, the checkpoint origin (required)")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the log (required)")
+	dbFlag := fs.String("db", "", "path of the SQLite index database, created if missing (required)")
+	listenFlag := fs.String("listen", "localhost:8080", "address to serve the search endpoint on, as accepted by the Listen config option")
+	intervalFlag := fs.Duration("interval", 10*time.Second, "how often to check the log for new entries")
+	fromFlag := fs.Int64("from", 0, "index of the first entry to index, if the database is empty")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *sourceFlag == "" || *nameFlag == "" || *keyFlag == "" || *dbFlag == "" {
+		logger.Error("-source, -name, -key, and -db are required")
+		os.Exit(1)
+	}
+	key, err := parsePublicKey(*keyFlag)
+	if err != nil {
+		logger.Error("invalid -key", "err", err)
+		os.Exit(1)
+	}
+	c, err := client.New(&client.Config{
+		MonitoringPrefix: *sourceFlag,
+		Name:             *nameFlag,
+		PublicKey:        key,
+		UserAgent:        "filippo.io/sunlight index",
+	})
+	if err != nil {
+		logger.Error("failed to create client", "err", err)
+		os.Exit(1)
+	}
+	ix, err := openDomainIndex(*dbFlag, *fromFlag)
+	if err != nil {
+		logger.Error("failed to open index database", "err", err)
+		os.Exit(1)
+	}
+	defer ix.close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ln, err := listen(*listenFlag, ListenerConfig{})
+	if err != nil {
+		logger.Error("failed to listen", "err", err)
+		os.Exit(1)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search", ix.serveSearch)
+	s := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 1 * time.Minute,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelDebug),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		logger.Info("serving search endpoint", "addr", ln.Addr())
+		if err := s.Serve(ln); err != http.ErrServerClosed {
+			logger.Error("server error", "err", err)
+			os.Exit(1)
+		}
+	}()
+
+	t := time.NewTicker(*intervalFlag)
+	defer t.Stop()
+	for {
+		if err := ix.update(ctx, c, logger); err != nil && ctx.Err() == nil {
+			logger.Error("failed to update index", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// domainIndex is the SQLite database of "sunlight index".
+//
+// The names table maps each DNS name, with its labels reversed so that the
+// names of a domain and its subdomains are a contiguous range, to the leaf
+// indexes of the entries that include it. The state table holds the last
+// verified tree, and the index of the next entry to add.
+type domainIndex struct {
+	// write is only used by update, which is not called concurrently.
+	write *sqlite.Conn
+
+	mu   sync.Mutex
+	read *sqlite.Conn
+}
+
+func openDomainIndex(path string, from int64) (*domainIndex, error) {
+	write, err := sqlite.OpenConn(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlitex.ExecTransient(write, "PRAGMA journal_mode = WAL", nil); err != nil {
+		write.Close()
+		return nil, err
+	}
+	if err := sqlitex.ExecTransient(write, "PRAGMA synchronous = NORMAL", nil); err != nil {
+		write.Close()
+		return nil, err
+	}
+	if err := sqlitex.ExecScript(write, `
+		CREATE TABLE IF NOT EXISTS entries (
+			leaf_index INTEGER PRIMARY KEY,
+			timestamp INTEGER,
+			is_precert INTEGER,
+			serial TEXT,
+			issuer TEXT,
+			not_before INTEGER,
+			not_after INTEGER,
+			dns_names TEXT
+		);
+		CREATE TABLE IF NOT EXISTS names (
+			name TEXT,
+			leaf_index INTEGER,
+			PRIMARY KEY (name, leaf_index)
+		) WITHOUT ROWID;
+		CREATE TABLE IF NOT EXISTS state (
+			id INTEGER PRIMARY KEY CHECK (id = 0),
+			tree_size INTEGER,
+			root_hash BLOB,
+			next_index INTEGER
+		);`); err != nil {
+		write.Close()
+		return nil, err
+	}
+	if err := sqlitex.Exec(write, `INSERT OR IGNORE INTO state (id, tree_size, root_hash, next_index)
+		VALUES (0, 0, NULL, ?)`, nil, from); err != nil {
+		write.Close()
+		return nil, err
+	}
+	read, err := sqlite.OpenConn(path, 0)
+	if err != nil {
+		write.Close()
+		return nil, err
+	}
+	return &domainIndex{write: write, read: read}, nil
+}
+
+func (ix *domainIndex) close() {
+	ix.write.Close()
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.read.Close()
+	ix.read = nil
+}
+
+// state returns the last verified tree, the empty tree if none, and the index
+// of the next entry to add.
+func (ix *domainIndex) state() (tree tlog.Tree, next int64, err error) {
+	err = sqlitex.Exec(ix.write, "SELECT tree_size, root_hash, next_index FROM state WHERE id = 0",
+		func(stmt *sqlite.Stmt) error {
+			tree.N = stmt.GetInt64("tree_size")
+			stmt.GetBytes("root_hash", tree.Hash[:])
+			next = stmt.GetInt64("next_index")
+			return nil
+		})
+	return tree, next, err
+}
+
+// update adds the entries up to the latest checkpoint of the log to the index.
+func (ix *domainIndex) update(ctx context.Context, c *client.Client, logger *slog.Logger) error {
+	old, next, err := ix.state()
+	if err != nil {
+		return fmt.Errorf("failed to read index state: %w", err)
+	}
+	cp, err := c.Checkpoint(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch checkpoint: %w", err)
+	}
+	switch {
+	case cp.N < old.N:
+		return fmt.Errorf("checkpoint rolled back: size %d is smaller than %d", cp.N, old.N)
+	case cp.N == old.N && old.N > 0 && cp.Hash != old.Hash:
+		return fmt.Errorf("checkpoint forked: size %d has hash %v, expected %v", cp.N, cp.Hash, old.Hash)
+	case cp.N == old.N:
+		return nil
+	case next > cp.N:
+		// The -from entry is not in the log yet.
+		return nil
+	}
+	if old.N > 0 {
+		proof, err := c.ConsistencyProof(ctx, cp.Tree, old.N)
+		if err != nil {
+			return err
+		}
+		if err := tlog.CheckTree(proof, cp.N, cp.Hash, old.N, old.Hash); err != nil {
+			return fmt.Errorf("checkpoint is inconsistent with previous: %w", err)
+		}
+	}
+
+	start := time.Now()
+	var batch []*client.Entry
+	var names int
+	for e, err := range c.Entries(ctx, cp.Tree, next) {
+		if err != nil {
+			return err
+		}
+		batch = append(batch, e)
+		if len(batch) == indexBatchSize {
+			n, err := ix.add(batch, nil, logger)
+			if err != nil {
+				return err
+			}
+			names += n
+			batch = batch[:0]
+		}
+	}
+	n, err := ix.add(batch, &cp.Tree, logger)
+	if err != nil {
+		return err
+	}
+	names += n
+	logger.Info("indexed entries", "start", next, "tree_size", cp.N,
+		"names", names, "elapsed", time.Since(start))
+	return nil
+}
+
+// add adds entries to the index in a single transaction, and updates the next
+// index. If tree is not nil, it's stored as the last verified tree.
+func (ix *domainIndex) add(entries []*client.Entry, tree *tlog.Tree, logger *slog.Logger) (names int, err error) {
+	defer sqlitex.Save(ix.write)(&err)
+	for _, e := range entries {
+		cert, err := parseIndexEntry(e)
+		if err != nil {
+			logger.Warn("failed to parse entry", "leaf_index", e.LeafIndex, "err", err)
+			continue
+		}
+		dnsNames := certificateNames(cert)
+		if err := sqlitex.Exec(ix.write, `INSERT OR REPLACE INTO entries (leaf_index, timestamp,
+			is_precert, serial, issuer, not_before, not_after, dns_names) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, nil,
+			e.LeafIndex, e.Timestamp, e.IsPrecert, hex.EncodeToString(cert.SerialNumber.Bytes()),
+			cert.Issuer.String(), cert.NotBefore.UnixMilli(), cert.NotAfter.UnixMilli(),
+			strings.Join(dnsNames, "\n")); err != nil {
+			return names, err
+		}
+		for _, name := range dnsNames {
+			if err := sqlitex.Exec(ix.write, "INSERT OR IGNORE INTO names (name, leaf_index) VALUES (?, ?)",
+				nil, reverseDomain(name), e.LeafIndex); err != nil {
+				return names, err
+			}
+			names++
+		}
+	}
+	if len(entries) > 0 {
+		if err := sqlitex.Exec(ix.write, "UPDATE state SET next_index = ? WHERE id = 0",
+			nil, entries[len(entries)-1].LeafIndex+1); err != nil {
+			return names, err
+		}
+	}
+	if tree != nil {
+		if err := sqlitex.Exec(ix.write, "UPDATE state SET tree_size = ?, root_hash = ? WHERE id = 0",
+			nil, tree.N, tree.Hash[:]); err != nil {
+			return names, err
+		}
+	}
+	return names, nil
+}
+
+// parseIndexEntry parses the certificate, or the precertificate TBSCertificate,
+// of e. Non-fatal parsing errors are ignored, as CAs log all sorts of things.
+func parseIndexEntry(e *client.Entry) (*x509.Certificate, error) {
+	var cert *x509.Certificate
+	var err error
+	if e.IsPrecert {
+		cert, err = x509.ParseTBSCertificate(e.Certificate)
+	} else {
+		cert, err = x509.ParseCertificate(e.Certificate)
+	}
+	if x509.IsFatal(err) {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// certificateNames returns the normalized DNS names of cert, from its SANs and
+// from its Subject Common Name if it looks like a DNS name.
+func certificateNames(cert *x509.Certificate) []string {
+	var names []string
+	for _, name := range append(cert.DNSNames, cert.Subject.CommonName) {
+		name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+		if !strings.Contains(name, ".") || strings.ContainsAny(name, " /:@") {
+			continue
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// reverseDomain reverses the labels of a DNS name, turning "*.example.com"
+// into "com.example.*". A trailing dot, for a fully qualified name, is dropped.
+func reverseDomain(name string) string {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	slices.Reverse(labels)
+	return strings.Join(labels, ".")
+}
+
+// indexResult is an entry returned by the search endpoint of "sunlight index".
+type indexResult struct {
+	LeafIndex int64     `json:"leaf_index"`
+	Timestamp int64     `json:"timestamp"`
+	IsPrecert bool      `json:"is_precert"`
+	Serial    string    `json:"serial"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	DNSNames  []string  `json:"dns_names"`
+}
+
+type indexResponse struct {
+	// IndexedSize is the size of the last verified tree the index is complete
+	// up to.
+	IndexedSize int64         `json:"indexed_size"`
+	Results     []indexResult `json:"results"`
+
+	// Next is set if there might be more results, and is the value of the
+	// after parameter of the next page.
+	Next *int64 `json:"next,omitempty"`
+}
+
+func (ix *domainIndex) serveSearch(rw http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q"))), ".")
+	if q == "" {
+		http.Error(rw, "missing q parameter", http.StatusBadRequest)
+		return
+	}
+	subdomains := r.URL.Query().Get("subdomains") == "true"
+	limit, after := defaultIndexSearchLimit, int64(-1)
+	if s := r.URL.Query().Get("limit"); s != "" {
+		l, err := strconv.Atoi(s)
+		if err != nil || l <= 0 || l > maxIndexSearchLimit {
+			http.Error(rw, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+	if s := r.URL.Query().Get("after"); s != "" {
+		a, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(rw, "invalid after parameter", http.StatusBadRequest)
+			return
+		}
+		after = a
+	}
+
+	res, err := ix.search(q, subdomains, after, limit)
+	if err != nil {
+		http.Error(rw, "search failed", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(res)
+}
+
+// search returns up to limit entries after the leaf index after that include
+// the DNS name domain, or with subdomains true any of its subdomains.
+func (ix *domainIndex) search(domain string, subdomains bool, after int64, limit int) (*indexResponse, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.read == nil {
+		return nil, errors.New("index is closed")
+	}
+	res := &indexResponse{Results: []indexResult{}}
+	if err := sqlitex.Exec(ix.read, "SELECT tree_size FROM state WHERE id = 0", func(stmt *sqlite.Stmt) error {
+		res.IndexedSize = stmt.GetInt64("tree_size")
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Subdomains sort between "com.example." and "com.example/", since '/' is
+	// the character after '.'.
+	rev := reverseDomain(domain)
+	lo, hi := rev, rev
+	if subdomains {
+		lo, hi = rev+".", rev+"/"
+	}
+	err := sqlitex.Exec(ix.read, `SELECT leaf_index, timestamp, is_precert, serial, issuer,
+		not_before, not_after, dns_names FROM entries WHERE leaf_index IN (
+			SELECT leaf_index FROM names WHERE name = ? OR (? AND name >= ? AND name < ?)
+		) AND leaf_index > ? ORDER BY leaf_index LIMIT ?`, func(stmt *sqlite.Stmt) error {
+		var names []string
+		if s := stmt.GetText("dns_names"); s != "" {
+			names = strings.Split(s, "\n")
+		}
+		res.Results = append(res.Results, indexResult{
+			LeafIndex: stmt.GetInt64("leaf_index"),
+			Timestamp: stmt.GetInt64("timestamp"),
+			IsPrecert: stmt.GetInt64("is_precert") != 0,
+			Serial:    stmt.GetText("serial"),
+			Issuer:    stmt.GetText("issuer"),
+			NotBefore: time.UnixMilli(stmt.GetInt64("not_before")).UTC(),
+			NotAfter:  time.UnixMilli(stmt.GetInt64("not_after")).UTC(),
+			DNSNames:  names,
+		})
+		return nil
+	}, rev, subdomains, lo, hi, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Results) == limit {
+		next := res.Results[len(res.Results)-1].LeafIndex
+		res.Next = &next
+	}
+	return res, nil
+}
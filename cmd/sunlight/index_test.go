@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+func TestReverseDomain(t *testing.T) {
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"example.com", "com.example"},
+		{"www.example.com", "com.example.www"},
+		{"example.com.", "com.example"},
+		{"*.example.com", "com.example.*"},
+		{"*.example.com.", "com.example.*"},
+		{"localhost", "localhost"},
+		{"localhost.", "localhost"},
+		{"", ""},
+	} {
+		if got := reverseDomain(tc.name); got != tc.want {
+			t.Errorf("reverseDomain(%q) = %q, expected %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// indexCount returns the result of a COUNT query on the index.
+func indexCount(t *testing.T, ix *domainIndex, query string) int64 {
+	var n int64
+	fatalIfErr(t, sqlitex.Exec(ix.write, query, func(stmt *sqlite.Stmt) error {
+		n = stmt.ColumnInt64(0)
+		return nil
+	}))
+	return n
+}
+
+func searchIndexes(t *testing.T, ix *domainIndex, domain string, subdomains bool) []int64 {
+	t.Helper()
+	res, err := ix.search(domain, subdomains, -1, maxIndexSearchLimit)
+	fatalIfErr(t, err)
+	var indexes []int64
+	for _, r := range res.Results {
+		indexes = append(indexes, r.LeafIndex)
+	}
+	return indexes
+}
+
+func TestDomainIndex(t *testing.T) {
+	tl := newTestLog(t)
+	ctx := context.Background()
+	tl.add(t, false, "example.com")                          // 0
+	tl.add(t, true, "www.example.com")                       // 1
+	tl.add(t, false, "badexample.com")                       // 2
+	tl.add(t, true, "*.example.com", "example.com")          // 3
+	tl.add(t, false, "a.b.example.com")                      // 4
+	tl.add(t, false, "example.com.evil.net", "EXAMPLE.org.") // 5
+	tl.add(t, false, "example-shop.com")                     // 6
+	tl.add(t, false, "localhost", "com")                     // 7
+
+	ix, err := openDomainIndex(filepath.Join(t.TempDir(), "index.db"), 0)
+	fatalIfErr(t, err)
+	defer ix.close()
+	fatalIfErr(t, ix.update(ctx, tl.Client, discardLogger()))
+
+	for _, tc := range []struct {
+		domain     string
+		subdomains bool
+		want       []int64
+	}{
+		{"example.com", false, []int64{0, 3}},
+		{"example.com", true, []int64{0, 1, 3, 4}},
+		{"www.example.com", false, []int64{1}},
+		{"b.example.com", true, []int64{4}},
+		{"*.example.com", false, []int64{3}},
+		{"badexample.com", true, []int64{2}},
+		{"example.org", false, []int64{5}},
+		{"evil.net", true, []int64{5}},
+		{"com", false, nil},
+		{"localhost", false, nil},
+		{"example.net", true, nil},
+	} {
+		if got := searchIndexes(t, ix, tc.domain, tc.subdomains); !slices.Equal(got, tc.want) {
+			t.Errorf("search(%q, subdomains=%v) = %v, expected %v", tc.domain, tc.subdomains, got, tc.want)
+		}
+	}
+
+	res, err := ix.search("example.com", true, -1, maxIndexSearchLimit)
+	fatalIfErr(t, err)
+	entries, err := tl.Entries(ctx)
+	fatalIfErr(t, err)
+	if res.IndexedSize != int64(len(entries)) {
+		t.Errorf("got indexed size %d, expected %d", res.IndexedSize, len(entries))
+	}
+	for _, r := range res.Results {
+		e := entries[r.LeafIndex]
+		if r.IsPrecert != e.IsPrecert || r.Timestamp != e.Timestamp {
+			t.Errorf("entry %d: got precert %v and timestamp %d, expected %v and %d",
+				r.LeafIndex, r.IsPrecert, r.Timestamp, e.IsPrecert, e.Timestamp)
+		}
+		if r.Serial == "" || !strings.Contains(r.Issuer, "Test Intermediate") || !r.NotBefore.Before(r.NotAfter) {
+			t.Errorf("entry %d: incomplete result %+v", r.LeafIndex, r)
+		}
+	}
+	if names := res.Results[2].DNSNames; !slices.Equal(names, []string{"*.example.com", "example.com"}) {
+		t.Errorf("got names %q for entry 3", names)
+	}
+
+	// Pages are requested with the next index of the previous one.
+	var pages [][]int64
+	after := int64(-1)
+	for {
+		res, err := ix.search("example.com", true, after, 3)
+		fatalIfErr(t, err)
+		var page []int64
+		for _, r := range res.Results {
+			page = append(page, r.LeafIndex)
+		}
+		pages = append(pages, page)
+		if res.Next == nil {
+			break
+		}
+		after = *res.Next
+	}
+	if !slices.EqualFunc(pages, [][]int64{{0, 1, 3}, {4}}, slices.Equal) {
+		t.Errorf("got pages %v", pages)
+	}
+}
+
+func TestDomainIndexResume(t *testing.T) {
+	tl := newTestLog(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index.db")
+	for range 3 {
+		tl.add(t, false, "example.com")
+	}
+
+	ix, err := openDomainIndex(path, 0)
+	fatalIfErr(t, err)
+	fatalIfErr(t, ix.update(ctx, tl.Client, discardLogger()))
+	// Updating again without new entries is a no-op.
+	fatalIfErr(t, ix.update(ctx, tl.Client, discardLogger()))
+	ix.close()
+
+	tl.add(t, true, "example.com")
+	tl.add(t, false, "www.example.com")
+
+	// The index resumes from the stored state, and -from is ignored.
+	ix, err = openDomainIndex(path, 100)
+	fatalIfErr(t, err)
+	defer ix.close()
+	tree, next, err := ix.state()
+	fatalIfErr(t, err)
+	if tree.N != 3 || next != 3 {
+		t.Fatalf("got stored tree size %d and next index %d, expected 3", tree.N, next)
+	}
+	fatalIfErr(t, ix.update(ctx, tl.Client, discardLogger()))
+
+	if n := indexCount(t, ix, "SELECT COUNT(*) FROM entries"); n != 5 {
+		t.Errorf("got %d entries rows, expected 5", n)
+	}
+	if n := indexCount(t, ix, "SELECT COUNT(*) FROM names"); n != 5 {
+		t.Errorf("got %d names rows, expected 5", n)
+	}
+	if got := searchIndexes(t, ix, "example.com", true); !slices.Equal(got, []int64{0, 1, 2, 3, 4}) {
+		t.Errorf("got %v after resuming, expected each entry once", got)
+	}
+	tree, next, err = ix.state()
+	fatalIfErr(t, err)
+	cp, err := tl.Checkpoint(ctx)
+	fatalIfErr(t, err)
+	if tree != cp.Tree || next != 5 {
+		t.Errorf("got stored tree %v and next index %d, expected %v and 5", tree, next, cp.Tree)
+	}
+
+	// A checkpoint that doesn't match the stored tree is not indexed.
+	fatalIfErr(t, sqlitex.Exec(ix.write, "UPDATE state SET root_hash = ? WHERE id = 0", nil, make([]byte, 32)))
+	if err := ix.update(ctx, tl.Client, discardLogger()); err == nil || !strings.Contains(err.Error(), "forked") {
+		t.Errorf("got error %v for a checkpoint forked from the stored tree", err)
+	}
+}
+
+func TestDomainIndexFrom(t *testing.T) {
+	tl := newTestLog(t)
+	ctx := context.Background()
+	for range 4 {
+		tl.add(t, false, "example.com")
+	}
+	ix, err := openDomainIndex(filepath.Join(t.TempDir(), "index.db"), 2)
+	fatalIfErr(t, err)
+	defer ix.close()
+	fatalIfErr(t, ix.update(ctx, tl.Client, discardLogger()))
+	if got := searchIndexes(t, ix, "example.com", false); !slices.Equal(got, []int64{2, 3}) {
+		t.Errorf("got %v, expected the entries starting at -from", got)
+	}
+
+	// If -from is past the end of the log, nothing is indexed yet.
+	ix, err = openDomainIndex(filepath.Join(t.TempDir(), "index.db"), 10)
+	fatalIfErr(t, err)
+	defer ix.close()
+	fatalIfErr(t, ix.update(ctx, tl.Client, discardLogger()))
+	if tree, next, _ := ix.state(); tree.N != 0 || next != 10 {
+		t.Errorf("got stored tree size %d and next index %d, expected 0 and 10", tree.N, next)
+	}
+}
+
+func TestIndexServeSearch(t *testing.T) {
+	tl := newTestLog(t)
+	tl.add(t, false, "www.example.com")
+	tl.add(t, true, "example.com")
+	ix, err := openDomainIndex(filepath.Join(t.TempDir(), "index.db"), 0)
+	fatalIfErr(t, err)
+	defer ix.close()
+	fatalIfErr(t, ix.update(context.Background(), tl.Client, discardLogger()))
+
+	for _, tc := range []struct {
+		query  string
+		status int
+		want   []int64
+	}{
+		{"q=Example.COM.", http.StatusOK, []int64{1}},
+		{"q=example.com&subdomains=true", http.StatusOK, []int64{0, 1}},
+		{"q=example.com&subdomains=true&after=0", http.StatusOK, []int64{1}},
+		{"q=example.net", http.StatusOK, []int64{}},
+		{"q=", http.StatusBadRequest, nil},
+		{"q=example.com&limit=0", http.StatusBadRequest, nil},
+		{"q=example.com&limit=1001", http.StatusBadRequest, nil},
+		{"q=example.com&after=first", http.StatusBadRequest, nil},
+	} {
+		rec := httptest.NewRecorder()
+		ix.serveSearch(rec, httptest.NewRequest("GET", "/search?"+tc.query, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s: got status %d, expected %d", tc.query, rec.Code, tc.status)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		var res indexResponse
+		fatalIfErr(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		got := []int64{}
+		for _, r := range res.Results {
+			got = append(got, r.LeafIndex)
+		}
+		if !slices.Equal(got, tc.want) || res.Next != nil || res.IndexedSize != 2 {
+			t.Errorf("%s: got %v with next %v and size %d, expected %v", tc.query, got, res.Next, res.IndexedSize, tc.want)
+		}
+	}
+}
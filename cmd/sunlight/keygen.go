@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/term"
+)
+
+type recipientsFlag []string
+
+func (r *recipientsFlag) String() string     { return fmt.Sprint(*r) }
+func (r *recipientsFlag) Set(v string) error { *r = append(*r, v); return nil }
+
+// keygen implements the "sunlight keygen" command, which generates the ECDSA
+// P-256 log key and an Ed25519 witness (note) key for a new log, and prints
+// the values needed for the config file and for log list submission.
+func keygen(args []string) {
+	fs := flag.NewFlagSet("sunlight keygen", flag.ExitOnError)
+	nameFlag := fs.String("name", "", "log name, used as the checkpoint origin (required)")
+	fileFlag := fs.String("f", "key.pem", "path to write the log key to")
+	witnessFileFlag := fs.String("witness-f", "witness.key", "path to write the Ed25519 witness key to, or empty to skip it")
+	encryptFlag := fs.Bool("encrypt", false, "encrypt the keys with a passphrase")
+	var recipients recipientsFlag
+	fs.Var(&recipients, "r", "encrypt the keys to this age recipient (can be repeated)")
+	fs.Parse(args)
+
+	if *nameFlag == "" {
+		log.Fatal("-name is required")
+	}
+
+	var ageRecipients []age.Recipient
+	switch {
+	case *encryptFlag && len(recipients) > 0:
+		log.Fatal("only one of -encrypt and -r can be used")
+	case *encryptFlag:
+		passphrase, err := readNewPassphrase()
+		if err != nil {
+			log.Fatal(err)
+		}
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ageRecipients = append(ageRecipients, r)
+	default:
+		for _, s := range recipients {
+			r, err := age.ParseX25519Recipient(s)
+			if err != nil {
+				log.Fatalf("failed to parse recipient %q: %v", s, err)
+			}
+			ageRecipients = append(ageRecipients, r)
+		}
+	}
+
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := writeKeyFile(*fileFlag, keyPEM, ageRecipients); err != nil {
+		log.Fatal(err)
+	}
+
+	var witnessVKey string
+	if *witnessFileFlag != "" {
+		skey, vkey, err := note.GenerateKey(rand.Reader, *nameFlag)
+		if err != nil {
+			log.Fatalf("failed to generate witness key: %v", err)
+		}
+		if err := writeKeyFile(*witnessFileFlag, []byte(skey+"\n"), ageRecipients); err != nil {
+			log.Fatal(err)
+		}
+		witnessVKey = vkey
+	}
+
+	spki, err := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logID := sha256.Sum256(spki)
+	fmt.Printf("Checkpoint origin: %s\n", *nameFlag)
+	fmt.Printf("Log ID: %s\n", base64.StdEncoding.EncodeToString(logID[:]))
+	fmt.Printf("PublicKey: %s\n", base64.StdEncoding.EncodeToString(spki))
+	if witnessVKey != "" {
+		fmt.Printf("Witness verifier key: %s\n", witnessVKey)
+	}
+	fmt.Println()
+	fmt.Println("Log list entry:")
+	fmt.Printf("  \"log_id\": %q,\n", base64.StdEncoding.EncodeToString(logID[:]))
+	fmt.Printf("  \"key\": %q,\n", base64.StdEncoding.EncodeToString(spki))
+}
+
+// writeKeyFile writes a new key file with mode 0600, failing if it already
+// exists, encrypting it to recipients if any.
+func writeKeyFile(path string, key []byte, recipients []age.Recipient) error {
+	if len(recipients) > 0 {
+		var err error
+		key, err = encrypt(key, recipients)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", path, err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func encrypt(plaintext []byte, recipients []age.Recipient) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	a := armor.NewWriter(buf)
+	w, err := age.Encrypt(a, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := a.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readNewPassphrase reads a passphrase from the SUNLIGHT_KEY_PASSPHRASE
+// environment variable or, asking for confirmation, from the terminal.
+func readNewPassphrase() (string, error) {
+	if p := os.Getenv(keyPassphraseEnv); p != "" {
+		return p, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("%s is not set and stdin is not a terminal", keyPassphraseEnv)
+	}
+	read := func(prompt string) ([]byte, error) {
+		fmt.Fprint(os.Stderr, prompt)
+		defer fmt.Fprintln(os.Stderr)
+		return term.ReadPassword(int(os.Stdin.Fd()))
+	}
+	p, err := read("Enter passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	confirm, err := read("Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(p, confirm) {
+		return "", fmt.Errorf("passphrases didn't match")
+	}
+	if len(p) == 0 {
+		return "", fmt.Errorf("empty passphrase")
+	}
+	return string(p), nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/term"
+)
+
+// keyPassphraseEnv is the environment variable that can hold the passphrase of
+// an encrypted Key, if no KeyPassphraseFile or KeyIdentityFile is configured.
+const keyPassphraseEnv = "SUNLIGHT_KEY_PASSPHRASE"
+
+// loadKey reads a PKCS#8 PEM ECDSA private key from path. If the file is
+// age-encrypted (armored or not), it's decrypted with the age identities in
+// identityFile, or otherwise with a passphrase read from passphraseFile, from
+// the SUNLIGHT_KEY_PASSPHRASE environment variable, or from the terminal.
+func loadKey(path, identityFile, passphraseFile string) (*ecdsa.PrivateKey, error) {
+	keyPEM, err := readKeyFile(path, identityFile, passphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("failed to parse key PEM")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+	ek, ok := k.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an ECDSA private key")
+	}
+	return ek, nil
+}
+
+// loadNoteSigner reads a note signer key, such as the witness key generated by
+// sunlight keygen, from path. It's decrypted like in loadKey.
+func loadNoteSigner(path, identityFile, passphraseFile string) (note.Signer, error) {
+	skey, err := readKeyFile(path, identityFile, passphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	s, err := note.NewSigner(strings.TrimSpace(string(skey)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse note signer key: %w", err)
+	}
+	return s, nil
+}
+
+// readKeyFile reads path and decrypts it if it's age-encrypted.
+func readKeyFile(path, identityFile, passphraseFile string) ([]byte, error) {
+	b, err := readSecretFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isAgeEncrypted(b) {
+		return decryptKey(path, b, identityFile, passphraseFile)
+	}
+	return b, nil
+}
+
+func isAgeEncrypted(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("age-encryption.org/v1\n")) ||
+		bytes.HasPrefix(bytes.TrimSpace(b), []byte(armor.Header))
+}
+
+func decryptKey(path string, ciphertext []byte, identityFile, passphraseFile string) ([]byte, error) {
+	var identities []age.Identity
+	switch {
+	case identityFile != "":
+		b, err := readSecretFile(identityFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key identity file: %w", err)
+		}
+		identities, err = age.ParseIdentities(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key identity file: %w", err)
+		}
+	default:
+		passphrase, err := keyPassphrase(path, passphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		id, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identities = []age.Identity{id}
+	}
+
+	var r io.Reader = bytes.NewReader(ciphertext)
+	if !bytes.HasPrefix(ciphertext, []byte("age-encryption.org/v1\n")) {
+		r = armor.NewReader(bytes.NewReader(bytes.TrimSpace(ciphertext)))
+	}
+	r, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+	return io.ReadAll(r)
+}
+
+func keyPassphrase(path, passphraseFile string) (string, error) {
+	if passphraseFile != "" {
+		b, err := readSecretFile(passphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read key passphrase file: %w", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	if p := os.Getenv(keyPassphraseEnv); p != "" {
+		return p, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("key is encrypted, but no passphrase was provided and stdin is not a terminal")
+	}
+	fmt.Fprintf(os.Stderr, "Enter passphrase for %s: ", path)
+	p, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key passphrase: %w", err)
+	}
+	return string(p), nil
+}
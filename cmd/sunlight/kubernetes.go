@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KubernetesConfig configures the integration with Kubernetes, for running
+// Sunlight as a Deployment with a hot standby replica.
+type KubernetesConfig struct {
+	// ProbesListen is the address of a server for the kubelet probes, such as
+	// ":8081", which is started before the logs are loaded. Optional.
+	//
+	// /livez always succeeds, and is meant for the startup and liveness
+	// probes, since a standby replica waiting for the Lease is healthy.
+	// /readyz succeeds only while this replica holds the Lease (if
+	// configured) and is serving the logs, so that the Service only routes
+	// to the active replica, and fails as soon as shutdown starts.
+	ProbesListen string
+
+	// Lease enables leader election with a coordination.k8s.io/v1 Lease, using
+	// the in-cluster service account credentials, which need get, create,
+	// and update permissions on leases. Only the replica holding the Lease
+	// loads the logs and runs the sequencers; the others wait to take over.
+	//
+	// The Lease is only a trigger: the checkpoint lock backend still ensures
+	// that two instances can't both extend a log, even in case of clock
+	// skew or network partitions. A replica that fails to renew the Lease
+	// stops sequencing and exits, to be restarted as a standby.
+	Lease struct {
+		// Name is the name of the Lease object. It's created if missing.
+		Name string
+
+		// Namespace is the namespace of the Lease. Optional. Defaults to the
+		// namespace of the service account.
+		Namespace string
+
+		// Identity is the holder identity of this replica. Optional. Defaults
+		// to the hostname, which is the Pod name.
+		Identity string
+
+		// Duration is how long a Lease that is not renewed stays valid for the
+		// standby, as a Go duration string. Optional. Defaults to 15s.
+		Duration string
+
+		// RenewDeadline is how long the leader keeps trying to renew the Lease
+		// before it gives up and stops, as a Go duration string. It must be
+		// shorter than Duration. Optional. Defaults to 10s.
+		RenewDeadline string
+
+		// RetryPeriod is how often the Lease is renewed, or checked by the
+		// standby, as a Go duration string. Optional. Defaults to 2s.
+		RetryPeriod string
+	}
+}
+
+const (
+	defaultLeaseDuration      = 15 * time.Second
+	defaultLeaseRenewDeadline = 10 * time.Second
+	defaultLeaseRetryPeriod   = 2 * time.Second
+)
+
+// serviceAccountDir holds the in-cluster credentials mounted in each Pod.
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// probes serves the kubelet probe endpoints.
+type probes struct {
+	ready atomic.Bool
+}
+
+func (p *probes) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /livez", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !p.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// leaseElector implements leader election with a Kubernetes Lease, following
+// the same algorithm as client-go's leaderelection package: the Lease is
+// considered expired if its holder didn't renew it within the lease duration,
+// as measured by the local clock since the record was last seen to change.
+type leaseElector struct {
+	api       string // API server URL
+	client    *http.Client
+	path      string // Lease object path
+	namespace string
+	name      string
+	identity  string
+
+	duration, renewDeadline, retryPeriod time.Duration
+
+	logger *slog.Logger
+
+	// now is time.Now, except in tests.
+	now func() time.Time
+
+	// mu protects the fields below, since Release can race with Hold.
+	mu           sync.Mutex
+	observed     leaseSpec
+	observedTime time.Time
+	lease        *lease // latest object read or written
+}
+
+type lease struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   map[string]any `json:"metadata"`
+	Spec       leaseSpec      `json:"spec"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// microTime is the format of Kubernetes MicroTime fields.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// leaseTimings parses the Lease.Duration, Lease.RenewDeadline, and
+// Lease.RetryPeriod settings of Kubernetes or Region, with defaults.
+func leaseTimings(durationS, renewDeadlineS, retryPeriodS string) (duration, renewDeadline, retryPeriod time.Duration, err error) {
+	duration, renewDeadline, retryPeriod = defaultLeaseDuration, defaultLeaseRenewDeadline, defaultLeaseRetryPeriod
+	for _, d := range []struct {
+		name string
+		s    string
+		d    *time.Duration
+	}{
+		{"Duration", durationS, &duration},
+		{"RenewDeadline", renewDeadlineS, &renewDeadline},
+		{"RetryPeriod", retryPeriodS, &retryPeriod},
+	} {
+		if d.s == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.s)
+		if err != nil || v <= 0 {
+			return 0, 0, 0, fmt.Errorf("invalid Lease.%s %q", d.name, d.s)
+		}
+		*d.d = v
+	}
+	if renewDeadline >= duration || retryPeriod >= renewDeadline {
+		return 0, 0, 0, errors.New("Lease.RetryPeriod must be shorter than RenewDeadline, which must be shorter than Duration")
+	}
+	if duration < time.Second {
+		return 0, 0, 0, errors.New("Lease.Duration must be at least 1s")
+	}
+	return duration, renewDeadline, retryPeriod, nil
+}
+
+func newLeaseElector(kc *KubernetesConfig, logger *slog.Logger) (*leaseElector, error) {
+	e := &leaseElector{
+		name:      kc.Lease.Name,
+		namespace: kc.Lease.Namespace,
+		identity:  kc.Lease.Identity,
+		logger:    logger,
+		now:       time.Now,
+	}
+	var err error
+	e.duration, e.renewDeadline, e.retryPeriod, err = leaseTimings(kc.Lease.Duration, kc.Lease.RenewDeadline, kc.Lease.RetryPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST is not set")
+	}
+	e.api = "https://" + net.JoinHostPort(host, port)
+	ca, err := os.ReadFile(serviceAccountDir + "ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates found in service account CA")
+	}
+	e.client = &http.Client{
+		Timeout:   e.retryPeriod,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	if e.namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account namespace: %w", err)
+		}
+		e.namespace = strings.TrimSpace(string(ns))
+	}
+	if e.identity == "" {
+		if e.identity, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get hostname for Lease identity: %w", err)
+		}
+	}
+	e.path = "/apis/coordination.k8s.io/v1/namespaces/" + e.namespace + "/leases/" + e.name
+	return e, nil
+}
+
+// Acquire blocks until the Lease is acquired or ctx is canceled.
+func (e *leaseElector) Acquire(ctx context.Context) error {
+	e.logger.Info("waiting to acquire Kubernetes lease", "lease", e.namespace+"/"+e.name, "identity", e.identity)
+	var lastHolder string
+	for {
+		ok, holder, err := e.tryAcquireOrRenew(ctx)
+		switch {
+		case err != nil:
+			e.logger.Warn("failed to acquire Kubernetes lease", "err", err)
+		case ok:
+			e.logger.Info("acquired Kubernetes lease", "lease", e.namespace+"/"+e.name)
+			return nil
+		case holder != lastHolder:
+			lastHolder = holder
+			e.logger.Info("Kubernetes lease is held by another replica", "holder", holder)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.retryPeriod):
+		}
+	}
+}
+
+// Hold renews the Lease every RetryPeriod until ctx is canceled, and calls
+// lost if it can't be renewed for RenewDeadline.
+func (e *leaseElector) Hold(ctx context.Context, lost func()) {
+	t := time.NewTicker(e.retryPeriod)
+	defer t.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		ok, holder, err := e.tryAcquireOrRenew(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if ok {
+			renewed = time.Now()
+			continue
+		}
+		if err == nil {
+			e.logger.Error("Kubernetes lease was taken by another replica", "holder", holder)
+			lost()
+			return
+		}
+		e.logger.Warn("failed to renew Kubernetes lease", "err", err)
+		if time.Since(renewed) > e.renewDeadline {
+			e.logger.Error("failed to renew Kubernetes lease before the deadline", "deadline", e.renewDeadline)
+			lost()
+			return
+		}
+	}
+}
+
+// Release gives up the Lease, if held, so that a standby can take over
+// without waiting for it to expire.
+func (e *leaseElector) Release(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lease == nil || e.lease.Spec.HolderIdentity != e.identity {
+		return
+	}
+	l := *e.lease
+	now := time.Now().Format(microTime)
+	l.Spec = leaseSpec{LeaseDurationSeconds: 1, AcquireTime: now, RenewTime: now,
+		LeaseTransitions: e.lease.Spec.LeaseTransitions}
+	if err := e.do(ctx, "PUT", e.path, &l, nil); err != nil {
+		e.logger.Warn("failed to release Kubernetes lease", "err", err)
+		return
+	}
+	e.logger.Info("released Kubernetes lease")
+}
+
+// tryAcquireOrRenew returns true if this replica holds the Lease after the
+// call. It returns false and no error if another replica, holder, holds it.
+func (e *leaseElector) tryAcquireOrRenew(ctx context.Context) (ok bool, holder string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ok, err = e.update(ctx)
+	return ok, e.observed.HolderIdentity, err
+}
+
+func (e *leaseElector) update(ctx context.Context) (bool, error) {
+	now := e.now()
+	spec := leaseSpec{
+		HolderIdentity:       e.identity,
+		LeaseDurationSeconds: int(e.duration / time.Second),
+		AcquireTime:          now.Format(microTime),
+		RenewTime:            now.Format(microTime),
+	}
+
+	current := &lease{}
+	err := e.do(ctx, "GET", e.path, nil, current)
+	if errors.Is(err, errLeaseNotFound) {
+		l := &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   map[string]any{"name": e.name, "namespace": e.namespace},
+			Spec:       spec,
+		}
+		created := &lease{}
+		err := e.do(ctx, "POST", "/apis/coordination.k8s.io/v1/namespaces/"+e.namespace+"/leases", l, created)
+		if errors.Is(err, errLeaseConflict) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		e.setObserved(created, now)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if current.Spec != e.observed {
+		e.observed, e.observedTime = current.Spec, now
+	}
+	e.lease = current
+	held := current.Spec.HolderIdentity == e.identity
+	if !held && current.Spec.HolderIdentity != "" {
+		d := time.Duration(current.Spec.LeaseDurationSeconds) * time.Second
+		if e.observedTime.Add(d).After(now) {
+			return false, nil
+		}
+	}
+	if held {
+		spec.AcquireTime = current.Spec.AcquireTime
+		spec.LeaseTransitions = current.Spec.LeaseTransitions
+	} else {
+		spec.LeaseTransitions = current.Spec.LeaseTransitions + 1
+	}
+
+	// The update carries the resourceVersion that was read, so it fails with
+	// a conflict if another replica updated the Lease in the meantime.
+	l := *current
+	l.Spec = spec
+	updated := &lease{}
+	err = e.do(ctx, "PUT", e.path, &l, updated)
+	if errors.Is(err, errLeaseConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	e.setObserved(updated, now)
+	return true, nil
+}
+
+func (e *leaseElector) setObserved(l *lease, now time.Time) {
+	e.lease, e.observed, e.observedTime = l, l.Spec, now
+}
+
+var (
+	errLeaseNotFound = errors.New("lease not found")
+	errLeaseConflict = errors.New("lease was modified concurrently")
+)
+
+func (e *leaseElector) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, e.api+path, body)
+	if err != nil {
+		return err
+	}
+	// The service account token is rotated by the kubelet, so it's read
+	// again for every request.
+	token, err := os.ReadFile(serviceAccountDir + "token")
+	if err != nil {
+		return fmt.Errorf("failed to read service account token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusNotFound:
+		return errLeaseNotFound
+	case http.StatusConflict:
+		return errLeaseConflict
+	default:
+		if len(b) > 200 {
+			b = b[:200]
+		}
+		return fmt.Errorf("%s %s: %s: %q", method, path, resp.Status, b)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
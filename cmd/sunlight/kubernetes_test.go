@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeaseAPI is a minimal coordination.k8s.io/v1 Lease API server, holding
+// at most one Lease.
+type fakeLeaseAPI struct {
+	mu      sync.Mutex
+	lease   *lease
+	version int
+
+	// fail, if not zero, is the status of all responses.
+	fail int
+	// beforeWrite, if not nil, is called with the lock held before applying
+	// a POST or PUT, to simulate a concurrent write by another replica.
+	beforeWrite func()
+}
+
+func (f *fakeLeaseAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if f.fail != 0 {
+		http.Error(w, "injected failure", f.fail)
+		return
+	}
+	const path = "/apis/coordination.k8s.io/v1/namespaces/test-ns/leases"
+	switch {
+	case r.Method == "GET" && r.URL.Path == path+"/test-lease":
+		if f.lease == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.lease)
+	case (r.Method == "POST" && r.URL.Path == path) ||
+		(r.Method == "PUT" && r.URL.Path == path+"/test-lease"):
+		l := &lease{}
+		if err := json.NewDecoder(r.Body).Decode(l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f.beforeWrite != nil {
+			f.beforeWrite()
+			f.beforeWrite = nil
+		}
+		if r.Method == "POST" && f.lease != nil {
+			http.Error(w, "already exists", http.StatusConflict)
+			return
+		}
+		if r.Method == "PUT" && (f.lease == nil ||
+			l.Metadata["resourceVersion"] != f.lease.Metadata["resourceVersion"]) {
+			http.Error(w, "conflict", http.StatusConflict)
+			return
+		}
+		f.setLocked(l)
+		json.NewEncoder(w).Encode(l)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func (f *fakeLeaseAPI) setLocked(l *lease) {
+	f.version++
+	if l.Metadata == nil {
+		l.Metadata = map[string]any{}
+	}
+	l.Metadata["resourceVersion"] = strconv.Itoa(f.version)
+	f.lease = l
+}
+
+// set replaces the Lease, as if another replica wrote it.
+func (f *fakeLeaseAPI) set(spec leaseSpec) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setLocked(&lease{Spec: spec})
+}
+
+func (f *fakeLeaseAPI) spec() leaseSpec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lease == nil {
+		return leaseSpec{}
+	}
+	return f.lease.Spec
+}
+
+func (f *fakeLeaseAPI) setFail(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = status
+}
+
+// newTestElector returns a leaseElector for identity, configured from the
+// environment and service account files like in a Pod, talking to api.
+func newTestElector(t *testing.T, api *fakeLeaseAPI, identity string) *leaseElector {
+	ts := httptest.NewTLSServer(api)
+	t.Cleanup(ts.Close)
+	host, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	fatalIfErr(t, err)
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	dir := t.TempDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	fatalIfErr(t, os.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0o644))
+	fatalIfErr(t, os.WriteFile(filepath.Join(dir, "namespace"), []byte("test-ns\n"), 0o644))
+	fatalIfErr(t, os.WriteFile(filepath.Join(dir, "token"), []byte("test-token\n"), 0o644))
+	old := serviceAccountDir
+	serviceAccountDir = dir + "/"
+	t.Cleanup(func() { serviceAccountDir = old })
+
+	kc := &KubernetesConfig{}
+	kc.Lease.Name = "test-lease"
+	kc.Lease.Identity = identity
+	kc.Lease.Duration = "15s"
+	kc.Lease.RenewDeadline = "100ms"
+	kc.Lease.RetryPeriod = "10ms"
+	e, err := newLeaseElector(kc, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	fatalIfErr(t, err)
+	// The request timeout is RetryPeriod, which is too short for a slow TLS
+	// handshake, and failures are injected by the fake API anyway.
+	e.client.Timeout = 0
+	return e
+}
+
+func TestLeaseElectorTakeover(t *testing.T) {
+	api := &fakeLeaseAPI{}
+	e := newTestElector(t, api, "standby")
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	api.set(leaseSpec{HolderIdentity: "leader", LeaseDurationSeconds: 15,
+		RenewTime: now.Format(microTime), LeaseTransitions: 3})
+	if ok, holder, err := e.tryAcquireOrRenew(ctx); ok || err != nil || holder != "leader" {
+		t.Fatalf("acquired a valid Lease: %v, %q, %v", ok, holder, err)
+	}
+
+	// The expiry is measured from when the Lease was observed to change, so
+	// a leader that renews keeps it.
+	now = now.Add(10 * time.Second)
+	api.set(leaseSpec{HolderIdentity: "leader", LeaseDurationSeconds: 15,
+		RenewTime: now.Format(microTime), LeaseTransitions: 3})
+	if ok, _, err := e.tryAcquireOrRenew(ctx); ok || err != nil {
+		t.Fatalf("acquired a renewed Lease: %v, %v", ok, err)
+	}
+	now = now.Add(10 * time.Second)
+	if ok, _, err := e.tryAcquireOrRenew(ctx); ok || err != nil {
+		t.Fatalf("acquired a Lease renewed 10s ago: %v, %v", ok, err)
+	}
+
+	now = now.Add(6 * time.Second)
+	if ok, holder, err := e.tryAcquireOrRenew(ctx); !ok || err != nil || holder != "standby" {
+		t.Fatalf("didn't take over an expired Lease: %v, %q, %v", ok, holder, err)
+	}
+	if spec := api.spec(); spec.HolderIdentity != "standby" || spec.LeaseTransitions != 4 {
+		t.Errorf("got Lease %+v after takeover", spec)
+	}
+
+	// Renewals keep the acquire time and the transitions count.
+	acquired := api.spec().AcquireTime
+	now = now.Add(time.Second)
+	if ok, _, err := e.tryAcquireOrRenew(ctx); !ok || err != nil {
+		t.Fatalf("failed to renew: %v, %v", ok, err)
+	}
+	if spec := api.spec(); spec.AcquireTime != acquired || spec.LeaseTransitions != 4 ||
+		spec.RenewTime != now.Format(microTime) {
+		t.Errorf("got Lease %+v after renewal", spec)
+	}
+
+	// Release lets another replica acquire it right away.
+	e.Release(ctx)
+	if spec := api.spec(); spec.HolderIdentity != "" {
+		t.Errorf("got Lease %+v after release", spec)
+	}
+	other := newTestElector(t, api, "other")
+	if ok, _, err := other.tryAcquireOrRenew(ctx); !ok || err != nil {
+		t.Fatalf("didn't acquire a released Lease: %v, %v", ok, err)
+	}
+	if spec := api.spec(); spec.HolderIdentity != "other" || spec.LeaseTransitions != 5 {
+		t.Errorf("got Lease %+v after acquiring a released Lease", spec)
+	}
+}
+
+func TestLeaseElectorCreate(t *testing.T) {
+	api := &fakeLeaseAPI{}
+	e := newTestElector(t, api, "leader")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	fatalIfErr(t, e.Acquire(ctx))
+	if spec := api.spec(); spec.HolderIdentity != "leader" || spec.LeaseDurationSeconds != 15 {
+		t.Errorf("got Lease %+v after creation", spec)
+	}
+
+	// A Lease created concurrently by another replica is a lost race.
+	api = &fakeLeaseAPI{}
+	e = newTestElector(t, api, "standby")
+	api.beforeWrite = func() {
+		api.setLocked(&lease{Spec: leaseSpec{HolderIdentity: "leader", LeaseDurationSeconds: 15}})
+	}
+	if ok, _, err := e.tryAcquireOrRenew(ctx); ok || err != nil {
+		t.Fatalf("got %v, %v on a conflicting create, expected false and no error", ok, err)
+	}
+	if spec := api.spec(); spec.HolderIdentity != "leader" {
+		t.Errorf("conflicting create overwrote the Lease: %+v", spec)
+	}
+}
+
+func TestLeaseElectorConflict(t *testing.T) {
+	api := &fakeLeaseAPI{}
+	e := newTestElector(t, api, "leader")
+	ctx := context.Background()
+	if ok, _, err := e.tryAcquireOrRenew(ctx); !ok || err != nil {
+		t.Fatalf("failed to acquire: %v, %v", ok, err)
+	}
+
+	// Another replica updates the Lease between the GET and the PUT.
+	api.beforeWrite = func() {
+		api.setLocked(&lease{Spec: leaseSpec{HolderIdentity: "other", LeaseDurationSeconds: 15}})
+	}
+	if ok, _, err := e.tryAcquireOrRenew(ctx); ok || err != nil {
+		t.Fatalf("got %v, %v on a conflicting update, expected false and no error", ok, err)
+	}
+	if spec := api.spec(); spec.HolderIdentity != "other" {
+		t.Errorf("conflicting update overwrote the Lease: %+v", spec)
+	}
+	if ok, holder, err := e.tryAcquireOrRenew(ctx); ok || err != nil || holder != "other" {
+		t.Errorf("got %v, %q, %v after the conflict, expected the Lease to be held by other", ok, holder, err)
+	}
+}
+
+func TestLeaseElectorHold(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		lose func(api *fakeLeaseAPI)
+	}{
+		{"FailedRenewals", func(api *fakeLeaseAPI) { api.setFail(http.StatusInternalServerError) }},
+		{"TakenOver", func(api *fakeLeaseAPI) {
+			api.set(leaseSpec{HolderIdentity: "other", LeaseDurationSeconds: 15})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			api := &fakeLeaseAPI{}
+			e := newTestElector(t, api, "leader")
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			fatalIfErr(t, e.Acquire(ctx))
+
+			lost := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				e.Hold(ctx, func() { close(lost) })
+			}()
+
+			// The Lease is renewed while the API works.
+			time.Sleep(50 * time.Millisecond)
+			select {
+			case <-lost:
+				t.Fatal("lost the Lease while renewals succeed")
+			default:
+			}
+			if spec := api.spec(); spec.HolderIdentity != "leader" {
+				t.Fatalf("got Lease %+v while holding", spec)
+			}
+
+			tc.lose(api)
+			select {
+			case <-lost:
+			case <-ctx.Done():
+				t.Fatal("lost was not called")
+			}
+			<-done
+		})
+	}
+}
+
+func fatalIfErr(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
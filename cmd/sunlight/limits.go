@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultReadTimeout and defaultWriteTimeout are the HTTP server timeouts, if
+// Limits.ReadTimeout and Limits.WriteTimeout are not set.
+const (
+	defaultReadTimeout  = 5 * time.Second
+	defaultWriteTimeout = 15 * time.Second
+)
+
+// setMemoryLimit applies Limits.MemoryLimit, unless GOMEMLIMIT is set.
+func setMemoryLimit(c *Config, logger *slog.Logger) error {
+	if c.Limits.MemoryLimit == "" {
+		return nil
+	}
+	if env := os.Getenv("GOMEMLIMIT"); env != "" {
+		logger.Info("GOMEMLIMIT is set, ignoring Limits.MemoryLimit", "GOMEMLIMIT", env)
+		return nil
+	}
+	n, err := parseMemoryLimit(c.Limits.MemoryLimit)
+	if err != nil {
+		return err
+	}
+	debug.SetMemoryLimit(n)
+	logger.Info("set memory limit", "bytes", n)
+	return nil
+}
+
+// parseMemoryLimit parses a size with the GOMEMLIMIT syntax: a number of
+// bytes, optionally followed by one of the B, KiB, MiB, GiB, or TiB suffixes.
+func parseMemoryLimit(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1},
+	}
+	num, size := s, int64(1)
+	for _, u := range units {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			num, size = n, u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 || n > (1<<63-1)/size {
+		return 0, fmt.Errorf("invalid memory limit %q", s)
+	}
+	return n * size, nil
+}
+
+// serverTimeouts returns the HTTP server timeouts from Limits. A zero idle
+// timeout makes net/http use the read timeout.
+func serverTimeouts(c *Config) (read, write, idle time.Duration, err error) {
+	read, write = defaultReadTimeout, defaultWriteTimeout
+	if c.Limits.ReadTimeout != "" {
+		if read, err = time.ParseDuration(c.Limits.ReadTimeout); err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to parse Limits.ReadTimeout: %w", err)
+		}
+	}
+	if c.Limits.WriteTimeout != "" {
+		if write, err = time.ParseDuration(c.Limits.WriteTimeout); err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to parse Limits.WriteTimeout: %w", err)
+		}
+	}
+	if c.Limits.IdleTimeout != "" {
+		if idle, err = time.ParseDuration(c.Limits.IdleTimeout); err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to parse Limits.IdleTimeout: %w", err)
+		}
+	}
+	return read, write, idle, nil
+}
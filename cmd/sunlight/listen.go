@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/netutil"
+)
+
+// ListenerConfig configures the sockets of a listener.
+type ListenerConfig struct {
+	// Network is "tcp", "tcp4", or "tcp6". Optional. Defaults to "tcp",
+	// which for an address without a specific IP, such as ":443", listens
+	// dual-stack on both IPv4 and IPv6 (unless the net.ipv6.bindv6only sysctl
+	// is set). "tcp6" listens only on IPv6, such as on the Fly.io private
+	// network, and "tcp4" only on IPv4. It's ignored for unix and systemd
+	// sockets.
+	Network string
+
+	// KeepAlive is the period of the TCP keep-alive probes of accepted
+	// connections, as a Go duration string, so that connections dropped by a
+	// NAT or proxy are detected. Optional. Defaults to 15s. A negative value,
+	// such as "-1s", disables keep-alives.
+	KeepAlive string
+
+	// FastOpen enables TCP Fast Open, which lets returning clients send data
+	// with the SYN. Optional. Linux only. It doesn't apply to systemd
+	// sockets, which can set FastOpen= in the socket unit instead.
+	FastOpen bool
+
+	// MaxConnections is the maximum number of open connections accepted by
+	// the listener. Further connections wait in the kernel accept queue.
+	// Optional. Defaults to no limit.
+	MaxConnections int
+}
+
+// defaultKeepAlive is the TCP keep-alive period if ListenerConfig.KeepAlive
+// is not set, which is also the Go default.
+const defaultKeepAlive = 15 * time.Second
+
+// fastOpenQueueLength is the TCP_FASTOPEN queue length, the maximum number of
+// pending Fast Open requests that haven't completed the handshake.
+const fastOpenQueueLength = 256
+
+// check validates the configuration, and returns the keep-alive period.
+func (lc *ListenerConfig) check() (time.Duration, error) {
+	switch lc.Network {
+	case "", "tcp", "tcp4", "tcp6":
+	default:
+		return 0, fmt.Errorf("invalid Network %q", lc.Network)
+	}
+	keepAlive := defaultKeepAlive
+	if lc.KeepAlive != "" {
+		d, err := time.ParseDuration(lc.KeepAlive)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse KeepAlive: %w", err)
+		}
+		keepAlive = d
+	}
+	if lc.FastOpen && setFastOpen == nil {
+		return 0, errors.New("FastOpen is only supported on Linux")
+	}
+	if lc.MaxConnections < 0 {
+		return 0, errors.New("MaxConnections can't be negative")
+	}
+	return keepAlive, nil
+}
+
+// wrap applies the keep-alive period and MaxConnections to the connections
+// accepted by ln, which might have been created by listen, passed by systemd,
+// or inherited from a binary upgrade.
+func (lc *ListenerConfig) wrap(ln net.Listener) (net.Listener, error) {
+	keepAlive, err := lc.check()
+	if err != nil {
+		return nil, err
+	}
+	ln = keepAliveListener{ln, keepAlive}
+	if lc.MaxConnections > 0 {
+		ln = netutil.LimitListener(ln, lc.MaxConnections)
+	}
+	return ln, nil
+}
+
+type keepAliveListener struct {
+	net.Listener
+	period time.Duration
+}
+
+func (ln keepAliveListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tc, ok := c.(*net.TCPConn); ok {
+		if ln.period < 0 {
+			tc.SetKeepAlive(false)
+		} else {
+			tc.SetKeepAlive(true)
+			tc.SetKeepAlivePeriod(ln.period)
+		}
+	}
+	return c, nil
+}
+
+// listen returns a listener for addr, which can be a TCP address such as
+// ":443", a unix domain socket path prefixed by "unix:", or "systemd" to use
+// the first socket passed by systemd socket activation. A specific named
+// socket (see FileDescriptorName in systemd.socket(5)) can be selected with
+// "systemd:NAME".
+//
+// The Network and FastOpen settings of lc apply to TCP addresses. The others
+// are applied by [ListenerConfig.wrap].
+func listen(addr string, lc ListenerConfig) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(addr, "unix:")
+		// Remove a stale socket from a previous run, but nothing else.
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("failed to remove stale unix socket: %w", err)
+			}
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		// Don't remove the socket on Close, as it might have been passed to a
+		// new process by a binary upgrade.
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+		return ln, nil
+	case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+		name := strings.TrimPrefix(strings.TrimPrefix(addr, "systemd"), ":")
+		return systemdListener(name)
+	default:
+		keepAlive, err := lc.check()
+		if err != nil {
+			return nil, err
+		}
+		network := lc.Network
+		if network == "" {
+			network = "tcp"
+		}
+		nlc := &net.ListenConfig{KeepAlive: keepAlive}
+		if lc.FastOpen {
+			nlc.Control = func(network, address string, c syscall.RawConn) error {
+				var err error
+				if cerr := c.Control(func(fd uintptr) { err = setFastOpen(fd) }); cerr != nil {
+					return cerr
+				}
+				if err != nil {
+					return fmt.Errorf("failed to enable TCP Fast Open: %w", err)
+				}
+				return nil
+			}
+		}
+		return nlc.Listen(context.Background(), network, addr)
+	}
+}
+
+// listenFdsStart is SD_LISTEN_FDS_START, the first file descriptor passed by
+// systemd socket activation.
+const listenFdsStart = 3
+
+// systemdListener returns a listener inherited through systemd socket
+// activation, as documented in sd_listen_fds(3). If name is empty, the first
+// passed socket is used.
+func systemdListener(name string) (net.Listener, error) {
+	fd, fdName, err := systemdSocket(name)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), fdName)
+	ln, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to use systemd socket %d (%s): %w", fd, fdName, err)
+	}
+	return ln, nil
+}
+
+// systemdSocket returns the file descriptor and name of the socket selected by
+// name among those described by the LISTEN_PID, LISTEN_FDS, and
+// LISTEN_FDNAMES environment variables.
+func systemdSocket(name string) (fd int, fdName string, err error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return 0, "", errors.New("no sockets passed by systemd (LISTEN_PID is missing or not ours)")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return 0, "", errors.New("no sockets passed by systemd (LISTEN_FDS is missing or zero)")
+	}
+	var names []string
+	if v := os.Getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+	for i := 0; i < n; i++ {
+		fdName := "unknown"
+		if i < len(names) {
+			fdName = names[i]
+		}
+		if name != "" && fdName != name {
+			continue
+		}
+		return listenFdsStart + i, fdName, nil
+	}
+	return 0, "", fmt.Errorf("no socket named %q passed by systemd", name)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// setFastOpen enables TCP Fast Open on the listening socket fd.
+var setFastOpen = func(fd uintptr) error {
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN, fastOpenQueueLength)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// TCP Fast Open is only enabled on Linux, where it's on by default for
+// clients, but needs to be enabled per socket for servers.
+
+var setFastOpen func(fd uintptr) error
@@ -0,0 +1,102 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestSystemdSocket(t *testing.T) {
+	ours := strconv.Itoa(os.Getpid())
+	for _, tc := range []struct {
+		name              string
+		pid, fds, fdNames string
+		selected          string
+		fd                int
+		fdName            string
+		err               bool
+	}{
+		{name: "NoPID", fds: "1", err: true},
+		{name: "OtherPID", pid: "1", fds: "1", err: true},
+		{name: "InvalidPID", pid: "our", fds: "1", err: true},
+		{name: "NoFDs", pid: ours, err: true},
+		{name: "ZeroFDs", pid: ours, fds: "0", err: true},
+		{name: "InvalidFDs", pid: ours, fds: "two", err: true},
+		{name: "First", pid: ours, fds: "2", fd: 3, fdName: "unknown"},
+		{name: "FirstNamed", pid: ours, fds: "2", fdNames: "http:https", fd: 3, fdName: "http"},
+		{name: "ByName", pid: ours, fds: "3", fdNames: "http:https:debug", selected: "https", fd: 4, fdName: "https"},
+		{name: "ByNameLast", pid: ours, fds: "3", fdNames: "http:https:debug", selected: "debug", fd: 5, fdName: "debug"},
+		{name: "DuplicateName", pid: ours, fds: "2", fdNames: "http:http", selected: "http", fd: 3, fdName: "http"},
+		{name: "MissingName", pid: ours, fds: "2", fdNames: "http:https", selected: "debug", err: true},
+		{name: "UnnamedFDs", pid: ours, fds: "2", selected: "http", err: true},
+		{name: "FewerNames", pid: ours, fds: "2", fdNames: "http", selected: "unknown", fd: 4, fdName: "unknown"},
+		{name: "ExtraNames", pid: ours, fds: "1", fdNames: "http:https", selected: "https", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tc.pid)
+			t.Setenv("LISTEN_FDS", tc.fds)
+			t.Setenv("LISTEN_FDNAMES", tc.fdNames)
+			fd, fdName, err := systemdSocket(tc.selected)
+			if tc.err {
+				if err == nil {
+					t.Errorf("got fd %d (%s), expected an error", fd, fdName)
+				}
+				return
+			}
+			fatalIfErr(t, err)
+			if fd != tc.fd || fdName != tc.fdName {
+				t.Errorf("got fd %d (%s), expected %d (%s)", fd, fdName, tc.fd, tc.fdName)
+			}
+		})
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	// Unix socket paths are limited to about 100 bytes, which t.TempDir
+	// might exceed.
+	dir, err := os.MkdirTemp("", "sunlight")
+	fatalIfErr(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "s")
+
+	ln, err := listen("unix:"+path, ListenerConfig{})
+	fatalIfErr(t, err)
+	fatalIfErr(t, ln.Close())
+	// The socket is left behind on Close, for a binary upgrade.
+	if fi, err := os.Lstat(path); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		t.Fatalf("socket was removed on Close: %v", err)
+	}
+
+	// The stale socket is replaced.
+	ln, err = listen("unix:"+path, ListenerConfig{})
+	fatalIfErr(t, err)
+	defer ln.Close()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			c.Write([]byte("ok"))
+			c.Close()
+		}
+	}()
+	c, err := net.Dial("unix", path)
+	fatalIfErr(t, err)
+	defer c.Close()
+	buf := make([]byte, 2)
+	if _, err := c.Read(buf); err != nil || string(buf) != "ok" {
+		t.Errorf("got %q, %v from the new socket", buf, err)
+	}
+
+	// Anything else at the path is left alone.
+	other := filepath.Join(dir, "file")
+	fatalIfErr(t, os.WriteFile(other, []byte("keep"), 0o644))
+	if ln, err := listen("unix:"+other, ListenerConfig{}); err == nil {
+		ln.Close()
+		t.Errorf("listened over a regular file")
+	}
+	if b, err := os.ReadFile(other); err != nil || string(b) != "keep" {
+		t.Errorf("regular file was modified: %q, %v", b, err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sunlight.log")
+	// An existing file counts towards the limit.
+	fatalIfErr(t, os.WriteFile(path, []byte("old\n"), 0o640))
+
+	const maxSize, maxBackups = 20, 2
+	r, err := newRotatingFile(path, maxSize, maxBackups)
+	fatalIfErr(t, err)
+	for i := range 10 {
+		// Each line is 9 bytes, so two fit in a file, but only one fits
+		// after the existing contents.
+		if _, err := fmt.Fprintf(r, "entry %02d\n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"sunlight.log", "entry 09\n"},
+		{"sunlight.log.1", "entry 07\nentry 08\n"},
+		{"sunlight.log.2", "entry 05\nentry 06\n"},
+	} {
+		got, err := os.ReadFile(filepath.Join(filepath.Dir(path), tc.name))
+		fatalIfErr(t, err)
+		if string(got) != tc.want {
+			t.Errorf("%s: got %q, expected %q", tc.name, got, tc.want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept more than %d backups: %v", maxBackups, err)
+	}
+
+	// A write larger than the limit goes to a file of its own, whole.
+	long := "a single entry longer than the limit\n"
+	if _, err := fmt.Fprint(r, long); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(r, "entry 10\n")
+	got, err := os.ReadFile(path + ".1")
+	fatalIfErr(t, err)
+	if string(got) != long {
+		t.Errorf("got %q before the last rotation, expected %q", got, long)
+	}
+	got, err = os.ReadFile(path)
+	fatalIfErr(t, err)
+	if string(got) != "entry 10\n" {
+		t.Errorf("got %q after the last rotation", got)
+	}
+}
+
+func TestRotatingFileNoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sunlight.log")
+	r, err := newRotatingFile(path, 20, 0)
+	fatalIfErr(t, err)
+	for i := range 5 {
+		fmt.Fprintf(r, "entry %02d\n", i)
+	}
+	got, err := os.ReadFile(path)
+	fatalIfErr(t, err)
+	if string(got) != "entry 04\n" {
+		t.Errorf("got %q, expected only the entries after the last rotation", got)
+	}
+	matches, err := filepath.Glob(path + ".*")
+	fatalIfErr(t, err)
+	if len(matches) != 0 {
+		t.Errorf("kept backups %q with MaxBackups 0", matches)
+	}
+}
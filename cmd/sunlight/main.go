@@ -3,34 +3,192 @@
 // A YAML config file is required (specified with -c, by default sunlight.yaml),
 // the keys are documented in the [Config] type.
 //
+// Config values can reference environment variables as ${VAR}, for example
+// "tokenfile: ${CREDENTIALS_DIRECTORY}/admin-token". An unset variable is an
+// error, and $${ is a literal ${. So that secrets don't need to be written to
+// disk, the paths of keys, passphrases, PINs, and tokens can instead be
+// secretref:// URIs, fetched at startup from AWS Secrets Manager
+// (secretref://aws/NAME), Google Cloud Secret Manager
+// (secretref://gcp/projects/PROJECT/secrets/SECRET), or the Vault KV engine
+// (secretref://vault/MOUNT/PATH#field), as are TestRootsToken and the Alerts
+// webhook URL and RoutingKey. A #field fragment selects a field of a JSON
+// secret.
+//
 // If the command line flag -testcert is passed, ACME will be disabled and the
 // certificate will be loaded from sunlight.pem and sunlight-key.pem.
 //
-// Metrics are exposed publicly at /metrics, and logs are written to stderr in
-// human-readable format, and to stdout in JSON format.
+// The random choices of the logs and backends, such as the sequencer stagger
+// and the retry backoff, are seeded with the -seed flag, or with a random seed
+// which is logged at startup, so that a failure found by fuzzing or
+// simulation can be replayed with the same seed. The -fakeclock flag, meant
+// for the same purpose, replaces the SCT and checkpoint clock with one that
+// starts at the given RFC 3339 time and advances by a millisecond per reading.
+//
+// Metrics are exposed at /metrics (publicly, unless Admin authentication is
+// configured), and logs are written by default to stderr in human-readable
+// format, and to stdout in JSON format (see [LoggingConfig]).
+//
+// A private HTTP debug server is also started, by default on a random port on
+// localhost. It serves /debug/logson and /debug/logsoff which enable and
+// disable debug logging, respectively, and /debug/maintenanceon and
+// /debug/maintenanceoff which toggle maintenance mode for the log selected by
+// the "log" query parameter (or for all logs), and /debug/state which dumps the
+// sequencer, pool, upload, and cache state of each log as JSON. Similarly,
+// /debug/features lists the features of each log as JSON, and
+// /debug/featureon, /debug/featureoff, and /debug/featurereset override the
+// feature selected by the "feature" query parameter, or clear the override. If
+// Debug.Profiling is set, it
+// also serves the net/http/pprof endpoints and /debug/goroutines. With
+// Admin.PublicDebug, they are also served on the main listener.
+//
+// The "sunlight keygen -name <origin>" command generates a new log key and
+// Ed25519 witness key, optionally encrypted with -encrypt or -r, and prints the
+// log ID and public keys in the formats needed for log list submission.
+//
+// The "sunlight mirror" command continuously copies a log from its monitoring
+// API to an S3 bucket, verifying every tile, to make an independent read
+// replica of the log, and with -witness submits its checkpoints to
+// c2sp.org/tlog-witness witnesses. See "sunlight mirror -h" for its flags.
+//
+// The "sunlight monitor -c monitor.yaml" command follows one or more logs,
+// verifying their checkpoints, consistency, tiles, and sampled inclusion
+// proofs, and exports the results as Prometheus metrics. Its config file keys
+// are documented in the [MonitorConfig] type.
+//
+// The "sunlight import -log <short name> -source <url>" command migrates an
+// existing RFC 6962 log by sequencing its entries, with their original
+// timestamps, into a new log from the config file, and verifies them against
+// the source STH. See "sunlight import -h" for its flags.
+//
+// The "sunlight export -format csv|parquet" command writes the entries of a
+// log, read and verified through its monitoring API, to a CSV or Parquet file.
+// See "sunlight export -h" for its flags.
+//
+// The "sunlight gc" command lists the tiles of the logs in the config file and
+// reports the partial tiles superseded by wider ones, and optionally the tiles
+// left beyond the checkpoint by failed sequencing rounds. It only deletes them
+// if -delete is passed.
+//
+// The "sunlight purge" command deletes the tiles of a retired temporal shard
+// once its Retention window is over, in rate-limited batches. It requires
+// -confirm to be set to the log name and -delete to actually delete anything,
+// and first uploads an inventory of the deleted tiles next to the checkpoint,
+// which is preserved.
+//
+// The "sunlight flood" command load tests a log by submitting synthetic chains
+// issued by a test root, generated with -gen-root, at a configurable rate and
+// concurrency, and reports the latency of the SCTs and, with -monitoring, of
+// their inclusion in the published checkpoint. Don't point it at production
+// logs, unless the test root is only in TestRoots.
+//
+// The "sunlight check-config" command validates the config file without
+// starting the logs: it loads the roots and keys, checks that the lock backend
+// and buckets are reachable and hold checkpoints matching the log keys, probes
+// the bucket permissions, and checks that the temporal intervals of logs with
+// the same roots don't overlap.
+//
+// The "sunlight compare-checkpoints" command fetches the checkpoint of a log
+// from multiple vantage points, such as the bucket, a CDN, mirrors, and
+// witnesses, and reports split views, inconsistent or stale checkpoints, and
+// missing cosignatures, writing the evidence to a JSON report.
+//
+// The "sunlight verify-sct" command verifies the SCTs issued by a log for a
+// certificate, embedded or sent by a TLS server, locates their entries in the
+// log, and prints their inclusion proofs.
+//
+// The "sunlight resubmit" command submits a set of chains to a log, such as
+// those issued by a CA during a log outage, with bounded concurrency and
+// retries, and records the returned SCTs, skipping chains already recorded.
 //
-// A private HTTP debug server is also started on a random port on localhost. It
-// serves the net/http/pprof endpoints, as well as /debug/logson and
-// /debug/logsoff which enable and disable debug logging, respectively.
+// The "sunlight status" command renders a static status page of the logs, with
+// their tree size, latest checkpoint time, temporal interval, number of roots,
+// and checkpoint cosigners, and uploads it to their backends as status.html and
+// status.json.
+//
+// The "sunlight compliance" command probes a log for a period of time, and
+// reports the availability of its endpoints, the merge delay against its MMD,
+// the freshness of its checkpoint, and whether it enforces its temporal
+// interval, as requested by CT log programs when reviewing a log.
+//
+// The "sunlight compare-mirrors" command compares two copies of a log, such as
+// the origin bucket and a CDN, object by object, and reports any missing,
+// extra, or differing tiles.
+//
+// The "sunlight proxy" command serves the monitoring API of a log from a local
+// disk cache, fetching misses from the origin with request coalescing, as a
+// self-hosted caching layer in front of the bucket.
+//
+// The "sunlight estimate" command projects the storage volume, request counts,
+// and monthly cost of a log for a given or sampled submission rate, across
+// storage providers and classes.
+//
+// The "sunlight snapshot" command takes a consistent snapshot of a log, its
+// checkpoint and every tile of its tree, verified against it, into a tar
+// archive or a second bucket. The "sunlight restore" command restores an
+// archive into a fresh backend, and verifies that the restored tree matches
+// the snapshot root hash before uploading the checkpoint.
+//
+// The "sunlight index" command follows a log and indexes the DNS names of its
+// certificates and precertificates in a local SQLite database, and serves a
+// search endpoint to find the entries logged for a domain and its subdomains.
+//
+// Sending SIGHUP to the process on Unix systems, or requesting /debug/reload on
+// the debug server, reloads the config file. Only the logging levels and
+// the PoolSize, State, StateTimestamp, Retention, Maintenance, Features,
+// Roots, RootsReloadInterval, and Witnesses of the logs are applied live; if
+// anything else changed, the reload is rejected with an error log, and the
+// process keeps running with the current configuration.
+//
+// On Unix systems, sending SIGUSR2 to the process starts a new instance of the
+// (possibly replaced) executable, which inherits the listening socket and takes
+// over sequencing once the old instance has drained pending requests.
+//
+// Under systemd with Type=notify (or notify-reload), Sunlight reports READY
+// once the logs are serving, RELOADING during config reloads, and STOPPING on
+// shutdown. If WatchdogSec is set, it pings the watchdog only while every
+// sequencer keeps completing rounds, so that systemd restarts a process whose
+// sequencing is stuck even if it still answers HTTP requests. Binary upgrades
+// hand over the main PID, which requires NotifyAccess=all.
+//
+// To run as a Kubernetes Deployment with two replicas, configure
+// Kubernetes.Lease and Kubernetes.ProbesListen, and point the startup and
+// liveness probes at /livez and the readiness probe at /readyz. Only the
+// replica holding the Lease loads the logs, and the other takes over within
+// the lease duration if it stops. SIGTERM stops the process like an interrupt.
+//
+// To run active/passive across regions, point the instances in each region at
+// the same buckets and DynamoDB or ETagS3 lock backend, and set Region.Name.
+// The active instance sequences the logs, while the passive ones serve reads
+// and reject submissions, until one of them takes over the region lease and
+// promotes itself. The sunlight_region_active and sunlight_region_lease_holder
+// metrics report which instance is active.
 package main
 
 import (
 	"context"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
-	"encoding/pem"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	runtimepprof "runtime/pprof"
 	"strings"
+	"syscall"
 	"time"
 
+	"filippo.io/sunlight/client"
 	"filippo.io/sunlight/internal/ctlog"
 	"github.com/google/certificate-transparency-go/x509util"
 	"github.com/prometheus/client_golang/prometheus"
@@ -38,16 +196,26 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/mod/sumdb/note"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
 	"golang.org/x/sync/errgroup"
-	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	// Listen is the address to listen on, e.g. ":443".
+	//
+	// It can also be a unix domain socket path prefixed by "unix:", e.g.
+	// "unix:/run/sunlight/sunlight.sock", or "systemd" to use the socket passed
+	// by systemd socket activation. If multiple sockets are passed, one can be
+	// selected by FileDescriptorName with "systemd:NAME".
 	Listen string
 
+	// Listener configures the sockets of Listen, such as the IPv4 and IPv6
+	// stacks, TCP keep-alives, and a connection limit. Optional.
+	Listener ListenerConfig
+
 	// ACME is the configuration for the ACME client. Optional. If missing,
 	// Sunlight will listen for plain HTTP or h2c.
 	ACME struct {
@@ -110,9 +278,205 @@ type Config struct {
 		Endpoint string
 	}
 
+	// NTP configures a periodic check of the local clock against an NTP
+	// server, or against the Date header of an HTTP server. Optional. While
+	// the offset exceeds MaxOffset, submissions are rejected with a 503 and
+	// no SCTs or checkpoints are signed, since they would carry wrong
+	// timestamps. If the server can't be reached, the last known state is
+	// kept. The offset is exported as the ntp_offset_seconds metric.
+	NTP struct {
+		// Server is the NTP server, such as "time.cloudflare.com". The port
+		// defaults to 123.
+		Server string
+
+		// DateURL is an HTTP URL whose Date response header is used instead
+		// of an NTP server, such as the S3 endpoint of the backend, for
+		// deployments that can't reach NTP servers. Only one of Server and
+		// DateURL can be set. Since the Date header has a resolution of one
+		// second, MaxOffset should be at least 2s.
+		DateURL string
+
+		// MaxOffset is the maximum tolerated clock offset, as a Go duration
+		// string. Optional. Defaults to 1s, or 2s with DateURL.
+		MaxOffset string
+
+		// Interval is how often the offset is checked, as a Go duration
+		// string. Optional. Defaults to 5m.
+		Interval string
+	}
+
+	// Limits bounds the resources used by the process, so that a burst of
+	// submissions can't get a small machine OOM-killed. Optional. See also
+	// MaxConcurrentValidations, MaxBackendRequests, and SubmissionTimeout in
+	// LogConfig.
+	Limits struct {
+		// MemoryLimit is the soft memory limit of the Go runtime, with the
+		// same syntax as GOMEMLIMIT, such as "900MiB". Optional. It should be
+		// somewhat lower than the memory of the machine. The GOMEMLIMIT
+		// environment variable takes precedence.
+		MemoryLimit string
+
+		// ReadTimeout and WriteTimeout are the HTTP server timeouts for
+		// reading a request and writing its response, as Go duration strings.
+		// Optional. Default to 5s and 15s.
+		ReadTimeout  string
+		WriteTimeout string
+
+		// IdleTimeout is how long an idle keep-alive connection is kept open
+		// waiting for the next request, as a Go duration string. Optional.
+		// Defaults to ReadTimeout. Proxies that reuse connections, such as
+		// the Fly.io one, work better with a value longer than theirs.
+		IdleTimeout string
+	}
+
+	// Debug configures the private debug server. Optional.
+	Debug struct {
+		// Listen is the address of the debug server. Optional. Defaults to
+		// a random port on localhost, which is logged at startup. The debug
+		// server is not authenticated, so it must not be publicly reachable;
+		// see Admin.PublicDebug instead.
+		Listen string
+
+		// MaxConnections is the maximum number of open connections to the
+		// debug server. Optional. Defaults to no limit.
+		MaxConnections int
+
+		// Profiling enables the net/http/pprof endpoints at /debug/pprof/,
+		// including CPU profiles and runtime/trace capture at
+		// /debug/pprof/trace, and a dump of all goroutine stacks at
+		// /debug/goroutines. Optional. Disabled by default.
+		Profiling bool
+	}
+
+	// Admin restricts access to /metrics and, if PublicDebug is set, the debug
+	// endpoints. Optional. If neither TokenFile nor ClientCAs is set, /metrics
+	// is public, and the debug endpoints are only served on localhost.
+	Admin struct {
+		// TokenFile is the path to a file containing a token that must be
+		// sent as "Authorization: Bearer <token>", or a secretref:// URI.
+		// Optional.
+		TokenFile string
+
+		// ClientCAs is the path to a PEM file of CA certificates. Clients that
+		// present a certificate issued by one of them are authorized. It
+		// requires ACME or -testcert, since it relies on the TLS handshake.
+		// Optional.
+		ClientCAs string
+
+		// PublicDebug also serves the debug endpoints (pprof, logs, and
+		// maintenance) at /debug/ on the main listener, behind the same
+		// authentication, for environments where the localhost debug server is
+		// not reachable. It requires TokenFile or ClientCAs.
+		PublicDebug bool
+	}
+
+	// LatencyMetrics is the type of the latency metrics, one of "summary",
+	// "histogram", or "native-histogram". Optional. Defaults to "summary".
+	//
+	// Unlike summaries, histograms can be aggregated across instances.
+	// Native histograms are exported alongside classic buckets, and require
+	// Prometheus to be configured to scrape them.
+	LatencyMetrics string
+
+	// TraceExemplars attaches the trace ID of the W3C traceparent header set
+	// by a tracing proxy or load balancer as an exemplar to the request and
+	// sequencing latency histograms, and serves /metrics in the OpenMetrics
+	// format when requested, which is required to expose exemplars. It
+	// requires LatencyMetrics to be "histogram" or "native-histogram".
+	// Optional.
+	TraceExemplars bool
+
+	// StatsD periodically pushes the metrics served at /metrics to a StatsD
+	// server, for environments where Prometheus scraping isn't available.
+	// Labels are sent as DogStatsD tags, and counters as increments since
+	// the previous push. Optional.
+	StatsD struct {
+		// Address is the UDP host:port of the StatsD server, such as
+		// "localhost:8125".
+		Address string
+
+		// Prefix is prepended to the metric names. Optional.
+		Prefix string
+
+		// Interval is how often the metrics are pushed, as a Go duration
+		// string. Optional. Defaults to 10s.
+		Interval string
+	}
+
+	// Logging configures the process logs. Optional. By default, logs are
+	// written at level INFO to stderr in human-readable format, and to stdout
+	// in JSON format.
+	Logging LoggingConfig
+
+	// Alerts configures webhooks notified of operational events, such as
+	// sequencing failure streaks, the sequencer stopping (for example after
+	// losing the checkpoint lock), risk of exceeding the MMD, signer health
+	// check failures, and roots reload or sync errors. Optional.
+	Alerts AlertsConfig
+
+	// Witness configures Sunlight to also act as a witness for other logs.
+	// Optional. See WitnessServerConfig.
+	Witness WitnessServerConfig
+
+	// Kubernetes configures the probe endpoints and Lease-based leader
+	// election for running as a Deployment. Optional. See KubernetesConfig.
+	Kubernetes KubernetesConfig
+
+	// Region configures active/passive operation across regions, with a lease
+	// stored in the lock backend. Optional. See RegionConfig.
+	Region RegionConfig
+
+	// LogDefaults are the defaults of the fields of Logs, for settings that
+	// are shared by all the shards of a log, such as the S3 region and
+	// endpoint, the roots, the signer or pool tuning, and the submission
+	// policy. Each log overrides any field it sets, including individual
+	// fields of nested sections, while lists are replaced as a whole.
+	// Optional. Name and ShortName can't be set.
+	//
+	// For example, this only needs the per-shard fields for each log:
+	//
+	//   logdefaults:
+	//     roots: /etc/sunlight/roots.pem
+	//     s3region: us-east-1
+	//     poolsize: 1000
+	//   logs:
+	//     - shortname: example2025h1
+	//       ...
+	LogDefaults LogConfig
+
 	Logs []LogConfig
 }
 
+type LoggingConfig struct {
+	// Format is "text" or "json". Optional. If set, logs are written only to
+	// stderr (or File) in this format. If File is set, defaults to "json".
+	Format string
+
+	// Level is the minimum level of logged messages, such as "DEBUG", "INFO",
+	// "WARN", or "ERROR". Optional. Defaults to "INFO". The /debug/logson and
+	// /debug/logsoff endpoints switch it to DEBUG and INFO.
+	Level string
+
+	// Levels overrides Level for specific subsystems. Optional. The keys are
+	// "log" (submissions and sequencing), "backend" (object storage), "lock"
+	// (checkpoint database), "signer" (remote signers), "http" (HTTP server
+	// errors), "metrics", "witness" (the witness server), and "lease"
+	// (Kubernetes and region leader election). For example, {"backend": "DEBUG"} logs
+	// every object storage request without enabling debug logging elsewhere.
+	Levels map[string]string
+
+	// File is a path to write logs to, instead of stderr and stdout. Optional.
+	File string
+
+	// MaxSizeMB is the size in megabytes after which File is rotated, by
+	// renaming it to File.1 (and File.1 to File.2, and so on). Optional.
+	// Defaults to 100.
+	MaxSizeMB int
+
+	// MaxBackups is the number of rotated files kept. Optional. Defaults to 5.
+	MaxBackups int
+}
+
 type LogConfig struct {
 	// Name is the fully qualified log name for the checkpoint origin line, as a
 	// schema-less URL. It doesn't need to be where the log is actually hosted,
@@ -134,28 +498,265 @@ type LogConfig struct {
 	// without "/ct/v1" suffix.
 	HTTPPrefix string
 
-	// Roots is the path to the accepted roots as a PEM file.
+	// Roots is the path to the accepted roots as a PEM file, or an https://
+	// URL to fetch it from.
+	//
+	// Roots are checked for changes every RootsReloadInterval, and replaced
+	// without restarting if they changed.
 	Roots string
 
-	// Key is the path to the private key as a PKCS#8 PEM file.
+	// DeniedRoots are hex-encoded SHA-256 hashes of the SubjectPublicKeyInfo
+	// of roots that are not accepted, even if present in Roots or TestRoots.
+	// Optional.
+	//
+	// To compute the hash of a root, run:
+	//
+	//   $ openssl x509 -in root.pem -pubkey -noout | openssl pkey -pubin -outform DER | sha256sum
+	//
+	DeniedRoots []string
+
+	// TestRoots is the path to a PEM file of roots accepted only for
+	// submissions that carry a Sunlight-Test-Submission header with the value
+	// TestRootsToken, such as for canary submissions. They are not listed by
+	// get-roots. Optional.
+	TestRoots string
+
+	// TestRootsToken is the secret value of the Sunlight-Test-Submission
+	// header, or a secretref:// URI. Required if TestRoots is set.
+	TestRootsToken string
+
+	// CrossSigned is the path to a PEM file of additional intermediates, such
+	// as cross-signed ones, used to build an alternate path to an accepted
+	// root if a submitted chain doesn't verify as is. Optional.
+	CrossSigned string
+
+	// RootsReloadInterval is how often Roots is checked for changes, as a Go
+	// duration string such as "10m". Optional. Defaults to one minute. A
+	// negative value disables reloading.
+	RootsReloadInterval string
+
+	// Key is the path to the private key as a PKCS#8 PEM file, or a
+	// secretref:// URI of a secret holding it.
 	//
 	// To generate a new key, run:
 	//
-	//   $ openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:P-256 -outform PEM -out key.pem
+	//   $ sunlight keygen -name example.com/2025h1
+	//
+	// The file can be encrypted with age, for example with sunlight keygen
+	// -encrypt, in which case it's decrypted with KeyIdentityFile or a
+	// passphrase from KeyPassphraseFile, the SUNLIGHT_KEY_PASSPHRASE
+	// environment variable, or the terminal, in this order of preference.
 	//
+	// Threshold (M-of-N) signing is not supported: the key signs an SCT for
+	// every submission and a checkpoint every second, which rules out
+	// interactive approvals, and threshold ECDSA protocols are too complex and
+	// slow for the submission path. Logs whose policy forbids any one machine
+	// from holding the key should use AWSKMS, GCPKMS, AzureKeyVault, PKCS11,
+	// or Vault, and rely on their access controls and quorum-protected key
+	// management for split custody. Independent parties can additionally
+	// cosign every checkpoint with CheckpointKeys.
 	Key string
 
+	// KeyIdentityFile is the path to an age identity file that decrypts Key,
+	// or a secretref:// URI. Optional.
+	KeyIdentityFile string
+
+	// KeyPassphraseFile is the path to a file containing the passphrase that
+	// decrypts Key, or a secretref:// URI. Optional.
+	KeyPassphraseFile string
+
+	// CheckpointKeys are paths to note signer keys, such as the witness key
+	// generated by sunlight keygen, that add a signature to every checkpoint
+	// alongside the one from Key. Optional. They can be encrypted like Key.
+	//
+	// This allows publishing an Ed25519 signature for witnesses, or signing with
+	// the next key ahead of a rotation.
+	CheckpointKeys []string
+
+	// AWSKMS configures an AWS KMS asymmetric key to use instead of Key, so
+	// that the private key never leaves KMS. The key must have key spec
+	// ECC_NIST_P256 and key usage SIGN_VERIFY. PublicKey is required, and the
+	// key is checked against it and with a test signature at startup.
+	// Optional.
+	AWSKMS struct {
+		// KeyID is the key ID, key ARN, alias name, or alias ARN.
+		KeyID string
+
+		// Region is the AWS region of the key. Optional. Defaults to the
+		// region of the default AWS configuration.
+		Region string
+	}
+
+	// GCPKMS configures a Google Cloud KMS asymmetric signing key to use
+	// instead of Key. The key must have algorithm EC_SIGN_P256_SHA256.
+	// Credentials are loaded from the Application Default Credentials.
+	// PublicKey is required. Optional.
+	GCPKMS struct {
+		// KeyVersion is the resource name of the key version, such as
+		// projects/P/locations/L/keyRings/R/cryptoKeys/K/cryptoKeyVersions/1.
+		KeyVersion string
+	}
+
+	// AzureKeyVault configures an Azure Key Vault or Managed HSM EC P-256 key
+	// to use instead of Key. Credentials are loaded as by the Azure SDK
+	// DefaultAzureCredential. PublicKey is required. Optional.
+	AzureKeyVault struct {
+		// KeyID is the versioned key identifier, such as
+		// https://example.vault.azure.net/keys/log2025h1/0123456789abcdef.
+		KeyID string
+	}
+
+	// PKCS11 configures an EC P-256 key on a PKCS#11 token to use instead of
+	// Key. PublicKey is required. Optional.
+	PKCS11 struct {
+		// Module is the path to the PKCS#11 shared library, such as
+		// /usr/lib/softhsm/libsofthsm2.so.
+		Module string
+
+		// TokenLabel is the label of the token holding the key.
+		TokenLabel string
+
+		// PINFile is the path to a file containing the user PIN of the
+		// token, or a secretref:// URI. Trailing whitespace is ignored.
+		PINFile string
+
+		// KeyLabel is the label of the private key and public key objects.
+		KeyLabel string
+
+		// Sessions is the maximum number of idle sessions kept open.
+		// Optional. Defaults to 4.
+		Sessions int
+	}
+
+	// Vault configures an ecdsa-p256 key in a HashiCorp Vault transit engine
+	// to use instead of Key. PublicKey is required. Optional.
+	Vault struct {
+		// Address is the Vault server URL.
+		Address string
+
+		// Namespace is the Vault Enterprise namespace. Optional.
+		Namespace string
+
+		// Mount is the path of the transit engine. Optional. Defaults to
+		// "transit".
+		Mount string
+
+		// Key is the name of the transit key.
+		Key string
+
+		// KeyVersion is the key version to sign with. Optional. Defaults to
+		// the latest version at startup.
+		KeyVersion int
+
+		// TokenFile is the path to a file containing a Vault token, or a
+		// secretref:// URI. The token is renewed as needed if renewable.
+		// Exactly one of TokenFile and AppRole must be set.
+		TokenFile string
+
+		// AppRole configures login with the AppRole auth method, which is
+		// repeated whenever the token can't be renewed.
+		AppRole struct {
+			// Mount is the path of the auth method. Optional. Defaults to
+			// "approle".
+			Mount string
+
+			RoleID string
+
+			// SecretIDFile is the path to a file containing the secret ID,
+			// or a secretref:// URI.
+			SecretIDFile string
+		}
+	}
+
 	// PublicKey is the SubjectPublicKeyInfo for this log, base64 encoded.
 	//
 	// This is the same format as used in Google and Apple's log list JSON files.
 	//
-	// To generate from a private key, run:
+	// It's printed by sunlight keygen, or to generate from a private key, run:
 	//
 	//   $ openssl pkey -in key.pem -pubout -outform DER | base64 -w0
 	//
 	// If provided, the loaded private Key is required to match it. Optional.
 	PublicKey string
 
+	// SigningWorkers is the number of workers that sign SCTs, bounding the
+	// concurrent requests to a remote signer such as AWSKMS or PKCS11.
+	// Optional. If zero, SCTs are signed inline, which is best for a local Key.
+	SigningWorkers int
+
+	// SigningQueueSize is the maximum number of SCTs waiting for a signing
+	// worker, after which add-[pre-]chain requests are rejected with a 503.
+	// Optional. Defaults to 64 times SigningWorkers.
+	SigningQueueSize int
+
+	// MaxConcurrentValidations is the maximum number of add-[pre-]chain
+	// requests that are read and validated at the same time. Further requests
+	// wait for a slot until SubmissionTimeout. Optional. Defaults to no limit.
+	MaxConcurrentValidations int
+
+	// MaxBackendRequests is the maximum number of concurrent requests to the
+	// S3 backend. Optional. Defaults to no limit.
+	MaxBackendRequests int
+
+	// SubmissionTimeout is the deadline of add-[pre-]chain requests,
+	// including the wait for sequencing, as a Go duration string. Requests
+	// that exceed it fail with a 503. Optional. Defaults to no deadline other
+	// than Limits.WriteTimeout.
+	SubmissionTimeout string
+
+	// Audit configures an append-only record of every accepted submission
+	// (timestamp, leaf index and hash, issuer, client IP, and SCT), uploaded
+	// to the backend as JSON Lines objects under audit/YYYY-MM-DD/. Optional.
+	Audit struct {
+		// Enabled turns on the audit log.
+		Enabled bool
+
+		// Interval is how often records are uploaded, as a Go duration
+		// string. Each upload creates a new object. Optional. Defaults to 1m.
+		Interval string
+
+		// ClientIPHeader is the request header set by a trusted proxy to the
+		// client IP address, such as Fly-Client-IP or X-Forwarded-For.
+		// Optional. If empty, the connection address is recorded.
+		ClientIPHeader string
+	}
+
+	// SignerCheck configures a periodic test signature with the key, exported
+	// as the signer_healthy metric, to detect a failing remote signer before
+	// sequencing does. Optional.
+	SignerCheck struct {
+		// Interval is how often the check runs, as a Go duration string.
+		// Optional. Defaults to one minute. A negative value disables it.
+		Interval string
+
+		// MaxLatency is the signing latency above which the signer is reported
+		// as unhealthy, as a Go duration string. Optional.
+		MaxLatency string
+	}
+
+	// SelfMonitor configures a periodic check of the log as published at
+	// MonitoringURL: the checkpoint signature, its consistency with the
+	// previously checked one, and the hashes of a sample of tiles. Results are
+	// exported as the self_monitor_* metrics. Optional.
+	SelfMonitor struct {
+		// Enabled turns on the self-monitor. MonitoringURL must be set.
+		Enabled bool
+
+		// Interval is how often the check runs, as a Go duration string.
+		// Optional. Defaults to 10s.
+		Interval string
+
+		// Samples is the number of randomly chosen data tiles verified by each
+		// check. Optional. Defaults to 4.
+		Samples int
+	}
+
+	// Witnesses are c2sp.org/tlog-witness witnesses the checkpoint of the log,
+	// as published at MonitoringURL, is submitted to every minute. Optional.
+	// The same witnesses can be configured for other logs with the -witness
+	// flag of "sunlight mirror".
+	Witnesses []WitnessConfig
+
 	// Cache is the path to the SQLite deduplication cache file.
 	Cache string
 
@@ -181,6 +782,63 @@ type LogConfig struct {
 	// going to be treated like a directory in many tools using S3.
 	S3KeyPrefix string
 
+	// S3Transport tunes the HTTP connections to S3, for when connection
+	// establishment dominates the upload latency under burst load. Optional.
+	S3Transport struct {
+		// MaxIdleConnsPerHost is the number of idle connections kept open to
+		// the endpoint. Optional. Defaults to 2. It should be about the number
+		// of concurrent uploads of a sequencing round.
+		MaxIdleConnsPerHost int
+
+		// IdleConnTimeout is how long an idle connection is kept open, as a
+		// Go duration string. Optional. Defaults to 90s. It should be longer
+		// than the sequencing period, so that connections survive between
+		// rounds.
+		IdleConnTimeout string
+
+		// TLSSessionCacheSize is the number of TLS sessions kept for
+		// resumption, to make new connections cheaper. Optional. Defaults to
+		// no resumption.
+		TLSSessionCacheSize int
+
+		// PrewarmConnections is the number of connections opened at startup,
+		// before the log starts sequencing. Optional.
+		PrewarmConnections int
+	}
+
+	// Hedging configures when a second, competing upload is sent to S3 for
+	// an upload that is slower than most recent ones of its kind, if the
+	// hedged-uploads feature is enabled. Optional.
+	Hedging struct {
+		// Quantile is the quantile of the recent upload latencies after which
+		// an upload is hedged, between 0 and 1. Optional. Defaults to 0.95.
+		Quantile float64
+
+		// MaxRate is the maximum fraction of uploads that are hedged, between
+		// 0 and 1. Optional. Defaults to 0.1.
+		MaxRate float64
+
+		// MinDelay and MaxDelay bound the hedging delay, as Go duration
+		// strings. Optional. Default to 10ms and 1s.
+		MinDelay string
+		MaxDelay string
+	}
+
+	// Compression configures the gzip compression of the data tiles and
+	// audit records uploaded to S3. Optional.
+	Compression struct {
+		// Workers is the number of objects compressed concurrently, in the
+		// background of the sequencing round. Optional. Defaults to the
+		// number of CPUs.
+		Workers int
+
+		// Levels are the gzip levels by object class: "data-tiles", "audit",
+		// or "other". From 1 (fastest) to 9 (smallest), or 0 for none, -1 for
+		// the default, and -2 for Huffman coding only. Optional. Defaults to
+		// -1, which is level 6, for all classes.
+		Levels map[string]int
+	}
+
 	// NotAfterStart is the start of the validity range for certificates
 	// accepted by this log instance, as and RFC 3339 date.
 	NotAfterStart string
@@ -188,154 +846,673 @@ type LogConfig struct {
 	// NotAfterLimit is the end of the validity range (not included) for
 	// certificates accepted by this log instance, as and RFC 3339 date.
 	NotAfterLimit string
+
+	// MaxChainLength is the maximum number of certificates in a submitted
+	// chain, including the leaf, such as 10. Optional. By default, there is no
+	// limit.
+	MaxChainLength int
+
+	// MaxCertificateSize is the maximum size in bytes of each DER certificate
+	// in a submitted chain, such as 32768. Optional. By default, there is no
+	// limit.
+	MaxCertificateSize int
+
+	// RejectExpired causes submissions of already expired certificates to be
+	// rejected. Optional.
+	RejectExpired bool
+
+	// RejectNotYetValid causes submissions of certificates whose NotBefore is
+	// in the future to be rejected. Optional.
+	RejectNotYetValid bool
+
+	// MaxValidityDays rejects certificates with a validity period longer than
+	// this many days, such as 398 for the CA/Browser Forum Baseline
+	// Requirements. Optional.
+	MaxValidityDays int
+
+	// ClockSkew is the allowance applied to RejectExpired and
+	// RejectNotYetValid, as a Go duration string such as "5m". Optional.
+	ClockSkew string
+
+	// Dedup is how submissions are recognized as already logged: "leaf" (the
+	// default) deduplicates identical submissions, while "tbs" additionally
+	// recognizes certificates whose precertificate was already logged,
+	// matching them by TBSCertificate and issuer. Optional.
+	Dedup string
+
+	// LoggedPrecert is what happens to a certificate whose precertificate was
+	// already logged, with Dedup "tbs": "log" (the default) logs it as a new
+	// entry, "reject" rejects it, and "sct" returns the SCT of the
+	// precertificate entry. Optional.
+	LoggedPrecert string
+
+	// RejectPrecertSigningCerts rejects precertificates issued by a
+	// Precertificate Signing Certificate, as defined in RFC 6962, Section 3.1.
+	// Optional.
+	RejectPrecertSigningCerts bool
+
+	// MinRSAKeySize rejects leaf and intermediate certificates with RSA keys
+	// smaller than this many bits, such as 2048. Optional.
+	MinRSAKeySize int
+
+	// RejectSHA1 rejects leaf and intermediate certificates signed with SHA-1.
+	// Optional.
+	RejectSHA1 bool
+
+	// RejectSignatureAlgorithms rejects leaf and intermediate certificates
+	// signed with any of the listed algorithms, named such as "MD5-RSA" or
+	// "DSA-SHA256". Optional.
+	RejectSignatureAlgorithms []string
+
+	// Policy configures an external submission policy, which can reject
+	// submissions with a valid chain. Optional. At most one of Command and
+	// Webhook can be set.
+	//
+	// The policy receives a JSON object with the DER "chain" (from the
+	// submitted certificate to the root, base64 encoded), a "precert"
+	// boolean, and the "log" short name.
+	Policy struct {
+		// Command is an executable and its arguments, which receives the
+		// JSON object on standard input, and accepts the submission by
+		// exiting with status zero. Otherwise, the first line of its
+		// standard output is returned to the submitter as the reason.
+		Command []string
+
+		// Webhook is a URL which receives the JSON object in a POST request,
+		// and must respond with a JSON object with an "accept" boolean and an
+		// optional "reason" string.
+		Webhook string
+
+		// Timeout is how long the policy has to reach a decision, as a Go
+		// duration string. Optional. Defaults to 5s.
+		Timeout string
+
+		// FailOpen accepts submissions if the policy fails to reach a
+		// decision. Optional. By default, they are rejected.
+		FailOpen bool
+	}
+
+	// ServeMonitoring enables serving the monitoring API (checkpoint, tiles,
+	// and issuers.pem) under HTTPPrefix, by fetching from the S3 bucket.
+	// Optional. By default, monitors are expected to fetch from the bucket.
+	ServeMonitoring bool
+
+	// TileStore keeps recent tiles in memory-mapped files in a local
+	// directory, so that ServeMonitoring can serve them without fetching
+	// them from S3. Optional.
+	TileStore struct {
+		// Path is the directory of the store. Its contents are deleted at
+		// startup.
+		Path string
+
+		// Size is the total size of the store, such as "1GiB". Between half
+		// and all of it holds tiles. Optional. Defaults to 256MiB.
+		Size string
+	}
+
+	// Description is the human-readable description of the log, advertised at
+	// HTTPPrefix + "/log.v3.json" along with the other log parameters.
+	// Optional. Defaults to Name.
+	Description string
+
+	// SubmissionURL is the public URL of the submission API, including the
+	// HTTPPrefix but without "/ct/v1", advertised in log.v3.json. Optional.
+	SubmissionURL string
+
+	// MonitoringURL is the public URL prefix of the monitoring API, advertised
+	// in log.v3.json. Optional.
+	MonitoringURL string
+
+	// MMD is the Maximum Merge Delay in seconds, advertised in log.v3.json.
+	// Optional. Defaults to 86400.
+	MMD int
+
+	// State is the log state advertised in log.v3.json, such as "pending",
+	// "qualified", "usable", "readonly", or "retired". Optional.
+	State string
+
+	// StateTimestamp is the time the log entered State, as an RFC 3339 date.
+	// Required if State is set.
+	StateTimestamp string
+
+	// Retention is how long the tiles of a retired log are kept after
+	// StateTimestamp, such as "2160h". Optional. If set, "sunlight purge" can
+	// delete the tiles of the log once it's retired, NotAfterLimit has passed,
+	// and the retention window is over. If not set, the tiles are never
+	// deleted.
+	Retention string
+
+	// Maintenance, if set, starts the log in maintenance mode, rejecting
+	// submissions with a 503 carrying this message. Optional. Maintenance mode
+	// can also be toggled at runtime from the debug server.
+	Maintenance string
+
+	// Features enables or disables, by name, behaviors that are being rolled
+	// out gradually, such as "conditional-writes: true", so that they can be
+	// tried on one log first. Optional. Unset features have their defaults.
+	// See the Feature constants of filippo.io/sunlight/internal/ctlog for the
+	// list. Features can also be overridden at runtime from the debug server,
+	// until the next restart.
+	Features map[string]bool
+
+	// CCADB configures automatic synchronization of the accepted roots with
+	// the CCADB. Optional. If Stores is set, the roots are periodically
+	// selected from the CCADB report and written to the Roots file, replacing
+	// its contents, and RootsReloadInterval is ignored.
+	CCADB struct {
+		// Stores is the list of root stores, as named in the CCADB "Status of
+		// Root Cert" column, such as "Mozilla" or "Google Chrome". Roots
+		// included in any of them are accepted.
+		Stores []string
+
+		// URL is the CSV report to fetch. Optional. Defaults to the CCADB All
+		// Certificate Records report.
+		URL string
+
+		// SyncInterval is how often the report is fetched, as a Go duration
+		// string. Optional. Defaults to 24h.
+		SyncInterval string
+
+		// AuditLog is the path to a file where a JSON line is appended for
+		// each added or removed root. Optional.
+		AuditLog string
+	}
+
+	// CORSOrigins is the list of origins allowed to make cross-origin requests
+	// to the read endpoints (get-roots and the monitoring API). Optional.
+	// Defaults to allowing all origins.
+	CORSOrigins []string
 }
 
+// defaultAuditInterval is how often audit records are uploaded, if
+// Audit.Interval is not set.
+const defaultAuditInterval = 1 * time.Minute
+
+// defaultSignerCheckInterval is how often the log key is tested, if
+// SignerCheck.Interval is not set.
+const defaultSignerCheckInterval = 1 * time.Minute
+
+// defaultSelfMonitorInterval and defaultSelfMonitorSamples are used if
+// SelfMonitor.Interval and SelfMonitor.Samples are not set.
+const (
+	defaultSelfMonitorInterval = 10 * time.Second
+	defaultSelfMonitorSamples  = 4
+)
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "keygen":
+			keygen(os.Args[2:])
+			return
+		case "mirror":
+			mirror(os.Args[2:])
+			return
+		case "monitor":
+			monitor(os.Args[2:])
+			return
+		case "import":
+			importLog(os.Args[2:])
+			return
+		case "export":
+			export(os.Args[2:])
+			return
+		case "gc":
+			gc(os.Args[2:])
+			return
+		case "purge":
+			purge(os.Args[2:])
+			return
+		case "flood":
+			flood(os.Args[2:])
+			return
+		case "check-config":
+			checkConfig(os.Args[2:])
+			return
+		case "compare-checkpoints":
+			compareCheckpoints(os.Args[2:])
+			return
+		case "verify-sct":
+			verifySCT(os.Args[2:])
+			return
+		case "resubmit":
+			resubmit(os.Args[2:])
+			return
+		case "status":
+			status(os.Args[2:])
+			return
+		case "compliance":
+			compliance(os.Args[2:])
+			return
+		case "compare-mirrors":
+			compareMirrors(os.Args[2:])
+			return
+		case "proxy":
+			proxy(os.Args[2:])
+			return
+		case "estimate":
+			estimate(os.Args[2:])
+			return
+		case "snapshot":
+			snapshot(os.Args[2:])
+			return
+		case "restore":
+			restore(os.Args[2:])
+			return
+		case "index":
+			indexLog(os.Args[2:])
+			return
+		}
+	}
+
 	fs := flag.NewFlagSet("sunlight", flag.ExitOnError)
 	configFlag := fs.String("c", "sunlight.yaml", "path to the config file")
 	testCertFlag := fs.Bool("testcert", false, "use sunlight.pem and sunlight-key.pem instead of ACME")
+	seedFlag := fs.Int64("seed", 0, "seed of the random choices, to replay a run (default random)")
+	fakeClockFlag := fs.String("fakeclock", "", "use a fake clock starting at this RFC 3339 time, for replays")
 	fs.Parse(os.Args[1:])
 
-	logLevel := new(slog.LevelVar)
-	logHandler := multiHandler([]slog.Handler{
-		slog.Handler(slog.NewJSONHandler(os.Stdout,
-			&slog.HandlerOptions{AddSource: true, Level: logLevel})),
-		slog.Handler(slog.NewTextHandler(os.Stderr,
-			&slog.HandlerOptions{Level: logLevel})),
-	})
-	logger := slog.New(logHandler)
+	lg, err := newLogging(LoggingConfig{})
+	if err != nil {
+		panic(err)
+	}
+	logger := slog.New(lg.handler(""))
+
+	c, err := readConfig(*configFlag)
+	if err != nil {
+		logger.Error("failed to load config", "err", err)
+		os.Exit(1)
+	}
 
-	http.HandleFunc("/debug/logson", func(w http.ResponseWriter, r *http.Request) {
+	lg, err = newLogging(c.Logging)
+	if err != nil {
+		logger.Error("failed to configure logging", "err", err)
+		os.Exit(1)
+	}
+	logLevel, logHandler := lg.level, lg.handler("")
+	logger = slog.New(logHandler)
+
+	seed := *seedFlag
+	if seed == 0 {
+		seed = ctlog.RandomSeed()
+	}
+	logger.Info("seeded random choices", "seed", seed)
+	var clock ctlog.Clock
+	if *fakeClockFlag != "" {
+		start, err := time.Parse(time.RFC3339, *fakeClockFlag)
+		if err != nil {
+			logger.Error("failed to parse -fakeclock", "err", err)
+			os.Exit(1)
+		}
+		logger.Warn("using a fake clock", "start", start)
+		clock = ctlog.NewFakeClock(start)
+	}
+
+	if err := setMemoryLimit(c, logger); err != nil {
+		logger.Error("failed to set memory limit", "err", err)
+		os.Exit(1)
+	}
+	readTimeout, writeTimeout, idleTimeout, err := serverTimeouts(c)
+	if err != nil {
+		logger.Error("invalid HTTP server timeouts", "err", err)
+		os.Exit(1)
+	}
+
+	// The debug endpoints are served from their own mux, rather than
+	// http.DefaultServeMux, where net/http/pprof registers itself on import.
+	debugMux := http.NewServeMux()
+	debugMux.HandleFunc("/debug/logson", func(w http.ResponseWriter, r *http.Request) {
 		logLevel.Set(slog.LevelDebug)
 		w.WriteHeader(http.StatusOK)
 	})
-	http.HandleFunc("/debug/logsoff", func(w http.ResponseWriter, r *http.Request) {
+	debugMux.HandleFunc("/debug/logsoff", func(w http.ResponseWriter, r *http.Request) {
 		logLevel.Set(slog.LevelInfo)
 		w.WriteHeader(http.StatusOK)
 	})
+	if c.Debug.Profiling {
+		debugMux.HandleFunc("/debug/pprof/", pprof.Index)
+		debugMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		debugMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		debugMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		debugMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		debugMux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+		})
+	}
+	debugListen := c.Debug.Listen
+	if debugListen == "" {
+		debugListen = "localhost:"
+	}
 	go func() {
-		ln, err := net.Listen("tcp", "localhost:")
+		ln, err := net.Listen("tcp", debugListen)
 		if err != nil {
 			logger.Error("failed to start debug server", "err", err)
 		} else {
 			logger.Info("debug server listening", "addr", ln.Addr())
-			err := http.Serve(ln, nil)
+			if c.Debug.MaxConnections > 0 {
+				ln = netutil.LimitListener(ln, c.Debug.MaxConnections)
+			}
+			err := http.Serve(ln, debugMux)
 			logger.Error("debug server exited", "err", err)
 		}
 	}()
 
-	yml, err := os.ReadFile(*configFlag)
-	if err != nil {
-		logger.Error("failed to read config file", "err", err)
-		os.Exit(1)
-	}
-	c := &Config{}
-	if err := yaml.Unmarshal(yml, c); err != nil {
-		logger.Error("failed to parse config file", "err", err)
-		os.Exit(1)
-	}
-
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	auth, err := newAdminAuth(c.Admin.TokenFile, c.Admin.ClientCAs)
+	if err != nil {
+		logger.Error("failed to load Admin configuration", "err", err)
+		os.Exit(1)
+	}
+	if c.Admin.PublicDebug {
+		if !auth.enabled() {
+			logger.Error("Admin.PublicDebug requires Admin.TokenFile or Admin.ClientCAs")
+			os.Exit(1)
+		}
+		mux.Handle("/debug/", auth.wrap(debugMux))
+	}
+
 	metrics := prometheus.NewRegistry()
 	metrics.MustRegister(collectors.NewGoCollector())
 	metrics.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
-	mux.Handle("/metrics", promhttp.HandlerFor(metrics, promhttp.HandlerOpts{
-		ErrorLog: slog.NewLogLogger(logHandler.WithAttrs(
+	mux.Handle("/metrics", auth.wrap(promhttp.HandlerFor(metrics, promhttp.HandlerOpts{
+		EnableOpenMetrics: c.TraceExemplars,
+		ErrorLog: slog.NewLogLogger(lg.handler("metrics").WithAttrs(
 			[]slog.Attr{slog.String("source", "metrics")},
 		), slog.LevelWarn),
-	}))
+	})))
 	sunlightMetrics := prometheus.WrapRegistererWithPrefix("sunlight_", metrics)
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	var db ctlog.LockBackend
-	switch {
-	case c.Checkpoints != "" && c.DynamoDB.Table != "" ||
-		c.Checkpoints != "" && c.ETagS3.Bucket != "" ||
-		c.DynamoDB.Table != "" && c.ETagS3.Bucket != "":
-		logger.Error("only one of Checkpoints, DynamoDB, or ETagS3 can be set at the same time")
+	probes := &probes{}
+	go func() {
+		<-ctx.Done()
+		probes.ready.Store(false)
+		sdNotify(logger, "STOPPING=1")
+	}()
+	if c.Kubernetes.ProbesListen != "" {
+		go func() {
+			ln, err := net.Listen("tcp", c.Kubernetes.ProbesListen)
+			if err != nil {
+				logger.Error("failed to start probes server", "err", err)
+				return
+			}
+			err = http.Serve(ln, probes.Handler())
+			logger.Error("probes server exited", "err", err)
+		}()
+	}
+
+	db, err := newLockBackend(ctx, c, slog.New(lg.handler("lock")))
+	if err != nil {
+		logger.Error("failed to create lock backend", "err", err)
 		os.Exit(1)
+	}
+	sunlightMetrics.MustRegister(db.Metrics()...)
 
-	case c.Checkpoints != "":
-		b, err := ctlog.NewSQLiteBackend(ctx, c.Checkpoints, logger)
+	ln, handoff, err := inheritedUpgrade()
+	if err != nil {
+		logger.Error("failed to inherit from old process", "err", err)
+		os.Exit(1)
+	}
+	if ln == nil {
+		ln, err = listen(c.Listen, c.Listener)
 		if err != nil {
-			logger.Error("failed to create SQLite checkpoint backend", "err", err)
+			logger.Error("failed to listen", "addr", c.Listen, "err", err)
+			os.Exit(1)
+		}
+	}
+	logger.Info("listening", "addr", ln.Addr())
+	// The binary upgrades pass ln itself, and the server accepts from the
+	// wrapped listener.
+	serveLn, err := c.Listener.wrap(ln)
+	if err != nil {
+		logger.Error("invalid Listener configuration", "err", err)
+		os.Exit(1)
+	}
+	if handoff != nil {
+		// Take over as the main process of the systemd service before the
+		// old process exits. This requires NotifyAccess=all.
+		sdNotify(logger, fmt.Sprintf("MAINPID=%d", os.Getpid()))
+		logger.Info("waiting for old process to stop sequencing")
+		if err := handoff.Wait(); err != nil {
+			logger.Error("failed to take over from old process", "err", err)
 			os.Exit(1)
 		}
-		sunlightMetrics.MustRegister(b.Metrics()...)
-		db = b
+	}
 
-	case c.DynamoDB.Table != "":
-		b, err := ctlog.NewDynamoDBBackend(ctx,
-			c.DynamoDB.Region, c.DynamoDB.Table, c.DynamoDB.Endpoint, logger)
+	var lease *leaseElector
+	if c.Kubernetes.Lease.Name != "" {
+		lease, err = newLeaseElector(&c.Kubernetes, slog.New(lg.handler("lease")))
 		if err != nil {
-			logger.Error("failed to create DynamoDB backend", "err", err)
+			logger.Error("failed to configure Kubernetes lease", "err", err)
+			os.Exit(1)
+		}
+		// Only the leader loads the logs, so that it starts from the latest
+		// checkpoint written by the previous one.
+		if err := lease.Acquire(ctx); err != nil {
+			logger.Info("stopped while waiting for Kubernetes lease")
 			os.Exit(1)
 		}
-		sunlightMetrics.MustRegister(b.Metrics()...)
-		db = b
+		go lease.Hold(ctx, func() {
+			probes.ready.Store(false)
+			stop()
+		})
+	}
 
-	case c.ETagS3.Bucket != "":
-		b, err := ctlog.NewETagBackend(ctx,
-			c.ETagS3.Region, c.ETagS3.Bucket, c.ETagS3.Endpoint, logger)
+	var region *regionLease
+	var passive bool
+	if c.Region.Name != "" {
+		region, err = newRegionLease(&c.Region, db, slog.New(lg.handler("lease")))
 		if err != nil {
-			logger.Error("failed to create ETag S3 backend", "err", err)
+			logger.Error("failed to configure region lease", "err", err)
 			os.Exit(1)
 		}
-		sunlightMetrics.MustRegister(b.Metrics()...)
-		db = b
+		sunlightMetrics.MustRegister(region.Metrics()...)
+		// If the lock backend can't be reached, start as passive and keep
+		// trying, rather than failing to serve reads too.
+		ok, _ := region.TryAcquire(ctx)
+		passive = !ok
+	}
 
+	seqCtx, cancelSeq := context.WithCancel(ctx)
+	defer cancelSeq()
+	sequencerGroup, sequencerContext := errgroup.WithContext(seqCtx)
+
+	var latencyMetrics ctlog.LatencyMetricsMode
+	switch c.LatencyMetrics {
+	case "", "summary":
+		latencyMetrics = ctlog.LatencySummaries
+	case "histogram":
+		latencyMetrics = ctlog.LatencyHistograms
+	case "native-histogram":
+		latencyMetrics = ctlog.LatencyNativeHistograms
 	default:
-		logger.Error("neither Checkpoints nor DynamoDB are set, one must be used")
+		logger.Error("unknown LatencyMetrics type", "type", c.LatencyMetrics)
+		os.Exit(1)
+	}
+	if c.TraceExemplars && latencyMetrics == ctlog.LatencySummaries {
+		logger.Error("TraceExemplars requires histogram LatencyMetrics")
 		os.Exit(1)
 	}
 
-	sequencerGroup, sequencerContext := errgroup.WithContext(ctx)
+	var alerter ctlog.Alerter
+	if len(c.Alerts.Webhooks) > 0 {
+		a, err := newWebhookAlerter(c.Alerts, logger)
+		if err != nil {
+			logger.Error("failed to load Alerts configuration", "err", err)
+			os.Exit(1)
+		}
+		alerter = a
+	}
 
+	reloads := &reloader{path: *configFlag, lg: lg, logger: logger,
+		config: c, logs: make(map[string]*liveLog)}
+	logs := make(map[string]*ctlog.Log)
 	for _, lc := range c.Logs {
 		if lc.Name == "" || lc.ShortName == "" {
 			logger.Error("missing name or short name for log")
 			os.Exit(1)
 		}
-		logger := slog.New(logHandler.WithAttrs([]slog.Attr{
-			slog.String("log", lc.ShortName),
-		}))
+		logAttrs := []slog.Attr{slog.String("log", lc.ShortName)}
+		logger := slog.New(lg.handler("log").WithAttrs(logAttrs))
+		backendLogger := slog.New(lg.handler("backend").WithAttrs(logAttrs))
+		signerLogger := slog.New(lg.handler("signer").WithAttrs(logAttrs))
 
-		b, err := ctlog.NewS3Backend(ctx, lc.S3Region, lc.S3Bucket, lc.S3Endpoint, lc.S3KeyPrefix, logger)
+		b, err := ctlog.NewS3Backend(ctx, lc.S3Region, lc.S3Bucket, lc.S3Endpoint, lc.S3KeyPrefix, backendLogger)
 		if err != nil {
 			logger.Error("failed to create backend", "err", err)
 			os.Exit(1)
 		}
+		b.SetMaxInFlight(lc.MaxBackendRequests)
+		b.SetSeed(seed)
+		transportOpts := ctlog.S3TransportOptions{
+			MaxIdleConnsPerHost: lc.S3Transport.MaxIdleConnsPerHost,
+			TLSSessionCacheSize: lc.S3Transport.TLSSessionCacheSize,
+		}
+		if lc.S3Transport.IdleConnTimeout != "" {
+			transportOpts.IdleConnTimeout, err = time.ParseDuration(lc.S3Transport.IdleConnTimeout)
+			if err != nil {
+				logger.Error("failed to parse S3Transport.IdleConnTimeout", "err", err)
+				os.Exit(1)
+			}
+		}
+		b.SetTransportOptions(transportOpts)
+		if err := b.SetCompression(compressionOptions(&lc)); err != nil {
+			logger.Error("invalid Compression", "err", err)
+			os.Exit(1)
+		}
+		hedgingOpts, err := hedgingOptions(&lc)
+		if err == nil {
+			err = b.SetHedging(hedgingOpts)
+		}
+		if err != nil {
+			logger.Error("invalid Hedging", "err", err)
+			os.Exit(1)
+		}
+		if n := lc.S3Transport.PrewarmConnections; n > 0 {
+			if err := b.Prewarm(ctx, n); err != nil {
+				logger.Warn("failed to prewarm S3 connections", "err", err)
+			}
+		}
+		features, err := ctlog.NewFeatures(lc.Features)
+		if err != nil {
+			logger.Error("invalid Features", "err", err)
+			os.Exit(1)
+		}
+		b.SetFeatures(features)
+		prometheus.WrapRegistererWith(prometheus.Labels{"log": lc.ShortName}, sunlightMetrics).
+			MustRegister(features.Metrics()...)
+
+		var ccadb *ccadbSyncer
+		ccadbSyncInterval := defaultCCADBSyncInterval
+		if len(lc.CCADB.Stores) > 0 {
+			ccadb = &ccadbSyncer{
+				url:    lc.CCADB.URL,
+				stores: lc.CCADB.Stores,
+				roots:  lc.Roots,
+				audit:  lc.CCADB.AuditLog,
+				logger: logger,
+			}
+			if ccadb.url == "" {
+				ccadb.url = defaultCCADBURL
+			}
+			if lc.CCADB.SyncInterval != "" {
+				ccadbSyncInterval, err = time.ParseDuration(lc.CCADB.SyncInterval)
+				if err != nil {
+					logger.Error("failed to parse CCADB.SyncInterval", "err", err)
+					os.Exit(1)
+				}
+			}
+			// Bootstrap the roots file on first run.
+			if _, err := os.Stat(lc.Roots); errors.Is(err, os.ErrNotExist) {
+				logger.Info("fetching initial roots from CCADB")
+				pemBytes, err := ccadb.fetch(ctx)
+				if err != nil {
+					logger.Error("failed to fetch roots from CCADB", "err", err)
+					os.Exit(1)
+				}
+				if err := writeFileAtomic(lc.Roots, pemBytes); err != nil {
+					logger.Error("failed to write roots", "err", err)
+					os.Exit(1)
+				}
+			}
+		}
 
-		r := x509util.NewPEMCertPool()
-		if err := r.AppendCertsFromPEMFile(lc.Roots); err != nil {
+		r, rootsPEM, err := loadRoots(ctx, lc.Roots)
+		if err != nil {
 			logger.Error("failed to load roots", "err", err)
 			os.Exit(1)
 		}
+		rootsReloadInterval := defaultRootsReloadInterval
+		if lc.RootsReloadInterval != "" {
+			rootsReloadInterval, err = time.ParseDuration(lc.RootsReloadInterval)
+			if err != nil {
+				logger.Error("failed to parse RootsReloadInterval", "err", err)
+				os.Exit(1)
+			}
+		}
 
-		keyPEM, err := os.ReadFile(lc.Key)
+		var deniedRoots [][sha256.Size]byte
+		for _, h := range lc.DeniedRoots {
+			b, err := hex.DecodeString(h)
+			if err != nil || len(b) != sha256.Size {
+				logger.Error("invalid DeniedRoots hash", "hash", h)
+				os.Exit(1)
+			}
+			deniedRoots = append(deniedRoots, [sha256.Size]byte(b))
+		}
+
+		var testRoots *x509util.PEMCertPool
+		testRootsToken, err := resolveSecret(lc.TestRootsToken)
 		if err != nil {
-			logger.Error("failed to load key", "err", err)
+			logger.Error("failed to resolve TestRootsToken", "err", err)
 			os.Exit(1)
 		}
-		block, _ := pem.Decode(keyPEM)
-		if block == nil || block.Type != "PRIVATE KEY" {
-			logger.Error("failed to parse key PEM")
-			os.Exit(1)
+		if lc.TestRoots != "" {
+			if testRootsToken == "" {
+				logger.Error("TestRoots requires TestRootsToken")
+				os.Exit(1)
+			}
+			testRoots = x509util.NewPEMCertPool()
+			if err := testRoots.AppendCertsFromPEMFile(lc.TestRoots); err != nil {
+				logger.Error("failed to load test roots", "err", err)
+				os.Exit(1)
+			}
+		}
+
+		var crossSigned *x509util.PEMCertPool
+		if lc.CrossSigned != "" {
+			crossSigned = x509util.NewPEMCertPool()
+			if err := crossSigned.AppendCertsFromPEMFile(lc.CrossSigned); err != nil {
+				logger.Error("failed to load cross-signed intermediates", "err", err)
+				os.Exit(1)
+			}
 		}
-		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+		signer, signerMetrics, err := newSigner(ctx, &lc, signerLogger)
 		if err != nil {
-			logger.Error("failed to parse key", "err", err)
+			logger.Error("failed to load log key", "err", err)
 			os.Exit(1)
 		}
-		if _, ok := k.(*ecdsa.PrivateKey); !ok {
-			logger.Error("key is not an ECDSA private key")
-			os.Exit(1)
+		if len(signerMetrics) > 0 {
+			prometheus.WrapRegistererWith(prometheus.Labels{"log": lc.ShortName}, sunlightMetrics).
+				MustRegister(signerMetrics...)
+		}
+
+		var checkpointSigners []note.Signer
+		for _, path := range lc.CheckpointKeys {
+			s, err := loadNoteSigner(path, lc.KeyIdentityFile, lc.KeyPassphraseFile)
+			if err != nil {
+				logger.Error("failed to load checkpoint key", "path", path, "err", err)
+				os.Exit(1)
+			}
+			checkpointSigners = append(checkpointSigners, s)
 		}
 
 		if lc.PublicKey != "" {
@@ -351,8 +1528,8 @@ func main() {
 				os.Exit(1)
 			}
 
-			if !k.(*ecdsa.PrivateKey).PublicKey.Equal(parsedPubKey) {
-				spki, err := x509.MarshalPKIXPublicKey(&k.(*ecdsa.PrivateKey).PublicKey)
+			if !signer.Public().(*ecdsa.PublicKey).Equal(parsedPubKey) {
+				spki, err := x509.MarshalPKIXPublicKey(signer.Public())
 				if err != nil {
 					logger.Error("failed to marshal public key from private key for display", "err", err)
 					os.Exit(1)
@@ -375,17 +1552,158 @@ func main() {
 			os.Exit(1)
 		}
 
+		var submissionTimeout time.Duration
+		if lc.SubmissionTimeout != "" {
+			submissionTimeout, err = time.ParseDuration(lc.SubmissionTimeout)
+			if err != nil {
+				logger.Error("failed to parse SubmissionTimeout", "err", err)
+				os.Exit(1)
+			}
+		}
+
+		var clockSkew time.Duration
+		if lc.ClockSkew != "" {
+			clockSkew, err = time.ParseDuration(lc.ClockSkew)
+			if err != nil {
+				logger.Error("failed to parse ClockSkew", "err", err)
+				os.Exit(1)
+			}
+		}
+
+		rejectAlgs, err := parseSignatureAlgorithms(lc.RejectSignatureAlgorithms)
+		if err != nil {
+			logger.Error("failed to parse RejectSignatureAlgorithms", "err", err)
+			os.Exit(1)
+		}
+
+		var dedup ctlog.DedupMode
+		switch lc.Dedup {
+		case "", "leaf":
+			dedup = ctlog.DedupLeaf
+		case "tbs":
+			dedup = ctlog.DedupTBS
+		default:
+			logger.Error("unknown Dedup mode", "dedup", lc.Dedup)
+			os.Exit(1)
+		}
+
+		var loggedPrecert ctlog.LoggedPrecertAction
+		switch lc.LoggedPrecert {
+		case "", "log":
+			loggedPrecert = ctlog.LoggedPrecertLog
+		case "reject":
+			loggedPrecert = ctlog.LoggedPrecertReject
+		case "sct":
+			loggedPrecert = ctlog.LoggedPrecertSCT
+		default:
+			logger.Error("unknown LoggedPrecert action", "action", lc.LoggedPrecert)
+			os.Exit(1)
+		}
+
+		var policy ctlog.SubmissionPolicy
+		if len(lc.Policy.Command) > 0 && lc.Policy.Webhook != "" {
+			logger.Error("only one of Policy.Command and Policy.Webhook can be set")
+			os.Exit(1)
+		}
+		if len(lc.Policy.Command) > 0 || lc.Policy.Webhook != "" {
+			p := &externalPolicy{
+				shortName: lc.ShortName,
+				command:   lc.Policy.Command,
+				webhook:   lc.Policy.Webhook,
+				timeout:   defaultPolicyTimeout,
+				failOpen:  lc.Policy.FailOpen,
+				logger:    logger,
+			}
+			if lc.Policy.Timeout != "" {
+				p.timeout, err = time.ParseDuration(lc.Policy.Timeout)
+				if err != nil {
+					logger.Error("failed to parse Policy.Timeout", "err", err)
+					os.Exit(1)
+				}
+			}
+			policy = p
+		}
+
+		var tileStore *ctlog.TileStore
+		if lc.TileStore.Path != "" {
+			size, err := tileStoreSize(&lc)
+			if err != nil {
+				logger.Error("invalid TileStore.Size", "err", err)
+				os.Exit(1)
+			}
+			tileStore, err = ctlog.OpenTileStore(lc.TileStore.Path, size)
+			if err != nil {
+				logger.Error("failed to open tile store", "err", err)
+				os.Exit(1)
+			}
+		}
+
+		var stateTimestamp time.Time
+		if lc.State != "" {
+			stateTimestamp, err = time.Parse(time.RFC3339, lc.StateTimestamp)
+			if err != nil {
+				logger.Error("failed to parse StateTimestamp", "err", err)
+				os.Exit(1)
+			}
+		}
+
 		cc := &ctlog.Config{
 			Name:          lc.Name,
-			Key:           k.(*ecdsa.PrivateKey),
+			Key:           signer,
 			Cache:         lc.Cache,
 			PoolSize:      lc.PoolSize,
 			Backend:       b,
 			Lock:          db,
 			Log:           logger,
+			Alerter:       alerter,
+			Clock:         clock,
+			Seed:          seed,
 			Roots:         r,
 			NotAfterStart: notAfterStart,
 			NotAfterLimit: notAfterLimit,
+			CrossSigned:   crossSigned,
+
+			DeniedRoots:    deniedRoots,
+			TestRoots:      testRoots,
+			TestRootsToken: testRootsToken,
+
+			MaxChainLength:     lc.MaxChainLength,
+			MaxCertificateSize: lc.MaxCertificateSize,
+
+			RejectExpired:     lc.RejectExpired,
+			RejectNotYetValid: lc.RejectNotYetValid,
+			ClockSkew:         clockSkew,
+			MaxValidity:       time.Duration(lc.MaxValidityDays) * 24 * time.Hour,
+			Policy:            policy,
+			Dedup:             dedup,
+			LoggedPrecert:     loggedPrecert,
+			LatencyMetrics:    latencyMetrics,
+			TraceExemplars:    c.TraceExemplars,
+			Audit:             lc.Audit.Enabled,
+			ClientIPHeader:    lc.Audit.ClientIPHeader,
+
+			SigningWorkers:    lc.SigningWorkers,
+			SigningQueueSize:  lc.SigningQueueSize,
+			CheckpointSigners: checkpointSigners,
+
+			MaxConcurrentValidations: lc.MaxConcurrentValidations,
+			SubmissionTimeout:        submissionTimeout,
+
+			RejectPrecertSigningCerts: lc.RejectPrecertSigningCerts,
+			MinRSAKeySize:             lc.MinRSAKeySize,
+			RejectSHA1:                lc.RejectSHA1,
+			RejectSignatureAlgorithms: rejectAlgs,
+
+			MonitoringAPI: lc.ServeMonitoring,
+			TileStore:     tileStore,
+			CORSOrigins:   lc.CORSOrigins,
+
+			Description:    lc.Description,
+			SubmissionURL:  lc.SubmissionURL,
+			MonitoringURL:  lc.MonitoringURL,
+			MMD:            time.Duration(lc.MMD) * time.Second,
+			State:          lc.State,
+			StateTimestamp: stateTimestamp,
 		}
 
 		if time.Now().Format(time.DateOnly) == lc.Inception {
@@ -403,10 +1721,109 @@ func main() {
 			os.Exit(1)
 		}
 		defer l.CloseCache()
+		logs[lc.ShortName] = l
+		ll := &liveLog{ctx: ctx, l: l, logger: logger, features: features}
+		reloads.logs[lc.ShortName] = ll
 
-		sequencerGroup.Go(func() error {
-			return l.RunSequencer(sequencerContext, 1*time.Second)
-		})
+		if lc.Maintenance != "" {
+			l.SetMaintenance(lc.Maintenance)
+		}
+
+		if ccadb != nil {
+			ccadb.log = l
+			go ccadb.run(ctx, rootsPEM, ccadbSyncInterval)
+		} else {
+			ll.watchRoots(lc.Roots, rootsPEM, rootsReloadInterval)
+		}
+
+		if lc.Audit.Enabled {
+			auditInterval := defaultAuditInterval
+			if lc.Audit.Interval != "" {
+				auditInterval, err = time.ParseDuration(lc.Audit.Interval)
+				if err != nil {
+					logger.Error("failed to parse Audit.Interval", "err", err)
+					os.Exit(1)
+				}
+			}
+			// Run in the sequencer group, so that the last records are
+			// uploaded before exiting.
+			sequencerGroup.Go(func() error {
+				l.RunAuditLog(sequencerContext, auditInterval)
+				return nil
+			})
+		}
+
+		signerCheckInterval, signerCheckMaxLatency := defaultSignerCheckInterval, time.Duration(0)
+		if lc.SignerCheck.Interval != "" {
+			signerCheckInterval, err = time.ParseDuration(lc.SignerCheck.Interval)
+			if err != nil {
+				logger.Error("failed to parse SignerCheck.Interval", "err", err)
+				os.Exit(1)
+			}
+		}
+		if lc.SignerCheck.MaxLatency != "" {
+			signerCheckMaxLatency, err = time.ParseDuration(lc.SignerCheck.MaxLatency)
+			if err != nil {
+				logger.Error("failed to parse SignerCheck.MaxLatency", "err", err)
+				os.Exit(1)
+			}
+		}
+		if signerCheckInterval > 0 {
+			go l.RunSignerCheck(ctx, signerCheckInterval, signerCheckMaxLatency)
+		}
+
+		if lc.SelfMonitor.Enabled {
+			if lc.MonitoringURL == "" {
+				logger.Error("SelfMonitor requires MonitoringURL")
+				os.Exit(1)
+			}
+			selfMonitorInterval := defaultSelfMonitorInterval
+			if lc.SelfMonitor.Interval != "" {
+				selfMonitorInterval, err = time.ParseDuration(lc.SelfMonitor.Interval)
+				if err != nil {
+					logger.Error("failed to parse SelfMonitor.Interval", "err", err)
+					os.Exit(1)
+				}
+			}
+			selfMonitorSamples := defaultSelfMonitorSamples
+			if lc.SelfMonitor.Samples != 0 {
+				selfMonitorSamples = lc.SelfMonitor.Samples
+			}
+			go l.RunSelfMonitor(ctx, selfMonitorInterval, selfMonitorSamples)
+		}
+
+		if lc.MonitoringURL != "" {
+			ll.client, err = client.New(&client.Config{
+				MonitoringPrefix: lc.MonitoringURL,
+				Name:             lc.Name,
+				PublicKey:        signer.Public(),
+				UserAgent:        "filippo.io/sunlight witness",
+			})
+			if err != nil {
+				logger.Error("failed to create witness client", "err", err)
+				os.Exit(1)
+			}
+		}
+		if len(lc.Witnesses) > 0 {
+			if ll.client == nil {
+				logger.Error("Witnesses requires MonitoringURL")
+				os.Exit(1)
+			}
+			var witnesses []*client.Witness
+			for _, w := range lc.Witnesses {
+				cw, err := newWitness(w.URL, w.PublicKey, nil, "filippo.io/sunlight witness")
+				if err != nil {
+					logger.Error("failed to configure witness", "url", w.URL, "err", err)
+					os.Exit(1)
+				}
+				witnesses = append(witnesses, cw)
+			}
+			ll.runWitnesses(witnesses)
+		}
+
+		if passive {
+			l.SetPassive(true)
+		}
 
 		mux.Handle(lc.HTTPPrefix+"/", http.StripPrefix(lc.HTTPPrefix, l.Handler()))
 
@@ -414,19 +1831,224 @@ func main() {
 			MustRegister(l.Metrics()...)
 	}
 
+	startSequencers := func() {
+		for _, l := range logs {
+			sequencerGroup.Go(func() error {
+				return l.RunSequencer(sequencerContext, 1*time.Second)
+			})
+		}
+	}
+	switch {
+	case region == nil:
+		startSequencers()
+	case !passive:
+		startSequencers()
+		sequencerGroup.Go(func() error {
+			region.Hold(sequencerContext, stop)
+			return nil
+		})
+	default:
+		// The passive instance keeps serving reads until it takes over, and
+		// then reloads the logs from the checkpoints of the previous holder.
+		sequencerGroup.Go(func() error {
+			if err := region.Acquire(sequencerContext); err != nil {
+				return err
+			}
+			for name, l := range logs {
+				if err := l.Resync(sequencerContext); err != nil {
+					logger.Error("failed to reload log after taking over", "log", name, "err", err)
+					stop()
+					return err
+				}
+				l.SetPassive(false)
+			}
+			startSequencers()
+			region.Hold(sequencerContext, stop)
+			return nil
+		})
+	}
+
+	if len(c.Witness.Logs) > 0 {
+		logger := slog.New(lg.handler("witness"))
+		w, err := newWitnessServer(&c.Witness, db, logger)
+		if err != nil {
+			logger.Error("failed to configure witness", "err", err)
+			os.Exit(1)
+		}
+		prefix := c.Witness.HTTPPrefix
+		if prefix == "" {
+			prefix = "/witness"
+		}
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, w.Handler()))
+		logger.Info("witnessing logs", "logs", len(c.Witness.Logs), "prefix", prefix)
+	}
+
+	if c.NTP.Server != "" && c.NTP.DateURL != "" {
+		logger.Error("only one of NTP.Server and NTP.DateURL can be set")
+		os.Exit(1)
+	}
+	if c.NTP.Server != "" || c.NTP.DateURL != "" {
+		maxOffset, interval := defaultNTPMaxOffset, defaultNTPInterval
+		server, measure := c.NTP.Server, ntpOffset
+		if c.NTP.DateURL != "" {
+			maxOffset = defaultDateMaxOffset
+			server, measure = c.NTP.DateURL, httpDateOffset
+		}
+		var err error
+		if c.NTP.MaxOffset != "" {
+			if maxOffset, err = time.ParseDuration(c.NTP.MaxOffset); err != nil {
+				logger.Error("failed to parse NTP.MaxOffset", "err", err)
+				os.Exit(1)
+			}
+		}
+		if c.NTP.Interval != "" {
+			if interval, err = time.ParseDuration(c.NTP.Interval); err != nil {
+				logger.Error("failed to parse NTP.Interval", "err", err)
+				os.Exit(1)
+			}
+		}
+		nc := &ntpChecker{
+			server:    server,
+			measure:   measure,
+			maxOffset: maxOffset,
+			logs:      logs,
+			logger:    logger,
+			offset: prometheus.NewGauge(prometheus.GaugeOpts{
+				Name: "ntp_offset_seconds",
+				Help: "Offset of the local clock from the NTP or Date server, positive if behind.",
+			}),
+		}
+		sunlightMetrics.MustRegister(nc.offset)
+		nc.check(ctx)
+		go nc.run(ctx, interval)
+	}
+
+	if c.StatsD.Address != "" {
+		interval := defaultStatsDInterval
+		if c.StatsD.Interval != "" {
+			if interval, err = time.ParseDuration(c.StatsD.Interval); err != nil {
+				logger.Error("failed to parse StatsD.Interval", "err", err)
+				os.Exit(1)
+			}
+		}
+		sp, err := newStatsDPusher(metrics, c.StatsD.Address, c.StatsD.Prefix,
+			slog.New(lg.handler("metrics")))
+		if err != nil {
+			logger.Error("failed to set up StatsD", "err", err)
+			os.Exit(1)
+		}
+		go sp.run(ctx, interval)
+	}
+
+	// The maintenance endpoints apply to the log with the short name passed as
+	// the "log" query parameter, or to all logs if it's missing.
+	setMaintenance := func(w http.ResponseWriter, r *http.Request, message string) {
+		name := r.URL.Query().Get("log")
+		if name == "" {
+			for _, l := range logs {
+				l.SetMaintenance(message)
+			}
+		} else if l, ok := logs[name]; ok {
+			l.SetMaintenance(message)
+		} else {
+			http.Error(w, "unknown log", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	debugMux.HandleFunc("/debug/maintenanceon", func(w http.ResponseWriter, r *http.Request) {
+		message := r.URL.Query().Get("message")
+		if message == "" {
+			message = "The log is undergoing scheduled maintenance."
+		}
+		setMaintenance(w, r, message)
+	})
+	debugMux.HandleFunc("/debug/maintenanceoff", func(w http.ResponseWriter, r *http.Request) {
+		setMaintenance(w, r, "")
+	})
+	// The feature endpoints work like the maintenance ones, with the feature
+	// name in the "feature" query parameter.
+	setFeature := func(w http.ResponseWriter, r *http.Request, set func(*ctlog.Features, ctlog.Feature) error) {
+		feature, err := ctlog.ParseFeature(r.URL.Query().Get("feature"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := r.URL.Query().Get("log")
+		if _, ok := reloads.logs[name]; name != "" && !ok {
+			http.Error(w, "unknown log", http.StatusNotFound)
+			return
+		}
+		for short, ll := range reloads.logs {
+			if name != "" && short != name {
+				continue
+			}
+			if err := set(ll.features, feature); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ll.logger.Info("feature override changed", "feature", feature,
+				"enabled", ll.features.Enabled(feature))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	debugMux.HandleFunc("/debug/featureon", func(w http.ResponseWriter, r *http.Request) {
+		setFeature(w, r, func(f *ctlog.Features, name ctlog.Feature) error { return f.Override(name, true) })
+	})
+	debugMux.HandleFunc("/debug/featureoff", func(w http.ResponseWriter, r *http.Request) {
+		setFeature(w, r, func(f *ctlog.Features, name ctlog.Feature) error { return f.Override(name, false) })
+	})
+	debugMux.HandleFunc("/debug/featurereset", func(w http.ResponseWriter, r *http.Request) {
+		setFeature(w, r, (*ctlog.Features).ClearOverride)
+	})
+	debugMux.HandleFunc("/debug/features", func(w http.ResponseWriter, r *http.Request) {
+		state := make(map[string][]ctlog.FeatureState)
+		for name, ll := range reloads.logs {
+			state[name] = ll.features.State()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(state); err != nil {
+			logger.Debug("failed to write features response", "err", err)
+		}
+	})
+	debugMux.HandleFunc("/debug/state", func(w http.ResponseWriter, r *http.Request) {
+		state := make(map[string]*ctlog.DebugState)
+		for name, l := range logs {
+			state[name] = l.DebugState()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(state); err != nil {
+			logger.Debug("failed to write state response", "err", err)
+		}
+	})
+
+	debugMux.HandleFunc("/debug/reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := reloads.reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	handleReloads(ctx, reloads)
+
+	httpHandler := lg.handler("http")
 	s := &http.Server{
-		Addr:         c.Listen,
 		Handler:      mux,
 		ConnContext:  ctlog.ReusedConnContext,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+		IdleTimeout:  idleTimeout,
 		ErrorLog: slog.NewLogLogger(filterHandler{
-			handler: logHandler.WithAttrs(
+			handler: httpHandler.WithAttrs(
 				[]slog.Attr{slog.String("source", "http.Server")},
 			),
 			filter: func(r slog.Record) bool {
 				// Unless debug logging is enabled, hide Internet background radiation.
-				if logHandler.Enabled(context.Background(), slog.LevelDebug) {
+				if httpHandler.Enabled(context.Background(), slog.LevelDebug) {
 					return true
 				}
 				if !strings.HasPrefix(r.Message, "http: TLS handshake error") {
@@ -465,25 +2087,237 @@ func main() {
 		s.Handler = h2c.NewHandler(s.Handler, &http2.Server{})
 		s.Handler = http.MaxBytesHandler(s.Handler, 128*1024)
 	}
+	if auth.clientCAs != nil {
+		if s.TLSConfig == nil {
+			logger.Error("Admin.ClientCAs requires ACME or -testcert")
+			os.Exit(1)
+		}
+		// CT clients don't send certificates, so they are optional, and only
+		// checked by the admin endpoints.
+		s.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		s.TLSConfig.ClientCAs = auth.clientCAs
+	}
 
 	go func() {
+		var err error
 		if s.TLSConfig != nil {
-			err := s.ListenAndServeTLS("", "")
-			logger.Error("ListenAndServeTLS error", "err", err)
+			err = s.ServeTLS(serveLn, "", "")
+			logger.Error("ServeTLS error", "err", err)
 		} else {
-			err := s.ListenAndServe()
-			logger.Error("ListenAndServe error", "err", err)
+			err = s.Serve(serveLn)
+			logger.Error("Serve error", "err", err)
+		}
+		if err != http.ErrServerClosed {
+			stop()
 		}
-		stop()
 	}()
+	if ctx.Err() == nil {
+		probes.ready.Store(true)
+		sdNotify(logger, "READY=1")
+		go runWatchdog(ctx, logs, logger)
+	}
+
+	upgraded := handleUpgrades(ctx, ln, logger, func() {
+		// Let pending requests complete while the sequencers are still
+		// running, and only then stop the sequencers.
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			logger.Error("Shutdown error", "err", err)
+		}
+		cancelSeq()
+	})
 
 	sequencerGroup.Wait()
 
+	select {
+	case handoff := <-upgraded:
+		handoff.Close()
+		logger.Info("handed off to new process")
+		os.Exit(0)
+	default:
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := s.Shutdown(ctx); err != nil {
 		logger.Error("Shutdown error", "err", err)
 	}
+	if lease != nil {
+		lease.Release(ctx)
+	}
+	if region != nil {
+		region.Release(ctx)
+	}
 
 	os.Exit(1)
 }
+
+// compressionOptions returns the S3 compression options from lc.Compression.
+func compressionOptions(lc *LogConfig) ctlog.CompressionOptions {
+	o := ctlog.CompressionOptions{Workers: lc.Compression.Workers}
+	for class, level := range lc.Compression.Levels {
+		if o.Levels == nil {
+			o.Levels = make(map[ctlog.ObjectClass]int)
+		}
+		o.Levels[ctlog.ObjectClass(class)] = level
+	}
+	return o
+}
+
+// hedgingOptions returns the S3 hedging options from lc.Hedging.
+func hedgingOptions(lc *LogConfig) (ctlog.HedgingOptions, error) {
+	o := ctlog.HedgingOptions{Quantile: lc.Hedging.Quantile, MaxRate: lc.Hedging.MaxRate}
+	var err error
+	if lc.Hedging.MinDelay != "" {
+		if o.MinDelay, err = time.ParseDuration(lc.Hedging.MinDelay); err != nil {
+			return o, fmt.Errorf("invalid MinDelay: %w", err)
+		}
+	}
+	if lc.Hedging.MaxDelay != "" {
+		if o.MaxDelay, err = time.ParseDuration(lc.Hedging.MaxDelay); err != nil {
+			return o, fmt.Errorf("invalid MaxDelay: %w", err)
+		}
+	}
+	return o, o.Check()
+}
+
+// tileStoreSize returns the size of the tile store from lc.TileStore.Size.
+func tileStoreSize(lc *LogConfig) (int64, error) {
+	if lc.TileStore.Size == "" {
+		return 256 << 20, nil
+	}
+	n, err := parseMemoryLimit(lc.TileStore.Size)
+	if err != nil {
+		return 0, err
+	}
+	if n < ctlog.MinTileStoreSize {
+		return 0, fmt.Errorf("tile store size %q is smaller than %d bytes", lc.TileStore.Size, ctlog.MinTileStoreSize)
+	}
+	return n, nil
+}
+
+// newLockBackend returns the LockBackend selected by the Checkpoints,
+// DynamoDB, or ETagS3 settings.
+func newLockBackend(ctx context.Context, c *Config, logger *slog.Logger) (interface {
+	ctlog.LockBackend
+	Metrics() []prometheus.Collector
+}, error) {
+	switch {
+	case c.Checkpoints != "" && c.DynamoDB.Table != "" ||
+		c.Checkpoints != "" && c.ETagS3.Bucket != "" ||
+		c.DynamoDB.Table != "" && c.ETagS3.Bucket != "":
+		return nil, errors.New("only one of Checkpoints, DynamoDB, or ETagS3 can be set at the same time")
+	case c.Checkpoints != "":
+		b, err := ctlog.NewSQLiteBackend(ctx, c.Checkpoints, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SQLite checkpoint backend: %w", err)
+		}
+		return b, nil
+	case c.DynamoDB.Table != "":
+		b, err := ctlog.NewDynamoDBBackend(ctx,
+			c.DynamoDB.Region, c.DynamoDB.Table, c.DynamoDB.Endpoint, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create DynamoDB backend: %w", err)
+		}
+		return b, nil
+	case c.ETagS3.Bucket != "":
+		b, err := ctlog.NewETagBackend(ctx,
+			c.ETagS3.Region, c.ETagS3.Bucket, c.ETagS3.Endpoint, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ETag S3 backend: %w", err)
+		}
+		return b, nil
+	default:
+		return nil, errors.New("neither Checkpoints nor DynamoDB are set, one must be used")
+	}
+}
+
+// newSigner returns the log key selected by the Key, AWSKMS, GCPKMS,
+// AzureKeyVault, PKCS11, or Vault settings, and its metrics, if any.
+func newSigner(ctx context.Context, lc *LogConfig, logger *slog.Logger) (crypto.Signer, []prometheus.Collector, error) {
+	var keySources int
+	for _, set := range []bool{lc.Key != "", lc.AWSKMS.KeyID != "",
+		lc.GCPKMS.KeyVersion != "", lc.AzureKeyVault.KeyID != "", lc.PKCS11.Module != "", lc.Vault.Address != ""} {
+		if set {
+			keySources++
+		}
+	}
+	switch {
+	case keySources > 1:
+		return nil, nil, errors.New("only one of Key, AWSKMS, GCPKMS, AzureKeyVault, PKCS11, and Vault can be set")
+	case keySources == 1 && lc.Key == "" && lc.PublicKey == "":
+		return nil, nil, errors.New("PublicKey is required with AWSKMS, GCPKMS, AzureKeyVault, PKCS11, and Vault")
+	}
+	switch {
+	case lc.AWSKMS.KeyID != "":
+		s, err := ctlog.NewKMSSigner(ctx, lc.AWSKMS.Region, lc.AWSKMS.KeyID, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create KMS signer: %w", err)
+		}
+		return s, s.Metrics(), nil
+	case lc.GCPKMS.KeyVersion != "":
+		s, err := ctlog.NewGCPKMSSigner(ctx, lc.GCPKMS.KeyVersion, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create Cloud KMS signer: %w", err)
+		}
+		return s, s.Metrics(), nil
+	case lc.AzureKeyVault.KeyID != "":
+		s, err := ctlog.NewAzureKeyVaultSigner(ctx, lc.AzureKeyVault.KeyID, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create Key Vault signer: %w", err)
+		}
+		return s, s.Metrics(), nil
+	case lc.PKCS11.Module != "":
+		pin, err := readSecretFile(lc.PKCS11.PINFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read PKCS#11 PIN: %w", err)
+		}
+		s, err := ctlog.NewPKCS11Signer(ctlog.PKCS11Config{
+			Module:     lc.PKCS11.Module,
+			TokenLabel: lc.PKCS11.TokenLabel,
+			PIN:        strings.TrimRight(string(pin), " \t\r\n"),
+			KeyLabel:   lc.PKCS11.KeyLabel,
+			Sessions:   lc.PKCS11.Sessions,
+		}, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create PKCS#11 signer: %w", err)
+		}
+		return s, s.Metrics(), nil
+	case lc.Vault.Address != "":
+		vc := ctlog.VaultConfig{
+			Address:      lc.Vault.Address,
+			Namespace:    lc.Vault.Namespace,
+			Mount:        lc.Vault.Mount,
+			Key:          lc.Vault.Key,
+			KeyVersion:   lc.Vault.KeyVersion,
+			AppRoleID:    lc.Vault.AppRole.RoleID,
+			AppRoleMount: lc.Vault.AppRole.Mount,
+		}
+		if lc.Vault.TokenFile != "" {
+			token, err := readSecretFile(lc.Vault.TokenFile)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read Vault token: %w", err)
+			}
+			vc.Token = strings.TrimSpace(string(token))
+		}
+		if lc.Vault.AppRole.SecretIDFile != "" {
+			secretID, err := readSecretFile(lc.Vault.AppRole.SecretIDFile)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read Vault AppRole secret ID: %w", err)
+			}
+			vc.AppRoleSecretID = strings.TrimSpace(string(secretID))
+		}
+		s, err := ctlog.NewVaultSigner(ctx, vc, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create Vault signer: %w", err)
+		}
+		return s, s.Metrics(), nil
+	default:
+		k, err := loadKey(lc.Key, lc.KeyIdentityFile, lc.KeyPassphraseFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load key: %w", err)
+		}
+		return k, nil, nil
+	}
+}
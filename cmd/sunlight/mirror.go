@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// defaultMirrorInterval is how often the mirror checks the source log, if
+// -interval is not set.
+const defaultMirrorInterval = 10 * time.Second
+
+// mirror implements the "sunlight mirror" command, which continuously copies
+// a log from its monitoring API to an S3 bucket, making an independent read
+// replica. It resumes from the checkpoint in the bucket, if any.
+//
+// With -witness, the checkpoints of the source log are also submitted to
+// witnesses, contributing to the witnessing of logs run by others.
+func mirror(args []string) {
+	fs := flag.NewFlagSet("sunlight mirror", flag.ExitOnError)
+	sourceFlag := fs.String("source", "", "monitoring URL prefix of the source log (required)")
+	nameFlag := fs.String("name", "", "name of the source log, the checkpoint origin (required)")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the source log (required)")
+	regionFlag := fs.String("s3-region", "", "AWS region of the destination S3 bucket")
+	bucketFlag := fs.String("s3-bucket", "", "destination S3 bucket (required)")
+	endpointFlag := fs.String("s3-endpoint", "", "base URL of the destination S3 API, if not AWS")
+	prefixFlag := fs.String("s3-prefix", "", "prefix of the destination object keys")
+	intervalFlag := fs.Duration("interval", defaultMirrorInterval, "how often to check the source log")
+	onceFlag := fs.Bool("once", false, "copy the current tree and exit")
+	var witnessFlags repeatedFlag
+	fs.Var(&witnessFlags, "witness", "URL and note verifier key, separated by a space, of a c2sp.org/tlog-witness witness to submit the source checkpoints to (can be repeated)")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *sourceFlag == "" || *nameFlag == "" || *keyFlag == "" || *bucketFlag == "" {
+		logger.Error("-source, -name, -key, and -s3-bucket are required")
+		os.Exit(1)
+	}
+	key, err := parsePublicKey(*keyFlag)
+	if err != nil {
+		logger.Error("invalid -key", "err", err)
+		os.Exit(1)
+	}
+	src, err := client.New(&client.Config{
+		MonitoringPrefix: *sourceFlag,
+		Name:             *nameFlag,
+		PublicKey:        key,
+		UserAgent:        "filippo.io/sunlight mirror",
+	})
+	if err != nil {
+		logger.Error("failed to create client", "err", err)
+		os.Exit(1)
+	}
+
+	var witnesses []*client.Witness
+	for _, f := range witnessFlags {
+		w, err := parseWitnessFlag(f, nil, "filippo.io/sunlight mirror")
+		if err != nil {
+			logger.Error("invalid -witness", "err", err)
+			os.Exit(1)
+		}
+		witnesses = append(witnesses, w)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dst, err := ctlog.NewS3Backend(ctx, *regionFlag, *bucketFlag, *endpointFlag, *prefixFlag, logger)
+	if err != nil {
+		logger.Error("failed to create backend", "err", err)
+		os.Exit(1)
+	}
+	m, err := ctlog.NewMirror(ctx, &ctlog.MirrorConfig{
+		Source:      src,
+		Destination: dst,
+		Log:         logger,
+	})
+	if err != nil {
+		logger.Error("failed to load mirror", "err", err)
+		os.Exit(1)
+	}
+	if *onceFlag {
+		if err := m.Sync(ctx); err != nil {
+			logger.Error("mirror sync failed", "err", err)
+			os.Exit(1)
+		}
+		submitWitnesses(ctx, src, witnesses, make(map[*client.Witness]int64), logger)
+		return
+	}
+	if len(witnesses) > 0 {
+		go runWitnesses(ctx, src, witnesses, defaultWitnessInterval, logger)
+	}
+	m.Run(ctx, *intervalFlag)
+}
+
+// parsePublicKey parses a base64-encoded SubjectPublicKeyInfo, the format of
+// the log list "key" field.
+func parsePublicKey(b64 string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key base64: %w", err)
+	}
+	return x509.ParsePKIXPublicKey(der)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// MonitorConfig is the config file of the "sunlight monitor" command.
+type MonitorConfig struct {
+	// Listen is the address to serve the Prometheus metrics on, at /metrics,
+	// e.g. ":9090".
+	Listen string
+
+	// PollInterval is how often the checkpoint of each log is fetched.
+	// Optional. Defaults to 10s.
+	PollInterval string
+
+	// InclusionSamples is how many of the entries of each log, one in
+	// InclusionSamples, are checked for inclusion in the latest checkpoint
+	// with an inclusion proof, like an SCT auditor would. Optional. Defaults to
+	// 1000. Set to -1 to disable sampling.
+	InclusionSamples int
+
+	// Logging configures the monitor logs.
+	Logging LoggingConfig
+
+	Logs []MonitorLogConfig
+}
+
+type MonitorLogConfig struct {
+	// Name is the log name, the origin line of its checkpoints.
+	Name string
+
+	// ShortName is the "log" label of the metrics of this log.
+	ShortName string
+
+	// MonitoringPrefix is the URL prefix of the log's monitoring API.
+	MonitoringPrefix string
+
+	// PublicKey is the SubjectPublicKeyInfo of the log, base64 encoded.
+	PublicKey string
+
+	// FromStart makes the monitor verify the log from the first entry, rather
+	// than from the size of the tree at startup. Optional.
+	FromStart bool
+}
+
+// defaultMonitorPollInterval and defaultInclusionSamples are used if
+// PollInterval and InclusionSamples are not set.
+const (
+	defaultMonitorPollInterval = 10 * time.Second
+	defaultInclusionSamples    = 1000
+)
+
+// monitor implements the "sunlight monitor" command, which follows one or
+// more logs through their monitoring API. It verifies every checkpoint
+// signature, the consistency of successive checkpoints, and every data tile,
+// samples inclusion proofs, and exports the results as Prometheus metrics.
+func monitor(args []string) {
+	fs := flag.NewFlagSet("sunlight monitor", flag.ExitOnError)
+	configFlag := fs.String("c", "monitor.yaml", "path to the config file")
+	fs.Parse(args)
+
+	lg, err := newLogging(LoggingConfig{})
+	if err != nil {
+		panic(err)
+	}
+	logger := slog.New(lg.handler(""))
+
+	yml, err := os.ReadFile(*configFlag)
+	if err != nil {
+		logger.Error("failed to read config file", "err", err)
+		os.Exit(1)
+	}
+	c := &MonitorConfig{}
+	if err := unmarshalConfig(yml, c); err != nil {
+		logger.Error("failed to parse config file", "err", err)
+		os.Exit(1)
+	}
+	lg, err = newLogging(c.Logging)
+	if err != nil {
+		logger.Error("failed to configure logging", "err", err)
+		os.Exit(1)
+	}
+	logger = slog.New(lg.handler(""))
+
+	interval := defaultMonitorPollInterval
+	if c.PollInterval != "" {
+		interval, err = time.ParseDuration(c.PollInterval)
+		if err != nil || interval <= 0 {
+			logger.Error("invalid PollInterval", "err", err)
+			os.Exit(1)
+		}
+	}
+	samples := c.InclusionSamples
+	if samples == 0 {
+		samples = defaultInclusionSamples
+	}
+	if len(c.Logs) == 0 {
+		logger.Error("no logs configured")
+		os.Exit(1)
+	}
+
+	metrics := prometheus.NewRegistry()
+	metrics.MustRegister(collectors.NewGoCollector())
+	metrics.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	m := newMonitorMetrics()
+	metrics.MustRegister(m.collectors()...)
+
+	var monitors []*logMonitor
+	for _, lc := range c.Logs {
+		if lc.Name == "" || lc.ShortName == "" || lc.MonitoringPrefix == "" || lc.PublicKey == "" {
+			logger.Error("Name, ShortName, MonitoringPrefix, and PublicKey are required", "log", lc.Name)
+			os.Exit(1)
+		}
+		key, err := parsePublicKey(lc.PublicKey)
+		if err != nil {
+			logger.Error("invalid PublicKey", "log", lc.ShortName, "err", err)
+			os.Exit(1)
+		}
+		cl, err := client.New(&client.Config{
+			MonitoringPrefix: lc.MonitoringPrefix,
+			Name:             lc.Name,
+			PublicKey:        key,
+			UserAgent:        "filippo.io/sunlight monitor",
+			PollInterval:     interval,
+		})
+		if err != nil {
+			logger.Error("failed to create client", "log", lc.ShortName, "err", err)
+			os.Exit(1)
+		}
+		monitors = append(monitors, &logMonitor{
+			c:         cl,
+			name:      lc.ShortName,
+			fromStart: lc.FromStart,
+			samples:   samples,
+			logger:    logger.With("log", lc.ShortName),
+			m:         m,
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics, promhttp.HandlerOpts{
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}))
+	srv := &http.Server{Addr: c.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	var wg sync.WaitGroup
+	for _, lm := range monitors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lm.run(ctx, interval)
+		}()
+	}
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("metrics server failed", "err", err)
+		stop()
+	}
+	wg.Wait()
+}
+
+type monitorMetrics struct {
+	TreeSize            *prometheus.GaugeVec
+	CheckpointTimestamp *prometheus.GaugeVec
+	CheckpointFetches   *prometheus.CounterVec
+	VerifiedSize        *prometheus.GaugeVec
+	Entries             *prometheus.CounterVec
+	EntryAge            *prometheus.HistogramVec
+	TailErrors          *prometheus.CounterVec
+	InclusionChecks     *prometheus.CounterVec
+}
+
+func newMonitorMetrics() *monitorMetrics {
+	return &monitorMetrics{
+		TreeSize: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "sunlight_monitor_tree_size",
+				Help: "Size of the latest verified checkpoint.",
+			},
+			[]string{"log"},
+		),
+		CheckpointTimestamp: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "sunlight_monitor_checkpoint_timestamp_seconds",
+				Help: "Timestamp of the latest verified checkpoint.",
+			},
+			[]string{"log"},
+		),
+		CheckpointFetches: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sunlight_monitor_checkpoint_fetches_total",
+				Help: "Checkpoint fetches, by result (ok or error, including invalid signatures).",
+			},
+			[]string{"log", "result"},
+		),
+		VerifiedSize: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "sunlight_monitor_verified_size",
+				Help: "Index of the first entry not yet fetched and verified.",
+			},
+			[]string{"log"},
+		),
+		Entries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sunlight_monitor_entries_total",
+				Help: "Entries fetched and verified against a checkpoint.",
+			},
+			[]string{"log"},
+		),
+		EntryAge: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "sunlight_monitor_entry_age_seconds",
+				Help:    "Time between the timestamp of an entry and its verification by the monitor.",
+				Buckets: prometheus.ExponentialBuckets(1, 2, 18),
+			},
+			[]string{"log"},
+		),
+		TailErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sunlight_monitor_tail_errors_total",
+				Help: "Errors fetching or verifying checkpoints and tiles, including inconsistent checkpoints.",
+			},
+			[]string{"log"},
+		),
+		InclusionChecks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sunlight_monitor_inclusion_checks_total",
+				Help: "Sampled inclusion proof checks, by result (ok or error).",
+			},
+			[]string{"log", "result"},
+		),
+	}
+}
+
+func (m *monitorMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.TreeSize, m.CheckpointTimestamp, m.CheckpointFetches,
+		m.VerifiedSize, m.Entries, m.EntryAge, m.TailErrors, m.InclusionChecks}
+}
+
+type logMonitor struct {
+	c         *client.Client
+	name      string
+	fromStart bool
+	samples   int
+	logger    *slog.Logger
+	m         *monitorMetrics
+
+	mu     sync.Mutex
+	latest *client.Checkpoint
+}
+
+func (lm *logMonitor) run(ctx context.Context, interval time.Duration) {
+	var start int64
+	for !lm.fromStart {
+		if err := lm.checkpoint(ctx); err == nil {
+			start = lm.latestTree().N
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+	lm.logger.InfoContext(ctx, "monitoring log", "start", start)
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			lm.checkpoint(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	for e, err := range lm.c.Tail(ctx, start) {
+		if err != nil {
+			lm.m.TailErrors.WithLabelValues(lm.name).Inc()
+			lm.logger.ErrorContext(ctx, "failed to follow log", "err", err)
+			continue
+		}
+		lm.m.Entries.WithLabelValues(lm.name).Inc()
+		lm.m.VerifiedSize.WithLabelValues(lm.name).Set(float64(e.LeafIndex + 1))
+		age := time.Since(time.UnixMilli(e.Timestamp))
+		lm.m.EntryAge.WithLabelValues(lm.name).Observe(age.Seconds())
+		if lm.samples > 0 && rand.Intn(lm.samples) == 0 {
+			lm.checkInclusion(ctx, e)
+		}
+	}
+}
+
+// checkpoint fetches and verifies the latest checkpoint, and updates the
+// checkpoint metrics.
+func (lm *logMonitor) checkpoint(ctx context.Context) error {
+	cp, err := lm.c.Checkpoint(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			lm.m.CheckpointFetches.WithLabelValues(lm.name, "error").Inc()
+			lm.logger.ErrorContext(ctx, "failed to fetch checkpoint", "err", err)
+		}
+		return err
+	}
+	lm.m.CheckpointFetches.WithLabelValues(lm.name, "ok").Inc()
+	lm.m.TreeSize.WithLabelValues(lm.name).Set(float64(cp.N))
+	lm.m.CheckpointTimestamp.WithLabelValues(lm.name).Set(float64(cp.Timestamp) / 1000)
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if lm.latest == nil || cp.N >= lm.latest.N {
+		lm.latest = cp
+	}
+	return nil
+}
+
+func (lm *logMonitor) latestTree() tlog.Tree {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if lm.latest == nil {
+		return tlog.Tree{}
+	}
+	return lm.latest.Tree
+}
+
+// checkInclusion verifies an inclusion proof of e in the latest checkpoint,
+// like an auditor checking an SCT for the entry would.
+func (lm *logMonitor) checkInclusion(ctx context.Context, e *client.Entry) {
+	tree := lm.latestTree()
+	if tree.N <= e.LeafIndex {
+		// The poller hasn't seen the checkpoint that includes e yet.
+		return
+	}
+	proof, err := lm.c.InclusionProof(ctx, tree, e.LeafIndex)
+	if err == nil {
+		err = tlog.CheckRecord(proof, tree.N, tree.Hash, e.LeafIndex, tlog.RecordHash(e.MerkleTreeLeaf()))
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			lm.m.InclusionChecks.WithLabelValues(lm.name, "error").Inc()
+			lm.logger.ErrorContext(ctx, "inclusion check failed", "index", e.LeafIndex, "err", err)
+		}
+		return
+	}
+	lm.m.InclusionChecks.WithLabelValues(lm.name, "ok").Inc()
+}
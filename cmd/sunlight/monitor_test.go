@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func newTestMonitor(tl *testLog, c *client.Client) *logMonitor {
+	if c == nil {
+		c = tl.Client
+	}
+	return &logMonitor{
+		c:         c,
+		name:      "test",
+		fromStart: true,
+		samples:   -1,
+		logger:    discardLogger(),
+		m:         newMonitorMetrics(),
+	}
+}
+
+func TestMonitorTail(t *testing.T) {
+	tl := newTestLog(t)
+	for range 3 {
+		tl.add(t, false)
+	}
+	tl.add(t, true)
+
+	lm := newTestMonitor(tl, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lm.run(ctx, 5*time.Millisecond)
+	}()
+	defer func() { cancel(); <-done }()
+
+	waitFor := func(n float64) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); ; {
+			if metricValue(lm.m.Entries.WithLabelValues("test")) == n {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("got %v entries, expected %v",
+					metricValue(lm.m.Entries.WithLabelValues("test")), n)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor(4)
+	// New entries are picked up as the log grows.
+	tl.add(t, false)
+	waitFor(5)
+
+	if got := metricValue(lm.m.VerifiedSize.WithLabelValues("test")); got != 5 {
+		t.Errorf("got verified size %v, expected 5", got)
+	}
+	if got := metricValue(lm.m.TailErrors.WithLabelValues("test")); got != 0 {
+		t.Errorf("got %v tail errors", got)
+	}
+	if got := metricValue(lm.m.CheckpointFetches.WithLabelValues("test", "ok")); got == 0 {
+		t.Errorf("no successful checkpoint fetches")
+	}
+}
+
+func TestMonitorCheckpoint(t *testing.T) {
+	tl := newTestLog(t)
+	tl.add(t, false)
+	tl.add(t, false)
+
+	lm := newTestMonitor(tl, nil)
+	fatalIfErr(t, lm.checkpoint(context.Background()))
+	if got := metricValue(lm.m.TreeSize.WithLabelValues("test")); got != 2 {
+		t.Errorf("got tree size %v, expected 2", got)
+	}
+	if got := metricValue(lm.m.CheckpointTimestamp.WithLabelValues("test")); got == 0 {
+		t.Errorf("checkpoint timestamp not set")
+	}
+	if lm.latestTree().N != 2 {
+		t.Errorf("got latest tree size %d, expected 2", lm.latestTree().N)
+	}
+
+	// A checkpoint signed by a different key is an error.
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	c, err := client.New(&client.Config{
+		MonitoringPrefix: tl.URL,
+		Name:             tl.Name,
+		PublicKey:        k.Public(),
+		HTTPClient:       tl.Server.Client(),
+	})
+	fatalIfErr(t, err)
+	lm = newTestMonitor(tl, c)
+	if err := lm.checkpoint(context.Background()); err == nil {
+		t.Errorf("accepted a checkpoint signed by the wrong key")
+	}
+	if got := metricValue(lm.m.CheckpointFetches.WithLabelValues("test", "error")); got != 1 {
+		t.Errorf("got %v checkpoint errors, expected 1", got)
+	}
+	if lm.latestTree().N != 0 {
+		t.Errorf("got latest tree size %d after an invalid checkpoint", lm.latestTree().N)
+	}
+}
+
+func TestMonitorInclusion(t *testing.T) {
+	tl := newTestLog(t)
+	for range 3 {
+		tl.add(t, false)
+	}
+	entries, err := tl.Entries(context.Background())
+	fatalIfErr(t, err)
+
+	lm := newTestMonitor(tl, nil)
+	// Entries past the latest checkpoint seen by the poller are skipped.
+	lm.checkInclusion(context.Background(), entries[0])
+
+	fatalIfErr(t, lm.checkpoint(context.Background()))
+	for _, e := range entries {
+		lm.checkInclusion(context.Background(), e)
+	}
+	if got := metricValue(lm.m.InclusionChecks.WithLabelValues("test", "ok")); got != 3 {
+		t.Errorf("got %v successful inclusion checks, expected 3", got)
+	}
+
+	tampered := *entries[1]
+	tampered.Timestamp++
+	lm.checkInclusion(context.Background(), &tampered)
+	if got := metricValue(lm.m.InclusionChecks.WithLabelValues("test", "error")); got != 1 {
+		t.Errorf("got %v failed inclusion checks, expected 1", got)
+	}
+}
+
+// metricValue returns the value of a counter or gauge.
+func metricValue(m prometheus.Metric) float64 {
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		panic(err)
+	}
+	if pb.Counter != nil {
+		return pb.Counter.GetValue()
+	}
+	return pb.Gauge.GetValue()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultNTPMaxOffset  = 1 * time.Second
+	defaultDateMaxOffset = 2 * time.Second
+	defaultNTPInterval   = 5 * time.Minute
+	ntpTimeout           = 5 * time.Second
+)
+
+// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and the
+// UNIX epoch (1970).
+const ntpEpochOffset = 2208988800
+
+// ntpOffset queries server with SNTP (RFC 4330) and returns the offset of the
+// local clock, positive if it's behind.
+func ntpOffset(ctx context.Context, server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	ctx, cancel := context.WithTimeout(ctx, ntpTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	req := make([]byte, 48)
+	req[0] = 0<<6 | 4<<3 | 3 // LI = 0, VN = 4, Mode = 3 (client)
+	t1 := time.Now()
+	binary.BigEndian.PutUint64(req[40:], toNTPTime(t1))
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	t4 := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if n < 48 {
+		return 0, errors.New("short NTP response")
+	}
+	if mode := resp[0] & 0x7; mode != 4 {
+		return 0, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+	if stratum := resp[1]; stratum == 0 || stratum > 15 {
+		return 0, fmt.Errorf("NTP server is unsynchronized (stratum %d)", stratum)
+	}
+	if binary.BigEndian.Uint64(resp[24:]) != binary.BigEndian.Uint64(req[40:]) {
+		return 0, errors.New("NTP response doesn't match request")
+	}
+	t2 := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+	t3 := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+func toNTPTime(t time.Time) uint64 {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return sec<<32 | frac
+}
+
+func fromNTPTime(ts uint64) time.Time {
+	sec := int64(ts>>32) - ntpEpochOffset
+	nsec := int64((ts & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(sec, nsec)
+}
+
+// httpDateOffset sends a HEAD request to url and returns the offset of the
+// local clock from the response Date header, positive if it's behind. The
+// Date header has a resolution of one second, so the result is only accurate
+// to about half a second plus half the round trip time.
+func httpDateOffset(ctx context.Context, url string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, ntpTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	t1 := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	t4 := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid Date header: %w", err)
+	}
+	// The server truncated the time to the second, so on average the
+	// response was generated half a second after date.
+	date = date.Add(500 * time.Millisecond)
+	return date.Sub(t1.Add(t4.Sub(t1) / 2)), nil
+}
+
+// ntpChecker periodically measures the clock offset, and stops the logs from
+// accepting submissions and signing checkpoints while it exceeds maxOffset.
+type ntpChecker struct {
+	server    string
+	measure   func(ctx context.Context, server string) (time.Duration, error)
+	maxOffset time.Duration
+	logs      map[string]*ctlog.Log
+	logger    *slog.Logger
+	offset    prometheus.Gauge
+}
+
+// check measures the offset once. If the NTP server can't be reached, the
+// previous state is kept.
+func (c *ntpChecker) check(ctx context.Context) {
+	offset, err := c.measure(ctx, c.server)
+	if err != nil {
+		c.logger.Warn("failed to query time server", "server", c.server, "err", err)
+		return
+	}
+	c.offset.Set(offset.Seconds())
+	reason := ""
+	if offset > c.maxOffset || offset < -c.maxOffset {
+		reason = fmt.Sprintf("clock offset %v from %s exceeds %v", offset, c.server, c.maxOffset)
+	} else {
+		c.logger.Debug("clock offset", "server", c.server, "offset", offset)
+	}
+	for _, l := range c.logs {
+		l.SetClockSkew(reason)
+	}
+}
+
+func (c *ntpChecker) run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			c.check(ctx)
+		}
+	}
+}
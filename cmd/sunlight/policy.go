@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// parseSignatureAlgorithms returns the algorithms with the given names, as
+// returned by their String method.
+func parseSignatureAlgorithms(names []string) ([]x509.SignatureAlgorithm, error) {
+	var algs []x509.SignatureAlgorithm
+names:
+	for _, name := range names {
+		for alg := x509.MD2WithRSA; alg <= x509.PureEd25519; alg++ {
+			if alg.String() == name {
+				algs = append(algs, alg)
+				continue names
+			}
+		}
+		return nil, fmt.Errorf("unknown signature algorithm %q", name)
+	}
+	return algs, nil
+}
+
+// defaultPolicyTimeout is how long an external submission policy has to reach
+// a decision, if Policy.Timeout is not set.
+const defaultPolicyTimeout = 5 * time.Second
+
+// policyRequest is the JSON object passed to an external submission policy,
+// on the standard input of a command or as the body of a webhook POST.
+type policyRequest struct {
+	// Chain is the verified chain, starting with the submitted certificate or
+	// precertificate and ending with the root, in DER.
+	Chain     [][]byte `json:"chain"`
+	Precert   bool     `json:"precert"`
+	ShortName string   `json:"log"`
+}
+
+// policyResponse is the JSON object returned by a webhook.
+type policyResponse struct {
+	Accept bool   `json:"accept"`
+	Reason string `json:"reason"`
+}
+
+// externalPolicy is a ctlog.SubmissionPolicy that delegates the decision to an
+// external command or webhook.
+//
+// A command accepts the submission by exiting with status zero, and rejects it
+// otherwise, with the first line of its output as the reason. A webhook must
+// respond 200 OK with a policyResponse.
+//
+// If the command or webhook fails to reach a decision (for example because it
+// times out, or the webhook returns a non-200 status), the submission is
+// rejected, unless failOpen is set.
+type externalPolicy struct {
+	shortName string
+	command   []string
+	webhook   string
+	timeout   time.Duration
+	failOpen  bool
+	logger    *slog.Logger
+}
+
+var _ ctlog.SubmissionPolicy = &externalPolicy{}
+
+// errPolicyRejected wraps the reason reported by the external policy.
+type errPolicyRejected struct{ reason string }
+
+func (e errPolicyRejected) Error() string { return e.reason }
+
+func (p *externalPolicy) CheckSubmission(ctx context.Context, chain []*x509.Certificate, isPrecert bool) error {
+	req := policyRequest{Precert: isPrecert, ShortName: p.shortName}
+	for _, c := range chain {
+		req.Chain = append(req.Chain, c.Raw)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	if p.webhook != "" {
+		err = p.callWebhook(ctx, body)
+	} else {
+		err = p.runCommand(ctx, body)
+	}
+	var rejected errPolicyRejected
+	if err == nil || errors.As(err, &rejected) {
+		return err
+	}
+	p.logger.WarnContext(ctx, "external submission policy failed", "err", err)
+	if p.failOpen {
+		return nil
+	}
+	return errors.New("submission policy unavailable")
+}
+
+func (p *externalPolicy) runCommand(ctx context.Context, body []byte) error {
+	cmd := exec.CommandContext(ctx, p.command[0], p.command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		reason, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		if reason == "" {
+			reason = "rejected"
+		}
+		return errPolicyRejected{reason}
+	}
+	return err
+}
+
+func (p *externalPolicy) callWebhook(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", p.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "filippo.io/sunlight")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	var res policyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&res); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if !res.Accept {
+		if res.Reason == "" {
+			res.Reason = "rejected"
+		}
+		return errPolicyRejected{res.Reason}
+	}
+	return nil
+}
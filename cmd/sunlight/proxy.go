@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"golang.org/x/mod/sumdb/tlog"
+	"golang.org/x/sync/singleflight"
+)
+
+// maxProxyObjectSize is the maximum size of an object fetched from the origin.
+const maxProxyObjectSize = 64 << 20
+
+var errProxyNotFound = errors.New("object not found at origin")
+
+// proxy implements the "sunlight proxy" command, which serves the monitoring
+// API of a log from a local disk cache, fetching misses from the origin, such
+// as the log's bucket or its own monitoring endpoint.
+//
+// Tiles never change once uploaded, so they are cached on disk indefinitely,
+// and concurrent misses for the same object are coalesced into a single origin
+// request. Partial tiles are removed from the cache when the corresponding full
+// tile is fetched. The checkpoint and issuers bundle are cached in memory for
+// -ttl.
+func proxy(args []string) {
+	fs := flag.NewFlagSet("sunlight proxy", flag.ExitOnError)
+	originFlag := fs.String("origin", "", "monitoring URL prefix of the log to proxy (required)")
+	cacheFlag := fs.String("cache", "", "directory of the tile cache (required)")
+	listenFlag := fs.String("listen", "localhost:8080", "address to listen on, as accepted by the Listen config option")
+	ttlFlag := fs.Duration("ttl", 1*time.Second, "how long to cache the checkpoint and issuers bundle")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *originFlag == "" || *cacheFlag == "" {
+		logger.Error("-origin and -cache are required")
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(*cacheFlag, 0755); err != nil {
+		logger.Error("failed to create cache directory", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	p := &tileProxy{
+		origin:  strings.TrimSuffix(*originFlag, "/") + "/",
+		cache:   *cacheFlag,
+		ttl:     *ttlFlag,
+		hc:      &http.Client{Timeout: 1 * time.Minute},
+		logger:  logger,
+		mutable: make(map[string]*proxyObject),
+	}
+	ln, err := listen(*listenFlag, ListenerConfig{})
+	if err != nil {
+		logger.Error("failed to listen", "err", err)
+		os.Exit(1)
+	}
+	s := &http.Server{
+		Handler:      p,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 1 * time.Minute,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelDebug),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s.Shutdown(shutdownCtx)
+	}()
+	logger.Info("serving proxy", "addr", ln.Addr(), "origin", p.origin)
+	if err := s.Serve(ln); err != http.ErrServerClosed {
+		logger.Error("server error", "err", err)
+		os.Exit(1)
+	}
+}
+
+// tileProxy is the [http.Handler] of "sunlight proxy".
+type tileProxy struct {
+	origin string
+	cache  string
+	ttl    time.Duration
+	hc     *http.Client
+	logger *slog.Logger
+
+	// sf coalesces the origin requests for the same key.
+	sf singleflight.Group
+
+	mu      sync.Mutex
+	mutable map[string]*proxyObject
+}
+
+type proxyObject struct {
+	data    []byte
+	fetched time.Time
+}
+
+func (p *tileProxy) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	var data []byte
+	var err error
+	switch key {
+	case "checkpoint", "issuers.pem":
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-store")
+		data, err = p.getMutable(key)
+	default:
+		tile, perr := tlog.ParseTilePath(key)
+		if perr != nil || tile.H != client.TileHeight {
+			http.Error(rw, "invalid tile path", http.StatusNotFound)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/octet-stream")
+		if tile.W == 1<<client.TileHeight {
+			rw.Header().Set("Cache-Control", "public, max-age=604800, immutable")
+		} else {
+			rw.Header().Set("Cache-Control", "no-store")
+		}
+		data, err = p.getTile(key, tile)
+	}
+	if errors.Is(err, errProxyNotFound) {
+		http.Error(rw, "object not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		p.logger.WarnContext(r.Context(), "failed to fetch object", "key", key, "err", err)
+		http.Error(rw, "failed to fetch object from origin", http.StatusBadGateway)
+		return
+	}
+
+	rw.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	rw.Write(data)
+}
+
+// getMutable returns key from the memory cache if it's fresher than p.ttl, or
+// from the origin otherwise.
+func (p *tileProxy) getMutable(key string) ([]byte, error) {
+	p.mu.Lock()
+	obj, ok := p.mutable[key]
+	p.mu.Unlock()
+	if ok && time.Since(obj.fetched) < p.ttl {
+		return obj.data, nil
+	}
+	v, err, _ := p.sf.Do(key, func() (any, error) {
+		data, err := p.fetch(key)
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.mutable[key] = &proxyObject{data: data, fetched: time.Now()}
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// getTile returns a tile from the disk cache, or fetches it from the origin
+// and stores it in the cache.
+func (p *tileProxy) getTile(key string, tile tlog.Tile) ([]byte, error) {
+	path := filepath.Join(p.cache, filepath.FromSlash(key))
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	v, err, _ := p.sf.Do(key, func() (any, error) {
+		p.logger.Debug("cache miss", "key", key)
+		data, err := p.fetch(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return nil, err
+		}
+		if tile.W == 1<<client.TileHeight {
+			// The partial tiles of this tile are superseded.
+			if err := os.RemoveAll(path + ".p"); err != nil {
+				p.logger.Warn("failed to remove partial tiles", "key", key, "err", err)
+			}
+		}
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// fetch fetches key from the origin. It doesn't use the request context, as the
+// result is shared by coalesced requests, and cached.
+func (p *tileProxy) fetch(key string) ([]byte, error) {
+	req, err := http.NewRequest("GET", p.origin+key, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "filippo.io/sunlight proxy")
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		// S3 returns 403 for missing objects if the bucket can't be listed.
+		return nil, errProxyNotFound
+	default:
+		return nil, fmt.Errorf("unexpected response status from origin: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxProxyObjectSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxProxyObjectSize {
+		return nil, errors.New("origin response is too large")
+	}
+	return data, nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// testOrigin is an origin that serves fixed objects, and counts the requests
+// for each of them.
+type testOrigin struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	status   map[string]int
+	requests map[string]int
+	// block, if not nil, is waited on before responding.
+	block chan struct{}
+}
+
+func newTestOrigin(t *testing.T) *testOrigin {
+	o := &testOrigin{objects: make(map[string][]byte), status: make(map[string]int),
+		requests: make(map[string]int)}
+	o.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		o.mu.Lock()
+		o.requests[key]++
+		data, ok := o.objects[key]
+		status, block := o.status[key], o.block
+		o.mu.Unlock()
+		if r.Header.Get("User-Agent") != "filippo.io/sunlight proxy" {
+			t.Errorf("unexpected User-Agent %q", r.Header.Get("User-Agent"))
+		}
+		if block != nil {
+			<-block
+		}
+		switch {
+		case status != 0:
+			http.Error(w, http.StatusText(status), status)
+		case !ok:
+			http.NotFound(w, r)
+		default:
+			w.Write(data)
+		}
+	}))
+	t.Cleanup(o.Close)
+	return o
+}
+
+func (o *testOrigin) set(key string, data []byte, status int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.objects[key], o.status[key] = data, status
+}
+
+func (o *testOrigin) count(key string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.requests[key]
+}
+
+func newTestProxy(t *testing.T, origin string, ttl time.Duration) (*tileProxy, *httptest.Server) {
+	p := &tileProxy{
+		origin:  strings.TrimSuffix(origin, "/") + "/",
+		cache:   t.TempDir(),
+		ttl:     ttl,
+		hc:      &http.Client{Timeout: 10 * time.Second},
+		logger:  discardLogger(),
+		mutable: make(map[string]*proxyObject),
+	}
+	ts := httptest.NewServer(p)
+	t.Cleanup(ts.Close)
+	return p, ts
+}
+
+func proxyGet(t *testing.T, ts *httptest.Server, method, key string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+"/"+key, nil)
+	fatalIfErr(t, err)
+	resp, err := ts.Client().Do(req)
+	fatalIfErr(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	fatalIfErr(t, err)
+	return resp, body
+}
+
+func TestProxyLog(t *testing.T) {
+	tl := newTestLog(t)
+	for range 5 {
+		tl.add(t, false)
+	}
+	_, ts := newTestProxy(t, tl.URL, 0)
+	c, err := client.New(&client.Config{
+		MonitoringPrefix: ts.URL,
+		Name:             tl.Name,
+		PublicKey:        tl.Key.Public(),
+		HTTPClient:       ts.Client(),
+	})
+	fatalIfErr(t, err)
+	ctx := context.Background()
+	cp, err := c.Checkpoint(ctx)
+	fatalIfErr(t, err)
+	if cp.N != 5 {
+		t.Fatalf("got tree size %d through the proxy, expected 5", cp.N)
+	}
+	want, err := tl.Entries(ctx)
+	fatalIfErr(t, err)
+	got, err := c.DataTile(ctx, cp.Tree, 0)
+	fatalIfErr(t, err)
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries through the proxy, expected %d", len(got), len(want))
+	}
+	for i := range got {
+		if !bytes.Equal(got[i].MerkleTreeLeaf(), want[i].MerkleTreeLeaf()) {
+			t.Errorf("entry %d differs through the proxy", i)
+		}
+	}
+	if _, err := c.InclusionProof(ctx, cp.Tree, 3); err != nil {
+		t.Errorf("failed to fetch inclusion proof through the proxy: %v", err)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	full := tlog.Tile{H: client.TileHeight, L: 0, N: 0, W: 1 << client.TileHeight}.Path()
+	partial := tlog.Tile{H: client.TileHeight, L: 0, N: 0, W: 10}.Path()
+	data := tlog.Tile{H: client.TileHeight, L: -1, N: 1, W: 1 << client.TileHeight}.Path()
+
+	t.Run("Headers", func(t *testing.T) {
+		o := newTestOrigin(t)
+		o.set("checkpoint", []byte("checkpoint\n"), 0)
+		o.set(full, []byte("full tile"), 0)
+		o.set(partial, []byte("partial tile"), 0)
+		_, ts := newTestProxy(t, o.URL, time.Second)
+		for _, tc := range []struct {
+			key, body, contentType, cacheControl string
+		}{
+			{"checkpoint", "checkpoint\n", "text/plain; charset=utf-8", "no-store"},
+			{full, "full tile", "application/octet-stream", "public, max-age=604800, immutable"},
+			{partial, "partial tile", "application/octet-stream", "no-store"},
+		} {
+			resp, body := proxyGet(t, ts, "GET", tc.key)
+			if resp.StatusCode != http.StatusOK || string(body) != tc.body {
+				t.Errorf("%s: got %d %q, expected %q", tc.key, resp.StatusCode, body, tc.body)
+			}
+			if resp.Header.Get("Content-Type") != tc.contentType ||
+				resp.Header.Get("Cache-Control") != tc.cacheControl {
+				t.Errorf("%s: got headers %v", tc.key, resp.Header)
+			}
+			resp, body = proxyGet(t, ts, "HEAD", tc.key)
+			if resp.StatusCode != http.StatusOK || len(body) != 0 || resp.ContentLength != int64(len(tc.body)) {
+				t.Errorf("%s: got HEAD %d with length %d and body %q", tc.key, resp.StatusCode, resp.ContentLength, body)
+			}
+		}
+
+		if resp, _ := proxyGet(t, ts, "POST", "checkpoint"); resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("got %d for a POST", resp.StatusCode)
+		}
+		for _, key := range []string{"log.v3.json", "tile/5/0/000", "ct/v1/get-sth"} {
+			if resp, _ := proxyGet(t, ts, "GET", key); resp.StatusCode != http.StatusNotFound {
+				t.Errorf("%s: got %d, expected 404", key, resp.StatusCode)
+			}
+		}
+		if o.count("log.v3.json") != 0 {
+			t.Errorf("invalid paths were forwarded to the origin")
+		}
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		o := newTestOrigin(t)
+		o.set("checkpoint", []byte("first"), 0)
+		o.set(partial, []byte("partial tile"), 0)
+		o.set(full, []byte("full tile"), 0)
+		o.set(data, []byte("data tile"), 0)
+		p, ts := newTestProxy(t, o.URL, 100*time.Millisecond)
+
+		// Tiles are fetched once, and then served from disk.
+		for range 3 {
+			proxyGet(t, ts, "GET", data)
+		}
+		if n := o.count(data); n != 1 {
+			t.Errorf("data tile fetched %d times from the origin, expected once", n)
+		}
+		o.set(data, []byte("changed"), 0)
+		if _, body := proxyGet(t, ts, "GET", data); string(body) != "data tile" {
+			t.Errorf("got %q, expected the cached tile", body)
+		}
+
+		// The checkpoint is cached for the TTL.
+		proxyGet(t, ts, "GET", "checkpoint")
+		o.set("checkpoint", []byte("second"), 0)
+		if _, body := proxyGet(t, ts, "GET", "checkpoint"); string(body) != "first" {
+			t.Errorf("got checkpoint %q before the TTL, expected the cached one", body)
+		}
+		time.Sleep(150 * time.Millisecond)
+		if _, body := proxyGet(t, ts, "GET", "checkpoint"); string(body) != "second" {
+			t.Errorf("got checkpoint %q after the TTL, expected the new one", body)
+		}
+
+		// Fetching a full tile removes its partial tiles from the cache.
+		proxyGet(t, ts, "GET", partial)
+		partialPath := filepath.Join(p.cache, filepath.FromSlash(partial))
+		if _, err := os.Stat(partialPath); err != nil {
+			t.Fatalf("partial tile not cached: %v", err)
+		}
+		proxyGet(t, ts, "GET", full)
+		if _, err := os.Stat(filepath.Dir(partialPath)); !os.IsNotExist(err) {
+			t.Errorf("partial tiles not removed after fetching the full tile: %v", err)
+		}
+	})
+
+	t.Run("Coalescing", func(t *testing.T) {
+		o := newTestOrigin(t)
+		o.set(data, []byte("data tile"), 0)
+		o.block = make(chan struct{})
+		_, ts := newTestProxy(t, o.URL, time.Second)
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := ts.Client().Get(ts.URL + "/" + data)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer resp.Body.Close()
+				if body, _ := io.ReadAll(resp.Body); string(body) != "data tile" {
+					t.Errorf("got %q", body)
+				}
+			}()
+		}
+		time.Sleep(100 * time.Millisecond)
+		close(o.block)
+		wg.Wait()
+		if n := o.count(data); n != 1 {
+			t.Errorf("concurrent misses made %d origin requests, expected 1", n)
+		}
+	})
+
+	t.Run("OriginErrors", func(t *testing.T) {
+		o := newTestOrigin(t)
+		o.set(data, nil, http.StatusForbidden)
+		o.set(full, nil, http.StatusInternalServerError)
+		_, ts := newTestProxy(t, o.URL, time.Second)
+
+		// Missing objects, including S3's 403, are reported as not found.
+		for _, key := range []string{data, partial} {
+			if resp, _ := proxyGet(t, ts, "GET", key); resp.StatusCode != http.StatusNotFound {
+				t.Errorf("%s: got %d, expected 404", key, resp.StatusCode)
+			}
+		}
+		// Other errors are a bad gateway, and are not cached.
+		if resp, _ := proxyGet(t, ts, "GET", full); resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("got %d for an origin error, expected 502", resp.StatusCode)
+		}
+		o.set(full, []byte("full tile"), 0)
+		if resp, body := proxyGet(t, ts, "GET", full); resp.StatusCode != http.StatusOK || string(body) != "full tile" {
+			t.Errorf("got %d %q after the origin recovered", resp.StatusCode, body)
+		}
+
+		o.Close()
+		if resp, _ := proxyGet(t, ts, "GET", "checkpoint"); resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("got %d for an unreachable origin, expected 502", resp.StatusCode)
+		}
+		// Cached tiles are still served.
+		if resp, _ := proxyGet(t, ts, "GET", full); resp.StatusCode != http.StatusOK {
+			t.Errorf("got %d for a cached tile with an unreachable origin", resp.StatusCode)
+		}
+	})
+}
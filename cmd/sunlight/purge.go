@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// purge implements the "sunlight purge" command, which deletes the tiles of a
+// retired temporal shard past its Retention window. See
+// [ctlog.DeleteRetiredShard] for the checks performed and what is preserved.
+func purge(args []string) {
+	fs := flag.NewFlagSet("sunlight purge", flag.ExitOnError)
+	configFlag := fs.String("c", "sunlight.yaml", "path to the config file")
+	logFlag := fs.String("log", "", "ShortName of the log to purge (required)")
+	confirmFlag := fs.String("confirm", "", "Name of the log, to confirm the deletion of its tiles (required)")
+	deleteFlag := fs.Bool("delete", false, "delete the tiles, rather than only reporting the inventory")
+	batchSizeFlag := fs.Int("batch-size", 1000, "number of tiles deleted per request")
+	batchIntervalFlag := fs.Duration("batch-interval", 100*time.Millisecond, "minimum time between delete requests")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *logFlag == "" || *confirmFlag == "" {
+		logger.Error("-log and -confirm are required")
+		os.Exit(1)
+	}
+	c, err := readConfig(*configFlag)
+	if err != nil {
+		logger.Error("failed to load config", "err", err)
+		os.Exit(1)
+	}
+	var lc *LogConfig
+	for i := range c.Logs {
+		if c.Logs[i].ShortName == *logFlag {
+			lc = &c.Logs[i]
+		}
+	}
+	if lc == nil {
+		logger.Error("log not found in config file", "log", *logFlag)
+		os.Exit(1)
+	}
+	logger = logger.With("log", lc.ShortName)
+	if lc.Retention == "" {
+		logger.Error("Retention is not set for the log")
+		os.Exit(1)
+	}
+	retention, err := time.ParseDuration(lc.Retention)
+	if err != nil {
+		logger.Error("failed to parse Retention", "err", err)
+		os.Exit(1)
+	}
+	notAfterLimit, err := time.Parse(time.RFC3339, lc.NotAfterLimit)
+	if err != nil {
+		logger.Error("failed to parse NotAfterLimit", "err", err)
+		os.Exit(1)
+	}
+	stateTimestamp, err := time.Parse(time.RFC3339, lc.StateTimestamp)
+	if err != nil {
+		logger.Error("failed to parse StateTimestamp", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	db, err := newLockBackend(ctx, c, logger)
+	if err != nil {
+		logger.Error("failed to create lock backend", "err", err)
+		os.Exit(1)
+	}
+	b, err := ctlog.NewS3Backend(ctx, lc.S3Region, lc.S3Bucket, lc.S3Endpoint, lc.S3KeyPrefix, logger)
+	if err != nil {
+		logger.Error("failed to create backend", "err", err)
+		os.Exit(1)
+	}
+	signer, _, err := newSigner(ctx, lc, logger)
+	if err != nil {
+		logger.Error("failed to load log key", "err", err)
+		os.Exit(1)
+	}
+	res, err := ctlog.DeleteRetiredShard(ctx, &ctlog.Config{
+		Name:           lc.Name,
+		Key:            signer,
+		Backend:        b,
+		Lock:           db,
+		Log:            logger,
+		NotAfterLimit:  notAfterLimit,
+		State:          lc.State,
+		StateTimestamp: stateTimestamp,
+	}, &ctlog.RetentionOptions{
+		Retention:     retention,
+		Confirm:       *confirmFlag,
+		Delete:        *deleteFlag,
+		BatchSize:     *batchSizeFlag,
+		BatchInterval: *batchIntervalFlag,
+	})
+	if err != nil {
+		logger.Error("purge failed", "err", err)
+		if res != nil {
+			logger.Info("partially deleted tiles", "deleted", res.Deleted, "bytes", res.DeletedBytes)
+		}
+		os.Exit(1)
+	}
+	for _, level := range slices.Sorted(maps.Keys(res.Inventory.Tiles)) {
+		count := res.Inventory.Tiles[level]
+		logger.Info("tiles", "level", level, "objects", count.Objects, "bytes", count.Bytes)
+	}
+	if !*deleteFlag {
+		logger.Info("dry run, pass -delete to delete the tiles above")
+	}
+}
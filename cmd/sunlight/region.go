@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegionConfig configures active/passive operation across regions, with
+// instances in each region sharing the same buckets and lock backend.
+type RegionConfig struct {
+	// Name is the name of the region of this instance, such as "iad". If
+	// set, the instances compete for a region lease stored in the lock
+	// backend. The one holding it is active and runs the sequencers. The
+	// others are passive: they load the logs and serve reads, but reject
+	// submissions with a 503. When the active instance stops renewing the
+	// lease, a passive one takes it over, reloads the logs from the latest
+	// checkpoint, and starts sequencing.
+	//
+	// As with Kubernetes.Lease, the lease is only a trigger: the checkpoint
+	// lock still ensures that two instances can't both extend a log. An
+	// active instance that fails to renew the lease exits, to be restarted
+	// as a passive one. The SQLite Checkpoints backend can't be shared across
+	// regions, so it's not supported.
+	Name string
+
+	Lease struct {
+		// Name distinguishes the leases of separate deployments that share a
+		// lock backend. Optional. Defaults to "sunlight".
+		Name string
+
+		// Identity is the holder identity of this instance. Optional.
+		// Defaults to the region name and the hostname, such as
+		// "iad/sunlight-1".
+		Identity string
+
+		// Duration, RenewDeadline, and RetryPeriod work like the ones of
+		// Kubernetes.Lease, and have the same defaults. Cross-region latency
+		// to the lock backend might call for longer values.
+		Duration      string
+		RenewDeadline string
+		RetryPeriod   string
+	}
+}
+
+// regionRecord is the region lease, stored as JSON in place of a checkpoint
+// in the lock backend. Renewed changes on every renewal, so that the record
+// bytes, which the compare-and-swap operations compare, change too.
+type regionRecord struct {
+	Holder      string `json:"holder"`
+	Region      string `json:"region"`
+	Renewed     string `json:"renewed"`
+	DurationMs  int64  `json:"duration_ms"`
+	Transitions int64  `json:"transitions"`
+}
+
+// regionLease implements leader election across regions on top of the
+// compare-and-swap operations of a ctlog.LockBackend. Like leaseElector, it
+// considers the lease expired if it didn't change for the duration recorded
+// by its holder, as measured by the local clock, so it doesn't depend on the
+// clocks of the regions being in sync.
+type regionLease struct {
+	lock     ctlog.LockBackend
+	id       [sha256.Size]byte
+	region   string
+	identity string
+	logger   *slog.Logger
+
+	duration      time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+
+	active      prometheus.Gauge
+	holder      *prometheus.GaugeVec
+	transitions prometheus.Gauge
+
+	mu           sync.Mutex
+	current      ctlog.LockedCheckpoint
+	observed     regionRecord
+	observedTime time.Time
+}
+
+func newRegionLease(rc *RegionConfig, lock ctlog.LockBackend, logger *slog.Logger) (*regionLease, error) {
+	r := &regionLease{
+		lock:     lock,
+		region:   rc.Name,
+		identity: rc.Lease.Identity,
+		logger:   logger,
+		active: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "region_active",
+			Help: "Whether this instance holds the region lease and is sequencing the logs.",
+		}),
+		holder: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "region_lease_holder",
+			Help: "Region of the holder of the region lease, as last observed, with value 1.",
+		}, []string{"region"}),
+		transitions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "region_lease_transitions",
+			Help: "Number of times the region lease changed holder.",
+		}),
+	}
+	name := rc.Lease.Name
+	if name == "" {
+		name = "sunlight"
+	}
+	// The key can't collide with a log ID, which is the hash of a public key.
+	r.id = sha256.Sum256([]byte("sunlight region lease\n" + name))
+	if r.identity == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hostname for Region.Lease.Identity: %w", err)
+		}
+		r.identity = rc.Name + "/" + host
+	}
+	var err error
+	r.duration, r.renewDeadline, r.retryPeriod, err = leaseTimings(
+		rc.Lease.Duration, rc.Lease.RenewDeadline, rc.Lease.RetryPeriod)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *regionLease) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{r.active, r.holder, r.transitions}
+}
+
+// TryAcquire makes a single attempt at acquiring the lease, and returns
+// whether this instance holds it.
+func (r *regionLease) TryAcquire(ctx context.Context) (bool, error) {
+	ok, holder, err := r.tryAcquireOrRenew(ctx)
+	switch {
+	case err != nil:
+		r.logger.Warn("failed to acquire region lease", "err", err)
+	case ok:
+		r.logger.Info("acquired region lease, this instance is active", "identity", r.identity)
+	default:
+		r.logger.Info("region lease is held by another instance, this instance is passive", "holder", holder)
+	}
+	return ok, err
+}
+
+// Acquire blocks until the lease is acquired or ctx is canceled.
+func (r *regionLease) Acquire(ctx context.Context) error {
+	lastHolder := r.observedHolder()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.retryPeriod):
+		}
+		ok, holder, err := r.tryAcquireOrRenew(ctx)
+		switch {
+		case err != nil:
+			r.logger.Warn("failed to acquire region lease", "err", err)
+		case ok:
+			r.logger.Info("acquired region lease, promoting this instance to active", "previous", lastHolder)
+			return nil
+		case holder != lastHolder:
+			lastHolder = holder
+			r.logger.Info("region lease is held by another instance", "holder", holder)
+		}
+	}
+}
+
+// Hold renews the lease every RetryPeriod until ctx is canceled, and calls
+// lost if it can't be renewed for RenewDeadline.
+func (r *regionLease) Hold(ctx context.Context, lost func()) {
+	t := time.NewTicker(r.retryPeriod)
+	defer t.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		ok, holder, err := r.tryAcquireOrRenew(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if ok {
+			renewed = time.Now()
+			continue
+		}
+		if err == nil {
+			r.logger.Error("region lease was taken by another instance", "holder", holder)
+			lost()
+			return
+		}
+		r.logger.Warn("failed to renew region lease", "err", err)
+		if time.Since(renewed) > r.renewDeadline {
+			r.logger.Error("failed to renew region lease before the deadline", "deadline", r.renewDeadline)
+			lost()
+			return
+		}
+	}
+}
+
+// Release gives up the lease, if held, so that a passive instance can take
+// over without waiting for it to expire.
+func (r *regionLease) Release(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == nil || r.observed.Holder != r.identity {
+		return
+	}
+	rec := regionRecord{Renewed: time.Now().Format(time.RFC3339Nano), Transitions: r.observed.Transitions}
+	if _, err := r.lock.Replace(ctx, r.current, rec.marshal()); err != nil {
+		r.logger.Warn("failed to release region lease", "err", err)
+		return
+	}
+	r.current = nil
+	r.active.Set(0)
+	r.logger.Info("released region lease")
+}
+
+func (r *regionLease) observedHolder() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.observed.Holder
+}
+
+// tryAcquireOrRenew returns true if this instance holds the lease after the
+// call. It returns false and no error if another instance, holder, holds it.
+func (r *regionLease) tryAcquireOrRenew(ctx context.Context) (ok bool, holder string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ok, err = r.update(ctx)
+	if ok {
+		r.active.Set(1)
+	} else {
+		r.active.Set(0)
+	}
+	return ok, r.observed.Holder, err
+}
+
+func (r *regionLease) update(ctx context.Context) (bool, error) {
+	now := time.Now()
+	next := regionRecord{
+		Holder:     r.identity,
+		Region:     r.region,
+		Renewed:    now.Format(time.RFC3339Nano),
+		DurationMs: r.duration.Milliseconds(),
+	}
+
+	current, err := r.lock.Fetch(ctx, r.id)
+	if err != nil {
+		// The lock backends don't report a missing entry with a distinct
+		// error, so try to create it, which fails if it exists.
+		next.Transitions = 1
+		if err := r.lock.Create(ctx, r.id, next.marshal()); err != nil {
+			return false, fmt.Errorf("failed to fetch region lease: %w", err)
+		}
+		created, err := r.lock.Fetch(ctx, r.id)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch created region lease: %w", err)
+		}
+		r.setObserved(created, next, now)
+		return true, nil
+	}
+	var rec regionRecord
+	if err := json.Unmarshal(current.Bytes(), &rec); err != nil {
+		return false, fmt.Errorf("invalid region lease: %w", err)
+	}
+	if rec != r.observed {
+		r.setObserved(current, rec, now)
+	}
+	r.current = current
+
+	held := rec.Holder == r.identity
+	if !held && rec.Holder != "" {
+		d := time.Duration(rec.DurationMs) * time.Millisecond
+		if r.observedTime.Add(d).After(now) {
+			return false, nil
+		}
+	}
+	next.Transitions = rec.Transitions
+	if !held {
+		next.Transitions++
+	}
+	updated, err := r.lock.Replace(ctx, current, next.marshal())
+	if err != nil {
+		// Conflicts can't be told apart from other errors, so they are
+		// retried, and the next Fetch will show the new holder.
+		return false, fmt.Errorf("failed to update region lease: %w", err)
+	}
+	r.setObserved(updated, next, now)
+	return true, nil
+}
+
+func (r *regionLease) setObserved(cp ctlog.LockedCheckpoint, rec regionRecord, now time.Time) {
+	if rec.Region != r.observed.Region {
+		r.holder.Reset()
+		if rec.Region != "" {
+			r.holder.WithLabelValues(rec.Region).Set(1)
+		}
+	}
+	r.current, r.observed, r.observedTime = cp, rec, now
+	r.transitions.Set(float64(rec.Transitions))
+}
+
+func (rec regionRecord) marshal() []byte {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
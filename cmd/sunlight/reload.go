@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+// liveLogFields are the LogConfig fields that are applied by a reload.
+var liveLogFields = []string{"PoolSize", "State", "StateTimestamp", "Retention",
+	"Maintenance", "Features",
+	"Roots", "RootsReloadInterval", "Witnesses"}
+
+// A reloader applies changes to the config file to the running process, on
+// SIGHUP or on a request to the /debug/reload endpoint.
+//
+// Only Logging.Level, Logging.Levels, and the liveLogFields of each log are
+// applied. If anything else changed, such as a key or a bucket, or if a log
+// was added or removed, the new config file is rejected as a whole, and the
+// process keeps running with the current one.
+type reloader struct {
+	path   string
+	lg     *logging
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	config *Config
+	logs   map[string]*liveLog
+}
+
+// liveLog is the part of the state of a running log that a reload can change.
+type liveLog struct {
+	ctx      context.Context
+	l        *ctlog.Log
+	logger   *slog.Logger
+	features *ctlog.Features
+
+	// client reads the log through MonitoringURL for the witnesses. It's nil
+	// if MonitoringURL is not set.
+	client *client.Client
+
+	stopRoots     context.CancelFunc
+	stopWitnesses context.CancelFunc
+}
+
+// watchRoots replaces the roots watcher of the log, if any, with one that
+// reloads path every interval. If interval is zero, the roots are not
+// reloaded.
+func (ll *liveLog) watchRoots(path string, current []byte, interval time.Duration) {
+	if ll.stopRoots != nil {
+		ll.stopRoots()
+	}
+	ctx, cancel := context.WithCancel(ll.ctx)
+	ll.stopRoots = cancel
+	if interval > 0 {
+		go watchRoots(ctx, ll.l, path, current, interval, ll.logger)
+	}
+}
+
+// runWitnesses replaces the witness submissions of the log, if any, with
+// submissions to witnesses.
+func (ll *liveLog) runWitnesses(witnesses []*client.Witness) {
+	if ll.stopWitnesses != nil {
+		ll.stopWitnesses()
+	}
+	ctx, cancel := context.WithCancel(ll.ctx)
+	ll.stopWitnesses = cancel
+	if len(witnesses) > 0 {
+		go runWitnesses(ctx, ll.client, witnesses, defaultWitnessInterval, ll.logger)
+	}
+}
+
+// reload reads the config file, and applies it if only live settings changed.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logger.Info("reloading config file", "path", r.path)
+	sdNotifyReloading(r.logger)
+	err := r.apply()
+	if err != nil {
+		r.logger.Error("config file not reloaded, keeping the current configuration", "err", err)
+	}
+	sdNotify(r.logger, "READY=1")
+	return err
+}
+
+// logChange is a validated change to a running log.
+type logChange struct {
+	ll             *liveLog
+	old, new       *LogConfig
+	stateTimestamp time.Time
+	roots          *x509util.PEMCertPool
+	rootsPEM       []byte
+	rootsInterval  time.Duration
+	witnesses      []*client.Witness
+}
+
+func (r *reloader) apply() error {
+	c, err := readConfig(r.path)
+	if err != nil {
+		return err
+	}
+
+	// Check that nothing that needs a restart changed, before applying
+	// anything.
+	static := changedFields("", r.config, c, "Logging", "LogDefaults", "Logs")
+	static = append(static, changedFields("Logging.", &r.config.Logging, &c.Logging, "Level", "Levels")...)
+	var oldNames, newNames []string
+	for _, lc := range r.config.Logs {
+		oldNames = append(oldNames, lc.ShortName)
+	}
+	for _, lc := range c.Logs {
+		newNames = append(newNames, lc.ShortName)
+	}
+	if !slices.Equal(oldNames, newNames) {
+		static = append(static, "Logs")
+	} else {
+		for i := range c.Logs {
+			static = append(static, changedFields("Logs["+c.Logs[i].ShortName+"].",
+				&r.config.Logs[i], &c.Logs[i], liveLogFields...)...)
+		}
+	}
+	if len(static) > 0 {
+		return fmt.Errorf("changes to %s require a restart", strings.Join(static, ", "))
+	}
+
+	var changes []*logChange
+	for i := range c.Logs {
+		old, lc := &r.config.Logs[i], &c.Logs[i]
+		ch := &logChange{ll: r.logs[lc.ShortName], old: old, new: lc}
+		if err := ch.check(); err != nil {
+			return fmt.Errorf("log %q: %w", lc.ShortName, err)
+		}
+		changes = append(changes, ch)
+	}
+	if err := r.lg.setLevels(c.Logging); err != nil {
+		return err
+	}
+	for _, ch := range changes {
+		ch.apply()
+	}
+	r.config = c
+	r.logger.Info("reloaded config file")
+	return nil
+}
+
+// check validates the new settings, and prepares the roots and witnesses.
+func (ch *logChange) check() error {
+	old, lc := ch.old, ch.new
+	if lc.PoolSize < 0 {
+		return errors.New("PoolSize can't be negative")
+	}
+	if lc.State != "" {
+		t, err := time.Parse(time.RFC3339, lc.StateTimestamp)
+		if err != nil {
+			return fmt.Errorf("failed to parse StateTimestamp: %w", err)
+		}
+		ch.stateTimestamp = t
+	}
+	if lc.Roots != old.Roots || lc.RootsReloadInterval != old.RootsReloadInterval {
+		if len(lc.CCADB.Stores) > 0 {
+			return errors.New("Roots and RootsReloadInterval can't be changed with CCADB")
+		}
+		ch.rootsInterval = defaultRootsReloadInterval
+		if lc.RootsReloadInterval != "" {
+			d, err := time.ParseDuration(lc.RootsReloadInterval)
+			if err != nil {
+				return fmt.Errorf("failed to parse RootsReloadInterval: %w", err)
+			}
+			ch.rootsInterval = d
+		}
+		roots, rootsPEM, err := loadRoots(ch.ll.ctx, lc.Roots)
+		if err != nil {
+			return fmt.Errorf("failed to load roots: %w", err)
+		}
+		ch.roots, ch.rootsPEM = roots, rootsPEM
+	}
+	for name := range lc.Features {
+		if _, err := ctlog.ParseFeature(name); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(lc.Witnesses, old.Witnesses) {
+		if len(lc.Witnesses) > 0 && ch.ll.client == nil {
+			return errors.New("Witnesses requires MonitoringURL")
+		}
+		ch.witnesses = []*client.Witness{}
+		for _, w := range lc.Witnesses {
+			cw, err := newWitness(w.URL, w.PublicKey, nil, "filippo.io/sunlight witness")
+			if err != nil {
+				return fmt.Errorf("invalid witness %q: %w", w.URL, err)
+			}
+			ch.witnesses = append(ch.witnesses, cw)
+		}
+	}
+	return nil
+}
+
+func (ch *logChange) apply() {
+	ll, old, lc := ch.ll, ch.old, ch.new
+	ll.l.SetPoolSize(lc.PoolSize)
+	ll.l.SetState(lc.State, ch.stateTimestamp)
+	if lc.Maintenance != old.Maintenance {
+		ll.l.SetMaintenance(lc.Maintenance)
+	}
+	if !reflect.DeepEqual(lc.Features, old.Features) {
+		ll.features.SetConfig(lc.Features)
+		ll.logger.Info("features changed", "features", lc.Features)
+	}
+	if ch.roots != nil {
+		ll.l.SetRoots(ch.roots)
+		ll.watchRoots(lc.Roots, ch.rootsPEM, ch.rootsInterval)
+	}
+	if ch.witnesses != nil {
+		ll.logger.Info("witnesses changed", "witnesses", len(ch.witnesses))
+		ll.runWitnesses(ch.witnesses)
+	}
+}
+
+// changedFields returns the names, with prefix, of the fields that differ
+// between a and b, two pointers to structs of the same type, except for the
+// fields named in skip.
+func changedFields(prefix string, a, b any, skip ...string) []string {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	var changed []string
+	for i := range va.NumField() {
+		name := va.Type().Field(i).Name
+		if slices.Contains(skip, name) {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, prefix+name)
+		}
+	}
+	return changed
+}
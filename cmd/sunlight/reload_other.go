@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "context"
+
+// SIGHUP is only supported on Unix systems. Elsewhere, the config file can be
+// reloaded through the /debug/reload endpoint.
+
+func handleReloads(ctx context.Context, r *reloader) {}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// resubmitRecord is a line of the "sunlight resubmit" output file.
+type resubmitRecord struct {
+	// File is the path of the PEM file the chain was read from.
+	File string `json:"file"`
+
+	// Fingerprint is the hex-encoded SHA-256 hash of the submitted leaf.
+	Fingerprint string `json:"fingerprint"`
+	IsPrecert   bool   `json:"is_precert"`
+
+	// SCT is the base64-encoded TLS SignedCertificateTimestamp, which can be
+	// verified with "sunlight verify-sct -sct".
+	SCT       string `json:"sct,omitempty"`
+	LeafIndex *int64 `json:"leaf_index,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// resubmit implements the "sunlight resubmit" command, which submits the
+// chains in the PEM files passed as arguments, or found in the directories
+// passed as arguments, such as the issuance records provided by a CA after an
+// outage, and records the returned SCTs.
+//
+// Each file holds one chain, starting with the certificate or precertificate,
+// followed by its intermediates, and optionally the root. With -list, the
+// paths are read one per line from a file, or from stdin if it's "-".
+//
+// A JSON line is appended to -o for each chain, with its SCT or the error.
+// Chains whose first certificate is already recorded with an SCT in -o are
+// skipped, so an interrupted or
+// partially failed run can be repeated with the same arguments.
+func resubmit(args []string) {
+	fs := flag.NewFlagSet("sunlight resubmit", flag.ExitOnError)
+	urlFlag := fs.String("url", "", "submission URL prefix of the log, without ct/v1/ (required)")
+	listFlag := fs.String("list", "", "file with the paths of the PEM files to submit, one per line, or - for stdin")
+	outFlag := fs.String("o", "", "JSON Lines file where the results are appended (required)")
+	concurrencyFlag := fs.Int("concurrency", 4, "maximum number of concurrent submissions")
+	retriesFlag := fs.Int("retries", 5, "number of retries of each submission after a rate limit or transient error")
+	tokenFlag := fs.String("token", "", "value of the Sunlight-Test-Submission header, for TestRoots")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *urlFlag == "" || *outFlag == "" {
+		logger.Error("-url and -o are required")
+		os.Exit(1)
+	}
+	if *concurrencyFlag <= 0 || *retriesFlag < 0 {
+		logger.Error("-concurrency must be positive and -retries not negative")
+		os.Exit(1)
+	}
+
+	paths, err := resubmitPaths(fs.Args(), *listFlag)
+	if err != nil {
+		logger.Error("failed to list files", "err", err)
+		os.Exit(1)
+	}
+	done, err := resubmitDone(*outFlag)
+	if err != nil {
+		logger.Error("failed to read output file", "err", err)
+		os.Exit(1)
+	}
+	out, err := os.OpenFile(*outFlag, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		logger.Error("failed to open output file", "err", err)
+		os.Exit(1)
+	}
+	defer out.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	s := &submitter{
+		url:       strings.TrimSuffix(*urlFlag, "/") + "/ct/v1/",
+		token:     *tokenFlag,
+		userAgent: "filippo.io/sunlight resubmit",
+		hc:        &http.Client{Timeout: 1 * time.Minute},
+	}
+	var mu sync.Mutex
+	var submitted, skipped, failed int
+	record := func(r *resubmitRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		b, err := json.Marshal(r)
+		if err == nil {
+			_, err = out.Write(append(b, '\n'))
+		}
+		if err != nil {
+			logger.Error("failed to write output file", "err", err)
+			os.Exit(1)
+		}
+		if r.Error != "" {
+			failed++
+			logger.Warn("submission failed", "file", r.File, "err", r.Error)
+		} else {
+			submitted++
+			logger.Debug("submitted", "file", r.File, "leaf_index", r.LeafIndex)
+		}
+		if n := submitted + failed; n%1000 == 0 {
+			logger.Info("resubmit progress", "submitted", submitted, "failed", failed,
+				"skipped", skipped, "total", len(paths))
+		}
+	}
+
+	sem := make(chan struct{}, *concurrencyFlag)
+	var wg sync.WaitGroup
+	for _, path := range paths {
+		chain, isPrecert, err := readResubmitChain(path)
+		if err != nil {
+			record(&resubmitRecord{File: path, Error: err.Error()})
+			continue
+		}
+		fp := sha256.Sum256(chain[0])
+		if done[fp] {
+			skipped++
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r := &resubmitRecord{File: path, Fingerprint: hex.EncodeToString(fp[:]), IsPrecert: isPrecert}
+			sct, err := s.submitWithRetries(ctx, chain, isPrecert, *retriesFlag, logger)
+			if err == nil {
+				err = r.setSCT(sct)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return // not recorded, so it's retried by the next run
+				}
+				r.Error = err.Error()
+			}
+			record(r)
+		}()
+	}
+	wg.Wait()
+
+	logger.Info("resubmit complete", "submitted", submitted, "failed", failed,
+		"skipped", skipped, "total", len(paths))
+	if failed > 0 || ctx.Err() != nil {
+		os.Exit(1)
+	}
+}
+
+func (r *resubmitRecord) setSCT(sct *ct.SignedCertificateTimestamp) error {
+	b, err := tls.Marshal(*sct)
+	if err != nil {
+		return fmt.Errorf("failed to encode SCT: %w", err)
+	}
+	index, err := ctlog.ParseExtensions(sct.Extensions)
+	if err != nil {
+		return fmt.Errorf("invalid SCT extensions: %w", err)
+	}
+	r.SCT = base64.StdEncoding.EncodeToString(b)
+	r.LeafIndex, r.Timestamp = &index, int64(sct.Timestamp)
+	return nil
+}
+
+// resubmitPaths returns the PEM files in args, walking directories, and in the
+// -list file, if set.
+func resubmitPaths(args []string, list string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && (path == arg || strings.HasSuffix(path, ".pem") || strings.HasSuffix(path, ".crt")) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if list != "" {
+		var r io.Reader = os.Stdin
+		if list != "-" {
+			f, err := os.Open(list)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			if line := strings.TrimSpace(sc.Text()); line != "" {
+				paths = append(paths, line)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no files to submit")
+	}
+	return paths, nil
+}
+
+// resubmitDone returns the fingerprints of the chains successfully submitted
+// according to the output file at path, if it exists.
+func resubmitDone(path string) (map[[sha256.Size]byte]bool, error) {
+	done := make(map[[sha256.Size]byte]bool)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var r resubmitRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("invalid line in %q: %w", path, err)
+		}
+		fp, err := hex.DecodeString(r.Fingerprint)
+		if r.SCT == "" || err != nil || len(fp) != sha256.Size {
+			continue
+		}
+		done[[sha256.Size]byte(fp)] = true
+	}
+	return done, sc.Err()
+}
+
+// readResubmitChain reads a PEM chain, and reports whether its first
+// certificate is a precertificate.
+func readResubmitChain(path string) (chain [][]byte, isPrecert bool, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, false, errors.New("no certificates in file")
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if x509.IsFatal(err) {
+		return nil, false, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return chain, leaf.IsPrecertificate(), nil
+}
+
+// submitter submits chains to the add-chain and add-pre-chain endpoints of a
+// log.
+type submitter struct {
+	// url is the prefix of the endpoints, ending in "ct/v1/".
+	url       string
+	token     string
+	userAgent string
+	hc        *http.Client
+}
+
+// errInvalidResponse is wrapped by the errors returned by [submitter.submit]
+// for a 200 response that can't be parsed.
+var errInvalidResponse = errors.New("invalid response")
+
+// submitError is returned by [submitter.submit] for a non-200 response.
+type submitError struct {
+	status     int
+	retryAfter time.Duration
+	body       string
+}
+
+func (err *submitError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", err.status, err.body)
+}
+
+// retryable returns whether the submission might succeed if retried.
+func (err *submitError) retryable() bool {
+	return err.status == http.StatusTooManyRequests || err.status >= 500
+}
+
+// submit submits chain, and returns the SCT.
+func (s *submitter) submit(ctx context.Context, chain [][]byte, isPrecert bool) (*ct.SignedCertificateTimestamp, error) {
+	endpoint := "add-chain"
+	if isPrecert {
+		endpoint = "add-pre-chain"
+	}
+	body, err := json.Marshal(struct {
+		Chain [][]byte `json:"chain"`
+	}{Chain: chain})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", s.userAgent)
+	if s.token != "" {
+		req.Header.Set(ctlog.TestSubmissionHeader, s.token)
+	}
+	resp, err := s.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	rspBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := &submitError{status: resp.StatusCode, body: strings.TrimSpace(string(rspBody))}
+		if secs, e := strconv.Atoi(resp.Header.Get("Retry-After")); e == nil {
+			err.retryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, err
+	}
+	var r ct.AddChainResponse
+	if err := json.Unmarshal(rspBody, &r); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidResponse, err)
+	}
+	sct, err := r.ToSignedCertificateTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidResponse, err)
+	}
+	return sct, nil
+}
+
+// submitWithRetries calls submit, retrying rate limited requests and transient
+// errors up to retries times, with exponential backoff.
+func (s *submitter) submitWithRetries(ctx context.Context, chain [][]byte, isPrecert bool,
+	retries int, logger *slog.Logger) (*ct.SignedCertificateTimestamp, error) {
+	backoff := 1 * time.Second
+	for attempt := 0; ; attempt++ {
+		sct, err := s.submit(ctx, chain, isPrecert)
+		var serr *submitError
+		if err == nil || attempt == retries || ctx.Err() != nil ||
+			errors.As(err, &serr) && !serr.retryable() {
+			return sct, err
+		}
+		wait := backoff
+		if serr != nil && serr.retryAfter > wait {
+			wait = serr.retryAfter
+		}
+		logger.Debug("retrying submission", "err", err, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, 1*time.Minute)
+	}
+}
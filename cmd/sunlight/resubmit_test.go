@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func writePEMChain(t *testing.T, path string, chain ...[]byte) {
+	var b []byte
+	for _, der := range chain {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	fatalIfErr(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	fatalIfErr(t, os.WriteFile(path, b, 0o644))
+}
+
+func TestReadResubmitChain(t *testing.T) {
+	tl := newTestLog(t)
+	dir := t.TempDir()
+	leaf, pre := tl.issue(t, false), tl.issue(t, true)
+	writePEMChain(t, filepath.Join(dir, "a", "leaf.pem"), leaf, tl.intermediate)
+	writePEMChain(t, filepath.Join(dir, "a", "pre.crt"), pre, tl.intermediate, tl.root)
+	fatalIfErr(t, os.WriteFile(filepath.Join(dir, "a", "README"), []byte("not a chain"), 0o644))
+	fatalIfErr(t, os.WriteFile(filepath.Join(dir, "empty.pem"), []byte("not a chain"), 0o644))
+
+	chain, isPrecert, err := readResubmitChain(filepath.Join(dir, "a", "leaf.pem"))
+	fatalIfErr(t, err)
+	if isPrecert || len(chain) != 2 || !bytes.Equal(chain[0], leaf) || !bytes.Equal(chain[1], tl.intermediate) {
+		t.Errorf("got %d certificates and precert %v, expected the leaf chain", len(chain), isPrecert)
+	}
+	chain, isPrecert, err = readResubmitChain(filepath.Join(dir, "a", "pre.crt"))
+	fatalIfErr(t, err)
+	if !isPrecert || len(chain) != 3 || !bytes.Equal(chain[0], pre) {
+		t.Errorf("got %d certificates and precert %v, expected the precertificate chain", len(chain), isPrecert)
+	}
+	if _, _, err := readResubmitChain(filepath.Join(dir, "empty.pem")); err == nil {
+		t.Errorf("read a chain from a file without certificates")
+	}
+
+	// Directories are walked for .pem and .crt files, while files passed
+	// explicitly or listed are used regardless of their name.
+	list := filepath.Join(dir, "list.txt")
+	fatalIfErr(t, os.WriteFile(list, []byte("\n  listed.der  \n\n"), 0o644))
+	paths, err := resubmitPaths([]string{filepath.Join(dir, "a"), filepath.Join(dir, "a", "README")}, list)
+	fatalIfErr(t, err)
+	want := []string{filepath.Join(dir, "a", "leaf.pem"), filepath.Join(dir, "a", "pre.crt"),
+		filepath.Join(dir, "a", "README"), "listed.der"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("got paths %q, expected %q", paths, want)
+	}
+	if _, err := resubmitPaths(nil, ""); err == nil {
+		t.Errorf("accepted no files")
+	}
+}
+
+func TestResubmitDone(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	done, err := resubmitDone(out)
+	fatalIfErr(t, err)
+	if len(done) != 0 {
+		t.Errorf("got %d done chains without an output file", len(done))
+	}
+
+	fpA, fpB := sha256.Sum256([]byte("a")), sha256.Sum256([]byte("b"))
+	var b []byte
+	for _, r := range []resubmitRecord{
+		{File: "a.pem", Fingerprint: hex.EncodeToString(fpA[:]), SCT: "AA=="},
+		{File: "b.pem", Fingerprint: hex.EncodeToString(fpB[:]), Error: "HTTP 503: pool full"},
+		{File: "c.pem", Error: "no certificates in file"},
+	} {
+		line, err := json.Marshal(r)
+		fatalIfErr(t, err)
+		b = append(append(b, line...), '\n')
+	}
+	fatalIfErr(t, os.WriteFile(out, b, 0o644))
+	done, err = resubmitDone(out)
+	fatalIfErr(t, err)
+	if len(done) != 1 || !done[fpA] {
+		t.Errorf("got done %v, expected only the chain with an SCT", done)
+	}
+
+	fatalIfErr(t, os.WriteFile(out, append(b, "{truncated\n"...), 0o644))
+	if _, err := resubmitDone(out); err == nil {
+		t.Errorf("accepted an invalid output file")
+	}
+}
+
+func TestSubmitter(t *testing.T) {
+	tl := newTestLog(t)
+	s := &submitter{url: tl.URL + "ct/v1/", userAgent: "test", hc: tl.Server.Client()}
+	ctx := context.Background()
+
+	for i, precert := range []bool{false, true} {
+		leaf := tl.issue(t, precert)
+		sct, err := s.submit(ctx, tl.chain(leaf), precert)
+		fatalIfErr(t, err)
+		r := &resubmitRecord{}
+		fatalIfErr(t, r.setSCT(sct))
+		if r.LeafIndex == nil || *r.LeafIndex != int64(i) || r.Timestamp != int64(sct.Timestamp) {
+			t.Errorf("got leaf index %v and timestamp %d, expected %d", r.LeafIndex, r.Timestamp, i)
+		}
+		e, err := tl.EntryForSCT(ctx, decodeBase64(t, r.SCT))
+		fatalIfErr(t, err)
+		if e.IsPrecert != precert {
+			t.Errorf("got logged precert %v, expected %v", e.IsPrecert, precert)
+		}
+	}
+
+	// Submitting a precertificate to add-chain is rejected, and not retried.
+	_, err := s.submitWithRetries(ctx, tl.chain(tl.issue(t, true)), false, 3, discardLogger())
+	var serr *submitError
+	if !errors.As(err, &serr) || serr.status != http.StatusBadRequest || serr.retryable() {
+		t.Errorf("got error %v, expected a non-retryable HTTP 400", err)
+	}
+}
+
+func TestSubmitterRequests(t *testing.T) {
+	tl := newTestLog(t)
+	var requests atomic.Int64
+	var status atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" ||
+			r.Header.Get("User-Agent") != "filippo.io/sunlight resubmit" ||
+			r.Header.Get(ctlog.TestSubmissionHeader) != "token" {
+			t.Errorf("unexpected request %s with headers %v", r.Method, r.Header)
+		}
+		if code := int(status.Load()); code != http.StatusOK {
+			if code == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "30")
+			}
+			http.Error(w, "  try again later\n", code)
+			return
+		}
+		// Forward the request to the log, checking that the body is exactly
+		// the chain in the expected format.
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request: %v", err)
+			return
+		}
+		var req struct {
+			Chain [][]byte `json:"chain"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		} else if b, _ := json.Marshal(req); !bytes.Equal(b, body) {
+			t.Errorf("unexpected request body %s", body)
+		}
+		if p := r.URL.Path; p != "/ct/v1/add-chain" && p != "/ct/v1/add-pre-chain" {
+			t.Errorf("unexpected path %q", p)
+		}
+		resp, err := tl.Server.Client().Post(tl.URL+r.URL.Path[1:], "application/json", bytes.NewReader(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer ts.Close()
+	s := &submitter{url: ts.URL + "/ct/v1/", token: "token",
+		userAgent: "filippo.io/sunlight resubmit", hc: ts.Client()}
+	ctx := context.Background()
+
+	t.Run("Endpoints", func(t *testing.T) {
+		status.Store(http.StatusOK)
+		for _, precert := range []bool{false, true} {
+			if _, err := s.submit(ctx, tl.chain(tl.issue(t, precert)), precert); err != nil {
+				t.Errorf("precert %v: %v", precert, err)
+			}
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		status.Store(http.StatusTooManyRequests)
+		_, err := s.submit(ctx, tl.chain(tl.issue(t, false)), false)
+		var serr *submitError
+		if !errors.As(err, &serr) || !serr.retryable() {
+			t.Fatalf("got error %v, expected a retryable submitError", err)
+		}
+		if err.Error() != "HTTP 429: try again later" || serr.retryAfter != 30*time.Second {
+			t.Errorf("got error %q with Retry-After %v", err, serr.retryAfter)
+		}
+		status.Store(http.StatusForbidden)
+		_, err = s.submit(ctx, tl.chain(tl.issue(t, false)), false)
+		if !errors.As(err, &serr) || serr.status != http.StatusForbidden || serr.retryable() {
+			t.Errorf("got error %v, expected a non-retryable HTTP 403", err)
+		}
+	})
+
+	t.Run("Retries", func(t *testing.T) {
+		status.Store(http.StatusServiceUnavailable)
+		requests.Store(0)
+		_, err := s.submitWithRetries(ctx, tl.chain(tl.issue(t, false)), false, 0, discardLogger())
+		if err == nil || requests.Load() != 1 {
+			t.Errorf("got error %v after %d requests, expected one failed request", err, requests.Load())
+		}
+
+		// A retried submission succeeds once the log recovers.
+		requests.Store(0)
+		time.AfterFunc(100*time.Millisecond, func() { status.Store(http.StatusOK) })
+		if _, err := s.submitWithRetries(ctx, tl.chain(tl.issue(t, false)), false, 1, discardLogger()); err != nil {
+			t.Errorf("retried submission failed: %v", err)
+		}
+		if requests.Load() != 2 {
+			t.Errorf("got %d requests, expected 2", requests.Load())
+		}
+
+		// Waiting for a retry is interrupted by the context.
+		status.Store(http.StatusServiceUnavailable)
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err = s.submitWithRetries(ctx, tl.chain(tl.issue(t, false)), false, 5, discardLogger())
+		if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 900*time.Millisecond {
+			t.Errorf("got error %v after %v, expected the context error", err, time.Since(start))
+		}
+	})
+
+	t.Run("InvalidResponse", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"sct_version":0,"id":"not base64"}`))
+		}))
+		defer ts.Close()
+		s := &submitter{url: ts.URL + "/ct/v1/", hc: ts.Client()}
+		_, err := s.submit(ctx, tl.chain(tl.issue(t, false)), false)
+		if !errors.Is(err, errInvalidResponse) {
+			t.Errorf("got error %v, expected an invalid response", err)
+		}
+	})
+}
+
+func decodeBase64(t *testing.T, s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	fatalIfErr(t, err)
+	return b
+}
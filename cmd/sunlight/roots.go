@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+// defaultRootsReloadInterval is how often the roots are checked for changes,
+// if RootsReloadInterval is not set.
+const defaultRootsReloadInterval = 1 * time.Minute
+
+// maxRootsSize is the maximum size of a roots PEM file fetched from a URL.
+const maxRootsSize = 16 << 20
+
+// loadRoots reads the roots PEM from a file, or from a URL if it starts with
+// "https://". It returns the raw contents too, to detect changes.
+func loadRoots(ctx context.Context, path string) (*x509util.PEMCertPool, []byte, error) {
+	var pemBytes []byte
+	if strings.HasPrefix(path, "https://") {
+		req, err := http.NewRequestWithContext(ctx, "GET", path, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("User-Agent", "filippo.io/sunlight")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+		}
+		pemBytes, err = io.ReadAll(io.LimitReader(resp.Body, maxRootsSize))
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		var err error
+		pemBytes, err = os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	r := x509util.NewPEMCertPool()
+	if ok := r.AppendCertsFromPEM(pemBytes); !ok {
+		return nil, nil, errors.New("no valid certificates in roots")
+	}
+	return r, pemBytes, nil
+}
+
+// watchRoots polls path every interval, and replaces the log's roots when its
+// contents change. Errors are logged, and the previous roots are kept.
+func watchRoots(ctx context.Context, l *ctlog.Log, path string, current []byte,
+	interval time.Duration, logger *slog.Logger) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		r, pemBytes, err := loadRoots(ctx, path)
+		if err != nil {
+			logger.Error("failed to reload roots", "err", err)
+			l.Alert(ctx, ctlog.AlertRootsReload, "failed to reload roots", err)
+			continue
+		}
+		if bytes.Equal(pemBytes, current) {
+			continue
+		}
+		current = pemBytes
+		l.SetRoots(r)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// sdNotify sends state to the systemd service manager, as documented in
+// sd_notify(3), if the process was started with NOTIFY_SOCKET. Errors are
+// logged, since the service keeps working regardless.
+func sdNotify(logger *slog.Logger, state string) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return
+	}
+	// A leading @ is an abstract socket, which is handled by package net.
+	conn, err := net.Dial("unixgram", addr)
+	if err == nil {
+		_, err = conn.Write([]byte(state))
+		conn.Close()
+	}
+	if err != nil {
+		logger.Warn("failed to notify systemd", "state", state, "err", err)
+	}
+}
+
+// sdNotifyReloading reports that the config file is being reloaded. The
+// MONOTONIC_USEC field is required by services with Type=notify-reload.
+func sdNotifyReloading(logger *slog.Logger) {
+	state := "RELOADING=1"
+	if us, ok := monotonicMicroseconds(); ok {
+		state += "\nMONOTONIC_USEC=" + strconv.FormatUint(us, 10)
+	}
+	sdNotify(logger, state)
+}
+
+// runWatchdog pings the systemd watchdog, if enabled with WatchdogSec=, at
+// half the watchdog interval, as long as the sequencer of every log made
+// progress within the interval. Otherwise, it stops pinging, and systemd
+// restarts the process, so that a stuck sequencer doesn't go unnoticed just
+// because the HTTP server still answers.
+func runWatchdog(ctx context.Context, logs map[string]*ctlog.Log, logger *slog.Logger) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	interval := time.Duration(usec) * time.Microsecond
+	logger.Info("systemd watchdog enabled", "interval", interval)
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	for {
+		if stalled := stalledSequencer(logs, interval); stalled != "" {
+			logger.Error("sequencer is stuck, not pinging the systemd watchdog", "log", stalled,
+				"last_progress", logs[stalled].SequencerProgress())
+		} else {
+			sdNotify(logger, "WATCHDOG=1")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// stalledSequencer returns the name of a log whose sequencer didn't complete
+// a round within d, if any.
+func stalledSequencer(logs map[string]*ctlog.Log, d time.Duration) string {
+	for name, l := range logs {
+		if p := l.SequencerProgress(); !p.IsZero() && time.Since(p) > d {
+			return name
+		}
+	}
+	return ""
+}
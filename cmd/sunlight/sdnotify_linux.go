@@ -0,0 +1,13 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// monotonicMicroseconds returns the CLOCK_MONOTONIC time, which is what
+// systemd compares MONOTONIC_USEC against.
+func monotonicMicroseconds() (uint64, bool) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0, false
+	}
+	return uint64(ts.Nano() / 1000), true
+}
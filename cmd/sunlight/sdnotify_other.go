@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// systemd only runs on Linux.
+
+func monotonicMicroseconds() (uint64, bool) {
+	return 0, false
+}
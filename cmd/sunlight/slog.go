@@ -3,7 +3,13 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"sync/atomic"
 )
 
 type multiHandler []slog.Handler
@@ -74,3 +80,143 @@ func (h filterHandler) WithGroup(name string) slog.Handler {
 		filter:  h.filter,
 	}
 }
+
+// levelHandler drops records below level, so that loggers sharing the same
+// underlying handlers can have different levels.
+type levelHandler struct {
+	level   slog.Leveler
+	handler slog.Handler
+}
+
+func (h levelHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= h.level.Level() && h.handler.Enabled(ctx, l)
+}
+
+func (h levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler.Handle(ctx, r)
+}
+
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{level: h.level, handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{level: h.level, handler: h.handler.WithGroup(name)}
+}
+
+// logSubsystems are the valid keys of Logging.Levels.
+var logSubsystems = []string{"log", "backend", "lock", "signer", "http", "metrics", "witness", "lease"}
+
+// logging produces the handlers for each subsystem, according to the Logging
+// configuration. Subsystems without a configured level follow level, which is
+// changed by the /debug/logson and /debug/logsoff endpoints. The levels can be
+// replaced by setLevels when the configuration is reloaded.
+type logging struct {
+	base   slog.Handler
+	level  *slog.LevelVar
+	levels map[string]*subsystemLevel
+}
+
+// subsystemLevel is the level of a subsystem, which follows the process level
+// unless it's overridden by Logging.Levels.
+type subsystemLevel struct {
+	process  *slog.LevelVar
+	override atomic.Pointer[slog.Level]
+}
+
+func (l *subsystemLevel) Level() slog.Level {
+	if o := l.override.Load(); o != nil {
+		return *o
+	}
+	return l.process.Level()
+}
+
+// newLogging returns the logging setup for c. The zero value of c produces
+// human-readable logs on stderr and JSON logs on stdout.
+func newLogging(c LoggingConfig) (*logging, error) {
+	lg := &logging{level: new(slog.LevelVar), levels: make(map[string]*subsystemLevel)}
+	for _, subsystem := range logSubsystems {
+		lg.levels[subsystem] = &subsystemLevel{process: lg.level}
+	}
+	if err := lg.setLevels(c); err != nil {
+		return nil, err
+	}
+
+	// The underlying handlers accept all levels, and levelHandler filters.
+	all := &slog.HandlerOptions{Level: slog.Level(math.MinInt)}
+	allWithSource := &slog.HandlerOptions{Level: slog.Level(math.MinInt), AddSource: true}
+	var w io.Writer = os.Stderr
+	if c.File != "" {
+		maxSize, maxBackups := c.MaxSizeMB, c.MaxBackups
+		if maxSize == 0 {
+			maxSize = defaultLogMaxSizeMB
+		}
+		if maxBackups == 0 {
+			maxBackups = defaultLogMaxBackups
+		}
+		f, err := newRotatingFile(c.File, int64(maxSize)<<20, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	switch c.Format {
+	case "":
+		if c.File != "" {
+			lg.base = slog.NewJSONHandler(w, allWithSource)
+			break
+		}
+		lg.base = multiHandler([]slog.Handler{
+			slog.NewJSONHandler(os.Stdout, allWithSource),
+			slog.NewTextHandler(os.Stderr, all),
+		})
+	case "json":
+		lg.base = slog.NewJSONHandler(w, allWithSource)
+	case "text":
+		lg.base = slog.NewTextHandler(w, all)
+	default:
+		return nil, fmt.Errorf("unknown Logging.Format %q", c.Format)
+	}
+	return lg, nil
+}
+
+// setLevels applies c.Level and c.Levels. If either is invalid, nothing is
+// changed.
+func (lg *logging) setLevels(c LoggingConfig) error {
+	level := slog.LevelInfo
+	if c.Level != "" {
+		if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+			return fmt.Errorf("invalid Logging.Level: %w", err)
+		}
+	}
+	overrides := make(map[string]slog.Level)
+	for subsystem, level := range c.Levels {
+		if !slices.Contains(logSubsystems, subsystem) {
+			return fmt.Errorf("unknown Logging.Levels subsystem %q, expected one of %v", subsystem, logSubsystems)
+		}
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid Logging.Levels level for %q: %w", subsystem, err)
+		}
+		overrides[subsystem] = l
+	}
+	lg.level.Set(level)
+	for subsystem, l := range lg.levels {
+		if o, ok := overrides[subsystem]; ok {
+			l.override.Store(&o)
+		} else {
+			l.override.Store(nil)
+		}
+	}
+	return nil
+}
+
+// handler returns the handler for subsystem, or for the rest of the process
+// if subsystem is empty.
+func (lg *logging) handler(subsystem string) slog.Handler {
+	var level slog.Leveler = lg.level
+	if l, ok := lg.levels[subsystem]; ok {
+		level = l
+	}
+	return levelHandler{level: level, handler: lg.base}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const defaultStatsDInterval = 10 * time.Second
+
+// maxStatsDPacket is the maximum size of a StatsD UDP packet, chosen to fit in
+// a typical Ethernet MTU.
+const maxStatsDPacket = 1432
+
+// statsdPusher periodically gathers the Prometheus metrics and sends them as
+// StatsD lines, with labels as DogStatsD tags (name:value|type|#k:v,k:v),
+// which are supported by the Datadog agent, Telegraf, and statsd_exporter.
+//
+// Gauges are sent as gauges. Prometheus counters, and the sums and counts of
+// summaries and histograms, are cumulative, so their increase since the
+// previous push is sent as a StatsD counter. Summary quantiles are sent as
+// gauges tagged with the quantile. Histogram buckets are not sent.
+type statsdPusher struct {
+	gatherer prometheus.Gatherer
+	conn     net.Conn
+	prefix   string
+	logger   *slog.Logger
+
+	// last is the previous value of cumulative metrics, by line prefix.
+	last map[string]float64
+}
+
+func newStatsDPusher(g prometheus.Gatherer, addr, prefix string, logger *slog.Logger) (*statsdPusher, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdPusher{
+		gatherer: g,
+		conn:     conn,
+		prefix:   prefix,
+		logger:   logger,
+		last:     make(map[string]float64),
+	}, nil
+}
+
+func (s *statsdPusher) run(ctx context.Context, interval time.Duration) {
+	defer s.conn.Close()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := s.push(); err != nil {
+			s.logger.Warn("failed to push StatsD metrics", "err", err)
+		}
+	}
+}
+
+func (s *statsdPusher) push() error {
+	mfs, err := s.gatherer.Gather()
+	if err != nil {
+		// Gather returns what it could collect along with the error.
+		s.logger.Warn("failed to gather some metrics", "err", err)
+	}
+	var lines []string
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			lines = append(lines, s.lines(mf.GetName(), mf.GetType(), m)...)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxStatsDPacket {
+			if _, err := s.conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		if _, err := s.conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *statsdPusher) lines(name string, typ dto.MetricType, m *dto.Metric) []string {
+	var tags []string
+	for _, l := range m.GetLabel() {
+		tags = append(tags, statsdEscape(l.GetName())+":"+statsdEscape(l.GetValue()))
+	}
+	var lines []string
+	gauge := func(name string, v float64, extra ...string) {
+		lines = append(lines, s.line(name, v, "g", append(tags, extra...)))
+	}
+	counter := func(name string, v float64) {
+		key := s.line(name, 0, "c", tags)
+		last, ok := s.last[key]
+		s.last[key] = v
+		// Skip the first observation, which has no previous value, and
+		// counter resets.
+		if !ok || v < last {
+			return
+		}
+		lines = append(lines, s.line(name, v-last, "c", tags))
+	}
+	switch typ {
+	case dto.MetricType_COUNTER:
+		counter(name, m.GetCounter().GetValue())
+	case dto.MetricType_GAUGE:
+		gauge(name, m.GetGauge().GetValue())
+	case dto.MetricType_UNTYPED:
+		gauge(name, m.GetUntyped().GetValue())
+	case dto.MetricType_SUMMARY:
+		counter(name+"_sum", m.GetSummary().GetSampleSum())
+		counter(name+"_count", float64(m.GetSummary().GetSampleCount()))
+		for _, q := range m.GetSummary().GetQuantile() {
+			gauge(name, q.GetValue(), "quantile:"+strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+		}
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		counter(name+"_sum", m.GetHistogram().GetSampleSum())
+		counter(name+"_count", float64(m.GetHistogram().GetSampleCount()))
+	}
+	return lines
+}
+
+func (s *statsdPusher) line(name string, v float64, typ string, tags []string) string {
+	line := fmt.Sprintf("%s%s:%s|%s", s.prefix, name, strconv.FormatFloat(v, 'g', -1, 64), typ)
+	if len(tags) > 0 {
+		tags = append([]string(nil), tags...)
+		sort.Strings(tags)
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// statsdEscape replaces the characters that are special in DogStatsD tags.
+func statsdEscape(s string) string {
+	return strings.NewReplacer("|", "_", ",", "_", "#", "_", ":", "_", "\n", "_").Replace(s)
+}
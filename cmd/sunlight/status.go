@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"filippo.io/sunlight"
+	"filippo.io/sunlight/internal/ctlog"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// statusPage is the content of status.json, and the data of status.html.
+type statusPage struct {
+	Generated time.Time   `json:"generated"`
+	Logs      []statusLog `json:"logs"`
+}
+
+type statusLog struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	SubmissionURL string `json:"submission_url,omitempty"`
+	MonitoringURL string `json:"monitoring_url,omitempty"`
+	State         string `json:"state,omitempty"`
+
+	// NotAfterStart and NotAfterLimit are the shard's temporal interval.
+	NotAfterStart time.Time `json:"not_after_start"`
+	NotAfterLimit time.Time `json:"not_after_limit"`
+
+	// Roots is the number of accepted roots, excluding DeniedRoots.
+	Roots int `json:"roots"`
+
+	TreeSize       int64      `json:"tree_size"`
+	RootHash       string     `json:"root_hash,omitempty"`
+	CheckpointTime *time.Time `json:"checkpoint_time,omitempty"`
+
+	// Cosigners are the key names of the checkpoint signatures other than
+	// the log's own, such as witnesses and CheckpointKeys. They are listed,
+	// not verified.
+	Cosigners []string `json:"cosigners,omitempty"`
+
+	// Error is set if the log's checkpoint couldn't be read or verified.
+	Error string `json:"error,omitempty"`
+}
+
+//go:embed status.html
+var statusTemplateText string
+
+var statusTemplate = template.Must(template.New("status").Parse(statusTemplateText))
+
+// status implements the "sunlight status" command, which renders a static
+// status page of the logs in the config file from their backends, and uploads
+// it to each of them as status.html and status.json, next to the checkpoint.
+// It's meant to be run periodically, for example from cron.
+//
+// A log whose checkpoint can't be fetched or verified is listed with the error
+// rather than failing the command, as that's what the public needs to see.
+func status(args []string) {
+	fs := flag.NewFlagSet("sunlight status", flag.ExitOnError)
+	configFlag := fs.String("c", "sunlight.yaml", "path to the config file")
+	logFlag := fs.String("log", "", "ShortName of the log to include, by default all logs")
+	outFlag := fs.String("o", "", "directory to write the status page to, instead of uploading it")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	c, err := readConfig(*configFlag)
+	if err != nil {
+		logger.Error("failed to load config", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	page := &statusPage{Generated: time.Now().UTC()}
+	var backends []ctlog.Backend
+	for _, lc := range c.Logs {
+		if *logFlag != "" && lc.ShortName != *logFlag {
+			continue
+		}
+		logger := logger.With("log", lc.ShortName)
+
+		b, err := ctlog.NewS3Backend(ctx, lc.S3Region, lc.S3Bucket, lc.S3Endpoint, lc.S3KeyPrefix, logger)
+		if err != nil {
+			logger.Error("failed to create backend", "err", err)
+			os.Exit(1)
+		}
+		backends = append(backends, b)
+		s, err := logStatus(ctx, &lc, b, logger)
+		if err != nil {
+			logger.Error("failed to load log configuration", "err", err)
+			os.Exit(1)
+		}
+		if s.Error != "" {
+			logger.Warn("failed to read checkpoint", "err", s.Error)
+		}
+		page.Logs = append(page.Logs, *s)
+	}
+	if len(page.Logs) == 0 {
+		logger.Error("log not found in config file", "log", *logFlag)
+		os.Exit(1)
+	}
+
+	j, err := json.MarshalIndent(page, "", "  ")
+	if err != nil {
+		logger.Error("failed to encode status.json", "err", err)
+		os.Exit(1)
+	}
+	h := &bytes.Buffer{}
+	if err := statusTemplate.Execute(h, page); err != nil {
+		logger.Error("failed to render status.html", "err", err)
+		os.Exit(1)
+	}
+
+	if *outFlag != "" {
+		for name, data := range map[string][]byte{"status.json": j, "status.html": h.Bytes()} {
+			if err := writeFileAtomic(filepath.Join(*outFlag, name), data); err != nil {
+				logger.Error("failed to write status page", "file", name, "err", err)
+				os.Exit(1)
+			}
+		}
+		return
+	}
+	for i, b := range backends {
+		logger := logger.With("log", page.Logs[i].Name)
+		if err := b.Upload(ctx, "status.json", j, &ctlog.UploadOptions{
+			ContentType: "application/json", Compress: true}); err != nil {
+			logger.Error("failed to upload status.json", "err", err)
+			os.Exit(1)
+		}
+		if err := b.Upload(ctx, "status.html", h.Bytes(), &ctlog.UploadOptions{
+			ContentType: "text/html; charset=utf-8", Compress: true}); err != nil {
+			logger.Error("failed to upload status.html", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("uploaded status page", "tree_size", page.Logs[i].TreeSize)
+	}
+}
+
+// logStatus returns the status of the log configured by lc. Errors reading the
+// checkpoint from b are reported in statusLog.Error, while configuration
+// errors are returned.
+func logStatus(ctx context.Context, lc *LogConfig, b ctlog.Backend, logger *slog.Logger) (*statusLog, error) {
+	s := &statusLog{
+		Name:          lc.Name,
+		Description:   lc.Description,
+		SubmissionURL: lc.SubmissionURL,
+		MonitoringURL: lc.MonitoringURL,
+		State:         lc.State,
+	}
+	var err error
+	if s.NotAfterStart, err = time.Parse(time.RFC3339, lc.NotAfterStart); err != nil {
+		return nil, fmt.Errorf("invalid NotAfterStart: %w", err)
+	}
+	if s.NotAfterLimit, err = time.Parse(time.RFC3339, lc.NotAfterLimit); err != nil {
+		return nil, fmt.Errorf("invalid NotAfterLimit: %w", err)
+	}
+	s.NotAfterStart, s.NotAfterLimit = s.NotAfterStart.UTC(), s.NotAfterLimit.UTC()
+
+	roots, _, err := loadRoots(ctx, lc.Roots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roots: %w", err)
+	}
+	for _, r := range roots.RawCertificates() {
+		h := sha256.Sum256(r.RawSubjectPublicKeyInfo)
+		if !slices.Contains(lc.DeniedRoots, hex.EncodeToString(h[:])) {
+			s.Roots++
+		}
+	}
+
+	// The public key is enough to verify the checkpoint, so avoid loading
+	// (and possibly decrypting) the private key if PublicKey is set.
+	var key crypto.PublicKey
+	if lc.PublicKey != "" {
+		if key, err = parsePublicKey(lc.PublicKey); err != nil {
+			return nil, fmt.Errorf("invalid PublicKey: %w", err)
+		}
+	} else {
+		signer, _, err := newSigner(ctx, lc, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load log key: %w", err)
+		}
+		key = signer.Public()
+	}
+	var timestamp uint64
+	v, err := sunlight.NewRFC6962Verifier(lc.Name, key, func(t uint64) { timestamp = t })
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := b.Fetch(ctx, "checkpoint")
+	if err != nil {
+		s.Error = fmt.Sprintf("failed to fetch checkpoint: %v", err)
+		return s, nil
+	}
+	n, err := note.Open(signed, note.VerifierList(v))
+	if err != nil {
+		s.Error = fmt.Sprintf("invalid checkpoint signature: %v", err)
+		return s, nil
+	}
+	cp, err := sunlight.ParseCheckpoint(n.Text)
+	if err != nil {
+		s.Error = fmt.Sprintf("couldn't parse checkpoint: %v", err)
+		return s, nil
+	}
+	if cp.Origin != lc.Name {
+		s.Error = fmt.Sprintf("checkpoint origin %q doesn't match log name", cp.Origin)
+		return s, nil
+	}
+	s.TreeSize, s.RootHash = cp.N, cp.Hash.String()
+	t := time.UnixMilli(int64(timestamp)).UTC()
+	s.CheckpointTime = &t
+	for _, sig := range n.UnverifiedSigs {
+		if !slices.Contains(s.Cosigners, sig.Name) {
+			s.Cosigners = append(s.Cosigners, sig.Name)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// mapBackend is a ctlog.Backend that serves a fixed set of objects.
+type mapBackend map[string][]byte
+
+func (b mapBackend) Upload(ctx context.Context, key string, data []byte, opts *ctlog.UploadOptions) error {
+	b[key] = data
+	return nil
+}
+
+func (b mapBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	data, ok := b[key]
+	if !ok {
+		return nil, fmt.Errorf("%q not found", key)
+	}
+	return data, nil
+}
+
+func (b mapBackend) Metrics() []prometheus.Collector { return nil }
+
+func TestLogStatus(t *testing.T) {
+	tl := newTestLog(t)
+	tl.add(t, false)
+	tl.add(t, true)
+	ctx := context.Background()
+	cp, err := tl.Checkpoint(ctx)
+	fatalIfErr(t, err)
+
+	dir := t.TempDir()
+	_, other, otherPEM := newTestCA(t, "Other Root")
+	roots := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tl.root}), otherPEM...)
+	fatalIfErr(t, os.WriteFile(filepath.Join(dir, "roots.pem"), roots, 0o644))
+	spki, err := x509.MarshalPKIXPublicKey(tl.Key.Public())
+	fatalIfErr(t, err)
+	lc := func() *LogConfig {
+		return &LogConfig{
+			Name:          tl.Name,
+			Description:   "Test log <2025h1>",
+			SubmissionURL: "https://example.com/submit/",
+			MonitoringURL: "https://example.com/monitor/",
+			State:         "usable",
+			NotAfterStart: "2025-01-01T00:00:00Z",
+			NotAfterLimit: "2025-07-01T00:00:00+02:00",
+			Roots:         filepath.Join(dir, "roots.pem"),
+			PublicKey:     base64.StdEncoding.EncodeToString(spki),
+		}
+	}
+
+	skey, _, err := note.GenerateKey(rand.Reader, "witness.example")
+	fatalIfErr(t, err)
+	witness, err := note.NewSigner(skey)
+	fatalIfErr(t, err)
+	b := mapBackend{"checkpoint": tl.signCheckpoint(t, cp.Tree, cp.Timestamp, witness)}
+
+	t.Run("Checkpoint", func(t *testing.T) {
+		s, err := logStatus(ctx, lc(), b, discardLogger())
+		fatalIfErr(t, err)
+		if s.Error != "" {
+			t.Fatalf("got error %q", s.Error)
+		}
+		if s.TreeSize != cp.N || s.RootHash != cp.Hash.String() {
+			t.Errorf("got tree %d %s, expected %d %s", s.TreeSize, s.RootHash, cp.N, cp.Hash)
+		}
+		if s.CheckpointTime == nil || !s.CheckpointTime.Equal(time.UnixMilli(cp.Timestamp)) {
+			t.Errorf("got checkpoint time %v, expected %v", s.CheckpointTime, time.UnixMilli(cp.Timestamp))
+		}
+		if !slices.Equal(s.Cosigners, []string{"witness.example"}) {
+			t.Errorf("got cosigners %q, expected the witness", s.Cosigners)
+		}
+		if s.Roots != 2 {
+			t.Errorf("got %d roots, expected 2", s.Roots)
+		}
+		if want := time.Date(2025, 6, 30, 22, 0, 0, 0, time.UTC); s.NotAfterLimit != want {
+			t.Errorf("got NotAfterLimit %v, expected %v", s.NotAfterLimit, want)
+		}
+	})
+
+	t.Run("DeniedRoots", func(t *testing.T) {
+		c := lc()
+		h := sha256.Sum256(other.RawSubjectPublicKeyInfo)
+		c.DeniedRoots = []string{hex.EncodeToString(h[:])}
+		s, err := logStatus(ctx, c, b, discardLogger())
+		fatalIfErr(t, err)
+		if s.Roots != 1 {
+			t.Errorf("got %d roots, expected only the one not denied", s.Roots)
+		}
+	})
+
+	for _, tc := range []struct {
+		name       string
+		checkpoint []byte
+		config     func(*LogConfig)
+		msg        string
+	}{
+		{"Missing", nil, nil, "failed to fetch checkpoint"},
+		{"WrongKey", b["checkpoint"], func(c *LogConfig) {
+			spki, err := x509.MarshalPKIXPublicKey(other.PublicKey)
+			fatalIfErr(t, err)
+			c.PublicKey = base64.StdEncoding.EncodeToString(spki)
+		}, "invalid checkpoint signature"},
+		{"WrongName", b["checkpoint"], func(c *LogConfig) { c.Name = "example.com/other" },
+			"invalid checkpoint signature"},
+		{"Tampered", bytes.Replace(b["checkpoint"], []byte(cp.Hash.String()),
+			[]byte(strings.Repeat("A", 43)+"="), 1), nil, "invalid checkpoint signature"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := lc()
+			if tc.config != nil {
+				tc.config(c)
+			}
+			b := mapBackend{}
+			if tc.checkpoint != nil {
+				b["checkpoint"] = tc.checkpoint
+			}
+			s, err := logStatus(ctx, c, b, discardLogger())
+			fatalIfErr(t, err)
+			if !strings.Contains(s.Error, tc.msg) {
+				t.Errorf("got error %q, expected %q", s.Error, tc.msg)
+			}
+			if s.TreeSize != 0 || s.CheckpointTime != nil {
+				t.Errorf("got a tree from an invalid checkpoint")
+			}
+			if s.Name != c.Name || s.Roots != 2 {
+				t.Errorf("configuration is missing from the status of a failing log")
+			}
+		})
+	}
+
+	t.Run("ConfigErrors", func(t *testing.T) {
+		for name, f := range map[string]func(*LogConfig){
+			"NotAfterStart": func(c *LogConfig) { c.NotAfterStart = "2025-01-01" },
+			"Roots":         func(c *LogConfig) { c.Roots = filepath.Join(dir, "missing.pem") },
+			"PublicKey":     func(c *LogConfig) { c.PublicKey = "AAAA" },
+		} {
+			c := lc()
+			f(c)
+			if _, err := logStatus(ctx, c, b, discardLogger()); err == nil {
+				t.Errorf("%s: accepted an invalid configuration", name)
+			}
+		}
+	})
+
+	t.Run("Render", func(t *testing.T) {
+		ok, err := logStatus(ctx, lc(), b, discardLogger())
+		fatalIfErr(t, err)
+		failing, err := logStatus(ctx, lc(), mapBackend{}, discardLogger())
+		fatalIfErr(t, err)
+		page := &statusPage{Generated: time.Now().UTC(), Logs: []statusLog{*ok, *failing}}
+
+		h := &bytes.Buffer{}
+		fatalIfErr(t, statusTemplate.Execute(h, page))
+		for _, want := range []string{
+			"Test log &lt;2025h1&gt;", fmt.Sprintf("<td>%d</td>", cp.N),
+			"<code>witness.example</code>", `class="error">failed to fetch checkpoint`,
+		} {
+			if !strings.Contains(h.String(), want) {
+				t.Errorf("status.html is missing %q", want)
+			}
+		}
+		if !strings.Contains(html.UnescapeString(h.String()), cp.Hash.String()) {
+			t.Errorf("status.html is missing the root hash")
+		}
+
+		j, err := json.Marshal(page)
+		fatalIfErr(t, err)
+		var got statusPage
+		fatalIfErr(t, json.Unmarshal(j, &got))
+		if len(got.Logs) != 2 || got.Logs[0].TreeSize != cp.N || got.Logs[1].Error == "" ||
+			got.Logs[1].CheckpointTime != nil {
+			t.Errorf("status.json doesn't round-trip: %s", j)
+		}
+	})
+}
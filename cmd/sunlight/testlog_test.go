@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"log/slog"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight"
+	"filippo.io/sunlight/internal/tlogx"
+	"filippo.io/sunlight/sunlighttest"
+	ct "github.com/google/certificate-transparency-go"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// testLog is a sunlighttest log, with a CA that issues the certificates
+// submitted to it.
+type testLog struct {
+	*sunlighttest.Log
+
+	root, intermediate []byte
+	ca                 *x509.Certificate
+	caKey, leafKey     *ecdsa.PrivateKey
+	serial             atomic.Int64
+}
+
+func newTestLog(t *testing.T) *testLog {
+	tl := &testLog{}
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	tl.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	tl.leafKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	tl.serial.Store(100)
+	ca := func(cn string, serial int64) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+	}
+	var root *x509.Certificate
+	tl.root, root = issueTestCert(t, ca("Test Root", 1), ca("Test Root", 1), &rootKey.PublicKey, rootKey)
+	tl.intermediate, tl.ca = issueTestCert(t, ca("Test Intermediate", 2), root, &tl.caKey.PublicKey, rootKey)
+
+	tl.Log = sunlighttest.NewLog(t, &sunlighttest.Config{
+		Roots:            []*x509.Certificate{root},
+		SequencingPeriod: 5 * time.Millisecond,
+	})
+	return tl
+}
+
+func issueTestCert(t *testing.T, tmpl, parent *x509.Certificate, pub, priv any) ([]byte, *x509.Certificate) {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+	fatalIfErr(t, err)
+	c, err := x509.ParseCertificate(der)
+	fatalIfErr(t, err)
+	return der, c
+}
+
+// issue returns a new leaf certificate, or precertificate, for names from the
+// intermediate of the log's hierarchy.
+func (tl *testLog) issue(t *testing.T, precert bool, names ...string) []byte {
+	if len(names) == 0 {
+		names = []string{"example.com"}
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(tl.serial.Add(1)),
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if precert {
+		tmpl.ExtraExtensions = []pkix.Extension{{
+			Id:       asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3},
+			Critical: true,
+			Value:    []byte{0x05, 0x00},
+		}}
+	}
+	der, _ := issueTestCert(t, tmpl, tl.ca, &tl.leafKey.PublicKey, tl.caKey)
+	return der
+}
+
+// chain returns the chain to submit for leaf.
+func (tl *testLog) chain(leaf []byte) [][]byte {
+	return [][]byte{leaf, tl.intermediate, tl.root}
+}
+
+// add submits a new certificate, or precertificate, for names and returns its
+// TLS-encoded SCT once it's logged.
+func (tl *testLog) add(t *testing.T, precert bool, names ...string) []byte {
+	t.Helper()
+	leaf := tl.issue(t, precert, names...)
+	var sct []byte
+	var err error
+	if precert {
+		sct, err = tl.AddPreChain(context.Background(), tl.chain(leaf))
+	} else {
+		sct, err = tl.AddChain(context.Background(), tl.chain(leaf))
+	}
+	fatalIfErr(t, err)
+	return sct
+}
+
+// signCheckpoint returns a checkpoint for tree with the given timestamp,
+// signed by the log key like the log would, and by each of extra.
+func (tl *testLog) signCheckpoint(t *testing.T, tree tlog.Tree, timestamp int64, extra ...note.Signer) []byte {
+	sth, err := ct.SerializeSTHSignatureInput(ct.SignedTreeHead{
+		Version:        ct.V1,
+		TreeSize:       uint64(tree.N),
+		Timestamp:      uint64(timestamp),
+		SHA256RootHash: ct.SHA256Hash(tree.Hash),
+	})
+	fatalIfErr(t, err)
+	digest := sha256.Sum256(sth)
+	sig, err := ecdsa.SignASN1(rand.Reader, tl.Key, digest[:])
+	fatalIfErr(t, err)
+	b := &cryptobyte.Builder{}
+	b.AddUint64(uint64(timestamp))
+	b.AddUint8(4 /* sha256 */)
+	b.AddUint8(3 /* ecdsa */)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(sig) })
+	noteSig, err := b.Bytes()
+	fatalIfErr(t, err)
+	logID := tl.LogID()
+	signer, err := tlogx.NewInjectedSigner(tl.Name, 0x05, logID[:], noteSig)
+	fatalIfErr(t, err)
+	signed, err := note.Sign(&note.Note{
+		Text: sunlight.FormatCheckpoint(sunlight.Checkpoint{Origin: tl.Name, Tree: tree}),
+	}, append([]note.Signer{signer}, extra...)...)
+	fatalIfErr(t, err)
+	return signed
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
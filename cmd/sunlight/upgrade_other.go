@@ -0,0 +1,24 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+)
+
+// Binary upgrades are only supported on Unix systems.
+
+func inheritedUpgrade() (net.Listener, *upgradeHandoff, error) {
+	return nil, nil, nil
+}
+
+type upgradeHandoff struct{}
+
+func (h *upgradeHandoff) Wait() error { return nil }
+
+func handleUpgrades(ctx context.Context, ln net.Listener, logger *slog.Logger, drain func()) <-chan *os.File {
+	return nil
+}
@@ -0,0 +1,169 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// A binary upgrade is started by sending SIGUSR2 to the running process, which
+// starts a new copy of the (possibly replaced) executable with the same
+// arguments, passing it the listening socket and two pipes.
+//
+// The new process parses its configuration and reports readiness on the first
+// pipe, but waits to load the logs until the old process closes the second
+// pipe. The old process meanwhile stops accepting connections, waits for
+// pending requests (which are still being sequenced) to complete, stops its
+// sequencers, and then closes the pipe and exits.
+//
+// Connections that arrive during the handoff wait in the shared socket's
+// accept queue, and only one process at a time ever runs the sequencers.
+
+// upgradeEnv is set in the environment of the new process to signal that it
+// should use the inherited file descriptors.
+const upgradeEnv = "SUNLIGHT_UPGRADE"
+
+// Inherited file descriptors, after stdin, stdout, and stderr.
+const (
+	upgradeListenerFd = 3
+	upgradeReadyFd    = 4
+	upgradeHandoffFd  = 5
+)
+
+// upgradeReadyTimeout is how long the old process waits for the new process to
+// become ready before giving up and continuing to serve.
+const upgradeReadyTimeout = 1 * time.Minute
+
+// inheritedUpgrade returns the listener and handoff handle passed by the old
+// process, if this process was started by a binary upgrade.
+func inheritedUpgrade() (net.Listener, *upgradeHandoff, error) {
+	if os.Getenv(upgradeEnv) == "" {
+		return nil, nil, nil
+	}
+	os.Unsetenv(upgradeEnv)
+	f := os.NewFile(upgradeListenerFd, "listener")
+	ln, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to use inherited listener: %w", err)
+	}
+	return ln, &upgradeHandoff{
+		ready:   os.NewFile(upgradeReadyFd, "ready"),
+		handoff: os.NewFile(upgradeHandoffFd, "handoff"),
+	}, nil
+}
+
+// upgradeHandoff is the new process side of a binary upgrade.
+type upgradeHandoff struct {
+	ready   *os.File
+	handoff *os.File
+}
+
+// Wait reports readiness to the old process, and then waits for it to stop
+// sequencing. If the old process died, Wait returns immediately after that.
+func (h *upgradeHandoff) Wait() error {
+	defer h.handoff.Close()
+	if _, err := h.ready.Write([]byte{1}); err != nil {
+		return fmt.Errorf("failed to report readiness: %w", err)
+	}
+	h.ready.Close()
+	if _, err := io.Copy(io.Discard, h.handoff); err != nil {
+		return fmt.Errorf("failed to wait for handoff: %w", err)
+	}
+	return nil
+}
+
+// handleUpgrades starts a new process on SIGUSR2. Once the new process is
+// ready, it calls drain, which is expected to stop the HTTP server and the
+// sequencers, and then returns the handoff pipe, which must be closed after the
+// sequencers returned.
+func handleUpgrades(ctx context.Context, ln net.Listener, logger *slog.Logger, drain func()) <-chan *os.File {
+	handoffCh := make(chan *os.File, 1)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c:
+			}
+			logger.Info("starting binary upgrade")
+			handoff, err := startUpgrade(ln)
+			if err != nil {
+				logger.Error("binary upgrade failed", "err", err)
+				continue
+			}
+			logger.Info("new process is ready, draining")
+			handoffCh <- handoff
+			drain()
+			return
+		}
+	}()
+	return handoffCh
+}
+
+func startUpgrade(ln net.Listener) (handoff *os.File, err error) {
+	fl, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("listener %T can't be passed to a new process", ln)
+	}
+	lnFile, err := fl.File()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get listener file: %w", err)
+	}
+	defer lnFile.Close()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer readyR.Close()
+	handoffR, handoffW, err := os.Pipe()
+	if err != nil {
+		readyW.Close()
+		return nil, err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		readyW.Close()
+		handoffR.Close()
+		handoffW.Close()
+		return nil, fmt.Errorf("failed to locate executable: %w", err)
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), upgradeEnv+"=1")
+	cmd.ExtraFiles = []*os.File{lnFile, readyW, handoffR}
+	err = cmd.Start()
+	readyW.Close()
+	handoffR.Close()
+	if err != nil {
+		handoffW.Close()
+		return nil, fmt.Errorf("failed to start new process: %w", err)
+	}
+	go cmd.Wait()
+
+	readyR.SetReadDeadline(time.Now().Add(upgradeReadyTimeout))
+	if _, err := io.ReadFull(readyR, make([]byte, 1)); err != nil {
+		handoffW.Close()
+		cmd.Process.Kill()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("new process exited before becoming ready")
+		}
+		return nil, fmt.Errorf("new process did not become ready: %w", err)
+	}
+	return handoffW, nil
+}
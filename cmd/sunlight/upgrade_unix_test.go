@@ -0,0 +1,118 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upgradeTestEnv selects the behavior of the test binary when it's started by
+// startUpgrade as the new process.
+const upgradeTestEnv = "SUNLIGHT_TEST_UPGRADE"
+
+// upgradeTestLogEnv is the path of a file where the new process and the test
+// append the steps of the handoff, to check their order.
+const upgradeTestLogEnv = "SUNLIGHT_TEST_UPGRADE_LOG"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(upgradeTestEnv); mode != "" && os.Getenv(upgradeEnv) != "" {
+		if err := upgradeChild(mode); err != nil {
+			fmt.Fprintln(os.Stderr, "upgrade child:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func upgradeChild(mode string) error {
+	if mode == "exit" {
+		return nil
+	}
+	ln, h, err := inheritedUpgrade()
+	if err != nil {
+		return err
+	}
+	appendUpgradeLog("started")
+	if err := h.Wait(); err != nil {
+		return err
+	}
+	appendUpgradeLog("handed off")
+	c, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	appendUpgradeLog("served")
+	_, err = c.Write([]byte("ok"))
+	return err
+}
+
+func appendUpgradeLog(step string) {
+	f, err := os.OpenFile(os.Getenv(upgradeTestLogEnv), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	fmt.Fprintln(f, step)
+}
+
+func readUpgradeLog(t *testing.T) string {
+	b, err := os.ReadFile(os.Getenv(upgradeTestLogEnv))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestUpgradeHandoff(t *testing.T) {
+	t.Setenv(upgradeTestEnv, "handoff")
+	t.Setenv(upgradeTestLogEnv, filepath.Join(t.TempDir(), "log"))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	fatalIfErr(t, err)
+	defer ln.Close()
+
+	handoff, err := startUpgrade(ln)
+	fatalIfErr(t, err)
+
+	// The new process is ready, but must not proceed until the handoff pipe
+	// is closed, which the old process does after its sequencers stopped.
+	time.Sleep(100 * time.Millisecond)
+	if got := readUpgradeLog(t); got != "started\n" {
+		t.Fatalf("new process proceeded before the handoff: %q", got)
+	}
+	appendUpgradeLog("closing handoff")
+	fatalIfErr(t, handoff.Close())
+
+	// The new process serves connections on the inherited listener.
+	c, err := net.Dial("tcp", ln.Addr().String())
+	fatalIfErr(t, err)
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	got, err := io.ReadAll(c)
+	fatalIfErr(t, err)
+	if string(got) != "ok" {
+		t.Errorf("got %q from the new process", got)
+	}
+	if got, want := readUpgradeLog(t), "started\nclosing handoff\nhanded off\nserved\n"; got != want {
+		t.Errorf("got handoff steps %q, expected %q", got, want)
+	}
+}
+
+func TestUpgradeChildExits(t *testing.T) {
+	t.Setenv(upgradeTestEnv, "exit")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	fatalIfErr(t, err)
+	defer ln.Close()
+
+	if _, err := startUpgrade(ln); err == nil || !strings.Contains(err.Error(), "exited before becoming ready") {
+		t.Errorf("got %v, expected the new process to exit before becoming ready", err)
+	}
+}
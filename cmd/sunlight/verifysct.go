@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"filippo.io/sunlight/client"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/x509"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// verifySCTResult is the output of "sunlight verify-sct" for each SCT.
+type verifySCTResult struct {
+	// Source is "embedded", "tls", or "flag", for SCTs from the certificate,
+	// from the TLS extension, or passed with -sct.
+	Source    string `json:"source"`
+	Timestamp int64  `json:"timestamp"`
+	LeafIndex int64  `json:"leaf_index"`
+	IsPrecert bool   `json:"is_precert"`
+	LeafHash  []byte `json:"leaf_hash,omitempty"`
+
+	// TreeSize, RootHash, and AuditPath are the inclusion proof, in the same
+	// format as the RFC 6962 get-proof-by-hash response, against Checkpoint.
+	TreeSize   int64    `json:"tree_size,omitempty"`
+	RootHash   []byte   `json:"root_hash,omitempty"`
+	AuditPath  [][]byte `json:"audit_path,omitempty"`
+	Checkpoint string   `json:"checkpoint,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// verifySCTCandidate is an SCT to verify, and the entries it might be for.
+type verifySCTCandidate struct {
+	source  string
+	sct     *client.SCT
+	entries []*client.Entry
+}
+
+// verifySCT implements the "sunlight verify-sct" command, which verifies the
+// SCTs issued by a log for a certificate, read from -cert or obtained from the
+// TLS server at -connect, locates their entries in the log's data tiles, and
+// prints their inclusion proofs as JSON.
+//
+// The SCTs are the ones embedded in the certificate, the ones sent by the TLS
+// server in the signed_certificate_timestamp extension, and the one passed with
+// -sct. SCTs from other logs are ignored. Verifying embedded SCTs, or SCTs for
+// precertificates, requires the issuer certificate, which can be in the same
+// PEM file as the certificate, in the TLS chain, or in -issuer.
+//
+// It exits with status 1 if no SCT from the log was found, or if any failed to
+// verify or isn't yet included in the log.
+func verifySCT(args []string) {
+	fs := flag.NewFlagSet("sunlight verify-sct", flag.ExitOnError)
+	certFlag := fs.String("cert", "", "path to the PEM certificate, optionally followed by its chain")
+	connectFlag := fs.String("connect", "", "host[:port] of a TLS server to fetch the certificate and SCTs from")
+	issuerFlag := fs.String("issuer", "", "path to the PEM issuer certificate, if not in -cert or the TLS chain")
+	sctFlag := fs.String("sct", "", "base64-encoded TLS SignedCertificateTimestamp to verify")
+	monitoringFlag := fs.String("monitoring", "", "monitoring URL prefix of the log (required)")
+	nameFlag := fs.String("name", "", "name of the log, the checkpoint origin (required)")
+	keyFlag := fs.String("key", "", "base64-encoded SubjectPublicKeyInfo of the log (required)")
+	fs.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if *monitoringFlag == "" || *nameFlag == "" || *keyFlag == "" {
+		logger.Error("-monitoring, -name, and -key are required")
+		os.Exit(1)
+	}
+	if (*certFlag == "") == (*connectFlag == "") {
+		logger.Error("exactly one of -cert and -connect is required")
+		os.Exit(1)
+	}
+	key, err := parsePublicKey(*keyFlag)
+	if err != nil {
+		logger.Error("invalid -key", "err", err)
+		os.Exit(1)
+	}
+	c, err := client.New(&client.Config{
+		MonitoringPrefix: *monitoringFlag,
+		Name:             *nameFlag,
+		PublicKey:        key,
+		UserAgent:        "filippo.io/sunlight verify-sct",
+	})
+	if err != nil {
+		logger.Error("failed to create client", "err", err)
+		os.Exit(1)
+	}
+	logID, err := c.LogID()
+	if err != nil {
+		logger.Error("invalid -key", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var chain []*x509.Certificate
+	var tlsSCTs [][]byte
+	if *certFlag != "" {
+		chain, err = readPEMCertificates(*certFlag)
+	} else {
+		chain, tlsSCTs, err = fetchTLSCertificates(ctx, *connectFlag)
+	}
+	if err != nil {
+		logger.Error("failed to load certificate", "err", err)
+		os.Exit(1)
+	}
+	if *issuerFlag != "" {
+		issuers, err := readPEMCertificates(*issuerFlag)
+		if err != nil {
+			logger.Error("failed to load issuer", "err", err)
+			os.Exit(1)
+		}
+		chain = append(chain[:1], issuers...)
+	}
+
+	x509Entry, precertEntry, err := verifySCTEntries(chain)
+	if err != nil {
+		logger.Error("failed to build log entries", "err", err)
+		os.Exit(1)
+	}
+	var entries []*client.Entry
+	for _, e := range []*client.Entry{x509Entry, precertEntry} {
+		if e != nil {
+			entries = append(entries, e)
+		}
+	}
+
+	var candidates []*verifySCTCandidate
+	add := func(source string, raw []byte, entries ...*client.Entry) {
+		sct, err := client.ParseSCT(raw)
+		if err != nil {
+			logger.Warn("skipping unparseable SCT", "source", source, "err", err)
+			return
+		}
+		if sct.LogID != logID {
+			logger.Debug("skipping SCT from another log", "source", source,
+				"log_id", base64.StdEncoding.EncodeToString(sct.LogID[:]))
+			return
+		}
+		candidates = append(candidates, &verifySCTCandidate{source, sct, entries})
+	}
+	if *sctFlag != "" {
+		raw, err := base64.StdEncoding.DecodeString(*sctFlag)
+		if err != nil {
+			logger.Error("invalid -sct", "err", err)
+			os.Exit(1)
+		}
+		add("flag", raw, entries...)
+	}
+	if len(chain[0].RawSCT) > 0 {
+		list, err := client.ParseSCTList(chain[0].RawSCT)
+		if err != nil {
+			logger.Warn("invalid embedded SCT list", "err", err)
+		}
+		for _, raw := range list {
+			if precertEntry == nil {
+				logger.Warn("can't verify embedded SCTs without the issuer certificate")
+				break
+			}
+			add("embedded", raw, precertEntry)
+		}
+	}
+	for _, raw := range tlsSCTs {
+		if x509Entry == nil {
+			break
+		}
+		add("tls", raw, x509Entry)
+	}
+	if len(candidates) == 0 {
+		logger.Error("no SCTs from the log found")
+		os.Exit(1)
+	}
+
+	cp, err := c.Checkpoint(ctx)
+	if err != nil {
+		logger.Error("failed to fetch checkpoint", "err", err)
+		os.Exit(1)
+	}
+	var failed bool
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	for _, cand := range candidates {
+		res := cand.verify(ctx, c, cp)
+		if res.Error != "" {
+			failed = true
+			logger.Error("SCT verification failed", "source", res.Source, "err", res.Error)
+		} else {
+			logger.Info("SCT verified and included in the log", "source", res.Source,
+				"leaf_index", res.LeafIndex, "tree_size", res.TreeSize)
+		}
+		if err := enc.Encode(res); err != nil {
+			logger.Error("failed to write result", "err", err)
+			os.Exit(1)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// verify verifies the SCT against each candidate entry, and returns the
+// inclusion proof for the first one it's valid for.
+func (cand *verifySCTCandidate) verify(ctx context.Context, c *client.Client, cp *client.Checkpoint) *verifySCTResult {
+	res := &verifySCTResult{Source: cand.source, Timestamp: cand.sct.Timestamp}
+	index, err := cand.sct.LeafIndex()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.LeafIndex = index
+	var e *client.Entry
+	for _, ce := range cand.entries {
+		if err = c.VerifySCT(cand.sct, ce); err == nil {
+			e = ce
+			break
+		}
+	}
+	if e == nil {
+		res.Error = fmt.Sprintf("SCT doesn't verify for the certificate: %v", err)
+		return res
+	}
+	res.IsPrecert = e.IsPrecert
+	logged, proof, err := c.SCTInclusionProof(ctx, cp.Tree, cand.sct, e)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	h := tlog.RecordHash(logged.MerkleTreeLeaf())
+	res.LeafHash = h[:]
+	res.TreeSize, res.RootHash = cp.N, cp.Hash[:]
+	for _, p := range proof {
+		res.AuditPath = append(res.AuditPath, p[:])
+	}
+	res.Checkpoint = string(cp.Signed)
+	return res
+}
+
+// verifySCTEntries returns the x509_entry and precert_entry that SCTs for
+// chain[0] might have been issued for. The precert_entry is nil if the issuer
+// is not in chain, and the x509_entry is nil if chain[0] is a precertificate.
+func verifySCTEntries(chain []*x509.Certificate) (x509Entry, precertEntry *client.Entry, err error) {
+	leaf := chain[0]
+	if !leaf.IsPrecertificate() {
+		x509Entry = &client.Entry{Certificate: leaf.Raw}
+	}
+	if len(chain) < 2 {
+		return x509Entry, nil, nil
+	}
+	issuer := chain[1]
+	var tbs []byte
+	switch {
+	case leaf.IsPrecertificate() && ct.IsPreIssuer(issuer):
+		// The precertificate was issued by a Precertificate Signing
+		// Certificate, so the entry is as if it was issued by its issuer.
+		if len(chain) < 3 {
+			return nil, nil, errors.New("issuer of the Precertificate Signing Certificate is missing")
+		}
+		tbs, err = x509.BuildPrecertTBS(leaf.RawTBSCertificate, issuer)
+		issuer = chain[2]
+	case leaf.IsPrecertificate():
+		tbs, err = x509.RemoveCTPoison(leaf.RawTBSCertificate)
+	default:
+		tbs, err = x509.RemoveSCTList(leaf.RawTBSCertificate)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build precertificate TBSCertificate: %w", err)
+	}
+	return x509Entry, &client.Entry{
+		Certificate:   tbs,
+		IsPrecert:     true,
+		IssuerKeyHash: sha256.Sum256(issuer.RawSubjectPublicKeyInfo),
+	}, nil
+}
+
+// readPEMCertificates reads all the certificates in a PEM file.
+func readPEMCertificates(path string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if x509.IsFatal(err) {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates in %q", path)
+	}
+	return certs, nil
+}
+
+// fetchTLSCertificates connects to a TLS server, and returns the certificate
+// chain and the SCTs it sent.
+func fetchTLSCertificates(ctx context.Context, addr string) ([]*x509.Certificate, [][]byte, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, addr = addr, net.JoinHostPort(addr, "443")
+	}
+	d := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 30 * time.Second},
+		Config: &tls.Config{
+			ServerName: host,
+			// Only the SCTs are checked, so an untrusted or expired
+			// certificate is not an error.
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	state := conn.(*tls.Conn).ConnectionState()
+	var chain []*x509.Certificate
+	for _, c := range state.PeerCertificates {
+		cert, err := x509.ParseCertificate(c.Raw)
+		if x509.IsFatal(err) {
+			return nil, nil, err
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, nil, errors.New("server sent no certificates")
+	}
+	return chain, state.SignedCertificateTimestamps, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/client"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// parseChain parses certs like verify-sct parses -cert.
+func parseChain(t *testing.T, certs ...[]byte) []*ctx509.Certificate {
+	var chain []*ctx509.Certificate
+	for _, der := range certs {
+		c, err := ctx509.ParseCertificate(der)
+		if ctx509.IsFatal(err) {
+			t.Fatal(err)
+		}
+		chain = append(chain, c)
+	}
+	return chain
+}
+
+// issueEmbedded returns a precertificate, and the matching certificate with
+// the SCT for the precertificate embedded in it.
+func (tl *testLog) issueEmbedded(t *testing.T) (precert, cert []byte) {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(tl.serial.Add(1)),
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		ExtraExtensions: []pkix.Extension{{
+			Id:       asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3},
+			Critical: true,
+			Value:    []byte{0x05, 0x00},
+		}},
+	}
+	precert, _ = issueTestCert(t, tmpl, tl.ca, &tl.leafKey.PublicKey, tl.caKey)
+	sct, err := tl.AddPreChain(context.Background(), tl.chain(precert))
+	fatalIfErr(t, err)
+
+	b := &cryptobyte.Builder{}
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(sct) })
+	})
+	list, err := b.Bytes()
+	fatalIfErr(t, err)
+	value, err := asn1.Marshal(list)
+	fatalIfErr(t, err)
+	tmpl.ExtraExtensions = []pkix.Extension{{
+		Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2},
+		Value: value,
+	}}
+	cert, _ = issueTestCert(t, tmpl, tl.ca, &tl.leafKey.PublicKey, tl.caKey)
+	return precert, cert
+}
+
+func TestVerifySCT(t *testing.T) {
+	tl := newTestLog(t)
+	ctx := context.Background()
+	tl.add(t, false)
+
+	leaf := tl.issue(t, false)
+	leafSCT, err := tl.AddChain(ctx, tl.chain(leaf))
+	fatalIfErr(t, err)
+	pre := tl.issue(t, true)
+	preSCT, err := tl.AddPreChain(ctx, tl.chain(pre))
+	fatalIfErr(t, err)
+	_, embedded := tl.issueEmbedded(t)
+	tl.add(t, false)
+
+	cp, err := tl.Checkpoint(ctx)
+	fatalIfErr(t, err)
+
+	entries := func(t *testing.T, chain ...[]byte) []*client.Entry {
+		x509Entry, precertEntry, err := verifySCTEntries(parseChain(t, chain...))
+		fatalIfErr(t, err)
+		var entries []*client.Entry
+		for _, e := range []*client.Entry{x509Entry, precertEntry} {
+			if e != nil {
+				entries = append(entries, e)
+			}
+		}
+		return entries
+	}
+	candidate := func(t *testing.T, source string, raw []byte, entries []*client.Entry) *verifySCTCandidate {
+		sct, err := client.ParseSCT(slices.Clone(raw))
+		fatalIfErr(t, err)
+		return &verifySCTCandidate{source, sct, entries}
+	}
+	checkVerified := func(t *testing.T, res *verifySCTResult, index int64, precert bool) {
+		t.Helper()
+		if res.Error != "" {
+			t.Fatalf("SCT didn't verify: %s", res.Error)
+		}
+		if res.LeafIndex != index || res.IsPrecert != precert {
+			t.Errorf("got leaf index %d and precert %v, expected %d and %v",
+				res.LeafIndex, res.IsPrecert, index, precert)
+		}
+		if res.TreeSize != cp.N || res.Checkpoint != string(cp.Signed) {
+			t.Errorf("proof is not against the latest checkpoint")
+		}
+		var proof tlog.RecordProof
+		for _, p := range res.AuditPath {
+			proof = append(proof, tlog.Hash(p))
+		}
+		err := tlog.CheckRecord(proof, res.TreeSize, tlog.Hash(res.RootHash), res.LeafIndex, tlog.Hash(res.LeafHash))
+		if err != nil {
+			t.Errorf("invalid inclusion proof: %v", err)
+		}
+	}
+	checkFailed := func(t *testing.T, res *verifySCTResult, msg string) {
+		t.Helper()
+		if !strings.Contains(res.Error, msg) {
+			t.Errorf("got error %q, expected %q", res.Error, msg)
+		}
+		if res.AuditPath != nil || res.Checkpoint != "" {
+			t.Errorf("got an inclusion proof for a failed SCT")
+		}
+	}
+
+	t.Run("Certificate", func(t *testing.T) {
+		res := candidate(t, "tls", leafSCT, entries(t, leaf)).verify(ctx, tl.Client, cp)
+		checkVerified(t, res, 1, false)
+	})
+
+	t.Run("Precertificate", func(t *testing.T) {
+		es := entries(t, pre, tl.intermediate)
+		if len(es) != 1 || !es[0].IsPrecert {
+			t.Fatalf("got %d entries for a precertificate, expected only a precert_entry", len(es))
+		}
+		res := candidate(t, "flag", preSCT, es).verify(ctx, tl.Client, cp)
+		checkVerified(t, res, 2, true)
+	})
+
+	t.Run("Embedded", func(t *testing.T) {
+		chain := parseChain(t, embedded, tl.intermediate)
+		list, err := client.ParseSCTList(chain[0].RawSCT)
+		fatalIfErr(t, err)
+		if len(list) != 1 {
+			t.Fatalf("got %d embedded SCTs, expected 1", len(list))
+		}
+		_, precertEntry, err := verifySCTEntries(chain)
+		fatalIfErr(t, err)
+		res := candidate(t, "embedded", list[0], []*client.Entry{precertEntry}).verify(ctx, tl.Client, cp)
+		checkVerified(t, res, 3, true)
+
+		// Without the issuer, there's no precert_entry to verify it against.
+		if _, precertEntry, _ := verifySCTEntries(chain[:1]); precertEntry != nil {
+			t.Errorf("got a precert_entry without the issuer")
+		}
+	})
+
+	t.Run("TamperedSignature", func(t *testing.T) {
+		c := candidate(t, "tls", leafSCT, entries(t, leaf))
+		c.sct.Signature[len(c.sct.Signature)-1] ^= 1
+		checkFailed(t, c.verify(ctx, tl.Client, cp), "invalid SCT signature")
+	})
+
+	t.Run("TamperedTimestamp", func(t *testing.T) {
+		c := candidate(t, "tls", leafSCT, entries(t, leaf))
+		c.sct.Timestamp++
+		checkFailed(t, c.verify(ctx, tl.Client, cp), "invalid SCT signature")
+	})
+
+	t.Run("WrongCertificate", func(t *testing.T) {
+		res := candidate(t, "tls", leafSCT, entries(t, tl.issue(t, false))).verify(ctx, tl.Client, cp)
+		checkFailed(t, res, "invalid SCT signature")
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		fatalIfErr(t, err)
+		c, err := client.New(&client.Config{
+			MonitoringPrefix: tl.URL,
+			Name:             tl.Name,
+			PublicKey:        k.Public(),
+			HTTPClient:       tl.Server.Client(),
+		})
+		fatalIfErr(t, err)
+		res := candidate(t, "tls", leafSCT, entries(t, leaf)).verify(ctx, c, cp)
+		checkFailed(t, res, "SCT is not from this log")
+	})
+
+	t.Run("NotIncluded", func(t *testing.T) {
+		old := &client.Checkpoint{Checkpoint: cp.Checkpoint}
+		old.N = 1
+		res := candidate(t, "tls", leafSCT, entries(t, leaf)).verify(ctx, tl.Client, old)
+		checkFailed(t, res, "not yet in tree of size 1")
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// defaultAlertRepeatInterval is how long repeated alerts for the same log and
+// event are suppressed, if Alerts.RepeatInterval is not set.
+const defaultAlertRepeatInterval = 1 * time.Hour
+
+type AlertsConfig struct {
+	// Webhooks are the endpoints notified of each alert. Optional.
+	Webhooks []struct {
+		// URL is the webhook URL, such as a Slack incoming webhook or
+		// https://events.pagerduty.com/v2/enqueue, or a secretref:// URI of
+		// a secret holding it.
+		URL string
+
+		// Format is the request body format, one of "slack" ({"text": ...},
+		// also accepted by Mattermost, Discord's /slack endpoints, and
+		// others), "pagerduty" (Events API v2), or "json" (the alert fields).
+		// Optional. Defaults to "slack".
+		Format string
+
+		// RoutingKey is the PagerDuty integration key, or a secretref://
+		// URI. Required for "pagerduty".
+		RoutingKey string
+	}
+
+	// RepeatInterval is how long further alerts for the same log and event
+	// are suppressed, as a Go duration string. Optional. Defaults to 1h.
+	RepeatInterval string
+}
+
+// webhookAlerter is a ctlog.Alerter that POSTs alerts to webhooks.
+type webhookAlerter struct {
+	hooks  []webhook
+	repeat time.Duration
+	logger *slog.Logger
+	client *http.Client
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+type webhook struct {
+	url, format, routingKey string
+}
+
+func newWebhookAlerter(c AlertsConfig, logger *slog.Logger) (*webhookAlerter, error) {
+	a := &webhookAlerter{
+		repeat: defaultAlertRepeatInterval,
+		logger: logger,
+		client: &http.Client{Timeout: 10 * time.Second},
+		last:   make(map[string]time.Time),
+	}
+	if c.RepeatInterval != "" {
+		d, err := time.ParseDuration(c.RepeatInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RepeatInterval: %w", err)
+		}
+		a.repeat = d
+	}
+	for _, h := range c.Webhooks {
+		hookURL, err := resolveSecret(h.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve webhook URL: %w", err)
+		}
+		routingKey, err := resolveSecret(h.RoutingKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve webhook RoutingKey: %w", err)
+		}
+		w := webhook{url: hookURL, format: h.Format, routingKey: routingKey}
+		if w.format == "" {
+			w.format = "slack"
+		}
+		switch {
+		case w.url == "":
+			return nil, fmt.Errorf("webhook URL is missing")
+		case w.format != "slack" && w.format != "pagerduty" && w.format != "json":
+			return nil, fmt.Errorf("unknown webhook format %q", w.format)
+		case w.format == "pagerduty" && w.routingKey == "":
+			return nil, fmt.Errorf("webhook %s: RoutingKey is required for pagerduty", w.url)
+		}
+		a.hooks = append(a.hooks, w)
+	}
+	return a, nil
+}
+
+func (a *webhookAlerter) Alert(ctx context.Context, alert ctlog.Alert) {
+	key := alert.Log + " " + string(alert.Event)
+	a.mu.Lock()
+	if t, ok := a.last[key]; ok && time.Since(t) < a.repeat {
+		a.mu.Unlock()
+		return
+	}
+	a.last[key] = time.Now()
+	a.mu.Unlock()
+
+	for _, h := range a.hooks {
+		go func() {
+			if err := a.send(h, alert); err != nil {
+				a.logger.Error("failed to send alert webhook", "event", alert.Event, "err", err)
+			}
+		}()
+	}
+}
+
+func (a *webhookAlerter) send(h webhook, alert ctlog.Alert) error {
+	summary := fmt.Sprintf("%s: %s", alert.Log, alert.Message)
+	var errString string
+	if alert.Err != nil {
+		errString = alert.Err.Error()
+		summary += ": " + errString
+	}
+	var body any
+	switch h.format {
+	case "slack":
+		body = map[string]string{"text": summary}
+	case "pagerduty":
+		body = map[string]any{
+			"routing_key":  h.routingKey,
+			"event_action": "trigger",
+			"dedup_key":    alert.Log + "/" + string(alert.Event),
+			"payload": map[string]any{
+				"summary":   summary,
+				"source":    alert.Log,
+				"severity":  "critical",
+				"component": "sunlight",
+				"class":     string(alert.Event),
+				"timestamp": alert.Time.UTC().Format(time.RFC3339),
+			},
+		}
+	case "json":
+		body = map[string]any{
+			"log":     alert.Log,
+			"event":   alert.Event,
+			"message": alert.Message,
+			"error":   errString,
+			"time":    alert.Time.UTC(),
+		}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Post(h.url, "application/json", bytes.NewReader(b))
+	if err, ok := err.(*url.Error); ok {
+		// Don't log the URL, which often embeds a secret.
+		return err.Err
+	} else if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"filippo.io/sunlight"
+	"filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// defaultWitnessInterval is how often checkpoints are submitted to witnesses.
+// Witnesses only need to see a checkpoint every so often to protect the
+// clients that rely on them from split views.
+const defaultWitnessInterval = 1 * time.Minute
+
+// witnessTimeout is the timeout of each checkpoint submission.
+const witnessTimeout = 30 * time.Second
+
+// WitnessConfig is a c2sp.org/tlog-witness witness checkpoints are submitted
+// to.
+type WitnessConfig struct {
+	// URL is the prefix of the witness API, to which "/add-checkpoint" is
+	// appended.
+	URL string
+
+	// PublicKey is the note verifier key of the witness, which must be
+	// configured to accept checkpoints from the log.
+	PublicKey string
+}
+
+// newWitness returns a client for the witness at url with the note verifier
+// key vkey.
+func newWitness(url, vkey string, hc *http.Client, userAgent string) (*client.Witness, error) {
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid witness key: %w", err)
+	}
+	return client.NewWitness(&client.WitnessConfig{
+		URL:        url,
+		Verifier:   v,
+		HTTPClient: hc,
+		UserAgent:  userAgent,
+	})
+}
+
+// parseWitnessFlag parses a -witness flag value, the witness URL and its note
+// verifier key separated by a space.
+func parseWitnessFlag(s string, hc *http.Client, userAgent string) (*client.Witness, error) {
+	url, vkey, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid -witness %q: expected URL and verifier key separated by a space", s)
+	}
+	return newWitness(url, strings.TrimSpace(vkey), hc, userAgent)
+}
+
+// runWitnesses submits the latest checkpoint of the log read by c to each of
+// the witnesses every interval, until ctx is canceled.
+func runWitnesses(ctx context.Context, c *client.Client, witnesses []*client.Witness, interval time.Duration, logger *slog.Logger) {
+	submitted := make(map[*client.Witness]int64)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		submitWitnesses(ctx, c, witnesses, submitted, logger)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// submitWitnesses submits the latest checkpoint of the log read by c to each
+// of the witnesses, unless one of the same size was already submitted, as
+// recorded in submitted.
+func submitWitnesses(ctx context.Context, c *client.Client, witnesses []*client.Witness, submitted map[*client.Witness]int64, logger *slog.Logger) {
+	cp, err := c.Checkpoint(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warn("failed to fetch checkpoint for witnesses", "err", err)
+		}
+		return
+	}
+	for _, w := range witnesses {
+		if n, ok := submitted[w]; ok && n == cp.N {
+			continue
+		}
+		wctx, cancel := context.WithTimeout(ctx, witnessTimeout)
+		_, err := w.Submit(wctx, c, cp)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warn("failed to submit checkpoint to witness", "witness", w.Name(),
+					"tree_size", cp.N, "err", err)
+			}
+			continue
+		}
+		submitted[w] = cp.N
+		logger.Debug("checkpoint cosigned by witness", "witness", w.Name(), "tree_size", cp.N)
+	}
+}
+
+// WitnessServerConfig configures Sunlight to act as a c2sp.org/tlog-witness
+// witness for other logs, cosigning their checkpoints after verifying that
+// each is consistent with the previous one. See [ctlog.Witness].
+type WitnessServerConfig struct {
+	// HTTPPrefix is the path prefix of the witness API, to which
+	// "/add-checkpoint" is appended. Optional. Defaults to "/witness".
+	HTTPPrefix string
+
+	// Key is the path to the note signer key of the witness, such as the
+	// witness key generated by sunlight keygen. It can be encrypted like the
+	// log Key, and decrypted with KeyIdentityFile or KeyPassphraseFile.
+	Key string
+
+	KeyIdentityFile   string
+	KeyPassphraseFile string
+
+	// Logs are the logs whose checkpoints are witnessed. The latest cosigned
+	// checkpoint of each is stored in the lock backend.
+	Logs []WitnessedLogConfig
+}
+
+// WitnessedLogConfig is a log whose checkpoints are cosigned by the witness.
+type WitnessedLogConfig struct {
+	// Origin is the checkpoint origin line of the log, such as its name.
+	Origin string
+
+	// PublicKey is the base64-encoded SubjectPublicKeyInfo of a CT log, whose
+	// checkpoints are signed according to c2sp.org/sunlight.
+	PublicKey string
+
+	// VerifierKey is the note verifier key of a log that is not a CT log,
+	// instead of PublicKey.
+	VerifierKey string
+}
+
+// newWitnessServer returns the witness described by wc, storing its state in
+// lock.
+func newWitnessServer(wc *WitnessServerConfig, lock ctlog.LockBackend, logger *slog.Logger) (*ctlog.Witness, error) {
+	if wc.Key == "" {
+		return nil, errors.New("Key is required")
+	}
+	signer, err := loadNoteSigner(wc.Key, wc.KeyIdentityFile, wc.KeyPassphraseFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load witness key: %w", err)
+	}
+	var logs []ctlog.WitnessedLog
+	for _, l := range wc.Logs {
+		var v note.Verifier
+		switch {
+		case l.PublicKey != "" && l.VerifierKey != "":
+			return nil, fmt.Errorf("log %q has both PublicKey and VerifierKey", l.Origin)
+		case l.PublicKey != "":
+			key, err := parsePublicKey(l.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PublicKey for log %q: %w", l.Origin, err)
+			}
+			if v, err = sunlight.NewRFC6962Verifier(l.Origin, key, nil); err != nil {
+				return nil, fmt.Errorf("invalid PublicKey for log %q: %w", l.Origin, err)
+			}
+		case l.VerifierKey != "":
+			if v, err = note.NewVerifier(l.VerifierKey); err != nil {
+				return nil, fmt.Errorf("invalid VerifierKey for log %q: %w", l.Origin, err)
+			}
+		default:
+			return nil, fmt.Errorf("log %q requires PublicKey or VerifierKey", l.Origin)
+		}
+		logs = append(logs, ctlog.WitnessedLog{Origin: l.Origin, Verifier: v})
+	}
+	return ctlog.NewWitness(&ctlog.WitnessConfig{
+		Signer: signer,
+		Logs:   logs,
+		Lock:   lock,
+		Log:    logger,
+	})
+}
@@ -0,0 +1,254 @@
+// Package ctlog runs a Sunlight Certificate Transparency log in-process.
+//
+// It's meant for programs that need a fully functional log without running
+// the sunlight command, such as CA test harnesses, integration test suites,
+// and research tools. A [Log] serves the RFC 6962 submission API and the
+// c2sp.org/static-ct-api monitoring API from its [Log.Handler], and stores its
+// tiles in a [Backend], by default in memory.
+//
+// Backend, LockBackend, and the other storage types are aliases of the ones
+// used by the sunlight command, and change with it, so this package doesn't
+// have a stable API yet. Production logs should use the sunlight command,
+// which offers many more options.
+package ctlog
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+// Backend is a strongly consistent object storage for the tiles, checkpoint,
+// and issuers of a single log. See [MemoryBackend].
+type Backend = ctlog.Backend
+
+// UploadOptions are the options of [Backend.Upload].
+type UploadOptions = ctlog.UploadOptions
+
+// LockBackend stores the latest checkpoint of each log with compare-and-swap
+// semantics, to protect against two instances extending the same log. See
+// [MemoryLockBackend].
+type LockBackend = ctlog.LockBackend
+
+// LockedCheckpoint is a checkpoint stored in a [LockBackend].
+type LockedCheckpoint = ctlog.LockedCheckpoint
+
+// LogEntry is the contents of a log entry, a certificate or precertificate.
+type LogEntry = ctlog.LogEntry
+
+// SequencedEntry is a [LogEntry] with its position in the log and timestamp.
+type SequencedEntry = ctlog.SequencedLogEntry
+
+// Config is the configuration of a [Log].
+type Config struct {
+	// Name is the name of the log, which is also the origin line of its
+	// checkpoints, such as "example.com/2025h1".
+	Name string
+
+	// Key is the log signing key, which must be an ECDSA P-256 key.
+	Key crypto.Signer
+
+	// Roots are the accepted roots. Submitted chains must chain up to one of
+	// them.
+	Roots []*x509.Certificate
+
+	// NotAfterStart and NotAfterLimit bound the NotAfter of the accepted
+	// certificates, as in a temporal shard. Optional. The zero values mean no
+	// lower and no upper bound, respectively.
+	NotAfterStart time.Time
+	NotAfterLimit time.Time
+
+	// Backend stores the tiles, checkpoint, and issuers. Optional. Defaults
+	// to a new [MemoryBackend].
+	Backend Backend
+
+	// Lock stores the latest checkpoint. Optional. Defaults to a new
+	// [MemoryLockBackend].
+	//
+	// To reopen an existing log, both Backend and Lock must be the ones it
+	// was created with.
+	Lock LockBackend
+
+	// Cache is the path of the SQLite deduplication cache, which returns the
+	// existing SCT for resubmitted certificates. Optional. Defaults to a file
+	// in a temporary directory, which Close removes.
+	Cache string
+
+	// PoolSize is the maximum number of submissions waiting to be sequenced.
+	// Further submissions are rejected with a 503. Optional. Defaults to no
+	// limit.
+	PoolSize int
+
+	// SequencingPeriod is how often pending submissions are sequenced.
+	// Submissions return after the next sequencing round. Optional. Defaults
+	// to 1s. Tests can use a shorter period to run faster.
+	SequencingPeriod time.Duration
+
+	// Logger is where the log events are written. Optional. By default, they
+	// are discarded.
+	Logger *slog.Logger
+}
+
+// Log is a Certificate Transparency log running in-process.
+type Log struct {
+	l      *ctlog.Log
+	period time.Duration
+	logger *slog.Logger
+	tmpDir string
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	cancel  context.CancelFunc
+	done    chan error
+}
+
+// NewLog returns a Log for config. If the lock backend doesn't have a
+// checkpoint for the log yet, a new empty log is created. Otherwise, the
+// existing log is loaded.
+//
+// The log doesn't sequence submissions until [Log.Start] is called.
+func NewLog(ctx context.Context, config *Config) (_ *Log, err error) {
+	if config.Name == "" {
+		return nil, errors.New("ctlog: Config.Name is required")
+	}
+	if config.Key == nil {
+		return nil, errors.New("ctlog: Config.Key is required")
+	}
+	l := &Log{period: config.SequencingPeriod, logger: config.Logger}
+	if l.period <= 0 {
+		l.period = 1 * time.Second
+	}
+	if l.logger == nil {
+		l.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	c := &ctlog.Config{
+		Name:          config.Name,
+		Key:           config.Key,
+		PoolSize:      config.PoolSize,
+		Cache:         config.Cache,
+		Backend:       config.Backend,
+		Lock:          config.Lock,
+		Log:           l.logger,
+		Roots:         x509util.NewPEMCertPool(),
+		NotAfterStart: config.NotAfterStart,
+		NotAfterLimit: config.NotAfterLimit,
+		MonitoringAPI: true,
+	}
+	if c.NotAfterLimit.IsZero() {
+		c.NotAfterLimit = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+	}
+	for _, root := range config.Roots {
+		cert, err := ctx509.ParseCertificate(root.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("ctlog: couldn't parse root %q: %w", root.Subject, err)
+		}
+		c.Roots.AddCert(cert)
+	}
+	if c.Backend == nil {
+		c.Backend = NewMemoryBackend()
+	}
+	if c.Lock == nil {
+		c.Lock = NewMemoryLockBackend()
+	}
+	if c.Cache == "" {
+		l.tmpDir, err = os.MkdirTemp("", "sunlight-")
+		if err != nil {
+			return nil, fmt.Errorf("ctlog: couldn't create cache directory: %w", err)
+		}
+		defer func() {
+			if err != nil {
+				os.RemoveAll(l.tmpDir)
+			}
+		}()
+		c.Cache = filepath.Join(l.tmpDir, "cache.db")
+	}
+
+	if err := ctlog.CreateLog(ctx, c); err != nil && !errors.Is(err, ctlog.ErrLogExists) {
+		return nil, fmt.Errorf("ctlog: couldn't create log: %w", err)
+	}
+	l.l, err = ctlog.LoadLog(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("ctlog: couldn't load log: %w", err)
+	}
+	return l, nil
+}
+
+// Start starts sequencing submissions in the background, until Close is
+// called. It can only be called once.
+func (l *Log) Start() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errors.New("ctlog: log is closed")
+	}
+	if l.started {
+		return errors.New("ctlog: log is already started")
+	}
+	l.started = true
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.done = make(chan error, 1)
+	go func() {
+		l.done <- l.l.RunSequencer(ctx, l.period)
+	}()
+	return nil
+}
+
+// Handler returns the HTTP handler of the submission and monitoring APIs,
+// such as /ct/v1/add-chain and /checkpoint. It's meant to be served at the
+// root of the submission and monitoring prefixes, which are the same.
+func (l *Log) Handler() http.Handler {
+	return l.l.Handler()
+}
+
+// Subscribe returns a channel that receives the entries sequenced from now
+// on, in order, as soon as the checkpoint that includes them is published.
+//
+// The channel is closed when ctx is canceled, or if the receiver falls more
+// than 65536 entries behind, in which case the missed entries can be read
+// from the data tiles served by Handler.
+func (l *Log) Subscribe(ctx context.Context) <-chan SequencedEntry {
+	return l.l.Subscribe(ctx)
+}
+
+// Close stops the sequencer, and releases the deduplication cache. Pending
+// submissions fail. Close returns an error if the sequencer had stopped
+// because of a fatal error, such as a conflicting write to the lock backend.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	var errs []error
+	if l.started {
+		l.cancel()
+		if err := <-l.done; err != nil && !errors.Is(err, context.Canceled) {
+			errs = append(errs, fmt.Errorf("ctlog: sequencer failed: %w", err))
+		}
+	}
+	if err := l.l.CloseCache(); err != nil {
+		errs = append(errs, fmt.Errorf("ctlog: couldn't close cache: %w", err))
+	}
+	if l.tmpDir != "" {
+		if err := os.RemoveAll(l.tmpDir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
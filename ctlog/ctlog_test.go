@@ -0,0 +1,144 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight"
+	"filippo.io/sunlight/ctlog"
+)
+
+func TestReopen(t *testing.T) {
+	root, issue := newHierarchy(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ctlog.Config{
+		Name:             "example.com/ctlogtest",
+		Key:              key,
+		Roots:            []*x509.Certificate{root},
+		Backend:          ctlog.NewMemoryBackend(),
+		Lock:             ctlog.NewMemoryLockBackend(),
+		SequencingPeriod: 10 * time.Millisecond,
+	}
+
+	start := func() *ctlog.Log {
+		l, err := ctlog.NewLog(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	submit := func(l *ctlog.Log, chain ...[]byte) {
+		body, err := json.Marshal(map[string][][]byte{"chain": chain})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		l.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("add-chain: got status %d: %s", rr.Code, rr.Body)
+		}
+	}
+	checkpoint := func(l *ctlog.Log) sunlight.Checkpoint {
+		rr := httptest.NewRecorder()
+		l.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/checkpoint", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("checkpoint: got status %d: %s", rr.Code, rr.Body)
+		}
+		text, _, ok := strings.Cut(rr.Body.String(), "\n\n")
+		if !ok {
+			t.Fatalf("malformed checkpoint %q", rr.Body)
+		}
+		c, err := sunlight.ParseCheckpoint(text + "\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Origin != config.Name {
+			t.Errorf("got origin %q, expected %q", c.Origin, config.Name)
+		}
+		return c
+	}
+
+	l := start()
+	submit(l, issue(1))
+	c1 := checkpoint(l)
+	if c1.N != 1 {
+		t.Errorf("got tree size %d, expected 1", c1.N)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l = start()
+	defer func() {
+		if err := l.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	if c := checkpoint(l); c.Tree != c1.Tree {
+		t.Errorf("reopened log has tree %v, expected %v", c.Tree, c1.Tree)
+	}
+	submit(l, issue(2))
+	if c := checkpoint(l); c.N != 2 {
+		t.Errorf("got tree size %d, expected 2", c.N)
+	}
+}
+
+// newHierarchy returns a root, and a function that issues a leaf directly
+// from it with the given serial number, returning it in DER.
+func newHierarchy(t *testing.T) (*x509.Certificate, func(serial int64) []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, func(serial int64) []byte {
+		leaf := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			DNSNames:     []string{"example.com"},
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     now.Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, leaf, root, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+}
@@ -0,0 +1,114 @@
+package ctlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MemoryBackend is a [Backend] that keeps the objects in memory.
+type MemoryBackend struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+// NewMemoryBackend returns an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{m: make(map[string][]byte)}
+}
+
+func (b *MemoryBackend) Upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.m[key] = bytes.Clone(data)
+	return nil
+}
+
+func (b *MemoryBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.m[key]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found", key)
+	}
+	return bytes.Clone(data), nil
+}
+
+func (b *MemoryBackend) Metrics() []prometheus.Collector { return nil }
+
+// MemoryLockBackend is a [LockBackend] that keeps the checkpoints in memory.
+// It can be shared by multiple logs.
+type MemoryLockBackend struct {
+	mu sync.Mutex
+	m  map[[sha256.Size]byte][]byte
+}
+
+// NewMemoryLockBackend returns an empty MemoryLockBackend.
+func NewMemoryLockBackend() *MemoryLockBackend {
+	return &MemoryLockBackend{m: make(map[[sha256.Size]byte][]byte)}
+}
+
+type memoryLockCheckpoint struct {
+	logID [sha256.Size]byte
+	data  []byte
+}
+
+func (c *memoryLockCheckpoint) Bytes() []byte {
+	return c.data
+}
+
+func (b *MemoryLockBackend) Fetch(ctx context.Context, logID [sha256.Size]byte) (LockedCheckpoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.m[logID]
+	if !ok {
+		return nil, fmt.Errorf("log %x not found", logID)
+	}
+	return &memoryLockCheckpoint{logID: logID, data: data}, nil
+}
+
+func (b *MemoryLockBackend) Create(ctx context.Context, logID [sha256.Size]byte, new []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.m[logID]; ok {
+		return fmt.Errorf("log %x already exists", logID)
+	}
+	b.m[logID] = bytes.Clone(new)
+	return nil
+}
+
+func (b *MemoryLockBackend) Replace(ctx context.Context, old LockedCheckpoint, new []byte) (LockedCheckpoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	o, ok := old.(*memoryLockCheckpoint)
+	if !ok {
+		return nil, fmt.Errorf("checkpoint of type %T was not fetched from a MemoryLockBackend", old)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if current, ok := b.m[o.logID]; !ok {
+		return nil, fmt.Errorf("log %x not found", o.logID)
+	} else if !bytes.Equal(current, o.data) {
+		return nil, fmt.Errorf("log %x has changed", o.logID)
+	}
+	new = bytes.Clone(new)
+	b.m[o.logID] = new
+	return &memoryLockCheckpoint{logID: o.logID, data: new}, nil
+}
@@ -0,0 +1,72 @@
+package ctlog
+
+import (
+	"context"
+	"time"
+)
+
+// Alerter is notified of operational events that likely need the attention
+// of the log operator, for example to deliver them to a chat or paging
+// service. Implementations must not block, and are expected to deduplicate
+// repeated alerts for the same event.
+type Alerter interface {
+	Alert(ctx context.Context, a Alert)
+}
+
+// Alert is an operational event reported to Config.Alerter.
+type Alert struct {
+	// Log is the log Name.
+	Log   string
+	Event AlertEvent
+	// Message is a short human-readable description of the event.
+	Message string
+	// Err is the underlying error, if any.
+	Err error
+	// Time is when the event was detected.
+	Time time.Time
+}
+
+// AlertEvent identifies the kind of an Alert.
+type AlertEvent string
+
+const (
+	// AlertSequencingFailures is reported when alertSequencingFailures
+	// consecutive sequencing rounds fail.
+	AlertSequencingFailures AlertEvent = "sequencing_failures"
+	// AlertSequencerStopped is reported when the sequencer stops due to a
+	// fatal error, such as losing the checkpoint lock.
+	AlertSequencerStopped AlertEvent = "sequencer_stopped"
+	// AlertMMDRisk is reported when no checkpoint was published for more than
+	// half the Maximum Merge Delay.
+	AlertMMDRisk AlertEvent = "mmd_risk"
+	// AlertSignerFailure is reported when a signer health check fails.
+	AlertSignerFailure AlertEvent = "signer_failure"
+	// AlertRootsReload is reported when the roots can't be reloaded or synced.
+	AlertRootsReload AlertEvent = "roots_reload"
+)
+
+// alertSequencingFailures is the number of consecutive failed sequencing
+// rounds after which AlertSequencingFailures is reported.
+const alertSequencingFailures = 10
+
+// Alert reports an event to Config.Alerter, if set.
+func (l *Log) Alert(ctx context.Context, event AlertEvent, message string, err error) {
+	if l.c.Alerter == nil {
+		return
+	}
+	l.c.Alerter.Alert(ctx, Alert{
+		Log:     l.c.Name,
+		Event:   event,
+		Message: message,
+		Err:     err,
+		Time:    time.UnixMilli(l.c.clock().NowUnixMilli()),
+	})
+}
+
+// mmd returns Config.MMD, or its default.
+func (l *Log) mmd() time.Duration {
+	if l.c.MMD == 0 {
+		return 24 * time.Hour
+	}
+	return l.c.MMD
+}
@@ -0,0 +1,100 @@
+package ctlog_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+type recordingAlerter struct {
+	mu     sync.Mutex
+	alerts []ctlog.Alert
+}
+
+func (a *recordingAlerter) Alert(ctx context.Context, alert ctlog.Alert) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.alerts = append(a.alerts, alert)
+}
+
+func (a *recordingAlerter) count(event ctlog.AlertEvent) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var n int
+	for _, alert := range a.alerts {
+		if alert.Event == event {
+			n++
+		}
+	}
+	return n
+}
+
+// failingBackend is a MemoryBackend whose uploads fail while fail is set.
+type failingBackend struct {
+	*MemoryBackend
+	fail atomic.Bool
+}
+
+func (b *failingBackend) Upload(ctx context.Context, key string, data []byte, opts *ctlog.UploadOptions) error {
+	if b.fail.Load() {
+		return errors.New("upload failed")
+	}
+	return b.MemoryBackend.Upload(ctx, key, data, opts)
+}
+
+func TestAlerts(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	a := &recordingAlerter{}
+	tl.Config.Alerter = a
+	b := &failingBackend{MemoryBackend: tl.Config.Backend.(*MemoryBackend)}
+	tl.Config.Backend = b
+
+	b.fail.Store(true)
+	for i := 0; i < 15; i++ {
+		fatalIfErr(t, tl.Log.Sequence())
+	}
+	if n := a.count(ctlog.AlertSequencingFailures); n != 1 {
+		t.Errorf("got %d sequencing failure alerts, expected 1", n)
+	}
+	if n := a.count(ctlog.AlertMMDRisk); n != 0 {
+		t.Errorf("got %d MMD risk alerts, expected 0", n)
+	}
+
+	tl.Config.MMD = time.Millisecond
+	time.Sleep(time.Millisecond)
+	fatalIfErr(t, tl.Log.Sequence())
+	fatalIfErr(t, tl.Log.Sequence())
+	if n := a.count(ctlog.AlertMMDRisk); n != 1 {
+		t.Errorf("got %d MMD risk alerts, expected 1", n)
+	}
+	tl.Config.MMD = 0
+
+	b.fail.Store(false)
+	fatalIfErr(t, tl.Log.Sequence())
+	b.fail.Store(true)
+	for i := 0; i < 10; i++ {
+		fatalIfErr(t, tl.Log.Sequence())
+	}
+	if n := a.count(ctlog.AlertSequencingFailures); n != 2 {
+		t.Errorf("got %d sequencing failure alerts after recovery, expected 2", n)
+	}
+	b.fail.Store(false)
+
+	tl.Config.Key = failingSigner{tl.Config.Key}
+	if err := tl.Log.CheckSigner(0); err == nil {
+		t.Error("expected failing signer to fail the check")
+	}
+	if n := a.count(ctlog.AlertSignerFailure); n != 1 {
+		t.Errorf("got %d signer failure alerts, expected 1", n)
+	}
+	for _, alert := range a.alerts {
+		if alert.Log != tl.Config.Name || alert.Err == nil {
+			t.Errorf("unexpected alert: %+v", alert)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+)
+
+func TestSubmitWeakAlgorithms(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+	submit := func() string {
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, expected 400", rr.Code)
+		}
+		return rr.Body.String()
+	}
+
+	// testIntermediate has a 2048-bit RSA key.
+	tl.Config.MinRSAKeySize = 3072
+	if err := submit(); !strings.Contains(err, "weak RSA key") {
+		t.Errorf("got error %q, expected weak RSA key", err)
+	}
+	tl.Config.MinRSAKeySize = 2048
+
+	tl.Config.RejectSignatureAlgorithms = []ctx509.SignatureAlgorithm{ctx509.SHA256WithRSA}
+	if err := submit(); !strings.Contains(err, "rejected signature algorithm") {
+		t.Errorf("got error %q, expected rejected signature algorithm", err)
+	}
+	tl.Config.RejectSignatureAlgorithms = nil
+
+	tl.Config.RejectSHA1 = true
+	_, err = tl.LogClient().AddChain(context.Background(), []ct.ASN1Cert{
+		{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+	fatalIfErr(t, err)
+}
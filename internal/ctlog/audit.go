@@ -0,0 +1,127 @@
+package ctlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAuditRecords is the maximum number of audit records held in memory, for
+// example while the backend is unreachable. Further records are dropped and
+// counted in the audit_dropped_records_total metric.
+const maxAuditRecords = 1 << 20
+
+var optsAudit = &UploadOptions{ContentType: "application/x-ndjson", Compress: true, Immutable: true,
+	Class: ObjectClassAudit}
+
+// auditRecord is a line of the submission audit log.
+type auditRecord struct {
+	// Time is the SCT timestamp, in milliseconds since the epoch.
+	Time      int64  `json:"time"`
+	LeafIndex int64  `json:"leaf_index"`
+	LeafHash  []byte `json:"leaf_hash"`
+	Precert   bool   `json:"precert"`
+	Issuer    string `json:"issuer"`
+	ClientIP  string `json:"client_ip"`
+	// SCT is the add-[pre-]chain response, which includes the signature.
+	SCT json.RawMessage `json:"sct"`
+}
+
+type auditBuffer struct {
+	mu      sync.Mutex
+	records []auditRecord
+}
+
+func (l *Log) audit(r auditRecord) {
+	if !l.c.Audit {
+		return
+	}
+	l.auditBuf.mu.Lock()
+	defer l.auditBuf.mu.Unlock()
+	if len(l.auditBuf.records) >= maxAuditRecords {
+		l.m.AuditDropped.Inc()
+		return
+	}
+	l.auditBuf.records = append(l.auditBuf.records, r)
+}
+
+// RunAuditLog uploads the audit records of accepted submissions every
+// interval, if Config.Audit is set, until ctx is canceled. It then uploads any
+// remaining records before returning.
+//
+// Each batch is uploaded as a new JSON Lines object named
+// audit/YYYY-MM-DD/<timestamp>.jsonl, by upload time, so existing objects are
+// never modified. If an upload fails, its records are retried with the next
+// batch.
+func (l *Log) RunAuditLog(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), sequenceTimeout)
+			defer cancel()
+			if err := l.flushAudit(ctx); err != nil {
+				l.c.Log.ErrorContext(ctx, "final audit log upload failed", "err", err)
+			}
+			return
+		case <-t.C:
+			if err := l.flushAudit(ctx); err != nil {
+				l.c.Log.ErrorContext(ctx, "audit log upload failed", "err", err)
+			}
+		}
+	}
+}
+
+func (l *Log) flushAudit(ctx context.Context) error {
+	l.auditBuf.mu.Lock()
+	records := l.auditBuf.records
+	l.auditBuf.records = nil
+	l.auditBuf.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return fmtErrorf("failed to encode audit record: %w", err)
+		}
+	}
+	now := time.UnixMilli(l.c.clock().NowUnixMilli()).UTC()
+	name := fmt.Sprintf("audit/%s/%s.jsonl", now.Format(time.DateOnly), now.Format("20060102T150405.000Z"))
+	if err := l.upload(ctx, name, buf.Bytes(), optsAudit); err != nil {
+		// Put the records back in front of any new ones, to retry them.
+		l.auditBuf.mu.Lock()
+		l.auditBuf.records = append(records, l.auditBuf.records...)
+		l.auditBuf.mu.Unlock()
+		return fmtErrorf("failed to upload audit log: %w", err)
+	}
+	l.m.AuditRecords.Add(float64(len(records)))
+	return nil
+}
+
+// clientIP returns the IP address of the client that sent r, from the
+// Config.ClientIPHeader header if set and present, or from the connection.
+func (l *Log) clientIP(r *http.Request) string {
+	if l.c.ClientIPHeader != "" {
+		if v := r.Header.Get(l.c.ClientIPHeader); v != "" {
+			// X-Forwarded-For can be a list, where the first entry is the
+			// original client.
+			ip, _, _ := strings.Cut(v, ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,59 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.Audit = true
+	tl.Config.ClientIPHeader = "X-Forwarded-For"
+	tl.StartSequencer()
+
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+	req := httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body))
+	req.Header.Set("X-Forwarded-For", "192.0.2.1, 10.0.0.1")
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, expected 200: %s", rr.Code, rr.Body)
+	}
+
+	// RunAuditLog uploads pending records when the context is canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tl.Log.RunAuditLog(ctx, time.Hour)
+
+	b := tl.Config.Backend.(*MemoryBackend)
+	b.mu.Lock()
+	var records []string
+	for key, data := range b.m {
+		if strings.HasPrefix(key, "audit/") {
+			records = append(records, strings.Split(strings.TrimSpace(string(data)), "\n")...)
+		}
+	}
+	b.mu.Unlock()
+	if len(records) != 1 {
+		t.Fatalf("got %d audit records, expected 1", len(records))
+	}
+	var record struct {
+		LeafIndex int64           `json:"leaf_index"`
+		ClientIP  string          `json:"client_ip"`
+		SCT       json.RawMessage `json:"sct"`
+	}
+	fatalIfErr(t, json.Unmarshal([]byte(records[0]), &record))
+	if record.LeafIndex != 0 || record.ClientIP != "192.0.2.1" {
+		t.Errorf("unexpected audit record: %s", records[0])
+	}
+	if !bytes.Equal(record.SCT, rr.Body.Bytes()) {
+		t.Errorf("audit record SCT doesn't match the response")
+	}
+}
@@ -0,0 +1,159 @@
+package ctlog
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const azureKeyVaultAPIVersion = "7.4"
+
+// AzureKeyVaultSigner is a [crypto.Signer] backed by an Azure Key Vault (or
+// Managed HSM) EC P-256 key, so that the log private key never leaves the
+// vault.
+//
+// Like [KMSSigner], its signatures are not deterministic.
+type AzureKeyVaultSigner struct {
+	cred     azcore.TokenCredential
+	scope    string
+	keyID    string
+	pub      *ecdsa.PublicKey
+	duration *prometheus.SummaryVec
+	log      *slog.Logger
+}
+
+// NewAzureKeyVaultSigner fetches the public key of the Key Vault key keyID, of
+// the form https://VAULT.vault.azure.net/keys/NAME/VERSION, and checks that it
+// can be used to sign by producing and verifying a test signature.
+//
+// The version is required, so that a key rotation doesn't change the log
+// key. Credentials are obtained with azidentity.DefaultAzureCredential.
+func NewAzureKeyVaultSigner(ctx context.Context, keyID string, l *slog.Logger) (*AzureKeyVaultSigner, error) {
+	duration := newSignDurationMetric("azurekv_sign_duration_seconds",
+		"Azure Key Vault sign request latencies, by error.")
+
+	u, err := url.Parse(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Key Vault key ID: %w", err)
+	}
+	if u.Scheme != "https" || len(strings.Split(strings.Trim(u.Path, "/"), "/")) != 3 ||
+		!strings.HasPrefix(u.Path, "/keys/") {
+		return nil, errors.New("Key Vault key ID must be of the form https://VAULT/keys/NAME/VERSION")
+	}
+	// The token scope is the vault.azure.net or managedhsm.azure.net
+	// resource, not the specific vault.
+	scope := "https://vault.azure.net/.default"
+	if strings.HasSuffix(u.Host, ".managedhsm.azure.net") {
+		scope = "https://managedhsm.azure.net/.default"
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Azure credentials for Key Vault signer: %w", err)
+	}
+	s := &AzureKeyVaultSigner{
+		cred:     cred,
+		scope:    scope,
+		keyID:    strings.TrimSuffix(keyID, "/"),
+		duration: duration,
+		log:      l,
+	}
+
+	var out struct {
+		Key struct {
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"key"`
+	}
+	if err := s.do(ctx, "GET", "", nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to fetch Key Vault public key: %w", err)
+	}
+	if (out.Key.Kty != "EC" && out.Key.Kty != "EC-HSM") || out.Key.Crv != "P-256" {
+		return nil, fmt.Errorf("Key Vault key is %s %s, not EC P-256", out.Key.Kty, out.Key.Crv)
+	}
+	x, errX := base64.RawURLEncoding.DecodeString(out.Key.X)
+	y, errY := base64.RawURLEncoding.DecodeString(out.Key.Y)
+	if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+		return nil, errors.New("failed to parse Key Vault public key coordinates")
+	}
+	if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+		return nil, fmt.Errorf("invalid Key Vault public key: %w", err)
+	}
+	s.pub = &ecdsa.PublicKey{Curve: elliptic.P256(),
+		X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+
+	if err := selfTestSigner(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *AzureKeyVaultSigner) do(ctx context.Context, method, op string, in, out any) error {
+	token, err := s.cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{s.scope}})
+	if err != nil {
+		return fmt.Errorf("failed to get Azure token: %w", err)
+	}
+	header := http.Header{"Authorization": {"Bearer " + token.Token}}
+	u := s.keyID + op + "?api-version=" + azureKeyVaultAPIVersion
+	return doJSON(ctx, http.DefaultClient, method, u, header, in, out)
+}
+
+var _ crypto.Signer = &AzureKeyVaultSigner{}
+
+func (s *AzureKeyVaultSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest, which must be a SHA-256 hash, with the Key Vault key.
+// rand is ignored.
+func (s *AzureKeyVaultSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("unsupported hash function %v", opts.HashFunc())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteSignTimeout)
+	defer cancel()
+	in := map[string]string{
+		"alg":   "ES256",
+		"value": base64.RawURLEncoding.EncodeToString(digest),
+	}
+	var out struct {
+		Value string `json:"value"`
+	}
+	start := time.Now()
+	err := s.do(ctx, "POST", "/sign", in, &out)
+	s.duration.WithLabelValues(fmt.Sprint(err != nil)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.log.Warn("Key Vault sign failed", "err", err)
+		return nil, fmt.Errorf("Key Vault sign failed: %w", err)
+	}
+
+	// Key Vault returns the JWS encoding of the signature, r || s.
+	sig, err := base64.RawURLEncoding.DecodeString(out.Value)
+	if err != nil {
+		return nil, errors.New("failed to parse Key Vault signature")
+	}
+	return encodeECDSASignature(sig)
+}
+
+func (s *AzureKeyVaultSigner) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{s.duration}
+}
@@ -0,0 +1,260 @@
+package ctlog
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto"
+	"io"
+	"log/slog"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"github.com/google/certificate-transparency-go/x509util"
+	"golang.org/x/mod/sumdb/tlog"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxSnapshotObjectSize is the maximum size of an object in a snapshot.
+const maxSnapshotObjectSize = 64 << 20
+
+// WriteSnapshot writes a snapshot of the log read through src to w, as a tar
+// archive of the objects of the log's backend.
+//
+// The snapshot is consistent: the first entry is the checkpoint, followed by
+// every tile of its tree, each verified against it, and the issuers bundle.
+// Partial tiles are read from their full version if they were collected.
+func WriteSnapshot(ctx context.Context, src *client.Client, w io.Writer, log *slog.Logger) (tlog.Tree, error) {
+	cp, err := src.Checkpoint(ctx)
+	if err != nil {
+		return tlog.Tree{}, fmtErrorf("failed to fetch checkpoint: %w", err)
+	}
+	log.InfoContext(ctx, "writing snapshot", "tree_size", cp.N)
+	start := time.Now()
+	tw := tar.NewWriter(w)
+	var objects int
+	var size int64
+	add := func(key string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     key,
+			Size:     int64(len(data)),
+			Mode:     0644,
+			ModTime:  start,
+		}); err != nil {
+			return fmtErrorf("failed to write %q header: %w", key, err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return fmtErrorf("failed to write %q: %w", key, err)
+		}
+		objects++
+		size += int64(len(data))
+		return nil
+	}
+	if err := add("checkpoint", cp.Signed); err != nil {
+		return tlog.Tree{}, err
+	}
+
+	// The HashReader verifies every tile it reads against the tree.
+	hr := src.HashReader(ctx, cp.Tree)
+	for _, t := range tlog.NewTiles(TileHeight, 0, cp.N) {
+		data, err := tlog.ReadTileData(t, hr)
+		if err != nil {
+			return tlog.Tree{}, fmtErrorf("couldn't read tile %v: %w", t.Path(), err)
+		}
+		if err := add(t.Path(), data); err != nil {
+			return tlog.Tree{}, err
+		}
+		if t.L != 0 {
+			continue
+		}
+		dataTile := t
+		dataTile.L = -1
+		b, err := src.ReadTile(ctx, dataTile)
+		if err != nil {
+			return tlog.Tree{}, fmtErrorf("failed to fetch data tile: %w", err)
+		}
+		if err := checkDataTile(hr, dataTile, b); err != nil {
+			return tlog.Tree{}, err
+		}
+		if err := add(dataTile.Path(), b); err != nil {
+			return tlog.Tree{}, err
+		}
+	}
+
+	issuers, err := src.Issuers(ctx)
+	if err != nil {
+		return tlog.Tree{}, err
+	}
+	if err := add("issuers.pem", issuers); err != nil {
+		return tlog.Tree{}, err
+	}
+	if err := tw.Close(); err != nil {
+		return tlog.Tree{}, fmtErrorf("failed to finish snapshot: %w", err)
+	}
+	log.InfoContext(ctx, "wrote snapshot", "tree_size", cp.N, "root_hash", cp.Hash,
+		"objects", objects, "bytes", size, "elapsed", time.Since(start))
+	return cp.Tree, nil
+}
+
+// RestoreConfig is the configuration of [RestoreSnapshot].
+type RestoreConfig struct {
+	// Name and Key are the name and public key of the log, which must have
+	// signed the snapshot checkpoint.
+	Name string
+	Key  crypto.PublicKey
+
+	// Destination is the backend the snapshot is restored to. It must not
+	// have a checkpoint.
+	Destination Backend
+
+	Log *slog.Logger
+}
+
+// RestoreSnapshot uploads a snapshot written by [WriteSnapshot] to
+// config.Destination, and returns the restored tree.
+//
+// The snapshot checkpoint is verified before anything is uploaded. After the
+// tiles and issuers bundle are uploaded, every tile of the tree is read back
+// from the destination and verified against the checkpoint root hash, and
+// only then is the checkpoint uploaded. If the restore fails, the destination
+// has no checkpoint, and the restore can be retried.
+func RestoreSnapshot(ctx context.Context, r io.Reader, config *RestoreConfig) (tlog.Tree, error) {
+	dst := config.Destination
+	if _, err := dst.Fetch(ctx, "checkpoint"); err == nil {
+		return tlog.Tree{}, fmtErrorf("destination already has a checkpoint")
+	}
+
+	tr := tar.NewReader(r)
+	next := func() (string, []byte, error) {
+		hdr, err := tr.Next()
+		if err != nil {
+			return "", nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return "", nil, fmtErrorf("unexpected snapshot entry %q of type %c", hdr.Name, hdr.Typeflag)
+		}
+		if hdr.Size > maxSnapshotObjectSize {
+			return "", nil, fmtErrorf("snapshot entry %q is too large: %d bytes", hdr.Name, hdr.Size)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return "", nil, fmtErrorf("failed to read snapshot entry %q: %w", hdr.Name, err)
+		}
+		return hdr.Name, data, nil
+	}
+
+	key, signed, err := next()
+	if err != nil {
+		return tlog.Tree{}, fmtErrorf("failed to read snapshot checkpoint: %w", err)
+	}
+	if key != "checkpoint" {
+		return tlog.Tree{}, fmtErrorf("first snapshot entry is %q, not the checkpoint", key)
+	}
+	c, err := openCheckpoint(config.Name, config.Key, signed)
+	if err != nil {
+		return tlog.Tree{}, fmtErrorf("invalid snapshot checkpoint: %w", err)
+	}
+	config.Log.InfoContext(ctx, "restoring snapshot", "tree_size", c.N, "root_hash", c.Hash)
+
+	start := time.Now()
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(mirrorUploads)
+	var objects int
+	var issuers []byte
+	err = func() error {
+		for {
+			key, data, err := next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			opts := optsHashTile
+			switch t, err := tlog.ParseTilePath(key); {
+			case key == "issuers.pem":
+				if len(data) > 0 && !x509util.NewPEMCertPool().AppendCertsFromPEM(data) {
+					return fmtErrorf("invalid snapshot issuers.pem")
+				}
+				issuers, opts = data, optsText
+			case err != nil || t.H != TileHeight:
+				return fmtErrorf("unexpected snapshot entry %q", key)
+			case t.W != tileWidthAt(t, c.N):
+				return fmtErrorf("snapshot tile %q is not part of the tree of size %d", key, c.N)
+			case t.L == -1:
+				opts = optsDataTile
+			}
+			g.Go(func() error {
+				if err := dst.Upload(gctx, key, data, opts); err != nil {
+					return fmtErrorf("failed to upload %q: %w", key, err)
+				}
+				return nil
+			})
+			objects++
+		}
+	}()
+	if err := g.Wait(); err != nil {
+		return tlog.Tree{}, err
+	}
+	if err != nil {
+		return tlog.Tree{}, err
+	}
+	if issuers == nil {
+		return tlog.Tree{}, fmtErrorf("snapshot has no issuers.pem")
+	}
+	config.Log.InfoContext(ctx, "uploaded snapshot", "objects", objects, "elapsed", time.Since(start))
+
+	if err := verifyRestoredTree(ctx, dst, c.Tree); err != nil {
+		return tlog.Tree{}, fmtErrorf("restored tree doesn't match checkpoint: %w", err)
+	}
+	restored, err := dst.Fetch(ctx, "issuers.pem")
+	if err != nil {
+		return tlog.Tree{}, fmtErrorf("couldn't fetch restored issuers.pem: %w", err)
+	}
+	if !bytes.Equal(restored, issuers) {
+		return tlog.Tree{}, fmtErrorf("restored issuers.pem doesn't match snapshot")
+	}
+
+	if err := dst.Upload(ctx, "checkpoint", signed, optsText); err != nil {
+		return tlog.Tree{}, fmtErrorf("failed to upload checkpoint: %w", err)
+	}
+	config.Log.InfoContext(ctx, "restored snapshot", "tree_size", c.N, "root_hash", c.Hash,
+		"elapsed", time.Since(start))
+	return c.Tree, nil
+}
+
+// verifyRestoredTree reads every tile of tree from b, and verifies it against
+// the tree root hash, along with the entries of the data tiles.
+func verifyRestoredTree(ctx context.Context, b Backend, tree tlog.Tree) error {
+	// TileHashReader verifies every tile it reads against the tree.
+	hr := tlog.TileHashReader(tree, &tileReader{
+		fetch: func(key string) ([]byte, error) {
+			return b.Fetch(ctx, key)
+		},
+		saveTiles: func(tiles []tlog.Tile, data [][]byte) {},
+	})
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(mirrorUploads)
+	for _, t := range tlog.NewTiles(TileHeight, 0, tree.N) {
+		if gctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			if _, err := tlog.ReadTileData(t, hr); err != nil {
+				return fmtErrorf("couldn't verify tile %v: %w", t.Path(), err)
+			}
+			if t.L != 0 {
+				return nil
+			}
+			dataTile := t
+			dataTile.L = -1
+			data, err := b.Fetch(gctx, dataTile.Path())
+			if err != nil {
+				return fmtErrorf("couldn't fetch data tile %v: %w", dataTile.Path(), err)
+			}
+			return checkDataTile(hr, dataTile, data)
+		})
+	}
+	return g.Wait()
+}
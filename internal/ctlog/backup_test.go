@@ -0,0 +1,97 @@
+package ctlog_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	sunlightclient "filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestSnapshot(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.MonitoringAPI = true
+	ts := httptest.NewServer(tl.Log.Handler())
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+
+	for i := 0; i < tileWidth*2+10; i++ {
+		addCertificate(t, tl)
+		if i%50 == 0 {
+			fatalIfErr(t, tl.Log.Sequence())
+		}
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+
+	src, err := sunlightclient.New(&sunlightclient.Config{
+		MonitoringPrefix: ts.URL,
+		Name:             tl.Config.Name,
+		PublicKey:        tl.Config.Key.Public(),
+	})
+	fatalIfErr(t, err)
+	snapshot := &bytes.Buffer{}
+	tree, err := ctlog.WriteSnapshot(ctx, src, snapshot, tl.Config.Log)
+	fatalIfErr(t, err)
+	if tree.N != tileWidth*2+10 {
+		t.Errorf("snapshot tree size is %d, expected %d", tree.N, tileWidth*2+10)
+	}
+
+	restore := func(archive []byte, dst ctlog.Backend) (tlog.Tree, error) {
+		return ctlog.RestoreSnapshot(ctx, bytes.NewReader(archive), &ctlog.RestoreConfig{
+			Name:        tl.Config.Name,
+			Key:         tl.Config.Key.Public(),
+			Destination: dst,
+			Log:         tl.Config.Log,
+		})
+	}
+
+	// A corrupted data tile must be detected, and the checkpoint not uploaded.
+	corrupted := &bytes.Buffer{}
+	tw := tar.NewWriter(corrupted)
+	tr := tar.NewReader(bytes.NewReader(snapshot.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		fatalIfErr(t, err)
+		data, err := io.ReadAll(tr)
+		fatalIfErr(t, err)
+		if hdr.Name == "tile/8/data/001" {
+			data[20] ^= 0xff
+		}
+		fatalIfErr(t, tw.WriteHeader(hdr))
+		_, err = tw.Write(data)
+		fatalIfErr(t, err)
+	}
+	fatalIfErr(t, tw.Close())
+	dst := NewMemoryBackend(t)
+	if _, err := restore(corrupted.Bytes(), dst); err == nil {
+		t.Error("restored snapshot with corrupted data tile")
+	}
+	if _, err := dst.Fetch(ctx, "checkpoint"); err == nil {
+		t.Error("checkpoint uploaded despite corrupted data tile")
+	}
+
+	dst = NewMemoryBackend(t)
+	restored, err := restore(snapshot.Bytes(), dst)
+	fatalIfErr(t, err)
+	if restored != tree {
+		t.Errorf("restored tree %v doesn't match snapshot tree %v", restored, tree)
+	}
+	if _, err := restore(snapshot.Bytes(), dst); err == nil {
+		t.Error("restored snapshot over existing checkpoint")
+	}
+
+	// The restored backend must be loadable as the log, and keep working.
+	tl.Config.Backend = dst
+	tl = ReloadLog(t, tl)
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	tl.CheckLog()
+}
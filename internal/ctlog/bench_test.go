@@ -0,0 +1,209 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// BenchmarkSubmission measures the validation of a submitted chain, up to
+// the deduplication cache hit, through the add-chain and add-pre-chain
+// handlers.
+func BenchmarkSubmission(b *testing.B) {
+	b.Run("Certificate", func(b *testing.B) {
+		benchmarkSubmission(b, "/ct/v1/add-chain", testLeaf)
+	})
+	b.Run("Precert", func(b *testing.B) {
+		benchmarkSubmission(b, "/ct/v1/add-pre-chain", testPrecert)
+	})
+}
+
+func benchmarkSubmission(b *testing.B, path string, leaf []byte) {
+	tl := NewEmptyTestLog(b)
+	tl.Quiet()
+	tl.StartSequencer()
+	body, err := json.Marshal(map[string][][]byte{"chain": {leaf, testIntermediate, testRoot}})
+	fatalIfErr(b, err)
+	h := tl.Log.Handler()
+	submit := func() {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			b.Fatalf("got status %d: %s", rr.Code, rr.Body)
+		}
+	}
+	// The first submission waits for the sequencer, the others hit the cache.
+	submit()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		submit()
+	}
+}
+
+var sequencingRoundSizes = []int{1, 256, 4096}
+
+// BenchmarkSequencingRound measures a call to Sequence with pools of various
+// sizes. Adding the entries to the pool is not included.
+func BenchmarkSequencingRound(b *testing.B) {
+	for _, n := range sequencingRoundSizes {
+		b.Run(fmt.Sprintf("entries=%d", n), func(b *testing.B) {
+			benchmarkSequencingRound(b, n)
+		})
+	}
+}
+
+func benchmarkSequencingRound(b *testing.B, n int) {
+	tl := NewEmptyTestLog(b)
+	tl.Quiet()
+	var count uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for range n {
+			count++
+			cert := binary.BigEndian.AppendUint64(bytes.Repeat([]byte("A"), 2350), count)
+			tl.Log.AddLeafToPool(&ctlog.LogEntry{Certificate: cert})
+		}
+		b.StartTimer()
+		fatalIfErr(b, tl.Log.Sequence())
+	}
+	b.ReportMetric(float64(n*b.N)/b.Elapsed().Seconds(), "entries/s")
+}
+
+// BenchmarkCompressDataTile measures the gzip compression of a full data tile
+// at various levels, as done by the S3 backend before uploading it.
+func BenchmarkCompressDataTile(b *testing.B) {
+	for _, level := range compressionLevels {
+		b.Run(fmt.Sprintf("level=%d", level), func(b *testing.B) {
+			benchmarkCompressDataTile(b, level)
+		})
+	}
+}
+
+var compressionLevels = []int{gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression}
+
+func benchmarkCompressDataTile(b *testing.B, level int) {
+	entries := benchmarkEntries()
+	var tile []byte
+	for i := range tileWidth {
+		tile = entries[i%len(entries)].AppendTileLeaf(tile)
+	}
+	b.SetBytes(int64(len(tile)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fatalIfErr(b, ctlog.Compress(tile, level))
+	}
+}
+
+var benchBaselineFlag = flag.String("bench-baseline", "", "compare the benchmarks against the baseline `file`")
+
+var benchUpdateFlag = flag.Bool("bench-update", false, "write the benchmark results to -bench-baseline instead")
+
+var benchToleranceFlag = flag.Float64("bench-tolerance", 0.25, "allowed `fraction` of ns/op regression from -bench-baseline")
+
+var benchRunsFlag = flag.Int("bench-runs", 3, "`runs` of each benchmark for -bench-baseline, of which the fastest is used")
+
+// regressionBenchmarks are the benchmarks checked by TestBenchmarkBaseline.
+func regressionBenchmarks() map[string]func(*testing.B) {
+	m := map[string]func(*testing.B){
+		"BenchmarkSequencer":              BenchmarkSequencer,
+		"BenchmarkAddLeafToPoolParallel":  BenchmarkAddLeafToPoolParallel,
+		"BenchmarkTileLeaf":               BenchmarkTileLeaf,
+		"BenchmarkMerkleTreeLeaf":         BenchmarkMerkleTreeLeaf,
+		"BenchmarkSignedEntry":            BenchmarkSignedEntry,
+		"BenchmarkSubmission/Certificate": func(b *testing.B) { benchmarkSubmission(b, "/ct/v1/add-chain", testLeaf) },
+		"BenchmarkSubmission/Precert":     func(b *testing.B) { benchmarkSubmission(b, "/ct/v1/add-pre-chain", testPrecert) },
+	}
+	for _, n := range sequencingRoundSizes {
+		m[fmt.Sprintf("BenchmarkSequencingRound/entries=%d", n)] = func(b *testing.B) { benchmarkSequencingRound(b, n) }
+	}
+	for _, level := range compressionLevels {
+		m[fmt.Sprintf("BenchmarkCompressDataTile/level=%d", level)] = func(b *testing.B) { benchmarkCompressDataTile(b, level) }
+	}
+	return m
+}
+
+// TestBenchmarkBaseline is a performance regression gate. To use it, record a
+// baseline on the base branch, and then compare the change against it:
+//
+//	go test ./internal/ctlog -run TestBenchmarkBaseline -bench-baseline=/tmp/bench.txt -bench-update
+//	git checkout feature
+//	go test ./internal/ctlog -run TestBenchmarkBaseline -bench-baseline=/tmp/bench.txt
+//
+// It fails if any benchmark allocates more than 1% more per op than the
+// baseline, or takes more than -bench-tolerance longer. Each benchmark is run
+// -bench-runs times, and the fastest run is used, to reduce the noise. The
+// baseline is in the go test -bench output format, so it can also be fed to
+// benchstat.
+func TestBenchmarkBaseline(t *testing.T) {
+	if *benchBaselineFlag == "" {
+		t.Skip("-bench-baseline not set")
+	}
+	benchmarks := regressionBenchmarks()
+	names := slices.Sorted(maps.Keys(benchmarks))
+	results := make(map[string]testing.BenchmarkResult)
+	for _, name := range names {
+		for range max(*benchRunsFlag, 1) {
+			r := testing.Benchmark(benchmarks[name])
+			if best, ok := results[name]; !ok || r.NsPerOp() < best.NsPerOp() {
+				results[name] = r
+			}
+		}
+	}
+
+	if *benchUpdateFlag {
+		var buf bytes.Buffer
+		for _, name := range names {
+			fmt.Fprintf(&buf, "%s\t%s\t%s\n", name, results[name], results[name].MemString())
+		}
+		fatalIfErr(t, os.WriteFile(*benchBaselineFlag, buf.Bytes(), 0o644))
+		return
+	}
+
+	baseline, err := os.ReadFile(*benchBaselineFlag)
+	fatalIfErr(t, err)
+	for _, line := range strings.Split(string(baseline), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		r, ok := results[fields[0]]
+		if !ok {
+			t.Logf("%s: not a known benchmark, skipping", fields[0])
+			continue
+		}
+		// Fields are name, iterations, and then value and unit pairs.
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				t.Fatalf("%s: invalid value %q", fields[0], fields[i])
+			}
+			switch fields[i+1] {
+			case "ns/op":
+				if got := float64(r.NsPerOp()); got > v*(1+*benchToleranceFlag) {
+					t.Errorf("%s: %.0f ns/op, baseline %.0f ns/op (%+.1f%%)", fields[0], got, v, (got/v-1)*100)
+				}
+			case "allocs/op":
+				if got := float64(r.AllocsPerOp()); got > v+max(v/100, 0.5) {
+					t.Errorf("%s: %.0f allocs/op, baseline %.0f allocs/op", fields[0], got, v)
+				}
+			}
+		}
+	}
+}
@@ -1,12 +1,57 @@
 package ctlog
 
 import (
+	"crypto/sha256"
+	"sync"
+
 	"crawshaw.io/sqlite"
 	"crawshaw.io/sqlite/sqlitex"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-func initCache(path string) (readConn, writeConn *sqlite.Conn, err error) {
+// cacheShards is the number of shards of the deduplication state. Each shard
+// has its own lock and SQLite read connection, so that concurrent submissions
+// only contend if their cache hashes share a prefix.
+const cacheShards = 16
+
+// cacheShard is the deduplication state of the cache hashes whose first byte
+// is equal to its index modulo cacheShards.
+type cacheShard struct {
+	// mu is held for the entire duration of addLeafToPool, and, for all
+	// shards at once, by sequence while rotating currentPool and
+	// inSequencing. See Log.poolMu.
+	mu sync.Mutex
+	// inSequencing is the shard of the pool.byHash maps of the pool that's
+	// currently being sequenced. These entries might not be sequenced yet or
+	// might not yet be committed to the deduplication cache.
+	inSequencing map[cacheHash]waitEntryFunc
+	// cacheRead is used to check the deduplication cache under mu.
+	cacheRead *sqlite.Conn
+}
+
+func (h cacheHash) shard() int {
+	return int(h[0]) % cacheShards
+}
+
+// lockPools locks every shard, and then poolMu, to rotate or inspect the
+// pools without any concurrent addLeafToPool.
+func (l *Log) lockPools() {
+	for i := range l.shards {
+		l.shards[i].mu.Lock()
+	}
+	l.poolMu.Lock()
+}
+
+func (l *Log) unlockPools() {
+	l.poolMu.Unlock()
+	for i := range l.shards {
+		l.shards[i].mu.Unlock()
+	}
+}
+
+// initCache creates the cache database if needed, and opens a write
+// connection and readers read connections to it.
+func initCache(path string, readers int) (readConns []*sqlite.Conn, writeConn *sqlite.Conn, err error) {
 	writeConn, err = sqlite.OpenConn(path, 0)
 	if err != nil {
 		return nil, nil, err
@@ -25,26 +70,35 @@ func initCache(path string) (readConn, writeConn *sqlite.Conn, err error) {
 		writeConn.Close()
 		return nil, nil, err
 	}
-	readConn, err = sqlite.OpenConn(path, 0)
-	if err != nil {
-		writeConn.Close()
-		return nil, nil, err
+	for range readers {
+		readConn, err := sqlite.OpenConn(path, 0)
+		if err != nil {
+			for _, c := range readConns {
+				c.Close()
+			}
+			writeConn.Close()
+			return nil, nil, err
+		}
+		readConns = append(readConns, readConn)
 	}
-	return readConn, writeConn, nil
+	return readConns, writeConn, nil
 }
 
 func (l *Log) CloseCache() error {
-	if err := l.cacheRead.Close(); err != nil {
-		return err
+	for i := range l.shards {
+		if err := l.shards[i].cacheRead.Close(); err != nil {
+			return err
+		}
 	}
 	return l.cacheWrite.Close()
 }
 
-func (l *Log) cacheGet(leaf *LogEntry) (*SequencedLogEntry, error) {
+// cacheGet looks up leaf, whose cache hash is h, in the deduplication cache.
+// The caller must hold the lock of shard s, of h.
+func (l *Log) cacheGet(s *cacheShard, leaf *LogEntry, h cacheHash) (*SequencedLogEntry, error) {
 	defer prometheus.NewTimer(l.m.CacheGetDuration).ObserveDuration()
-	h := leaf.cacheHash()
 	var se *SequencedLogEntry
-	err := sqlitex.Exec(l.cacheRead, "SELECT timestamp, leaf_index FROM cache WHERE key = ?",
+	err := sqlitex.Exec(s.cacheRead, "SELECT timestamp, leaf_index FROM cache WHERE key = ?",
 		func(stmt *sqlite.Stmt) error {
 			se = &SequencedLogEntry{
 				LogEntry:  *leaf,
@@ -69,6 +123,50 @@ func (l *Log) cachePut(entries []*SequencedLogEntry) (err error) {
 		if err != nil {
 			return err
 		}
+		if l.c.Dedup == DedupTBS && se.IsPrecert {
+			h := tbsCacheHash(se.IssuerKeyHash, se.Certificate)
+			err := sqlitex.Exec(l.cacheWrite, "INSERT OR IGNORE INTO cache (key, timestamp, leaf_index) VALUES (?, ?, ?)",
+				nil, h[:], se.Timestamp, se.LeafIndex)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
+
+// tbsCacheHash is the cache key of a precertificate by its TBSCertificate,
+// after the poison extension is removed, and the hash of its issuer key.
+//
+// It's domain separated from the leaf cache key, which is a hash of a
+// SignedEntry, which can't start with the "tbs:" prefix.
+func tbsCacheHash(issuerKeyHash [32]byte, tbs []byte) cacheHash {
+	h := sha256.New()
+	h.Write([]byte("tbs:"))
+	h.Write(issuerKeyHash[:])
+	h.Write(tbs)
+	return cacheHash(h.Sum(nil)[:16])
+}
+
+// loggedPrecert returns the sequenced entry of the precertificate with the
+// given tbsCacheHash, if it was logged while Config.Dedup was DedupTBS.
+func (l *Log) loggedPrecert(h cacheHash) (*SequencedLogEntry, error) {
+	// cacheRead is shared with addLeafToPool, which holds the shard lock.
+	s := &l.shards[h.shard()]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer prometheus.NewTimer(l.m.CacheGetDuration).ObserveDuration()
+	var se *SequencedLogEntry
+	err := sqlitex.Exec(s.cacheRead, "SELECT timestamp, leaf_index FROM cache WHERE key = ?",
+		func(stmt *sqlite.Stmt) error {
+			se = &SequencedLogEntry{
+				LeafIndex: stmt.GetInt64("leaf_index"),
+				Timestamp: stmt.GetInt64("timestamp"),
+			}
+			return nil
+		}, h[:])
+	if err != nil {
+		return nil, err
+	}
+	return se, nil
+}
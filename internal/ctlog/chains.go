@@ -0,0 +1,105 @@
+package ctlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+// chainCacheSize is the maximum number of verified intermediate chains kept
+// in the chain cache. There are only a few hundred active intermediates.
+const chainCacheSize = 4096
+
+// chainCache remembers, for each submitted sequence of intermediates, its
+// parsed certificates and the verified path from the first one to a root.
+//
+// Most submissions come from a few intermediates, so this allows parsing and
+// verifying only the leaf and its signature, instead of the whole chain.
+type chainCache struct {
+	mu sync.Mutex
+	m  map[[sha256.Size]byte]cachedChain
+}
+
+type cachedChain struct {
+	// roots is the pool the path was verified against. Entries for a pool
+	// that's not in use anymore are ignored.
+	roots *x509util.PEMCertPool
+	// path starts with the first submitted intermediate and ends with a root.
+	path []*x509.Certificate
+}
+
+func newChainCache() *chainCache {
+	return &chainCache{m: make(map[[sha256.Size]byte]cachedChain)}
+}
+
+func chainCacheKey(intermediates [][]byte) [sha256.Size]byte {
+	h := sha256.New()
+	for _, c := range intermediates {
+		d := sha256.Sum256(c)
+		h.Write(d[:])
+	}
+	return [sha256.Size]byte(h.Sum(nil))
+}
+
+func (c *chainCache) get(intermediates [][]byte, roots *x509util.PEMCertPool) []*x509.Certificate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.m[chainCacheKey(intermediates)]
+	if !ok || e.roots != roots {
+		return nil
+	}
+	return e.path
+}
+
+func (c *chainCache) put(intermediates [][]byte, roots *x509util.PEMCertPool, path []*x509.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.m) >= chainCacheSize {
+		// Evict an arbitrary entry.
+		for k := range c.m {
+			delete(c.m, k)
+			break
+		}
+	}
+	c.m[chainCacheKey(intermediates)] = cachedChain{roots: roots, path: path}
+}
+
+// validateCachedChain verifies rawChain using a cached path for its
+// intermediates, applying the same checks as ctfe.ValidateChain to the leaf.
+// It returns nil if there is no cached path.
+func (l *Log) validateCachedChain(rawChain [][]byte, roots *x509util.PEMCertPool) ([]*x509.Certificate, error) {
+	if len(rawChain) < 2 {
+		return nil, nil
+	}
+	path := l.chains.get(rawChain[1:], roots)
+	if path == nil {
+		l.m.ChainCacheRequests.WithLabelValues("miss").Inc()
+		return nil, nil
+	}
+	l.m.ChainCacheRequests.WithLabelValues("hit").Inc()
+
+	leaf, err := x509.ParseCertificate(rawChain[0])
+	if x509.IsFatal(err) {
+		return nil, err
+	}
+	if leaf.NotAfter.Before(l.c.NotAfterStart) || !leaf.NotAfter.Before(l.c.NotAfterLimit) {
+		return nil, errors.New("certificate NotAfter outside of the log temporal interval")
+	}
+	if !slices.Contains(leaf.ExtKeyUsage, x509.ExtKeyUsageServerAuth) {
+		return nil, errors.New("rejecting certificate without serverAuth EKU")
+	}
+	// These are the checks x509.Certificate.Verify applies to each link,
+	// given the options used by ctfe.ValidateChain.
+	if !bytes.Equal(leaf.RawIssuer, path[0].RawSubject) {
+		return nil, errors.New("leaf issuer doesn't match the first intermediate")
+	}
+	if err := leaf.CheckSignatureFrom(path[0]); err != nil {
+		return nil, err
+	}
+	return append([]*x509.Certificate{leaf}, path...), nil
+}
@@ -0,0 +1,117 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/certificate-transparency-go/x509util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestChainCache(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.StartSequencer()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(tl.Log.Metrics()...)
+	lookups := func(result string) float64 {
+		mfs, err := reg.Gather()
+		fatalIfErr(t, err)
+		for _, mf := range mfs {
+			if mf.GetName() != "chain_cache_requests_total" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				if m.GetLabel()[0].GetValue() == result {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+		return 0
+	}
+	submit := func(path string, chain ...[]byte) int {
+		body, err := json.Marshal(map[string][][]byte{"chain": chain})
+		fatalIfErr(t, err)
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		return rr.Code
+	}
+
+	if code := submit("/ct/v1/add-chain", testLeaf, testIntermediate, testRoot); code != http.StatusOK {
+		t.Fatalf("got status %d, expected 200", code)
+	}
+	if code := submit("/ct/v1/add-pre-chain", testPrecert, testIntermediate, testRoot); code != http.StatusOK {
+		t.Fatalf("got status %d, expected 200", code)
+	}
+	if hits, misses := lookups("hit"), lookups("miss"); hits != 1 || misses != 1 {
+		t.Errorf("got %v hits and %v misses, expected 1 and 1", hits, misses)
+	}
+
+	// A leaf not issued by the cached intermediate must still be rejected.
+	h := newPrecertHierarchy(t)
+	if code := submit("/ct/v1/add-chain", h.finalFromPreIssuer, testIntermediate, testRoot); code != http.StatusBadRequest {
+		t.Errorf("got status %d, expected 400", code)
+	}
+	if hits := lookups("hit"); hits != 2 {
+		t.Errorf("got %v hits, expected 2", hits)
+	}
+
+	// Replacing the roots invalidates the cache.
+	tl.Log.SetRoots(x509util.NewPEMCertPool())
+	if code := submit("/ct/v1/add-chain", testLeaf, testIntermediate, testRoot); code != http.StatusBadRequest {
+		t.Errorf("got status %d, expected 400", code)
+	}
+}
+
+func TestChainCacheEKU(t *testing.T) {
+	h := newPrecertHierarchy(t)
+	r := x509util.NewPEMCertPool()
+	r.AppendCertsFromPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: h.root}))
+	newLog := func(t *testing.T) *TestLog {
+		tl := NewEmptyTestLog(t)
+		tl.Log.SetRoots(r)
+		tl.StartSequencer()
+		return tl
+	}
+	submit := func(t *testing.T, tl *TestLog, chain ...[]byte) int {
+		body, err := json.Marshal(map[string][][]byte{"chain": chain})
+		fatalIfErr(t, err)
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+		return rr.Code
+	}
+
+	// Submitting through a cached path must give the same answer as the
+	// full validation of ctfe.ValidateChain.
+	for _, tc := range []struct {
+		name string
+		leaf []byte
+		code int
+	}{
+		{"ServerAuth", h.serverAuth, http.StatusOK},
+		{"NoEKU", h.noEKU, http.StatusBadRequest},
+		{"Any", h.anyEKU, http.StatusBadRequest},
+		{"ClientAuth", h.clientAuth, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cold := submit(t, newLog(t), tc.leaf, h.intermediate)
+
+			tl := newLog(t)
+			if code := submit(t, tl, h.final, h.intermediate); code != http.StatusOK {
+				t.Fatalf("got status %d populating the cache", code)
+			}
+			warm := submit(t, tl, tc.leaf, h.intermediate)
+			tl.CheckLog()
+
+			if cold != warm {
+				t.Errorf("got status %d uncached and %d cached", cold, warm)
+			}
+			if cold != tc.code {
+				t.Errorf("got status %d, expected %d", cold, tc.code)
+			}
+		})
+	}
+}
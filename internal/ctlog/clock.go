@@ -0,0 +1,68 @@
+package ctlog
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// A Clock is the source of the timestamps of SCTs and checkpoints.
+type Clock interface {
+	// NowUnixMilli returns the current time in milliseconds since the UNIX
+	// epoch. It must never go backwards.
+	NowUnixMilli() int64
+}
+
+type systemClock struct{}
+
+func (systemClock) NowUnixMilli() int64 { return timeNowUnixMilli() }
+
+var timeNowUnixMilli = func() int64 { return time.Now().UnixMilli() }
+
+func (c *Config) clock() Clock {
+	if c.Clock != nil {
+		return c.Clock
+	}
+	return systemClock{}
+}
+
+// A FakeClock is a Clock that starts at a fixed time and advances by one
+// millisecond every time it's read, so that the timestamps of a run only
+// depend on the order of the operations, and can be replayed along with
+// Config.Seed.
+type FakeClock struct {
+	now atomic.Int64
+}
+
+// NewFakeClock returns a FakeClock whose first reading is start.
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{}
+	c.now.Store(start.UnixMilli() - 1)
+	return c
+}
+
+func (c *FakeClock) NowUnixMilli() int64 { return c.now.Add(1) }
+
+var errClockSkew = fmtErrorf("clock skew")
+
+// clockSkewRetryAfter is the Retry-After value, in seconds, for submissions
+// rejected because of clock skew.
+const clockSkewRetryAfter = 60
+
+// SetClockSkew reports whether the clock is believed to be inaccurate, such as
+// because its offset from NTP exceeds a threshold. If reason is not empty,
+// submissions are rejected with a 503 and the sequencer doesn't sign any SCTs
+// or checkpoints until SetClockSkew is called again with an empty reason, to
+// avoid issuing them with wrong timestamps.
+func (l *Log) SetClockSkew(reason string) {
+	if reason == "" {
+		if l.clockSkew.Swap(nil) != nil {
+			l.m.ClockSkew.Set(0)
+			l.c.Log.Info("clock is accurate again, accepting submissions")
+		}
+		return
+	}
+	if l.clockSkew.Swap(&reason) == nil {
+		l.c.Log.Error("clock is inaccurate, rejecting submissions", "reason", reason)
+	}
+	l.m.ClockSkew.Set(1)
+}
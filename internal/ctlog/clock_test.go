@@ -0,0 +1,65 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+type clockFunc func() int64
+
+func (f clockFunc) NowUnixMilli() int64 { return f() }
+
+func TestClock(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	// The clock must be ahead of the log creation time.
+	start := time.Now().Add(24 * time.Hour).UnixMilli()
+	var now atomic.Int64
+	now.Store(start)
+	tl.Config.Clock = clockFunc(func() int64 { return now.Add(1) })
+	sct, err := tl.LogClient().AddChain(context.Background(), []ct.ASN1Cert{
+		{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+	fatalIfErr(t, err)
+	if sct.Timestamp < uint64(start) || sct.Timestamp > uint64(now.Load()) {
+		t.Errorf("SCT timestamp %d is not from the configured clock", sct.Timestamp)
+	}
+	if sth := tl.CheckLog(); sth < start || sth > now.Load() {
+		t.Errorf("checkpoint timestamp %d is not from the configured clock", sth)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+
+	sth := tl.CheckLog()
+	tl.Log.SetClockSkew("offset too large")
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, expected 503", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+
+	// No checkpoints are signed while the clock is inaccurate.
+	time.Sleep(5 * time.Millisecond)
+	fatalIfErr(t, tl.Log.Sequence())
+	if got := tl.CheckLog(); got != sth {
+		t.Errorf("checkpoint timestamp changed from %d to %d", sth, got)
+	}
+
+	tl.Log.SetClockSkew("")
+	_, err = tl.LogClient().AddChain(context.Background(), []ct.ASN1Cert{
+		{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+	fatalIfErr(t, err)
+}
@@ -0,0 +1,38 @@
+package ctlog_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func TestClockRegression(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	ctx := context.Background()
+	start := time.Now().Add(24 * time.Hour).UnixMilli()
+	var now atomic.Int64
+	now.Store(start)
+	tl.Config.Clock = clockFunc(func() int64 { return now.Load() })
+	fatalIfErr(t, tl.Log.Sequence())
+	sth := tl.CheckLog()
+
+	// A clock that didn't progress fails the round, but doesn't stop the log.
+	f, _ := tl.Log.AddLeafToPool(&ctlog.LogEntry{Certificate: []byte("regressed")})
+	fatalIfErr(t, tl.Log.Sequence())
+	if _, err := f(ctx); err == nil {
+		t.Error("entry was sequenced with a regressing timestamp")
+	}
+	if got := tl.CheckLog(); got != sth {
+		t.Errorf("checkpoint timestamp changed from %d to %d", sth, got)
+	}
+
+	now.Store(start + 1000)
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	if got := tl.CheckLog(); got != start+1000 {
+		t.Errorf("checkpoint timestamp is %d, expected %d", got, start+1000)
+	}
+}
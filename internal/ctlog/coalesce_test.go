@@ -0,0 +1,86 @@
+package ctlog_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// blockingBackend is a MemoryBackend whose fetches of key wait for release,
+// and are counted.
+type blockingBackend struct {
+	*MemoryBackend
+	key     string
+	release chan struct{}
+	fetches atomic.Int64
+}
+
+func (b *blockingBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	if key == b.key {
+		b.fetches.Add(1)
+		<-b.release
+	}
+	return b.MemoryBackend.Fetch(ctx, key)
+}
+
+func TestCoalescedFetches(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.MonitoringAPI = true
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	b := &blockingBackend{MemoryBackend: tl.Config.Backend.(*MemoryBackend),
+		key: "checkpoint", release: make(chan struct{})}
+	tl.Config.Backend = b
+	h := tl.Log.Handler()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(tl.Log.Metrics()...)
+	coalesced := func() float64 {
+		mfs, err := reg.Gather()
+		fatalIfErr(t, err)
+		for _, mf := range mfs {
+			if mf.GetName() != "object_cache_requests_total" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "result" && l.GetValue() == "coalesced" {
+						return m.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return 0
+	}
+
+	const n = 10
+	codes := make(chan int, n)
+	for range n {
+		go func() {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", "/checkpoint", nil))
+			codes <- rr.Code
+		}()
+	}
+	// Give all requests time to reach the pending fetch.
+	for b.fetches.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(b.release)
+	for range n {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("got status %d", code)
+		}
+	}
+	if f := b.fetches.Load(); f != 1 {
+		t.Errorf("backend fetched the checkpoint %d times, expected 1", f)
+	}
+	if c := coalesced(); c != n-1 {
+		t.Errorf("%v requests were coalesced, expected %d", c, n-1)
+	}
+}
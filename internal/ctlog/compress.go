@@ -0,0 +1,166 @@
+package ctlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"runtime"
+	"sync"
+)
+
+// gzipWriters and uploadBuffers are reused across uploads, since a new
+// gzip.Writer allocates hundreds of KB of compression state, and at thousands
+// of uploads per minute that dominates the garbage collection work.
+//
+// gzipWriters is indexed by compression level, starting at gzip.HuffmanOnly.
+var (
+	gzipWriters   [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+	uploadBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+)
+
+// maxPooledBufferSize is the capacity above which upload buffers are not
+// returned to the pool, so that a rare large upload isn't retained forever.
+const maxPooledBufferSize = 4 << 20
+
+func compress(data []byte, level int) (*bytes.Buffer, error) {
+	b := uploadBuffers.Get().(*bytes.Buffer)
+	b.Reset()
+	pool := &gzipWriters[level-gzip.HuffmanOnly]
+	w, _ := pool.Get().(*gzip.Writer)
+	if w == nil {
+		var err error
+		if w, err = gzip.NewWriterLevel(b, level); err != nil {
+			putUploadBuffer(b)
+			return nil, err
+		}
+	} else {
+		w.Reset(b)
+	}
+	defer pool.Put(w)
+	if _, err := w.Write(data); err != nil {
+		putUploadBuffer(b)
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		putUploadBuffer(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+func putUploadBuffer(b *bytes.Buffer) {
+	if b.Cap() <= maxPooledBufferSize {
+		uploadBuffers.Put(b)
+	}
+}
+
+// ParseObjectClass returns the ObjectClass named s, or an error if it's
+// unknown.
+func ParseObjectClass(s string) (ObjectClass, error) {
+	switch c := ObjectClass(s); c {
+	case ObjectClassDataTile, ObjectClassAudit, ObjectClassOther:
+		return c, nil
+	default:
+		return "", fmtErrorf("unknown object class %q", s)
+	}
+}
+
+// CompressionOptions configure the compression of the uploads of an
+// [S3Backend] with UploadOptions.Compress set.
+type CompressionOptions struct {
+	// Workers is the number of objects compressed concurrently. Uploads
+	// queue for a worker, so that compression can't starve the sequencer of
+	// CPU. Zero means GOMAXPROCS.
+	Workers int
+
+	// Levels are the gzip compression levels by object class, from
+	// gzip.HuffmanOnly to gzip.BestCompression. Missing classes use
+	// gzip.DefaultCompression.
+	Levels map[ObjectClass]int
+}
+
+// compressor is a pool of compression workers. Uploads run concurrently with
+// the sequencing round that produced them, so compressing a full data tile
+// overlaps with the hashing and serialization of the following ones, while
+// the workers bound the CPU the compression takes from them.
+type compressor struct {
+	once    sync.Once
+	jobs    chan compressJob
+	workers int
+	levels  map[ObjectClass]int
+}
+
+type compressJob struct {
+	data  []byte
+	level int
+	done  chan compressResult
+}
+
+type compressResult struct {
+	b   *bytes.Buffer
+	err error
+}
+
+// Check returns an error if o has unknown object classes or invalid levels.
+func (o CompressionOptions) Check() error {
+	if o.Workers < 0 {
+		return fmtErrorf("invalid number of compression workers %d", o.Workers)
+	}
+	for class, level := range o.Levels {
+		if _, err := ParseObjectClass(string(class)); err != nil {
+			return err
+		}
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return fmtErrorf("invalid compression level %d for %q", level, class)
+		}
+	}
+	return nil
+}
+
+// SetCompression applies o to the uploads with UploadOptions.Compress set. It
+// must be called before the backend is used.
+func (s *S3Backend) SetCompression(o CompressionOptions) error {
+	if err := o.Check(); err != nil {
+		return err
+	}
+	s.compressor.workers = o.Workers
+	s.compressor.levels = o.Levels
+	return nil
+}
+
+func (c *compressor) start() {
+	n := c.workers
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	c.jobs = make(chan compressJob)
+	for range n {
+		go func() {
+			for job := range c.jobs {
+				b, err := compress(job.data, job.level)
+				job.done <- compressResult{b, err}
+			}
+		}()
+	}
+}
+
+// compress compresses data with the level of class on one of the workers,
+// which are started on first use.
+func (c *compressor) compress(ctx context.Context, data []byte, class ObjectClass) (*bytes.Buffer, error) {
+	c.once.Do(c.start)
+	if class == "" {
+		class = ObjectClassOther
+	}
+	level, ok := c.levels[class]
+	if !ok {
+		level = gzip.DefaultCompression
+	}
+	job := compressJob{data: data, level: level, done: make(chan compressResult, 1)}
+	select {
+	case c.jobs <- job:
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+	res := <-job.done
+	return res.b, res.err
+}
@@ -0,0 +1,186 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight"
+	"filippo.io/sunlight/internal/ctlog"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var minioFlag = flag.String("minio", "", "URL of a MinIO bucket, like http://localhost:9000/sunlight, "+
+	"to run TestConcurrentSequencers against, with credentials from the environment")
+
+// TestConcurrentSequencers runs two sequencers against the same backend and
+// lock, as it happens when a deployment briefly runs two instances, with
+// random jitter on every backend request so that their rounds interleave.
+//
+// In every round, at most one sequencer can win the lock, and the other only
+// leaves behind garbage tiles of tree sizes that were never signed. Both can
+// lose a round if it was refused an upload of a tile the other uploaded first,
+// in which case the round is retried, and both start again from the backends.
+// No immutable object must ever be overwritten, which is what conditional
+// writes prevent, and every published checkpoint must be a prefix of the
+// final tree.
+//
+// The rounds stay within the first data tile: a round lost by both
+// sequencers can leave behind conflicting full tiles, which no later round
+// could replace.
+func TestConcurrentSequencers(t *testing.T) {
+	seed := time.Now().UnixNano()
+	t.Logf("seed: %d", seed)
+	r := mathrand.New(mathrand.NewSource(seed))
+
+	var backend *RacyBackend
+	if *minioFlag != "" {
+		backend = NewRacyBackend(newMinIOBackend(t), seed)
+	} else {
+		backend = NewRacyBackend(NewMemoryBackend(t), seed)
+		backend.Conditional = true
+	}
+	tl := NewEmptyTestLogWithBackend(t, backend)
+	tl.Quiet()
+
+	rounds := 40
+	if testing.Short() {
+		rounds = 5
+	}
+	var serial uint64
+	newEntry := func() *ctlog.LogEntry {
+		serial++
+		return &ctlog.LogEntry{Certificate: binary.BigEndian.AppendUint64([]byte("race"), serial)}
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(tl.Config.Key.Public())
+	fatalIfErr(t, err)
+	logID := sha256.Sum256(pkix)
+
+	published := make(map[int64]tlog.Hash)
+	logged := make(map[int64][]byte)
+	var lostRounds int
+	for round := 0; round < rounds; {
+		var wg sync.WaitGroup
+		won := make([][]*ctlog.SequencedLogEntry, 2)
+		for i := range won {
+			c := *tl.Config
+			c.Cache = filepath.Join(t.TempDir(), "cache.db")
+			l, err := ctlog.LoadLog(context.Background(), &c)
+			fatalIfErr(t, err)
+			var waits []func(context.Context) (*ctlog.SequencedLogEntry, error)
+			for range r.Intn(4) + 1 {
+				f, _ := l.AddLeafToPool(newEntry())
+				waits = append(waits, f)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Losing the lock is a fatal error, and being refused an
+				// upload fails the round, so the error is not interesting.
+				l.Sequence()
+				for _, wait := range waits {
+					if e, err := wait(context.Background()); err == nil {
+						won[i] = append(won[i], e)
+					}
+				}
+				if err := l.CloseCache(); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		var winners int
+		for _, entries := range won {
+			if len(entries) > 0 {
+				winners++
+			}
+			for _, e := range entries {
+				logged[e.LeafIndex] = e.Certificate
+			}
+		}
+		switch winners {
+		case 0:
+			lostRounds++
+			if lostRounds > 10*rounds {
+				t.Fatal("too many rounds lost by both sequencers")
+			}
+			continue
+		case 2:
+			t.Fatalf("round %d was won by both sequencers", round)
+		}
+		round++
+
+		lock, err := tl.Config.Lock.Fetch(context.Background(), logID)
+		fatalIfErr(t, err)
+		sth, err := backend.Fetch(context.Background(), "checkpoint")
+		fatalIfErr(t, err)
+		if !bytes.Equal(lock.Bytes(), sth) {
+			t.Fatalf("round %d: published checkpoint doesn't match the lock", round)
+		}
+		c, err := sunlight.ParseCheckpoint(string(sth[:bytes.Index(sth, []byte("\n\n"))+1]))
+		fatalIfErr(t, err)
+		if h, ok := published[c.N]; ok && h != c.Hash {
+			t.Fatalf("split tree: two checkpoints of size %d with different hashes", c.N)
+		}
+		published[c.N] = c.Hash
+	}
+	t.Logf("%d rounds lost by both sequencers", lostRounds)
+
+	overwritten, refused := backend.Overwrites()
+	for _, key := range overwritten {
+		t.Errorf("immutable object %q was overwritten", key)
+	}
+	t.Logf("%d overwrites of immutable objects were refused", refused)
+
+	tl.CheckLog()
+	sth, err := backend.Fetch(context.Background(), "checkpoint")
+	fatalIfErr(t, err)
+	c, err := sunlight.ParseCheckpoint(string(sth[:bytes.Index(sth, []byte("\n\n"))+1]))
+	fatalIfErr(t, err)
+	hr := tlog.TileHashReader(tlog.Tree{N: c.N, Hash: c.Hash}, (*tileReader)(tl))
+	for n, h := range published {
+		if got, err := tlog.TreeHash(n, hr); err != nil {
+			t.Errorf("couldn't compute the tree hash at size %d: %v", n, err)
+		} else if got != h {
+			t.Errorf("checkpoint of size %d is not a prefix of the final tree", n)
+		}
+	}
+	if int64(len(logged)) != c.N {
+		t.Errorf("%d entries got an SCT, tree size is %d", len(logged), c.N)
+	}
+	for idx, cert := range logged {
+		if e := entryAt(t, tl, idx); !bytes.Equal(e.Certificate, cert) {
+			t.Errorf("entry %d is not the one that got an SCT", idx)
+		}
+	}
+}
+
+// newMinIOBackend returns an S3Backend with conditional writes for the bucket
+// at the URL in -minio, under a unique prefix.
+func newMinIOBackend(t *testing.T) ctlog.Backend {
+	u, err := url.Parse(*minioFlag)
+	fatalIfErr(t, err)
+	bucket := strings.Trim(u.Path, "/")
+	u.Path = ""
+	prefix := fmt.Sprintf("%s/%d/", t.Name(), time.Now().UnixNano())
+	handler, _ := testLogHandler(t)
+	b, err := ctlog.NewS3Backend(context.Background(), "us-east-1", bucket, u.String(), prefix, slog.New(handler))
+	fatalIfErr(t, err)
+	f, err := ctlog.NewFeatures(map[string]bool{string(ctlog.FeatureConditionalWrites): true})
+	fatalIfErr(t, err)
+	b.SetFeatures(f)
+	return b
+}
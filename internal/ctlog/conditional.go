@@ -0,0 +1,128 @@
+package ctlog
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// A ConditionalBackend is a Backend that can skip transferring an object that
+// didn't change since a previous fetch, as identified by its ETag.
+//
+// If the Backend of a Log implements it, the monitoring API keeps the
+// checkpoint, the issuers, and recently served tiles in memory, and only
+// revalidates them against the backend.
+type ConditionalBackend interface {
+	Backend
+
+	// FetchIfNoneMatch is like Fetch, but returns ErrNotModified if the ETag
+	// of the object is still etag. It also returns the current ETag of the
+	// object, which might be empty if the backend doesn't provide one. An
+	// empty etag argument always fetches the object.
+	FetchIfNoneMatch(ctx context.Context, key, etag string) (data []byte, newETag string, err error)
+}
+
+// ErrNotModified is returned by [ConditionalBackend.FetchIfNoneMatch] if the
+// object didn't change.
+var ErrNotModified = errors.New("object not modified")
+
+// Objects larger than maxCachedObjectSize are not cached, and the cache is
+// cleared when it reaches maxCachedObjects entries. Together they bound the
+// cache to 64MiB, while holding the checkpoint, the issuers, and the hash
+// tiles any monitor needs to follow the log.
+const (
+	maxCachedObjects    = 1024
+	maxCachedObjectSize = 64 << 10
+)
+
+type cachedObject struct {
+	data []byte
+	// eTag and lastModified are the validators returned with data.
+	eTag         string
+	lastModified string
+}
+
+// objectCache keeps recently fetched objects along with their validators, for
+// conditional fetches.
+type objectCache struct {
+	mu      sync.Mutex
+	objects map[string]*cachedObject
+}
+
+func (c *objectCache) get(key string) *cachedObject {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.objects[key]
+}
+
+// put stores o, if it has a validator and it's small enough.
+func (c *objectCache) put(key string, o *cachedObject) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if (o.eTag == "" && o.lastModified == "") || len(o.data) > maxCachedObjectSize {
+		delete(c.objects, key)
+		return
+	}
+	if c.objects == nil || len(c.objects) >= maxCachedObjects {
+		c.objects = make(map[string]*cachedObject)
+	}
+	c.objects[key] = o
+}
+
+// fetchObject fetches key from the Backend for the monitoring API, with a
+// conditional request if it's cached and the Backend is a ConditionalBackend.
+// immutable objects are served from the cache without revalidation.
+//
+// Concurrent fetches of the same key, such as of the checkpoint or of the
+// newest partial tiles by many monitors at once, share a single backend
+// request. The returned data must not be modified.
+//
+// It returns the ETag of the object, if known.
+func (l *Log) fetchObject(ctx context.Context, key string, immutable bool) (data []byte, eTag string, err error) {
+	if _, ok := l.c.Backend.(ConditionalBackend); ok && immutable {
+		if cached := l.objects.get(key); cached != nil {
+			l.m.ObjectCacheRequests.WithLabelValues("backend", "hit").Inc()
+			return cached.data, cached.eTag, nil
+		}
+	}
+	var leader bool
+	v, err, _ := l.fetches.Do(key, func() (any, error) {
+		leader = true
+		// The result is shared by the coalesced requests, so it must not fail
+		// because the first one was canceled.
+		data, eTag, err := l.fetchObjectUncoalesced(context.WithoutCancel(ctx), key)
+		return &cachedObject{data: data, eTag: eTag}, err
+	})
+	if !leader {
+		l.m.ObjectCacheRequests.WithLabelValues("backend", "coalesced").Inc()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	o := v.(*cachedObject)
+	return o.data, o.eTag, nil
+}
+
+func (l *Log) fetchObjectUncoalesced(ctx context.Context, key string) (data []byte, eTag string, err error) {
+	b, ok := l.c.Backend.(ConditionalBackend)
+	if !ok {
+		data, err := l.c.Backend.Fetch(ctx, key)
+		return data, "", err
+	}
+	cached := l.objects.get(key)
+	var ifNoneMatch string
+	if cached != nil {
+		ifNoneMatch = cached.eTag
+	}
+	data, eTag, err = b.FetchIfNoneMatch(ctx, key, ifNoneMatch)
+	switch {
+	case errors.Is(err, ErrNotModified) && cached != nil:
+		l.m.ObjectCacheRequests.WithLabelValues("backend", "not_modified").Inc()
+		return cached.data, cached.eTag, nil
+	case err != nil:
+		return nil, "", err
+	}
+	l.m.ObjectCacheRequests.WithLabelValues("backend", "miss").Inc()
+	l.objects.put(key, &cachedObject{data: data, eTag: eTag})
+	return data, eTag, nil
+}
@@ -0,0 +1,98 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// conditionalBackend is a MemoryBackend with ETags, which counts the objects
+// it actually returns.
+type conditionalBackend struct {
+	*MemoryBackend
+	transfers atomic.Int64
+}
+
+func (b *conditionalBackend) FetchIfNoneMatch(ctx context.Context, key, etag string) ([]byte, string, error) {
+	data, err := b.Fetch(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	h := sha256.Sum256(data)
+	newETag := fmt.Sprintf(`"%x"`, h[:8])
+	if etag == newETag {
+		return nil, etag, ctlog.ErrNotModified
+	}
+	b.transfers.Add(1)
+	return data, newETag, nil
+}
+
+func TestConditionalFetch(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.MonitoringAPI = true
+	b := &conditionalBackend{MemoryBackend: tl.Config.Backend.(*MemoryBackend)}
+	tl.Config.Backend = b
+	for i := 0; i < tileWidth+5; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	h := tl.Log.Handler()
+
+	get := func(path, etag string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Result()
+	}
+	for _, path := range []string{"/checkpoint", "/tile/8/0/000"} {
+		start := b.transfers.Load()
+		res := get(path, "")
+		etag := res.Header.Get("ETag")
+		if res.StatusCode != http.StatusOK || etag == "" {
+			t.Fatalf("GET %s: got status %d, ETag %q", path, res.StatusCode, etag)
+		}
+		first, err := io.ReadAll(res.Body)
+		fatalIfErr(t, err)
+		res = get(path, "")
+		again, err := io.ReadAll(res.Body)
+		fatalIfErr(t, err)
+		if res.StatusCode != http.StatusOK || !bytes.Equal(first, again) {
+			t.Errorf("GET %s: cached response differs", path)
+		}
+		if res := get(path, etag); res.StatusCode != http.StatusNotModified {
+			t.Errorf("GET %s with If-None-Match: got status %d, expected 304", path, res.StatusCode)
+		}
+		if n := b.transfers.Load() - start; n != 1 {
+			t.Errorf("GET %s: backend transferred the object %d times, expected 1", path, n)
+		}
+	}
+
+	// A new checkpoint is fetched and gets a new ETag.
+	res := get("/checkpoint", "")
+	etag := res.Header.Get("ETag")
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	res = get("/checkpoint", etag)
+	if res.StatusCode != http.StatusOK || res.Header.Get("ETag") == etag {
+		t.Errorf("GET /checkpoint after sequencing: got status %d, ETag %q", res.StatusCode, res.Header.Get("ETag"))
+	}
+	got, err := io.ReadAll(res.Body)
+	fatalIfErr(t, err)
+	exp, err := b.Fetch(context.Background(), "checkpoint")
+	fatalIfErr(t, err)
+	if !bytes.Equal(got, exp) {
+		t.Errorf("GET /checkpoint after sequencing: got stale checkpoint")
+	}
+}
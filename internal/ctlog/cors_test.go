@@ -0,0 +1,78 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMonitoringAPI(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.MonitoringAPI = true
+	for i := 0; i < tileWidth+5; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	h := tl.Log.Handler()
+
+	get := func(method, path string) *http.Response {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr.Result()
+	}
+	for _, path := range []string{"/checkpoint", "/issuers.pem",
+		"/tile/8/0/000", "/tile/8/0/001.p/5", "/tile/8/data/000", "/tile/8/data/001.p/5"} {
+		res := get("GET", path)
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: got status %d", path, res.StatusCode)
+			continue
+		}
+		got, err := io.ReadAll(res.Body)
+		fatalIfErr(t, err)
+		exp, err := tl.Config.Backend.Fetch(context.Background(), path[1:])
+		fatalIfErr(t, err)
+		if !bytes.Equal(got, exp) {
+			t.Errorf("GET %s: got different contents than the backend", path)
+		}
+		if h := res.Header.Get("Access-Control-Allow-Origin"); h != "*" {
+			t.Errorf("GET %s: got Access-Control-Allow-Origin %q", path, h)
+		}
+	}
+	for _, path := range []string{"/tile/8/0/002", "/tile/8/0/x001", "/tile/4/0/000", "/tile/8/data/001"} {
+		if res := get("GET", path); res.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: got status %d, expected 404", path, res.StatusCode)
+		}
+	}
+	if res := get("OPTIONS", "/checkpoint"); res.StatusCode != http.StatusNoContent {
+		t.Errorf("OPTIONS /checkpoint: got status %d", res.StatusCode)
+	} else if h := res.Header.Get("Access-Control-Allow-Methods"); !strings.Contains(h, "GET") {
+		t.Errorf("OPTIONS /checkpoint: got Access-Control-Allow-Methods %q", h)
+	}
+
+	tl.Config.CORSOrigins = []string{"https://example.com"}
+	h = tl.Log.Handler()
+	req := httptest.NewRequest("GET", "/checkpoint", nil)
+	req.Header.Set("Origin", "https://example.com")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if h := rr.Result().Header.Get("Access-Control-Allow-Origin"); h != "https://example.com" {
+		t.Errorf("got Access-Control-Allow-Origin %q", h)
+	}
+	req.Header.Set("Origin", "https://example.net")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if h := rr.Result().Header.Get("Access-Control-Allow-Origin"); h != "" {
+		t.Errorf("got Access-Control-Allow-Origin %q for disallowed origin", h)
+	}
+
+	tl.Config.MonitoringAPI = false
+	h = tl.Log.Handler()
+	if res := get("GET", "/checkpoint"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /checkpoint with MonitoringAPI disabled: got status %d", res.StatusCode)
+	}
+}
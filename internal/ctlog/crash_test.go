@@ -0,0 +1,87 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"filippo.io/sunlight"
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+// TestCrashRecovery crashes the sequencer at each crash point, and checks that
+// the log reloads from the backends, and keeps growing consistently.
+func TestCrashRecovery(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		point ctlog.CrashPoint
+		key   string // prefix of the upload key, for CrashPointUpload
+		// committed is whether the crashed round is part of the log after
+		// the restart, because it was committed to the lock backend.
+		committed bool
+	}{
+		{"DataTileUpload", ctlog.CrashPointUpload, "tile/8/data/", false},
+		{"HashTileUpload", ctlog.CrashPointUpload, "tile/8/0/", false},
+		{"TilesUploaded", ctlog.CrashPointTilesUploaded, "", false},
+		{"CheckpointSigned", ctlog.CrashPointCheckpointSigned, "", false},
+		{"LockReplaced", ctlog.CrashPointLockReplaced, "", true},
+		{"CheckpointUpload", ctlog.CrashPointUpload, "checkpoint", true},
+		{"CheckpointUploaded", ctlog.CrashPointCheckpointUploaded, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tl := NewEmptyTestLog(t)
+			tl.Quiet()
+			var count uint64
+			add := func() {
+				count++
+				cert := binary.BigEndian.AppendUint64([]byte("crash"), count)
+				tl.Log.AddLeafToPool(&ctlog.LogEntry{Certificate: cert})
+			}
+			// Start a few entries short of a full tile, so that the crashed
+			// round uploads both a full and a partial data tile.
+			size := int64(tileWidth - 3)
+			for range size {
+				add()
+			}
+			fatalIfErr(t, tl.Log.Sequence())
+			tl.CheckLog()
+
+			var crashed bool
+			ctlog.SetCrashPoint(t, func(p ctlog.CrashPoint, key string) error {
+				if crashed || p != tc.point || !strings.HasPrefix(key, tc.key) {
+					return nil
+				}
+				crashed = true
+				return errors.New("crash")
+			})
+			for range 10 {
+				add()
+			}
+			if err := tl.Log.Sequence(); err == nil || !crashed {
+				t.Fatalf("sequencing didn't crash: %v", err)
+			}
+			if tc.committed {
+				size += 10
+			}
+
+			// Restart from the backends, abandoning the crashed Log.
+			tl = ReloadLog(t, tl)
+			for range 5 {
+				addCertificate(t, tl)
+			}
+			fatalIfErr(t, tl.Log.Sequence())
+			size += 5
+			tl.CheckLog()
+			sth, err := tl.Config.Backend.Fetch(context.Background(), "checkpoint")
+			fatalIfErr(t, err)
+			c, err := sunlight.ParseCheckpoint(string(sth[:bytes.Index(sth, []byte("\n\n"))+1]))
+			fatalIfErr(t, err)
+			if c.N != size {
+				t.Errorf("tree size after restart is %d, expected %d", c.N, size)
+			}
+		})
+	}
+}
@@ -5,16 +5,19 @@ import (
 	"context"
 	"crypto"
 	"crypto/ecdsa"
+	cryptorand "crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"log/slog"
 	"maps"
 	"math"
-	"math/rand"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"crawshaw.io/sqlite"
@@ -22,12 +25,14 @@ import (
 	"filippo.io/sunlight/internal/rfc6979"
 	"filippo.io/sunlight/internal/tlogx"
 	ct "github.com/google/certificate-transparency-go"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
 	"github.com/google/certificate-transparency-go/x509util"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/crypto/cryptobyte"
 	"golang.org/x/mod/sumdb/note"
 	"golang.org/x/mod/sumdb/tlog"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 type Log struct {
@@ -40,26 +45,96 @@ type Log struct {
 	lockCheckpoint LockedCheckpoint
 	// edgeTiles is a map from level to the right-most tile of that level.
 	edgeTiles map[int]tileWithBytes
+	// seqFailures is the number of consecutive failed sequencing rounds, and
+	// publishedAt the time of the latest checkpoint upload, in milliseconds.
+	seqFailures int
+	publishedAt int64
+	mmdAlerted  bool
+	// lockUpdated is when lockCheckpoint was last replaced or loaded.
+	lockUpdated time.Time
 	// cacheWrite is used to update the deduplication cache at the end of each
 	// sequencing batch, before inSequencing and currentPool are rotated.
 	cacheWrite *sqlite.Conn
 
-	// poolMu is held for the entire duration of addLeafToPool, and by
-	// RunSequencer while rotating currentPool and inSequencing.
+	// The lock of the cache hash shard of a leaf is held for the entire
+	// duration of addLeafToPool, and all of them are held by RunSequencer
+	// while rotating currentPool and inSequencing.
 	// This guarantees that addLeafToPool will never add to a pool that already
 	// started sequencing, and that cacheRead will see entries from older pools
 	// before they are rotated out of inSequencing.
+	shards [cacheShards]cacheShard
+	// poolMu is held while appending to currentPool.pendingLeaves, inside
+	// a shard lock, and by RunSequencer after all the shard locks.
 	poolMu      sync.Mutex
 	currentPool *pool
-	// inSequencing is the pool.byHash map of the pool that's currently being
-	// sequenced. These entries might not be sequenced yet or might not yet be
-	// committed to the deduplication cache.
-	inSequencing map[cacheHash]waitEntryFunc
-	// cacheRead is used to check the deduplication cache under poolMu.
-	cacheRead *sqlite.Conn
 
 	issuersMu sync.RWMutex
 	issuers   *x509util.PEMCertPool
+
+	// roots is the set of accepted roots, initialized from Config.Roots and
+	// replaced by SetRoots.
+	roots atomic.Pointer[rootSet]
+
+	// chains caches verified intermediate chains.
+	chains *chainCache
+
+	// clockSkew is the reason the clock is believed to be inaccurate, if any.
+	clockSkew atomic.Pointer[string]
+
+	// rand is the source of the random choices of the log, seeded by
+	// Config.Seed.
+	rand *lockedRand
+
+	// validations limits the concurrent chain validations, if
+	// Config.MaxConcurrentValidations is not zero.
+	validations chan struct{}
+
+	// signQueue holds SCTs waiting for a signing worker, if
+	// Config.SigningWorkers is not zero. It's initialized by signOnce.
+	signOnce  sync.Once
+	signQueue chan *signRequest
+
+	// auditBuf holds audit records until RunAuditLog uploads them.
+	auditBuf auditBuffer
+
+	// seqState is a snapshot of the sequencer state for DebugState, and
+	// uploads and dedupStats are counters reported by it.
+	seqState   atomic.Pointer[sequencerState]
+	uploads    atomic.Int64
+	dedupStats struct{ pool, cache, misses atomic.Int64 }
+
+	// checkpoints broadcasts published checkpoints to event stream clients,
+	// and entries the sequenced entries to Subscribe callers.
+	checkpoints checkpointFeed
+	entries     entryFeed
+
+	// monitorTree is the latest tree verified by CheckPublished.
+	monitorMu   sync.Mutex
+	monitorTree tlog.Tree
+	// monitorObjects and objects cache the objects fetched by the
+	// self-monitor and by the monitoring API, for conditional fetches.
+	monitorObjects objectCache
+	objects        objectCache
+	// fetches coalesces the concurrent backend fetches of the same object by
+	// the monitoring API.
+	fetches singleflight.Group
+
+	// maintenance is the maintenance mode message, or nil if the log is not in
+	// maintenance mode.
+	maintenance atomic.Pointer[string]
+
+	// passive is set by SetPassive while another instance sequences the log.
+	passive atomic.Bool
+
+	// poolSize is initialized from Config.PoolSize and replaced by
+	// SetPoolSize. state is set by SetState, and if nil Config.State and
+	// Config.StateTimestamp are used instead.
+	poolSize atomic.Int64
+	state    atomic.Pointer[logState]
+
+	// sequencerProgress is the time in Unix nanoseconds when RunSequencer
+	// started, or last completed a round.
+	sequencerProgress atomic.Int64
 }
 
 type treeWithTimestamp struct {
@@ -77,8 +152,18 @@ func (t tileWithBytes) String() string {
 }
 
 type Config struct {
-	Name     string
-	Key      *ecdsa.PrivateKey
+	Name string
+
+	// Key is the log signing key, which must be an ECDSA P-256 key. It is
+	// usually an *ecdsa.PrivateKey, but can be any crypto.Signer such as a
+	// [KMSSigner].
+	Key crypto.Signer
+
+	// CheckpointSigners are additional signers that cosign every checkpoint,
+	// such as an Ed25519 key for compatibility with witnesses, or the next log
+	// key during a rotation. Their names don't need to match Name. Optional.
+	CheckpointSigners []note.Signer
+
 	PoolSize int
 	Cache    string
 
@@ -86,9 +171,151 @@ type Config struct {
 	Lock    LockBackend
 	Log     *slog.Logger
 
+	// Alerter, if not nil, is notified of operational events such as failed
+	// sequencing rounds and signer errors.
+	Alerter Alerter
+
+	// Clock is the source of SCT and checkpoint timestamps. If nil, the
+	// system clock is used. See also [FakeClock].
+	Clock Clock
+
+	// Seed seeds the random choices of the log, such as the sequencer
+	// stagger, the self-monitor tile samples, and the Retry-After values, so
+	// that a failure can be replayed. If zero, a random seed is used. Either
+	// way, the seed is logged by LoadLog.
+	Seed int64
+
+	// Roots is the initial set of accepted roots. It can be replaced with
+	// [Log.SetRoots] and must not be modified after LoadLog.
 	Roots         *x509util.PEMCertPool
 	NotAfterStart time.Time
 	NotAfterLimit time.Time
+
+	// DeniedRoots are SHA-256 hashes of the SubjectPublicKeyInfo of roots that
+	// are not accepted, even if present in Roots or TestRoots.
+	DeniedRoots [][sha256.Size]byte
+
+	// TestRoots are roots accepted only for submissions that carry the
+	// TestSubmissionHeader with the value TestRootsToken, for canary
+	// submissions. They are not listed by get-roots. If TestRootsToken is
+	// empty, TestRoots are never accepted.
+	TestRoots      *x509util.PEMCertPool
+	TestRootsToken string
+
+	// CrossSigned are additional intermediates, such as cross-signed ones,
+	// used to build an alternate path to an accepted root if the submitted
+	// chain doesn't verify as is. Optional.
+	CrossSigned *x509util.PEMCertPool
+
+	// SigningWorkers is the number of goroutines that sign SCTs. If zero,
+	// SCTs are signed by the HTTP handlers directly, which is best for local
+	// keys. For remote signers with multi-millisecond latency, a bounded pool
+	// of workers limits the concurrent requests, and allows batching if Key
+	// implements [BatchSigner].
+	SigningWorkers int
+
+	// SigningQueueSize is the maximum number of SCTs waiting to be signed by
+	// the SigningWorkers. Further add-[pre-]chain requests are rejected with a
+	// 503. If zero, it defaults to 64 times SigningWorkers.
+	SigningQueueSize int
+
+	// MaxConcurrentValidations is the maximum number of add-[pre-]chain
+	// requests that read, parse, and validate their chain at the same time.
+	// Further requests wait for a slot, and fail with a 503 if
+	// SubmissionTimeout expires first. Zero means no limit.
+	MaxConcurrentValidations int
+
+	// SubmissionTimeout is the deadline of add-[pre-]chain requests,
+	// including the wait for the chain validation and sequencing. Requests
+	// that exceed it fail with a 503. Zero means no deadline, other than the
+	// HTTP server timeouts.
+	SubmissionTimeout time.Duration
+
+	// Dedup selects how submissions are deduplicated. The default is
+	// DedupLeaf.
+	Dedup DedupMode
+
+	// LoggedPrecert selects what happens to a certificate whose
+	// precertificate was already logged, if Dedup is DedupTBS. The default is
+	// LoggedPrecertLog.
+	LoggedPrecert LoggedPrecertAction
+
+	// Audit enables the submission audit log, an append-only record of every
+	// accepted submission, independent of the tree contents. Records are
+	// uploaded to the Backend under the audit/ prefix by [Log.RunAuditLog].
+	Audit bool
+
+	// ClientIPHeader is a request header, such as Fly-Client-IP or
+	// X-Forwarded-For, set by a trusted proxy to the IP address of the client,
+	// for the audit log. If empty, the connection address is used.
+	ClientIPHeader string
+
+	// LatencyMetrics selects the type of the latency metrics. The default is
+	// LatencySummaries.
+	LatencyMetrics LatencyMetricsMode
+
+	// TraceExemplars attaches the trace ID of the W3C traceparent header of
+	// requests as an exemplar to the HTTP request, add-[pre-]chain, and
+	// sequencing latency histograms. A sequencing round is linked to the trace
+	// of one of the requests it sequenced. Exemplars are not supported by
+	// LatencySummaries.
+	TraceExemplars bool
+
+	// MaxChainLength is the maximum number of certificates in a submitted
+	// chain, and MaxCertificateSize the maximum size in bytes of each DER
+	// certificate. Zero means no limit.
+	MaxChainLength     int
+	MaxCertificateSize int
+
+	// RejectExpired and RejectNotYetValid reject leaves whose validity period
+	// ended or has not started yet, respectively, allowing for ClockSkew.
+	RejectExpired     bool
+	RejectNotYetValid bool
+	ClockSkew         time.Duration
+
+	// MaxValidity rejects leaves with a longer validity period, such as 398
+	// days for the CA/Browser Forum Baseline Requirements. Zero means no
+	// limit.
+	MaxValidity time.Duration
+
+	// MinRSAKeySize rejects leaves and intermediates with RSA keys smaller
+	// than this many bits. RejectSHA1 rejects leaves and intermediates signed
+	// with SHA-1, and RejectSignatureAlgorithms with any of the listed
+	// algorithms.
+	MinRSAKeySize             int
+	RejectSHA1                bool
+	RejectSignatureAlgorithms []ctx509.SignatureAlgorithm
+
+	// RejectPrecertSigningCerts rejects precertificates issued by a
+	// Precertificate Signing Certificate (RFC 6962, Section 3.1).
+	RejectPrecertSigningCerts bool
+
+	// Policy, if not nil, is consulted for every submission with a valid
+	// chain, and can reject it.
+	Policy SubmissionPolicy
+
+	// MonitoringAPI enables serving the checkpoint, tiles, and issuers bundle
+	// from the Backend through Handler, in addition to the submission API.
+	MonitoringAPI bool
+
+	// TileStore, if not nil, keeps the tiles uploaded by the sequencer and
+	// fetched by the monitoring API, which serves them from it when present.
+	TileStore *TileStore
+
+	// CORSOrigins are the origins allowed to fetch from the read endpoints. If
+	// empty, all origins are allowed.
+	CORSOrigins []string
+
+	// Description, SubmissionURL, MonitoringURL, MMD, State, and
+	// StateTimestamp are advertised in the log.v3.json metadata document,
+	// using the format of the Google and Apple log lists. All are optional.
+	// Description defaults to Name, and MMD to 24 hours.
+	Description    string
+	SubmissionURL  string
+	MonitoringURL  string
+	MMD            time.Duration
+	State          string
+	StateTimestamp time.Time
 }
 
 var ErrLogExists = errors.New("checkpoint already exist, refusing to initialize log")
@@ -107,13 +334,10 @@ func CreateLog(ctx context.Context, config *Config) error {
 		return fmt.Errorf("checkpoint missing from database but present in object storage")
 	}
 
-	cacheRead, cacheWrite, err := initCache(config.Cache)
+	_, cacheWrite, err := initCache(config.Cache, 0)
 	if err != nil {
 		return fmt.Errorf("couldn't initialize cache database: %w", err)
 	}
-	if err := cacheRead.Close(); err != nil {
-		return fmt.Errorf("couldn't close cache database: %w", err)
-	}
 	if err := cacheWrite.Close(); err != nil {
 		return fmt.Errorf("couldn't close cache database: %w", err)
 	}
@@ -122,9 +346,9 @@ func CreateLog(ctx context.Context, config *Config) error {
 		return fmt.Errorf("couldn't upload issuers.pem: %w", err)
 	}
 
-	timestamp := timeNowUnixMilli()
+	timestamp := config.clock().NowUnixMilli()
 	tree := treeWithTimestamp{tlog.Tree{}, timestamp}
-	checkpoint, err := signTreeHead(config.Name, logID, config.Key, tree)
+	checkpoint, err := signTreeHead(config.Name, logID, config.Key, config.CheckpointSigners, tree)
 	if err != nil {
 		return fmt.Errorf("couldn't sign empty tree head: %w", err)
 	}
@@ -141,13 +365,16 @@ func CreateLog(ctx context.Context, config *Config) error {
 	return nil
 }
 
-func LoadLog(ctx context.Context, config *Config) (*Log, error) {
-	pkix, err := x509.MarshalPKIXPublicKey(config.Key.Public())
-	if err != nil {
-		return nil, fmt.Errorf("couldn't marshal public key: %w", err)
-	}
-	logID := sha256.Sum256(pkix)
+// treeState is the state of a log loaded from the lock and object storage
+// backends by LoadLog and Resync.
+type treeState struct {
+	tree      treeWithTimestamp
+	lock      LockedCheckpoint
+	edgeTiles map[int]tileWithBytes
+	issuers   *x509util.PEMCertPool
+}
 
+func loadTreeState(ctx context.Context, config *Config, logID [sha256.Size]byte) (*treeState, error) {
 	lock, err := config.Lock.Fetch(ctx, logID)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't fetch checkpoint from lock database: %w", err)
@@ -168,7 +395,7 @@ func LoadLog(ctx context.Context, config *Config) (*Log, error) {
 		return nil, fmt.Errorf("couldn't parse checkpoint: %w", err)
 	}
 
-	if now := timeNowUnixMilli(); now < timestamp {
+	if now := config.clock().NowUnixMilli(); now < timestamp {
 		return nil, fmt.Errorf("current time %d is before checkpoint time %d", now, timestamp)
 	}
 	if c.Origin != config.Name {
@@ -224,11 +451,6 @@ func LoadLog(ctx context.Context, config *Config) (*Log, error) {
 		return nil, errors.New("invalid issuers.pem")
 	}
 
-	cacheRead, cacheWrite, err := initCache(config.Cache)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't initialize cache database: %w", err)
-	}
-
 	edgeTiles := make(map[int]tileWithBytes)
 	if c.N > 0 {
 		// Fetch the right-most edge tiles by reading the last leaf.
@@ -281,33 +503,76 @@ func LoadLog(ctx context.Context, config *Config) (*Log, error) {
 		config.Log.DebugContext(ctx, "edge tile", "tile", t)
 	}
 
+	return &treeState{
+		tree:      treeWithTimestamp{c.Tree, timestamp},
+		lock:      lock,
+		edgeTiles: edgeTiles,
+		issuers:   issuers,
+	}, nil
+}
+
+func LoadLog(ctx context.Context, config *Config) (*Log, error) {
+	pkix, err := x509.MarshalPKIXPublicKey(config.Key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal public key: %w", err)
+	}
+	logID := sha256.Sum256(pkix)
+
+	st, err := loadTreeState(ctx, config, logID)
+	if err != nil {
+		return nil, err
+	}
+	c, timestamp, issuers := st.tree.Tree, st.tree.Time, st.issuers
+
+	cacheRead, cacheWrite, err := initCache(config.Cache, cacheShards)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialize cache database: %w", err)
+	}
+
+	seed := config.Seed
+	if seed == 0 {
+		seed = RandomSeed()
+	}
 	config.Log.InfoContext(ctx, "loaded log", "logID", base64.StdEncoding.EncodeToString(logID[:]),
-		"size", c.N, "timestamp", timestamp, "issuers", len(issuers.RawCertificates()))
+		"size", c.N, "timestamp", timestamp, "issuers", len(issuers.RawCertificates()),
+		"seed", seed)
 
-	m := initMetrics()
+	m := initMetrics(config.LatencyMetrics)
 	m.TreeSize.Set(float64(c.N))
 	m.TreeTime.Set(float64(timestamp))
 	m.Issuers.Set(float64(len(issuers.RawCertificates())))
-	m.ConfigRoots.Set(float64(len(config.Roots.RawCertificates())))
 	m.ConfigStart.Set(float64(config.NotAfterStart.Unix()))
 	m.ConfigEnd.Set(float64(config.NotAfterLimit.Unix()))
 
-	return &Log{
+	l := &Log{
 		c:              config,
 		logID:          logID,
 		m:              m,
-		tree:           treeWithTimestamp{c.Tree, timestamp},
-		lockCheckpoint: lock,
-		edgeTiles:      edgeTiles,
-		cacheRead:      cacheRead,
+		tree:           st.tree,
+		lockCheckpoint: st.lock,
+		edgeTiles:      st.edgeTiles,
+		publishedAt:    timestamp,
+		lockUpdated:    time.Now(),
 		currentPool:    newPool(),
 		cacheWrite:     cacheWrite,
 		issuers:        issuers,
-	}, nil
+		chains:         newChainCache(),
+		rand:           newLockedRand(seed),
+	}
+	for i := range l.shards {
+		l.shards[i].cacheRead = cacheRead[i]
+	}
+	if config.MaxConcurrentValidations > 0 {
+		l.validations = make(chan struct{}, config.MaxConcurrentValidations)
+	}
+	roots := l.newRootSet(config.Roots)
+	l.roots.Store(roots)
+	m.ConfigRoots.Set(float64(len(roots.accepted.RawCertificates())))
+	l.poolSize.Store(int64(config.PoolSize))
+	l.storeSequencerState(nil)
+	return l, nil
 }
 
-var timeNowUnixMilli = func() int64 { return time.Now().UnixMilli() }
-
 // Backend is a strongly consistent object storage.
 //
 // It is dedicated to a single log instance.
@@ -337,10 +602,27 @@ type UploadOptions struct {
 
 	// Immutable is true if the data is never updated after being uploaded.
 	Immutable bool
+
+	// Class is the kind of object, which can select backend settings such
+	// as the compression level. If empty, defaults to ObjectClassOther.
+	Class ObjectClass
 }
 
+// ObjectClass is a kind of uploaded object. See [UploadOptions.Class].
+type ObjectClass string
+
+const (
+	ObjectClassDataTile ObjectClass = "data-tiles"
+	ObjectClassAudit    ObjectClass = "audit"
+	ObjectClassOther    ObjectClass = "other"
+)
+
+// Hash tiles are not compressed: they are concatenated SHA-256 hashes, which
+// no compression scheme, with or without a dictionary, can shrink. The
+// checkpoint is a few hundred bytes of mostly base64, and it's fetched by
+// clients that only support the standard Content-Encoding values.
 var optsHashTile = &UploadOptions{Immutable: true}
-var optsDataTile = &UploadOptions{Compress: true, Immutable: true}
+var optsDataTile = &UploadOptions{Compress: true, Immutable: true, Class: ObjectClassDataTile}
 var optsText = &UploadOptions{ContentType: "text/plain; charset=utf-8"}
 
 // A LockBackend is a database that supports compare-and-swap operations.
@@ -420,27 +702,85 @@ func (e *LogEntry) SignedEntry() []byte {
 	//     } signed_entry;
 	// } SignedEntry;
 
-	b := &cryptobyte.Builder{}
+	return e.appendSignedEntry(make([]byte, 0, e.signedEntryLen()))
+}
+
+func (e *LogEntry) signedEntryLen() int {
+	n := 2 + 3 + len(e.Certificate)
+	if e.IsPrecert {
+		n += len(e.IssuerKeyHash)
+	}
+	return n
+}
+
+func (e *LogEntry) appendSignedEntry(b []byte) []byte {
+	b = e.appendSignedEntryHeader(b)
+	return append(b, e.Certificate...)
+}
+
+// signedEntryHeaderMaxLen is the maximum output length of
+// appendSignedEntryHeader.
+const signedEntryHeaderMaxLen = 2 + 32 + 3
+
+// appendSignedEntryHeader appends the SignedEntry up to the certificate, so
+// that the latter can be hashed or copied without an intermediate buffer.
+func (e *LogEntry) appendSignedEntryHeader(b []byte) []byte {
+	if len(e.Certificate) >= 1<<24 {
+		panic("ctlog: certificate too large")
+	}
 	if !e.IsPrecert {
-		b.AddUint16(0 /* entry_type = x509_entry */)
-		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
-			b.AddBytes(e.Certificate)
-		})
+		b = binary.BigEndian.AppendUint16(b, 0 /* entry_type = x509_entry */)
 	} else {
-		b.AddUint16(1 /* entry_type = precert_entry */)
-		b.AddBytes(e.IssuerKeyHash[:])
-		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
-			b.AddBytes(e.Certificate)
-		})
+		b = binary.BigEndian.AppendUint16(b, 1 /* entry_type = precert_entry */)
+		b = append(b, e.IssuerKeyHash[:]...)
 	}
-	return b.BytesOrPanic()
+	return appendUint24(b, len(e.Certificate))
 }
 
+// DedupMode selects how submissions are recognized as already logged.
+type DedupMode int
+
+const (
+	// DedupLeaf deduplicates submissions of the same entry. A certificate is
+	// always a new entry, even if its precertificate was already logged.
+	DedupLeaf DedupMode = iota
+
+	// DedupTBS additionally recognizes certificates whose precertificate was
+	// already logged, by matching the TBSCertificate (excluding the embedded
+	// SCT list) and the issuer, and handles them according to
+	// Config.LoggedPrecert.
+	//
+	// Only precertificates logged while DedupTBS is in effect are recognized.
+	DedupTBS
+)
+
+// LoggedPrecertAction selects what happens to a certificate whose
+// precertificate was already logged, with DedupTBS.
+type LoggedPrecertAction int
+
+const (
+	// LoggedPrecertLog logs the certificate as a new entry, like DedupLeaf.
+	LoggedPrecertLog LoggedPrecertAction = iota
+
+	// LoggedPrecertReject rejects the certificate, since the precertificate
+	// entry already makes it publicly discoverable.
+	LoggedPrecertReject
+
+	// LoggedPrecertSCT returns the SCT of the precertificate entry instead of
+	// logging the certificate. Note that the SCT is over the precert_entry,
+	// so it doesn't verify as an SCT for the certificate itself.
+	LoggedPrecertSCT
+)
+
 type cacheHash [16]byte // birthday bound of 2⁴⁸ entries with collision chance 2⁻³²
 
 func (e *LogEntry) cacheHash() cacheHash {
-	h := sha256.Sum256(e.SignedEntry())
-	return cacheHash(h[:16])
+	var header [signedEntryHeaderMaxLen]byte
+	h := sha256.New()
+	h.Write(e.appendSignedEntryHeader(header[:0]))
+	h.Write(e.Certificate)
+	var sum [sha256.Size]byte
+	return cacheHash(h.Sum(sum[:0])[:16])
 }
 
 type SequencedLogEntry struct {
@@ -451,15 +791,21 @@ type SequencedLogEntry struct {
 
 // MerkleTreeLeaf returns a RFC 6962 MerkleTreeLeaf.
 func (e *SequencedLogEntry) MerkleTreeLeaf() []byte {
-	b := &cryptobyte.Builder{}
-	b.AddUint8(0 /* version = v1 */)
-	b.AddUint8(0 /* leaf_type = timestamped_entry */)
-	b.AddUint64(uint64(e.Timestamp))
-	b.AddBytes(e.SignedEntry())
-	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-		b.AddBytes(e.Extensions())
-	})
-	return b.BytesOrPanic()
+	return e.AppendMerkleTreeLeaf(make([]byte, 0, e.merkleTreeLeafLen()))
+}
+
+func (e *SequencedLogEntry) merkleTreeLeafLen() int {
+	return 1 + 1 + 8 + e.signedEntryLen() + 2 + extensionsLen
+}
+
+// AppendMerkleTreeLeaf appends the output of MerkleTreeLeaf to b.
+func (e *SequencedLogEntry) AppendMerkleTreeLeaf(b []byte) []byte {
+	b = slices.Grow(b, e.merkleTreeLeafLen())
+	b = append(b, 0 /* version = v1 */, 0 /* leaf_type = timestamped_entry */)
+	b = binary.BigEndian.AppendUint64(b, uint64(e.Timestamp))
+	b = e.appendSignedEntry(b)
+	b = binary.BigEndian.AppendUint16(b, extensionsLen)
+	return e.appendExtensions(b)
 }
 
 // Extensions returns the custom structure that's encoded in the
@@ -479,12 +825,16 @@ func (e *SequencedLogEntry) Extensions() []byte {
 	// uint8 uint40[5];
 	// uint40 LeafIndex;
 
-	b := &cryptobyte.Builder{}
-	b.AddUint8(0 /* extension_type = leaf_index */)
-	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-		addUint40(b, uint64(e.LeafIndex))
-	})
-	return b.BytesOrPanic()
+	return e.appendExtensions(make([]byte, 0, extensionsLen))
+}
+
+// extensionsLen is the length of the output of Extensions.
+const extensionsLen = 1 + 2 + 5
+
+func (e *SequencedLogEntry) appendExtensions(b []byte) []byte {
+	v := uint64(e.LeafIndex)
+	return append(b, 0 /* extension_type = leaf_index */, 0, 5,
+		byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
 }
 
 func ParseExtensions(extensions []byte) (leafIndex int64, err error) {
@@ -508,6 +858,11 @@ func ParseExtensions(extensions []byte) (leafIndex int64, err error) {
 
 // TileLeaf returns the custom structure that's encoded in data tiles.
 func (e *SequencedLogEntry) TileLeaf() []byte {
+	return e.AppendTileLeaf(nil)
+}
+
+// AppendTileLeaf appends the output of TileLeaf to b, such as a data tile.
+func (e *SequencedLogEntry) AppendTileLeaf(b []byte) []byte {
 	// struct {
 	//     TimestampedEntry timestamped_entry;
 	//     select(entry_type) {
@@ -521,26 +876,36 @@ func (e *SequencedLogEntry) TileLeaf() []byte {
 	//     opaque PrecertificateSigningCertificate<0..2^24-1>;
 	// } PreCertExtraData;
 
-	b := &cryptobyte.Builder{}
-	b.AddUint64(uint64(e.Timestamp))
-	b.AddBytes(e.SignedEntry())
-	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-		b.AddBytes(e.Extensions())
-	})
+	b = slices.Grow(b, e.tileLeafLen())
+	b = binary.BigEndian.AppendUint64(b, uint64(e.Timestamp))
+	b = e.appendSignedEntry(b)
+	b = binary.BigEndian.AppendUint16(b, extensionsLen)
+	b = e.appendExtensions(b)
 	if e.IsPrecert {
-		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
-			b.AddBytes(e.PreCertificate)
-		})
-		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
-			b.AddBytes(e.PrecertSigningCert)
-		})
+		if len(e.PreCertificate) >= 1<<24 || len(e.PrecertSigningCert) >= 1<<24 {
+			panic("ctlog: certificate too large")
+		}
+		b = appendUint24(b, len(e.PreCertificate))
+		b = append(b, e.PreCertificate...)
+		b = appendUint24(b, len(e.PrecertSigningCert))
+		b = append(b, e.PrecertSigningCert...)
 	}
-	return b.BytesOrPanic()
+	return b
+}
+
+func (e *SequencedLogEntry) tileLeafLen() int {
+	n := 8 + e.signedEntryLen() + 2 + extensionsLen
+	if e.IsPrecert {
+		n += 3 + len(e.PreCertificate) + 3 + len(e.PrecertSigningCert)
+	}
+	return n
 }
 
 type pool struct {
 	pendingLeaves []*LogEntry
-	byHash        map[cacheHash]waitEntryFunc
+	// byHash is indexed by cacheHash.shard, and each map is guarded by the
+	// lock of its shard.
+	byHash [cacheShards]map[cacheHash]waitEntryFunc
 
 	// done is closed when the pool has been sequenced and
 	// the results below are ready.
@@ -554,35 +919,54 @@ type pool struct {
 	// "The timestamp MUST be at least as recent as the most recent SCT
 	// timestamp in the tree." RFC 6962, Section 3.5.
 	timestamp int64
+	// timestamps, if not nil, are the timestamps of pendingLeaves, which are
+	// imported from another log by ImportEntries.
+	timestamps []int64
+
+	// traceID is the trace ID of the first request added to the pool that
+	// carried one, used as an exemplar for the sequencing duration.
+	traceID string
 }
 
 type waitEntryFunc func(ctx context.Context) (*SequencedLogEntry, error)
 
 func newPool() *pool {
-	return &pool{
-		done:   make(chan struct{}),
-		byHash: make(map[cacheHash]waitEntryFunc),
+	p := &pool{done: make(chan struct{})}
+	for i := range p.byHash {
+		p.byHash[i] = make(map[cacheHash]waitEntryFunc)
 	}
+	return p
 }
 
 var errPoolFull = fmtErrorf("rate limited")
 
+// SetPoolSize replaces Config.PoolSize, the maximum number of entries pending
+// in the sequencing pool. Zero means no limit. Entries already in the pool are
+// not affected.
+func (l *Log) SetPoolSize(n int) {
+	if old := l.poolSize.Swap(int64(n)); old != int64(n) {
+		l.c.Log.Info("pool size changed", "old", old, "new", n)
+	}
+}
+
 // addLeafToPool adds leaf to the current pool, unless it is found in a
 // deduplication cache. It returns a function that will wait until the pool is
 // sequenced and return the sequenced leaf, as well as the source of the
 // sequenced leaf (pool or cache if deduplicated, sequencer otherwise).
-func (l *Log) addLeafToPool(leaf *LogEntry) (f waitEntryFunc, source string) {
-	l.poolMu.Lock()
-	defer l.poolMu.Unlock()
-	p := l.currentPool
+func (l *Log) addLeafToPool(ctx context.Context, leaf *LogEntry) (f waitEntryFunc, source string) {
 	h := leaf.cacheHash()
-	if f, ok := p.byHash[h]; ok {
+	s := &l.shards[h.shard()]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// currentPool is only replaced while holding all the shard locks.
+	p := l.currentPool
+	if f, ok := p.byHash[h.shard()][h]; ok {
 		return f, "pool"
 	}
-	if f, ok := l.inSequencing[h]; ok {
+	if f, ok := s.inSequencing[h]; ok {
 		return f, "pool"
 	}
-	if leaf, err := l.cacheGet(leaf); err != nil {
+	if leaf, err := l.cacheGet(s, leaf, h); err != nil {
 		return func(ctx context.Context) (*SequencedLogEntry, error) {
 			return nil, fmtErrorf("deduplication cache get failed: %w", err)
 		}, "cache"
@@ -591,13 +975,19 @@ func (l *Log) addLeafToPool(leaf *LogEntry) (f waitEntryFunc, source string) {
 			return leaf, nil
 		}, "cache"
 	}
+	l.poolMu.Lock()
 	n := len(p.pendingLeaves)
-	if l.c.PoolSize > 0 && n >= l.c.PoolSize {
+	if limit := l.poolSize.Load(); limit > 0 && int64(n) >= limit {
+		l.poolMu.Unlock()
 		return func(ctx context.Context) (*SequencedLogEntry, error) {
 			return nil, errPoolFull
 		}, "ratelimit"
 	}
 	p.pendingLeaves = append(p.pendingLeaves, leaf)
+	if p.traceID == "" {
+		p.traceID = traceID(ctx)
+	}
+	l.poolMu.Unlock()
 	f = func(ctx context.Context) (*SequencedLogEntry, error) {
 		select {
 		case <-ctx.Done():
@@ -616,7 +1006,7 @@ func (l *Log) addLeafToPool(leaf *LogEntry) (f waitEntryFunc, source string) {
 			}, nil
 		}
 	}
-	p.byHash[h] = f
+	p.byHash[h.shard()][h] = f
 	return f, "sequencer"
 }
 
@@ -629,8 +1019,10 @@ func (l *Log) RunSequencer(ctx context.Context, period time.Duration) (err error
 		close(l.currentPool.done)
 	}()
 
+	l.sequencerProgress.Store(time.Now().UnixNano())
+
 	// Randomly stagger the sequencers to avoid conflicting for resources.
-	time.Sleep(time.Duration(rand.Int63n(int64(period))))
+	time.Sleep(time.Duration(l.rand.Int63n(int64(period))))
 
 	t := time.NewTicker(period)
 	defer t.Stop()
@@ -642,29 +1034,49 @@ func (l *Log) RunSequencer(ctx context.Context, period time.Duration) (err error
 		case <-t.C:
 			if err := l.sequence(ctx); err != nil {
 				l.c.Log.ErrorContext(ctx, "fatal sequencing error", "err", err)
+				l.Alert(ctx, AlertSequencerStopped, "sequencer stopped after a fatal error", err)
 				return err
 			}
+			l.sequencerProgress.Store(time.Now().UnixNano())
 		}
 	}
 }
 
+// SequencerProgress returns when the sequencer last completed a round, even
+// one that failed with a non-fatal error, or when RunSequencer started. It
+// returns the zero time if RunSequencer was never called.
+//
+// Rounds start every period, so a time much older than that means the
+// sequencer is stuck, even if the HTTP handlers still respond.
+func (l *Log) SequencerProgress() time.Time {
+	n := l.sequencerProgress.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
 const sequenceTimeout = 5 * time.Second
 
 var errFatal = errors.New("fatal sequencing error")
 
 func (l *Log) sequence(ctx context.Context) error {
-	l.poolMu.Lock()
+	l.lockPools()
 	p := l.currentPool
 	l.currentPool = newPool()
-	l.inSequencing = p.byHash
-	l.poolMu.Unlock()
+	for i := range l.shards {
+		l.shards[i].inSequencing = p.byHash[i]
+	}
+	l.unlockPools()
 
 	return l.sequencePool(ctx, p)
 }
 
 func (l *Log) sequencePool(ctx context.Context, p *pool) (err error) {
 	oldSize := l.tree.N
-	defer prometheus.NewTimer(l.m.SeqDuration).ObserveDuration()
+	defer func(start time.Time) {
+		l.observe(l.m.SeqDuration, time.Since(start).Seconds(), p.traceID)
+	}(time.Now())
 	defer func() {
 		if err != nil {
 			p.err = err
@@ -672,6 +1084,18 @@ func (l *Log) sequencePool(ctx context.Context, p *pool) (err error) {
 				"entries", len(p.pendingLeaves), "err", err)
 			l.m.SeqCount.With(prometheus.Labels{"error": errorCategory(err)}).Inc()
 
+			l.seqFailures++
+			if l.seqFailures == alertSequencingFailures {
+				l.Alert(ctx, AlertSequencingFailures, fmt.Sprintf(
+					"%d consecutive sequencing rounds failed", l.seqFailures), err)
+			}
+			unpublished := time.Duration(l.c.clock().NowUnixMilli()-l.publishedAt) * time.Millisecond
+			if !l.mmdAlerted && unpublished > l.mmd()/2 {
+				l.mmdAlerted = true
+				l.Alert(ctx, AlertMMDRisk, fmt.Sprintf(
+					"no checkpoint published for %v, more than half the MMD", unpublished), err)
+			}
+
 			// Non-fatal errors are delivered to the requests waiting on this
 			// pool, but do not break the sequencer loop.
 			if !errors.Is(err, errFatal) {
@@ -679,8 +1103,11 @@ func (l *Log) sequencePool(ctx context.Context, p *pool) (err error) {
 			}
 		} else {
 			l.m.SeqCount.With(prometheus.Labels{"error": ""}).Inc()
+			l.seqFailures = 0
+			l.mmdAlerted = false
 		}
 		l.m.SeqPoolSize.Observe(float64(len(p.pendingLeaves)))
+		l.storeSequencerState(p.err)
 
 		close(p.done)
 	}()
@@ -692,10 +1119,28 @@ func (l *Log) sequencePool(ctx context.Context, p *pool) (err error) {
 	g, gctx := errgroup.WithContext(ctx)
 	defer g.Wait()
 
-	timestamp := timeNowUnixMilli()
+	// Refuse to sign anything while the clock is known to be inaccurate, or
+	// if it went backwards, rather than publishing SCTs and checkpoints with
+	// wrong or regressing timestamps. These errors are not fatal: the pending
+	// entries fail with a 503, and sequencing resumes when the clock recovers.
+	if reason := l.clockSkew.Load(); reason != nil {
+		return fmtErrorf("clock is inaccurate (%s): %w", *reason, errClockSkew)
+	}
+	timestamp := l.c.clock().NowUnixMilli()
 	if timestamp <= l.tree.Time {
-		return errors.Join(errFatal, fmtErrorf("time did not progress! %d -> %d", l.tree.Time, timestamp))
+		return fmtErrorf("time did not progress! %d -> %d: %w", l.tree.Time, timestamp, errClockSkew)
+	}
+
+	phase := func(name string, d time.Duration) {
+		l.m.SeqPhases.WithLabelValues(name).Observe(d.Seconds())
 	}
+	timed := func(name string, f func() error) error {
+		start := time.Now()
+		err := f()
+		phase(name, time.Since(start))
+		return err
+	}
+	phaseStart := time.Now()
 
 	edgeTiles := maps.Clone(l.edgeTiles)
 	var dataTile []byte
@@ -703,28 +1148,36 @@ func (l *Log) sequencePool(ctx context.Context, p *pool) (err error) {
 	if t, ok := edgeTiles[-1]; ok && t.W < tileWidth {
 		dataTile = bytes.Clone(t.B)
 	}
+	phase("read_staged", time.Since(phaseStart))
+
+	// Hashing and serialization are interleaved, so their durations are
+	// accumulated separately.
+	var hashTime, serializeTime time.Duration
 	newHashes := make(map[int64]tlog.Hash)
 	hashReader := l.hashReader(newHashes)
 	n := l.tree.N
-	var sequencedLeaves []*SequencedLogEntry
-	for _, leaf := range p.pendingLeaves {
+	sequencedLeaves := make([]*SequencedLogEntry, 0, len(p.pendingLeaves))
+	// The MerkleTreeLeaf values are serialized back to back in one buffer.
+	var merkleData []byte
+	merkleEnds := make([]int, 0, len(p.pendingLeaves))
+	for i, leaf := range p.pendingLeaves {
 		leaf := &SequencedLogEntry{LogEntry: *leaf, Timestamp: timestamp, LeafIndex: n}
-		sequencedLeaves = append(sequencedLeaves, leaf)
-		leafData := leaf.TileLeaf()
-		dataTile = append(dataTile, leafData...)
-		l.m.SeqLeafSize.Observe(float64(len(leafData)))
-
-		// Compute the new tree hashes and add them to the hashReader overlay
-		// (we will use them later to insert more leaves and finally to produce
-		// the new tiles).
-		hashes, err := tlog.StoredHashes(n, leaf.MerkleTreeLeaf(), hashReader)
-		if err != nil {
-			return fmtErrorf("couldn't compute new hashes for leaf %d: %w", n, err)
-		}
-		for i, h := range hashes {
-			id := tlog.StoredHashIndex(0, n) + int64(i)
-			newHashes[id] = h
+		if p.timestamps != nil {
+			leaf.Timestamp = p.timestamps[i]
 		}
+		sequencedLeaves = append(sequencedLeaves, leaf)
+		phaseStart = time.Now()
+		// Serialize the leaf directly into the data tile, rather than into a
+		// temporary buffer.
+		tileSize := len(dataTile)
+		dataTile = leaf.AppendTileLeaf(dataTile)
+		serializeTime += time.Since(phaseStart)
+		l.m.SeqLeafSize.Observe(float64(len(dataTile) - tileSize))
+
+		phaseStart = time.Now()
+		merkleData = leaf.AppendMerkleTreeLeaf(merkleData)
+		merkleEnds = append(merkleEnds, len(merkleData))
+		hashTime += time.Since(phaseStart)
 
 		n++
 
@@ -738,8 +1191,9 @@ func (l *Log) sequencePool(ctx context.Context, p *pool) (err error) {
 			l.m.SeqDataTileSize.Observe(float64(len(dataTile)))
 			tileCount++
 			data := dataTile // data is captured by the g.Go function.
-			g.Go(func() error { return l.c.Backend.Upload(gctx, tile.Path(), data, optsDataTile) })
-			dataTile = nil
+			g.Go(func() error { return l.upload(gctx, tile.Path(), data, optsDataTile) })
+			// The next full tile will be about the same size.
+			dataTile = make([]byte, 0, len(data))
 		}
 	}
 
@@ -752,14 +1206,36 @@ func (l *Log) sequencePool(ctx context.Context, p *pool) (err error) {
 			"tree_size", n, "tile", tile, "size", len(dataTile))
 		l.m.SeqDataTileSize.Observe(float64(len(dataTile)))
 		tileCount++
-		g.Go(func() error { return l.c.Backend.Upload(gctx, tile.Path(), dataTile, optsDataTile) })
+		g.Go(func() error { return l.upload(gctx, tile.Path(), dataTile, optsDataTile) })
+	}
+
+	// Compute the new tree hashes, in parallel for large batches, and add them
+	// to the hashReader overlay (we will use them to produce the new tiles).
+	phaseStart = time.Now()
+	merkleLeaves := make([][]byte, len(merkleEnds))
+	for i, end := range merkleEnds {
+		start := 0
+		if i > 0 {
+			start = merkleEnds[i-1]
+		}
+		merkleLeaves[i] = merkleData[start:end:end]
+	}
+	hashes, err := storedHashes(l.tree.N, merkleLeaves, hashReader)
+	hashTime += time.Since(phaseStart)
+	if err != nil {
+		return fmtErrorf("couldn't compute new hashes for leaves %d-%d: %w", l.tree.N, n, err)
+	}
+	for i, h := range hashes {
+		newHashes[tlog.StoredHashIndex(0, l.tree.N)+int64(i)] = h
 	}
 
 	// Produce and upload new tree tiles.
 	tiles := tlog.NewTiles(TileHeight, l.tree.N, n)
 	for _, tile := range tiles {
 		tile := tile // tile is captured by the g.Go function.
+		phaseStart = time.Now()
 		data, err := tlog.ReadTileData(tile, hashReader)
+		serializeTime += time.Since(phaseStart)
 		if err != nil {
 			return fmtErrorf("couldn't generate tile %v: %w", tile, err)
 		}
@@ -771,35 +1247,51 @@ func (l *Log) sequencePool(ctx context.Context, p *pool) (err error) {
 		l.c.Log.DebugContext(ctx, "uploading tree tile", "old_tree_size", oldSize,
 			"tree_size", n, "tile", tile, "size", len(data))
 		tileCount++
-		g.Go(func() error { return l.c.Backend.Upload(gctx, tile.Path(), data, optsHashTile) })
+		g.Go(func() error { return l.upload(gctx, tile.Path(), data, optsHashTile) })
 	}
 
-	if err := g.Wait(); err != nil {
+	// Uploads start as soon as each tile is ready, so this only measures the
+	// time spent waiting for them after all tiles were produced.
+	if err := timed("upload_tiles", g.Wait); err != nil {
 		return fmtErrorf("couldn't upload a tile: %w", err)
 	}
 
-	if testingOnlyPauseSequencing != nil {
-		testingOnlyPauseSequencing()
+	if err := crash(crashPointTilesUploaded, ""); err != nil {
+		return err
 	}
 
+	phaseStart = time.Now()
 	rootHash, err := tlog.TreeHash(n, hashReader)
+	hashTime += time.Since(phaseStart)
+	phase("hash", hashTime)
+	phase("serialize", serializeTime)
 	if err != nil {
 		return fmtErrorf("couldn't compute tree hash: %w", err)
 	}
 	tree := treeWithTimestamp{Tree: tlog.Tree{N: n, Hash: rootHash}, Time: timestamp}
 
-	checkpoint, err := signTreeHead(l.c.Name, l.logID, l.c.Key, tree)
+	phaseStart = time.Now()
+	checkpoint, err := signTreeHead(l.c.Name, l.logID, l.c.Key, l.c.CheckpointSigners, tree)
+	phase("sign", time.Since(phaseStart))
 	if err != nil {
 		return fmtErrorf("couldn't sign checkpoint: %w", err)
 	}
+	if err := crash(crashPointCheckpointSigned, ""); err != nil {
+		return err
+	}
 	l.c.Log.DebugContext(ctx, "uploading checkpoint", "size", len(checkpoint))
+	phaseStart = time.Now()
 	newLock, err := l.c.Lock.Replace(ctx, l.lockCheckpoint, checkpoint)
+	phase("cas_checkpoint", time.Since(phaseStart))
 	if err != nil {
 		// This is a critical error, since we don't know the state of the
 		// checkpoint in the database at this point. Bail and let LoadLog get us
 		// to a good state after restart.
 		return errors.Join(errFatal, fmtErrorf("couldn't upload checkpoint to database: %w", err))
 	}
+	if err := crash(crashPointLockReplaced, ""); err != nil {
+		return err
+	}
 
 	// At this point the pool is fully serialized: the new tree was uploaded to
 	// object storage and the checkpoint was committed to the database. If the
@@ -810,19 +1302,28 @@ func (l *Log) sequencePool(ctx context.Context, p *pool) (err error) {
 	p.firstLeafIndex = l.tree.N
 	l.tree = tree
 	l.lockCheckpoint = newLock
+	l.lockUpdated = time.Now()
 	l.edgeTiles = edgeTiles
 
-	if err := l.c.Backend.Upload(ctx, "checkpoint", checkpoint, optsText); err != nil {
+	if err := timed("upload_checkpoint", func() error {
+		return l.upload(ctx, "checkpoint", checkpoint, optsText)
+	}); err != nil {
 		// Return an error so we don't produce SCTs that, although safely
 		// serialized, wouldn't be part of a publicly visible tree.
 		return fmtErrorf("couldn't upload checkpoint to object storage: %w", err)
 	}
+	l.checkpoints.publish(checkpoint)
+	l.entries.publish(sequencedLeaves)
+	l.publishedAt = timestamp
+	if err := crash(crashPointCheckpointUploaded, ""); err != nil {
+		return err
+	}
 
 	// At this point if the cache put fails, there's no reason to return errors
 	// to users. The only consequence of cache false negatives are duplicated
 	// leaves anyway. In fact, an error might cause the clients to resumbit,
 	// producing more cache false negatives and duplicates.
-	if err := l.cachePut(sequencedLeaves); err != nil {
+	if err := timed("cache_put", func() error { return l.cachePut(sequencedLeaves) }); err != nil {
 		l.c.Log.ErrorContext(ctx, "cache put failed",
 			"tree_size", tree.N, "entries", n-oldSize, "err", err)
 		l.m.CachePutErrors.Inc()
@@ -842,11 +1343,47 @@ func (l *Log) sequencePool(ctx context.Context, p *pool) (err error) {
 	return nil
 }
 
-var testingOnlyPauseSequencing func()
+// A crashPoint is a point of a sequencing round at which tests can simulate a
+// crash of the process, to check that the log recovers from the state left in
+// the backends, or pause the sequencer.
+type crashPoint string
+
+const (
+	// crashPointUpload is before each upload to object storage, with its key.
+	crashPointUpload crashPoint = "upload"
+	// crashPointTilesUploaded is after all tiles are uploaded, before the
+	// checkpoint is signed.
+	crashPointTilesUploaded crashPoint = "tiles-uploaded"
+	// crashPointCheckpointSigned is right before the lock backend update.
+	crashPointCheckpointSigned crashPoint = "checkpoint-signed"
+	// crashPointLockReplaced is after the lock backend update, before the
+	// checkpoint is uploaded to object storage.
+	crashPointLockReplaced crashPoint = "lock-replaced"
+	// crashPointCheckpointUploaded is after the checkpoint is uploaded to
+	// object storage, before the deduplication cache is updated.
+	crashPointCheckpointUploaded crashPoint = "checkpoint-uploaded"
+)
+
+// testingOnlyCrashPoint, if set, is called at each crashPoint. It can block to
+// pause the sequencer, or return an error to crash it.
+var testingOnlyCrashPoint func(p crashPoint, key string) error
+
+// crash returns a fatal error, abandoning the sequencing round, if
+// testingOnlyCrashPoint crashes at p.
+func crash(p crashPoint, key string) error {
+	if testingOnlyCrashPoint == nil {
+		return nil
+	}
+	if err := testingOnlyCrashPoint(p, key); err != nil {
+		return errors.Join(errFatal, fmtErrorf("injected crash at %s: %w", p, err))
+	}
+	return nil
+}
 
 // signTreeHead signs the tree and returns a checkpoint according to
-// c2sp.org/checkpoint.
-func signTreeHead(name string, logID [sha256.Size]byte, privKey *ecdsa.PrivateKey, tree treeWithTimestamp) (checkpoint []byte, err error) {
+// c2sp.org/checkpoint, with an RFC6962NoteSignature from privKey followed by a
+// signature from each of extra.
+func signTreeHead(name string, logID [sha256.Size]byte, privKey crypto.Signer, extra []note.Signer, tree treeWithTimestamp) (checkpoint []byte, err error) {
 	sthBytes, err := ct.SerializeSTHSignatureInput(ct.SignedTreeHead{
 		Version:        ct.V1,
 		TreeSize:       uint64(tree.N),
@@ -886,7 +1423,7 @@ func signTreeHead(name string, logID [sha256.Size]byte, privKey *ecdsa.PrivateKe
 			Origin: name,
 			Tree:   tlog.Tree{N: tree.N, Hash: tree.Hash},
 		}),
-	}, signer)
+	}, append([]note.Signer{signer}, extra...)...)
 	if err != nil {
 		return nil, fmtErrorf("couldn't sign note: %w", err)
 	}
@@ -900,15 +1437,28 @@ func signTreeHead(name string, logID [sha256.Size]byte, privKey *ecdsa.PrivateKe
 // complexity and in part because tls.CreateSignature expects non-pointer
 // {rsa,ecdsa}.PrivateKey types, which is unusual.
 //
-// We use deterministic RFC 6979 ECDSA signatures so that when fetching a
-// previous SCT's timestamp and index from the deduplication cache, the new SCT
-// we produce is identical.
-func digitallySign(k *ecdsa.PrivateKey, msg []byte) ([]byte, error) {
+// For local keys, we use deterministic RFC 6979 ECDSA signatures so that when
+// fetching a previous SCT's timestamp and index from the deduplication cache,
+// the new SCT we produce is identical. Other signers, such as KMS, can't offer
+// that, so their SCTs are only equivalent.
+func digitallySign(k crypto.Signer, msg []byte) ([]byte, error) {
 	h := sha256.Sum256(msg)
-	sig, err := rfc6979.Sign(k, h[:], crypto.SHA256)
+	var sig []byte
+	var err error
+	if priv, ok := k.(*ecdsa.PrivateKey); ok {
+		sig, err = rfc6979.Sign(priv, h[:], crypto.SHA256)
+	} else {
+		sig, err = k.Sign(cryptorand.Reader, h[:], crypto.SHA256)
+	}
 	if err != nil {
 		return nil, err
 	}
+	return encodeDigitallySigned(sig)
+}
+
+// encodeDigitallySigned encodes an ASN.1 ECDSA signature of a SHA-256 hash as
+// a TLS DigitallySigned structure.
+func encodeDigitallySigned(sig []byte) ([]byte, error) {
 	var b cryptobyte.Builder
 	b.AddUint8(4 /* hash = sha256 */)
 	b.AddUint8(3 /* signature = ecdsa */)
@@ -977,9 +1527,9 @@ func ReadTileLeaf(tile []byte) (e *SequencedLogEntry, rest []byte, err error) {
 	return e, s, nil
 }
 
-// addUint40 appends a big-endian, 40-bit value to the byte string.
-func addUint40(b *cryptobyte.Builder, v uint64) {
-	b.AddBytes([]byte{byte(v >> 32), byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+// appendUint24 appends a big-endian, 24-bit value to b.
+func appendUint24(b []byte, v int) []byte {
+	return append(b, byte(v>>16), byte(v>>8), byte(v))
 }
 
 // readUint40 decodes a big-endian, 40-bit value into out and advances over it.
@@ -0,0 +1,127 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+func TestLoggedPrecertReject(t *testing.T) {
+	h := newPrecertHierarchy(t)
+	submit := func(tl *TestLog, path string, chain ...[]byte) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string][][]byte{"chain": chain})
+		fatalIfErr(t, err)
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		return rr
+	}
+
+	for _, tc := range []struct {
+		name    string
+		dedup   ctlog.DedupMode
+		precert [][]byte
+		final   []byte
+		code    int
+	}{
+		{"Leaf", ctlog.DedupLeaf, [][]byte{h.direct, h.intermediate}, h.final, http.StatusOK},
+		{"TBS", ctlog.DedupTBS, [][]byte{h.direct, h.intermediate}, h.final, http.StatusBadRequest},
+		{"TBSWithSCTs", ctlog.DedupTBS, [][]byte{h.direct, h.intermediate}, h.finalWithSCTs, http.StatusBadRequest},
+		{"TBSDelegated", ctlog.DedupTBS, [][]byte{h.delegated, h.preIssuer, h.intermediate}, h.final, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tl := NewEmptyTestLog(t)
+			r := x509util.NewPEMCertPool()
+			r.AppendCertsFromPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: h.root}))
+			tl.Log.SetRoots(r)
+			tl.Config.Dedup = tc.dedup
+			tl.Config.LoggedPrecert = ctlog.LoggedPrecertReject
+			tl.StartSequencer()
+
+			if rr := submit(tl, "/ct/v1/add-pre-chain", tc.precert...); rr.Code != http.StatusOK {
+				t.Fatalf("got status %d, expected 200: %s", rr.Code, rr.Body)
+			}
+			rr := submit(tl, "/ct/v1/add-chain", tc.final, h.intermediate)
+			if rr.Code != tc.code {
+				t.Fatalf("got status %d, expected %d: %s", rr.Code, tc.code, rr.Body)
+			}
+			if tc.code == http.StatusBadRequest && !strings.Contains(rr.Body.String(), "precertificate already logged") {
+				t.Errorf("got error %q, expected precertificate already logged", rr.Body.String())
+			}
+			// Resubmitting the precertificate is still deduplicated as usual.
+			if rr := submit(tl, "/ct/v1/add-pre-chain", tc.precert...); rr.Code != http.StatusOK {
+				t.Fatalf("got status %d, expected 200: %s", rr.Code, rr.Body)
+			}
+			tl.CheckLog()
+		})
+	}
+}
+
+func TestLoggedPrecertLog(t *testing.T) {
+	h := newPrecertHierarchy(t)
+	tl := newDedupTBSTestLog(t, h, ctlog.LoggedPrecertLog)
+
+	pre := submitDedupTBS(t, tl, "/ct/v1/add-pre-chain", h.direct, h.intermediate)
+	final := submitDedupTBS(t, tl, "/ct/v1/add-chain", h.final, h.intermediate)
+	if final.Extensions == pre.Extensions {
+		t.Errorf("certificate got the leaf index of its precertificate")
+	}
+	// Once logged, the certificate is deduplicated as usual.
+	again := submitDedupTBS(t, tl, "/ct/v1/add-chain", h.finalWithSCTs, h.intermediate)
+	if again.Extensions == pre.Extensions || again.Extensions == final.Extensions {
+		t.Errorf("certificate with SCTs wasn't logged as a new entry")
+	}
+	tl.CheckLog()
+}
+
+func TestLoggedPrecertSCT(t *testing.T) {
+	h := newPrecertHierarchy(t)
+	tl := newDedupTBSTestLog(t, h, ctlog.LoggedPrecertSCT)
+
+	pre := submitDedupTBS(t, tl, "/ct/v1/add-pre-chain", h.direct, h.intermediate)
+	for _, final := range [][]byte{h.final, h.finalWithSCTs} {
+		rsp := submitDedupTBS(t, tl, "/ct/v1/add-chain", final, h.intermediate)
+		if rsp.Timestamp != pre.Timestamp || rsp.Extensions != pre.Extensions {
+			t.Errorf("got SCT at %d with extensions %q, expected the precertificate's at %d with %q",
+				rsp.Timestamp, rsp.Extensions, pre.Timestamp, pre.Extensions)
+		}
+	}
+	// A certificate without a logged precertificate is logged as usual.
+	rsp := submitDedupTBS(t, tl, "/ct/v1/add-chain", h.serverAuth, h.intermediate)
+	if rsp.Extensions == pre.Extensions {
+		t.Errorf("unrelated certificate got the SCT of the precertificate")
+	}
+	tl.CheckLog()
+}
+
+func newDedupTBSTestLog(t *testing.T, h *precertHierarchy, action ctlog.LoggedPrecertAction) *TestLog {
+	tl := NewEmptyTestLog(t)
+	r := x509util.NewPEMCertPool()
+	r.AppendCertsFromPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: h.root}))
+	tl.Log.SetRoots(r)
+	tl.Config.Dedup = ctlog.DedupTBS
+	tl.Config.LoggedPrecert = action
+	tl.StartSequencer()
+	return tl
+}
+
+func submitDedupTBS(t *testing.T, tl *TestLog, path string, chain ...[]byte) *ct.AddChainResponse {
+	t.Helper()
+	body, err := json.Marshal(map[string][][]byte{"chain": chain})
+	fatalIfErr(t, err)
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, expected 200: %s", rr.Code, rr.Body)
+	}
+	rsp := &ct.AddChainResponse{}
+	fatalIfErr(t, json.Unmarshal(rr.Body.Bytes(), rsp))
+	return rsp
+}
@@ -0,0 +1,234 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight"
+	"filippo.io/sunlight/internal/ctlog"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/google/certificate-transparency-go/trillian/ctfe"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	ctx509pkix "github.com/google/certificate-transparency-go/x509/pkix"
+	"github.com/google/certificate-transparency-go/x509util"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var differentialCorpus = flag.String("differential-corpus", "",
+	"directory of PEM chains (and their roots.pem) to also run TestDifferentialCTFE on")
+
+// TestDifferentialCTFE submits a corpus of chains to a Sunlight log and to the
+// chain validation and leaf construction of CTFE, the certificate-transparency-go
+// RFC 6962 frontend, and checks that they accept the same chains and log the
+// same MerkleTreeLeaf for them.
+//
+// With -differential-corpus, the PEM chains in that directory are also
+// submitted, to add-pre-chain if the leaf has the poison extension, and to
+// add-chain otherwise, with the roots in its roots.pem and no temporal
+// interval.
+func TestDifferentialCTFE(t *testing.T) {
+	h := newPrecertHierarchy(t)
+	corpus := []differentialCase{
+		{"Certificate", false, [][]byte{testLeaf, testIntermediate, testRoot}, ""},
+		{"CertificateWithoutRoot", false, [][]byte{testLeaf, testIntermediate}, ""},
+		{"CertificateOnly", false, [][]byte{testLeaf}, ""},
+		{"CertificateReordered", false, [][]byte{testLeaf, testRoot, testIntermediate},
+			"Sunlight logs an alternate path for chains submitted out of order"},
+		{"CertificateToAddPreChain", true, [][]byte{testLeaf, testIntermediate, testRoot}, ""},
+		{"Precertificate", true, [][]byte{testPrecert, testIntermediate, testRoot}, ""},
+		{"PrecertificateToAddChain", false, [][]byte{testPrecert, testIntermediate, testRoot}, ""},
+		{"NotAfterOutOfRange", false, [][]byte{h.intermediate, h.root}, ""},
+		{"UnknownRoot", false, [][]byte{testLeaf, h.intermediate, h.root}, ""},
+		{"Garbage", false, [][]byte{[]byte("not a certificate")}, ""},
+		{"Direct", true, [][]byte{h.direct, h.intermediate, h.root}, ""},
+		{"Final", false, [][]byte{h.final, h.intermediate, h.root}, ""},
+		{"FinalWithSCTs", false, [][]byte{h.finalWithSCTs, h.intermediate}, ""},
+		{"Delegated", true, [][]byte{h.delegated, h.preIssuer, h.intermediate, h.root}, ""},
+		{"DelegatedWithoutRoot", true, [][]byte{h.delegated, h.preIssuer, h.intermediate}, ""},
+		{"DelegatedWithoutAKI", true, [][]byte{h.delegatedNoAKI, h.preIssuer, h.intermediate},
+			"x509.BuildPrecertTBS adds the Authority Key Identifier of the Precertificate Signing Certificate"},
+		{"DelegatedWithoutIssuer", true, [][]byte{h.delegated, h.preIssuer}, ""},
+		{"PreIssuerWithoutAKI", true, [][]byte{h.precertForPreIssuerNoAKI, h.preIssuerNoAKI, h.intermediate},
+			"x509.BuildPrecertTBS drops the Authority Key Identifier of the precertificate"},
+		{"FinalFromPreIssuer", false, [][]byte{h.finalFromPreIssuer, h.preIssuer, h.intermediate},
+			"RFC 6962 forbids Precertificate Signing Certificates from issuing final certificates"},
+		{"ClientAuthEKU", false, [][]byte{h.clientAuth, h.intermediate}, ""},
+	}
+
+	roots := x509util.NewPEMCertPool()
+	roots.AppendCertsFromPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testRoot}))
+	roots.AppendCertsFromPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: h.root}))
+	testDifferential(t, corpus, roots, func(tl *TestLog) {})
+
+	if *differentialCorpus == "" {
+		return
+	}
+	roots = x509util.NewPEMCertPool()
+	rootsPEM, err := os.ReadFile(*differentialCorpus + "/roots.pem")
+	fatalIfErr(t, err)
+	if !roots.AppendCertsFromPEM(rootsPEM) {
+		t.Fatal("no roots in roots.pem")
+	}
+	files, err := filepath.Glob(*differentialCorpus + "/*.pem")
+	fatalIfErr(t, err)
+	corpus = nil
+	for _, file := range files {
+		if filepath.Base(file) == "roots.pem" {
+			continue
+		}
+		b, err := os.ReadFile(file)
+		fatalIfErr(t, err)
+		tc := differentialCase{name: filepath.Base(file)}
+		for {
+			var block *pem.Block
+			if block, b = pem.Decode(b); block == nil {
+				break
+			}
+			tc.chain = append(tc.chain, block.Bytes)
+		}
+		if len(tc.chain) == 0 {
+			t.Fatalf("no certificates in %s", file)
+		}
+		if leaf, err := ctx509.ParseCertificate(tc.chain[0]); !ctx509.IsFatal(err) {
+			tc.precert = slices.ContainsFunc(leaf.Extensions, func(ext ctx509pkix.Extension) bool {
+				return ext.Id.Equal(ctx509.OIDExtensionCTPoison)
+			})
+		}
+		corpus = append(corpus, tc)
+	}
+	t.Run("Corpus", func(t *testing.T) {
+		testDifferential(t, corpus, roots, func(tl *TestLog) {
+			tl.Config.NotAfterStart = time.Time{}
+			tl.Config.NotAfterLimit = time.Date(9999, time.January, 1, 0, 0, 0, 0, time.UTC)
+		})
+	})
+}
+
+type differentialCase struct {
+	name    string
+	precert bool
+	chain   [][]byte
+	// divergence is the reason Sunlight intentionally disagrees with CTFE
+	// about this chain, if it does.
+	divergence string
+}
+
+func testDifferential(t *testing.T, corpus []differentialCase, roots *x509util.PEMCertPool, configure func(tl *TestLog)) {
+	tl := NewEmptyTestLog(t)
+	tl.Quiet()
+	tl.Log.SetRoots(roots)
+	configure(tl)
+	tl.StartSequencer()
+
+	for _, tc := range corpus {
+		var diverged bool
+		diverge := func(format string, args ...any) {
+			t.Helper()
+			diverged = true
+			if tc.divergence == "" {
+				t.Errorf("%s: "+format, append([]any{tc.name}, args...)...)
+			}
+		}
+
+		path := "/ct/v1/add-chain"
+		if tc.precert {
+			path = "/ct/v1/add-pre-chain"
+		}
+		body, err := json.Marshal(map[string][][]byte{"chain": tc.chain})
+		fatalIfErr(t, err)
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		leaf, ctfeErr := ctfeMerkleTreeLeaf(tc.chain, tc.precert, roots,
+			tl.Config.NotAfterStart, tl.Config.NotAfterLimit)
+
+		switch {
+		case rr.Code != http.StatusOK && ctfeErr == nil:
+			diverge("Sunlight rejected the chain with %d (%s), CTFE accepted it",
+				rr.Code, strings.TrimSpace(rr.Body.String()))
+		case rr.Code == http.StatusOK && ctfeErr != nil:
+			diverge("Sunlight accepted the chain, CTFE rejected it: %v", ctfeErr)
+		case rr.Code == http.StatusOK:
+			var resp ct.AddChainResponse
+			fatalIfErr(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			sct, err := resp.ToSignedCertificateTimestamp()
+			fatalIfErr(t, err)
+			idx, err := ctlog.ParseExtensions(sct.Extensions)
+			fatalIfErr(t, err)
+			// CTFE doesn't set the extensions, and uses its own timestamp.
+			leaf.TimestampedEntry.Timestamp = sct.Timestamp
+			leaf.TimestampedEntry.Extensions = sct.Extensions
+			b, err := tls.Marshal(*leaf)
+			fatalIfErr(t, err)
+			got := tlog.RecordHash(entryAt(t, tl, idx).MerkleTreeLeaf())
+			if want := tlog.RecordHash(b); got != want {
+				diverge("Sunlight logged leaf hash %v, CTFE would log %v", got, want)
+			}
+		}
+		if tc.divergence != "" && !diverged {
+			t.Errorf("%s: Sunlight and CTFE agree, but they are expected to diverge because %s",
+				tc.name, tc.divergence)
+		}
+	}
+	tl.CheckLog()
+}
+
+// ctfeMerkleTreeLeaf returns the MerkleTreeLeaf that CTFE would log for
+// rawChain submitted to add-pre-chain if precert is true, or to add-chain
+// otherwise, or the error it would reject it with.
+func ctfeMerkleTreeLeaf(rawChain [][]byte, precert bool, roots *x509util.PEMCertPool, notAfterStart, notAfterLimit time.Time) (*ct.MerkleTreeLeaf, error) {
+	opts := ctfe.NewCertValidationOpts(roots, time.Time{}, false, false,
+		&notAfterStart, &notAfterLimit, false, []ctx509.ExtKeyUsage{ctx509.ExtKeyUsageServerAuth})
+	chain, err := ctfe.ValidateChain(rawChain, opts)
+	if err != nil {
+		return nil, err
+	}
+	isPrecert, err := ctfe.IsPrecertificate(chain[0])
+	if err != nil {
+		return nil, err
+	}
+	if isPrecert != precert {
+		return nil, errors.New("cert / precert mismatch")
+	}
+	etype := ct.X509LogEntryType
+	if precert {
+		etype = ct.PrecertLogEntryType
+	}
+	return ct.MerkleTreeLeafFromChain(chain, etype, 0)
+}
+
+// entryAt returns the entry at index idx, reading it from the data tile of
+// the current checkpoint.
+func entryAt(t *testing.T, tl *TestLog, idx int64) *ctlog.SequencedLogEntry {
+	t.Helper()
+	sth, err := tl.Config.Backend.Fetch(context.Background(), "checkpoint")
+	fatalIfErr(t, err)
+	c, err := sunlight.ParseCheckpoint(string(sth[:bytes.Index(sth, []byte("\n\n"))+1]))
+	fatalIfErr(t, err)
+	n := idx / tileWidth
+	tile := tlog.Tile{H: ctlog.TileHeight, L: -1, N: n, W: int(min(tileWidth, c.N-n*tileWidth))}
+	b, err := tl.Config.Backend.Fetch(context.Background(), tile.Path())
+	fatalIfErr(t, err)
+	for len(b) > 0 {
+		e, rest, err := ctlog.ReadTileLeaf(b)
+		fatalIfErr(t, err)
+		if e.LeafIndex == idx {
+			return e
+		}
+		b = rest
+	}
+	t.Fatalf("entry %d not found in tile %v", idx, tile)
+	return nil
+}
@@ -0,0 +1,213 @@
+package ctlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventsKeepAlive is how often a comment is sent on idle event streams, to
+// keep proxies from closing them.
+const eventsKeepAlive = 15 * time.Second
+
+// eventsMaxDuration is how long an event stream is kept open. Clients are
+// expected to reconnect, which EventSource does automatically.
+const eventsMaxDuration = 10 * time.Minute
+
+// checkpointFeed broadcasts each checkpoint published by the sequencer.
+type checkpointFeed struct {
+	mu         sync.Mutex
+	checkpoint []byte
+	// updated is closed and replaced when checkpoint changes.
+	updated chan struct{}
+}
+
+func (f *checkpointFeed) publish(checkpoint []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checkpoint = checkpoint
+	if f.updated != nil {
+		close(f.updated)
+	}
+	f.updated = make(chan struct{})
+}
+
+// latest returns the latest published checkpoint, or nil if none was
+// published yet, and a channel that is closed when a new one is published.
+func (f *checkpointFeed) latest() ([]byte, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.updated == nil {
+		f.updated = make(chan struct{})
+	}
+	return f.checkpoint, f.updated
+}
+
+// subscriberMaxPending is how many sequenced entries a Subscribe caller can
+// fall behind before it's dropped.
+const subscriberMaxPending = 1 << 16
+
+// entryFeed delivers the sequenced entries to Subscribe callers. Each
+// subscriber has its own queue, so that a slow one never blocks the sequencer.
+type entryFeed struct {
+	mu   sync.Mutex
+	subs map[*entrySubscriber]struct{}
+}
+
+type entrySubscriber struct {
+	mu      sync.Mutex
+	pending []SequencedLogEntry
+	dropped bool
+	// wake has a buffer of one, and is signaled when pending changes.
+	wake chan struct{}
+}
+
+func (f *entryFeed) publish(entries []*SequencedLogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs {
+		s.mu.Lock()
+		switch {
+		case s.dropped:
+		case len(s.pending)+len(entries) > subscriberMaxPending:
+			s.dropped = true
+		default:
+			for _, e := range entries {
+				s.pending = append(s.pending, *e)
+			}
+		}
+		s.mu.Unlock()
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (f *entryFeed) add(s *entrySubscriber) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[*entrySubscriber]struct{})
+	}
+	f.subs[s] = struct{}{}
+}
+
+func (f *entryFeed) remove(s *entrySubscriber) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs, s)
+}
+
+// Subscribe returns a channel that receives the entries sequenced by this
+// instance from now on, in order, once the checkpoint that includes them has
+// been published.
+//
+// The channel is closed when ctx is canceled, or if the receiver falls more
+// than 65536 entries behind. In the latter case, the entries after the last
+// received one need to be read from the tiles, before subscribing again.
+func (l *Log) Subscribe(ctx context.Context) <-chan SequencedLogEntry {
+	s := &entrySubscriber{wake: make(chan struct{}, 1)}
+	l.entries.add(s)
+	ch := make(chan SequencedLogEntry)
+	go func() {
+		defer close(ch)
+		defer l.entries.remove(s)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+			}
+			s.mu.Lock()
+			pending, dropped := s.pending, s.dropped
+			s.pending = nil
+			s.mu.Unlock()
+			for _, e := range pending {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if dropped {
+				l.c.Log.WarnContext(ctx, "dropped slow subscriber",
+					"max_pending", subscriberMaxPending)
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// getCheckpointEvents serves a text/event-stream of the checkpoints published
+// by this instance's sequencer, as "checkpoint" events with the tree size as
+// the event ID. The stream starts with the next published checkpoint, so
+// clients should fetch /checkpoint after connecting.
+func (l *Log) getCheckpointEvents(rw http.ResponseWriter, r *http.Request) {
+	// Subscribe before sending the headers, so that a client that sees the
+	// response doesn't miss a checkpoint published right after.
+	_, updated := l.checkpoints.latest()
+
+	rc := http.NewResponseController(rw)
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-store")
+	// Ask nginx and similar proxies not to buffer the stream.
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+
+	write := func(event []byte) bool {
+		// Extend the server WriteTimeout, if any. If the ResponseWriter doesn't
+		// support it, the stream will just be cut short.
+		rc.SetWriteDeadline(time.Now().Add(eventsKeepAlive * 2))
+		if _, err := rw.Write(event); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	if !write([]byte(": connected\n\n")) {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	end := time.After(eventsMaxDuration)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-end:
+			return
+		case <-keepAlive.C:
+			if !write([]byte(": keep-alive\n\n")) {
+				return
+			}
+		case <-updated:
+			var checkpoint []byte
+			checkpoint, updated = l.checkpoints.latest()
+			if !write(checkpointEvent(checkpoint)) {
+				return
+			}
+		}
+	}
+}
+
+func checkpointEvent(checkpoint []byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("event: checkpoint\n")
+	// The second line of a checkpoint is the tree size.
+	if lines := bytes.SplitN(checkpoint, []byte("\n"), 3); len(lines) == 3 {
+		fmt.Fprintf(buf, "id: %s\n", lines[1])
+	}
+	for _, line := range bytes.Split(bytes.TrimSuffix(checkpoint, []byte("\n")), []byte("\n")) {
+		fmt.Fprintf(buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
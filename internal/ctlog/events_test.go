@@ -0,0 +1,65 @@
+package ctlog_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointEvents(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	ts := httptest.NewServer(tl.Log.Handler())
+	t.Cleanup(ts.Close)
+
+	res, err := http.Get(ts.URL + "/checkpoint/events")
+	fatalIfErr(t, err)
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("got Content-Type %q", ct)
+	}
+	r := bufio.NewReader(res.Body)
+	readEvent := func() map[string][]string {
+		t.Helper()
+		event := make(map[string][]string)
+		for {
+			line, err := r.ReadString('\n')
+			fatalIfErr(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				if len(event) == 0 {
+					continue // a comment-only event
+				}
+				return event
+			}
+			if strings.HasPrefix(line, ":") {
+				continue
+			}
+			field, value, _ := strings.Cut(line, ": ")
+			event[field] = append(event[field], value)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	event := readEvent()
+	checkpoint, err := tl.Config.Backend.Fetch(context.Background(), "checkpoint")
+	fatalIfErr(t, err)
+	if got := strings.Join(event["data"], "\n") + "\n"; got != string(checkpoint) {
+		t.Errorf("got event data %q, expected checkpoint %q", got, checkpoint)
+	}
+	if !slices.Equal(event["event"], []string{"checkpoint"}) || !slices.Equal(event["id"], []string{"3"}) {
+		t.Errorf("unexpected event fields: %v", event)
+	}
+
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	if event := readEvent(); !slices.Equal(event["id"], []string{"4"}) {
+		t.Errorf("unexpected second event: %v", event)
+	}
+}
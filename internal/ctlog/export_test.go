@@ -1,9 +1,15 @@
 package ctlog
 
-import "context"
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
 
 func (l *Log) AddLeafToPool(e *LogEntry) (waitEntryFunc, string) {
-	return l.addLeafToPool(e)
+	return l.addLeafToPool(context.Background(), e)
 }
 
 func (l *Log) Sequence() error {
@@ -18,11 +24,78 @@ var seqRunning chan struct{}
 
 func PauseSequencer() {
 	seqRunning = make(chan struct{})
-	testingOnlyPauseSequencing = func() {
-		<-seqRunning
+	testingOnlyCrashPoint = func(p crashPoint, key string) error {
+		if p == crashPointTilesUploaded {
+			<-seqRunning
+		}
+		return nil
 	}
 }
 
 func ResumeSequencer() {
 	close(seqRunning)
 }
+
+type CrashPoint = crashPoint
+
+const (
+	CrashPointUpload             = crashPointUpload
+	CrashPointTilesUploaded      = crashPointTilesUploaded
+	CrashPointCheckpointSigned   = crashPointCheckpointSigned
+	CrashPointLockReplaced       = crashPointLockReplaced
+	CrashPointCheckpointUploaded = crashPointCheckpointUploaded
+)
+
+// SetCrashPoint makes the sequencer call f at each crash point, until the
+// test ends. A non-nil error is a simulated crash.
+func SetCrashPoint(t testing.TB, f func(p CrashPoint, key string) error) {
+	testingOnlyCrashPoint = f
+	t.Cleanup(func() { testingOnlyCrashPoint = nil })
+}
+
+type Hedger = hedger
+
+func NewHedger(o HedgingOptions) *Hedger {
+	h := newHedger()
+	h.setOptions(o)
+	return h
+}
+
+func (h *hedger) Delay(class ObjectClass) time.Duration { return h.delay(class) }
+
+func (h *hedger) Allow() bool { return h.allow() }
+
+func (h *hedger) Observe(class ObjectClass, d time.Duration) { h.observe(class, d) }
+
+func Compress(data []byte, level int) error {
+	b, err := compress(data, level)
+	if err != nil {
+		return err
+	}
+	putUploadBuffer(b)
+	return nil
+}
+
+const ParallelHashingMinLeaves = parallelHashingMinLeaves
+
+func StoredHashes(n int64, leaves [][]byte, r tlog.HashReader) ([]tlog.Hash, error) {
+	return storedHashes(n, leaves, r)
+}
+
+type IssuerTracker = issuerTracker
+
+type IssuerCount = issuerCount
+
+const (
+	MaxIssuerLabels  = maxIssuerLabels
+	TopIssuersCount  = topIssuersCount
+	TopIssuersWindow = topIssuersWindow
+)
+
+func NewIssuerTracker(now func() time.Time) *IssuerTracker { return newIssuerTracker(now) }
+
+func (t *issuerTracker) Label(issuer string) string { return t.label(issuer) }
+
+func (t *issuerTracker) Observe(issuer string) { t.observe(issuer) }
+
+func (t *issuerTracker) Top(n int) []IssuerCount { return t.top(n) }
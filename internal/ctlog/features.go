@@ -0,0 +1,181 @@
+package ctlog
+
+import (
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A Feature is a behavior that is rolled out gradually, so that it can be
+// enabled on one log first, and disabled again without a redeploy.
+type Feature string
+
+const (
+	// FeatureConditionalWrites makes the S3 backend create immutable objects
+	// with If-None-Match: *, so that a concurrent sequencer can never
+	// overwrite them. It requires a backend that supports conditional writes,
+	// such as S3 or R2. Tigris always gets the equivalent If-Match header.
+	// Disabled by default.
+	FeatureConditionalWrites Feature = "conditional-writes"
+
+	// FeatureHedgedUploads makes the S3 backend send a second, competing
+	// request for uploads that are slower than most recent ones, see
+	// [HedgingOptions]. Enabled by default.
+	FeatureHedgedUploads Feature = "hedged-uploads"
+)
+
+var featureDefaults = map[Feature]bool{
+	FeatureConditionalWrites: false,
+	FeatureHedgedUploads:     true,
+}
+
+// AllFeatures returns the known features, sorted by name.
+func AllFeatures() []Feature {
+	return slices.Sorted(maps.Keys(featureDefaults))
+}
+
+// Features is the set of features enabled for a log. A feature is enabled
+// according to its runtime override, if any, or else to its configured
+// value, if any, or else to its default.
+//
+// A nil *Features has every feature set to its default.
+type Features struct {
+	mu        sync.RWMutex
+	config    map[Feature]bool
+	overrides map[Feature]bool
+	enabled   *prometheus.GaugeVec
+}
+
+// NewFeatures returns a Features with the configured values in config, keyed
+// by feature name. Unknown names are rejected.
+func NewFeatures(config map[string]bool) (*Features, error) {
+	f := &Features{
+		overrides: make(map[Feature]bool),
+		enabled: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "feature_enabled",
+			Help: "Whether a feature is enabled, by feature name.",
+		}, []string{"feature"}),
+	}
+	if err := f.SetConfig(config); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ParseFeature returns the Feature named s, or an error if it's unknown.
+func ParseFeature(s string) (Feature, error) {
+	if _, ok := featureDefaults[Feature(s)]; !ok {
+		return "", fmtErrorf("unknown feature %q", s)
+	}
+	return Feature(s), nil
+}
+
+func (f *Features) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{f.enabled}
+}
+
+// Enabled reports whether the feature is enabled.
+func (f *Features) Enabled(name Feature) bool {
+	if f == nil {
+		return featureDefaults[name]
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.enabledLocked(name)
+}
+
+func (f *Features) enabledLocked(name Feature) bool {
+	if v, ok := f.overrides[name]; ok {
+		return v
+	}
+	if v, ok := f.config[name]; ok {
+		return v
+	}
+	return featureDefaults[name]
+}
+
+// SetConfig replaces the configured values, such as after a config reload.
+// Runtime overrides are kept.
+func (f *Features) SetConfig(config map[string]bool) error {
+	c := make(map[Feature]bool, len(config))
+	for s, v := range config {
+		name, err := ParseFeature(s)
+		if err != nil {
+			return err
+		}
+		c[name] = v
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config = c
+	f.updateMetrics()
+	return nil
+}
+
+// Override enables or disables the feature until ClearOverride is called or
+// the process restarts, regardless of its configured value.
+func (f *Features) Override(name Feature, enabled bool) error {
+	if _, ok := featureDefaults[name]; !ok {
+		return fmtErrorf("unknown feature %q", name)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.overrides[name] = enabled
+	f.updateMetrics()
+	return nil
+}
+
+// ClearOverride removes the runtime override of the feature, if any.
+func (f *Features) ClearOverride(name Feature) error {
+	if _, ok := featureDefaults[name]; !ok {
+		return fmtErrorf("unknown feature %q", name)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.overrides, name)
+	f.updateMetrics()
+	return nil
+}
+
+// FeatureState describes how a feature is set, for the admin endpoints.
+type FeatureState struct {
+	Name     Feature `json:"name"`
+	Enabled  bool    `json:"enabled"`
+	Default  bool    `json:"default"`
+	Config   *bool   `json:"config,omitempty"`
+	Override *bool   `json:"override,omitempty"`
+}
+
+// State returns the state of every known feature, sorted by name.
+func (f *Features) State() []FeatureState {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var state []FeatureState
+	for _, name := range AllFeatures() {
+		s := FeatureState{
+			Name:    name,
+			Enabled: f.enabledLocked(name),
+			Default: featureDefaults[name],
+		}
+		if v, ok := f.config[name]; ok {
+			s.Config = &v
+		}
+		if v, ok := f.overrides[name]; ok {
+			s.Override = &v
+		}
+		state = append(state, s)
+	}
+	return state
+}
+
+func (f *Features) updateMetrics() {
+	for name := range featureDefaults {
+		if f.enabledLocked(name) {
+			f.enabled.WithLabelValues(string(name)).Set(1)
+		} else {
+			f.enabled.WithLabelValues(string(name)).Set(0)
+		}
+	}
+}
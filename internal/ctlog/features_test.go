@@ -0,0 +1,47 @@
+package ctlog_test
+
+import (
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func TestFeatures(t *testing.T) {
+	var nilFeatures *ctlog.Features
+	if nilFeatures.Enabled(ctlog.FeatureConditionalWrites) || !nilFeatures.Enabled(ctlog.FeatureHedgedUploads) {
+		t.Error("nil Features don't have the defaults")
+	}
+	if _, err := ctlog.NewFeatures(map[string]bool{"nope": true}); err == nil {
+		t.Error("expected unknown feature to be rejected")
+	}
+
+	f, err := ctlog.NewFeatures(map[string]bool{"conditional-writes": true})
+	fatalIfErr(t, err)
+	if !f.Enabled(ctlog.FeatureConditionalWrites) {
+		t.Error("configured feature is not enabled")
+	}
+	fatalIfErr(t, f.Override(ctlog.FeatureConditionalWrites, false))
+	if f.Enabled(ctlog.FeatureConditionalWrites) {
+		t.Error("override didn't disable the feature")
+	}
+	fatalIfErr(t, f.SetConfig(map[string]bool{"conditional-writes": true, "hedged-uploads": false}))
+	if f.Enabled(ctlog.FeatureConditionalWrites) {
+		t.Error("config change replaced the override")
+	}
+	if f.Enabled(ctlog.FeatureHedgedUploads) {
+		t.Error("config change was not applied")
+	}
+	fatalIfErr(t, f.ClearOverride(ctlog.FeatureConditionalWrites))
+	if !f.Enabled(ctlog.FeatureConditionalWrites) {
+		t.Error("clearing the override didn't restore the configured value")
+	}
+	if err := f.Override("nope", true); err == nil {
+		t.Error("expected override of unknown feature to fail")
+	}
+
+	for _, s := range f.State() {
+		if s.Name == ctlog.FeatureHedgedUploads && (s.Enabled || !s.Default || s.Config == nil || s.Override != nil) {
+			t.Errorf("unexpected state %+v", s)
+		}
+	}
+}
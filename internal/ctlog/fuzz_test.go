@@ -0,0 +1,213 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"filippo.io/sunlight"
+	sunlightclient "filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// The Fuzz targets below exercise the parsers of untrusted inputs. Without
+// -fuzz they only run their seed corpus. Run one continuously with, for
+// example,
+//
+//	go test ./internal/ctlog -run '^$' -fuzz '^FuzzAddChain$'
+//
+// Inputs that crash or violate an invariant are minimized and saved under
+// testdata/fuzz, where they become regression tests once committed.
+
+// FuzzAddChain submits arbitrary add-chain and add-pre-chain bodies, which
+// must never cause a server error.
+func FuzzAddChain(f *testing.F) {
+	tl := NewEmptyTestLog(f)
+	tl.Quiet()
+	tl.StartSequencer()
+
+	for _, chain := range [][][]byte{
+		{testLeaf, testIntermediate, testRoot},
+		{testPrecert, testIntermediate, testRoot},
+		{testIntermediate, testRoot},
+		{testLeaf},
+		{},
+	} {
+		body, err := json.Marshal(map[string][][]byte{"chain": chain})
+		fatalIfErr(f, err)
+		f.Add(body, false)
+		f.Add(body, true)
+	}
+	f.Add([]byte(`{"chain":["AA=="]}`), false)
+	f.Add([]byte(`{"chain":null}`), true)
+	f.Add([]byte(`{}`), false)
+
+	f.Fuzz(func(t *testing.T, body []byte, precert bool) {
+		path := "/ct/v1/add-chain"
+		if precert {
+			path = "/ct/v1/add-pre-chain"
+		}
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		switch rr.Code {
+		case http.StatusOK, http.StatusBadRequest:
+		default:
+			t.Errorf("got status %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
+
+// FuzzChainLeaf submits arbitrary DER as the leaf of a chain to a real
+// intermediate and root, which is closer to what a malicious submitter would
+// send than FuzzAddChain. Accepted leaves must be sequenced as submitted.
+func FuzzChainLeaf(f *testing.F) {
+	tl := NewEmptyTestLog(f)
+	tl.Quiet()
+	tl.StartSequencer()
+	pkix, err := x509.MarshalPKIXPublicKey(tl.Config.Key.Public())
+	fatalIfErr(f, err)
+	logID := sha256.Sum256(pkix)
+
+	f.Add(testLeaf, false)
+	f.Add(testPrecert, true)
+	f.Add(testIntermediate, false)
+	f.Add(testLeaf[:len(testLeaf)/2], false)
+
+	f.Fuzz(func(t *testing.T, leaf []byte, precert bool) {
+		body, err := json.Marshal(map[string][][]byte{"chain": {leaf, testIntermediate, testRoot}})
+		fatalIfErr(t, err)
+		path := "/ct/v1/add-chain"
+		if precert {
+			path = "/ct/v1/add-pre-chain"
+		}
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		switch rr.Code {
+		case http.StatusBadRequest:
+			return
+		case http.StatusOK:
+		default:
+			t.Fatalf("got status %d: %s", rr.Code, rr.Body.String())
+		}
+		var sct struct {
+			ID         []byte
+			Timestamp  int64
+			Extensions []byte
+		}
+		fatalIfErr(t, json.Unmarshal(rr.Body.Bytes(), &sct))
+		if !bytes.Equal(sct.ID, logID[:]) {
+			t.Errorf("got SCT log ID %x, expected %x", sct.ID, logID)
+		}
+		idx, err := ctlog.ParseExtensions(sct.Extensions)
+		fatalIfErr(t, err)
+		e := entryAt(t, tl, idx)
+		if e.Timestamp != sct.Timestamp || e.IsPrecert != precert {
+			t.Errorf("entry %d doesn't match its SCT", idx)
+		}
+		if !precert && !bytes.Equal(e.Certificate, leaf) {
+			t.Errorf("entry %d is not the submitted leaf", idx)
+		}
+		if precert && !bytes.Equal(e.PreCertificate, leaf) {
+			t.Errorf("entry %d is not the submitted precertificate", idx)
+		}
+	})
+}
+
+// FuzzReadTileLeaf decodes arbitrary data tiles, and checks that the log and
+// the client agree, and that decoded entries re-encode to the same bytes.
+func FuzzReadTileLeaf(f *testing.F) {
+	intermediate, err := ctx509.ParseCertificate(testIntermediate)
+	fatalIfErr(f, err)
+	precert, err := ctx509.ParseCertificate(testPrecert)
+	fatalIfErr(f, err)
+	tbs, err := ctx509.RemoveCTPoison(precert.RawTBSCertificate)
+	fatalIfErr(f, err)
+	cert := &ctlog.SequencedLogEntry{LogEntry: ctlog.LogEntry{Certificate: testLeaf},
+		LeafIndex: 42, Timestamp: 1704067200000}
+	pre := &ctlog.SequencedLogEntry{LogEntry: ctlog.LogEntry{Certificate: tbs, IsPrecert: true,
+		PreCertificate: testPrecert, PrecertSigningCert: testIntermediate,
+		IssuerKeyHash: sha256.Sum256(intermediate.RawSubjectPublicKeyInfo)},
+		LeafIndex: 1<<40 - 1, Timestamp: 1704067200001}
+	f.Add(cert.TileLeaf())
+	f.Add(pre.TileLeaf())
+	f.Add(pre.AppendTileLeaf(cert.TileLeaf()))
+	if tile, err := os.ReadFile("testdata/vectors/log/tile/8/data/000.p/2"); err == nil {
+		f.Add(tile)
+	}
+
+	f.Fuzz(func(t *testing.T, tile []byte) {
+		e, rest, err := ctlog.ReadTileLeaf(tile)
+		ce, crest, cerr := sunlightclient.ReadTileLeaf(tile)
+		if (err == nil) != (cerr == nil) {
+			t.Fatalf("log error %v, client error %v", err, cerr)
+		}
+		if err != nil {
+			return
+		}
+		if len(rest) != len(crest) {
+			t.Errorf("log left %d bytes, client left %d", len(rest), len(crest))
+		}
+		if got := e.TileLeaf(); !bytes.Equal(got, tile[:len(tile)-len(rest)]) {
+			t.Errorf("entry re-encodes to %x, decoded from %x", got, tile[:len(tile)-len(rest)])
+		}
+		if !bytes.Equal(e.MerkleTreeLeaf(), ce.MerkleTreeLeaf()) {
+			t.Errorf("log and client MerkleTreeLeaf differ")
+		}
+		if e.LeafIndex != ce.LeafIndex || e.Timestamp != ce.Timestamp ||
+			!bytes.Equal(e.PreCertificate, ce.PreCertificate) ||
+			!bytes.Equal(e.PrecertSigningCert, ce.PrecertSigningCert) {
+			t.Errorf("log and client entries differ")
+		}
+	})
+}
+
+// FuzzCheckpoint parses arbitrary checkpoints and signed notes. Parsed
+// checkpoints must format back to the same text, and notes that verify must
+// be valid checkpoints.
+func FuzzCheckpoint(f *testing.F) {
+	keyPEM, err := os.ReadFile("testdata/vectors/key.pem")
+	fatalIfErr(f, err)
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		f.Fatal("invalid key.pem")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	fatalIfErr(f, err)
+	signed, err := os.ReadFile("testdata/vectors/log/checkpoint")
+	fatalIfErr(f, err)
+	f.Add(signed)
+	f.Add([]byte("example.com/TestLog\n0\n47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=\n"))
+	f.Add([]byte("example.com/TestLog\n1\n47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=\nextension\n"))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if c, err := sunlight.ParseCheckpoint(string(b)); err == nil {
+			if got := sunlight.FormatCheckpoint(c); got != string(b) {
+				t.Errorf("checkpoint %q formats as %q", b, got)
+			}
+		}
+
+		var timestamp uint64
+		v, err := sunlight.NewRFC6962Verifier("example.com/TestLog", k.(*ecdsa.PrivateKey).Public(),
+			func(ts uint64) { timestamp = ts })
+		fatalIfErr(t, err)
+		n, err := note.Open(b, note.VerifierList(v))
+		if err != nil {
+			return
+		}
+		if _, err := sunlight.ParseCheckpoint(n.Text); err != nil {
+			t.Errorf("verified note is not a checkpoint: %v", err)
+		}
+		if timestamp == 0 {
+			t.Errorf("verified note has no timestamp")
+		}
+	})
+}
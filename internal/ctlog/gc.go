@@ -0,0 +1,182 @@
+package ctlog
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"iter"
+	"time"
+
+	"filippo.io/sunlight"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// A GCBackend is a Backend that can also list and delete objects, as needed
+// by [CollectGarbage].
+type GCBackend interface {
+	Backend
+
+	// List returns the objects with keys starting with prefix, in
+	// lexicographic order.
+	List(ctx context.Context, prefix string) iter.Seq2[ObjectInfo, error]
+
+	// Delete deletes the objects with the given keys. Objects that don't
+	// exist are ignored.
+	Delete(ctx context.Context, keys []string) error
+}
+
+// ObjectInfo describes an object returned by [GCBackend.List].
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// GCOptions are the options of [CollectGarbage].
+type GCOptions struct {
+	// Delete is true if the garbage objects should be deleted. Otherwise,
+	// they are only reported.
+	Delete bool
+
+	// Orphans is true if tiles beyond the latest checkpoint, uploaded by
+	// sequencing rounds that failed before committing it, should be collected
+	// too. Those might be uploaded again by a concurrent sequencer, so this is
+	// only safe while the log is not running.
+	Orphans bool
+
+	// MinAge is the minimum age of an object to be collected, to let clients
+	// that fetched a recent checkpoint read the partial tiles it requires.
+	MinAge time.Duration
+}
+
+// GCResult reports the garbage objects found by [CollectGarbage].
+type GCResult struct {
+	// Obsolete and Orphaned are the keys of the partial tiles superseded by a
+	// wider tile of the published tree, and of the tiles beyond the latest
+	// checkpoint.
+	Obsolete []string
+	Orphaned []string
+
+	// Bytes is the total size of the garbage objects.
+	Bytes int64
+
+	// Deleted is the number of objects that were deleted.
+	Deleted int
+}
+
+// gcDeleteBatch is the maximum number of keys passed to each Delete call.
+const gcDeleteBatch = 1000
+
+// CollectGarbage lists the tiles in config.Backend, which must implement
+// [GCBackend], and finds the ones that are no longer needed.
+//
+// Partial tiles are obsolete once the checkpoint in object storage includes a
+// wider or full version of the same tile, since clients can truncate it.
+// Sunlight uploads tiles in place, so a sequencing round that fails after
+// uploading tiles but before committing the checkpoint to the lock backend
+// leaves behind tiles beyond it, which are only collected if opts.Orphans is
+// set. No other objects are ever collected.
+func CollectGarbage(ctx context.Context, config *Config, opts *GCOptions) (*GCResult, error) {
+	b, ok := config.Backend.(GCBackend)
+	if !ok {
+		return nil, fmtErrorf("backend doesn't support listing and deleting objects")
+	}
+
+	pkix, err := x509.MarshalPKIXPublicKey(config.Key.Public())
+	if err != nil {
+		return nil, fmtErrorf("couldn't marshal public key: %w", err)
+	}
+	lock, err := config.Lock.Fetch(ctx, sha256.Sum256(pkix))
+	if err != nil {
+		return nil, fmtErrorf("couldn't fetch checkpoint from lock database: %w", err)
+	}
+	locked, err := openCheckpoint(config.Name, config.Key.Public(), lock.Bytes())
+	if err != nil {
+		return nil, fmtErrorf("invalid lock checkpoint: %w", err)
+	}
+	signed, err := b.Fetch(ctx, "checkpoint")
+	if err != nil {
+		return nil, fmtErrorf("couldn't fetch checkpoint: %w", err)
+	}
+	published, err := openCheckpoint(config.Name, config.Key.Public(), signed)
+	if err != nil {
+		return nil, fmtErrorf("invalid checkpoint in object storage: %w", err)
+	}
+	if published.N > locked.N {
+		return nil, fmtErrorf("checkpoint in object storage is newer than lock checkpoint: %d > %d",
+			published.N, locked.N)
+	}
+	config.Log.InfoContext(ctx, "collecting garbage", "tree_size", published.N,
+		"lock_tree_size", locked.N, "delete", opts.Delete, "orphans", opts.Orphans)
+
+	res := &GCResult{}
+	var garbage []string
+	minTime := time.Now().Add(-opts.MinAge)
+	for obj, err := range b.List(ctx, "tile/") {
+		if err != nil {
+			return nil, fmtErrorf("failed to list tiles: %w", err)
+		}
+		t, err := tlog.ParseTilePath(obj.Key)
+		if err != nil || t.H != TileHeight || obj.LastModified.After(minTime) {
+			continue
+		}
+		switch w := tileWidthAt(t, locked.N); {
+		case t.W > w:
+			if !opts.Orphans {
+				continue
+			}
+			res.Orphaned = append(res.Orphaned, obj.Key)
+			config.Log.DebugContext(ctx, "orphaned tile", "key", obj.Key, "size", obj.Size)
+		case t.W < tileWidthAt(t, published.N):
+			res.Obsolete = append(res.Obsolete, obj.Key)
+			config.Log.DebugContext(ctx, "obsolete partial tile", "key", obj.Key, "size", obj.Size)
+		default:
+			continue
+		}
+		garbage = append(garbage, obj.Key)
+		res.Bytes += obj.Size
+	}
+
+	for opts.Delete && len(garbage) > 0 {
+		batch := garbage[:min(len(garbage), gcDeleteBatch)]
+		if err := b.Delete(ctx, batch); err != nil {
+			return res, fmtErrorf("failed to delete tiles: %w", err)
+		}
+		res.Deleted += len(batch)
+		garbage = garbage[len(batch):]
+	}
+	config.Log.InfoContext(ctx, "collected garbage", "obsolete", len(res.Obsolete),
+		"orphaned", len(res.Orphaned), "bytes", res.Bytes, "deleted", res.Deleted)
+	return res, nil
+}
+
+// tileWidthAt returns the width of the tile with the same level and index as
+// t in a tree of size n, which is zero if the tree doesn't reach it.
+func tileWidthAt(t tlog.Tile, n int64) int {
+	level := max(t.L, 0) // data tiles have the same width as level 0 tiles.
+	hashes := n >> (TileHeight * level)
+	return int(min(max(hashes-t.N*tileWidth, 0), tileWidth))
+}
+
+// openCheckpoint verifies the signature of a checkpoint of the named log, and
+// parses it.
+func openCheckpoint(name string, key crypto.PublicKey, signed []byte) (sunlight.Checkpoint, error) {
+	v, err := sunlight.NewRFC6962Verifier(name, key, nil)
+	if err != nil {
+		return sunlight.Checkpoint{}, fmtErrorf("couldn't construct verifier: %w", err)
+	}
+	n, err := note.Open(signed, note.VerifierList(v))
+	if err != nil {
+		return sunlight.Checkpoint{}, fmtErrorf("couldn't verify checkpoint signature: %w", err)
+	}
+	c, err := sunlight.ParseCheckpoint(n.Text)
+	if err != nil {
+		return sunlight.Checkpoint{}, fmtErrorf("couldn't parse checkpoint: %w", err)
+	}
+	if c.Origin != name {
+		return sunlight.Checkpoint{}, fmtErrorf("checkpoint name is %q, not %q", c.Origin, name)
+	}
+	return c, nil
+}
@@ -0,0 +1,104 @@
+package ctlog_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	ctx := context.Background()
+
+	for i := 0; i < tileWidth+10; i++ {
+		addCertificate(t, tl)
+		if i%7 == 0 {
+			fatalIfErr(t, tl.Log.Sequence())
+		}
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	treeSize := int64(tileWidth + 10)
+
+	// Tiles from a sequencing round that failed before committing the checkpoint.
+	orphans := []string{"tile/8/0/001.p/20", "tile/8/data/001.p/20", "tile/8/0/002"}
+	for _, key := range orphans {
+		fatalIfErr(t, tl.Config.Backend.Upload(ctx, key, []byte("orphan"), nil))
+	}
+
+	b := tl.Config.Backend.(*MemoryBackend)
+	countTiles := func() int {
+		var n int
+		for range b.List(ctx, "tile/") {
+			n++
+		}
+		return n
+	}
+	before := countTiles()
+
+	res, err := ctlog.CollectGarbage(ctx, tl.Config, &ctlog.GCOptions{})
+	fatalIfErr(t, err)
+	if len(res.Obsolete) == 0 || len(res.Orphaned) != 0 || res.Deleted != 0 {
+		t.Errorf("dry run: got %d obsolete, %d orphaned, %d deleted",
+			len(res.Obsolete), len(res.Orphaned), res.Deleted)
+	}
+	if n := countTiles(); n != before {
+		t.Errorf("dry run deleted %d tiles", before-n)
+	}
+	for _, key := range res.Obsolete {
+		tile, err := tlog.ParseTilePath(key)
+		fatalIfErr(t, err)
+		if tile.W == tileWidth {
+			t.Errorf("full tile %q is obsolete", key)
+		}
+	}
+
+	res, err = ctlog.CollectGarbage(ctx, tl.Config, &ctlog.GCOptions{Delete: true})
+	fatalIfErr(t, err)
+	if res.Deleted != len(res.Obsolete) {
+		t.Errorf("deleted %d tiles, expected %d", res.Deleted, len(res.Obsolete))
+	}
+	if n := countTiles(); n != before-len(res.Obsolete) {
+		t.Errorf("%d tiles left, expected %d", n, before-len(res.Obsolete))
+	}
+	for _, key := range orphans {
+		if _, err := b.Fetch(ctx, key); err != nil {
+			t.Errorf("orphan %q was deleted without Orphans", key)
+		}
+	}
+
+	res, err = ctlog.CollectGarbage(ctx, tl.Config, &ctlog.GCOptions{Delete: true, Orphans: true})
+	fatalIfErr(t, err)
+	if len(res.Obsolete) != 0 || len(res.Orphaned) != len(orphans) {
+		t.Errorf("got obsolete %q and orphaned %q", res.Obsolete, res.Orphaned)
+	}
+	for _, key := range orphans {
+		if _, err := b.Fetch(ctx, key); err == nil {
+			t.Errorf("orphan %q was not deleted", key)
+		}
+	}
+
+	// The log is still complete, and can be loaded and extended.
+	tl.CheckLog()
+	tl = ReloadLog(t, tl)
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	tl.CheckLog()
+	if s := tl.Log.DebugState(); s.TreeSize != treeSize+1 {
+		t.Errorf("tree size is %d, expected %d", s.TreeSize, treeSize+1)
+	}
+
+	// The minimum age protects recent tiles.
+	res, err = ctlog.CollectGarbage(ctx, tl.Config, &ctlog.GCOptions{MinAge: time.Hour})
+	fatalIfErr(t, err)
+	if len(res.Obsolete) != 0 {
+		t.Errorf("got %d obsolete tiles younger than MinAge", len(res.Obsolete))
+	}
+	res, err = ctlog.CollectGarbage(ctx, tl.Config, &ctlog.GCOptions{})
+	fatalIfErr(t, err)
+	if len(res.Obsolete) == 0 {
+		t.Errorf("got no obsolete tiles after sequencing")
+	}
+}
@@ -0,0 +1,111 @@
+package ctlog
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// parallelHashingMinLeaves is the smallest batch that is hashed in parallel.
+// Smaller batches are not worth the goroutine overhead.
+const parallelHashingMinLeaves = 512
+
+// hashingSubtreeHeight is the height of the aligned subtrees that are hashed
+// by a single worker. A subtree of 256 leaves matches a full tile.
+const hashingSubtreeHeight = TileHeight
+
+// storedHashes returns the hashes that tlog.StoredHashes would return for
+// each leaf appended to a tree of size n, concatenated. That is, the stored
+// hashes from index tlog.StoredHashIndex(0, n) to tlog.StoredHashIndex(0,
+// n+len(leaves)), exclusive.
+//
+// Large batches are split into aligned subtrees, which workers pick up one at
+// a time, computing both the leaf hashes and the internal nodes of each. The
+// few nodes above the subtrees are computed last.
+func storedHashes(n int64, leaves [][]byte, r tlog.HashReader) ([]tlog.Hash, error) {
+	end := n + int64(len(leaves))
+	base := tlog.StoredHashIndex(0, n)
+	hashes := make([]tlog.Hash, tlog.StoredHashIndex(0, end)-base)
+	if len(leaves) == 0 {
+		return hashes, nil
+	}
+
+	// At each level, only the leftmost new node can have a child that is
+	// already in the tree (if the tree size is not a multiple of the node
+	// width). Read all of them at once, before the hashing starts.
+	var oldIndexes []int64
+	var oldLevels []int
+	for level := 1; end>>level > n>>level; level++ {
+		if left := 2 * (n >> level); left < n>>(level-1) {
+			oldIndexes = append(oldIndexes, tlog.StoredHashIndex(level-1, left))
+			oldLevels = append(oldLevels, level-1)
+		}
+	}
+	old := make(map[int]tlog.Hash, len(oldIndexes))
+	if len(oldIndexes) > 0 {
+		oldHashes, err := r.ReadHashes(oldIndexes)
+		if err != nil {
+			return nil, err
+		}
+		if len(oldHashes) != len(oldIndexes) {
+			return nil, fmtErrorf("bad read length %d, expected %d", len(oldHashes), len(oldIndexes))
+		}
+		for i, level := range oldLevels {
+			old[level] = oldHashes[i]
+		}
+	}
+
+	node := func(level int, i int64) tlog.Hash {
+		if i < n>>level {
+			return old[level]
+		}
+		return hashes[tlog.StoredHashIndex(level, i)-base]
+	}
+	// hashRange computes the new nodes at levels from..to (inclusive) that
+	// cover the leaves in [start, stop).
+	hashRange := func(from, to int, start, stop int64) {
+		for level := from; level <= to; level++ {
+			lo, hi := max(n>>level, start>>level), min(end>>level, stop>>level)
+			for i := lo; i < hi; i++ {
+				var h tlog.Hash
+				if level == 0 {
+					h = tlog.RecordHash(leaves[i-n])
+				} else {
+					h = tlog.NodeHash(node(level-1, 2*i), node(level-1, 2*i+1))
+				}
+				hashes[tlog.StoredHashIndex(level, i)-base] = h
+			}
+		}
+	}
+
+	if len(leaves) < parallelHashingMinLeaves {
+		hashRange(0, 63, n, end)
+		return hashes, nil
+	}
+
+	// The subtrees are disjoint and depend only on their own leaves and on
+	// the old nodes read above, so they can be computed concurrently.
+	const width = 1 << hashingSubtreeHeight
+	first, last := n/width, (end-1)/width
+	var next atomic.Int64
+	next.Store(first)
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), int(last-first+1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				s := next.Add(1) - 1
+				if s > last {
+					return
+				}
+				hashRange(0, hashingSubtreeHeight, s*width, (s+1)*width)
+			}
+		}()
+	}
+	wg.Wait()
+	hashRange(hashingSubtreeHeight+1, 63, n, end)
+	return hashes, nil
+}
@@ -0,0 +1,61 @@
+package ctlog_test
+
+import (
+	"fmt"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestStoredHashes(t *testing.T) {
+	const minLeaves = ctlog.ParallelHashingMinLeaves
+	const width = 1 << ctlog.TileHeight
+	for _, n := range []int64{0, 1, 3, width - 1, width, width + 7, 3 * width, 5*width + 100} {
+		for _, batch := range []int{1, 2, minLeaves - 1, minLeaves, minLeaves + 1,
+			2*width + 3, 4 * width} {
+			t.Run(fmt.Sprintf("%d+%d", n, batch), func(t *testing.T) {
+				var stored []tlog.Hash
+				r := tlog.HashReaderFunc(func(indexes []int64) ([]tlog.Hash, error) {
+					var hashes []tlog.Hash
+					for _, i := range indexes {
+						if i >= int64(len(stored)) {
+							return nil, fmt.Errorf("missing hash %d", i)
+						}
+						hashes = append(hashes, stored[i])
+					}
+					return hashes, nil
+				})
+				leaf := func(i int64) []byte { return fmt.Appendf(nil, "leaf %d", i) }
+				appendLeaf := func(i int64) {
+					h, err := tlog.StoredHashes(i, leaf(i), r)
+					fatalIfErr(t, err)
+					stored = append(stored, h...)
+				}
+				for i := int64(0); i < n; i++ {
+					appendLeaf(i)
+				}
+				base := len(stored)
+
+				var leaves [][]byte
+				for i := n; i < n+int64(batch); i++ {
+					leaves = append(leaves, leaf(i))
+				}
+				got, err := ctlog.StoredHashes(n, leaves, r)
+				fatalIfErr(t, err)
+				for i := n; i < n+int64(batch); i++ {
+					appendLeaf(i)
+				}
+				want := stored[base:]
+				if len(got) != len(want) {
+					t.Fatalf("got %d hashes, expected %d", len(got), len(want))
+				}
+				for i := range want {
+					if got[i] != want[i] {
+						t.Fatalf("hash at index %d is %v, expected %v", base+i, got[i], want[i])
+					}
+				}
+			})
+		}
+	}
+}
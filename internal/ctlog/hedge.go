@@ -0,0 +1,202 @@
+package ctlog
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HedgingOptions configure when an [S3Backend] with [FeatureHedgedUploads]
+// sends a second, competing upload request. The zero value uses the defaults.
+//
+// The hedge is sent once the first request has taken longer than Quantile of
+// the recent requests of the same object class, so that when the backend is
+// slow for everyone the delay grows with it, and only the outliers are
+// hedged. MaxRate bounds the extra load hedging adds in any case.
+type HedgingOptions struct {
+	// Quantile is the quantile of the recent latencies after which a request
+	// is hedged, between 0 and 1. Defaults to 0.95.
+	Quantile float64
+
+	// MaxRate is the maximum fraction of requests that are hedged, between 0
+	// and 1. Defaults to 0.1.
+	MaxRate float64
+
+	// MinDelay and MaxDelay bound the hedging delay. They default to 10ms and
+	// 1s. Until enough latencies are recorded, the delay is 75ms, within the
+	// bounds.
+	MinDelay, MaxDelay time.Duration
+}
+
+const (
+	// hedgeWindow is the number of recent latencies kept per object class.
+	hedgeWindow = 1000
+	// hedgeMinSamples is the number of latencies needed to compute the delay.
+	hedgeMinSamples = 50
+	// hedgeRecompute is how many latencies are recorded between updates of
+	// the delay, to amortize sorting the window.
+	hedgeRecompute = 32
+	// hedgeBurst is how many hedges can be sent back to back, in excess of
+	// MaxRate, after a period without them.
+	hedgeBurst = 10
+
+	defaultHedgeDelay = 75 * time.Millisecond
+)
+
+// Check returns an error if o has out of range values.
+func (o HedgingOptions) Check() error {
+	if o.Quantile < 0 || o.Quantile > 1 {
+		return fmtErrorf("invalid hedging quantile %v", o.Quantile)
+	}
+	if o.MaxRate < 0 || o.MaxRate > 1 {
+		return fmtErrorf("invalid hedging max rate %v", o.MaxRate)
+	}
+	if o.MinDelay < 0 || o.MaxDelay < 0 ||
+		(o.MinDelay != 0 && o.MaxDelay != 0 && o.MinDelay > o.MaxDelay) {
+		return fmtErrorf("invalid hedging delay bounds %v and %v", o.MinDelay, o.MaxDelay)
+	}
+	return nil
+}
+
+// hedger tracks the upload latencies by object class, and decides when to
+// hedge.
+type hedger struct {
+	quantile           float64
+	maxRate            float64
+	minDelay, maxDelay time.Duration
+
+	delayGauge *prometheus.GaugeVec
+	capped     prometheus.Counter
+
+	mu      sync.Mutex
+	classes map[ObjectClass]*latencyWindow
+	// tokens is a token bucket refilled by maxRate with every request, and
+	// spent by every hedge.
+	tokens float64
+}
+
+type latencyWindow struct {
+	samples []time.Duration // ring buffer of up to hedgeWindow latencies
+	next    int
+	pending int // latencies recorded since delay was computed
+	delay   time.Duration
+}
+
+func newHedger() *hedger {
+	h := &hedger{
+		delayGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "s3_hedge_delay_seconds",
+				Help: "Current delay after which S3 uploads are hedged, by object class.",
+			},
+			[]string{"class"},
+		),
+		capped: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "s3_hedges_capped_total",
+				Help: "S3 hedge requests that were not launched because of the hedging rate limit.",
+			},
+		),
+		classes: make(map[ObjectClass]*latencyWindow),
+		tokens:  hedgeBurst,
+	}
+	h.setOptions(HedgingOptions{})
+	return h
+}
+
+func (h *hedger) setOptions(o HedgingOptions) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.quantile, h.maxRate = o.Quantile, o.MaxRate
+	h.minDelay, h.maxDelay = o.MinDelay, o.MaxDelay
+	if h.quantile == 0 {
+		h.quantile = 0.95
+	}
+	if h.maxRate == 0 {
+		h.maxRate = 0.1
+	}
+	if h.minDelay == 0 {
+		h.minDelay = 10 * time.Millisecond
+		if h.maxDelay != 0 {
+			h.minDelay = min(h.minDelay, h.maxDelay)
+		}
+	}
+	if h.maxDelay == 0 {
+		h.maxDelay = max(1*time.Second, h.minDelay)
+	}
+}
+
+func (h *hedger) window(class ObjectClass) *latencyWindow {
+	w := h.classes[class]
+	if w == nil {
+		w = &latencyWindow{samples: make([]time.Duration, 0, hedgeWindow)}
+		w.delay = min(max(defaultHedgeDelay, h.minDelay), h.maxDelay)
+		h.classes[class] = w
+		h.delayGauge.WithLabelValues(string(class)).Set(w.delay.Seconds())
+	}
+	return w
+}
+
+// delay returns how long to wait before hedging a request of class, and
+// refills the hedging budget for the request.
+func (h *hedger) delay(class ObjectClass) time.Duration {
+	if class == "" {
+		class = ObjectClassOther
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens = min(h.tokens+h.maxRate, hedgeBurst)
+	return h.window(class).delay
+}
+
+// allow reports whether a hedge can be sent within the rate limit, and if so
+// spends its budget.
+func (h *hedger) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1 {
+		h.capped.Inc()
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+// observe records the latency of a completed request of class, which for a
+// hedged request is the time until either request completed.
+func (h *hedger) observe(class ObjectClass, d time.Duration) {
+	if class == "" {
+		class = ObjectClassOther
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w := h.window(class)
+	if len(w.samples) < hedgeWindow {
+		w.samples = append(w.samples, d)
+	} else {
+		w.samples[w.next] = d
+		w.next = (w.next + 1) % hedgeWindow
+	}
+	w.pending++
+	if len(w.samples) < hedgeMinSamples || w.pending < hedgeRecompute {
+		return
+	}
+	w.pending = 0
+	sorted := slices.Clone(w.samples)
+	slices.Sort(sorted)
+	q := sorted[min(int(h.quantile*float64(len(sorted))), len(sorted)-1)]
+	w.delay = min(max(q, h.minDelay), h.maxDelay)
+	h.delayGauge.WithLabelValues(string(class)).Set(w.delay.Seconds())
+}
+
+// SetHedging applies o to the uploads hedged because of
+// [FeatureHedgedUploads]. It must be called before the backend is used.
+func (s *S3Backend) SetHedging(o HedgingOptions) error {
+	if err := o.Check(); err != nil {
+		return err
+	}
+	s.hedger.setOptions(o)
+	return nil
+}
@@ -0,0 +1,54 @@
+package ctlog_test
+
+import (
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func TestHedgingDelay(t *testing.T) {
+	h := ctlog.NewHedger(ctlog.HedgingOptions{Quantile: 0.9, MaxRate: 0.5, MaxDelay: 500 * time.Millisecond})
+	if d := h.Delay(ctlog.ObjectClassDataTile); d != 75*time.Millisecond {
+		t.Errorf("initial delay is %v, expected 75ms", d)
+	}
+
+	// 1ms to 100ms, so the 90th percentile is about 90ms. The delay is only
+	// recomputed every few samples.
+	for i := range 210 {
+		h.Observe(ctlog.ObjectClassDataTile, time.Duration(i%100+1)*time.Millisecond)
+	}
+	if d := h.Delay(ctlog.ObjectClassDataTile); d < 85*time.Millisecond || d > 95*time.Millisecond {
+		t.Errorf("delay is %v, expected about 90ms", d)
+	}
+	if d := h.Delay(ctlog.ObjectClassOther); d != 75*time.Millisecond {
+		t.Errorf("delay of other class is %v, expected 75ms", d)
+	}
+
+	// When everything is slow, the delay follows, up to MaxDelay.
+	for range 1000 {
+		h.Observe(ctlog.ObjectClassDataTile, 2*time.Second)
+	}
+	if d := h.Delay(ctlog.ObjectClassDataTile); d != 500*time.Millisecond {
+		t.Errorf("delay is %v, expected MaxDelay", d)
+	}
+
+	// After the burst, hedges are allowed for half the requests.
+	var allowed int
+	for range 1000 {
+		h.Delay(ctlog.ObjectClassDataTile)
+		if h.Allow() {
+			allowed++
+		}
+	}
+	if allowed < 500 || allowed > 510 {
+		t.Errorf("allowed %d hedges out of 1000 requests, expected about 500", allowed)
+	}
+
+	if err := (ctlog.HedgingOptions{Quantile: 2}).Check(); err == nil {
+		t.Errorf("quantile 2 was accepted")
+	}
+	if err := (ctlog.HedgingOptions{MinDelay: time.Second, MaxDelay: time.Millisecond}).Check(); err == nil {
+		t.Errorf("MinDelay above MaxDelay was accepted")
+	}
+}
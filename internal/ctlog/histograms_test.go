@@ -0,0 +1,38 @@
+package ctlog_test
+
+import (
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLatencyHistograms(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.LatencyMetrics = ctlog.LatencyNativeHistograms
+	tl = ReloadLog(t, tl)
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(tl.Log.Metrics()...)
+	mfs, err := reg.Gather()
+	fatalIfErr(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() != "sequencing_duration_seconds" {
+			continue
+		}
+		if mf.GetType().String() != "HISTOGRAM" {
+			t.Fatalf("got metric type %v, expected histogram", mf.GetType())
+		}
+		h := mf.GetMetric()[0].GetHistogram()
+		if h.GetSampleCount() != 1 {
+			t.Errorf("got %d samples, expected 1", h.GetSampleCount())
+		}
+		if h.Schema == nil {
+			t.Error("expected a native histogram")
+		}
+		return
+	}
+	t.Fatal("sequencing_duration_seconds not found")
+}
@@ -3,50 +3,106 @@ package ctlog
 import (
 	"bytes"
 	"context"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/subtle"
+	_ "embed"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	ct "github.com/google/certificate-transparency-go"
 	"github.com/google/certificate-transparency-go/trillian/ctfe"
 	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509/pkix"
 	"github.com/google/certificate-transparency-go/x509util"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/mod/sumdb/tlog"
 )
 
 func (l *Log) Handler() http.Handler {
-	addChainLabels := prometheus.Labels{"endpoint": "add-chain"}
-	addChain := http.Handler(http.HandlerFunc(l.addChain))
-	addChain = promhttp.InstrumentHandlerCounter(l.m.ReqCount.MustCurryWith(addChainLabels), addChain)
-	addChain = promhttp.InstrumentHandlerDuration(l.m.ReqDuration.MustCurryWith(addChainLabels), addChain)
-	addChain = promhttp.InstrumentHandlerInFlight(l.m.ReqInFlight.With(addChainLabels), addChain)
-
-	addPreChainLabels := prometheus.Labels{"endpoint": "add-pre-chain"}
-	addPreChain := http.Handler(http.HandlerFunc(l.addPreChain))
-	addPreChain = promhttp.InstrumentHandlerCounter(l.m.ReqCount.MustCurryWith(addPreChainLabels), addPreChain)
-	addPreChain = promhttp.InstrumentHandlerDuration(l.m.ReqDuration.MustCurryWith(addPreChainLabels), addPreChain)
-	addPreChain = promhttp.InstrumentHandlerInFlight(l.m.ReqInFlight.With(addPreChainLabels), addPreChain)
-
-	getRootsLabels := prometheus.Labels{"endpoint": "get-roots"}
-	getRoots := http.Handler(http.HandlerFunc(l.getRoots))
-	getRoots = promhttp.InstrumentHandlerCounter(l.m.ReqCount.MustCurryWith(getRootsLabels), getRoots)
-	getRoots = promhttp.InstrumentHandlerDuration(l.m.ReqDuration.MustCurryWith(getRootsLabels), getRoots)
-	getRoots = promhttp.InstrumentHandlerInFlight(l.m.ReqInFlight.With(getRootsLabels), getRoots)
-
 	mux := http.NewServeMux()
-	mux.Handle("POST /ct/v1/add-chain", addChain)
-	mux.Handle("POST /ct/v1/add-pre-chain", addPreChain)
+	mux.Handle("POST /ct/v1/add-chain", l.instrument("add-chain", http.HandlerFunc(l.addChain)))
+	mux.Handle("POST /ct/v1/add-pre-chain", l.instrument("add-pre-chain", http.HandlerFunc(l.addPreChain)))
+	getRoots := l.cors(l.instrument("get-roots", http.HandlerFunc(l.getRoots)))
 	mux.Handle("GET /ct/v1/get-roots", getRoots)
-	return http.MaxBytesHandler(mux, 128*1024)
+	mux.Handle("OPTIONS /ct/v1/get-roots", getRoots)
+	metadata := l.cors(l.instrument("log.v3.json", http.HandlerFunc(l.getMetadata)))
+	mux.Handle("GET /log.v3.json", metadata)
+	mux.Handle("OPTIONS /log.v3.json", metadata)
+	openAPI := l.cors(l.instrument("openapi.json", http.HandlerFunc(l.getOpenAPI)))
+	mux.Handle("GET /openapi.json", openAPI)
+	mux.Handle("OPTIONS /openapi.json", openAPI)
+	if l.c.MonitoringAPI {
+		checkpoint := l.cors(l.instrument("checkpoint", http.HandlerFunc(l.getObject)))
+		mux.Handle("GET /checkpoint", checkpoint)
+		mux.Handle("OPTIONS /checkpoint", checkpoint)
+		issuers := l.cors(l.instrument("issuers", http.HandlerFunc(l.getObject)))
+		mux.Handle("GET /issuers.pem", issuers)
+		mux.Handle("OPTIONS /issuers.pem", issuers)
+		tile := l.cors(l.instrument("tile", http.HandlerFunc(l.getObject)))
+		mux.Handle("GET /tile/", tile)
+		mux.Handle("OPTIONS /tile/", tile)
+	}
+	// The event stream is only instrumented for in-flight requests, since the
+	// other instrumentation wraps the ResponseWriter and hides its
+	// SetWriteDeadline method.
+	events := l.cors(promhttp.InstrumentHandlerInFlight(
+		l.m.ReqInFlight.With(prometheus.Labels{"endpoint": "checkpoint/events"}),
+		http.HandlerFunc(l.getCheckpointEvents)))
+	mux.Handle("GET /checkpoint/events", events)
+	mux.Handle("OPTIONS /checkpoint/events", events)
+	h := http.MaxBytesHandler(mux, 128*1024)
+	if l.c.TraceExemplars {
+		h = withTraceID(h)
+	}
+	return h
+}
+
+func (l *Log) instrument(endpoint string, h http.Handler) http.Handler {
+	labels := prometheus.Labels{"endpoint": endpoint}
+	h = promhttp.InstrumentHandlerCounter(l.m.ReqCount.MustCurryWith(labels), h)
+	h = promhttp.InstrumentHandlerDuration(l.m.ReqDuration.MustCurryWith(labels), h,
+		promhttp.WithExemplarFromContext(l.traceExemplar))
+	h = promhttp.InstrumentHandlerInFlight(l.m.ReqInFlight.With(labels), h)
+	return h
+}
+
+// cors adds CORS headers to the responses of read endpoints, and answers
+// preflight requests, so that browser-based tools can fetch from the log.
+func (l *Log) cors(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		switch {
+		case len(l.c.CORSOrigins) == 0:
+			rw.Header().Set("Access-Control-Allow-Origin", "*")
+		case slices.Contains(l.c.CORSOrigins, "*"):
+			rw.Header().Set("Access-Control-Allow-Origin", "*")
+		case origin != "" && slices.Contains(l.c.CORSOrigins, origin):
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+			rw.Header().Add("Vary", "Origin")
+		default:
+			rw.Header().Add("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions {
+			rw.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			rw.Header().Set("Access-Control-Max-Age", "86400")
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(rw, r)
+	})
 }
 
 type reusedConnContextKey struct{}
@@ -58,7 +114,7 @@ func ReusedConnContext(ctx context.Context, c net.Conn) context.Context {
 }
 
 func (l *Log) addChain(rw http.ResponseWriter, r *http.Request) {
-	rsp, code, err := l.addChainOrPreChain(r.Context(), r.Body, func(le *LogEntry) error {
+	rsp, code, err := l.addChainOrPreChain(r.Context(), r.Body, r.Header.Get(TestSubmissionHeader), l.clientIP(r), func(le *LogEntry) error {
 		if le.IsPrecert {
 			return fmtErrorf("pre-certificate submitted to add-chain")
 		}
@@ -66,12 +122,7 @@ func (l *Log) addChain(rw http.ResponseWriter, r *http.Request) {
 	})
 	if err != nil {
 		l.c.Log.DebugContext(r.Context(), "add-chain error", "code", code, "err", err)
-		if code == http.StatusServiceUnavailable {
-			rw.Header().Set("Retry-After", fmt.Sprintf("%d", 30+rand.Intn(60)))
-			http.Error(rw, "😮‍💨 this party is popular and the pool is full ✨ please retry later 🥺", code)
-			return
-		}
-		http.Error(rw, err.Error(), code)
+		l.writeSubmissionError(rw, r, code, err)
 		return
 	}
 
@@ -84,7 +135,7 @@ func (l *Log) addChain(rw http.ResponseWriter, r *http.Request) {
 }
 
 func (l *Log) addPreChain(rw http.ResponseWriter, r *http.Request) {
-	rsp, code, err := l.addChainOrPreChain(r.Context(), r.Body, func(le *LogEntry) error {
+	rsp, code, err := l.addChainOrPreChain(r.Context(), r.Body, r.Header.Get(TestSubmissionHeader), l.clientIP(r), func(le *LogEntry) error {
 		if !le.IsPrecert {
 			return fmtErrorf("final certificate submitted to add-pre-chain")
 		}
@@ -92,12 +143,7 @@ func (l *Log) addPreChain(rw http.ResponseWriter, r *http.Request) {
 	})
 	if err != nil {
 		l.c.Log.DebugContext(r.Context(), "add-pre-chain error", "code", code, "err", err)
-		if code == http.StatusServiceUnavailable {
-			rw.Header().Set("Retry-After", fmt.Sprintf("%d", 30+rand.Intn(60)))
-			http.Error(rw, "😮‍💨 this party is popular and the pool is full ✨ please retry later 🥺", code)
-			return
-		}
-		http.Error(rw, err.Error(), code)
+		l.writeSubmissionError(rw, r, code, err)
 		return
 	}
 
@@ -109,19 +155,132 @@ func (l *Log) addPreChain(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (l *Log) addChainOrPreChain(ctx context.Context, reqBody io.ReadCloser, checkType func(*LogEntry) error) (response []byte, code int, err error) {
+// writeSubmissionError writes the response to an add-chain or add-pre-chain
+// request that failed with err and code, adding a Retry-After header to the
+// temporary failures.
+func (l *Log) writeSubmissionError(rw http.ResponseWriter, r *http.Request, code int, err error) {
+	switch {
+	case err == errMaintenance:
+		l.writeMaintenance(rw, r)
+	case errors.Is(err, errClockSkew):
+		rw.Header().Set("Retry-After", fmt.Sprintf("%d", clockSkewRetryAfter))
+		http.Error(rw, "the log clock is out of sync, please retry later", code)
+	case err == errPassive:
+		rw.Header().Set("Retry-After", fmt.Sprintf("%d", passiveRetryAfter))
+		http.Error(rw, "this log instance is passive, please retry later", code)
+	case code == http.StatusServiceUnavailable:
+		rw.Header().Set("Retry-After", fmt.Sprintf("%d", 30+l.rand.Intn(60)))
+		http.Error(rw, "😮‍💨 this party is popular and the pool is full ✨ please retry later 🥺", code)
+	default:
+		http.Error(rw, err.Error(), code)
+	}
+}
+
+var errMaintenance = fmtErrorf("log in maintenance")
+
+// SetMaintenance puts the log in maintenance mode if message is not empty, and
+// takes it out of maintenance mode otherwise.
+//
+// While in maintenance mode, submissions are rejected with a 503 and the
+// provided message, while reads and the sequencer keep working, so that
+// already pending entries are sequenced normally.
+func (l *Log) SetMaintenance(message string) {
+	if message == "" {
+		l.maintenance.Store(nil)
+		l.m.Maintenance.Set(0)
+		l.c.Log.Info("maintenance mode disabled")
+		return
+	}
+	l.maintenance.Store(&message)
+	l.m.Maintenance.Set(1)
+	l.c.Log.Info("maintenance mode enabled", "message", message)
+}
+
+// maintenanceRetryAfter is the Retry-After value, in seconds, of responses to
+// submissions while in maintenance mode.
+const maintenanceRetryAfter = 300
+
+func (l *Log) writeMaintenance(rw http.ResponseWriter, r *http.Request) {
+	var res struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	res.Error = "maintenance"
+	if m := l.maintenance.Load(); m != nil {
+		res.Message = *m
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Retry-After", fmt.Sprintf("%d", maintenanceRetryAfter))
+	rw.WriteHeader(http.StatusServiceUnavailable)
+	if err := json.NewEncoder(rw).Encode(res); err != nil {
+		l.c.Log.DebugContext(r.Context(), "failed to write maintenance response", "err", err)
+	}
+}
+
+var errValidationsBusy = fmtErrorf("too many concurrent validations")
+var errSubmissionTimeout = fmtErrorf("submission timed out")
+
+// acquireValidation waits for a chain validation slot, if
+// Config.MaxConcurrentValidations is set, and returns a function that
+// releases it, which can be called multiple times.
+func (l *Log) acquireValidation(ctx context.Context) (release func(), err error) {
+	if l.validations == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.validations <- struct{}{}:
+	case <-ctx.Done():
+		return nil, errValidationsBusy
+	}
+	return sync.OnceFunc(func() { <-l.validations }), nil
+}
+
+func (l *Log) addChainOrPreChain(ctx context.Context, reqBody io.ReadCloser, testToken, clientIP string, checkType func(*LogEntry) error) (response []byte, code int, err error) {
 	labels := prometheus.Labels{"error": "", "issuer": "", "root": "", "reused": "",
 		"precert": "", "preissuer": "", "chain_len": "", "source": ""}
+	var issuer string
+	start := time.Now()
 	defer func() {
 		if err != nil {
 			labels["error"] = errorCategory(err)
 		}
+		if issuer != "" {
+			l.m.AddChainIssuers.observe(issuer)
+			labels["issuer"] = l.m.AddChainIssuers.label(issuer)
+			l.observe(l.m.AddChainDuration.WithLabelValues(labels["issuer"]),
+				time.Since(start).Seconds(), traceID(ctx))
+		}
 		l.m.AddChainCount.With(labels).Inc()
 	}()
 	if b, ok := ctx.Value(reusedConnContextKey{}).(*atomic.Bool); ok && b.Swap(true) {
 		labels["reused"] = "true"
 	}
 
+	if l.maintenance.Load() != nil {
+		return nil, http.StatusServiceUnavailable, errMaintenance
+	}
+	if l.clockSkew.Load() != nil {
+		return nil, http.StatusServiceUnavailable, errClockSkew
+	}
+	if l.passive.Load() {
+		return nil, http.StatusServiceUnavailable, errPassive
+	}
+	if l.c.SubmissionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.c.SubmissionTimeout)
+		defer cancel()
+		defer func() {
+			if err != nil && ctx.Err() == context.DeadlineExceeded {
+				code, err = http.StatusServiceUnavailable, errSubmissionTimeout
+			}
+		}()
+	}
+	release, err := l.acquireValidation(ctx)
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, err
+	}
+	defer release()
+
 	body, err := io.ReadAll(reqBody)
 	if err != nil {
 		return nil, http.StatusInternalServerError, fmtErrorf("failed to read body: %w", err)
@@ -135,14 +294,45 @@ func (l *Log) addChainOrPreChain(ctx context.Context, reqBody io.ReadCloser, che
 	if len(req.Chain) == 0 {
 		return nil, http.StatusBadRequest, fmtErrorf("empty chain")
 	}
+	if l.c.MaxChainLength > 0 && len(req.Chain) > l.c.MaxChainLength {
+		return nil, http.StatusBadRequest, fmtErrorf("chain too long: %d certificates, maximum is %d", len(req.Chain), l.c.MaxChainLength)
+	}
+	for i, der := range req.Chain {
+		if l.c.MaxCertificateSize > 0 && len(der) > l.c.MaxCertificateSize {
+			return nil, http.StatusBadRequest, fmtErrorf("certificate too large: %d bytes at position %d, maximum is %d", len(der), i, l.c.MaxCertificateSize)
+		}
+	}
 
-	chain, err := ctfe.ValidateChain(req.Chain, ctfe.NewCertValidationOpts(l.c.Roots, time.Time{}, false, false, &l.c.NotAfterStart, &l.c.NotAfterLimit, false, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}))
+	// Check the temporal interval before the (more expensive) chain
+	// validation, and with a specific error, since it's the most likely
+	// reason for a valid chain to be rejected.
+	if leaf, err := x509.ParseCertificate(req.Chain[0]); x509.IsFatal(err) {
+		return nil, http.StatusBadRequest, fmtErrorf("invalid leaf certificate: %w", err)
+	} else if err := l.checkNotAfter(leaf); err != nil {
+		return nil, http.StatusBadRequest, err
+	} else if err := l.checkValidity(leaf); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	roots := l.roots.Load().accepted
+	if l.c.TestRootsToken != "" && subtle.ConstantTimeCompare([]byte(testToken), []byte(l.c.TestRootsToken)) == 1 {
+		roots = l.roots.Load().test
+	}
+	chain, alternate, err := l.validateChain(req.Chain, roots)
+	release()
 	if err != nil {
 		return nil, http.StatusBadRequest, fmtErrorf("invalid chain: %w", err)
 	}
+	if alternate {
+		l.m.AddChainAlternatePaths.Inc()
+		l.c.Log.DebugContext(ctx, "using alternate path", "root", x509util.NameToString(chain[len(chain)-1].Subject))
+	}
+	if err := l.checkAlgorithms(chain); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
 	labels["chain_len"] = fmt.Sprintf("%d", len(chain))
 	labels["root"] = x509util.NameToString(chain[len(chain)-1].Subject)
-	labels["issuer"] = x509util.NameToString(chain[0].Issuer)
+	issuer = x509util.NameToString(chain[0].Issuer)
 
 	e := &LogEntry{Certificate: chain[0].Raw}
 	issuers := chain[1:]
@@ -161,17 +351,20 @@ func (l *Log) addChainOrPreChain(ctx context.Context, reqBody io.ReadCloser, che
 			preIssuer = issuers[0]
 			issuers = issuers[1:]
 			labels["preissuer"] = "true"
-			labels["issuer"] = x509util.NameToString(preIssuer.Issuer)
+			issuer = x509util.NameToString(preIssuer.Issuer)
+			if l.c.RejectPrecertSigningCerts {
+				return nil, http.StatusBadRequest, fmtErrorf("precertificate signing certificates are not accepted")
+			}
 			if len(issuers) == 0 {
 				l.c.Log.WarnContext(ctx, "missing precertificate signing certificate issuer", "err", err, "body", body)
 				return nil, http.StatusBadRequest, fmtErrorf("missing precertificate signing certificate issuer")
 			}
 		}
 
-		defangedTBS, err := x509.BuildPrecertTBS(chain[0].RawTBSCertificate, preIssuer)
+		defangedTBS, err := buildPrecertTBS(chain[0], preIssuer)
 		if err != nil {
-			l.c.Log.ErrorContext(ctx, "failed to build TBSCertificate", "err", err, "body", body)
-			return nil, http.StatusInternalServerError, fmtErrorf("failed to build TBSCertificate: %w", err)
+			l.c.Log.WarnContext(ctx, "failed to build TBSCertificate", "err", err, "body", body)
+			return nil, http.StatusBadRequest, fmtErrorf("failed to build TBSCertificate: %w", err)
 		}
 
 		e.IsPrecert = true
@@ -181,10 +374,58 @@ func (l *Log) addChainOrPreChain(ctx context.Context, reqBody io.ReadCloser, che
 			e.PrecertSigningCert = preIssuer.Raw
 		}
 		e.IssuerKeyHash = sha256.Sum256(issuers[0].RawSubjectPublicKeyInfo)
+	} else if len(issuers) > 0 && ct.IsPreIssuer(issuers[0]) {
+		// RFC 6962, Section 3.1: a Precertificate Signing Certificate "MUST
+		// NOT be used to issue certificates other than Precertificates".
+		return nil, http.StatusBadRequest, fmtErrorf("final certificate issued by precertificate signing certificate")
+	} else if l.c.Dedup == DedupTBS && l.c.LoggedPrecert != LoggedPrecertLog && len(issuers) > 0 {
+		tbs := chain[0].RawTBSCertificate
+		if slices.ContainsFunc(chain[0].Extensions, func(ext pkix.Extension) bool {
+			return ext.Id.Equal(x509.OIDExtensionCTSCT)
+		}) {
+			tbs, err = x509.RemoveSCTList(tbs)
+			if err != nil {
+				return nil, http.StatusBadRequest, fmtErrorf("failed to remove SCT list: %w", err)
+			}
+		}
+		issuerKeyHash := sha256.Sum256(issuers[0].RawSubjectPublicKeyInfo)
+		se, err := l.loggedPrecert(tbsCacheHash(issuerKeyHash, tbs))
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmtErrorf("deduplication cache get failed: %w", err)
+		}
+		if se != nil && l.c.LoggedPrecert == LoggedPrecertReject {
+			return nil, http.StatusBadRequest, fmtErrorf("precertificate already logged: at index %d", se.LeafIndex)
+		}
+		if se != nil {
+			labels["source"] = "precert"
+			se.IsPrecert = true
+			se.Certificate = tbs
+			se.IssuerKeyHash = issuerKeyHash
+			rsp, code, err := l.sctResponse(ctx, se, body)
+			if err != nil {
+				return nil, code, err
+			}
+			leafHash := tlog.RecordHash(se.MerkleTreeLeaf())
+			l.audit(auditRecord{
+				Time:      se.Timestamp,
+				LeafIndex: se.LeafIndex,
+				LeafHash:  leafHash[:],
+				Precert:   true,
+				Issuer:    issuer,
+				ClientIP:  clientIP,
+				SCT:       rsp,
+			})
+			return rsp, http.StatusOK, nil
+		}
 	}
 	if err := checkType(e); err != nil {
 		return nil, http.StatusBadRequest, err
 	}
+	if l.c.Policy != nil {
+		if err := l.c.Policy.CheckSubmission(ctx, chain, e.IsPrecert); err != nil {
+			return nil, http.StatusBadRequest, fmtErrorf("rejected by submission policy: %w", err)
+		}
+	}
 
 	var newIssuers bool
 	l.issuersMu.RLock()
@@ -201,25 +442,56 @@ func (l *Log) addChainOrPreChain(ctx context.Context, reqBody io.ReadCloser, che
 		}
 	}
 
-	waitLeaf, source := l.addLeafToPool(e)
+	waitLeaf, source := l.addLeafToPool(ctx, e)
 	labels["source"] = source
+	switch source {
+	case "pool":
+		l.dedupStats.pool.Add(1)
+	case "cache":
+		l.dedupStats.cache.Add(1)
+	case "sequencer":
+		l.dedupStats.misses.Add(1)
+	}
 	waitTimer := prometheus.NewTimer(l.m.AddChainWait)
 	seq, err := waitLeaf(ctx)
 	if source == "sequencer" {
 		waitTimer.ObserveDuration()
 	}
-	if err == errPoolFull {
+	if err == errPoolFull || errors.Is(err, errClockSkew) {
 		return nil, http.StatusServiceUnavailable, err
 	} else if err != nil {
 		return nil, http.StatusInternalServerError, fmtErrorf("failed to sequence leaf: %w", err)
 	}
 
+	rsp, code, err := l.sctResponse(ctx, seq, body)
+	if err != nil {
+		return nil, code, err
+	}
+
+	leafHash := tlog.RecordHash(seq.MerkleTreeLeaf())
+	l.audit(auditRecord{
+		Time:      seq.Timestamp,
+		LeafIndex: seq.LeafIndex,
+		LeafHash:  leafHash[:],
+		Precert:   e.IsPrecert,
+		Issuer:    issuer,
+		ClientIP:  clientIP,
+		SCT:       rsp,
+	})
+
+	return rsp, http.StatusOK, nil
+}
+
+// sctResponse signs an SCT for seq and returns the add-[pre-]chain response.
+func (l *Log) sctResponse(ctx context.Context, seq *SequencedLogEntry, body []byte) ([]byte, int, error) {
 	// The digitally-signed data of an SCT is technically not a MerkleTreeLeaf,
 	// but it's a completely identical structure, except for the second field,
 	// which is a SignatureType of value 0 and length 1 instead of a
 	// MerkleLeafType of value 0 and length 1.
-	sctSignature, err := digitallySign(l.c.Key, seq.MerkleTreeLeaf())
-	if err != nil {
+	sctSignature, err := l.signSCT(ctx, seq.MerkleTreeLeaf())
+	if err == errSigningQueueFull {
+		return nil, http.StatusServiceUnavailable, err
+	} else if err != nil {
 		l.c.Log.ErrorContext(ctx, "failed to sign SCT", "err", err, "body", body)
 		return nil, http.StatusInternalServerError, fmtErrorf("failed to sign SCT: %w", err)
 	}
@@ -235,10 +507,95 @@ func (l *Log) addChainOrPreChain(ctx context.Context, reqBody io.ReadCloser, che
 		l.c.Log.ErrorContext(ctx, "failed to encode response", "err", err, "body", body)
 		return nil, http.StatusInternalServerError, fmtErrorf("failed to encode response: %w", err)
 	}
-
 	return rsp, http.StatusOK, nil
 }
 
+// checkNotAfter checks that the NotAfter of the leaf is within the temporal
+// interval of the log, [NotAfterStart, NotAfterLimit).
+func (l *Log) checkNotAfter(leaf *x509.Certificate) error {
+	if leaf.NotAfter.Before(l.c.NotAfterStart) {
+		return fmtErrorf("NotAfter is before the log temporal interval: %v < %v",
+			leaf.NotAfter.UTC(), l.c.NotAfterStart.UTC())
+	}
+	if !leaf.NotAfter.Before(l.c.NotAfterLimit) {
+		return fmtErrorf("NotAfter is after the log temporal interval: %v >= %v",
+			leaf.NotAfter.UTC(), l.c.NotAfterLimit.UTC())
+	}
+	return nil
+}
+
+// checkValidity checks, if required by the log policy, that the leaf is
+// currently valid, allowing for the configured clock skew, and that its
+// validity period is not too long.
+func (l *Log) checkValidity(leaf *x509.Certificate) error {
+	now := time.UnixMilli(l.c.clock().NowUnixMilli())
+	if l.c.RejectExpired && now.Add(-l.c.ClockSkew).After(leaf.NotAfter) {
+		return fmtErrorf("certificate is expired: NotAfter %v", leaf.NotAfter.UTC())
+	}
+	if l.c.RejectNotYetValid && now.Add(l.c.ClockSkew).Before(leaf.NotBefore) {
+		return fmtErrorf("certificate is not yet valid: NotBefore %v", leaf.NotBefore.UTC())
+	}
+	// The validity period is inclusive of both NotBefore and NotAfter, per
+	// RFC 5280, Section 4.1.2.5, and the CA/Browser Forum Baseline
+	// Requirements, Section 1.6.1.
+	if validity := leaf.NotAfter.Sub(leaf.NotBefore) + time.Second; l.c.MaxValidity > 0 && validity > l.c.MaxValidity {
+		return fmtErrorf("validity period too long: %v, maximum is %v", validity, l.c.MaxValidity)
+	}
+	return nil
+}
+
+// buildPrecertTBS returns the TBSCertificate of the final certificate
+// corresponding to precert, as defined in RFC 6962, Section 3.2.
+//
+// If precert was issued by a Precertificate Signing Certificate, the issuer
+// and the Authority Key Identifier extension, if present, are changed to match
+// the final certificate. x509.BuildPrecertTBS instead adds the Authority Key
+// Identifier of preIssuer if the precertificate doesn't have one, and drops the
+// precertificate's if preIssuer doesn't have one, both of which produce a TBS
+// that doesn't match the final certificate.
+func buildPrecertTBS(precert, preIssuer *x509.Certificate) ([]byte, error) {
+	if preIssuer == nil {
+		return x509.BuildPrecertTBS(precert.RawTBSCertificate, nil)
+	}
+	hasAKI := func(c *x509.Certificate) bool {
+		return slices.ContainsFunc(c.Extensions, func(ext pkix.Extension) bool {
+			return ext.Id.Equal(x509.OIDExtensionAuthorityKeyId)
+		})
+	}
+	switch {
+	case hasAKI(precert) && !hasAKI(preIssuer):
+		return nil, errors.New("precertificate signing certificate lacks the Authority Key Identifier of the final certificate")
+	case !hasAKI(precert) && hasAKI(preIssuer):
+		pi := *preIssuer
+		pi.Extensions = slices.DeleteFunc(slices.Clone(pi.Extensions), func(ext pkix.Extension) bool {
+			return ext.Id.Equal(x509.OIDExtensionAuthorityKeyId)
+		})
+		preIssuer = &pi
+	}
+	return x509.BuildPrecertTBS(precert.RawTBSCertificate, preIssuer)
+}
+
+// checkAlgorithms checks that the keys and signatures of the leaf and
+// intermediates in chain are allowed by the log policy. The root is trusted
+// as configured, so it's not checked.
+func (l *Log) checkAlgorithms(chain []*x509.Certificate) error {
+	for _, c := range chain[:len(chain)-1] {
+		if k, ok := c.PublicKey.(*rsa.PublicKey); ok && k.N.BitLen() < l.c.MinRSAKeySize {
+			return fmtErrorf("weak RSA key: %d bits in %q", k.N.BitLen(), x509util.NameToString(c.Subject))
+		}
+		switch c.SignatureAlgorithm {
+		case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+			if l.c.RejectSHA1 {
+				return fmtErrorf("SHA-1 signature: %v on %q", c.SignatureAlgorithm, x509util.NameToString(c.Subject))
+			}
+		}
+		if slices.Contains(l.c.RejectSignatureAlgorithms, c.SignatureAlgorithm) {
+			return fmtErrorf("rejected signature algorithm: %v on %q", c.SignatureAlgorithm, x509util.NameToString(c.Subject))
+		}
+	}
+	return nil
+}
+
 func (l *Log) uploadIssuers(ctx context.Context, issuers []*x509.Certificate) error {
 	l.issuersMu.Lock()
 	defer l.issuersMu.Unlock()
@@ -258,7 +615,7 @@ func (l *Log) uploadIssuers(ctx context.Context, issuers []*x509.Certificate) er
 		}
 	}
 
-	err := l.c.Backend.Upload(ctx, "issuers.pem", pemIssuers.Bytes(), optsText)
+	err := l.upload(ctx, "issuers.pem", pemIssuers.Bytes(), optsText)
 	l.c.Log.InfoContext(ctx, "uploaded issuers", "size", pemIssuers.Len(),
 		"old", oldCount, "new", len(l.issuers.RawCertificates()), "err", err)
 	l.m.Issuers.Set(float64(len(l.issuers.RawCertificates())))
@@ -266,7 +623,7 @@ func (l *Log) uploadIssuers(ctx context.Context, issuers []*x509.Certificate) er
 }
 
 func (l *Log) getRoots(rw http.ResponseWriter, r *http.Request) {
-	roots := l.c.Roots.RawCertificates()
+	roots := l.Roots().RawCertificates()
 	var res struct {
 		Certificates [][]byte `json:"certificates"`
 	}
@@ -280,3 +637,154 @@ func (l *Log) getRoots(rw http.ResponseWriter, r *http.Request) {
 		l.c.Log.DebugContext(r.Context(), "failed to write get-roots response", "err", err)
 	}
 }
+
+// getObject serves the checkpoint, issuers bundle, and tiles of the monitoring
+// API from the Backend.
+func (l *Log) getObject(rw http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	contentType := "application/octet-stream"
+	immutable := false
+	switch key {
+	case "checkpoint", "issuers.pem":
+		contentType = optsText.ContentType
+		rw.Header().Set("Cache-Control", "no-store")
+	default:
+		tile, err := tlog.ParseTilePath(key)
+		if err != nil || tile.H != TileHeight {
+			http.Error(rw, "invalid tile path", http.StatusNotFound)
+			return
+		}
+		if tile.W == tileWidth {
+			immutable = true
+			rw.Header().Set("Cache-Control", "public, max-age=604800, immutable")
+		} else {
+			rw.Header().Set("Cache-Control", "no-store")
+		}
+	}
+
+	data, eTag, err := l.fetchTile(r.Context(), key, immutable)
+	if err != nil {
+		l.c.Log.DebugContext(r.Context(), "failed to fetch object", "key", key, "err", err)
+		http.Error(rw, "object not found", http.StatusNotFound)
+		return
+	}
+
+	if eTag != "" {
+		rw.Header().Set("ETag", eTag)
+		if r.Header.Get("If-None-Match") == eTag {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := rw.Write(data); err != nil {
+		l.c.Log.DebugContext(r.Context(), "failed to write object response", "key", key, "err", err)
+	}
+}
+
+type logMetadata struct {
+	Description      string                   `json:"description"`
+	LogID            []byte                   `json:"log_id"`
+	Key              []byte                   `json:"key"`
+	SubmissionURL    string                   `json:"submission_url,omitempty"`
+	MonitoringURL    string                   `json:"monitoring_url,omitempty"`
+	MMD              int64                    `json:"mmd"`
+	State            map[string]logStateEntry `json:"state,omitempty"`
+	TemporalInterval struct {
+		StartInclusive time.Time `json:"start_inclusive"`
+		EndExclusive   time.Time `json:"end_exclusive"`
+	} `json:"temporal_interval"`
+}
+
+type logStateEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// logState is the log state advertised in log.v3.json.
+type logState struct {
+	name      string
+	timestamp time.Time
+}
+
+// SetState replaces Config.State and Config.StateTimestamp, the log state
+// advertised in the log.v3.json metadata document.
+func (l *Log) SetState(state string, timestamp time.Time) {
+	old := l.state.Swap(&logState{state, timestamp})
+	if old == nil {
+		old = &logState{l.c.State, l.c.StateTimestamp}
+	}
+	if old.name != state || !old.timestamp.Equal(timestamp) {
+		l.c.Log.Info("log state changed", "old", old.name, "new", state, "timestamp", timestamp)
+	}
+}
+
+// getMetadata serves a description of the log in the format of a log entry in
+// the v3 log lists, so that it can be ingested by log list maintainers.
+func (l *Log) getMetadata(rw http.ResponseWriter, r *http.Request) {
+	spki, err := x509.MarshalPKIXPublicKey(l.c.Key.Public())
+	if err != nil {
+		l.c.Log.ErrorContext(r.Context(), "failed to marshal public key", "err", err)
+		http.Error(rw, "internal error", http.StatusInternalServerError)
+		return
+	}
+	m := &logMetadata{
+		Description:   l.c.Description,
+		LogID:         l.logID[:],
+		Key:           spki,
+		SubmissionURL: l.c.SubmissionURL,
+		MonitoringURL: l.c.MonitoringURL,
+		MMD:           int64(l.c.MMD / time.Second),
+	}
+	if m.Description == "" {
+		m.Description = l.c.Name
+	}
+	if m.MMD == 0 {
+		m.MMD = int64(24 * time.Hour / time.Second)
+	}
+	st := l.state.Load()
+	if st == nil {
+		st = &logState{l.c.State, l.c.StateTimestamp}
+	}
+	if st.name != "" {
+		m.State = map[string]logStateEntry{st.name: {st.timestamp.UTC()}}
+	}
+	m.TemporalInterval.StartInclusive = l.c.NotAfterStart.UTC()
+	m.TemporalInterval.EndExclusive = l.c.NotAfterLimit.UTC()
+
+	rw.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		l.c.Log.DebugContext(r.Context(), "failed to write log.v3.json response", "err", err)
+	}
+}
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// getOpenAPI serves an OpenAPI document describing the submission and
+// monitoring APIs, with the log's submission URL as the server, if known.
+func (l *Log) getOpenAPI(rw http.ResponseWriter, r *http.Request) {
+	var spec map[string]any
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		l.c.Log.ErrorContext(r.Context(), "failed to parse embedded OpenAPI document", "err", err)
+		http.Error(rw, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if l.c.SubmissionURL != "" {
+		spec["servers"] = []map[string]string{{
+			"url":         strings.TrimSuffix(l.c.SubmissionURL, "/"),
+			"description": l.c.Name,
+		}}
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(spec); err != nil {
+		l.c.Log.DebugContext(r.Context(), "failed to write openapi.json response", "err", err)
+	}
+}
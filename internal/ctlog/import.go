@@ -0,0 +1,136 @@
+package ctlog
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// An ImportEntry is an entry of another log, to be added to a Log with
+// [Log.ImportEntries].
+type ImportEntry struct {
+	LogEntry
+
+	// Timestamp is the original timestamp of the entry, which is preserved.
+	Timestamp int64
+
+	// Issuers are the certificates of the entry's chain that are added to the
+	// issuers bundle, excluding any precertificate signing certificate.
+	Issuers []*x509.Certificate
+}
+
+// ParseRFC6962Entry parses the leaf_input and extra_data of an entry returned
+// by the get-entries endpoint of a RFC 6962 log.
+//
+// The entry is checked to convert to a Sunlight entry without loss: the
+// leaf_input is the MerkleTreeLeaf of the returned entry, minus the
+// leaf_index extension Sunlight adds to every entry.
+func ParseRFC6962Entry(leafInput, extraData []byte) (*ImportEntry, error) {
+	rle, err := ct.RawLogEntryFromLeaf(0, &ct.LeafEntry{LeafInput: leafInput, ExtraData: extraData})
+	if err != nil {
+		return nil, fmtErrorf("invalid entry: %w", err)
+	}
+	te := rle.Leaf.TimestampedEntry
+	e := &ImportEntry{Timestamp: int64(te.Timestamp)}
+	chain := rle.Chain
+	if te.EntryType == ct.PrecertLogEntryType {
+		e.IsPrecert = true
+		e.Certificate = te.PrecertEntry.TBSCertificate
+		e.IssuerKeyHash = te.PrecertEntry.IssuerKeyHash
+		e.PreCertificate = rle.Cert.Data
+		if len(chain) == 0 {
+			return nil, fmtErrorf("missing precertificate issuer")
+		}
+		preIssuer, err := x509.ParseCertificate(chain[0].Data)
+		if x509.IsFatal(err) {
+			return nil, fmtErrorf("invalid precertificate issuer: %w", err)
+		}
+		if ct.IsPreIssuer(preIssuer) {
+			e.PrecertSigningCert = chain[0].Data
+			chain = chain[1:]
+		}
+	} else {
+		e.Certificate = rle.Cert.Data
+	}
+	for _, c := range chain {
+		issuer, err := x509.ParseCertificate(c.Data)
+		if x509.IsFatal(err) {
+			return nil, fmtErrorf("invalid chain certificate: %w", err)
+		}
+		e.Issuers = append(e.Issuers, issuer)
+	}
+
+	// The original MerkleTreeLeaf, with empty extensions.
+	b := &cryptobyte.Builder{}
+	b.AddUint8(0 /* version = v1 */)
+	b.AddUint8(0 /* leaf_type = timestamped_entry */)
+	b.AddUint64(uint64(e.Timestamp))
+	b.AddBytes(e.SignedEntry())
+	b.AddUint16(0 /* extensions */)
+	if !bytes.Equal(b.BytesOrPanic(), leafInput) {
+		return nil, fmtErrorf("entry can't be imported without changes, it might have extensions")
+	}
+	return e, nil
+}
+
+// ImportEntries sequences entries at the end of the log in a single batch,
+// with their original timestamps rather than the current time. No SCTs are
+// produced for them.
+//
+// ImportEntries is meant to migrate the contents of another log to a new Log,
+// and must not be called concurrently with [Log.RunSequencer] or during
+// normal operation. The entries are added to the deduplication cache and
+// their issuers to the issuers bundle. Entries with a timestamp in the future
+// are rejected, since the checkpoint must be at least as recent as every entry
+// in the tree.
+func (l *Log) ImportEntries(ctx context.Context, entries []*ImportEntry) error {
+	// The checkpoint timestamp must progress, so wait for the clock to tick if
+	// the previous batch was sequenced within the same millisecond.
+	for l.c.clock().NowUnixMilli() <= l.tree.Time {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	now := l.c.clock().NowUnixMilli()
+	p := newPool()
+	for _, e := range entries {
+		if e.Timestamp > now {
+			return fmtErrorf("entry timestamp %d is in the future", e.Timestamp)
+		}
+		p.pendingLeaves = append(p.pendingLeaves, &e.LogEntry)
+		p.timestamps = append(p.timestamps, e.Timestamp)
+	}
+
+	var newIssuers []*x509.Certificate
+	seen := make(map[string]bool)
+	l.issuersMu.RLock()
+	for _, e := range entries {
+		for _, issuer := range e.Issuers {
+			if !seen[string(issuer.Raw)] && !l.issuers.Included(issuer) {
+				seen[string(issuer.Raw)] = true
+				l.c.Log.InfoContext(ctx, "new issuer", "issuer", x509util.NameToString(issuer.Subject))
+				newIssuers = append(newIssuers, issuer)
+			}
+		}
+	}
+	l.issuersMu.RUnlock()
+	if len(newIssuers) > 0 {
+		if err := l.uploadIssuers(ctx, newIssuers); err != nil {
+			return fmtErrorf("failed to upload issuers: %w", err)
+		}
+	}
+
+	// sequencePool only returns fatal errors, and stores the others in p.err.
+	if err := l.sequencePool(ctx, p); err != nil {
+		return err
+	}
+	return p.err
+}
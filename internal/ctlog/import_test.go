@@ -0,0 +1,111 @@
+package ctlog_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/google/certificate-transparency-go/x509util"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestImportEntries(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+
+	chain := []ct.ASN1Cert{{Data: testIntermediate}, {Data: testRoot}}
+	sourceEntry := func(i int, ts uint64) (leafInput, extraData []byte) {
+		cert := []byte(fmt.Sprintf("certificate %d", i))
+		te := &ct.TimestampedEntry{Timestamp: ts}
+		var err error
+		if i%3 == 0 {
+			te.EntryType = ct.PrecertLogEntryType
+			te.PrecertEntry = &ct.PreCert{IssuerKeyHash: sha256.Sum256([]byte("issuer")), TBSCertificate: cert}
+			extraData, err = tls.Marshal(ct.PrecertChainEntry{
+				PreCertificate: ct.ASN1Cert{Data: []byte(fmt.Sprintf("precertificate %d", i))}, CertificateChain: chain})
+		} else {
+			te.EntryType = ct.X509LogEntryType
+			te.X509Entry = &ct.ASN1Cert{Data: cert}
+			extraData, err = tls.Marshal(ct.CertificateChain{Entries: chain})
+		}
+		fatalIfErr(t, err)
+		leafInput, err = tls.Marshal(ct.MerkleTreeLeaf{Version: ct.V1,
+			LeafType: ct.TimestampedEntryLeafType, TimestampedEntry: te})
+		fatalIfErr(t, err)
+		return leafInput, extraData
+	}
+
+	// Timestamps are in the past, and not in order.
+	start := uint64(time.Now().Add(-time.Hour).UnixMilli())
+	timestamp := func(i int) uint64 { return start + uint64(i*1000) - uint64(i%2*1500) }
+
+	n := tileWidth + 10
+	for i := 0; i < n; i += 100 {
+		var entries []*ctlog.ImportEntry
+		for j := i; j < min(i+100, n); j++ {
+			e, err := ctlog.ParseRFC6962Entry(sourceEntry(j, timestamp(j)))
+			fatalIfErr(t, err)
+			if len(e.Issuers) != 2 {
+				t.Errorf("entry %d: got %d issuers, expected 2", j, len(e.Issuers))
+			}
+			entries = append(entries, e)
+		}
+		fatalIfErr(t, tl.Log.ImportEntries(context.Background(), entries))
+	}
+	tl.CheckLog()
+
+	for _, tile := range []tlog.Tile{
+		{H: ctlog.TileHeight, L: -1, N: 0, W: tileWidth},
+		{H: ctlog.TileHeight, L: -1, N: 1, W: 10},
+	} {
+		b, err := tl.Config.Backend.Fetch(context.Background(), tile.Path())
+		fatalIfErr(t, err)
+		for i := 0; i < tile.W; i++ {
+			e, rest, err := ctlog.ReadTileLeaf(b)
+			fatalIfErr(t, err)
+			b = rest
+			idx := int(tile.N)*tileWidth + i
+			if e.Timestamp != int64(timestamp(idx)) {
+				t.Errorf("entry %d: timestamp %d, expected %d", idx, e.Timestamp, timestamp(idx))
+			}
+			if e.IsPrecert != (idx%3 == 0) {
+				t.Errorf("entry %d: IsPrecert is %v", idx, e.IsPrecert)
+			}
+		}
+	}
+	issuers, err := tl.Config.Backend.Fetch(context.Background(), "issuers.pem")
+	fatalIfErr(t, err)
+	if pool := x509util.NewPEMCertPool(); !pool.AppendCertsFromPEM(issuers) || len(pool.RawCertificates()) != 2 {
+		t.Errorf("unexpected issuers.pem: %s", issuers)
+	}
+
+	// Entries cross-checked against the deduplication cache get the
+	// original timestamp.
+	wait, _ := tl.Log.AddLeafToPool(&ctlog.LogEntry{Certificate: []byte("certificate 1")})
+	if se, err := wait(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if se.LeafIndex != 1 || se.Timestamp != int64(timestamp(1)) {
+		t.Errorf("got cached entry %d at %d, expected 1 at %d", se.LeafIndex, se.Timestamp, timestamp(1))
+	}
+
+	future, err := ctlog.ParseRFC6962Entry(sourceEntry(n, uint64(time.Now().Add(time.Hour).UnixMilli())))
+	fatalIfErr(t, err)
+	if err := tl.Log.ImportEntries(context.Background(), []*ctlog.ImportEntry{future}); err == nil {
+		t.Error("entry with a future timestamp was imported")
+	}
+
+	leafInput, extraData := sourceEntry(n, timestamp(n))
+	var leaf ct.MerkleTreeLeaf
+	_, err = tls.Unmarshal(leafInput, &leaf)
+	fatalIfErr(t, err)
+	leaf.TimestampedEntry.Extensions = ct.CTExtensions{1, 2, 3}
+	leafInput, err = tls.Marshal(leaf)
+	fatalIfErr(t, err)
+	if _, err := ctlog.ParseRFC6962Entry(leafInput, extraData); err == nil {
+		t.Error("entry with extensions was parsed")
+	}
+}
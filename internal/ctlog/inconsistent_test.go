@@ -0,0 +1,132 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sunlightclient "filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func TestLoadLogInconsistentBackend(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Quiet()
+	fb := NewFaultyBackend(tl.Config.Backend, 1)
+	tl.Config.Backend = fb
+	// The second round creates new tiles, and overwrites the checkpoint.
+	for range tileWidth - 5 {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	for range 10 {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+
+	tiles := func(key string) bool { return strings.HasPrefix(key, "tile/") }
+	checkpoint := func(key string) bool { return key == "checkpoint" }
+	for _, tc := range []struct {
+		name           string
+		stale, corrupt float64
+		keys           func(string) bool
+		ok             bool
+	}{
+		{"CorruptTiles", 0, 1, tiles, false},
+		{"StaleTiles", 1, 0, tiles, false},
+		{"CorruptCheckpoint", 0, 1, checkpoint, false},
+		// The lock backend is authoritative, so a stale checkpoint in object
+		// storage is recovered from.
+		{"StaleCheckpoint", 1, 0, checkpoint, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fb.Stale, fb.Corrupt, fb.Keys = tc.stale, tc.corrupt, tc.keys
+			defer func() { fb.Stale, fb.Corrupt, fb.Keys = 0, 0, nil }()
+			faults := fb.Faults()
+			log, err := ctlog.LoadLog(context.Background(), tl.Config)
+			if fb.Faults() == faults {
+				t.Fatalf("no faults were injected")
+			}
+			if !tc.ok {
+				if err == nil {
+					log.CloseCache()
+					t.Fatalf("LoadLog succeeded from an inconsistent backend")
+				}
+				return
+			}
+			fatalIfErr(t, err)
+			fatalIfErr(t, log.CloseCache())
+		})
+	}
+
+	tl = ReloadLog(t, tl)
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	tl.CheckLog()
+}
+
+func TestReadPathInconsistentBackend(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Quiet()
+	tl.Config.MonitoringAPI = true
+	fb := NewFaultyBackend(tl.Config.Backend, 1)
+	tl.Config.Backend = fb
+	ts := httptest.NewServer(tl.Log.Handler())
+	t.Cleanup(ts.Close)
+	tl.Config.MonitoringURL = ts.URL + "/"
+	ctx := context.Background()
+	c, err := sunlightclient.New(&sunlightclient.Config{
+		MonitoringPrefix: ts.URL,
+		Name:             tl.Config.Name,
+		PublicKey:        tl.Config.Key.Public(),
+	})
+	fatalIfErr(t, err)
+
+	var leaves [][]byte
+	for round := range 3 {
+		for range tileWidth - 10 + round*7 {
+			addCertificate(t, tl)
+		}
+		fatalIfErr(t, tl.Log.Sequence())
+	}
+	cp, err := c.Checkpoint(ctx)
+	fatalIfErr(t, err)
+	for e, err := range c.Entries(ctx, cp.Tree, 0) {
+		fatalIfErr(t, err)
+		leaves = append(leaves, e.MerkleTreeLeaf())
+	}
+	fatalIfErr(t, tl.Log.CheckPublished(ctx, 3))
+
+	// Every read either fails, or returns the correct entries, possibly of
+	// an older tree.
+	fb.Stale, fb.Corrupt = 0.1, 0.1
+	var detected, monitorFailures int
+	for range 50 {
+		if err := tl.Log.CheckPublished(ctx, 3); err != nil {
+			monitorFailures++
+		}
+		cp, err := c.Checkpoint(ctx)
+		if err != nil {
+			detected++
+			continue
+		}
+		for e, err := range c.Entries(ctx, cp.Tree, 0) {
+			if err != nil {
+				detected++
+				break
+			}
+			if !bytes.Equal(e.MerkleTreeLeaf(), leaves[e.LeafIndex]) {
+				t.Fatalf("entry %d was served corrupted", e.LeafIndex)
+			}
+		}
+	}
+	if fb.Faults() == 0 || detected == 0 || monitorFailures == 0 {
+		t.Errorf("%d faults, %d detected by the client, %d by the self-monitor",
+			fb.Faults(), detected, monitorFailures)
+	}
+
+	fb.Stale, fb.Corrupt = 0, 0
+	fatalIfErr(t, tl.Log.CheckPublished(ctx, 3))
+}
@@ -0,0 +1,115 @@
+package ctlog
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// KMSSigner is a [crypto.Signer] backed by an AWS KMS asymmetric ECDSA P-256
+// key, so that the log private key never leaves KMS.
+//
+// Unlike a local key, KMS signatures are not deterministic, so SCTs for
+// resubmitted entries are different (but equally valid) each time.
+type KMSSigner struct {
+	client   *kms.Client
+	keyID    string
+	pub      *ecdsa.PublicKey
+	duration *prometheus.SummaryVec
+	log      *slog.Logger
+}
+
+// NewKMSSigner fetches the public key of the KMS key identified by keyID (a
+// key ID, key ARN, or alias) and checks that it can be used to sign with
+// ECDSA P-256 and SHA-256, by producing and verifying a test signature.
+func NewKMSSigner(ctx context.Context, region, keyID string, l *slog.Logger) (*KMSSigner, error) {
+	duration := newSignDurationMetric("kms_sign_duration_seconds",
+		"AWS KMS Sign request latencies, by error.")
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config for KMS signer: %w", err)
+	}
+	client := kms.NewFromConfig(cfg, func(o *kms.Options) {
+		if region != "" {
+			o.Region = region
+		}
+	})
+
+	out, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch KMS public key: %w", err)
+	}
+	if out.KeySpec != types.KeySpecEccNistP256 {
+		return nil, fmt.Errorf("KMS key spec is %s, not %s", out.KeySpec, types.KeySpecEccNistP256)
+	}
+	if out.KeyUsage != types.KeyUsageTypeSignVerify {
+		return nil, fmt.Errorf("KMS key usage is %s, not %s", out.KeyUsage, types.KeyUsageTypeSignVerify)
+	}
+	k, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse KMS public key: %w", err)
+	}
+	pub, ok := k.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return nil, errors.New("KMS public key is not an ECDSA P-256 key")
+	}
+
+	s := &KMSSigner{
+		client:   client,
+		keyID:    keyID,
+		pub:      pub,
+		duration: duration,
+		log:      l,
+	}
+	if err := selfTestSigner(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+var _ crypto.Signer = &KMSSigner{}
+
+func (s *KMSSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest, which must be a SHA-256 hash, with the KMS key. rand is
+// ignored.
+func (s *KMSSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("unsupported hash function %v", opts.HashFunc())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteSignTimeout)
+	defer cancel()
+	start := time.Now()
+	out, err := s.client.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(s.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+	})
+	s.duration.WithLabelValues(fmt.Sprint(err != nil)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.log.Warn("KMS sign failed", "err", err)
+		return nil, fmt.Errorf("KMS sign failed: %w", err)
+	}
+	return out.Signature, nil
+}
+
+func (s *KMSSigner) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{s.duration}
+}
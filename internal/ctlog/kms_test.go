@@ -0,0 +1,24 @@
+package ctlog_test
+
+import (
+	"context"
+	"crypto"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// opaqueSigner hides the concrete type of a crypto.Signer.
+type opaqueSigner struct{ crypto.Signer }
+
+func TestOpaqueSigner(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.Key = opaqueSigner{tl.Config.Key}
+	lc := tl.LogClient()
+	for i := 0; i < 2; i++ {
+		_, err := lc.AddChain(context.Background(), []ct.ASN1Cert{
+			{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+		fatalIfErr(t, err)
+	}
+	tl.CheckLog()
+}
@@ -0,0 +1,41 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+func TestSubmitLimits(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	submit := func(chain ...[]byte) string {
+		body, err := json.Marshal(map[string][][]byte{"chain": chain})
+		fatalIfErr(t, err)
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, expected 400", rr.Code)
+		}
+		return rr.Body.String()
+	}
+
+	tl.Config.MaxChainLength = 3
+	if err := submit(testLeaf, testIntermediate, testIntermediate, testRoot); !strings.Contains(err, "chain too long") {
+		t.Errorf("got error %q, expected chain too long", err)
+	}
+	tl.Config.MaxCertificateSize = len(testLeaf) - 1
+	if err := submit(testLeaf, testIntermediate, testRoot); !strings.Contains(err, "certificate too large") {
+		t.Errorf("got error %q, expected certificate too large", err)
+	}
+
+	tl.Config.MaxCertificateSize = 4096
+	_, err := tl.LogClient().AddChain(context.Background(), []ct.ASN1Cert{
+		{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+	fatalIfErr(t, err)
+}
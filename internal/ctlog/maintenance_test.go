@@ -0,0 +1,40 @@
+package ctlog_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+func TestMaintenance(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	logClient := tl.LogClient()
+	chain := []ct.ASN1Cert{{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}}
+
+	// Don't use logClient in maintenance mode, as it retries 503 responses.
+	tl.Log.SetMaintenance("scheduled maintenance")
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", strings.NewReader("{}")))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, expected 503", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+	if !strings.Contains(rr.Body.String(), "scheduled maintenance") {
+		t.Errorf("missing message in body %q", rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/ct/v1/get-roots", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("get-roots in maintenance mode: got status %d", rr.Code)
+	}
+
+	tl.Log.SetMaintenance("")
+	_, err := logClient.AddChain(context.Background(), chain)
+	fatalIfErr(t, err)
+}
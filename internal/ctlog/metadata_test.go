@@ -0,0 +1,65 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetadata(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.SubmissionURL = "https://example.com/"
+	tl.Config.State = "usable"
+	tl.Config.StateTimestamp = time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/log.v3.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d", rr.Code)
+	}
+	var m struct {
+		Description   string `json:"description"`
+		LogID         []byte `json:"log_id"`
+		Key           []byte `json:"key"`
+		SubmissionURL string `json:"submission_url"`
+		MMD           int    `json:"mmd"`
+		State         struct {
+			Usable struct {
+				Timestamp time.Time `json:"timestamp"`
+			} `json:"usable"`
+		} `json:"state"`
+		TemporalInterval struct {
+			StartInclusive time.Time `json:"start_inclusive"`
+			EndExclusive   time.Time `json:"end_exclusive"`
+		} `json:"temporal_interval"`
+	}
+	fatalIfErr(t, json.Unmarshal(rr.Body.Bytes(), &m))
+	pkix, err := x509.MarshalPKIXPublicKey(tl.Config.Key.Public())
+	fatalIfErr(t, err)
+	if logID := sha256.Sum256(pkix); !bytes.Equal(m.LogID, logID[:]) {
+		t.Errorf("got log ID %x, expected %x", m.LogID, logID)
+	}
+	if !bytes.Equal(m.Key, pkix) {
+		t.Errorf("got key %x, expected %x", m.Key, pkix)
+	}
+	if m.Description != tl.Config.Name {
+		t.Errorf("got description %q", m.Description)
+	}
+	if m.SubmissionURL != "https://example.com/" {
+		t.Errorf("got submission URL %q", m.SubmissionURL)
+	}
+	if m.MMD != 86400 {
+		t.Errorf("got MMD %d", m.MMD)
+	}
+	if !m.State.Usable.Timestamp.Equal(tl.Config.StateTimestamp) {
+		t.Errorf("got state timestamp %v", m.State.Usable.Timestamp)
+	}
+	if !m.TemporalInterval.StartInclusive.Equal(tl.Config.NotAfterStart) ||
+		!m.TemporalInterval.EndExclusive.Equal(tl.Config.NotAfterLimit) {
+		t.Errorf("got temporal interval %v", m.TemporalInterval)
+	}
+}
@@ -13,11 +13,12 @@ import (
 type metrics struct {
 	ReqCount    *prometheus.CounterVec
 	ReqInFlight *prometheus.GaugeVec
-	ReqDuration *prometheus.SummaryVec
+	ReqDuration prometheus.ObserverVec
 
 	SeqCount        *prometheus.CounterVec
 	SeqPoolSize     prometheus.Summary
-	SeqDuration     prometheus.Summary
+	SeqDuration     latencyObserver
+	SeqPhases       *prometheus.HistogramVec
 	SeqLeafSize     prometheus.Summary
 	SeqTiles        prometheus.Counter
 	SeqDataTileSize prometheus.Summary
@@ -25,21 +26,48 @@ type metrics struct {
 	TreeTime prometheus.Gauge
 	TreeSize prometheus.Gauge
 
-	ConfigRoots prometheus.Gauge
-	ConfigStart prometheus.Gauge
-	ConfigEnd   prometheus.Gauge
+	ConfigRoots        prometheus.Gauge
+	ConfigRootsReloads prometheus.Counter
+	ConfigStart        prometheus.Gauge
+	ConfigEnd          prometheus.Gauge
 
 	Issuers prometheus.Gauge
 
-	AddChainCount *prometheus.CounterVec
-	AddChainWait  prometheus.Summary
+	Maintenance prometheus.Gauge
+	ClockSkew   prometheus.Gauge
+	Passive     prometheus.Gauge
 
-	CacheGetDuration prometheus.Summary
-	CachePutDuration prometheus.Summary
+	AddChainCount    *prometheus.CounterVec
+	AddChainWait     latencyObserver
+	AddChainDuration prometheus.ObserverVec
+	AddChainIssuers  *issuerTracker
+
+	AddChainAlternatePaths prometheus.Counter
+
+	ChainCacheRequests  *prometheus.CounterVec
+	ObjectCacheRequests *prometheus.CounterVec
+
+	CacheGetDuration latencyObserver
+	CachePutDuration latencyObserver
 	CachePutErrors   prometheus.Counter
+
+	SignDuration   latencyObserver
+	SignQueueDepth prometheus.Gauge
+	SignBatchSize  prometheus.Summary
+
+	SignerHealthy       prometheus.Gauge
+	SignerCheckDuration prometheus.Gauge
+	SignerCheckFailures prometheus.Counter
+
+	AuditRecords prometheus.Counter
+	AuditDropped prometheus.Counter
+
+	SelfMonitorChecks      *prometheus.CounterVec
+	SelfMonitorTreeSize    prometheus.Gauge
+	SelfMonitorLastSuccess prometheus.Gauge
 }
 
-func initMetrics() metrics {
+func initMetrics(mode LatencyMetricsMode) metrics {
 	return metrics{
 		ReqInFlight: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -55,14 +83,10 @@ func initMetrics() metrics {
 			},
 			[]string{"endpoint", "code"},
 		),
-		ReqDuration: prometheus.NewSummaryVec(
-			prometheus.SummaryOpts{
-				Name:       "http_request_duration_seconds",
-				Help:       "HTTP request serving latencies in seconds, by endpoint.",
-				Objectives: map[float64]float64{0.5: 0.05, 0.75: 0.025, 0.9: 0.01, 0.99: 0.001},
-				MaxAge:     1 * time.Minute,
-				AgeBuckets: 6,
-			},
+		ReqDuration: newLatencyMetricVec(mode,
+			"http_request_duration_seconds",
+			"HTTP request serving latencies in seconds, by endpoint.",
+			map[float64]float64{0.5: 0.05, 0.75: 0.025, 0.9: 0.01, 0.99: 0.001},
 			[]string{"endpoint"},
 		),
 
@@ -82,14 +106,19 @@ func initMetrics() metrics {
 				AgeBuckets: 6,
 			},
 		),
-		SeqDuration: prometheus.NewSummary(
-			prometheus.SummaryOpts{
-				Name:       "sequencing_duration_seconds",
-				Help:       "Duration of sequencing rounds, successful or not.",
-				Objectives: map[float64]float64{0.5: 0.05, 0.75: 0.025, 0.9: 0.01, 0.99: 0.001},
-				MaxAge:     1 * time.Minute,
-				AgeBuckets: 6,
+		SeqDuration: newLatencyMetric(mode,
+			"sequencing_duration_seconds",
+			"Duration of sequencing rounds, successful or not.",
+			map[float64]float64{0.5: 0.05, 0.75: 0.025, 0.9: 0.01, 0.99: 0.001},
+		),
+		SeqPhases: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "sequencing_phase_duration_seconds",
+				Help: "Duration of the phases of sequencing rounds, by phase. " +
+					"Rounds that fail only observe the phases they reached.",
+				Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
 			},
+			[]string{"phase"},
 		),
 		SeqLeafSize: prometheus.NewSummary(
 			prometheus.SummaryOpts{
@@ -135,6 +164,12 @@ func initMetrics() metrics {
 				Help: "Number of accepted roots.",
 			},
 		),
+		ConfigRootsReloads: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "config_roots_reloads_total",
+				Help: "Number of times the set of accepted roots was replaced since startup.",
+			},
+		),
 		ConfigStart: prometheus.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "config_notafter_start_timestamp_seconds",
@@ -155,6 +190,25 @@ func initMetrics() metrics {
 			},
 		),
 
+		Maintenance: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "maintenance_mode",
+				Help: "Whether the log is in maintenance mode and rejecting submissions.",
+			},
+		),
+		ClockSkew: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "clock_skew",
+				Help: "Whether submissions are rejected because the clock is believed to be inaccurate.",
+			},
+		),
+		Passive: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "passive",
+				Help: "Whether the instance is passive, serving reads while another one sequences the log.",
+			},
+		),
+
 		AddChainCount: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "addchain_requests_total",
@@ -162,41 +216,191 @@ func initMetrics() metrics {
 			},
 			[]string{"error", "issuer", "root", "precert", "preissuer", "chain_len", "source", "reused"},
 		),
-		AddChainWait: prometheus.NewSummary(
-			prometheus.SummaryOpts{
-				Name:       "addchain_wait_seconds",
-				Help:       "Duration of add-[pre-]chain pauses waiting for a leaf to be sequenced, excluding deduplicated entries.",
-				Objectives: map[float64]float64{0.5: 0.05, 0.75: 0.025, 0.9: 0.01, 0.99: 0.001},
-				MaxAge:     1 * time.Minute,
-				AgeBuckets: 6,
+		AddChainAlternatePaths: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "addchain_alternate_paths_total",
+				Help: "Number of add-[pre-]chain requests accepted through an alternate path, reordered or using a cross-signed intermediate.",
 			},
 		),
+		ChainCacheRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "chain_cache_requests_total",
+				Help: "Lookups of submitted intermediates in the verified chain cache, by result (hit or miss).",
+			},
+			[]string{"result"},
+		),
+		ObjectCacheRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "object_cache_requests_total",
+				Help: "Fetches of the checkpoint and tiles by the monitoring API (backend and tile_store) or the self-monitor (monitor), by result (hit, miss, not_modified, or coalesced).",
+			},
+			[]string{"source", "result"},
+		),
+		AddChainWait: newLatencyMetric(mode,
+			"addchain_wait_seconds",
+			"Duration of add-[pre-]chain pauses waiting for a leaf to be sequenced, excluding deduplicated entries.",
+			map[float64]float64{0.5: 0.05, 0.75: 0.025, 0.9: 0.01, 0.99: 0.001},
+		),
+		AddChainDuration: newLatencyMetricVec(mode,
+			"addchain_duration_seconds",
+			"Duration of add-[pre-]chain requests, by issuer of the submitted certificate.",
+			map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			[]string{"issuer"},
+		),
+		AddChainIssuers: newIssuerTracker(time.Now),
 
-		CacheGetDuration: prometheus.NewSummary(
-			prometheus.SummaryOpts{
-				Name:       "cache_get_duration_seconds",
-				Help:       "Duration of individual deduplication cache lookups.",
-				Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
-				MaxAge:     1 * time.Minute,
-				AgeBuckets: 6,
+		CacheGetDuration: newLatencyMetric(mode,
+			"cache_get_duration_seconds",
+			"Duration of individual deduplication cache lookups.",
+			map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		),
+		CachePutDuration: newLatencyMetric(mode,
+			"cache_put_duration_seconds",
+			"Duration of batch deduplication cache inserts.",
+			map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		),
+		CachePutErrors: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "cache_put_errors_total",
+				Help: "Number of failed deduplication cache inserts.",
+			},
+		),
+		SignDuration: newLatencyMetric(mode,
+			"sign_duration_seconds",
+			"Duration of SCT signing operations, including batches.",
+			map[float64]float64{0.5: 0.05, 0.75: 0.025, 0.9: 0.01, 0.99: 0.001},
+		),
+		SignQueueDepth: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "sign_queue_depth",
+				Help: "Number of SCTs waiting for a signing worker.",
 			},
 		),
-		CachePutDuration: prometheus.NewSummary(
+		SignBatchSize: prometheus.NewSummary(
 			prometheus.SummaryOpts{
-				Name:       "cache_put_duration_seconds",
-				Help:       "Duration of batch deduplication cache inserts.",
+				Name:       "sign_batch_size",
+				Help:       "Number of SCTs signed together by a signing worker.",
 				Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
 				MaxAge:     1 * time.Minute,
 				AgeBuckets: 6,
 			},
 		),
-		CachePutErrors: prometheus.NewCounter(
+
+		SignerHealthy: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "signer_healthy",
+				Help: "Whether the latest signer health check succeeded within the latency threshold.",
+			},
+		),
+		SignerCheckDuration: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "signer_check_duration_seconds",
+				Help: "Duration of the latest signer health check.",
+			},
+		),
+		SignerCheckFailures: prometheus.NewCounter(
 			prometheus.CounterOpts{
-				Name: "cache_put_errors_total",
-				Help: "Number of failed deduplication cache inserts.",
+				Name: "signer_check_failures_total",
+				Help: "Number of failed or slow signer health checks.",
 			},
 		),
+
+		AuditRecords: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "audit_records_total",
+				Help: "Number of submission audit records uploaded to the backend.",
+			},
+		),
+		AuditDropped: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "audit_dropped_records_total",
+				Help: "Number of submission audit records dropped because too many were pending upload.",
+			},
+		),
+
+		SelfMonitorChecks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "self_monitor_checks_total",
+				Help: "Number of checks of the published log, by error category if failed.",
+			},
+			[]string{"error"},
+		),
+		SelfMonitorTreeSize: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "self_monitor_tree_size_leaves",
+				Help: "Size of the latest published tree verified by the self-monitor.",
+			},
+		),
+		SelfMonitorLastSuccess: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "self_monitor_last_success_timestamp_seconds",
+				Help: "UNIX timestamp of the latest successful check of the published log.",
+			},
+		),
+	}
+}
+
+// LatencyMetricsMode selects the metric type of the latency metrics.
+type LatencyMetricsMode int
+
+const (
+	// LatencySummaries exports latencies as summaries with fixed quantiles
+	// over the last minute. Summaries can't be aggregated across instances.
+	LatencySummaries LatencyMetricsMode = iota
+
+	// LatencyHistograms exports latencies as histograms with the default
+	// Prometheus buckets.
+	LatencyHistograms
+
+	// LatencyNativeHistograms exports latencies as Prometheus native
+	// histograms, as well as with the default buckets for scrapers that don't
+	// support native histograms.
+	LatencyNativeHistograms
+)
+
+// latencyObserver is implemented by both prometheus.Summary and
+// prometheus.Histogram.
+type latencyObserver interface {
+	prometheus.Observer
+	prometheus.Collector
+}
+
+func newLatencyMetric(mode LatencyMetricsMode, name, help string, objectives map[float64]float64) latencyObserver {
+	if mode == LatencySummaries {
+		return prometheus.NewSummary(summaryOpts(name, help, objectives))
+	}
+	return prometheus.NewHistogram(histogramOpts(mode, name, help))
+}
+
+func newLatencyMetricVec(mode LatencyMetricsMode, name, help string, objectives map[float64]float64, labels []string) prometheus.ObserverVec {
+	if mode == LatencySummaries {
+		return prometheus.NewSummaryVec(summaryOpts(name, help, objectives), labels)
+	}
+	return prometheus.NewHistogramVec(histogramOpts(mode, name, help), labels)
+}
+
+func summaryOpts(name, help string, objectives map[float64]float64) prometheus.SummaryOpts {
+	return prometheus.SummaryOpts{
+		Name:       name,
+		Help:       help,
+		Objectives: objectives,
+		MaxAge:     1 * time.Minute,
+		AgeBuckets: 6,
+	}
+}
+
+func histogramOpts(mode LatencyMetricsMode, name, help string) prometheus.HistogramOpts {
+	opts := prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: prometheus.DefBuckets,
+	}
+	if mode == LatencyNativeHistograms {
+		opts.NativeHistogramBucketFactor = 1.1
+		opts.NativeHistogramMaxBucketNumber = 100
+		opts.NativeHistogramMinResetDuration = 1 * time.Hour
 	}
+	return opts
 }
 
 func (l *Log) Metrics() []prometheus.Collector {
@@ -0,0 +1,218 @@
+package ctlog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"github.com/google/certificate-transparency-go/x509util"
+	"golang.org/x/mod/sumdb/tlog"
+	"golang.org/x/sync/errgroup"
+)
+
+// mirrorUploads is the maximum number of concurrent uploads of a Mirror.
+const mirrorUploads = 16
+
+// MirrorConfig is the configuration of a [Mirror].
+type MirrorConfig struct {
+	// Source reads the mirrored log through its monitoring API.
+	Source *client.Client
+
+	// Destination is the backend the log is copied to. It must be dedicated
+	// to the mirror.
+	Destination Backend
+
+	Log *slog.Logger
+}
+
+// A Mirror copies the checkpoint, tiles, and issuers bundle of a log to
+// another Backend, making an independent read replica of the log.
+type Mirror struct {
+	c *MirrorConfig
+
+	// tree and checkpoint are the state of the destination.
+	tree       tlog.Tree
+	checkpoint []byte
+	issuers    []byte
+
+	// resume is set if the destination might have tiles beyond tree, uploaded
+	// by an interrupted Sync.
+	resume bool
+}
+
+// NewMirror returns a Mirror that resumes from the checkpoint at the
+// destination, which must be a valid checkpoint of the source log. If the
+// destination has no checkpoint, the log is copied from the start.
+func NewMirror(ctx context.Context, config *MirrorConfig) (*Mirror, error) {
+	m := &Mirror{c: config, resume: true}
+	signed, err := config.Destination.Fetch(ctx, "checkpoint")
+	if err != nil {
+		config.Log.InfoContext(ctx, "no checkpoint at destination, mirroring from the start", "err", err)
+		return m, nil
+	}
+	cp, err := config.Source.VerifyCheckpoint(signed)
+	if err != nil {
+		return nil, fmtErrorf("invalid checkpoint at destination: %w", err)
+	}
+	m.tree, m.checkpoint = cp.Tree, signed
+	if issuers, err := config.Destination.Fetch(ctx, "issuers.pem"); err == nil {
+		m.issuers = issuers
+	}
+	config.Log.InfoContext(ctx, "resuming mirror", "tree_size", m.tree.N)
+	return m, nil
+}
+
+// Sync copies the tiles added to the source log since the last Sync, its
+// issuers bundle, and then its latest checkpoint.
+//
+// The source checkpoint is verified to be consistent with the destination
+// one, and every tile is verified against it before it's uploaded. Since the
+// checkpoint is uploaded last, the destination is always a valid copy of the
+// log, and an interrupted Sync is resumed by the next one.
+func (m *Mirror) Sync(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			m.resume = true
+		}
+	}()
+	src := m.c.Source
+
+	cp, err := src.Checkpoint(ctx)
+	if err != nil {
+		return fmtErrorf("failed to fetch source checkpoint: %w", err)
+	}
+	switch {
+	case cp.N < m.tree.N:
+		return fmtErrorf("source checkpoint rolled back: size %d is smaller than %d", cp.N, m.tree.N)
+	case cp.N == m.tree.N && cp.Hash != m.tree.Hash:
+		return fmtErrorf("source checkpoint forked: size %d has hash %v, expected %v", cp.N, cp.Hash, m.tree.Hash)
+	}
+
+	// The HashReader verifies every tile it reads against the tree.
+	hr := src.HashReader(ctx, cp.Tree)
+	if m.tree.N > 0 && m.tree.N < cp.N {
+		proof, err := tlog.ProveTree(cp.N, m.tree.N, hr)
+		if err != nil {
+			return fmtErrorf("couldn't build consistency proof: %w", err)
+		}
+		if err := tlog.CheckTree(proof, cp.N, cp.Hash, m.tree.N, m.tree.Hash); err != nil {
+			return fmtErrorf("source checkpoint is inconsistent with destination: %w", err)
+		}
+	}
+
+	start := time.Now()
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(mirrorUploads)
+	var copied, skipped int
+	err = func() error {
+		for _, t := range tlog.NewTiles(TileHeight, m.tree.N, cp.N) {
+			if m.resume && t.W == tileWidth && m.uploaded(ctx, t) {
+				skipped++
+				continue
+			}
+			data, err := tlog.ReadTileData(t, hr)
+			if err != nil {
+				return fmtErrorf("couldn't read tile %v: %w", t.Path(), err)
+			}
+			g.Go(func() error { return m.upload(gctx, t.Path(), data, optsHashTile) })
+			copied++
+			if t.L != 0 {
+				continue
+			}
+			dataTile := t
+			dataTile.L = -1
+			b, err := src.ReadTile(ctx, dataTile)
+			if err != nil {
+				return fmtErrorf("failed to fetch data tile: %w", err)
+			}
+			if err := checkDataTile(hr, dataTile, b); err != nil {
+				return err
+			}
+			g.Go(func() error { return m.upload(gctx, dataTile.Path(), b, optsDataTile) })
+			copied++
+		}
+
+		issuers, err := src.Issuers(ctx)
+		if err != nil {
+			return err
+		}
+		if m.issuers == nil || !bytes.Equal(issuers, m.issuers) {
+			if len(issuers) > 0 && !x509util.NewPEMCertPool().AppendCertsFromPEM(issuers) {
+				return fmtErrorf("invalid source issuers.pem")
+			}
+			if err := m.upload(ctx, "issuers.pem", issuers, optsText); err != nil {
+				return err
+			}
+			m.issuers = issuers
+		}
+		return nil
+	}()
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(cp.Signed, m.checkpoint) {
+		if err := m.upload(ctx, "checkpoint", cp.Signed, optsText); err != nil {
+			return err
+		}
+	}
+	if cp.N > m.tree.N {
+		m.c.Log.InfoContext(ctx, "mirrored tree", "old_tree_size", m.tree.N, "tree_size", cp.N,
+			"tiles", copied, "skipped", skipped, "elapsed", time.Since(start))
+	}
+	m.tree, m.checkpoint, m.resume = cp.Tree, cp.Signed, false
+	return nil
+}
+
+// uploaded reports whether a full tile, and its data tile if it's a level 0
+// tile, are already at the destination.
+func (m *Mirror) uploaded(ctx context.Context, t tlog.Tile) bool {
+	if _, err := m.c.Destination.Fetch(ctx, t.Path()); err != nil {
+		return false
+	}
+	if t.L == 0 {
+		dataTile := t
+		dataTile.L = -1
+		if _, err := m.c.Destination.Fetch(ctx, dataTile.Path()); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// upload uploads an object to the destination. If an upload of an immutable
+// object fails, for example because the backend refuses to overwrite it, it's
+// considered successful if the destination already has the same contents.
+func (m *Mirror) upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	err := m.c.Destination.Upload(ctx, key, data, opts)
+	if err != nil && opts.Immutable {
+		if existing, fetchErr := m.c.Destination.Fetch(ctx, key); fetchErr == nil && bytes.Equal(existing, data) {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmtErrorf("failed to upload %q: %w", key, err)
+	}
+	return nil
+}
+
+// Run calls Sync every interval until ctx is canceled.
+func (m *Mirror) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := m.Sync(ctx); err != nil && ctx.Err() == nil {
+			m.c.Log.ErrorContext(ctx, "mirror sync failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	sunlightclient "filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestMirror(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.MonitoringAPI = true
+	ts := httptest.NewServer(tl.Log.Handler())
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+
+	src, err := sunlightclient.New(&sunlightclient.Config{
+		MonitoringPrefix: ts.URL,
+		Name:             tl.Config.Name,
+		PublicKey:        tl.Config.Key.Public(),
+	})
+	fatalIfErr(t, err)
+	dst := &failingUploadBackend{MemoryBackend: NewMemoryBackend(t)}
+	newMirror := func() *ctlog.Mirror {
+		m, err := ctlog.NewMirror(ctx, &ctlog.MirrorConfig{
+			Source:      src,
+			Destination: dst,
+			Log:         tl.Config.Log,
+		})
+		fatalIfErr(t, err)
+		return m
+	}
+	checkMirror := func() {
+		t.Helper()
+		c, err := src.Checkpoint(ctx)
+		fatalIfErr(t, err)
+		b := tl.Config.Backend.(*MemoryBackend)
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		dst.mu.Lock()
+		defer dst.mu.Unlock()
+		for key, data := range dst.m {
+			if !bytes.Equal(data, b.m[key]) {
+				t.Errorf("mirrored %q doesn't match source", key)
+			}
+		}
+		for _, tile := range tlog.NewTiles(ctlog.TileHeight, 0, c.N) {
+			dataTile := tile
+			dataTile.L = -1
+			if _, ok := dst.m[tile.Path()]; !ok {
+				t.Errorf("tile %s not mirrored", tile.Path())
+			}
+			if _, ok := dst.m[dataTile.Path()]; tile.L == 0 && !ok {
+				t.Errorf("data tile %s not mirrored", dataTile.Path())
+			}
+		}
+		for _, key := range []string{"checkpoint", "issuers.pem"} {
+			if _, ok := dst.m[key]; !ok {
+				t.Errorf("%s not mirrored", key)
+			}
+		}
+	}
+
+	m := newMirror()
+	fatalIfErr(t, m.Sync(ctx))
+	checkMirror()
+
+	for i := 0; i < tileWidth+10; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	fatalIfErr(t, m.Sync(ctx))
+	checkMirror()
+
+	// Interrupt a Sync before the checkpoint upload, and resume it.
+	for i := 0; i < tileWidth*2; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	dst.fail.Store(true)
+	if err := m.Sync(ctx); err == nil {
+		t.Fatal("Sync succeeded with failing checkpoint upload")
+	}
+	dst.fail.Store(false)
+	m = newMirror()
+	fatalIfErr(t, m.Sync(ctx))
+	checkMirror()
+
+	// A corrupted source tile must not be mirrored.
+	for i := 0; i < tileWidth; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	oldCheckpoint, err := dst.Fetch(ctx, "checkpoint")
+	fatalIfErr(t, err)
+	b := tl.Config.Backend.(*MemoryBackend)
+	b.mu.Lock()
+	for key, data := range b.m {
+		if strings.HasPrefix(key, "tile/8/data/003") {
+			corrupted := bytes.Clone(data)
+			corrupted[20] ^= 0xff
+			b.m[key] = corrupted
+		}
+	}
+	b.mu.Unlock()
+	if err := m.Sync(ctx); err == nil {
+		t.Error("Sync succeeded with corrupted source data tile")
+	}
+	newCheckpoint, err := dst.Fetch(ctx, "checkpoint")
+	fatalIfErr(t, err)
+	if !bytes.Equal(newCheckpoint, oldCheckpoint) {
+		t.Error("checkpoint was mirrored despite corrupted source data tile")
+	}
+}
+
+// failingUploadBackend fails checkpoint uploads while fail is set.
+type failingUploadBackend struct {
+	*MemoryBackend
+	fail atomic.Bool
+}
+
+func (b *failingUploadBackend) Upload(ctx context.Context, key string, data []byte, opts *ctlog.UploadOptions) error {
+	if key == "checkpoint" && b.fail.Load() {
+		return errors.New("checkpoint upload failed")
+	}
+	return b.MemoryBackend.Upload(ctx, key, data, opts)
+}
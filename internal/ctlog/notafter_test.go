@@ -0,0 +1,37 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubmitNotAfter(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+	// testLeaf expires on 2024-02-13.
+	for _, tc := range []struct {
+		start, limit time.Time
+		err          string
+	}{
+		{time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC), "before the log temporal interval"},
+		{time.Date(2023, time.July, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), "after the log temporal interval"},
+	} {
+		tl.Config.NotAfterStart, tl.Config.NotAfterLimit = tc.start, tc.limit
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, expected 400", rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), tc.err) {
+			t.Errorf("got error %q, expected %q", rr.Body.String(), tc.err)
+		}
+	}
+}
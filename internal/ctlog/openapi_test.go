@@ -0,0 +1,33 @@
+package ctlog_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.SubmissionURL = "https://example.com/2024h1/"
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d", rr.Code)
+	}
+	var spec struct {
+		OpenAPI string
+		Servers []struct{ URL string }
+		Paths   map[string]any
+	}
+	fatalIfErr(t, json.Unmarshal(rr.Body.Bytes(), &spec))
+	if len(spec.Servers) != 1 || spec.Servers[0].URL != "https://example.com/2024h1" {
+		t.Errorf("got servers %v", spec.Servers)
+	}
+	for _, path := range []string{"/ct/v1/add-chain", "/ct/v1/add-pre-chain",
+		"/ct/v1/get-roots", "/checkpoint", "/tile/8/data/{index}"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("missing path %q", path)
+		}
+	}
+}
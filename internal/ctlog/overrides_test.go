@@ -0,0 +1,58 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+func TestRootOverrides(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+	submit := func(token string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set(ctlog.TestSubmissionHeader, token)
+		}
+		tl.Log.Handler().ServeHTTP(rr, req)
+		return rr.Code
+	}
+	root, err := ctx509.ParseCertificate(testRoot)
+	fatalIfErr(t, err)
+
+	tl.Config.DeniedRoots = [][sha256.Size]byte{sha256.Sum256(root.RawSubjectPublicKeyInfo)}
+	tl.Log.SetRoots(tl.Config.Roots)
+	if code := submit(""); code != http.StatusBadRequest {
+		t.Errorf("got status %d for denied root, expected 400", code)
+	}
+	if n := len(tl.Log.Roots().RawCertificates()); n != 0 {
+		t.Errorf("got %d roots, expected denied root to be excluded", n)
+	}
+
+	tl.Config.DeniedRoots = nil
+	tl.Config.TestRoots = tl.Config.Roots
+	tl.Config.TestRootsToken = "canary"
+	tl.Log.SetRoots(x509util.NewPEMCertPool())
+	if code := submit(""); code != http.StatusBadRequest {
+		t.Errorf("got status %d without token, expected 400", code)
+	}
+	if code := submit("wrong"); code != http.StatusBadRequest {
+		t.Errorf("got status %d with wrong token, expected 400", code)
+	}
+	tl.StartSequencer()
+	if code := submit("canary"); code != http.StatusOK {
+		t.Errorf("got status %d with token, expected 200", code)
+	}
+	if n := len(tl.Log.Roots().RawCertificates()); n != 0 {
+		t.Errorf("got %d roots, expected test roots to be excluded", n)
+	}
+}
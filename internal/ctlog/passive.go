@@ -0,0 +1,55 @@
+package ctlog
+
+import (
+	"context"
+	"time"
+)
+
+var errPassive = fmtErrorf("passive instance")
+
+// passiveRetryAfter is the Retry-After value, in seconds, of responses to
+// submissions while the instance is passive.
+const passiveRetryAfter = 30
+
+// SetPassive puts the log in passive mode, for an instance that serves reads
+// while another one, such as one in a different region, is sequencing the
+// same log. While passive, submissions are rejected with a 503, and the
+// sequencer must not be running.
+//
+// To take over, call [Log.Resync], then SetPassive(false), and then start
+// the sequencer.
+func (l *Log) SetPassive(passive bool) {
+	if l.passive.Swap(passive) != passive {
+		l.c.Log.Info("passive mode changed", "passive", passive)
+	}
+	if passive {
+		l.m.Passive.Set(1)
+	} else {
+		l.m.Passive.Set(0)
+	}
+}
+
+// Resync reloads the tree from the lock and object storage backends, to pick
+// up the entries sequenced, and the issuers uploaded, by another instance. It
+// must not be called while the sequencer is running.
+func (l *Log) Resync(ctx context.Context) error {
+	st, err := loadTreeState(ctx, l.c, l.logID)
+	if err != nil {
+		return err
+	}
+	l.tree, l.lockCheckpoint, l.edgeTiles = st.tree, st.lock, st.edgeTiles
+	l.publishedAt, l.lockUpdated = st.tree.Time, time.Now()
+	l.seqFailures, l.mmdAlerted = 0, false
+
+	l.issuersMu.Lock()
+	l.issuers = st.issuers
+	issuers := len(l.issuers.RawCertificates())
+	l.issuersMu.Unlock()
+
+	l.m.TreeSize.Set(float64(st.tree.N))
+	l.m.TreeTime.Set(float64(st.tree.Time))
+	l.m.Issuers.Set(float64(issuers))
+	l.storeSequencerState(nil)
+	l.c.Log.InfoContext(ctx, "resynced log", "size", st.tree.N, "timestamp", st.tree.Time, "issuers", issuers)
+	return nil
+}
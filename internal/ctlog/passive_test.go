@@ -0,0 +1,39 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPassiveResync(t *testing.T) {
+	active := NewEmptyTestLog(t)
+	passive := ReloadLog(t, active)
+	passive.Log.SetPassive(true)
+
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+	rr := httptest.NewRecorder()
+	passive.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d from passive instance, expected 503", rr.Code)
+	}
+
+	for range tileWidth + 5 {
+		addCertificate(t, active)
+	}
+	fatalIfErr(t, active.Log.Sequence())
+
+	// The passive instance takes over from the latest checkpoint.
+	fatalIfErr(t, passive.Log.Resync(context.Background()))
+	passive.Log.SetPassive(false)
+	addCertificate(t, passive)
+	fatalIfErr(t, passive.Log.Sequence())
+	passive.CheckLog()
+	if s := passive.Log.DebugState(); s.TreeSize != tileWidth+6 {
+		t.Errorf("tree size is %d, expected %d", s.TreeSize, tileWidth+6)
+	}
+}
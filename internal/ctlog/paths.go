@@ -0,0 +1,107 @@
+package ctlog
+
+import (
+	"time"
+
+	"github.com/google/certificate-transparency-go/trillian/ctfe"
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+// validateChain verifies the submitted chain, and returns the chain to log,
+// starting with the submitted certificate and ending with one of roots.
+//
+// If the submitted chain doesn't verify as is, but the leaf chains to an
+// accepted root through the submitted certificates and the configured
+// CrossSigned intermediates, the alternate path is returned instead. This
+// handles chains submitted out of order or with duplicate or extraneous
+// certificates, like other RFC 6962 logs do, and CAs that send chains anchored
+// at a root the log doesn't accept, typically during root transitions. The
+// second return value reports whether an alternate path was used.
+func (l *Log) validateChain(rawChain [][]byte, roots *x509util.PEMCertPool) ([]*x509.Certificate, bool, error) {
+	opts := ctfe.NewCertValidationOpts(roots, time.Time{}, false, false,
+		&l.c.NotAfterStart, &l.c.NotAfterLimit, false,
+		[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+	// If the cached path doesn't work, the submission might still verify
+	// through a different path, so fall back to the full validation.
+	if chain, err := l.validateCachedChain(rawChain, roots); err == nil && chain != nil {
+		return chain, false, nil
+	}
+	chain, err := ctfe.ValidateChain(rawChain, opts)
+	if err == nil && len(chain) > 1 {
+		l.chains.put(rawChain[1:], roots, chain[1:])
+	}
+	if err == nil {
+		return chain, false, nil
+	}
+
+	alt := l.alternatePath(rawChain, roots)
+	if alt == nil {
+		return nil, false, err
+	}
+	// Run the alternate path through the same checks as a submitted chain.
+	chain, altErr := ctfe.ValidateChain(alt, opts)
+	if altErr != nil {
+		return nil, false, err
+	}
+	return chain, true, nil
+}
+
+// alternatePath returns a path from the leaf of rawChain to an accepted root
+// using the submitted intermediates and the configured CrossSigned ones, or
+// nil if there isn't one. Among multiple paths, it prefers the one that shares
+// the longest prefix with rawChain, and then the shortest.
+func (l *Log) alternatePath(rawChain [][]byte, roots *x509util.PEMCertPool) [][]byte {
+	var submitted []*x509.Certificate
+	for _, der := range rawChain {
+		c, err := x509.ParseCertificate(der)
+		if x509.IsFatal(err) {
+			return nil
+		}
+		submitted = append(submitted, c)
+	}
+	intermediates := x509util.NewPEMCertPool()
+	for _, c := range submitted[1:] {
+		intermediates.AddCert(c)
+	}
+	if l.c.CrossSigned != nil {
+		for _, c := range l.c.CrossSigned.RawCertificates() {
+			intermediates.AddCert(c)
+		}
+	}
+
+	// These are the same lax options used by ctfe.ValidateChain.
+	paths, err := submitted[0].Verify(x509.VerifyOptions{
+		Roots:                          roots.CertPool(),
+		Intermediates:                  intermediates.CertPool(),
+		DisableTimeChecks:              true,
+		DisableCriticalExtensionChecks: true,
+		DisableEKUChecks:               true,
+		DisablePathLenChecks:           true,
+		DisableNameConstraintChecks:    true,
+		KeyUsages:                      []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil || len(paths) == 0 {
+		return nil
+	}
+
+	commonPrefix := func(path []*x509.Certificate) int {
+		n := 0
+		for n < len(path) && n < len(submitted) && path[n].Equal(submitted[n]) {
+			n++
+		}
+		return n
+	}
+	best := paths[0]
+	for _, p := range paths[1:] {
+		if c, bc := commonPrefix(p), commonPrefix(best); c > bc || c == bc && len(p) < len(best) {
+			best = p
+		}
+	}
+
+	var alt [][]byte
+	for _, c := range best {
+		alt = append(alt, c.Raw)
+	}
+	return alt
+}
@@ -0,0 +1,31 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+func TestSubmitAlternatePath(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf}})
+	fatalIfErr(t, err)
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, expected 400", rr.Code)
+	}
+
+	tl.Config.CrossSigned = x509util.NewPEMCertPool()
+	tl.Config.CrossSigned.AppendCertsFromPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testIntermediate}))
+	_, err = tl.LogClient().AddChain(context.Background(), []ct.ASN1Cert{{Data: testLeaf}})
+	fatalIfErr(t, err)
+	tl.CheckLog()
+}
@@ -0,0 +1,37 @@
+package ctlog_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSequencingPhases(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(tl.Log.Metrics()...)
+	mfs, err := reg.Gather()
+	fatalIfErr(t, err)
+	phases := make(map[string]uint64)
+	for _, mf := range mfs {
+		if mf.GetName() != "sequencing_phase_duration_seconds" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "phase" {
+					phases[l.GetValue()] = m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	for _, phase := range []string{"read_staged", "hash", "serialize", "upload_tiles",
+		"sign", "cas_checkpoint", "upload_checkpoint", "cache_put"} {
+		if phases[phase] != 1 {
+			t.Errorf("got %d observations of phase %q, expected 1", phases[phase], phase)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package ctlog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/miekg/pkcs11"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// p256Params is the DER encoding of the prime256v1 OID, as found in the
+// CKA_EC_PARAMS attribute of P-256 keys.
+var p256Params = []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}
+
+// PKCS11Config identifies a key on a PKCS#11 token.
+type PKCS11Config struct {
+	// Module is the path to the PKCS#11 shared library.
+	Module string
+
+	// TokenLabel is the label of the token holding the key.
+	TokenLabel string
+
+	// PIN is the user PIN of the token.
+	PIN string
+
+	// KeyLabel is the CKA_LABEL of the EC P-256 private key and of the
+	// matching public key object.
+	KeyLabel string
+
+	// Sessions is the maximum number of idle sessions kept open. If zero,
+	// four sessions are kept.
+	Sessions int
+}
+
+// PKCS11Signer is a [crypto.Signer] backed by an EC P-256 key on a PKCS#11
+// token, such as a SoftHSM, YubiHSM, or Thales Luna HSM.
+//
+// Sessions are pooled, so that concurrent SCT signatures don't contend on a
+// single session, and are transparently reopened (reinitializing the module if
+// necessary) if the token connection is lost.
+//
+// Like [KMSSigner], its signatures are not deterministic.
+type PKCS11Signer struct {
+	c   PKCS11Config
+	pub *ecdsa.PublicKey
+
+	// mu protects ctx, slot, and gen, which change on reconnection. It's held
+	// for reading while using them.
+	mu   sync.RWMutex
+	ctx  *pkcs11.Ctx
+	slot uint
+	gen  uint64
+
+	idle chan pkcs11Session
+
+	duration   *prometheus.SummaryVec
+	reconnects prometheus.Counter
+	log        *slog.Logger
+}
+
+type pkcs11Session struct {
+	h   pkcs11.SessionHandle
+	key pkcs11.ObjectHandle
+	gen uint64
+}
+
+// NewPKCS11Signer loads the PKCS#11 module, logs into the token, fetches the
+// public key, and checks that the key can be used to sign by producing and
+// verifying a test signature.
+func NewPKCS11Signer(c PKCS11Config, l *slog.Logger) (*PKCS11Signer, error) {
+	if c.Sessions == 0 {
+		c.Sessions = 4
+	}
+	s := &PKCS11Signer{
+		c:    c,
+		idle: make(chan pkcs11Session, c.Sessions),
+		duration: newSignDurationMetric("pkcs11_sign_duration_seconds",
+			"PKCS#11 C_Sign latencies, by error."),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pkcs11_reconnects_total",
+			Help: "Number of times the PKCS#11 module was reinitialized after losing the token.",
+		}),
+		log: l,
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	sess, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := s.publicKey(sess)
+	s.release(sess)
+	if err != nil {
+		return nil, err
+	}
+	s.pub = pub
+
+	if err := selfTestSigner(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect initializes the module and finds the token. s.mu must be held, or s
+// must not be shared yet.
+func (s *PKCS11Signer) connect() error {
+	ctx := pkcs11.New(s.c.Module)
+	if ctx == nil {
+		return fmt.Errorf("failed to load PKCS#11 module %q", s.c.Module)
+	}
+	if err := ctx.Initialize(); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		ctx.Destroy()
+		return fmt.Errorf("failed to initialize PKCS#11 module: %w", err)
+	}
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return fmt.Errorf("failed to list PKCS#11 slots: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil || info.Label != s.c.TokenLabel {
+			continue
+		}
+		s.ctx, s.slot = ctx, slot
+		s.gen++
+		return nil
+	}
+	ctx.Finalize()
+	ctx.Destroy()
+	return fmt.Errorf("PKCS#11 token %q not found", s.c.TokenLabel)
+}
+
+// reconnect reinitializes the module, unless another goroutine already did
+// since generation gen. It waits for in-flight operations to complete.
+func (s *PKCS11Signer) reconnect(gen uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gen != gen {
+		return nil
+	}
+	s.log.Warn("reconnecting to PKCS#11 token", "token", s.c.TokenLabel)
+	s.reconnects.Inc()
+	if s.ctx != nil {
+		for {
+			select {
+			case sess := <-s.idle:
+				s.ctx.CloseSession(sess.h)
+				continue
+			default:
+			}
+			break
+		}
+		s.ctx.Finalize()
+		s.ctx.Destroy()
+		// If connect fails, the next Sign will try again.
+		s.ctx = nil
+	}
+	return s.connect()
+}
+
+// session returns an idle session, or opens a new one. s.mu must be held for
+// reading, and s.ctx must not be nil.
+func (s *PKCS11Signer) session() (pkcs11Session, error) {
+	for {
+		select {
+		case sess := <-s.idle:
+			if sess.gen == s.gen {
+				return sess, nil
+			}
+			// Sessions from before a reconnection are already invalid.
+			continue
+		default:
+		}
+		break
+	}
+
+	h, err := s.ctx.OpenSession(s.slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return pkcs11Session{}, fmt.Errorf("failed to open PKCS#11 session: %w", err)
+	}
+	// Login applies to all sessions of the application, so another session
+	// might have already logged in.
+	err = s.ctx.Login(h, pkcs11.CKU_USER, s.c.PIN)
+	if err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		s.ctx.CloseSession(h)
+		return pkcs11Session{}, fmt.Errorf("failed to log into PKCS#11 token: %w", err)
+	}
+	key, err := s.findObject(h, pkcs11.CKO_PRIVATE_KEY)
+	if err != nil {
+		s.ctx.CloseSession(h)
+		return pkcs11Session{}, err
+	}
+	return pkcs11Session{h: h, key: key, gen: s.gen}, nil
+}
+
+// release returns a session to the idle pool, or closes it if the pool is
+// full. s.mu must be held for reading.
+func (s *PKCS11Signer) release(sess pkcs11Session) {
+	select {
+	case s.idle <- sess:
+	default:
+		s.ctx.CloseSession(sess.h)
+	}
+}
+
+func (s *PKCS11Signer) findObject(h pkcs11.SessionHandle, class uint) (pkcs11.ObjectHandle, error) {
+	ctx := s.ctx
+	if err := ctx.FindObjectsInit(h, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, s.c.KeyLabel),
+	}); err != nil {
+		return 0, fmt.Errorf("failed to search PKCS#11 objects: %w", err)
+	}
+	objs, _, err := ctx.FindObjects(h, 2)
+	ctx.FindObjectsFinal(h)
+	if err != nil {
+		return 0, fmt.Errorf("failed to search PKCS#11 objects: %w", err)
+	}
+	if len(objs) != 1 {
+		return 0, fmt.Errorf("found %d PKCS#11 EC keys of class %d with label %q, expected one",
+			len(objs), class, s.c.KeyLabel)
+	}
+	return objs[0], nil
+}
+
+// publicKey reads the public key object. s.mu must be held for reading.
+func (s *PKCS11Signer) publicKey(sess pkcs11Session) (*ecdsa.PublicKey, error) {
+	obj, err := s.findObject(sess.h, pkcs11.CKO_PUBLIC_KEY)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := s.ctx.GetAttributeValue(sess.h, obj, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PKCS#11 public key: %w", err)
+	}
+	if !bytes.Equal(attrs[0].Value, p256Params) {
+		return nil, errors.New("PKCS#11 key is not a P-256 key")
+	}
+	// CKA_EC_POINT is a DER OCTET STRING, but some tokens return the raw
+	// point instead.
+	point := attrs[1].Value
+	var octets cryptobyte.String
+	if str := cryptobyte.String(point); str.ReadASN1(&octets, asn1.OCTET_STRING) && str.Empty() {
+		point = octets
+	}
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#11 public key: %w", err)
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(),
+		X: new(big.Int).SetBytes(point[1:33]), Y: new(big.Int).SetBytes(point[33:])}, nil
+}
+
+// isPKCS11ConnectionError reports whether err indicates that the session or
+// the token connection was lost, and a reconnection might help.
+func isPKCS11ConnectionError(err error) bool {
+	var e pkcs11.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e {
+	case pkcs11.CKR_SESSION_HANDLE_INVALID, pkcs11.CKR_SESSION_CLOSED,
+		pkcs11.CKR_DEVICE_REMOVED, pkcs11.CKR_DEVICE_ERROR,
+		pkcs11.CKR_TOKEN_NOT_PRESENT, pkcs11.CKR_TOKEN_NOT_RECOGNIZED,
+		pkcs11.CKR_USER_NOT_LOGGED_IN, pkcs11.CKR_CRYPTOKI_NOT_INITIALIZED:
+		return true
+	}
+	return false
+}
+
+var _ crypto.Signer = &PKCS11Signer{}
+
+func (s *PKCS11Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest, which must be a SHA-256 hash, with the token key. rand is
+// ignored. If the token connection was lost, Sign reconnects and retries once.
+func (s *PKCS11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("unsupported hash function %v", opts.HashFunc())
+	}
+	start := time.Now()
+	sig, gen, err := s.sign(digest)
+	if isPKCS11ConnectionError(err) {
+		if err = s.reconnect(gen); err == nil {
+			sig, _, err = s.sign(digest)
+		}
+	}
+	s.duration.WithLabelValues(fmt.Sprint(err != nil)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.log.Warn("PKCS#11 sign failed", "err", err)
+		return nil, fmt.Errorf("PKCS#11 sign failed: %w", err)
+	}
+	return encodeECDSASignature(sig)
+}
+
+// sign signs digest with a pooled session, and returns the generation of the
+// connection it used.
+func (s *PKCS11Signer) sign(digest []byte) (sig []byte, gen uint64, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.ctx == nil {
+		return nil, s.gen, pkcs11.Error(pkcs11.CKR_CRYPTOKI_NOT_INITIALIZED)
+	}
+	sess, err := s.session()
+	if err != nil {
+		return nil, s.gen, err
+	}
+	err = s.ctx.SignInit(sess.h, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, sess.key)
+	if err == nil {
+		sig, err = s.ctx.Sign(sess.h, digest)
+	}
+	if err != nil {
+		s.ctx.CloseSession(sess.h)
+		return nil, s.gen, err
+	}
+	s.release(sess)
+	return sig, s.gen, nil
+}
+
+func (s *PKCS11Signer) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{s.duration, s.reconnects}
+}
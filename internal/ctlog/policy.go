@@ -0,0 +1,27 @@
+package ctlog
+
+import (
+	"context"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// A SubmissionPolicy implements custom acceptance logic for submissions,
+// such as size caps, algorithm restrictions, or issuer allowlists.
+type SubmissionPolicy interface {
+	// CheckSubmission is called after the chain was verified, and before the
+	// entry is added to the pool. chain starts with the submitted certificate
+	// or precertificate, and ends with an accepted root. If it includes a
+	// precertificate signing certificate, it's chain[1].
+	//
+	// If CheckSubmission returns an error, the submission is rejected with a
+	// 400, and the error message is returned to the submitter.
+	CheckSubmission(ctx context.Context, chain []*x509.Certificate, isPrecert bool) error
+}
+
+// SubmissionPolicyFunc adapts a function to the SubmissionPolicy interface.
+type SubmissionPolicyFunc func(ctx context.Context, chain []*x509.Certificate, isPrecert bool) error
+
+func (f SubmissionPolicyFunc) CheckSubmission(ctx context.Context, chain []*x509.Certificate, isPrecert bool) error {
+	return f(ctx, chain, isPrecert)
+}
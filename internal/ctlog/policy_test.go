@@ -0,0 +1,52 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+	ct "github.com/google/certificate-transparency-go"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+)
+
+func TestSubmissionPolicy(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+
+	var calls int
+	tl.Config.Policy = ctlog.SubmissionPolicyFunc(func(ctx context.Context, chain []*ctx509.Certificate, isPrecert bool) error {
+		calls++
+		if len(chain) != 3 || isPrecert {
+			t.Errorf("unexpected chain: %d certificates, precert %v", len(chain), isPrecert)
+		}
+		if !bytes.Equal(chain[0].Raw, testLeaf) {
+			t.Errorf("chain doesn't start with the leaf")
+		}
+		return errors.New("no thanks")
+	})
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, expected 400", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "no thanks") {
+		t.Errorf("got error %q, expected policy reason", rr.Body.String())
+	}
+	if calls != 1 {
+		t.Errorf("policy called %d times, expected 1", calls)
+	}
+
+	tl.Config.Policy = ctlog.SubmissionPolicyFunc(func(ctx context.Context, chain []*ctx509.Certificate, isPrecert bool) error {
+		return nil
+	})
+	_, err = tl.LogClient().AddChain(context.Background(), []ct.ASN1Cert{
+		{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+	fatalIfErr(t, err)
+}
@@ -0,0 +1,24 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync/atomic"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func BenchmarkAddLeafToPoolParallel(b *testing.B) {
+	tl := NewEmptyTestLog(b)
+	tl.Quiet()
+	var n atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cert := binary.BigEndian.AppendUint64(bytes.Repeat([]byte("A"), 2350), uint64(n.Add(1)))
+			tl.Log.AddLeafToPool(&ctlog.LogEntry{Certificate: cert})
+		}
+	})
+}
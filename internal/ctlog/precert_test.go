@@ -0,0 +1,235 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/google/certificate-transparency-go/x509util"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// precertHierarchy is a test PKI with an intermediate that issues
+// precertificates both directly and through a Precertificate Signing
+// Certificate, and the final certificates corresponding to them.
+type precertHierarchy struct {
+	root, intermediate, preIssuer []byte
+	intermediateSPKI              []byte
+
+	direct, directFinal                      []byte
+	final, finalWithSCTs                     []byte
+	delegated, delegatedFinal                []byte
+	delegatedNoAKI, noAKIFinal               []byte
+	finalFromPreIssuer                       []byte
+	preIssuerNoAKI, precertForPreIssuerNoAKI []byte
+	serverAuth, noEKU, anyEKU, clientAuth    []byte
+}
+
+func newPrecertHierarchy(t *testing.T) *precertHierarchy {
+	h := &precertHierarchy{}
+	newKey := func() *ecdsa.PrivateKey {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		fatalIfErr(t, err)
+		return k
+	}
+	notBefore := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	issue := func(tmpl, parent *x509.Certificate, pub, priv any) ([]byte, *x509.Certificate) {
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+		fatalIfErr(t, err)
+		c, err := x509.ParseCertificate(der)
+		fatalIfErr(t, err)
+		return der, c
+	}
+	ca := func(cn string, serial int64) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             notBefore.AddDate(-1, 0, 0),
+			NotAfter:              notAfter.AddDate(1, 0, 0),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+	}
+
+	rootKey, intKey, preKey, leafKey := newKey(), newKey(), newKey(), newKey()
+	var root, intermediate, preIssuer *x509.Certificate
+	h.root, root = issue(ca("Test Root", 1), ca("Test Root", 1), &rootKey.PublicKey, rootKey)
+	h.intermediate, intermediate = issue(ca("Test Intermediate", 2), root, &intKey.PublicKey, rootKey)
+	h.intermediateSPKI = intermediate.RawSubjectPublicKeyInfo
+	preTmpl := ca("Test Precertificate Signing Certificate", 3)
+	preTmpl.ExtKeyUsage = nil
+	preTmpl.UnknownExtKeyUsage = []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 11129, 2, 4, 4}}
+	h.preIssuer, preIssuer = issue(preTmpl, intermediate, &preKey.PublicKey, intKey)
+
+	leaf := func(precert bool, exts ...pkix.Extension) *x509.Certificate {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(100),
+			Subject:      pkix.Name{CommonName: "example.com"},
+			DNSNames:     []string{"example.com"},
+			NotBefore:    notBefore,
+			NotAfter:     notAfter,
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if precert {
+			tmpl.ExtraExtensions = []pkix.Extension{{
+				Id:       asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3},
+				Critical: true,
+				Value:    []byte{0x05, 0x00},
+			}}
+		}
+		tmpl.ExtraExtensions = append(tmpl.ExtraExtensions, exts...)
+		return tmpl
+	}
+	// withoutSKI makes CreateCertificate omit the Authority Key Identifier.
+	withoutSKI := func(c *x509.Certificate) *x509.Certificate {
+		c2 := *c
+		c2.SubjectKeyId = nil
+		return &c2
+	}
+	tbs := func(_ []byte, c *x509.Certificate) []byte { return c.RawTBSCertificate }
+
+	h.direct, _ = issue(leaf(true), intermediate, &leafKey.PublicKey, intKey)
+	var final *x509.Certificate
+	h.final, final = issue(leaf(false), intermediate, &leafKey.PublicKey, intKey)
+	h.directFinal = final.RawTBSCertificate
+	h.finalWithSCTs, _ = issue(leaf(false, pkix.Extension{
+		Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2},
+		Value: []byte{0x04, 0x02, 0x00, 0x00},
+	}), intermediate, &leafKey.PublicKey, intKey)
+	h.delegated, _ = issue(leaf(true), preIssuer, &leafKey.PublicKey, preKey)
+	h.delegatedFinal = h.directFinal
+	h.delegatedNoAKI, _ = issue(leaf(true), withoutSKI(preIssuer), &leafKey.PublicKey, preKey)
+	h.noAKIFinal = tbs(issue(leaf(false), withoutSKI(intermediate), &leafKey.PublicKey, intKey))
+	h.finalFromPreIssuer, _ = issue(leaf(false), preIssuer, &leafKey.PublicKey, preKey)
+	// A Precertificate Signing Certificate without an Authority Key
+	// Identifier, and a precertificate with one.
+	h.preIssuerNoAKI, _ = issue(preTmpl, withoutSKI(intermediate), &preKey.PublicKey, intKey)
+	h.precertForPreIssuerNoAKI, _ = issue(leaf(true), preIssuer, &leafKey.PublicKey, preKey)
+	withEKU := func(serial int64, eku ...x509.ExtKeyUsage) *x509.Certificate {
+		c := leaf(false)
+		c.SerialNumber = big.NewInt(serial)
+		c.ExtKeyUsage = eku
+		return c
+	}
+	h.serverAuth, _ = issue(withEKU(101, x509.ExtKeyUsageServerAuth), intermediate, &leafKey.PublicKey, intKey)
+	h.noEKU, _ = issue(withEKU(102), intermediate, &leafKey.PublicKey, intKey)
+	h.anyEKU, _ = issue(withEKU(103, x509.ExtKeyUsageAny), intermediate, &leafKey.PublicKey, intKey)
+	h.clientAuth, _ = issue(withEKU(104, x509.ExtKeyUsageClientAuth), intermediate, &leafKey.PublicKey, intKey)
+	return h
+}
+
+func TestPrecertSigningCerts(t *testing.T) {
+	h := newPrecertHierarchy(t)
+	newLog := func(t *testing.T) *TestLog {
+		tl := NewEmptyTestLog(t)
+		r := x509util.NewPEMCertPool()
+		r.AppendCertsFromPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: h.root}))
+		tl.Log.SetRoots(r)
+		return tl
+	}
+	submit := func(tl *TestLog, path string, chain ...[]byte) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string][][]byte{"chain": chain})
+		fatalIfErr(t, err)
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+		return rr
+	}
+	// firstEntry returns the entry at index 0 of a log with a single entry.
+	firstEntry := func(t *testing.T, tl *TestLog) *ctlog.SequencedLogEntry {
+		tile := tlog.Tile{H: ctlog.TileHeight, L: -1, N: 0, W: 1}
+		b, err := tl.Config.Backend.Fetch(context.Background(), tile.Path())
+		fatalIfErr(t, err)
+		e, _, err := ctlog.ReadTileLeaf(b)
+		fatalIfErr(t, err)
+		return e
+	}
+
+	for _, tc := range []struct {
+		name      string
+		chain     [][]byte
+		tbs       []byte
+		preIssuer []byte
+	}{
+		{"Direct", [][]byte{h.direct, h.intermediate, h.root}, h.directFinal, nil},
+		{"Delegated", [][]byte{h.delegated, h.preIssuer, h.intermediate, h.root}, h.delegatedFinal, h.preIssuer},
+		{"DelegatedWithoutRoot", [][]byte{h.delegated, h.preIssuer, h.intermediate}, h.delegatedFinal, h.preIssuer},
+		{"DelegatedWithoutAKI", [][]byte{h.delegatedNoAKI, h.preIssuer, h.intermediate, h.root}, h.noAKIFinal, h.preIssuer},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tl := newLog(t)
+			tl.StartSequencer()
+			if rr := submit(tl, "/ct/v1/add-pre-chain", tc.chain...); rr.Code != http.StatusOK {
+				t.Fatalf("got status %d, expected 200: %s", rr.Code, rr.Body)
+			}
+			tl.CheckLog()
+			e := firstEntry(t, tl)
+			if !e.IsPrecert {
+				t.Error("entry is not a precertificate")
+			}
+			if !bytes.Equal(e.Certificate, tc.tbs) {
+				t.Error("TBSCertificate doesn't match the final certificate")
+			}
+			if e.IssuerKeyHash != sha256.Sum256(h.intermediateSPKI) {
+				t.Error("issuer key hash is not of the intermediate")
+			}
+			if !bytes.Equal(e.PreCertificate, tc.chain[0]) {
+				t.Error("PreCertificate is not the submitted precertificate")
+			}
+			if !bytes.Equal(e.PrecertSigningCert, tc.preIssuer) {
+				t.Error("unexpected PrecertSigningCert")
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		chain  [][]byte
+		reject bool
+		err    string
+	}{
+		{"MissingIssuer", "/ct/v1/add-pre-chain", [][]byte{h.delegated, h.preIssuer}, false, "invalid chain"},
+		{"PreIssuerWithoutAKI", "/ct/v1/add-pre-chain", [][]byte{h.precertForPreIssuerNoAKI, h.preIssuerNoAKI, h.intermediate, h.root}, false, "Authority Key Identifier"},
+		{"FinalFromPreIssuer", "/ct/v1/add-chain", [][]byte{h.finalFromPreIssuer, h.preIssuer, h.intermediate, h.root}, false, "final certificate issued by precertificate signing certificate"},
+		{"Rejected", "/ct/v1/add-pre-chain", [][]byte{h.delegated, h.preIssuer, h.intermediate, h.root}, true, "not accepted"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tl := newLog(t)
+			tl.Config.RejectPrecertSigningCerts = tc.reject
+			rr := submit(tl, tc.path, tc.chain...)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("got status %d, expected 400", rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tc.err) {
+				t.Errorf("got error %q, expected %q", rr.Body.String(), tc.err)
+			}
+		})
+	}
+
+	t.Run("Accepted", func(t *testing.T) {
+		tl := newLog(t)
+		tl.Config.RejectPrecertSigningCerts = true
+		tl.StartSequencer()
+		if rr := submit(tl, "/ct/v1/add-pre-chain", h.direct, h.intermediate, h.root); rr.Code != http.StatusOK {
+			t.Errorf("got status %d, expected 200: %s", rr.Code, rr.Body)
+		}
+	})
+}
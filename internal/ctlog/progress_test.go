@@ -0,0 +1,24 @@
+package ctlog_test
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSequencerProgress(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	if p := tl.Log.SequencerProgress(); !p.IsZero() {
+		t.Errorf("got progress %v before the sequencer started", p)
+	}
+	start := time.Now()
+	tl.StartSequencer()
+	_, err := addCertificate(t, tl)(context.Background())
+	fatalIfErr(t, err)
+	// The round that sequenced the entry completes right after its SCT is
+	// returned, and more rounds follow every 50ms.
+	time.Sleep(200 * time.Millisecond)
+	if p := tl.Log.SequencerProgress(); !p.After(start) || time.Since(p) > 150*time.Millisecond {
+		t.Errorf("got progress %v, expected a recent time after %v", p, start)
+	}
+}
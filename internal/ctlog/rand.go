@@ -0,0 +1,58 @@
+package ctlog
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+)
+
+// lockedRand is a math/rand source that is safe for concurrent use, for the
+// random choices of a Log or S3Backend, such as the sequencer stagger and the
+// retry backoff. Seeding it with Config.Seed makes a run replayable, as long as
+// the operations happen in the same order.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+// Seed replaces the state of r with that of a new source seeded with seed.
+func (r *lockedRand) Seed(seed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.r.Seed(seed)
+}
+
+func (r *lockedRand) Int63n(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Int63n(n)
+}
+
+func (r *lockedRand) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Intn(n)
+}
+
+func (r *lockedRand) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Float64()
+}
+
+// RandomSeed returns a new random, non-zero seed for Config.Seed and
+// S3Backend.SetSeed.
+func RandomSeed() int64 {
+	for {
+		var b [8]byte
+		cryptorand.Read(b[:])
+		if seed := int64(binary.LittleEndian.Uint64(b[:])); seed != 0 {
+			return seed
+		}
+	}
+}
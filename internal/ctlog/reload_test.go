@@ -0,0 +1,39 @@
+package ctlog_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func TestSetPoolSizeAndState(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Log.SetPoolSize(1)
+	addCertificateFast(t, tl)
+	e := &ctlog.LogEntry{Certificate: []byte("pool is full")}
+	if _, source := tl.Log.AddLeafToPool(e); source != "ratelimit" {
+		t.Errorf("got source %q with a full pool, expected ratelimit", source)
+	}
+	tl.Log.SetPoolSize(0)
+	if _, source := tl.Log.AddLeafToPool(e); source == "ratelimit" {
+		t.Error("rate limited without a pool size")
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+
+	ts := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tl.Log.SetState("readonly", ts)
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/log.v3.json", nil))
+	var m struct {
+		State map[string]struct {
+			Timestamp time.Time `json:"timestamp"`
+		} `json:"state"`
+	}
+	fatalIfErr(t, json.Unmarshal(rr.Body.Bytes(), &m))
+	if len(m.State) != 1 || !m.State["readonly"].Timestamp.Equal(ts) {
+		t.Errorf("got state %v, expected readonly since %v", m.State, ts)
+	}
+}
@@ -0,0 +1,31 @@
+package ctlog_test
+
+import (
+	"context"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+func TestSubmitReordered(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	lc := tl.LogClient()
+	for _, chain := range []struct {
+		name  string
+		chain [][]byte
+	}{
+		{"OutOfOrder", [][]byte{testLeaf, testRoot, testIntermediate}},
+		{"Duplicates", [][]byte{testLeaf, testIntermediate, testIntermediate, testRoot, testRoot}},
+		{"Extraneous", [][]byte{testLeaf, testPrecert, testIntermediate, testRoot}},
+	} {
+		t.Run(chain.name, func(t *testing.T) {
+			var certs []ct.ASN1Cert
+			for _, c := range chain.chain {
+				certs = append(certs, ct.ASN1Cert{Data: c})
+			}
+			_, err := lc.AddChain(context.Background(), certs)
+			fatalIfErr(t, err)
+		})
+	}
+	tl.CheckLog()
+}
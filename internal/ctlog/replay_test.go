@@ -0,0 +1,98 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+// TestSeededReplay runs the same workload twice with the same Config.Seed and
+// a FakeClock, and checks that the published objects and the random
+// Retry-After values are identical, as needed to replay a failure.
+func TestSeededReplay(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+
+	run := func(seed int64) (objects map[string][]byte, retryAfter []string) {
+		backend := NewMemoryBackend(t)
+		logHandler, _ := testLogHandler(t)
+		config := &ctlog.Config{
+			Name:          "example.com/TestLog",
+			Key:           key,
+			Cache:         filepath.Join(t.TempDir(), "cache.db"),
+			Backend:       backend,
+			Lock:          NewMemoryLockBackend(t),
+			Log:           slog.New(logHandler),
+			Roots:         x509util.NewPEMCertPool(),
+			NotAfterStart: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			NotAfterLimit: time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC),
+			Clock:         ctlog.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)),
+			Seed:          seed,
+		}
+		root, err := ctx509.ParseCertificate(testRoot)
+		fatalIfErr(t, err)
+		config.Roots.AddCert(root)
+		fatalIfErr(t, ctlog.CreateLog(context.Background(), config))
+		log, err := ctlog.LoadLog(context.Background(), config)
+		fatalIfErr(t, err)
+		t.Cleanup(func() { fatalIfErr(t, log.CloseCache()) })
+
+		for round := range 3 {
+			for i := range 5 {
+				log.AddLeafToPool(&ctlog.LogEntry{Certificate: fmt.Appendf(nil, "replay %d %d", round, i)})
+			}
+			fatalIfErr(t, log.Sequence())
+		}
+
+		// Fill the pool, so that submissions are rejected with a random
+		// Retry-After.
+		log.SetPoolSize(1)
+		log.AddLeafToPool(&ctlog.LogEntry{Certificate: []byte("pending")})
+		for range 5 {
+			rr := httptest.NewRecorder()
+			log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+			if rr.Code != http.StatusServiceUnavailable {
+				t.Fatalf("got status %d, expected 503", rr.Code)
+			}
+			retryAfter = append(retryAfter, rr.Header().Get("Retry-After"))
+		}
+
+		objects = make(map[string][]byte)
+		for obj, err := range backend.List(context.Background(), "") {
+			fatalIfErr(t, err)
+			objects[obj.Key], err = backend.Fetch(context.Background(), obj.Key)
+			fatalIfErr(t, err)
+		}
+		return objects, retryAfter
+	}
+
+	objects1, retryAfter1 := run(1)
+	objects2, retryAfter2 := run(1)
+	if !maps.EqualFunc(objects1, objects2, bytes.Equal) {
+		t.Errorf("objects differ between runs with the same seed")
+	}
+	if !slices.Equal(retryAfter1, retryAfter2) {
+		t.Errorf("got Retry-After %v and %v with the same seed", retryAfter1, retryAfter2)
+	}
+	if _, retryAfter3 := run(2); slices.Equal(retryAfter1, retryAfter3) {
+		t.Errorf("got Retry-After %v with different seeds", retryAfter1)
+	}
+}
@@ -0,0 +1,50 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+func TestSubmissionLimits(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.MaxConcurrentValidations = 1
+	tl.Config.SubmissionTimeout = 100 * time.Millisecond
+	tl = ReloadLog(t, tl)
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+
+	// A request with a slow body holds the only validation slot.
+	pr, pw := io.Pipe()
+	slow := make(chan int)
+	go func() {
+		rr := httptest.NewRecorder()
+		tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", pr))
+		slow <- rr.Code
+	}()
+	time.Sleep(20 * time.Millisecond)
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d while validations are busy, expected 503", rr.Code)
+	}
+
+	// Without a sequencer, the slow request times out waiting for it.
+	pw.Write(body)
+	pw.Close()
+	if code := <-slow; code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d for an unsequenced request, expected 503", code)
+	}
+
+	tl.Config.SubmissionTimeout = 0
+	_, err = tl.LogClient().AddChain(context.Background(), []ct.ASN1Cert{
+		{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+	fatalIfErr(t, err)
+}
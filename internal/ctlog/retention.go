@@ -0,0 +1,252 @@
+package ctlog
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// InventoryKey is the key of the [ShardInventory] uploaded by
+// [DeleteRetiredShard] before deleting any tile.
+const InventoryKey = "tile-inventory.json"
+
+// RetentionOptions are the options of [DeleteRetiredShard].
+type RetentionOptions struct {
+	// Retention is how long the tiles are kept after the log was retired, as
+	// recorded in Config.StateTimestamp.
+	Retention time.Duration
+
+	// Confirm must be Config.Name, as an explicit confirmation that the tiles
+	// of this log are to be deleted.
+	Confirm string
+
+	// Delete is true if the tiles should be deleted. Otherwise, the checks are
+	// performed and the inventory is computed, but nothing is uploaded or
+	// deleted.
+	Delete bool
+
+	// BatchSize is the number of keys passed to each Delete call. Optional.
+	// Defaults to 1000, the maximum for S3.
+	BatchSize int
+
+	// BatchInterval is the minimum time between Delete calls, to limit the
+	// request rate to the backend. Optional.
+	BatchInterval time.Duration
+}
+
+// A ShardInventory records the final state of a deleted shard. It's uploaded
+// as JSON to [InventoryKey], alongside the checkpoint, which is not deleted.
+type ShardInventory struct {
+	Name       string `json:"name"`
+	TreeSize   int64  `json:"tree_size"`
+	RootHash   []byte `json:"root_hash"`
+	Checkpoint string `json:"checkpoint"`
+
+	// Created is when the inventory was taken, before the deletion started.
+	Created time.Time `json:"created"`
+
+	// Tiles counts the tiles in the backend, by level ("0", "1", ...) or
+	// "data".
+	Tiles map[string]InventoryCount `json:"tiles"`
+}
+
+// InventoryCount is the number and total size of a set of objects.
+type InventoryCount struct {
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// RetentionResult reports the outcome of [DeleteRetiredShard].
+type RetentionResult struct {
+	Inventory *ShardInventory
+
+	// Deleted and DeletedBytes are the number and total size of the tiles
+	// that were deleted by this call.
+	Deleted      int64
+	DeletedBytes int64
+}
+
+// DeleteRetiredShard deletes the tiles of a temporal shard that is past its
+// retention window, in rate-limited batches.
+//
+// It refuses to run unless opts.Confirm is the log name, the log is in the
+// "retired" state since at least opts.Retention, Config.NotAfterLimit is in
+// the past, and the checkpoint in object storage matches the lock backend,
+// which means the log is not sequencing.
+//
+// Before deleting anything, it uploads a [ShardInventory] to [InventoryKey].
+// If one already exists, for example because a previous run was interrupted,
+// it's kept. The checkpoint, issuers, and other non-tile objects are never
+// deleted.
+func DeleteRetiredShard(ctx context.Context, config *Config, opts *RetentionOptions) (*RetentionResult, error) {
+	b, ok := config.Backend.(GCBackend)
+	if !ok {
+		return nil, fmtErrorf("backend doesn't support listing and deleting objects")
+	}
+	if opts.Confirm != config.Name {
+		return nil, fmtErrorf("confirmation %q doesn't match log name %q", opts.Confirm, config.Name)
+	}
+	if config.NotAfterLimit.IsZero() {
+		return nil, fmtErrorf("log is not a temporal shard: NotAfterLimit is not set")
+	}
+	now := time.Now()
+	if config.NotAfterLimit.After(now) {
+		return nil, fmtErrorf("log still accepts unexpired certificates until %v", config.NotAfterLimit)
+	}
+	if config.State != "retired" || config.StateTimestamp.IsZero() {
+		return nil, fmtErrorf("log state is %q, not retired", config.State)
+	}
+	if end := config.StateTimestamp.Add(opts.Retention); end.After(now) {
+		return nil, fmtErrorf("log is within its retention window until %v", end)
+	}
+
+	pkix, err := x509.MarshalPKIXPublicKey(config.Key.Public())
+	if err != nil {
+		return nil, fmtErrorf("couldn't marshal public key: %w", err)
+	}
+	lock, err := config.Lock.Fetch(ctx, sha256.Sum256(pkix))
+	if err != nil {
+		return nil, fmtErrorf("couldn't fetch checkpoint from lock database: %w", err)
+	}
+	locked, err := openCheckpoint(config.Name, config.Key.Public(), lock.Bytes())
+	if err != nil {
+		return nil, fmtErrorf("invalid lock checkpoint: %w", err)
+	}
+	signed, err := b.Fetch(ctx, "checkpoint")
+	if err != nil {
+		return nil, fmtErrorf("couldn't fetch checkpoint: %w", err)
+	}
+	published, err := openCheckpoint(config.Name, config.Key.Public(), signed)
+	if err != nil {
+		return nil, fmtErrorf("invalid checkpoint in object storage: %w", err)
+	}
+	if published.Tree != locked.Tree {
+		return nil, fmtErrorf("checkpoint in object storage doesn't match lock checkpoint (sizes %d and %d), is the log still running?",
+			published.N, locked.N)
+	}
+
+	res := &RetentionResult{}
+	if inv, err := fetchInventory(ctx, b); err == nil {
+		if inv.Name != config.Name || inv.TreeSize != published.N {
+			return nil, fmtErrorf("existing inventory is for %q at size %d", inv.Name, inv.TreeSize)
+		}
+		config.Log.InfoContext(ctx, "resuming deletion with existing inventory", "created", inv.Created)
+		res.Inventory = inv
+	} else {
+		inv := &ShardInventory{
+			Name:       config.Name,
+			TreeSize:   published.N,
+			RootHash:   published.Hash[:],
+			Checkpoint: string(signed),
+			Created:    now,
+			Tiles:      make(map[string]InventoryCount),
+		}
+		for obj, err := range b.List(ctx, "tile/") {
+			if err != nil {
+				return nil, fmtErrorf("failed to list tiles: %w", err)
+			}
+			level, ok := inventoryLevel(obj.Key)
+			if !ok {
+				continue
+			}
+			c := inv.Tiles[level]
+			c.Objects++
+			c.Bytes += obj.Size
+			inv.Tiles[level] = c
+		}
+		res.Inventory = inv
+		if !opts.Delete {
+			config.Log.InfoContext(ctx, "dry run, not deleting tiles", "tree_size", inv.TreeSize)
+			return res, nil
+		}
+		j, err := json.MarshalIndent(inv, "", "\t")
+		if err != nil {
+			return nil, fmtErrorf("couldn't marshal inventory: %w", err)
+		}
+		if err := b.Upload(ctx, InventoryKey, j, &UploadOptions{ContentType: "application/json"}); err != nil {
+			return nil, fmtErrorf("couldn't upload inventory: %w", err)
+		}
+		config.Log.InfoContext(ctx, "uploaded inventory", "key", InventoryKey, "tree_size", inv.TreeSize)
+	}
+	if !opts.Delete {
+		return res, nil
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 || batchSize > gcDeleteBatch {
+		batchSize = gcDeleteBatch
+	}
+	var batch []string
+	var batchBytes int64
+	var last time.Time
+	flush := func() error {
+		if wait := opts.BatchInterval - time.Since(last); !last.IsZero() && wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		last = time.Now()
+		if err := b.Delete(ctx, batch); err != nil {
+			return err
+		}
+		res.Deleted += int64(len(batch))
+		res.DeletedBytes += batchBytes
+		config.Log.DebugContext(ctx, "deleted tiles", "keys", len(batch), "total", res.Deleted)
+		batch, batchBytes = batch[:0], 0
+		return nil
+	}
+	for obj, err := range b.List(ctx, "tile/") {
+		if err != nil {
+			return res, fmtErrorf("failed to list tiles: %w", err)
+		}
+		if _, ok := inventoryLevel(obj.Key); !ok {
+			continue
+		}
+		batch = append(batch, obj.Key)
+		batchBytes += obj.Size
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return res, fmtErrorf("failed to delete tiles: %w", err)
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return res, fmtErrorf("failed to delete tiles: %w", err)
+		}
+	}
+	config.Log.InfoContext(ctx, "deleted retired shard tiles", "deleted", res.Deleted, "bytes", res.DeletedBytes)
+	return res, nil
+}
+
+// inventoryLevel returns the inventory level of a tile key, or false if the
+// key is not a tile of this log.
+func inventoryLevel(key string) (string, bool) {
+	t, err := tlog.ParseTilePath(key)
+	if err != nil || t.H != TileHeight {
+		return "", false
+	}
+	if t.L == -1 {
+		return "data", true
+	}
+	return strconv.Itoa(t.L), true
+}
+
+func fetchInventory(ctx context.Context, b Backend) (*ShardInventory, error) {
+	j, err := b.Fetch(ctx, InventoryKey)
+	if err != nil {
+		return nil, err
+	}
+	inv := &ShardInventory{}
+	if err := json.Unmarshal(j, inv); err != nil {
+		return nil, fmtErrorf("invalid inventory: %w", err)
+	}
+	return inv, nil
+}
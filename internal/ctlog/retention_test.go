@@ -0,0 +1,88 @@
+package ctlog_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func TestDeleteRetiredShard(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	ctx := context.Background()
+
+	for i := 0; i < tileWidth+10; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	fatalIfErr(t, tl.Config.Backend.Upload(ctx, "issuer/test", []byte("issuer"), nil))
+
+	b := tl.Config.Backend.(*MemoryBackend)
+	countTiles := func() int {
+		var n int
+		for range b.List(ctx, "tile/") {
+			n++
+		}
+		return n
+	}
+	before := countTiles()
+
+	config := *tl.Config
+	opts := &ctlog.RetentionOptions{Retention: 24 * time.Hour, Confirm: config.Name, BatchSize: 3}
+	if _, err := ctlog.DeleteRetiredShard(ctx, &config, opts); err == nil {
+		t.Error("expected error for a log without NotAfterLimit")
+	}
+	config.NotAfterLimit = time.Now().Add(-48 * time.Hour)
+	config.State = "retired"
+	config.StateTimestamp = time.Now().Add(-time.Hour)
+	if _, err := ctlog.DeleteRetiredShard(ctx, &config, opts); err == nil {
+		t.Error("expected error within the retention window")
+	}
+	config.StateTimestamp = time.Now().Add(-25 * time.Hour)
+	if _, err := ctlog.DeleteRetiredShard(ctx, &config, &ctlog.RetentionOptions{
+		Retention: 24 * time.Hour, Confirm: "wrong", Delete: true}); err == nil {
+		t.Error("expected error for the wrong confirmation")
+	}
+
+	res, err := ctlog.DeleteRetiredShard(ctx, &config, opts)
+	fatalIfErr(t, err)
+	if res.Deleted != 0 || countTiles() != before {
+		t.Errorf("dry run deleted %d tiles", res.Deleted)
+	}
+	if _, err := b.Fetch(ctx, ctlog.InventoryKey); err == nil {
+		t.Error("dry run uploaded the inventory")
+	}
+	var inventoried int64
+	for _, c := range res.Inventory.Tiles {
+		inventoried += c.Objects
+	}
+	if inventoried != int64(before) || res.Inventory.Tiles["data"].Objects == 0 {
+		t.Errorf("inventory has %d tiles, expected %d", inventoried, before)
+	}
+
+	opts.Delete = true
+	res, err = ctlog.DeleteRetiredShard(ctx, &config, opts)
+	fatalIfErr(t, err)
+	if res.Deleted != int64(before) {
+		t.Errorf("deleted %d tiles, expected %d", res.Deleted, before)
+	}
+	if n := countTiles(); n != 0 {
+		t.Errorf("%d tiles left", n)
+	}
+	for _, key := range []string{"checkpoint", "issuer/test", ctlog.InventoryKey} {
+		if _, err := b.Fetch(ctx, key); err != nil {
+			t.Errorf("%q was deleted", key)
+		}
+	}
+	if res.Inventory.TreeSize != int64(tileWidth+10) {
+		t.Errorf("inventory tree size is %d", res.Inventory.TreeSize)
+	}
+
+	// A second run resumes with the existing inventory.
+	res2, err := ctlog.DeleteRetiredShard(ctx, &config, opts)
+	fatalIfErr(t, err)
+	if res2.Deleted != 0 || !res2.Inventory.Created.Equal(res.Inventory.Created) {
+		t.Errorf("second run deleted %d tiles, inventory created %v", res2.Deleted, res2.Inventory.Created)
+	}
+}
@@ -0,0 +1,84 @@
+package ctlog
+
+import (
+	"crypto/sha256"
+	"slices"
+
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+// TestSubmissionHeader is the request header that must carry
+// Config.TestRootsToken for a submission to be accepted under Config.TestRoots.
+const TestSubmissionHeader = "Sunlight-Test-Submission"
+
+// rootSet is the set of roots a log accepts submissions under.
+type rootSet struct {
+	// accepted is Config.Roots or the last SetRoots argument, minus
+	// Config.DeniedRoots.
+	accepted *x509util.PEMCertPool
+	// test is accepted plus Config.TestRoots, minus Config.DeniedRoots. It's
+	// used for submissions that carry TestSubmissionHeader.
+	test *x509util.PEMCertPool
+}
+
+func (l *Log) newRootSet(roots *x509util.PEMCertPool) *rootSet {
+	denied := func(c []byte) bool {
+		return slices.Contains(l.c.DeniedRoots, sha256.Sum256(c))
+	}
+	rs := &rootSet{accepted: x509util.NewPEMCertPool(), test: x509util.NewPEMCertPool()}
+	for _, c := range roots.RawCertificates() {
+		if denied(c.RawSubjectPublicKeyInfo) {
+			continue
+		}
+		rs.accepted.AddCert(c)
+		rs.test.AddCert(c)
+	}
+	if l.c.TestRoots != nil {
+		for _, c := range l.c.TestRoots.RawCertificates() {
+			if denied(c.RawSubjectPublicKeyInfo) {
+				continue
+			}
+			rs.test.AddCert(c)
+		}
+	}
+	return rs
+}
+
+// Roots returns the currently accepted roots, excluding Config.DeniedRoots
+// and Config.TestRoots.
+func (l *Log) Roots() *x509util.PEMCertPool {
+	return l.roots.Load().accepted
+}
+
+// SetRoots atomically replaces the set of accepted roots. Submissions that
+// already started validation might still use the old set. Config.DeniedRoots
+// are excluded from roots, as they are from Config.Roots.
+//
+// The additions and removals are logged, and the roots reloads metric is
+// incremented. roots must not be modified after it's passed to SetRoots.
+func (l *Log) SetRoots(roots *x509util.PEMCertPool) {
+	rs := l.newRootSet(roots)
+	old := l.roots.Swap(rs).accepted
+	oldSet := make(map[[sha256.Size]byte]bool)
+	for _, c := range old.RawCertificates() {
+		oldSet[sha256.Sum256(c.Raw)] = true
+	}
+	newSet := make(map[[sha256.Size]byte]bool)
+	for _, c := range rs.accepted.RawCertificates() {
+		h := sha256.Sum256(c.Raw)
+		newSet[h] = true
+		if !oldSet[h] {
+			l.c.Log.Info("added root", "root", x509util.NameToString(c.Subject),
+				"sha256", h[:])
+		}
+	}
+	for _, c := range old.RawCertificates() {
+		if h := sha256.Sum256(c.Raw); !newSet[h] {
+			l.c.Log.Info("removed root", "root", x509util.NameToString(c.Subject),
+				"sha256", h[:])
+		}
+	}
+	l.m.ConfigRoots.Set(float64(len(rs.accepted.RawCertificates())))
+	l.m.ConfigRootsReloads.Inc()
+	l.c.Log.Info("reloaded roots", "old", len(oldSet), "new", len(newSet))
+}
@@ -0,0 +1,45 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/x509util"
+)
+
+func TestSetRoots(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+	lc := tl.LogClient()
+
+	tl.Log.SetRoots(x509util.NewPEMCertPool())
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, expected 400", rr.Code)
+	}
+	roots, err := lc.GetAcceptedRoots(context.Background())
+	fatalIfErr(t, err)
+	if len(roots) != 0 {
+		t.Errorf("got %d roots, expected 0", len(roots))
+	}
+
+	r := x509util.NewPEMCertPool()
+	r.AppendCertsFromPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testRoot}))
+	tl.Log.SetRoots(r)
+	_, err = lc.AddChain(context.Background(), []ct.ASN1Cert{
+		{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+	fatalIfErr(t, err)
+	roots, err = lc.GetAcceptedRoots(context.Background())
+	fatalIfErr(t, err)
+	if len(roots) != 1 {
+		t.Errorf("got %d roots, expected 1", len(roots))
+	}
+}
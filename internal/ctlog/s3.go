@@ -4,17 +4,22 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"log/slog"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	awshttp "github.com/aws/smithy-go/transport/http"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -22,6 +27,7 @@ import (
 
 type S3Backend struct {
 	client        *s3.Client
+	transport     *http.Transport
 	bucket        string
 	keyPrefix     string
 	metrics       []prometheus.Collector
@@ -30,6 +36,18 @@ type S3Backend struct {
 	hedgeRequests prometheus.Counter
 	hedgeWins     prometheus.Counter
 	log           *slog.Logger
+
+	// inflight limits the concurrent requests, if set by SetMaxInFlight.
+	inflight chan struct{}
+
+	// features gates the upload behaviors, if set by SetFeatures.
+	features *Features
+
+	compressor compressor
+	hedger     *hedger
+
+	// rand jitters the retry backoff, and can be seeded by SetSeed.
+	rand *lockedRand
 }
 
 func NewS3Backend(ctx context.Context, region, bucket, endpoint, keyPrefix string, l *slog.Logger) (*S3Backend, error) {
@@ -80,7 +98,11 @@ func NewS3Backend(ctx context.Context, region, bucket, endpoint, keyPrefix strin
 		},
 	)
 
-	transport := http.RoundTripper(http.DefaultTransport.(*http.Transport).Clone())
+	hedger := newHedger()
+	r := newLockedRand(RandomSeed())
+
+	baseTransport := http.DefaultTransport.(*http.Transport).Clone()
+	transport := http.RoundTripper(baseTransport)
 	transport = promhttp.InstrumentRoundTripperCounter(counter, transport)
 	transport = promhttp.InstrumentRoundTripperDuration(duration, transport)
 
@@ -96,21 +118,160 @@ func NewS3Backend(ctx context.Context, region, bucket, endpoint, keyPrefix strin
 				o.BaseEndpoint = aws.String(endpoint)
 			}
 			o.HTTPClient = &http.Client{Transport: transport}
-			o.Retryer = retry.AddWithMaxBackoffDelay(retry.NewStandard(), 5*time.Millisecond)
+			o.Retryer = retry.AddWithMaxBackoffDelay(retry.NewStandard(func(o *retry.StandardOptions) {
+				o.Backoff = jitterBackoff(r)
+			}), 5*time.Millisecond)
 		}),
+		transport: baseTransport,
 		bucket:    bucket,
 		keyPrefix: keyPrefix,
 		metrics: []prometheus.Collector{counter, duration,
-			uploadSize, compressRatio, hedgeRequests, hedgeWins},
+			uploadSize, compressRatio, hedgeRequests, hedgeWins,
+			hedger.delayGauge, hedger.capped},
 		uploadSize:    uploadSize,
 		compressRatio: compressRatio,
 		hedgeRequests: hedgeRequests,
 		hedgeWins:     hedgeWins,
+		hedger:        hedger,
+		rand:          r,
 		log:           l,
 	}, nil
 }
 
-var _ Backend = &S3Backend{}
+// jitterBackoff is like retry.ExponentialJitterBackoff, a random delay of up
+// to 2^attempt seconds, but draws from r, to be reproducible with SetSeed.
+func jitterBackoff(r *lockedRand) retry.BackoffDelayer {
+	return retry.BackoffDelayerFunc(func(attempt int, err error) (time.Duration, error) {
+		return time.Duration(r.Float64() * float64(time.Second<<min(attempt, 5))), nil
+	})
+}
+
+// SetSeed seeds the jitter of the retry backoff, which is otherwise random,
+// like Config.Seed does for the Log. It must be called before the backend is
+// used.
+func (s *S3Backend) SetSeed(seed int64) {
+	s.rand.Seed(seed)
+}
+
+var _ GCBackend = &S3Backend{}
+
+// SetMaxInFlight limits the concurrent requests to S3, including hedges and
+// retries, to n, so that a burst of backend operations can't exhaust the
+// memory or sockets of the process. Further requests wait for a slot. It must
+// be called before the backend is used. Zero means no limit.
+func (s *S3Backend) SetMaxInFlight(n int) {
+	if n > 0 {
+		s.inflight = make(chan struct{}, n)
+	}
+}
+
+// S3TransportOptions tune the connections of an [S3Backend]. The zero value
+// keeps the net/http defaults.
+type S3TransportOptions struct {
+	// MaxIdleConnsPerHost is the number of idle connections kept open to the
+	// S3 endpoint. The net/http default is only 2, so a burst of concurrent
+	// uploads opens (and then closes) many new connections.
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept open. The
+	// net/http default is 90s.
+	IdleConnTimeout time.Duration
+
+	// TLSSessionCacheSize is the number of TLS sessions kept for resumption,
+	// which makes the handshakes of new connections cheaper. Zero disables
+	// resumption.
+	TLSSessionCacheSize int
+}
+
+// SetTransportOptions applies o to the HTTP transport of the backend. It must
+// be called before the backend is used.
+func (s *S3Backend) SetTransportOptions(o S3TransportOptions) {
+	if o.MaxIdleConnsPerHost > 0 {
+		s.transport.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+		s.transport.MaxIdleConns = max(s.transport.MaxIdleConns, o.MaxIdleConnsPerHost)
+	}
+	if o.IdleConnTimeout > 0 {
+		s.transport.IdleConnTimeout = o.IdleConnTimeout
+	}
+	if o.TLSSessionCacheSize > 0 {
+		if s.transport.TLSClientConfig == nil {
+			s.transport.TLSClientConfig = &tls.Config{}
+		}
+		s.transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(o.TLSSessionCacheSize)
+	}
+}
+
+// Prewarm opens n connections to the S3 endpoint with concurrent HEAD
+// requests for the checkpoint, so that the first burst of uploads doesn't pay
+// for the TCP and TLS handshakes. The connections are kept only if
+// MaxIdleConnsPerHost allows it, and until IdleConnTimeout. The requests
+// count against the SetMaxInFlight limit.
+//
+// Failed requests, including for a missing checkpoint, are not errors: Prewarm
+// returns an error only if no connection could be established.
+func (s *S3Backend) Prewarm(ctx context.Context, n int) error {
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.acquire(ctx); err != nil {
+				errs[i] = err
+				return
+			}
+			defer s.release()
+			_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    aws.String(s.keyPrefix + "checkpoint"),
+			})
+			// Any HTTP response, such as a 404, means the connection works.
+			var sendErr *awshttp.RequestSendError
+			if errors.As(err, &sendErr) || ctx.Err() != nil {
+				errs[i] = err
+			}
+		}()
+	}
+	wg.Wait()
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if n > 0 && failed == n {
+		return fmtErrorf("failed to prewarm S3 connections: %w", errs[0])
+	}
+	s.log.InfoContext(ctx, "prewarmed S3 connections", "connections", n-failed, "failed", failed,
+		"duration", time.Since(start))
+	return nil
+}
+
+// SetFeatures makes the backend check f for [FeatureConditionalWrites] and
+// [FeatureHedgedUploads] on every upload. It must be called before the
+// backend is used. If not called, the features are at their defaults.
+func (s *S3Backend) SetFeatures(f *Features) {
+	s.features = f
+}
+
+func (s *S3Backend) acquire(ctx context.Context) error {
+	if s.inflight == nil {
+		return nil
+	}
+	select {
+	case s.inflight <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+func (s *S3Backend) release() {
+	if s.inflight != nil {
+		<-s.inflight
+	}
+}
 
 func (s *S3Backend) Upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
 	start := time.Now()
@@ -118,16 +279,22 @@ func (s *S3Backend) Upload(ctx context.Context, key string, data []byte, opts *U
 	if opts != nil && opts.ContentType != "" {
 		contentType = aws.String(opts.ContentType)
 	}
+	original := data
 	var contentEncoding *string
+	// requests tracks the PutObject calls that might still be reading the
+	// compressed data, which can't be reused until they return.
+	var requests sync.WaitGroup
 	if opts != nil && opts.Compress {
-		b := &bytes.Buffer{}
-		w := gzip.NewWriter(b)
-		if _, err := w.Write(data); err != nil {
-			return fmtErrorf("failed to compress %q: %w", key, err)
-		}
-		if err := w.Close(); err != nil {
+		b, err := s.compressor.compress(ctx, data, opts.Class)
+		if err != nil {
 			return fmtErrorf("failed to compress %q: %w", key, err)
 		}
+		defer func() {
+			go func() {
+				requests.Wait()
+				putUploadBuffer(b)
+			}()
+		}()
 		s.compressRatio.Observe(float64(b.Len()) / float64(len(data)))
 		data = b.Bytes()
 		contentEncoding = aws.String("gzip")
@@ -136,7 +303,12 @@ func (s *S3Backend) Upload(ctx context.Context, key string, data []byte, opts *U
 	if opts != nil && opts.Immutable {
 		cacheControl = aws.String("public, max-age=604800, immutable")
 	}
-	putObject := func() (*s3.PutObjectOutput, error) {
+	conditional := opts != nil && opts.Immutable && s.features.Enabled(FeatureConditionalWrites)
+	putObject := func(ctx context.Context) (*s3.PutObjectOutput, error) {
+		if err := s.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer s.release()
 		return s.client.PutObject(ctx, &s3.PutObjectInput{
 			Bucket:          aws.String(s.bucket),
 			Key:             aws.String(s.keyPrefix + key),
@@ -152,53 +324,128 @@ func (s *S3Backend) Upload(ctx context.Context, key string, data []byte, opts *U
 			// protects against signing a split tree, but there is a risk that the
 			// losing sequencer will overwrite the data tiles of the winning one.
 			// Without S3 Versioning, that's potentially irrecoverable.
-			if opts.Immutable && options.BaseEndpoint != nil &&
-				*options.BaseEndpoint == "https://fly.storage.tigris.dev" {
+			tigris := options.BaseEndpoint != nil &&
+				*options.BaseEndpoint == "https://fly.storage.tigris.dev"
+			if opts.Immutable && tigris {
 				options.APIOptions = append(options.APIOptions, awshttp.AddHeaderValue("If-Match", ""))
+			} else if conditional {
+				options.APIOptions = append(options.APIOptions, awshttp.AddHeaderValue("If-None-Match", "*"))
 			}
 		})
 	}
+	var err error
+	if s.features.Enabled(FeatureHedgedUploads) {
+		var class ObjectClass
+		if opts != nil {
+			class = opts.Class
+		}
+		err = s.hedge(ctx, key, class, putObject, &requests)
+	} else {
+		_, err = putObject(ctx)
+	}
+	s.log.DebugContext(ctx, "S3 PUT", "key", key, "size", len(data),
+		"compress", contentEncoding != nil, "type", *contentType,
+		"immutable", cacheControl != nil, "conditional", conditional,
+		"elapsed", time.Since(start), "err", err)
+	s.uploadSize.Observe(float64(len(data)))
+	if err != nil && conditional && objectExists(err) {
+		// The object already exists, which is expected if a hedge or a retry
+		// won. Anything other than the same contents is a conflict.
+		existing, fetchErr := s.Fetch(ctx, key)
+		if fetchErr != nil {
+			return fmtErrorf("failed to upload %q to S3: %w (and failed to fetch existing object: %v)", key, err, fetchErr)
+		}
+		if !bytes.Equal(existing, original) {
+			return fmtErrorf("failed to upload %q to S3: a different object already exists", key)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmtErrorf("failed to upload %q to S3: %w", key, err)
+	}
+	return nil
+}
+
+// hedge calls putObject, and calls it again concurrently if the first call
+// didn't return within the hedging delay for class, returning the result of
+// the first to complete. The second call might still be running when hedge
+// returns, until requests is done.
+func (s *S3Backend) hedge(ctx context.Context, key string, class ObjectClass,
+	putObject func(context.Context) (*s3.PutObjectOutput, error), requests *sync.WaitGroup) error {
+	start := time.Now()
 	ctx, cancel := context.WithCancelCause(ctx)
 	hedgeErr := make(chan error, 1)
+	requests.Add(1)
 	go func() {
-		timer := time.NewTimer(75 * time.Millisecond)
+		defer requests.Done()
+		timer := time.NewTimer(s.hedger.delay(class))
 		defer timer.Stop()
 		select {
 		case <-ctx.Done():
 		case <-timer.C:
+			if !s.hedger.allow() {
+				return
+			}
 			s.hedgeRequests.Inc()
-			_, err := putObject()
+			_, err := putObject(ctx)
 			s.log.DebugContext(ctx, "S3 PUT hedge", "key", key, "err", err)
 			hedgeErr <- err
 			cancel(errors.New("competing request succeeded"))
 		}
 	}()
-	_, err := putObject()
+	_, err := putObject(ctx)
 	select {
 	case err = <-hedgeErr:
 		s.hedgeWins.Inc()
 	default:
 		cancel(errors.New("competing request succeeded"))
 	}
-	s.log.DebugContext(ctx, "S3 PUT", "key", key, "size", len(data),
-		"compress", contentEncoding != nil, "type", *contentType,
-		"immutable", cacheControl != nil,
-		"elapsed", time.Since(start), "err", err)
-	s.uploadSize.Observe(float64(len(data)))
-	if err != nil {
-		return fmtErrorf("failed to upload %q to S3: %w", key, err)
+	if err == nil {
+		s.hedger.observe(class, time.Since(start))
 	}
-	return nil
+	return err
+}
+
+// objectExists reports whether err is the response to a conditional write of
+// an object that already exists: 412 Precondition Failed, or 409 Conflict if
+// another conditional write of the same key was in progress.
+func objectExists(err error) bool {
+	var re interface{ HTTPStatusCode() int }
+	if !errors.As(err, &re) {
+		return false
+	}
+	return re.HTTPStatusCode() == http.StatusPreconditionFailed ||
+		re.HTTPStatusCode() == http.StatusConflict
 }
 
 func (s *S3Backend) Fetch(ctx context.Context, key string) ([]byte, error) {
-	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+	data, _, err := s.FetchIfNoneMatch(ctx, key, "")
+	return data, err
+}
+
+var _ ConditionalBackend = &S3Backend{}
+
+func (s *S3Backend) FetchIfNoneMatch(ctx context.Context, key, etag string) ([]byte, string, error) {
+	if err := s.acquire(ctx); err != nil {
+		return nil, "", fmtErrorf("failed to fetch %q from S3: %w", key, err)
+	}
+	defer s.release()
+	in := &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(s.keyPrefix + key),
-	})
+	}
+	if etag != "" {
+		in.IfNoneMatch = aws.String(etag)
+	}
+	out, err := s.client.GetObject(ctx, in)
+	var re interface{ HTTPStatusCode() int }
+	if etag != "" && errors.As(err, &re) && re.HTTPStatusCode() == http.StatusNotModified {
+		s.log.DebugContext(ctx, "S3 GET", "key", key, "etag", etag, "status", "not modified")
+		return nil, etag, ErrNotModified
+	}
 	if err != nil {
 		s.log.DebugContext(ctx, "S3 GET", "key", key, "err", err)
-		return nil, fmtErrorf("failed to fetch %q from S3: %w", key, err)
+		return nil, "", fmtErrorf("failed to fetch %q from S3: %w", key, err)
 	}
 	defer out.Body.Close()
 	s.log.DebugContext(ctx, "S3 GET", "key", key,
@@ -207,14 +454,71 @@ func (s *S3Backend) Fetch(ctx context.Context, key string) ([]byte, error) {
 	if out.ContentEncoding != nil && *out.ContentEncoding == "gzip" {
 		body, err = gzip.NewReader(out.Body)
 		if err != nil {
-			return nil, fmtErrorf("failed to decompress %q from S3: %w", key, err)
+			return nil, "", fmtErrorf("failed to decompress %q from S3: %w", key, err)
 		}
 	}
 	data, err := io.ReadAll(body)
 	if err != nil {
-		return nil, fmtErrorf("failed to read %q from S3: %w", key, err)
+		return nil, "", fmtErrorf("failed to read %q from S3: %w", key, err)
 	}
-	return data, nil
+	return data, aws.ToString(out.ETag), nil
+}
+
+func (s *S3Backend) List(ctx context.Context, prefix string) iter.Seq2[ObjectInfo, error] {
+	return func(yield func(ObjectInfo, error) bool) {
+		p := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(s.bucket),
+			Prefix: aws.String(s.keyPrefix + prefix),
+		})
+		for p.HasMorePages() {
+			if err := s.acquire(ctx); err != nil {
+				yield(ObjectInfo{}, fmtErrorf("failed to list %q in S3: %w", prefix, err))
+				return
+			}
+			page, err := p.NextPage(ctx)
+			s.release()
+			if err != nil {
+				yield(ObjectInfo{}, fmtErrorf("failed to list %q in S3: %w", prefix, err))
+				return
+			}
+			s.log.DebugContext(ctx, "S3 LIST", "prefix", prefix, "keys", len(page.Contents))
+			for _, obj := range page.Contents {
+				info := ObjectInfo{
+					Key:          strings.TrimPrefix(aws.ToString(obj.Key), s.keyPrefix),
+					Size:         aws.ToInt64(obj.Size),
+					LastModified: aws.ToTime(obj.LastModified),
+				}
+				if !yield(info, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *S3Backend) Delete(ctx context.Context, keys []string) error {
+	objects := make([]types.ObjectIdentifier, 0, len(keys))
+	for _, key := range keys {
+		objects = append(objects, types.ObjectIdentifier{Key: aws.String(s.keyPrefix + key)})
+	}
+	if err := s.acquire(ctx); err != nil {
+		return fmtErrorf("failed to delete objects from S3: %w", err)
+	}
+	out, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+	})
+	s.release()
+	s.log.DebugContext(ctx, "S3 DELETE", "keys", len(keys), "err", err)
+	if err != nil {
+		return fmtErrorf("failed to delete objects from S3: %w", err)
+	}
+	if len(out.Errors) > 0 {
+		e := out.Errors[0]
+		return fmtErrorf("failed to delete %d objects from S3, including %q: %s",
+			len(out.Errors), aws.ToString(e.Key), aws.ToString(e.Message))
+	}
+	return nil
 }
 
 func (s *S3Backend) Metrics() []prometheus.Collector {
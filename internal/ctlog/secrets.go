@@ -0,0 +1,192 @@
+package ctlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"golang.org/x/oauth2/google"
+)
+
+// SecretRefScheme is the URI scheme of the secret references accepted by
+// [FetchSecret].
+const SecretRefScheme = "secretref"
+
+const gcpSecretManagerEndpoint = "https://secretmanager.googleapis.com/v1/"
+
+// IsSecretRef reports whether s is a secret reference for [FetchSecret].
+func IsSecretRef(s string) bool {
+	return strings.HasPrefix(s, SecretRefScheme+"://")
+}
+
+// FetchSecret fetches the secret identified by ref, a URI of one of the forms
+//
+//   - secretref://aws/NAME, the secret NAME (or ARN) in AWS Secrets Manager,
+//     with the default AWS configuration, and the region overridden by a
+//     "region" query parameter, if any;
+//   - secretref://gcp/projects/PROJECT/secrets/SECRET, optionally followed by
+//     /versions/VERSION, in Google Cloud Secret Manager, with the Application
+//     Default Credentials; the latest version is used by default;
+//   - secretref://vault/MOUNT/PATH, the secret PATH of the KV version 2 engine
+//     at MOUNT in HashiCorp Vault, with the server, token, and namespace from
+//     the VAULT_ADDR, VAULT_TOKEN, and VAULT_NAMESPACE environment variables.
+//
+// A fragment, such as "#password", selects a string field of a JSON object
+// secret. It's required for Vault, whose secrets are always objects.
+func FetchSecret(ctx context.Context, ref string) ([]byte, error) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != SecretRefScheme {
+		return nil, fmtErrorf("invalid secret reference %q", ref)
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" {
+		return nil, fmtErrorf("secret reference %q has no secret name", ref)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var secret []byte
+	switch u.Host {
+	case "aws":
+		secret, err = fetchAWSSecret(ctx, name, u.Query().Get("region"))
+	case "gcp":
+		secret, err = fetchGCPSecret(ctx, name)
+	case "vault":
+		if u.Fragment == "" {
+			return nil, fmtErrorf("Vault secret reference %q requires a #field", ref)
+		}
+		secret, err = fetchVaultSecret(ctx, name)
+	default:
+		return nil, fmtErrorf("unknown secret provider %q in %q", u.Host, ref)
+	}
+	if err != nil {
+		return nil, fmtErrorf("failed to fetch secret %q: %w", ref, err)
+	}
+	if u.Fragment == "" {
+		return secret, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(secret, &fields); err != nil {
+		return nil, fmtErrorf("secret %q is not a JSON object: %w", ref, err)
+	}
+	v, ok := fields[u.Fragment].(string)
+	if !ok {
+		return nil, fmtErrorf("secret %q has no string field %q", ref, u.Fragment)
+	}
+	return []byte(v), nil
+}
+
+func fetchAWSSecret(ctx context.Context, name, region string) ([]byte, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmtErrorf("failed to load AWS config: %w", err)
+	}
+	if region != "" {
+		cfg.Region = region
+	}
+	if cfg.Region == "" {
+		return nil, fmtErrorf("AWS region is not configured")
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmtErrorf("failed to load AWS credentials: %w", err)
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return nil, err
+	}
+	endpoint := "https://secretsmanager." + cfg.Region + ".amazonaws.com/"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	payloadHash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]),
+		"secretsmanager", cfg.Region, time.Now()); err != nil {
+		return nil, fmtErrorf("failed to sign request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(b) > 200 {
+			b = b[:200]
+		}
+		return nil, &httpStatusError{method: "POST", url: endpoint, code: resp.StatusCode, body: b}
+	}
+	var out struct {
+		SecretString *string
+		SecretBinary []byte
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	if out.SecretString != nil {
+		return []byte(*out.SecretString), nil
+	}
+	return out.SecretBinary, nil
+}
+
+func fetchGCPSecret(ctx context.Context, name string) ([]byte, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, fmtErrorf("failed to load Google Cloud credentials: %w", err)
+	}
+	var out struct {
+		Payload struct {
+			Data []byte `json:"data"`
+		} `json:"payload"`
+	}
+	if err := doJSON(ctx, client, "GET", gcpSecretManagerEndpoint+name+":access", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Payload.Data, nil
+}
+
+func fetchVaultSecret(ctx context.Context, name string) ([]byte, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, fmtErrorf("VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+	mount, path, ok := strings.Cut(name, "/")
+	if !ok || path == "" {
+		return nil, fmtErrorf("Vault secret %q is not of the form MOUNT/PATH", name)
+	}
+	header := http.Header{"X-Vault-Token": {token}}
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		header.Set("X-Vault-Namespace", ns)
+	}
+	var out struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	endpoint := strings.TrimSuffix(addr, "/") + "/v1/" + mount + "/data/" + path
+	if err := doJSON(ctx, &http.Client{}, "GET", endpoint, header, nil, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Data.Data) == 0 {
+		return nil, fmtErrorf("Vault secret has no data")
+	}
+	return out.Data.Data, nil
+}
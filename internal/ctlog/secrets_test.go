@@ -0,0 +1,53 @@
+package ctlog_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func TestFetchSecret(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/secret/data/sunlight/log", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" || r.Header.Get("X-Vault-Namespace") != "ns" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"data": map[string]any{"passphrase": "hunter2", "version": 3}}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+	t.Setenv("VAULT_NAMESPACE", "ns")
+
+	ctx := context.Background()
+	b, err := ctlog.FetchSecret(ctx, "secretref://vault/secret/sunlight/log#passphrase")
+	fatalIfErr(t, err)
+	if string(b) != "hunter2" {
+		t.Errorf("got secret %q, expected %q", b, "hunter2")
+	}
+	for _, ref := range []string{
+		"secretref://vault/secret/sunlight/log",         // missing field
+		"secretref://vault/secret/sunlight/log#version", // not a string
+		"secretref://vault/secret/sunlight/log#missing",
+		"secretref://vault/secret/sunlight/other#passphrase",
+		"secretref://unknown/name",
+		"secretref://aws/",
+		"https://example.com/secret",
+	} {
+		if _, err := ctlog.FetchSecret(ctx, ref); err == nil {
+			t.Errorf("FetchSecret(%q) succeeded, expected error", ref)
+		}
+	}
+
+	t.Setenv("VAULT_TOKEN", "wrong")
+	if _, err := ctlog.FetchSecret(ctx, "secretref://vault/secret/sunlight/log#passphrase"); err == nil {
+		t.Error("FetchSecret succeeded with the wrong token")
+	}
+}
@@ -0,0 +1,212 @@
+package ctlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"filippo.io/sunlight"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// selfMonitorTimeout is the timeout of each self-monitor check, including all
+// the fetches it performs.
+const selfMonitorTimeout = 1 * time.Minute
+
+// CheckPublished verifies the log as published at Config.MonitoringURL, the
+// way an external monitor would see it. It fetches the checkpoint, verifies
+// its signature and its consistency with the checkpoint seen by the previous
+// call, and verifies the hashes of the tiles needed for that and of samples
+// randomly chosen data tiles against the tree.
+//
+// The outcome is recorded in the self-monitor metrics.
+func (l *Log) CheckPublished(ctx context.Context, samples int) error {
+	ctx, cancel := context.WithTimeout(ctx, selfMonitorTimeout)
+	defer cancel()
+
+	l.monitorMu.Lock()
+	defer l.monitorMu.Unlock()
+
+	tree, err := l.checkPublished(ctx, l.monitorTree, samples)
+	if err != nil {
+		l.m.SelfMonitorChecks.WithLabelValues(errorCategory(err)).Inc()
+		return err
+	}
+	l.m.SelfMonitorChecks.WithLabelValues("").Inc()
+	l.m.SelfMonitorTreeSize.Set(float64(tree.N))
+	l.m.SelfMonitorLastSuccess.Set(float64(time.Now().Unix()))
+	l.monitorTree = tree
+	return nil
+}
+
+func (l *Log) checkPublished(ctx context.Context, old tlog.Tree, samples int) (tlog.Tree, error) {
+	if l.c.MonitoringURL == "" {
+		return tlog.Tree{}, fmtErrorf("MonitoringURL is not set")
+	}
+	fetch := func(key string) ([]byte, error) {
+		return l.fetchPublished(ctx, key)
+	}
+
+	signed, err := fetch("checkpoint")
+	if err != nil {
+		return tlog.Tree{}, fmtErrorf("failed to fetch checkpoint: %w", err)
+	}
+	v, err := sunlight.NewRFC6962Verifier(l.c.Name, l.c.Key.Public(), nil)
+	if err != nil {
+		return tlog.Tree{}, fmtErrorf("couldn't construct verifier: %w", err)
+	}
+	n, err := note.Open(signed, note.VerifierList(v))
+	if err != nil {
+		return tlog.Tree{}, fmtErrorf("invalid checkpoint signature: %w", err)
+	}
+	c, err := sunlight.ParseCheckpoint(n.Text)
+	if err != nil {
+		return tlog.Tree{}, fmtErrorf("couldn't parse checkpoint: %w", err)
+	}
+	if c.Origin != l.c.Name {
+		return tlog.Tree{}, fmtErrorf("checkpoint origin %q doesn't match", c.Origin)
+	}
+
+	switch {
+	case c.N < old.N:
+		return tlog.Tree{}, fmtErrorf("checkpoint rolled back: size %d is smaller than %d", c.N, old.N)
+	case c.N == old.N && c.Hash != old.Hash:
+		return tlog.Tree{}, fmtErrorf("checkpoint forked: size %d has hash %v, expected %v", c.N, c.Hash, old.Hash)
+	}
+
+	// TileHashReader verifies every tile it reads against the tree.
+	hr := tlog.TileHashReader(c.Tree, &tileReader{
+		fetch:     fetch,
+		saveTiles: func(tiles []tlog.Tile, data [][]byte) {},
+	})
+	if old.N > 0 && old.N < c.N {
+		proof, err := tlog.ProveTree(c.N, old.N, hr)
+		if err != nil {
+			return tlog.Tree{}, fmtErrorf("couldn't build consistency proof: %w", err)
+		}
+		if err := tlog.CheckTree(proof, c.N, c.Hash, old.N, old.Hash); err != nil {
+			return tlog.Tree{}, fmtErrorf("checkpoint is inconsistent with previous: %w", err)
+		}
+	}
+
+	if c.N == 0 {
+		return c.Tree, nil
+	}
+	lastTile := (c.N - 1) / tileWidth
+	for i := 0; i < samples; i++ {
+		n := l.rand.Int63n(lastTile + 1)
+		tile := tlog.Tile{H: TileHeight, L: -1, N: n, W: tileWidth}
+		if n == lastTile {
+			tile.W = int(c.N - n*tileWidth)
+		}
+		b, err := fetch(tile.Path())
+		if err != nil {
+			return tlog.Tree{}, fmtErrorf("failed to fetch data tile: %w", err)
+		}
+		if err := checkDataTile(hr, tile, b); err != nil {
+			return tlog.Tree{}, err
+		}
+	}
+	return c.Tree, nil
+}
+
+// checkDataTile verifies that the leaves in b, the contents of a data tile,
+// hash to the level 0 hashes of the tree.
+func checkDataTile(hr tlog.HashReader, tile tlog.Tile, b []byte) error {
+	start := tile.N * tileWidth
+	indexes := make([]int64, 0, tile.W)
+	for i := start; i < start+int64(tile.W); i++ {
+		indexes = append(indexes, tlog.StoredHashIndex(0, i))
+	}
+	hashes, err := hr.ReadHashes(indexes)
+	if err != nil {
+		return fmtErrorf("couldn't read level 0 hashes: %w", err)
+	}
+	for i := range hashes {
+		e, rest, err := ReadTileLeaf(b)
+		if err != nil {
+			return fmtErrorf("invalid data tile %v: %w", tile.Path(), err)
+		}
+		b = rest
+		if idx := start + int64(i); e.LeafIndex != idx {
+			return fmtErrorf("data tile leaf %d has index %d", idx, e.LeafIndex)
+		}
+		if got := tlog.RecordHash(e.MerkleTreeLeaf()); got != hashes[i] {
+			return fmtErrorf("data tile leaf %d hashes to %v, level 0 hash is %v", start+int64(i), got, hashes[i])
+		}
+	}
+	if len(b) != 0 {
+		return fmtErrorf("invalid data tile %v: trailing data", tile.Path())
+	}
+	return nil
+}
+
+// fetchPublished fetches key from Config.MonitoringURL. Objects fetched
+// before are revalidated with If-None-Match and If-Modified-Since, so that an
+// unchanged checkpoint or tile isn't transferred again. A 304 still means the
+// object is published as it was when it was verified.
+func (l *Log) fetchPublished(ctx context.Context, key string) ([]byte, error) {
+	url := strings.TrimSuffix(l.c.MonitoringURL, "/") + "/" + key
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	cached := l.monitorObjects.get(key)
+	if cached != nil {
+		if cached.eTag != "" {
+			req.Header.Set("If-None-Match", cached.eTag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		l.m.ObjectCacheRequests.WithLabelValues("monitor", "not_modified").Inc()
+		return cached.data, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	l.m.ObjectCacheRequests.WithLabelValues("monitor", "miss").Inc()
+	l.monitorObjects.put(key, &cachedObject{
+		data:         data,
+		eTag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	})
+	return data, nil
+}
+
+// RunSelfMonitor calls CheckPublished every interval until ctx is canceled,
+// so that a publishing problem (a corrupted tile, a stale or rolled back
+// checkpoint, or a misconfigured CDN) is detected by the log operator before
+// it's detected by the log's monitors.
+//
+// The interval should be around the sequencing period, to check each
+// published checkpoint.
+func (l *Log) RunSelfMonitor(ctx context.Context, interval time.Duration, samples int) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := l.CheckPublished(ctx, samples); err != nil && ctx.Err() == nil {
+			l.c.Log.ErrorContext(ctx, "self-monitor check failed", "err", err)
+		}
+	}
+}
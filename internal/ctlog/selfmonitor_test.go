@@ -0,0 +1,65 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSelfMonitor(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.MonitoringAPI = true
+	ts := httptest.NewServer(tl.Log.Handler())
+	t.Cleanup(ts.Close)
+	tl.Config.MonitoringURL = ts.URL + "/"
+	ctx := context.Background()
+
+	for i := 0; i < tileWidth+5; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	fatalIfErr(t, tl.Log.CheckPublished(ctx, 5))
+	oldCheckpoint, err := tl.Config.Backend.Fetch(ctx, "checkpoint")
+	fatalIfErr(t, err)
+
+	for i := 0; i < tileWidth; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	fatalIfErr(t, tl.Log.CheckPublished(ctx, 5))
+
+	b := tl.Config.Backend.(*MemoryBackend)
+	b.mu.Lock()
+	original := make(map[string][]byte)
+	for key, data := range b.m {
+		if strings.HasPrefix(key, "tile/8/data/") {
+			original[key] = data
+			corrupted := bytes.Clone(data)
+			corrupted[20] ^= 0xff // inside the first certificate
+			b.m[key] = corrupted
+		}
+	}
+	b.mu.Unlock()
+	if err := tl.Log.CheckPublished(ctx, 1); err == nil {
+		t.Errorf("CheckPublished succeeded with corrupted data tiles")
+	}
+
+	b.mu.Lock()
+	for key, data := range original {
+		b.m[key] = data
+	}
+	b.mu.Unlock()
+	fatalIfErr(t, tl.Log.CheckPublished(ctx, 1))
+
+	fatalIfErr(t, b.Upload(ctx, "checkpoint", oldCheckpoint, nil))
+	if err := tl.Log.CheckPublished(ctx, 1); err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Errorf("CheckPublished with rolled back checkpoint: got %v", err)
+	}
+
+	tl.Config.MonitoringURL = ts.URL + "/nope/"
+	if err := tl.Log.CheckPublished(ctx, 1); err == nil {
+		t.Errorf("CheckPublished succeeded with wrong MonitoringURL")
+	}
+}
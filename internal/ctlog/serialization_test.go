@@ -0,0 +1,46 @@
+package ctlog_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func benchmarkEntries() []*ctlog.SequencedLogEntry {
+	return []*ctlog.SequencedLogEntry{
+		{LogEntry: ctlog.LogEntry{Certificate: testLeaf}, LeafIndex: 123456789, Timestamp: 1700000000000},
+		{LogEntry: ctlog.LogEntry{
+			Certificate: testPrecert, IsPrecert: true, IssuerKeyHash: sha256.Sum256(testIntermediate),
+			PreCertificate: testPrecert, PrecertSigningCert: testIntermediate,
+		}, LeafIndex: 123456790, Timestamp: 1700000000001},
+	}
+}
+
+func BenchmarkTileLeaf(b *testing.B) {
+	entries := benchmarkEntries()
+	var tile []byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if i%256 == 0 {
+			tile = tile[:0]
+		}
+		tile = entries[i%len(entries)].AppendTileLeaf(tile)
+	}
+}
+
+func BenchmarkMerkleTreeLeaf(b *testing.B) {
+	entries := benchmarkEntries()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		entries[i%len(entries)].MerkleTreeLeaf()
+	}
+}
+
+func BenchmarkSignedEntry(b *testing.B) {
+	entries := benchmarkEntries()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		entries[i%len(entries)].SignedEntry()
+	}
+}
@@ -0,0 +1,32 @@
+package ctlog_test
+
+import (
+	"crypto"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+type failingSigner struct{ crypto.Signer }
+
+func (failingSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("access denied")
+}
+
+func TestCheckSigner(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	fatalIfErr(t, tl.Log.CheckSigner(0))
+
+	key := tl.Config.Key
+	tl.Config.Key = failingSigner{key}
+	if err := tl.Log.CheckSigner(0); err == nil {
+		t.Error("expected failing signer to fail the check")
+	}
+
+	tl.Config.Key = &batchSigner{Signer: key}
+	if err := tl.Log.CheckSigner(time.Nanosecond); err == nil {
+		t.Error("expected slow signer to fail the check")
+	}
+	fatalIfErr(t, tl.Log.CheckSigner(time.Minute))
+}
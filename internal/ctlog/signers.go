@@ -0,0 +1,120 @@
+package ctlog
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// remoteSignTimeout bounds each remote signing request, since crypto.Signer
+// doesn't take a context.
+const remoteSignTimeout = 5 * time.Second
+
+func newSignDurationMetric(name, help string) *prometheus.SummaryVec {
+	return prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       name,
+			Help:       help,
+			Objectives: map[float64]float64{0.5: 0.05, 0.75: 0.025, 0.9: 0.01, 0.99: 0.001},
+			MaxAge:     1 * time.Minute,
+			AgeBuckets: 6,
+		},
+		[]string{"error"},
+	)
+}
+
+// selfTestSigner produces and verifies a test signature, to fail at startup
+// rather than at the first sequencing if a remote key is disabled or the
+// signing permission is missing.
+func selfTestSigner(s crypto.Signer) error {
+	msg := sha256.Sum256([]byte("sunlight signer self-test"))
+	sig, err := s.Sign(rand.Reader, msg[:], crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("signer self-test failed: %w", err)
+	}
+	if !ecdsa.VerifyASN1(s.Public().(*ecdsa.PublicKey), msg[:], sig) {
+		return errors.New("signer self-test failed: signature doesn't verify")
+	}
+	return nil
+}
+
+// encodeECDSASignature converts a P-256 signature from the fixed-size r || s
+// encoding used by JWS and PKCS#11 to the ASN.1 encoding.
+func encodeECDSASignature(rs []byte) ([]byte, error) {
+	if len(rs) != 64 {
+		return nil, fmt.Errorf("invalid signature length %d", len(rs))
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(new(big.Int).SetBytes(rs[:32]))
+		b.AddASN1BigInt(new(big.Int).SetBytes(rs[32:]))
+	})
+	return b.Bytes()
+}
+
+// doJSON performs a request with a JSON body (if in is not nil), and decodes
+// a JSON response into out (if not nil). Non-200 responses are returned as an
+// *httpStatusError.
+func doJSON(ctx context.Context, client *http.Client, method, url string, header http.Header, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(b) > 200 {
+			b = b[:200]
+		}
+		return &httpStatusError{method: method, url: url, code: resp.StatusCode, body: b}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+type httpStatusError struct {
+	method, url string
+	code        int
+	body        []byte
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s: %q", e.method, e.url, e.code, http.StatusText(e.code), e.body)
+}
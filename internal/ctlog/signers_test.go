@@ -0,0 +1,36 @@
+package ctlog_test
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestCheckpointSigners(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	skey, vkey, err := note.GenerateKey(rand.Reader, "example.com/TestLog")
+	fatalIfErr(t, err)
+	signer, err := note.NewSigner(skey)
+	fatalIfErr(t, err)
+	verifier, err := note.NewVerifier(vkey)
+	fatalIfErr(t, err)
+	tl.Config.CheckpointSigners = []note.Signer{signer}
+
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	tl.CheckLog()
+
+	sth, err := tl.Config.Backend.Fetch(context.Background(), "checkpoint")
+	fatalIfErr(t, err)
+	n, err := note.Open(sth, note.VerifierList(verifier))
+	fatalIfErr(t, err)
+	if len(n.Sigs) != 1 || len(n.UnverifiedSigs) != 1 {
+		t.Errorf("got %d verified and %d unverified signatures, expected 1 and 1",
+			len(n.Sigs), len(n.UnverifiedSigs))
+	}
+
+	// The extra signature must not get in the way of reloading the log.
+	ReloadLog(t, tl)
+}
@@ -0,0 +1,162 @@
+package ctlog
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"time"
+)
+
+// BatchSigner is a crypto.Signer that can produce multiple signatures in a
+// single operation, amortizing the round-trip latency of remote signers.
+//
+// If Config.Key implements BatchSigner and Config.SigningWorkers is not zero,
+// concurrent SCT signature requests are batched.
+type BatchSigner interface {
+	crypto.Signer
+
+	// SignBatch signs each of the digests, like Sign with a nil rand.
+	SignBatch(digests [][]byte, opts crypto.SignerOpts) ([][]byte, error)
+}
+
+// maxSignBatch is the maximum number of SCTs signed with a single SignBatch.
+const maxSignBatch = 64
+
+var errSigningQueueFull = fmtErrorf("signing queue full")
+
+type signRequest struct {
+	msg  []byte
+	sig  []byte
+	err  error
+	done chan struct{}
+}
+
+// signSCT produces the digitally-signed signature of an SCT, either inline or,
+// if Config.SigningWorkers is not zero, through the bounded signing queue.
+func (l *Log) signSCT(ctx context.Context, msg []byte) ([]byte, error) {
+	if l.c.SigningWorkers == 0 {
+		start := time.Now()
+		defer func() { l.m.SignDuration.Observe(time.Since(start).Seconds()) }()
+		return digitallySign(l.c.Key, msg)
+	}
+	l.signOnce.Do(l.startSigningWorkers)
+
+	r := &signRequest{msg: msg, done: make(chan struct{})}
+	select {
+	case l.signQueue <- r:
+		l.m.SignQueueDepth.Inc()
+	default:
+		return nil, errSigningQueueFull
+	}
+	select {
+	case <-r.done:
+		return r.sig, r.err
+	case <-ctx.Done():
+		// The worker will still complete the request, and drop the result.
+		return nil, ctx.Err()
+	}
+}
+
+// startSigningWorkers starts the signing workers, which run for the lifetime
+// of the process.
+func (l *Log) startSigningWorkers() {
+	size := l.c.SigningQueueSize
+	if size == 0 {
+		size = l.c.SigningWorkers * maxSignBatch
+	}
+	l.signQueue = make(chan *signRequest, size)
+	for i := 0; i < l.c.SigningWorkers; i++ {
+		go l.signWorker()
+	}
+}
+
+func (l *Log) signWorker() {
+	_, canBatch := l.c.Key.(BatchSigner)
+	for r := range l.signQueue {
+		batch := []*signRequest{r}
+	drain:
+		for canBatch && len(batch) < maxSignBatch {
+			select {
+			case r := <-l.signQueue:
+				batch = append(batch, r)
+			default:
+				break drain
+			}
+		}
+		l.m.SignQueueDepth.Sub(float64(len(batch)))
+		l.m.SignBatchSize.Observe(float64(len(batch)))
+
+		start := time.Now()
+		l.signBatch(batch)
+		l.m.SignDuration.Observe(time.Since(start).Seconds())
+		for _, r := range batch {
+			close(r.done)
+		}
+	}
+}
+
+func (l *Log) signBatch(batch []*signRequest) {
+	bs, ok := l.c.Key.(BatchSigner)
+	if !ok || len(batch) == 1 {
+		for _, r := range batch {
+			r.sig, r.err = digitallySign(l.c.Key, r.msg)
+		}
+		return
+	}
+	digests := make([][]byte, 0, len(batch))
+	for _, r := range batch {
+		h := sha256.Sum256(r.msg)
+		digests = append(digests, h[:])
+	}
+	sigs, err := bs.SignBatch(digests, crypto.SHA256)
+	if err == nil && len(sigs) != len(batch) {
+		err = fmtErrorf("SignBatch returned %d signatures for %d digests", len(sigs), len(batch))
+	}
+	for i, r := range batch {
+		if err != nil {
+			r.err = err
+			continue
+		}
+		r.sig, r.err = encodeDigitallySigned(sigs[i])
+	}
+}
+
+// CheckSigner produces and verifies a test signature with Config.Key, and
+// records the outcome in the signer health metrics. It fails if the signature
+// can't be produced or doesn't verify, or if it took longer than maxLatency,
+// if not zero.
+func (l *Log) CheckSigner(maxLatency time.Duration) error {
+	start := time.Now()
+	err := selfTestSigner(l.c.Key)
+	elapsed := time.Since(start)
+	l.m.SignerCheckDuration.Set(elapsed.Seconds())
+	if err == nil && maxLatency > 0 && elapsed > maxLatency {
+		err = fmtErrorf("signer self-test took %v, more than %v", elapsed, maxLatency)
+	}
+	if err != nil {
+		l.m.SignerHealthy.Set(0)
+		l.m.SignerCheckFailures.Inc()
+		l.Alert(context.Background(), AlertSignerFailure, "signer health check failed", err)
+		return err
+	}
+	l.m.SignerHealthy.Set(1)
+	return nil
+}
+
+// RunSignerCheck calls CheckSigner every interval until ctx is canceled, so
+// that a revoked KMS grant or a disconnected HSM is detected and alerted on
+// before the next sequencing round fails.
+func (l *Log) RunSignerCheck(ctx context.Context, interval, maxLatency time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := l.CheckSigner(maxLatency); err != nil {
+			l.c.Log.ErrorContext(ctx, "signer health check failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
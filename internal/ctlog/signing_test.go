@@ -0,0 +1,71 @@
+package ctlog_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// batchSigner is a ctlog.BatchSigner that counts signatures, and simulates
+// the latency of a remote signer.
+type batchSigner struct {
+	crypto.Signer
+	batches, signatures atomic.Int64
+}
+
+func (s *batchSigner) SignBatch(digests [][]byte, opts crypto.SignerOpts) ([][]byte, error) {
+	s.batches.Add(1)
+	time.Sleep(time.Millisecond)
+	var sigs [][]byte
+	for _, d := range digests {
+		s.signatures.Add(1)
+		sig, err := s.Signer.Sign(rand.Reader, d, opts)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+func (s *batchSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.signatures.Add(1)
+	time.Sleep(time.Millisecond)
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestSigningWorkers(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	s := &batchSigner{Signer: tl.Config.Key}
+	tl.Config.Key = s
+	tl.Config.SigningWorkers = 2
+	lc := tl.LogClient()
+
+	const n = 50
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			// The client verifies the SCT signature.
+			_, err := lc.AddChain(context.Background(), []ct.ASN1Cert{
+				{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		fatalIfErr(t, <-errs)
+	}
+	tl.CheckLog()
+	// SCTs plus at least one checkpoint.
+	if got := s.signatures.Load(); got <= n {
+		t.Errorf("got %d signatures, expected more than %d", got, n)
+	}
+	if s.batches.Load() == 0 {
+		t.Error("no batches were signed")
+	}
+}
@@ -0,0 +1,141 @@
+package ctlog
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+)
+
+// DebugState is a snapshot of the internal state of a Log, for debugging.
+type DebugState struct {
+	Name string `json:"name"`
+
+	// TreeSize and TreeTime are the size and timestamp of the latest tree
+	// committed to the lock backend, and PublishedTime the timestamp of the
+	// latest checkpoint uploaded to object storage.
+	TreeSize      int64     `json:"tree_size"`
+	TreeTime      time.Time `json:"tree_time"`
+	PublishedTime time.Time `json:"published_time"`
+
+	// LockUpdated is when this instance last replaced the lock checkpoint, or
+	// loaded it at startup.
+	LockUpdated time.Time `json:"lock_updated"`
+
+	// EdgeTiles are the right-most tiles of each level.
+	EdgeTiles []string `json:"edge_tiles"`
+
+	// SequencingFailures is the number of consecutive failed sequencing
+	// rounds, and LastSequencingError the error of the latest one.
+	SequencingFailures  int    `json:"sequencing_failures"`
+	LastSequencingError string `json:"last_sequencing_error,omitempty"`
+
+	// PendingLeaves is the number of leaves waiting for the next sequencing
+	// round, and InSequencingLeaves the number in the current one.
+	PendingLeaves      int `json:"pending_leaves"`
+	InSequencingLeaves int `json:"in_sequencing_leaves"`
+
+	// InFlightUploads is the number of object storage uploads in progress.
+	InFlightUploads int64 `json:"in_flight_uploads"`
+
+	DedupCache struct {
+		// SizeBytes is the size of the cache database, including its WAL.
+		SizeBytes int64 `json:"size_bytes"`
+		// PoolHits, CacheHits, and Misses count the add-[pre-]chain
+		// submissions since startup deduplicated against the pending pools
+		// and the cache, or added to the pool.
+		PoolHits  int64 `json:"pool_hits"`
+		CacheHits int64 `json:"cache_hits"`
+		Misses    int64 `json:"misses"`
+	} `json:"dedup_cache"`
+
+	Maintenance string `json:"maintenance,omitempty"`
+	ClockSkew   string `json:"clock_skew,omitempty"`
+}
+
+// sequencerState is the part of DebugState owned by the sequencer, stored
+// at the end of each round.
+type sequencerState struct {
+	tree        treeWithTimestamp
+	publishedAt int64
+	lockUpdated time.Time
+	edgeTiles   []string
+	failures    int
+	lastErr     string
+}
+
+func (l *Log) storeSequencerState(err error) {
+	s := &sequencerState{
+		tree:        l.tree,
+		publishedAt: l.publishedAt,
+		lockUpdated: l.lockUpdated,
+		failures:    l.seqFailures,
+	}
+	if err != nil {
+		s.lastErr = err.Error()
+	}
+	for _, t := range l.edgeTiles {
+		s.edgeTiles = append(s.edgeTiles, t.Path())
+	}
+	sort.Strings(s.edgeTiles)
+	l.seqState.Store(s)
+}
+
+// DebugState returns a snapshot of the internal state of the log.
+func (l *Log) DebugState() *DebugState {
+	d := &DebugState{Name: l.c.Name}
+	if s := l.seqState.Load(); s != nil {
+		d.TreeSize = s.tree.N
+		d.TreeTime = time.UnixMilli(s.tree.Time).UTC()
+		d.PublishedTime = time.UnixMilli(s.publishedAt).UTC()
+		d.LockUpdated = s.lockUpdated.UTC()
+		d.EdgeTiles = s.edgeTiles
+		d.SequencingFailures = s.failures
+		d.LastSequencingError = s.lastErr
+	}
+
+	l.lockPools()
+	d.PendingLeaves = len(l.currentPool.pendingLeaves)
+	for i := range l.shards {
+		d.InSequencingLeaves += len(l.shards[i].inSequencing)
+	}
+	l.unlockPools()
+
+	d.InFlightUploads = l.uploads.Load()
+
+	for _, suffix := range []string{"", "-wal"} {
+		if fi, err := os.Stat(l.c.Cache + suffix); err == nil {
+			d.DedupCache.SizeBytes += fi.Size()
+		}
+	}
+	d.DedupCache.PoolHits = l.dedupStats.pool.Load()
+	d.DedupCache.CacheHits = l.dedupStats.cache.Load()
+	d.DedupCache.Misses = l.dedupStats.misses.Load()
+
+	if m := l.maintenance.Load(); m != nil {
+		d.Maintenance = *m
+	}
+	if s := l.clockSkew.Load(); s != nil {
+		d.ClockSkew = *s
+	}
+	return d
+}
+
+// upload calls Backend.Upload, tracking the number of uploads in flight.
+// Uploaded tiles are also added to the TileStore, if any.
+func (l *Log) upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	l.uploads.Add(1)
+	defer l.uploads.Add(-1)
+	if err := crash(crashPointUpload, key); err != nil {
+		return err
+	}
+	if err := l.c.Backend.Upload(ctx, key, data, opts); err != nil {
+		return err
+	}
+	if l.c.TileStore != nil {
+		if err := l.c.TileStore.Put(key, data); err != nil {
+			l.c.Log.WarnContext(ctx, "failed to add tile to the tile store", "key", key, "err", err)
+		}
+	}
+	return nil
+}
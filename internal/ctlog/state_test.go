@@ -0,0 +1,40 @@
+package ctlog_test
+
+import (
+	"context"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+func TestDebugState(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	for i := 0; i < 3; i++ {
+		addCertificate(t, tl)
+	}
+	if s := tl.Log.DebugState(); s.PendingLeaves != 3 || s.TreeSize != 0 {
+		t.Errorf("before sequencing: got %d pending leaves and tree size %d", s.PendingLeaves, s.TreeSize)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	s := tl.Log.DebugState()
+	if s.PendingLeaves != 0 || s.TreeSize != 3 || s.SequencingFailures != 0 {
+		t.Errorf("after sequencing: unexpected state %+v", s)
+	}
+	if len(s.EdgeTiles) == 0 || s.DedupCache.SizeBytes == 0 || s.InFlightUploads != 0 {
+		t.Errorf("after sequencing: unexpected state %+v", s)
+	}
+
+	client := tl.LogClient()
+	for i := 0; i < 2; i++ {
+		_, err := client.AddChain(context.Background(), []ct.ASN1Cert{
+			{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+		fatalIfErr(t, err)
+	}
+	// The duplicate is found in the cache or, if the previous pool hasn't
+	// been rotated out yet, in the pool.
+	s = tl.Log.DebugState()
+	if s.DedupCache.Misses != 1 || s.DedupCache.CacheHits+s.DedupCache.PoolHits != 1 {
+		t.Errorf("got %d dedup misses and %d hits, expected 1 and 1",
+			s.DedupCache.Misses, s.DedupCache.CacheHits+s.DedupCache.PoolHits)
+	}
+}
@@ -0,0 +1,41 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func TestSubscribe(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries := tl.Log.Subscribe(ctx)
+	var added []*ctlog.LogEntry
+	for i := 0; i < 3; i++ {
+		e := &ctlog.LogEntry{Certificate: []byte(fmt.Sprintf("certificate %d", i))}
+		tl.Log.AddLeafToPool(e)
+		added = append(added, e)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	for i, e := range added {
+		got := <-entries
+		if got.LeafIndex != int64(i+1) {
+			t.Errorf("got leaf index %d, expected %d", got.LeafIndex, i+1)
+		}
+		if !bytes.Equal(got.Certificate, e.Certificate) {
+			t.Errorf("got certificate %q, expected %q", got.Certificate, e.Certificate)
+		}
+	}
+
+	cancel()
+	if _, ok := <-entries; ok {
+		t.Error("channel not closed after cancel")
+	}
+}
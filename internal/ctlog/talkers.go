@@ -0,0 +1,133 @@
+package ctlog
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxIssuerLabels is the maximum number of distinct issuer label values that
+// are exposed in metrics. Issuers observed after the limit is reached are
+// reported as "other", to bound the cardinality of the per-issuer metrics.
+const maxIssuerLabels = 100
+
+// topIssuersCount is the number of issuers exposed by the top talkers metric.
+const topIssuersCount = 10
+
+// topIssuersWindow is the period over which top talkers are measured.
+const topIssuersWindow = 1 * time.Minute
+
+// issuerTracker bounds the cardinality of issuer labels, and keeps track of
+// the issuers responsible for the most submissions in the recent past.
+type issuerTracker struct {
+	mu    sync.Mutex
+	known map[string]bool
+
+	// current counts submissions since windowStart, and previous counts
+	// submissions in the window before that. Top talkers are computed over
+	// both, so that the metric doesn't drop to zero at every rotation.
+	current     map[string]uint64
+	previous    map[string]uint64
+	windowStart time.Time
+
+	// now is time.Now, except in tests.
+	now func() time.Time
+
+	desc *prometheus.Desc
+}
+
+func newIssuerTracker(now func() time.Time) *issuerTracker {
+	return &issuerTracker{
+		known:       make(map[string]bool),
+		current:     make(map[string]uint64),
+		previous:    make(map[string]uint64),
+		windowStart: now(),
+		now:         now,
+		desc: prometheus.NewDesc("addchain_top_issuers_requests",
+			"Number of add-[pre-]chain requests in the last one to two minutes, for the issuers with the most requests.",
+			[]string{"issuer"}, nil),
+	}
+}
+
+// label returns the metrics label value for issuer, which is issuer itself
+// unless too many distinct issuers were already observed.
+func (t *issuerTracker) label(issuer string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.known[issuer] {
+		return issuer
+	}
+	if len(t.known) >= maxIssuerLabels {
+		return "other"
+	}
+	t.known[issuer] = true
+	return issuer
+}
+
+// observe records a submission from issuer, which doesn't need to be bounded.
+func (t *issuerTracker) observe(issuer string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rotate()
+	t.current[issuer]++
+}
+
+func (t *issuerTracker) rotate() {
+	switch elapsed := t.now().Sub(t.windowStart); {
+	case elapsed >= 2*topIssuersWindow:
+		clear(t.previous)
+		clear(t.current)
+		t.windowStart = t.now()
+	case elapsed >= topIssuersWindow:
+		t.previous, t.current = t.current, t.previous
+		clear(t.current)
+		t.windowStart = t.windowStart.Add(topIssuersWindow)
+	}
+}
+
+type issuerCount struct {
+	Issuer string
+	Count  uint64
+}
+
+// top returns the issuers with the most submissions in the last one to two
+// windows, sorted by decreasing count.
+func (t *issuerTracker) top(n int) []issuerCount {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rotate()
+	counts := make(map[string]uint64, len(t.current)+len(t.previous))
+	for issuer, c := range t.previous {
+		counts[issuer] += c
+	}
+	for issuer, c := range t.current {
+		counts[issuer] += c
+	}
+	top := make([]issuerCount, 0, len(counts))
+	for issuer, c := range counts {
+		top = append(top, issuerCount{issuer, c})
+	}
+	slices.SortFunc(top, func(a, b issuerCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Issuer, b.Issuer)
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+func (t *issuerTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.desc
+}
+
+func (t *issuerTracker) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range t.top(topIssuersCount) {
+		ch <- prometheus.MustNewConstMetric(t.desc, prometheus.GaugeValue, float64(c.Count), c.Issuer)
+	}
+}
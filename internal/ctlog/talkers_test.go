@@ -0,0 +1,74 @@
+package ctlog_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestIssuerTracker(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tr := ctlog.NewIssuerTracker(func() time.Time { return now })
+
+	for i := range ctlog.MaxIssuerLabels {
+		issuer := fmt.Sprintf("CA %d", i)
+		if got := tr.Label(issuer); got != issuer {
+			t.Fatalf("got label %q for %q before the limit", got, issuer)
+		}
+	}
+	if got := tr.Label("CA new"); got != "other" {
+		t.Errorf("got label %q after the limit, expected \"other\"", got)
+	}
+	if got := tr.Label("CA 0"); got != "CA 0" {
+		t.Errorf("got label %q for a known issuer after the limit", got)
+	}
+
+	// Issuer i submits i+1 times. "CA tie" ties with the last of the top
+	// issuers, and loses the tie because ties are sorted by name.
+	for i := range ctlog.TopIssuersCount + 5 {
+		for range i + 1 {
+			tr.Observe(fmt.Sprintf("CA %02d", i))
+		}
+	}
+	for range 6 {
+		tr.Observe("CA tie")
+	}
+	var want []ctlog.IssuerCount
+	for i := ctlog.TopIssuersCount + 4; i >= 5; i-- {
+		want = append(want, ctlog.IssuerCount{Issuer: fmt.Sprintf("CA %02d", i), Count: uint64(i + 1)})
+	}
+	if top := tr.Top(ctlog.TopIssuersCount); !slices.Equal(top, want) {
+		t.Errorf("got top issuers %v, expected %v", top, want)
+	}
+	if top := tr.Top(100); len(top) != ctlog.TopIssuersCount+6 ||
+		top[ctlog.TopIssuersCount] != (ctlog.IssuerCount{Issuer: "CA tie", Count: 6}) {
+		t.Errorf("got all issuers %v", top)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(tr)
+	mfs, err := reg.Gather()
+	fatalIfErr(t, err)
+	if len(mfs) != 1 || len(mfs[0].GetMetric()) != ctlog.TopIssuersCount {
+		t.Errorf("got %v, expected %d top issuer gauges", mfs, ctlog.TopIssuersCount)
+	}
+
+	// The previous window still counts, then expires.
+	now = now.Add(ctlog.TopIssuersWindow)
+	tr.Observe("CA late")
+	if top := tr.Top(1); len(top) != 1 || top[0].Issuer != "CA 14" {
+		t.Errorf("got %v after one window, expected the previous window to count", top)
+	}
+	now = now.Add(ctlog.TopIssuersWindow)
+	if top := tr.Top(100); len(top) != 1 || top[0] != (ctlog.IssuerCount{Issuer: "CA late", Count: 1}) {
+		t.Errorf("got %v after two windows, expected only the last submission", top)
+	}
+	now = now.Add(2 * ctlog.TopIssuersWindow)
+	if top := tr.Top(100); len(top) != 0 {
+		t.Errorf("got %v after four windows, expected none", top)
+	}
+}
@@ -10,12 +10,15 @@ import (
 	"encoding/pem"
 	"fmt"
 	"io"
+	"iter"
 	"log/slog"
 	mathrand "math/rand"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -40,6 +43,10 @@ type TestLog struct {
 }
 
 func NewEmptyTestLog(t testing.TB) *TestLog {
+	return NewEmptyTestLogWithBackend(t, NewMemoryBackend(t))
+}
+
+func NewEmptyTestLogWithBackend(t testing.TB, backend ctlog.Backend) *TestLog {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	fatalIfErr(t, err)
 	k, err := x509.MarshalPKCS8PrivateKey(key)
@@ -50,7 +57,7 @@ func NewEmptyTestLog(t testing.TB) *TestLog {
 		Name:          "example.com/TestLog",
 		Key:           key,
 		Cache:         filepath.Join(t.TempDir(), "cache.db"),
-		Backend:       NewMemoryBackend(t),
+		Backend:       backend,
 		Lock:          NewMemoryLockBackend(t),
 		Log:           slog.New(logHandler),
 		Roots:         x509util.NewPEMCertPool(),
@@ -217,10 +224,15 @@ func (tl *TestLog) LogClient() *client.LogClient {
 
 func (tl *TestLog) StartSequencer() {
 	ctx, cancel := context.WithCancel(context.Background())
-	tl.t.Cleanup(cancel)
+	done := make(chan struct{})
+	// Wait for the sequencer to stop, so it doesn't log after the test ends.
+	tl.t.Cleanup(func() { cancel(); <-done })
 	go func() {
+		defer close(done)
 		err := tl.Log.RunSequencer(ctx, 50*time.Millisecond)
-		if err != context.Canceled {
+		// If the context is canceled in the middle of a round, the error
+		// might not be context.Canceled itself.
+		if ctx.Err() == nil {
 			tl.t.Errorf("RunSequencer returned an error: %v", err)
 		}
 	}()
@@ -321,13 +333,15 @@ type MemoryBackend struct {
 	t  testing.TB
 	mu sync.Mutex
 	m  map[string][]byte
+	// mtime is the upload time of each object, for List.
+	mtime map[string]time.Time
 
 	uploads uint64
 }
 
 func NewMemoryBackend(t testing.TB) *MemoryBackend {
 	return &MemoryBackend{
-		t: t, m: make(map[string][]byte),
+		t: t, m: make(map[string][]byte), mtime: make(map[string]time.Time),
 	}
 }
 
@@ -343,6 +357,7 @@ func (b *MemoryBackend) Upload(ctx context.Context, key string, data []byte, opt
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.m[key] = data
+	b.mtime[key] = time.Now()
 	return nil
 }
 
@@ -359,8 +374,187 @@ func (b *MemoryBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
 	return data, nil
 }
 
+func (b *MemoryBackend) List(ctx context.Context, prefix string) iter.Seq2[ctlog.ObjectInfo, error] {
+	return func(yield func(ctlog.ObjectInfo, error) bool) {
+		b.mu.Lock()
+		var objects []ctlog.ObjectInfo
+		for key, data := range b.m {
+			if strings.HasPrefix(key, prefix) {
+				objects = append(objects, ctlog.ObjectInfo{
+					Key: key, Size: int64(len(data)), LastModified: b.mtime[key]})
+			}
+		}
+		b.mu.Unlock()
+		slices.SortFunc(objects, func(a, b ctlog.ObjectInfo) int { return strings.Compare(a.Key, b.Key) })
+		for _, obj := range objects {
+			if !yield(obj, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (b *MemoryBackend) Delete(ctx context.Context, keys []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, key := range keys {
+		delete(b.m, key)
+		delete(b.mtime, key)
+	}
+	return nil
+}
+
 func (b *MemoryBackend) Metrics() []prometheus.Collector { return nil }
 
+// FaultyBackend wraps a Backend, and makes it behave like an inconsistent or
+// malicious object storage. Each fetch of a key selected by Keys is faulty
+// with the configured probabilities, using a deterministic random source.
+type FaultyBackend struct {
+	ctlog.Backend
+
+	// Stale is the probability that a fetch returns the previous version of
+	// the object, or not found if it was created by the latest upload, as if
+	// the writes became visible out of order.
+	Stale float64
+	// Corrupt is the probability that a fetch returns the object with a
+	// random bit flipped.
+	Corrupt float64
+	// Keys selects the keys that can be faulty. If nil, all keys are.
+	Keys func(key string) bool
+
+	mu     sync.Mutex
+	r      *mathrand.Rand
+	prev   map[string][]byte
+	faults int
+}
+
+func NewFaultyBackend(b ctlog.Backend, seed int64) *FaultyBackend {
+	return &FaultyBackend{Backend: b, r: mathrand.New(mathrand.NewSource(seed)),
+		prev: make(map[string][]byte)}
+}
+
+func (b *FaultyBackend) Upload(ctx context.Context, key string, data []byte, opts *ctlog.UploadOptions) error {
+	old, fetchErr := b.Backend.Fetch(ctx, key)
+	if err := b.Backend.Upload(ctx, key, data, opts); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if fetchErr != nil {
+		old = nil
+	}
+	b.prev[key] = old
+	return nil
+}
+
+func (b *FaultyBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	data, err := b.Backend.Fetch(ctx, key)
+	if err != nil || (b.Keys != nil && !b.Keys(key)) {
+		return data, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if prev, ok := b.prev[key]; ok && b.r.Float64() < b.Stale {
+		b.faults++
+		if prev == nil {
+			return nil, fmt.Errorf("key %q not found", key)
+		}
+		data = prev
+	}
+	if len(data) > 0 && b.r.Float64() < b.Corrupt {
+		b.faults++
+		data = bytes.Clone(data)
+		i := b.r.Intn(len(data) * 8)
+		data[i/8] ^= 1 << (i % 8)
+	}
+	return data, nil
+}
+
+// Faults returns the number of faulty fetches so far.
+func (b *FaultyBackend) Faults() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.faults
+}
+
+// RacyBackend wraps a Backend shared by concurrent sequencers. It delays every
+// call by a random jitter, so that their requests interleave, and tracks
+// whether an immutable object is ever replaced with different contents.
+//
+// If Conditional is set, it refuses to do so, like object storage with
+// conditional writes. Otherwise, the wrapped Backend is expected to refuse.
+type RacyBackend struct {
+	ctlog.Backend
+
+	Jitter      time.Duration
+	Conditional bool
+
+	mu         sync.Mutex
+	r          *mathrand.Rand
+	immutable  map[string][]byte // contents of the first upload
+	overwrites []string
+	refused    int
+}
+
+func NewRacyBackend(b ctlog.Backend, seed int64) *RacyBackend {
+	return &RacyBackend{Backend: b, Jitter: 2 * time.Millisecond,
+		r: mathrand.New(mathrand.NewSource(seed)), immutable: make(map[string][]byte)}
+}
+
+func (b *RacyBackend) sleep() {
+	b.mu.Lock()
+	d := time.Duration(b.r.Int63n(int64(b.Jitter) + 1))
+	b.mu.Unlock()
+	time.Sleep(d)
+}
+
+func (b *RacyBackend) Upload(ctx context.Context, key string, data []byte, opts *ctlog.UploadOptions) error {
+	b.sleep()
+	defer b.sleep()
+	if opts == nil || !opts.Immutable {
+		return b.Backend.Upload(ctx, key, data, opts)
+	}
+	if b.Conditional {
+		// The check and the upload must be atomic, like a conditional write.
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if old, ok := b.immutable[key]; ok && !bytes.Equal(old, data) {
+			b.refused++
+			return fmt.Errorf("key %q already exists", key)
+		}
+	}
+	err := b.Backend.Upload(ctx, key, data, opts)
+	if !b.Conditional {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+	}
+	old, ok := b.immutable[key]
+	switch {
+	case err != nil && ok && !bytes.Equal(old, data):
+		b.refused++
+	case err != nil:
+	case !ok:
+		b.immutable[key] = bytes.Clone(data)
+	case !bytes.Equal(old, data):
+		b.overwrites = append(b.overwrites, key)
+	}
+	return err
+}
+
+func (b *RacyBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	b.sleep()
+	defer b.sleep()
+	return b.Backend.Fetch(ctx, key)
+}
+
+// Overwrites returns the immutable objects that were replaced with different
+// contents, and how many times that was refused.
+func (b *RacyBackend) Overwrites() (overwritten []string, refused int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.overwrites), b.refused
+}
+
 type MemoryLockBackend struct {
 	t  testing.TB
 	mu sync.Mutex
@@ -0,0 +1,205 @@
+package ctlog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// TileStore keeps recently uploaded and served tiles in memory-mapped local
+// files, so that the monitoring API can serve them with a page cache read,
+// instead of a Backend fetch and, for data tiles, a decompression.
+//
+// The tiles are appended to one of two segments, each of half the store size.
+// When the active segment is full, the other one is dropped and reused, so
+// the store holds between half and all of its size of the most recent tiles.
+// The contents are not preserved across restarts.
+//
+// A TileStore can be shared by multiple logs, as long as their tile paths
+// are distinguished with a different prefix, but it's usually simpler to
+// give each log its own.
+type TileStore struct {
+	dir         string
+	segmentSize int
+
+	mu sync.RWMutex
+	// active is appended to, and previous is only read from.
+	active, previous *tileSegment
+	index            map[string]tileSpan
+	nextID           int
+}
+
+type tileSegment struct {
+	id   int
+	path string
+	f    *os.File
+	data []byte
+	used int
+}
+
+type tileSpan struct {
+	segment int
+	off, n  int
+}
+
+// MinTileStoreSize is the smallest size of a TileStore, which fits a couple
+// full data tiles of large certificates in each segment.
+const MinTileStoreSize = 4 << 20
+
+// OpenTileStore creates a TileStore of size bytes in the directory dir,
+// which is created if needed. Segment files left in dir by a previous run are
+// removed.
+func OpenTileStore(dir string, size int64) (*TileStore, error) {
+	if size < MinTileStoreSize {
+		return nil, fmtErrorf("tile store size %d is too small", size)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmtErrorf("couldn't create tile store directory: %w", err)
+	}
+	old, err := filepath.Glob(filepath.Join(dir, "segment-*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range old {
+		if err := os.Remove(path); err != nil {
+			return nil, fmtErrorf("couldn't remove old tile store segment: %w", err)
+		}
+	}
+	s := &TileStore{dir: dir, segmentSize: int(size / 2), index: make(map[string]tileSpan)}
+	if s.active, err = s.newSegment(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *TileStore) newSegment() (*tileSegment, error) {
+	seg := &tileSegment{id: s.nextID}
+	s.nextID++
+	seg.path = filepath.Join(s.dir, fmt.Sprintf("segment-%d", seg.id))
+	f, err := os.OpenFile(seg.path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmtErrorf("couldn't create tile store segment: %w", err)
+	}
+	data, err := mapSegment(f, s.segmentSize)
+	if err != nil {
+		f.Close()
+		os.Remove(seg.path)
+		return nil, fmtErrorf("couldn't map tile store segment: %w", err)
+	}
+	seg.f, seg.data = f, data
+	return seg, nil
+}
+
+func (seg *tileSegment) close() error {
+	err := unmapSegment(seg.data)
+	seg.data = nil
+	if cerr := seg.f.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := os.Remove(seg.path); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// Put stores the uncompressed contents of the tile at path key, replacing any
+// previous contents. Tiles larger than a segment are ignored.
+func (s *TileStore) Put(key string, data []byte) error {
+	if len(data) > s.segmentSize || !strings.HasPrefix(key, "tile/") {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return fmtErrorf("tile store is closed")
+	}
+	if s.active.used+len(data) > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	seg := s.active
+	copy(seg.data[seg.used:], data)
+	s.index[key] = tileSpan{segment: seg.id, off: seg.used, n: len(data)}
+	seg.used += len(data)
+	return nil
+}
+
+// rotate drops the previous segment, and replaces the active one.
+func (s *TileStore) rotate() error {
+	if prev := s.previous; prev != nil {
+		for key, span := range s.index {
+			if span.segment == prev.id {
+				delete(s.index, key)
+			}
+		}
+		s.previous = nil
+		if err := prev.close(); err != nil {
+			return fmtErrorf("couldn't remove tile store segment: %w", err)
+		}
+	}
+	seg, err := s.newSegment()
+	if err != nil {
+		return err
+	}
+	s.previous, s.active = s.active, seg
+	return nil
+}
+
+// Get returns a copy of the contents of the tile at path key, if stored.
+func (s *TileStore) Get(key string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	span, ok := s.index[key]
+	if !ok {
+		return nil, false
+	}
+	seg := s.active
+	if span.segment != seg.id {
+		seg = s.previous
+	}
+	// The segment might be unmapped by a later rotation, so the contents
+	// can't outlive the lock.
+	return append([]byte(nil), seg.data[span.off:span.off+span.n]...), true
+}
+
+// Close unmaps and removes the segments.
+func (s *TileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for _, seg := range []*tileSegment{s.active, s.previous} {
+		if seg != nil {
+			if cerr := seg.close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	s.active, s.previous, s.index = nil, nil, nil
+	return err
+}
+
+// fetchTile is fetchObject, but tiles are served from the TileStore, if any,
+// and added to it on a miss.
+func (l *Log) fetchTile(ctx context.Context, key string, immutable bool) (data []byte, eTag string, err error) {
+	ts := l.c.TileStore
+	if ts == nil || !strings.HasPrefix(key, "tile/") {
+		return l.fetchObject(ctx, key, immutable)
+	}
+	if data, ok := ts.Get(key); ok {
+		l.m.ObjectCacheRequests.WithLabelValues("tile_store", "hit").Inc()
+		return data, "", nil
+	}
+	l.m.ObjectCacheRequests.WithLabelValues("tile_store", "miss").Inc()
+	data, eTag, err = l.fetchObject(ctx, key, immutable)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ts.Put(key, data); err != nil {
+		l.c.Log.WarnContext(ctx, "failed to add tile to the tile store", "key", key, "err", err)
+	}
+	return data, eTag, nil
+}
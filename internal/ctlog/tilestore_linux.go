@@ -0,0 +1,21 @@
+package ctlog
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapSegment extends f to size bytes, and maps it into memory. Writes to the
+// mapping go to the page cache, which the kernel writes back to f in the
+// background.
+func mapSegment(f *os.File, size int) ([]byte, error) {
+	if err := f.Truncate(int64(size)); err != nil {
+		return nil, err
+	}
+	return unix.Mmap(int(f.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+}
+
+func unmapSegment(data []byte) error {
+	return unix.Munmap(data)
+}
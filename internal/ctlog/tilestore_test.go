@@ -0,0 +1,75 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func TestTileStore(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.MonitoringAPI = true
+	b := &conditionalBackend{MemoryBackend: tl.Config.Backend.(*MemoryBackend)}
+	tl.Config.Backend = b
+	ts, err := ctlog.OpenTileStore(t.TempDir(), ctlog.MinTileStoreSize)
+	fatalIfErr(t, err)
+	t.Cleanup(func() { ts.Close() })
+	tl.Config.TileStore = ts
+	for i := 0; i < tileWidth+5; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	h := tl.Log.Handler()
+
+	get := func(path string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: got status %d", path, rr.Code)
+		}
+		exp, err := b.Fetch(context.Background(), strings.TrimPrefix(path, "/"))
+		fatalIfErr(t, err)
+		if !bytes.Equal(rr.Body.Bytes(), exp) {
+			t.Errorf("GET %s: response differs from the backend", path)
+		}
+	}
+
+	// Uploaded tiles are served from the store.
+	for _, path := range []string{"/tile/8/0/000", "/tile/8/data/000", "/tile/8/data/001.p/5"} {
+		get(path)
+	}
+	if n := b.transfers.Load(); n != 0 {
+		t.Errorf("backend transferred %d uploaded tiles, expected 0", n)
+	}
+
+	// Other tiles are added to the store on the first fetch.
+	ts2, err := ctlog.OpenTileStore(t.TempDir(), ctlog.MinTileStoreSize)
+	fatalIfErr(t, err)
+	t.Cleanup(func() { ts2.Close() })
+	tl.Config.TileStore = ts2
+	get("/tile/8/data/000")
+	get("/tile/8/data/000")
+	if n := b.transfers.Load(); n != 1 {
+		t.Errorf("backend transferred the tile %d times, expected 1", n)
+	}
+
+	// Filling the active segment drops the previous one.
+	big := make([]byte, ctlog.MinTileStoreSize/2)
+	for _, key := range []string{"tile/a", "tile/b", "tile/c"} {
+		fatalIfErr(t, ts2.Put(key, big))
+	}
+	if _, ok := ts2.Get("tile/a"); ok {
+		t.Errorf("tile/a was not evicted")
+	}
+	for _, key := range []string{"tile/b", "tile/c"} {
+		if _, ok := ts2.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ctlog
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type traceIDContextKey struct{}
+
+// withTraceID stores the trace ID of the W3C Trace Context traceparent header
+// of each request, if any, in its context, to attach it to latency metrics as
+// an exemplar. The header is usually set by a tracing proxy or load balancer
+// in front of the log.
+func withTraceID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if id := parseTraceparent(r.Header.Get("traceparent")); id != "" {
+			r = r.WithContext(context.WithValue(r.Context(), traceIDContextKey{}, id))
+		}
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// parseTraceparent returns the trace ID of a version 00 traceparent header,
+// such as "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", or an
+// empty string if the header is missing or invalid.
+func parseTraceparent(h string) string {
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 ||
+		len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ""
+	}
+	for _, p := range parts[1:] {
+		for _, c := range p {
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+				return ""
+			}
+		}
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return ""
+	}
+	return parts[1]
+}
+
+func traceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDContextKey{}).(string)
+	return id
+}
+
+// traceExemplar returns the exemplar labels for the trace of ctx, or nil if
+// there is none. It's suitable for promhttp.WithExemplarFromContext.
+func (l *Log) traceExemplar(ctx context.Context) prometheus.Labels {
+	return l.exemplar(traceID(ctx))
+}
+
+func (l *Log) exemplar(traceID string) prometheus.Labels {
+	// Summaries don't support exemplars.
+	if traceID == "" || !l.c.TraceExemplars || l.c.LatencyMetrics == LatencySummaries {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": traceID}
+}
+
+// observe records v on o, with the trace ID as an exemplar if enabled.
+func (l *Log) observe(o prometheus.Observer, v float64, traceID string) {
+	if e := l.exemplar(traceID); e != nil {
+		if eo, ok := o.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(v, e)
+			return
+		}
+	}
+	o.Observe(v)
+}
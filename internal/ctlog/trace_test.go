@@ -0,0 +1,66 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTraceExemplars(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.LatencyMetrics = ctlog.LatencyHistograms
+	tl.Config.TraceExemplars = true
+	tl = ReloadLog(t, tl)
+	tl.StartSequencer()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+	req := httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, expected 200: %s", rr.Code, rr.Body)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(tl.Log.Metrics()...)
+	hasExemplar := func(name string) bool {
+		mfs, err := reg.Gather()
+		fatalIfErr(t, err)
+		for _, mf := range mfs {
+			if mf.GetName() != name {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, b := range m.GetHistogram().GetBucket() {
+					for _, l := range b.GetExemplar().GetLabel() {
+						if l.GetName() == "trace_id" && l.GetValue() == traceID {
+							return true
+						}
+					}
+				}
+			}
+		}
+		return false
+	}
+	for _, name := range []string{"http_request_duration_seconds", "addchain_duration_seconds"} {
+		if !hasExemplar(name) {
+			t.Errorf("%s has no exemplar with the trace ID", name)
+		}
+	}
+	// The sequencing round is observed after the request is unblocked.
+	for i := 0; !hasExemplar("sequencing_duration_seconds"); i++ {
+		if i > 100 {
+			t.Fatal("sequencing_duration_seconds has no exemplar with the trace ID")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,35 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+func TestSubmitMaxValidity(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	body, err := json.Marshal(map[string][][]byte{"chain": {testLeaf, testIntermediate, testRoot}})
+	fatalIfErr(t, err)
+	// testLeaf is valid for 90 days.
+	tl.Config.MaxValidity = 89 * 24 * time.Hour
+	rr := httptest.NewRecorder()
+	tl.Log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/ct/v1/add-chain", bytes.NewReader(body)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, expected 400", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "validity period too long") {
+		t.Errorf("got error %q, expected validity period too long", rr.Body.String())
+	}
+
+	tl.Config.MaxValidity = 90 * 24 * time.Hour
+	_, err = tl.LogClient().AddChain(context.Background(), []ct.ASN1Cert{
+		{Data: testLeaf}, {Data: testIntermediate}, {Data: testRoot}})
+	fatalIfErr(t, err)
+}
@@ -0,0 +1,321 @@
+package ctlog
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// VaultConfig identifies a key in a HashiCorp Vault transit secrets engine,
+// and how to authenticate to Vault.
+type VaultConfig struct {
+	// Address is the Vault server URL, such as https://vault.example.com:8200.
+	Address string
+
+	// Namespace is the Vault Enterprise namespace. Optional.
+	Namespace string
+
+	// Mount is the path of the transit engine. If empty, "transit" is used.
+	Mount string
+
+	// Key is the name of the transit key, which must be of type ecdsa-p256.
+	Key string
+
+	// KeyVersion is the key version to sign with. If zero, the latest version
+	// at startup is used, and kept even if the key is rotated later.
+	KeyVersion int
+
+	// Token is a Vault token. It's renewed as needed if renewable.
+	// Exactly one of Token and AppRoleID must be set.
+	Token string
+
+	// AppRoleID and AppRoleSecretID are used to log in with the AppRole auth
+	// method, which is mounted at AppRoleMount or, if empty, at "approle".
+	// The login is repeated whenever the token can't be renewed.
+	AppRoleID       string
+	AppRoleSecretID string
+	AppRoleMount    string
+}
+
+// VaultSigner is a [crypto.Signer] backed by an ecdsa-p256 key in a
+// HashiCorp Vault transit engine, so that the log private key never leaves
+// Vault and every use is recorded in the Vault audit log.
+//
+// Like [KMSSigner], its signatures are not deterministic.
+type VaultSigner struct {
+	c       VaultConfig
+	version int
+	pub     *ecdsa.PublicKey
+	client  *http.Client
+
+	// mu protects the token state.
+	mu        sync.Mutex
+	token     string
+	renewable bool
+	issued    time.Time
+	ttl       time.Duration // zero if the token doesn't expire
+
+	duration *prometheus.SummaryVec
+	logins   *prometheus.CounterVec
+	log      *slog.Logger
+}
+
+// NewVaultSigner authenticates to Vault, fetches the public key of the transit
+// key, and checks that it can be used to sign by producing and verifying a
+// test signature.
+func NewVaultSigner(ctx context.Context, c VaultConfig, l *slog.Logger) (*VaultSigner, error) {
+	if (c.Token == "") == (c.AppRoleID == "") {
+		return nil, errors.New("exactly one of Vault token and AppRole must be configured")
+	}
+	if c.Mount == "" {
+		c.Mount = "transit"
+	}
+	if c.AppRoleMount == "" {
+		c.AppRoleMount = "approle"
+	}
+	c.Address = strings.TrimSuffix(c.Address, "/")
+	s := &VaultSigner{
+		c:      c,
+		client: &http.Client{Timeout: remoteSignTimeout},
+		duration: newSignDurationMetric("vault_sign_duration_seconds",
+			"Vault transit sign request latencies, by error."),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "vault_logins_total",
+			Help: "Vault token acquisitions and renewals, by method and error.",
+		}, []string{"method", "error"}),
+		log: l,
+	}
+
+	if c.Token != "" {
+		var out struct {
+			Data struct {
+				TTL       int64 `json:"ttl"`
+				Renewable bool  `json:"renewable"`
+			} `json:"data"`
+		}
+		s.token = c.Token
+		if err := s.do(ctx, "GET", "auth/token/lookup-self", nil, &out); err != nil {
+			return nil, fmt.Errorf("failed to look up Vault token: %w", err)
+		}
+		s.issued = time.Now()
+		s.ttl = time.Duration(out.Data.TTL) * time.Second
+		s.renewable = out.Data.Renewable
+	} else if err := s.login(ctx); err != nil {
+		return nil, err
+	}
+
+	var key struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := s.do(ctx, "GET", c.Mount+"/keys/"+c.Key, nil, &key); err != nil {
+		return nil, fmt.Errorf("failed to fetch Vault transit key: %w", err)
+	}
+	if key.Data.Type != "ecdsa-p256" {
+		return nil, fmt.Errorf("Vault transit key type is %q, not ecdsa-p256", key.Data.Type)
+	}
+	s.version = c.KeyVersion
+	if s.version == 0 {
+		s.version = key.Data.LatestVersion
+	}
+	block, _ := pem.Decode([]byte(key.Data.Keys[strconv.Itoa(s.version)].PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("Vault transit key version %d not found", s.version)
+	}
+	k, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Vault public key: %w", err)
+	}
+	pub, ok := k.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return nil, errors.New("Vault public key is not an ECDSA P-256 key")
+	}
+	s.pub = pub
+
+	if err := selfTestSigner(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// login obtains a new token with AppRole. s.mu must be held, or s must not be
+// shared yet.
+func (s *VaultSigner) login(ctx context.Context) (err error) {
+	defer func() { s.logins.WithLabelValues("approle", fmt.Sprint(err != nil)).Inc() }()
+	var out struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+			Renewable     bool   `json:"renewable"`
+		} `json:"auth"`
+	}
+	in := map[string]string{"role_id": s.c.AppRoleID, "secret_id": s.c.AppRoleSecretID}
+	err = doJSON(ctx, s.client, "POST", s.c.Address+"/v1/auth/"+s.c.AppRoleMount+"/login",
+		s.header(""), in, &out)
+	if err != nil {
+		return fmt.Errorf("failed to log into Vault with AppRole: %w", err)
+	}
+	s.token = out.Auth.ClientToken
+	s.issued = time.Now()
+	s.ttl = time.Duration(out.Auth.LeaseDuration) * time.Second
+	s.renewable = out.Auth.Renewable
+	return nil
+}
+
+// renew extends the token lease. s.mu must be held.
+func (s *VaultSigner) renew(ctx context.Context) (err error) {
+	defer func() { s.logins.WithLabelValues("renew", fmt.Sprint(err != nil)).Inc() }()
+	var out struct {
+		Auth struct {
+			LeaseDuration int64 `json:"lease_duration"`
+			Renewable     bool  `json:"renewable"`
+		} `json:"auth"`
+	}
+	err = doJSON(ctx, s.client, "POST", s.c.Address+"/v1/auth/token/renew-self",
+		s.header(s.token), struct{}{}, &out)
+	if err != nil {
+		return fmt.Errorf("failed to renew Vault token: %w", err)
+	}
+	s.issued = time.Now()
+	s.ttl = time.Duration(out.Auth.LeaseDuration) * time.Second
+	s.renewable = out.Auth.Renewable
+	return nil
+}
+
+// currentToken returns a token, renewing it or logging in again once more than
+// half of its TTL has elapsed.
+func (s *VaultSigner) currentToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ttl == 0 || time.Since(s.issued) < s.ttl/2 {
+		return s.token, nil
+	}
+	if s.renewable {
+		err := s.renew(ctx)
+		if err == nil {
+			return s.token, nil
+		}
+		if s.c.AppRoleID == "" {
+			return "", err
+		}
+		s.log.Warn("Vault token renewal failed, logging in again", "err", err)
+	} else if s.c.AppRoleID == "" {
+		if time.Since(s.issued) < s.ttl {
+			return s.token, nil
+		}
+		return "", errors.New("Vault token expired and is not renewable")
+	}
+	if err := s.login(ctx); err != nil {
+		return "", err
+	}
+	return s.token, nil
+}
+
+// forceLogin logs in again after the token was rejected, unless another
+// goroutine already replaced the token.
+func (s *VaultSigner) forceLogin(ctx context.Context, rejected string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != rejected {
+		return nil
+	}
+	return s.login(ctx)
+}
+
+func (s *VaultSigner) header(token string) http.Header {
+	h := http.Header{}
+	if token != "" {
+		h.Set("X-Vault-Token", token)
+	}
+	if s.c.Namespace != "" {
+		h.Set("X-Vault-Namespace", s.c.Namespace)
+	}
+	return h
+}
+
+// do performs an authenticated request to the Vault API. If the token is
+// rejected and AppRole is configured, it logs in again and retries once.
+func (s *VaultSigner) do(ctx context.Context, method, path string, in, out any) error {
+	token, err := s.currentToken(ctx)
+	if err != nil {
+		return err
+	}
+	url := s.c.Address + "/v1/" + path
+	err = doJSON(ctx, s.client, method, url, s.header(token), in, out)
+	var httpErr *httpStatusError
+	if errors.As(err, &httpErr) && httpErr.code == http.StatusForbidden && s.c.AppRoleID != "" {
+		if err := s.forceLogin(ctx, token); err != nil {
+			return err
+		}
+		if token, err = s.currentToken(ctx); err != nil {
+			return err
+		}
+		err = doJSON(ctx, s.client, method, url, s.header(token), in, out)
+	}
+	return err
+}
+
+var _ crypto.Signer = &VaultSigner{}
+
+func (s *VaultSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest, which must be a SHA-256 hash, with the transit key. rand
+// is ignored.
+func (s *VaultSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("unsupported hash function %v", opts.HashFunc())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteSignTimeout)
+	defer cancel()
+	in := map[string]any{
+		"input":                base64.StdEncoding.EncodeToString(digest),
+		"prehashed":            true,
+		"key_version":          s.version,
+		"marshaling_algorithm": "asn1",
+	}
+	var out struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	start := time.Now()
+	err := s.do(ctx, "POST", s.c.Mount+"/sign/"+s.c.Key+"/sha2-256", in, &out)
+	s.duration.WithLabelValues(fmt.Sprint(err != nil)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.log.Warn("Vault sign failed", "err", err)
+		return nil, fmt.Errorf("Vault sign failed: %w", err)
+	}
+
+	// The signature is encoded as "vault:v<version>:<base64>".
+	prefix := "vault:v" + strconv.Itoa(s.version) + ":"
+	if !strings.HasPrefix(out.Data.Signature, prefix) {
+		return nil, fmt.Errorf("unexpected Vault signature format %q", out.Data.Signature)
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimPrefix(out.Data.Signature, prefix))
+}
+
+func (s *VaultSigner) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{s.duration, s.logins}
+}
@@ -0,0 +1,106 @@
+package ctlog_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"filippo.io/sunlight/internal/ctlog"
+)
+
+func TestVaultSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fatalIfErr(t, err)
+	spki, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	fatalIfErr(t, err)
+	var logins, token atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/auth/approle/login", func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			RoleID   string `json:"role_id"`
+			SecretID string `json:"secret_id"`
+		}
+		fatalIfErr(t, json.NewDecoder(r.Body).Decode(&in))
+		if in.RoleID != "role" || in.SecretID != "secret" {
+			http.Error(w, "bad credentials", http.StatusBadRequest)
+			return
+		}
+		logins.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"auth": map[string]any{
+			"client_token": fmt.Sprint(token.Add(1)), "lease_duration": 3600, "renewable": true}})
+	})
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("X-Vault-Token") != fmt.Sprint(token.Load()) {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("GET /v1/transit/keys/log", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"type": "ecdsa-p256", "latest_version": 2, "keys": map[string]any{
+				"2": map[string]any{"public_key": string(pem.EncodeToMemory(
+					&pem.Block{Type: "PUBLIC KEY", Bytes: spki}))}}}})
+	})
+	mux.HandleFunc("POST /v1/transit/sign/log/sha2-256", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		var in struct {
+			Input      []byte `json:"input"`
+			Prehashed  bool   `json:"prehashed"`
+			KeyVersion int    `json:"key_version"`
+		}
+		fatalIfErr(t, json.NewDecoder(r.Body).Decode(&in))
+		if !in.Prehashed || in.KeyVersion != 2 {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		sig, err := ecdsa.SignASN1(rand.Reader, key, in.Input)
+		fatalIfErr(t, err)
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"signature": "vault:v2:" + base64.StdEncoding.EncodeToString(sig)}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	s, err := ctlog.NewVaultSigner(context.Background(), ctlog.VaultConfig{
+		Address:         srv.URL,
+		Key:             "log",
+		AppRoleID:       "role",
+		AppRoleSecretID: "secret",
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	fatalIfErr(t, err)
+	if !key.PublicKey.Equal(s.Public()) {
+		t.Fatal("unexpected public key")
+	}
+
+	// Revoke the token behind the signer's back.
+	token.Add(1)
+	h := sha256.Sum256([]byte("hello"))
+	sig, err := s.Sign(rand.Reader, h[:], crypto.SHA256)
+	fatalIfErr(t, err)
+	if !ecdsa.VerifyASN1(&key.PublicKey, h[:], sig) {
+		t.Error("signature doesn't verify")
+	}
+	if n := logins.Load(); n != 2 {
+		t.Errorf("got %d logins, expected 2", n)
+	}
+}
@@ -0,0 +1,195 @@
+package ctlog_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/internal/ctlog"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509util"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var updateVectors = flag.Bool("update-vectors", false, "rewrite the golden vectors in testdata/vectors")
+
+// vectorEntry is an entry of testdata/vectors/entries.json.
+type vectorEntry struct {
+	LeafIndex          int64  `json:"leaf_index"`
+	Timestamp          int64  `json:"timestamp"`
+	Certificate        []byte `json:"certificate"`
+	IsPrecert          bool   `json:"is_precert"`
+	IssuerKeyHash      []byte `json:"issuer_key_hash,omitempty"`
+	PreCertificate     []byte `json:"pre_certificate,omitempty"`
+	PrecertSigningCert []byte `json:"precert_signing_certificate,omitempty"`
+	MerkleTreeLeaf     []byte `json:"merkle_tree_leaf"`
+	TileLeaf           []byte `json:"tile_leaf"`
+	LeafHash           []byte `json:"leaf_hash"`
+}
+
+// TestGoldenVectors builds a log from a fixed key, clock, and set of entries,
+// and checks the encoded entries and every object in the backend against the
+// vectors in testdata/vectors, byte for byte. Run with -update-vectors to
+// regenerate them after an intentional format change.
+func TestGoldenVectors(t *testing.T) {
+	const dir = "testdata/vectors"
+	keyPEM, err := os.ReadFile(dir + "/key.pem")
+	fatalIfErr(t, err)
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		t.Fatal("invalid key.pem")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	fatalIfErr(t, err)
+
+	// The log is created at 2024-01-01T00:00:00Z, and each round is sequenced
+	// one second later than the previous one.
+	var now atomic.Int64
+	now.Store(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC).UnixMilli())
+	backend := NewMemoryBackend(t)
+	logHandler, logLevel := testLogHandler(t)
+	config := &ctlog.Config{
+		Name:          "example.com/TestLog",
+		Key:           k.(*ecdsa.PrivateKey),
+		Cache:         t.TempDir() + "/cache.db",
+		Backend:       backend,
+		Lock:          NewMemoryLockBackend(t),
+		Log:           slog.New(logHandler),
+		Roots:         x509util.NewPEMCertPool(),
+		NotAfterStart: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfterLimit: time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC),
+		Clock:         clockFunc(now.Load),
+	}
+	fatalIfErr(t, ctlog.CreateLog(context.Background(), config))
+	log, err := ctlog.LoadLog(context.Background(), config)
+	fatalIfErr(t, err)
+	t.Cleanup(func() { fatalIfErr(t, log.CloseCache()) })
+	tl := &TestLog{t: t, Log: log, Config: config, l: logLevel}
+
+	precert, err := ctx509.ParseCertificate(testPrecert)
+	fatalIfErr(t, err)
+	tbs, err := ctx509.RemoveCTPoison(precert.RawTBSCertificate)
+	fatalIfErr(t, err)
+	intermediate, err := ctx509.ParseCertificate(testIntermediate)
+	fatalIfErr(t, err)
+	synthetic := func(i int) []byte {
+		h := sha256.Sum256(fmt.Appendf(nil, "sunlight test vector %d", i))
+		return h[:]
+	}
+
+	// The first round has a real certificate and precertificate, the second
+	// fills the first data tile and spills into the next, and the last one
+	// grows the partial tiles.
+	var rounds [][]*ctlog.LogEntry
+	rounds = append(rounds, []*ctlog.LogEntry{
+		{Certificate: testLeaf},
+		{Certificate: tbs, IsPrecert: true, PreCertificate: testPrecert,
+			IssuerKeyHash: sha256.Sum256(intermediate.RawSubjectPublicKeyInfo)},
+	})
+	var round []*ctlog.LogEntry
+	for i := range tileWidth - 1 {
+		round = append(round, &ctlog.LogEntry{Certificate: synthetic(i)})
+	}
+	rounds = append(rounds, round)
+	rounds = append(rounds, []*ctlog.LogEntry{
+		{Certificate: synthetic(tileWidth)},
+		{Certificate: synthetic(tileWidth + 1), IsPrecert: true,
+			PreCertificate:     synthetic(tileWidth + 2),
+			IssuerKeyHash:      sha256.Sum256(synthetic(tileWidth + 3)),
+			PrecertSigningCert: synthetic(tileWidth + 4)},
+		{Certificate: synthetic(tileWidth + 5)},
+	})
+
+	var entries []vectorEntry
+	for _, round := range rounds {
+		var waits []func(context.Context) (*ctlog.SequencedLogEntry, error)
+		for _, e := range round {
+			f, _ := tl.Log.AddLeafToPool(e)
+			waits = append(waits, f)
+		}
+		now.Add(1000)
+		fatalIfErr(t, tl.Log.Sequence())
+		for _, wait := range waits {
+			e, err := wait(context.Background())
+			fatalIfErr(t, err)
+			leafHash := tlog.RecordHash(e.MerkleTreeLeaf())
+			v := vectorEntry{
+				LeafIndex:          e.LeafIndex,
+				Timestamp:          e.Timestamp,
+				Certificate:        e.Certificate,
+				IsPrecert:          e.IsPrecert,
+				PreCertificate:     e.PreCertificate,
+				PrecertSigningCert: e.PrecertSigningCert,
+				MerkleTreeLeaf:     e.MerkleTreeLeaf(),
+				TileLeaf:           e.TileLeaf(),
+				LeafHash:           leafHash[:],
+			}
+			if e.IsPrecert {
+				v.IssuerKeyHash = e.IssuerKeyHash[:]
+			}
+			entries = append(entries, v)
+		}
+	}
+	tl.CheckLog()
+
+	got := make(map[string][]byte)
+	for obj, err := range backend.List(context.Background(), "") {
+		fatalIfErr(t, err)
+		got[obj.Key], err = backend.Fetch(context.Background(), obj.Key)
+		fatalIfErr(t, err)
+	}
+	got["entries.json"], err = json.MarshalIndent(entries, "", "\t")
+	fatalIfErr(t, err)
+
+	if *updateVectors {
+		fatalIfErr(t, os.RemoveAll(dir+"/log"))
+		for key, data := range got {
+			path := dir + "/log/" + key
+			if key == "entries.json" {
+				path = dir + "/entries.json"
+			}
+			fatalIfErr(t, os.MkdirAll(path[:strings.LastIndex(path, "/")], 0o755))
+			fatalIfErr(t, os.WriteFile(path, data, 0o644))
+		}
+		return
+	}
+
+	want := make(map[string][]byte)
+	want["entries.json"], err = os.ReadFile(dir + "/entries.json")
+	fatalIfErr(t, err)
+	logDir := os.DirFS(dir + "/log")
+	fatalIfErr(t, fs.WalkDir(logDir, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		want[path], err = fs.ReadFile(logDir, path)
+		return err
+	}))
+	for _, key := range slices.Sorted(maps.Keys(want)) {
+		if g, ok := got[key]; !ok {
+			t.Errorf("%s is missing from the log", key)
+		} else if !bytes.Equal(g, want[key]) {
+			t.Errorf("%s doesn't match the vector", key)
+		}
+	}
+	for key := range got {
+		if _, ok := want[key]; !ok {
+			t.Errorf("%s is not in the vectors", key)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package ctlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"filippo.io/sunlight"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// maxWitnessRequestSize is the maximum size of an add-checkpoint request body.
+const maxWitnessRequestSize = 1 << 16
+
+// WitnessConfig is the configuration of a [Witness].
+type WitnessConfig struct {
+	// Signer produces the cosignatures, usually with the Ed25519 witness key
+	// generated by sunlight keygen.
+	Signer note.Signer
+
+	// Logs are the logs whose checkpoints are witnessed.
+	Logs []WitnessedLog
+
+	// Lock stores the latest cosigned checkpoint of each log, keyed by
+	// [WitnessLockID] of its origin. It can be shared with the logs, since
+	// their keys are hashes of a different form.
+	Lock LockBackend
+
+	Log *slog.Logger
+}
+
+// A WitnessedLog is an external log whose checkpoints a [Witness] cosigns.
+type WitnessedLog struct {
+	// Origin is the checkpoint origin line of the log.
+	Origin string
+
+	// Verifier verifies the log signature on its checkpoints. For CT logs,
+	// it's a [sunlight.NewRFC6962Verifier].
+	Verifier note.Verifier
+}
+
+// A Witness implements the c2sp.org/tlog-witness protocol: it cosigns
+// checkpoints of a set of logs, after verifying that each is consistent with
+// the previous one it cosigned for the same log, so that clients that require
+// its cosignature can't be shown a split view of the log.
+type Witness struct {
+	c    *WitnessConfig
+	logs map[string]*witnessedLog
+}
+
+type witnessedLog struct {
+	v  note.Verifier
+	id [sha256.Size]byte
+
+	// mu serializes the add-checkpoint requests for the log, and protects
+	// the fields below, which are the latest state stored in the lock backend.
+	mu     sync.Mutex
+	loaded bool
+	locked LockedCheckpoint // nil if none was stored yet
+	tree   tlog.Tree
+}
+
+// WitnessLockID returns the key of the lock backend entry of the witnessed
+// log with the given origin.
+func WitnessLockID(origin string) [sha256.Size]byte {
+	return sha256.Sum256([]byte("c2sp.org/tlog-witness\n" + origin))
+}
+
+// NewWitness returns a new Witness for the logs in config. The state of each
+// log is loaded from the lock backend when its first checkpoint is submitted.
+func NewWitness(config *WitnessConfig) (*Witness, error) {
+	if config.Signer == nil {
+		return nil, fmtErrorf("witness signer is required")
+	}
+	w := &Witness{c: config, logs: make(map[string]*witnessedLog)}
+	for _, l := range config.Logs {
+		if l.Origin == "" || l.Verifier == nil {
+			return nil, fmtErrorf("witnessed log origin and verifier are required")
+		}
+		if _, ok := w.logs[l.Origin]; ok {
+			return nil, fmtErrorf("duplicate witnessed log %q", l.Origin)
+		}
+		w.logs[l.Origin] = &witnessedLog{v: l.Verifier, id: WitnessLockID(l.Origin)}
+	}
+	return w, nil
+}
+
+// Handler returns an http.Handler serving the add-checkpoint endpoint.
+func (w *Witness) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /add-checkpoint", w.addCheckpoint)
+	return mux
+}
+
+// A witnessError is an add-checkpoint failure with its HTTP status code.
+type witnessError struct {
+	code int
+	err  error
+}
+
+func (e *witnessError) Error() string { return e.err.Error() }
+func (e *witnessError) Unwrap() error { return e.err }
+
+// A witnessConflictError is returned by [Witness.AddCheckpoint] if the old
+// size of the request doesn't match the latest cosigned checkpoint.
+type witnessConflictError struct {
+	size int64
+}
+
+func (e *witnessConflictError) Error() string {
+	return fmt.Sprintf("old size doesn't match latest cosigned checkpoint of size %d", e.size)
+}
+
+func (w *Witness) addCheckpoint(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxWitnessRequestSize))
+	if err != nil {
+		http.Error(rw, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	oldSize, proof, signed, err := parseAddCheckpoint(body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sigs, err := w.AddCheckpoint(r.Context(), oldSize, proof, signed)
+	if conflict := (*witnessConflictError)(nil); errors.As(err, &conflict) {
+		rw.Header().Set("Content-Type", "text/x.tlog.size")
+		rw.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(rw, "%d\n", conflict.size)
+		return
+	}
+	if werr := (*witnessError)(nil); errors.As(err, &werr) {
+		http.Error(rw, werr.Error(), werr.code)
+		return
+	}
+	if err != nil {
+		w.c.Log.ErrorContext(r.Context(), "failed to witness checkpoint", "err", err)
+		http.Error(rw, "internal error", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Write(sigs)
+}
+
+// parseAddCheckpoint parses an add-checkpoint request body: the old size
+// line, the consistency proof lines, an empty line, and the signed checkpoint.
+func parseAddCheckpoint(body []byte) (oldSize int64, proof tlog.TreeProof, signed []byte, err error) {
+	line, rest, ok := bytes.Cut(body, []byte("\n"))
+	size, found := strings.CutPrefix(string(line), "old ")
+	if !ok || !found {
+		return 0, nil, nil, errors.New("malformed old size line")
+	}
+	oldSize, err = strconv.ParseInt(size, 10, 64)
+	if err != nil || oldSize < 0 || strconv.FormatInt(oldSize, 10) != size {
+		return 0, nil, nil, errors.New("malformed old size line")
+	}
+	for {
+		line, rest, ok = bytes.Cut(rest, []byte("\n"))
+		if !ok {
+			return 0, nil, nil, errors.New("missing checkpoint")
+		}
+		if len(line) == 0 {
+			break
+		}
+		if len(proof) >= 63 {
+			return 0, nil, nil, errors.New("consistency proof is too long")
+		}
+		h, err := base64.StdEncoding.DecodeString(string(line))
+		if err != nil || len(h) != tlog.HashSize {
+			return 0, nil, nil, errors.New("malformed consistency proof line")
+		}
+		proof = append(proof, tlog.Hash(h))
+	}
+	return oldSize, proof, rest, nil
+}
+
+// AddCheckpoint verifies the signed checkpoint and the consistency proof from
+// the latest cosigned checkpoint of its log, of size oldSize, stores it as the
+// latest checkpoint of the log if it's larger, and returns the cosignature
+// note signature lines.
+func (w *Witness) AddCheckpoint(ctx context.Context, oldSize int64, proof tlog.TreeProof, signed []byte) ([]byte, error) {
+	origin, _, _ := bytes.Cut(signed, []byte("\n"))
+	l, ok := w.logs[string(origin)]
+	if !ok {
+		return nil, &witnessError{http.StatusNotFound, fmtErrorf("unknown log %q", origin)}
+	}
+	n, err := note.Open(signed, note.VerifierList(l.v))
+	if err != nil {
+		return nil, &witnessError{http.StatusForbidden, fmtErrorf("invalid checkpoint signature: %w", err)}
+	}
+	c, err := sunlight.ParseCheckpoint(n.Text)
+	if err != nil {
+		return nil, &witnessError{http.StatusBadRequest, fmtErrorf("couldn't parse checkpoint: %w", err)}
+	}
+	if oldSize > c.N {
+		return nil, &witnessError{http.StatusBadRequest, fmtErrorf("old size %d is larger than checkpoint size %d", oldSize, c.N)}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := w.load(ctx, l, string(origin)); err != nil {
+		return nil, err
+	}
+	if oldSize != l.tree.N {
+		return nil, &witnessConflictError{size: l.tree.N}
+	}
+	switch {
+	case oldSize == 0:
+		if len(proof) != 0 {
+			return nil, &witnessError{http.StatusUnprocessableEntity, fmtErrorf("unexpected consistency proof from empty tree")}
+		}
+	case oldSize == c.N:
+		if len(proof) != 0 || c.Hash != l.tree.Hash {
+			return nil, &witnessError{http.StatusConflict, fmtErrorf("checkpoint doesn't match latest cosigned checkpoint of the same size")}
+		}
+	default:
+		if err := tlog.CheckTree(proof, c.N, c.Hash, l.tree.N, l.tree.Hash); err != nil {
+			return nil, &witnessError{http.StatusUnprocessableEntity, fmtErrorf("invalid consistency proof: %w", err)}
+		}
+	}
+
+	// The checkpoint is stored before it's cosigned, so that a witness that
+	// restarts or loses the lock never cosigns an inconsistent checkpoint.
+	if c.N > l.tree.N || l.locked == nil {
+		if l.locked == nil {
+			err = w.c.Lock.Create(ctx, l.id, signed)
+			if err == nil {
+				l.locked, err = w.c.Lock.Fetch(ctx, l.id)
+			}
+		} else {
+			l.locked, err = w.c.Lock.Replace(ctx, l.locked, signed)
+		}
+		if err != nil {
+			// Reload the state from the lock backend at the next request.
+			l.loaded, l.locked, l.tree = false, nil, tlog.Tree{}
+			return nil, fmtErrorf("failed to store checkpoint: %w", err)
+		}
+		l.tree = c.Tree
+		w.c.Log.InfoContext(ctx, "witnessed checkpoint", "origin", c.Origin, "tree_size", c.N)
+	}
+
+	cosigned, err := note.Sign(&note.Note{Text: n.Text}, w.c.Signer)
+	if err != nil {
+		return nil, fmtErrorf("failed to cosign checkpoint: %w", err)
+	}
+	return cosigned[len(n.Text)+1:], nil
+}
+
+// load fetches the latest cosigned checkpoint of l from the lock backend, if
+// it wasn't already. If there is none, the log starts from the empty tree.
+func (w *Witness) load(ctx context.Context, l *witnessedLog, origin string) error {
+	if l.loaded {
+		return nil
+	}
+	locked, err := w.c.Lock.Fetch(ctx, l.id)
+	if err != nil {
+		// If the entry actually exists, storing the first checkpoint will
+		// fail, since Create checks that none exist.
+		w.c.Log.InfoContext(ctx, "no stored checkpoint for witnessed log", "origin", origin, "err", err)
+		l.loaded, l.locked, l.tree = true, nil, tlog.Tree{}
+		return nil
+	}
+	n, err := note.Open(locked.Bytes(), note.VerifierList(l.v))
+	if err != nil {
+		return fmtErrorf("invalid stored checkpoint for %q: %w", origin, err)
+	}
+	c, err := sunlight.ParseCheckpoint(n.Text)
+	if err != nil {
+		return fmtErrorf("couldn't parse stored checkpoint for %q: %w", origin, err)
+	}
+	if c.Origin != origin {
+		return fmtErrorf("stored checkpoint origin is %q, not %q", c.Origin, origin)
+	}
+	l.loaded, l.locked, l.tree = true, locked, c.Tree
+	return nil
+}
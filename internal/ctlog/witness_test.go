@@ -0,0 +1,146 @@
+package ctlog_test
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"filippo.io/sunlight"
+	sunlightclient "filippo.io/sunlight/client"
+	"filippo.io/sunlight/internal/ctlog"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestWitness(t *testing.T) {
+	tl := NewEmptyTestLog(t)
+	tl.Config.MonitoringAPI = true
+	ts := httptest.NewServer(tl.Log.Handler())
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+
+	c, err := sunlightclient.New(&sunlightclient.Config{
+		MonitoringPrefix: ts.URL,
+		Name:             tl.Config.Name,
+		PublicKey:        tl.Config.Key.Public(),
+	})
+	fatalIfErr(t, err)
+	logVerifier, err := sunlight.NewRFC6962Verifier(tl.Config.Name, tl.Config.Key.Public(), nil)
+	fatalIfErr(t, err)
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "example.com/TestWitness")
+	fatalIfErr(t, err)
+	signer, err := note.NewSigner(skey)
+	fatalIfErr(t, err)
+	verifier, err := note.NewVerifier(vkey)
+	fatalIfErr(t, err)
+
+	lock := NewMemoryLockBackend(t)
+	newServer := func() *httptest.Server {
+		w, err := ctlog.NewWitness(&ctlog.WitnessConfig{
+			Signer: signer,
+			Logs:   []ctlog.WitnessedLog{{Origin: tl.Config.Name, Verifier: logVerifier}},
+			Lock:   lock,
+			Log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		})
+		fatalIfErr(t, err)
+		ws := httptest.NewServer(w.Handler())
+		t.Cleanup(ws.Close)
+		return ws
+	}
+	newWitness := func(ws *httptest.Server) *sunlightclient.Witness {
+		w, err := sunlightclient.NewWitness(&sunlightclient.WitnessConfig{URL: ws.URL, Verifier: verifier})
+		fatalIfErr(t, err)
+		return w
+	}
+	submit := func(w *sunlightclient.Witness) *sunlightclient.Checkpoint {
+		t.Helper()
+		cp, err := c.Checkpoint(ctx)
+		fatalIfErr(t, err)
+		cosigned, err := w.Submit(ctx, c, cp)
+		fatalIfErr(t, err)
+		if _, err := note.Open(cosigned, note.VerifierList(verifier)); err != nil {
+			t.Errorf("invalid cosigned checkpoint: %v", err)
+		}
+		return cp
+	}
+	checkStored := func(n int64) {
+		t.Helper()
+		locked, err := lock.Fetch(ctx, ctlog.WitnessLockID(tl.Config.Name))
+		fatalIfErr(t, err)
+		cp, err := c.VerifyCheckpoint(locked.Bytes())
+		fatalIfErr(t, err)
+		if cp.N != n {
+			t.Errorf("stored checkpoint has size %d, expected %d", cp.N, n)
+		}
+	}
+
+	ws := newServer()
+	w := newWitness(ws)
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	submit(w)
+	checkStored(1)
+
+	for i := 0; i < tileWidth+10; i++ {
+		addCertificate(t, tl)
+	}
+	fatalIfErr(t, tl.Log.Sequence())
+	submit(w)
+	checkStored(tileWidth + 11)
+
+	// The same checkpoint is cosigned again.
+	submit(w)
+
+	// A restarted witness loads its state from the lock backend, and a new
+	// client learns it from the conflict response.
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	ws = newServer()
+	cp := submit(newWitness(ws))
+	checkStored(tileWidth + 12)
+
+	var conflict *sunlightclient.WitnessConflictError
+	if _, err := newWitness(ws).AddCheckpoint(ctx, 0, nil, cp.Signed); !errors.As(err, &conflict) {
+		t.Errorf("got %v, expected a conflict", err)
+	} else if conflict.Size != cp.N {
+		t.Errorf("got conflict size %d, expected %d", conflict.Size, cp.N)
+	}
+
+	addCertificate(t, tl)
+	fatalIfErr(t, tl.Log.Sequence())
+	next, err := c.Checkpoint(ctx)
+	fatalIfErr(t, err)
+	proof, err := c.ConsistencyProof(ctx, next.Tree, cp.N)
+	fatalIfErr(t, err)
+	bad := slices.Clone(proof)
+	bad[0][0] ^= 1
+	if _, err := newWitness(ws).AddCheckpoint(ctx, cp.N, bad, next.Signed); err == nil {
+		t.Error("accepted an invalid consistency proof")
+	}
+
+	// Checkpoints of unknown logs, or not signed by the log key, are rejected.
+	forged, err := note.Sign(&note.Note{Text: sunlight.FormatCheckpoint(sunlight.Checkpoint{
+		Origin: tl.Config.Name, Tree: tlog.Tree{N: next.N + 1, Hash: next.Hash},
+	})}, signer)
+	fatalIfErr(t, err)
+	if _, err := newWitness(ws).AddCheckpoint(ctx, cp.N, proof, forged); err == nil {
+		t.Error("accepted a checkpoint not signed by the log")
+	}
+	unknown, err := note.Sign(&note.Note{Text: sunlight.FormatCheckpoint(sunlight.Checkpoint{
+		Origin: "example.com/unknown", Tree: next.Tree,
+	})}, signer)
+	fatalIfErr(t, err)
+	if _, err := newWitness(ws).AddCheckpoint(ctx, 0, nil, unknown); err == nil {
+		t.Error("accepted a checkpoint of an unknown log")
+	}
+	checkStored(cp.N)
+
+	submit(newWitness(ws))
+	checkStored(next.N)
+}
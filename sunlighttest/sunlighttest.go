@@ -0,0 +1,326 @@
+// Package sunlighttest runs a complete Sunlight log in-process, for the
+// integration tests of CA software and other Certificate Transparency
+// clients.
+//
+// [NewLog] creates a log with a fresh key, in-memory or MinIO-backed storage,
+// and an in-memory lock, serves its submission and monitoring APIs from an
+// [httptest.Server], and tears everything down when the test ends. The
+// software under test can be pointed at [Log.URL] like at any other log, and
+// the test can then check what was logged with [Log.Entries] or [Log.Client].
+//
+// Submissions return after a sequencing round, which by default runs every
+// 50ms, so the log is immediately consistent for the submitter.
+package sunlighttest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"filippo.io/sunlight/ctlog"
+	internal "filippo.io/sunlight/internal/ctlog"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// Config is the configuration of a [Log]. All fields are optional, except
+// Roots.
+type Config struct {
+	// Name is the name of the log, which is also the origin line of its
+	// checkpoints. Defaults to "example.com/sunlighttest".
+	Name string
+
+	// Roots are the accepted roots.
+	Roots []*x509.Certificate
+
+	// NotAfterStart and NotAfterLimit bound the NotAfter of the accepted
+	// certificates, as in a temporal shard. The zero values mean no lower and
+	// no upper bound, respectively.
+	NotAfterStart time.Time
+	NotAfterLimit time.Time
+
+	// Backend stores the tiles, checkpoint, and issuers. Defaults to a new
+	// [ctlog.MemoryBackend]. See also [MinIOBackend].
+	Backend ctlog.Backend
+
+	// SequencingPeriod is how often pending submissions are sequenced.
+	// Defaults to 50ms.
+	SequencingPeriod time.Duration
+
+	// Logger is where the log events are written. Defaults to the test log,
+	// at the warning level.
+	Logger *slog.Logger
+}
+
+// Log is a running log, and an HTTP server for it.
+type Log struct {
+	// Name is the name of the log.
+	Name string
+
+	// Key is the signing key of the log, generated by [NewLog].
+	Key *ecdsa.PrivateKey
+
+	// URL is the submission and monitoring prefix of the log, such as
+	// "http://127.0.0.1:1234/", which ends in a slash.
+	URL string
+
+	// Log is the underlying log.
+	Log *ctlog.Log
+
+	// Server is the HTTP server of the log.
+	Server *httptest.Server
+
+	// Client is a monitoring API client for the log.
+	Client *client.Client
+}
+
+// NewLog starts a new empty log for config, which may be nil, and stops it
+// when the test ends.
+func NewLog(t testing.TB, config *Config) *Log {
+	t.Helper()
+	if config == nil {
+		config = &Config{}
+	}
+	if len(config.Roots) == 0 {
+		t.Fatal("sunlighttest: Config.Roots is required")
+	}
+	l := &Log{Name: config.Name}
+	if l.Name == "" {
+		l.Name = "example.com/sunlighttest"
+	}
+	period := config.SequencingPeriod
+	if period <= 0 {
+		period = 50 * time.Millisecond
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(testWriter{t}, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	}
+
+	var err error
+	l.Key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("sunlighttest: couldn't generate log key: %v", err)
+	}
+	l.Log, err = ctlog.NewLog(context.Background(), &ctlog.Config{
+		Name:             l.Name,
+		Key:              l.Key,
+		Roots:            config.Roots,
+		NotAfterStart:    config.NotAfterStart,
+		NotAfterLimit:    config.NotAfterLimit,
+		Backend:          config.Backend,
+		SequencingPeriod: period,
+		Logger:           logger,
+	})
+	if err != nil {
+		t.Fatalf("sunlighttest: %v", err)
+	}
+	if err := l.Log.Start(); err != nil {
+		l.Log.Close()
+		t.Fatalf("sunlighttest: %v", err)
+	}
+	l.Server = httptest.NewServer(l.Log.Handler())
+	// Close the server first, so that no request is pending when the log is
+	// closed. Cleanup functions run in reverse order.
+	t.Cleanup(func() {
+		if err := l.Log.Close(); err != nil {
+			t.Errorf("sunlighttest: %v", err)
+		}
+	})
+	t.Cleanup(l.Server.Close)
+	l.URL = l.Server.URL + "/"
+
+	l.Client, err = client.New(&client.Config{
+		MonitoringPrefix: l.URL,
+		Name:             l.Name,
+		PublicKey:        l.Key.Public(),
+		HTTPClient:       l.Server.Client(),
+		UserAgent:        "filippo.io/sunlight/sunlighttest",
+		PollInterval:     period,
+	})
+	if err != nil {
+		t.Fatalf("sunlighttest: couldn't create client: %v", err)
+	}
+	return l
+}
+
+type testWriter struct{ t testing.TB }
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Logf("%s", bytes.TrimSuffix(p, []byte("\n")))
+	return len(p), nil
+}
+
+// LogID returns the RFC 6962 log ID, the SHA-256 hash of the log public key.
+func (l *Log) LogID() [sha256.Size]byte {
+	id, err := l.Client.LogID()
+	if err != nil {
+		panic("sunlighttest: couldn't compute log ID: " + err.Error())
+	}
+	return id
+}
+
+// AddChain submits chain, starting with the leaf certificate, to
+// add-chain and returns the TLS-encoded SCT, which can be parsed with
+// [client.ParseSCT] or included in a SignedCertificateTimestampList.
+func (l *Log) AddChain(ctx context.Context, chain [][]byte) ([]byte, error) {
+	return l.submit(ctx, "ct/v1/add-chain", chain)
+}
+
+// AddPreChain is like [Log.AddChain], but submits a precertificate chain to
+// add-pre-chain.
+func (l *Log) AddPreChain(ctx context.Context, chain [][]byte) ([]byte, error) {
+	return l.submit(ctx, "ct/v1/add-pre-chain", chain)
+}
+
+func (l *Log) submit(ctx context.Context, path string, chain [][]byte) ([]byte, error) {
+	body, err := json.Marshal(struct{ Chain [][]byte }{chain})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", l.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := l.Server.Client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sunlighttest: %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("sunlighttest: %s failed: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sunlighttest: %s failed with %s: %s",
+			path, resp.Status, strings.TrimSpace(string(b)))
+	}
+	var r struct {
+		SCTVersion uint8  `json:"sct_version"`
+		ID         []byte `json:"id"`
+		Timestamp  uint64 `json:"timestamp"`
+		Extensions []byte `json:"extensions"`
+		Signature  []byte `json:"signature"`
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("sunlighttest: invalid %s response: %w", path, err)
+	}
+	// The signature is already a TLS-encoded DigitallySigned structure.
+	sct := &cryptobyte.Builder{}
+	sct.AddUint8(r.SCTVersion)
+	sct.AddBytes(r.ID)
+	sct.AddUint64(r.Timestamp)
+	sct.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(r.Extensions)
+	})
+	sct.AddBytes(r.Signature)
+	return sct.Bytes()
+}
+
+// Checkpoint fetches and verifies the latest checkpoint of the log.
+func (l *Log) Checkpoint(ctx context.Context) (*client.Checkpoint, error) {
+	return l.Client.Checkpoint(ctx)
+}
+
+// Entries returns all the entries in the latest checkpoint of the log, read
+// from its data tiles and verified against the checkpoint.
+func (l *Log) Entries(ctx context.Context) ([]*client.Entry, error) {
+	cp, err := l.Client.Checkpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*client.Entry
+	for e, err := range l.Client.Entries(ctx, tlog.Tree{N: cp.N, Hash: cp.Hash}, 0) {
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// ReadTile fetches a hash tile, or a data tile if t.L is -1, from the
+// monitoring API. The tile is not verified.
+func (l *Log) ReadTile(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	return l.Client.ReadTile(ctx, t)
+}
+
+// MinIOBackend returns a [ctlog.Backend] that stores the objects in a MinIO
+// (or other S3-compatible) bucket, identified by a URL like
+// "http://localhost:9000/bucket". The credentials are read from the standard
+// AWS environment variables, such as AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY.
+//
+// Each call uses a new key prefix in the bucket, so tests can share it. The
+// objects are not deleted when the test ends.
+func MinIOBackend(t testing.TB, bucketURL string) ctlog.Backend {
+	t.Helper()
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		t.Fatalf("sunlighttest: invalid MinIO URL: %v", err)
+	}
+	bucket := strings.Trim(u.Path, "/")
+	if bucket == "" || strings.Contains(bucket, "/") {
+		t.Fatalf("sunlighttest: MinIO URL %q must have the bucket as its path", bucketURL)
+	}
+	u.Path = ""
+	prefix := fmt.Sprintf("sunlighttest/%s/%d/", t.Name(), time.Now().UnixNano())
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	b, err := internal.NewS3Backend(context.Background(), "us-east-1", bucket, u.String(), prefix, logger)
+	if err != nil {
+		t.Fatalf("sunlighttest: %v", err)
+	}
+	// MinIO supports conditional writes, which protect the immutable tiles
+	// like in production.
+	f, err := internal.NewFeatures(map[string]bool{string(internal.FeatureConditionalWrites): true})
+	if err != nil {
+		t.Fatalf("sunlighttest: %v", err)
+	}
+	b.SetFeatures(f)
+	return b
+}
+
+// EntryForSCT returns the entry that sct, as returned by [Log.AddChain] or
+// [Log.AddPreChain], was issued for, after verifying its SCT signature and
+// inclusion in the latest checkpoint.
+func (l *Log) EntryForSCT(ctx context.Context, sct []byte) (*client.Entry, error) {
+	s, err := client.ParseSCT(sct)
+	if err != nil {
+		return nil, fmt.Errorf("sunlighttest: %w", err)
+	}
+	idx, err := s.LeafIndex()
+	if err != nil {
+		return nil, fmt.Errorf("sunlighttest: %w", err)
+	}
+	entries, err := l.Entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if idx >= int64(len(entries)) {
+		return nil, fmt.Errorf("sunlighttest: entry %d is not in the log", idx)
+	}
+	e := entries[idx]
+	if e.Timestamp != s.Timestamp {
+		return nil, fmt.Errorf("sunlighttest: entry %d has timestamp %d, SCT has %d", idx, e.Timestamp, s.Timestamp)
+	}
+	if err := l.Client.VerifySCT(s, e); err != nil {
+		return nil, fmt.Errorf("sunlighttest: %w", err)
+	}
+	return e, nil
+}
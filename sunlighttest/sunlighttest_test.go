@@ -0,0 +1,90 @@
+package sunlighttest_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight/client"
+	"filippo.io/sunlight/sunlighttest"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestAddChain(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		DNSNames:     []string{"example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, root, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	l := sunlighttest.NewLog(t, &sunlighttest.Config{Roots: []*x509.Certificate{root}})
+	sctBytes, err := l.AddChain(ctx, [][]byte{leaf, rootDER})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// EntryForSCT verifies the SCT signature against the logged entry.
+	e, err := l.EntryForSCT(ctx, sctBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.IsPrecert || !bytes.Equal(e.Certificate, leaf) {
+		t.Errorf("logged entry doesn't match the submitted certificate")
+	}
+	sct, err := client.ParseSCT(sctBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sct.LogID != l.LogID() {
+		t.Errorf("got SCT log ID %x, expected %x", sct.LogID, l.LogID())
+	}
+
+	cp, err := l.Checkpoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := tlog.Tree{N: cp.N, Hash: cp.Hash}
+	proof, err := tlog.ProveRecord(tree.N, e.LeafIndex, l.Client.HashReader(ctx, tree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tlog.CheckRecord(proof, tree.N, tree.Hash, e.LeafIndex, tlog.RecordHash(e.MerkleTreeLeaf())); err != nil {
+		t.Errorf("inclusion proof doesn't verify: %v", err)
+	}
+}